@@ -1,12 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/alehatsman/mooncake/internal/actions"
+	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/facts"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/sinks"
+	"github.com/alehatsman/mooncake/internal/vault"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 	"github.com/urfave/cli/v2"
 )
 
@@ -217,7 +231,7 @@ func TestCreateApp(t *testing.T) {
 	}
 
 	// Test commands exist
-	expectedCommands := []string{"presets", "docs", "schema", "run", "plan", "facts", "actions", "validate", "agent"}
+	expectedCommands := []string{"presets", "docs", "schema", "mcp", "serve", "vault", "run", "undo", "drift", "plan", "keygen", "facts", "actions", "validate", "agent"}
 	if len(app.Commands) != len(expectedCommands) {
 		t.Errorf("app.Commands length = %d, expected %d", len(app.Commands), len(expectedCommands))
 	}
@@ -247,7 +261,7 @@ func TestPresetsCommand(t *testing.T) {
 	}
 
 	// Test subcommands exist
-	expectedSubcommands := []string{"add", "list", "info", "install", "status", "uninstall"}
+	expectedSubcommands := []string{"add", "list", "info", "install", "status", "uninstall", "sign", "manifest", "trust"}
 	if len(cmd.Subcommands) != len(expectedSubcommands) {
 		t.Errorf("cmd.Subcommands length = %d, expected %d", len(cmd.Subcommands), len(expectedSubcommands))
 	}
@@ -553,6 +567,11 @@ func TestConstants(t *testing.T) {
 			value:    yamlIndentSpaces,
 			expected: 2,
 		},
+		{
+			name:     "exitCodeStepFailed",
+			value:    exitCodeStepFailed,
+			expected: 1,
+		},
 		{
 			name:     "exitCodeValidationError",
 			value:    exitCodeValidationError,
@@ -563,6 +582,16 @@ func TestConstants(t *testing.T) {
 			value:    exitCodeRuntimeError,
 			expected: 3,
 		},
+		{
+			name:     "exitCodeCancelled",
+			value:    exitCodeCancelled,
+			expected: 130,
+		},
+		{
+			name:     "exitCodeDrift",
+			value:    exitCodeDrift,
+			expected: 2,
+		},
 	}
 
 	for _, tt := range tests {
@@ -592,9 +621,10 @@ func TestRunCommandFlags(t *testing.T) {
 
 	expectedFlags := []string{
 		"config", "vars", "log-level", "sudo-pass", "ask-become-pass",
-		"sudo-pass-file", "insecure-sudo-pass", "tags", "raw", "dry-run",
-		"output-format", "artifacts-dir", "capture-full-output",
-		"max-output-bytes", "max-output-lines", "from-plan", "facts-json",
+		"sudo-pass-file", "insecure-sudo-pass", "tags", "raw", "dry-run", "keep-going",
+		"parallel", "timeout", "output-format", "artifacts-dir", "capture-full-output",
+		"max-output-bytes", "max-output-lines", "from-plan", "resume", "start-at-step", "force", "diff", "host", "root", "inventory", "limit", "concurrency", "fail-fast", "continue",
+		"facts-json", "verify-key", "allow-drift", "policy",
 	}
 
 	flagNames := make(map[string]bool)
@@ -607,6 +637,8 @@ func TestRunCommandFlags(t *testing.T) {
 			flagNames[f.Name] = true
 		case *cli.IntFlag:
 			flagNames[f.Name] = true
+		case *cli.DurationFlag:
+			flagNames[f.Name] = true
 		}
 	}
 
@@ -634,7 +666,7 @@ func TestPlanCommandFlags(t *testing.T) {
 	}
 
 	expectedFlags := []string{
-		"config", "vars", "tags", "format", "show-origins", "output",
+		"config", "vars", "tags", "format", "show-origins", "output", "diff", "policy",
 	}
 
 	flagNames := make(map[string]bool)
@@ -703,7 +735,7 @@ func TestValidateCommandFlags(t *testing.T) {
 		t.Fatal("validate command not found")
 	}
 
-	expectedFlags := []string{"config", "vars", "format"}
+	expectedFlags := []string{"config", "vars", "format", "policy"}
 
 	flagNames := make(map[string]bool)
 	for _, flag := range validateCmd.Flags {
@@ -720,11 +752,57 @@ func TestValidateCommandFlags(t *testing.T) {
 	}
 }
 
+// TestAgentRunCommandFlags tests that agent run command has all expected flags
+func TestAgentRunCommandFlags(t *testing.T) {
+	app := createApp()
+
+	var runCmd *cli.Command
+	for _, cmd := range app.Commands {
+		if cmd.Name == "agent" {
+			for _, sub := range cmd.Subcommands {
+				if sub.Name == "run" {
+					runCmd = sub
+				}
+			}
+		}
+	}
+
+	if runCmd == nil {
+		t.Fatal("agent run command not found")
+	}
+
+	expectedFlags := []string{
+		"goal", "plan", "stdin", "provider", "model", "max-iterations", "policy",
+		"sandbox", "sandbox-network", "sandbox-cpu", "sandbox-memory", "sandbox-timeout",
+	}
+
+	flagNames := make(map[string]bool)
+	for _, flag := range runCmd.Flags {
+		flagNames[flag.Names()[0]] = true
+	}
+
+	for _, expectedFlag := range expectedFlags {
+		if !flagNames[expectedFlag] {
+			t.Errorf("agent run command missing flag: %s", expectedFlag)
+		}
+	}
+}
+
+// TestAgentRunSandboxFlagsRequireSandbox tests that the limits of the sandbox
+// aren't silently ignored without --sandbox
+func TestAgentRunSandboxFlagsRequireSandbox(t *testing.T) {
+	app := createApp()
+	err := app.Run([]string{"mooncake", "agent", "run", "--goal", "test", "--plan", "plan.yml", "--sandbox-network"})
+	if err == nil || !strings.Contains(err.Error(), "--sandbox-network requires --sandbox") {
+		t.Errorf("agent run error = %v, want --sandbox required", err)
+	}
+}
+
 // TestPresetsCommandFlags tests that presets command has expected flags
 func TestPresetsCommandFlags(t *testing.T) {
 	cmd := presetsCommand()
 
-	expectedFlags := []string{"ask-become-pass", "sudo-pass", "sudo-pass-file", "insecure-sudo-pass"}
+	expectedFlags := []string{"ask-become-pass", "sudo-pass", "sudo-pass-file", "insecure-sudo-pass", "require-signed"}
 
 	flagNames := make(map[string]bool)
 	for _, flag := range cmd.Flags {
@@ -759,7 +837,7 @@ func TestPresetsInstallSubcommandFlags(t *testing.T) {
 		t.Fatal("install subcommand not found")
 	}
 
-	expectedFlags := []string{"ask-become-pass", "sudo-pass", "sudo-pass-file", "insecure-sudo-pass"}
+	expectedFlags := []string{"ask-become-pass", "sudo-pass", "sudo-pass-file", "insecure-sudo-pass", "require-signed"}
 
 	flagNames := make(map[string]bool)
 	for _, flag := range installCmd.Flags {
@@ -778,6 +856,25 @@ func TestPresetsInstallSubcommandFlags(t *testing.T) {
 	}
 }
 
+// TestPresetsAddRequireSigned tests that --require-signed refuses unsigned
+// presets before they are added
+func TestPresetsAddRequireSigned(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	source := filepath.Join(t.TempDir(), "unsigned.yml")
+	if err := os.WriteFile(source, []byte("name: unsigned\nsteps:\n  - print: hi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := createApp()
+	err := app.Run([]string{"mooncake", "presets", "add", "--require-signed", source})
+	if err == nil || !strings.Contains(err.Error(), "preset is not signed") {
+		t.Fatalf("presets add error = %v, want the unsigned preset refused", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(os.Getenv("HOME"), ".mooncake", "presets", "unsigned.yml")); !os.IsNotExist(statErr) {
+		t.Error("the unsigned preset was installed")
+	}
+}
+
 // TestPresetsUninstallSubcommandFlags tests uninstall subcommand flags
 func TestPresetsUninstallSubcommandFlags(t *testing.T) {
 	cmd := presetsCommand()
@@ -1806,34 +1903,14 @@ func TestRunCommandPasswordFlags(t *testing.T) {
 	}
 }
 
-// TestPlanCommandRequiredFlags tests that plan command has config as required
+// TestPlanCommandRequiredFlags tests that plan command requires config. It isn't
+// a Required flag, as that would also apply to the plan diff subcommand.
 func TestPlanCommandRequiredFlags(t *testing.T) {
 	app := createApp()
 
-	var planCmd *cli.Command
-	for _, cmd := range app.Commands {
-		if cmd.Name == "plan" {
-			planCmd = cmd
-			break
-		}
-	}
-
-	if planCmd == nil {
-		t.Fatal("plan command not found")
-	}
-
-	// Check that config flag is required
-	hasRequiredConfig := false
-	for _, flag := range planCmd.Flags {
-		if f, ok := flag.(*cli.StringFlag); ok && f.Name == "config" {
-			if f.Required {
-				hasRequiredConfig = true
-			}
-		}
-	}
-
-	if !hasRequiredConfig {
-		t.Error("plan command config flag should be required")
+	err := app.Run([]string{"mooncake", "plan"})
+	if err == nil || !contains(err.Error(), "--config is required") {
+		t.Errorf("plan without --config error = %v, want --config is required", err)
 	}
 }
 
@@ -1879,6 +1956,9 @@ func TestPresetsSubcommandActions(t *testing.T) {
 		"install":   true,
 		"status":    true,
 		"uninstall": true,
+		"sign":      true,
+		"manifest":  true,
+		"trust":     true,
 	}
 
 	for _, subcmd := range cmd.Subcommands {
@@ -1887,8 +1967,15 @@ func TestPresetsSubcommandActions(t *testing.T) {
 			continue
 		}
 
-		if subcmd.Action == nil {
-			t.Errorf("subcommand %s should have an action", subcmd.Name)
+		// Groups of subcommands have actions on their subcommands
+		commands := subcmd.Subcommands
+		if len(commands) == 0 {
+			commands = []*cli.Command{subcmd}
+		}
+		for _, command := range commands {
+			if command.Action == nil {
+				t.Errorf("subcommand %s should have an action", command.FullName())
+			}
 		}
 
 		delete(expectedSubcommands, subcmd.Name)
@@ -2501,3 +2588,753 @@ func TestFactsCommandFormatFlag(t *testing.T) {
 		t.Error("facts command should have format flag")
 	}
 }
+
+func TestSignedPlanVerification(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yml")
+	if err := os.WriteFile(configPath, []byte("- shell: echo hello\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(tmpDir, "plan.key")
+	planPath := filepath.Join(tmpDir, "plan.json")
+
+	app := createApp()
+	if err := app.Run([]string{"mooncake", "keygen", "--out", keyPath}); err != nil {
+		t.Fatalf("keygen failed: %v", err)
+	}
+	if err := app.Run([]string{"mooncake", "plan", "--config", configPath, "--sign-key", keyPath}); err == nil {
+		t.Error("plan --sign-key without --output should fail")
+	}
+	if err := app.Run([]string{"mooncake", "plan", "--config", configPath, "--sign-key", keyPath, "--output", planPath}); err != nil {
+		t.Fatalf("plan --sign-key failed: %v", err)
+	}
+
+	signed, err := plan.LoadPlanFromFile(planPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPlan(signed, facts.Collect(), keyPath+".pub", false); err != nil {
+		t.Errorf("verifyPlan() of an unchanged signed plan = %v", err)
+	}
+
+	// Source drift refuses the plan unless allowed
+	if err := os.WriteFile(configPath, []byte("- shell: echo changed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPlan(signed, facts.Collect(), keyPath+".pub", false); err == nil || !contains(err.Error(), "--allow-drift") {
+		t.Errorf("verifyPlan() with a changed source = %v, want a drift error", err)
+	}
+	if err := verifyPlan(signed, facts.Collect(), keyPath+".pub", true); err != nil {
+		t.Errorf("verifyPlan() with --allow-drift = %v, want nil", err)
+	}
+
+	// A bad signature is never allowed
+	otherKey := filepath.Join(tmpDir, "other.key")
+	if err := app.Run([]string{"mooncake", "keygen", "--out", otherKey}); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyPlan(signed, facts.Collect(), otherKey+".pub", true); err == nil || !contains(err.Error(), "trusted key") {
+		t.Errorf("verifyPlan() with another key = %v, want a signature error", err)
+	}
+	signed.Steps[0].Name = "tampered"
+	if err := verifyPlan(signed, facts.Collect(), "", true); err == nil || !contains(err.Error(), "modified after signing") {
+		t.Errorf("verifyPlan() of a tampered plan = %v, want a signature error", err)
+	}
+}
+
+func TestPlanDiffCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	configPath := write("config.yml", "- name: greet\n  shell: echo hello\n")
+	oldPlan := filepath.Join(tmpDir, "old.json")
+	newPlan := filepath.Join(tmpDir, "new.json")
+
+	app := createApp()
+	if err := app.Run([]string{"mooncake", "plan", "--config", configPath, "--output", oldPlan}); err != nil {
+		t.Fatal(err)
+	}
+	write("config.yml", "- name: greet\n  shell: echo hi\n- name: done\n  print: done\n")
+	if err := app.Run([]string{"mooncake", "plan", "--config", configPath, "--output", newPlan}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"text", "json", "markdown"} {
+		if err := app.Run([]string{"mooncake", "plan", "diff", "--format", format, oldPlan, newPlan}); err != nil {
+			t.Errorf("plan diff --format %s failed: %v", format, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"invalid format", []string{"--format", "html", oldPlan, newPlan}, "invalid format"},
+		{"one plan", []string{oldPlan}, "needs two plan files"},
+		{"plans and base", []string{"--base", "HEAD", oldPlan, newPlan}, "can't be combined"},
+		{"base without config", []string{"--base", "HEAD"}, "--base requires --config"},
+		{"missing plan", []string{oldPlan, filepath.Join(tmpDir, "missing.json")}, "failed to load plan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := app.Run(append([]string{"mooncake", "plan", "diff"}, tt.args...))
+			if err == nil || !contains(err.Error(), tt.want) {
+				t.Errorf("plan diff error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPlanAtRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := t.TempDir()
+	runGit := func(args ...string) {
+		t.Helper()
+		if _, err := git(repo, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	configPath := filepath.Join(repo, "config.yml")
+	if err := os.MkdirAll(filepath.Join(repo, "tasks"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, []byte("- include: tasks/main.yml\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Template and copy sources resolve to absolute paths in the checkout
+	sources := "- template:\n    src: motd.j2\n    dest: /tmp/motd\n- copy:\n    src: motd.j2\n    dest: /tmp/motd.copy\n"
+	if err := os.WriteFile(filepath.Join(repo, "tasks", "main.yml"), []byte("- shell: echo v1\n"+sources), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "tasks", "motd.j2"), []byte("hello\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	runGit("init", "-q")
+	runGit("add", "-A")
+	runGit("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "v1")
+	if err := os.WriteFile(filepath.Join(repo, "tasks", "main.yml"), []byte("- shell: echo v2\n"+sources), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldPlan, err := buildPlanAtRevision(configPath, "", nil, "HEAD")
+	if err != nil {
+		t.Fatalf("buildPlanAtRevision() error = %v", err)
+	}
+	newPlan, err := buildPlan(configPath, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := plan.DiffPlans(oldPlan, newPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Modified) != 1 || diff.Modified[0].New.Origin != "tasks/main.yml:1" ||
+		diff.Modified[0].Fields[0].Old != "echo v1" || diff.Unchanged != 2 {
+		t.Errorf("DiffPlans() = %+v, want the shell command modified", diff)
+	}
+
+	if _, err := buildPlanAtRevision(configPath, "", nil, "no-such-rev"); err == nil {
+		t.Error("buildPlanAtRevision() with an unknown revision should fail")
+	}
+}
+
+func TestWritePlanDiff(t *testing.T) {
+	diff := &plan.Diff{
+		Added:   []plan.StepRef{{ID: "step-0001", Name: "check", Action: "shell", Origin: "main.yml:1"}},
+		Removed: []plan.StepRef{{ID: "step-0009", Action: "print", Handler: true}},
+		Modified: []plan.StepChange{{
+			Old: plan.StepRef{ID: "step-0002", Name: "config", Action: "file", Origin: "main.yml:3"},
+			New: plan.StepRef{ID: "step-0003", Name: "config", Action: "file", Origin: "main.yml:5"},
+			Fields: []plan.FieldChange{
+				{Path: "file.content", Old: "a|b", New: "c"},
+				{Path: "when", New: "os == 'linux'"},
+			},
+		}},
+		Unchanged: 4,
+	}
+
+	var text bytes.Buffer
+	writePlanDiffText(&text, "old.json", "new.json", diff)
+	want := `Plan diff: old.json -> new.json
+
+- [step-0009] (handler, print)
++ [step-0001] check (shell) main.yml:1
+~ [step-0002 -> step-0003] config (file) main.yml:5
+    file.content: "a|b" -> "c"
+    when: (none) -> "os == 'linux'"
+
+1 added, 1 removed, 1 modified, 4 unchanged
+`
+	if text.String() != want {
+		t.Errorf("text output =\n%s\nwant\n%s", text.String(), want)
+	}
+
+	var markdown bytes.Buffer
+	writePlanDiffMarkdown(&markdown, "old.json", "new.json", diff)
+	for _, line := range []string{
+		"`old.json` → `new.json`: 1 added, 1 removed, 1 modified, 4 unchanged",
+		"- `step-0001` **check** (shell) — `main.yml:1`",
+		"| `file.content` | `\"a\\|b\"` | `\"c\"` |",
+		"| `when` | (none) | `\"os == 'linux'\"` |",
+	} {
+		if !contains(markdown.String(), line) {
+			t.Errorf("markdown output missing %q:\n%s", line, markdown.String())
+		}
+	}
+
+	var empty bytes.Buffer
+	writePlanDiffText(&empty, "a", "b", &plan.Diff{Unchanged: 2})
+	if !contains(empty.String(), "no changes, 2 steps unchanged") {
+		t.Errorf("empty diff output = %q", empty.String())
+	}
+}
+
+func TestDriftCommandInvalidFormat(t *testing.T) {
+	app := createApp()
+	err := app.Run([]string{"mooncake", "drift", "--config", "config.yml", "--format", "yaml"})
+	if err == nil || !contains(err.Error(), "invalid format") {
+		t.Errorf("drift with yaml format error = %v, want invalid format", err)
+	}
+}
+
+func TestWriteDriftText(t *testing.T) {
+	report := &executor.DriftReport{
+		CheckedSteps: 3,
+		Drifted: []executor.DriftedStep{
+			{
+				StepID: "step-0001",
+				Name:   "app config",
+				Action: "file",
+				Resources: []actions.Drift{
+					{Kind: actions.DriftFile, Resource: "/etc/app.conf", Detail: "content differs"},
+				},
+				Diff: "--- /etc/app.conf\n+++ /etc/app.conf\n@@ -1 +1 @@\n-port=80\n+port=8080\n",
+			},
+			{
+				StepID: "step-0002",
+				Name:   "nginx",
+				Action: "package",
+				Resources: []actions.Drift{
+					{Kind: actions.DriftPackage, Resource: "nginx", Detail: "not installed"},
+				},
+			},
+		},
+		Unchecked: []executor.UncheckedStep{
+			{StepID: "step-0003", Name: "migrate", Action: "shell", Reason: "action can't be checked"},
+		},
+	}
+
+	var buf bytes.Buffer
+	writeDriftText(&buf, report)
+	want := `Drifted:
+  app config [step-0001]
+    file /etc/app.conf: content differs
+      --- /etc/app.conf
+      +++ /etc/app.conf
+      @@ -1 +1 @@
+      -port=80
+      +port=8080
+  nginx [step-0002]
+    package nginx: not installed
+
+Not checked:
+  migrate [step-0003] (shell): action can't be checked
+
+Drift: 2 resources in 2 of 3 checked steps, 1 not checked
+`
+	if buf.String() != want {
+		t.Errorf("writeDriftText() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	writeDriftText(&buf, &executor.DriftReport{CheckedSteps: 2})
+	if buf.String() != "No drift: 2 steps checked\n" {
+		t.Errorf("writeDriftText() without drift = %q", buf.String())
+	}
+}
+
+func TestRunInventoryFlags(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yml")
+	if err := os.WriteFile(configPath, []byte("- name: greet\n  print: hello\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	inventoryPath := filepath.Join(tmpDir, "hosts.yml")
+	if err := os.WriteFile(inventoryPath, []byte("hosts:\n  here:\n    connection: local\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"limit without inventory", []string{"--limit", "web"}, "--limit requires --inventory"},
+		{"fail-fast without inventory", []string{"--fail-fast"}, "--fail-fast requires --inventory"},
+		{"inventory and host", []string{"-i", inventoryPath, "--host", "box"}, "cannot be combined with --host"},
+		{"inventory and resume", []string{"-i", inventoryPath, "--resume", "run"}, "cannot be combined with --resume"},
+		{"fail-fast and continue", []string{"-i", inventoryPath, "--fail-fast", "--continue"}, "mutually exclusive"},
+		{"no concurrency", []string{"-i", inventoryPath, "--concurrency", "0"}, "at least 1"},
+		{"unknown host", []string{"-i", inventoryPath, "--limit", "web"}, `no hosts match "web"`},
+		{"missing inventory", []string{"-i", filepath.Join(tmpDir, "missing.yml")}, "failed to read inventory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"mooncake", "run", "--config", configPath}, tt.args...)
+			err := createApp().Run(args)
+			if err == nil || !contains(err.Error(), tt.want) {
+				t.Errorf("run %v error = %v, want %q", tt.args, err, tt.want)
+			}
+		})
+	}
+
+	args := []string{"mooncake", "run", "--config", configPath, "-i", inventoryPath, "--limit", "here", "--raw"}
+	if err := createApp().Run(args); err != nil {
+		t.Errorf("run with an inventory error = %v", err)
+	}
+}
+
+func TestWriteHostsSummary(t *testing.T) {
+	summary := &executor.HostsSummary{
+		Hosts: []executor.HostResult{
+			{Host: "web1", Status: executor.HostStatusSuccess, ChangedSteps: 2, DurationMs: 1200},
+			{Host: "db-primary", Status: executor.HostStatusFailed, ChangedSteps: 1, FailedSteps: 1, DurationMs: 800,
+				Error:         "step failed\ndetails",
+				ResumeCommand: "mooncake run --resume r1 --artifacts-dir .mooncake/hosts/db-primary --host db1"},
+			{Host: "web2", Status: executor.HostStatusSkipped},
+		},
+		Succeeded: 1, Failed: 1, Skipped: 1, Changed: 2,
+	}
+
+	var buf bytes.Buffer
+	writeHostsSummary(&buf, summary)
+	want := `
+HOST        STATUS      CHANGED   FAILED   DURATION
+web1        success           2        0     1200ms
+db-primary  failed            1        1      800ms
+web2        skipped           0        0        0ms
+
+Failures:
+  db-primary: step failed
+    Resume with: mooncake run --resume r1 --artifacts-dir .mooncake/hosts/db-primary --host db1
+
+Hosts: 1 ok, 1 failed, 1 skipped; 2 changed
+`
+	if buf.String() != want {
+		t.Errorf("writeHostsSummary() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestRunRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "image")
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", "os-release"), []byte("ID=debian\nVERSION_ID=12\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(tmpDir, "config.yml")
+	config := "- name: motd\n  file:\n    path: /etc/motd\n    content: \"{{ distribution }}\"\n"
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"mooncake", "run", "--config", configPath, "--root", root, "--host", "box"}
+	if err := createApp().Run(args); err == nil || !contains(err.Error(), "--root cannot be combined with --host") {
+		t.Errorf("run with --root and --host error = %v", err)
+	}
+
+	args = []string{"mooncake", "run", "--config", configPath, "--root", root, "--raw"}
+	if err := createApp().Run(args); err != nil {
+		t.Fatalf("run with --root error = %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(root, "etc", "motd"))
+	if err != nil || string(content) != "debian" {
+		t.Errorf("file in the root = %q, %v, want %q", content, err, "debian")
+	}
+}
+
+func TestMCPCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yml")
+	if err := os.WriteFile(configPath, []byte("- name: greet\n  print: hello\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	app := createApp()
+	app.Reader = bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"validate","arguments":{"config":"` + configPath + `"}}}` + "\n")
+	app.Writer = &out
+	if err := app.Run([]string{"mooncake", "mcp", "--artifacts-dir", filepath.Join(tmpDir, "artifacts")}); err != nil {
+		t.Fatalf("mcp error = %v", err)
+	}
+	if !contains(out.String(), `"structuredContent":{"valid":true}`) {
+		t.Errorf("mcp output = %s", out.String())
+	}
+
+	if err := createApp().Run([]string{"mooncake", "mcp", "--log-level", "loud"}); err == nil {
+		t.Error("mcp with an invalid log level succeeded")
+	}
+}
+
+func TestServeCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tokenFile := filepath.Join(tmpDir, "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if token, generated, err := apiToken(tokenFile); err != nil || token != "secret" || generated {
+		t.Errorf("apiToken(file) = %q, %v, %v", token, generated, err)
+	}
+	t.Setenv(tokenEnvVar, "from-env")
+	if token, generated, err := apiToken(""); err != nil || token != "from-env" || generated {
+		t.Errorf("apiToken(env) = %q, %v, %v", token, generated, err)
+	}
+	t.Setenv(tokenEnvVar, "")
+	if token, generated, err := apiToken(""); err != nil || len(token) != 64 || !generated {
+		t.Errorf("apiToken() = %q, %v, %v", token, generated, err)
+	}
+	emptyTokenFile := filepath.Join(tmpDir, "empty-token")
+	if err := os.WriteFile(emptyTokenFile, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := apiToken(emptyTokenFile); err == nil {
+		t.Error("apiToken with an empty token file succeeded")
+	}
+
+	socket := filepath.Join(tmpDir, "api.sock")
+	listener, err := listen("unix:" + socket)
+	if err != nil {
+		t.Fatalf("listen() error = %v", err)
+	}
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, %v", info, err)
+	}
+	if _, err := listen("unix:" + socket); err == nil {
+		t.Error("listen on a socket in use succeeded")
+	}
+
+	if err := createApp().Run([]string{"mooncake", "serve", "--log-level", "loud"}); err == nil {
+		t.Error("serve with an invalid log level succeeded")
+	}
+	if err := createApp().Run([]string{"mooncake", "serve", "--token-file", filepath.Join(tmpDir, "missing")}); err == nil {
+		t.Error("serve with a missing token file succeeded")
+	}
+	if err := createApp().Run([]string{"mooncake", "serve", "--token-file", tokenFile, "--listen", "unix:" + socket}); err == nil {
+		t.Error("serve on a socket in use succeeded")
+	}
+
+	// Closing the listener of a unix socket removes it: the server can listen again
+	_ = listener.Close()
+	listener, err = listen("unix:" + socket)
+	if err != nil {
+		t.Fatalf("listen() again error = %v", err)
+	}
+	_ = listener.Close()
+}
+
+func TestRunEventSinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yml")
+	if err := os.WriteFile(configPath, []byte("- name: greet\n  print: hello\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	secretFile := filepath.Join(tmpDir, "secret")
+	if err := os.WriteFile(secretFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var delivered []json.RawMessage
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(sinks.SignatureHeader) != sinks.Sign([]byte("s3cret"), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var batch struct {
+			Events []json.RawMessage `json:"events"`
+		}
+		_ = json.Unmarshal(body, &batch)
+		mu.Lock()
+		delivered = append(delivered, batch.Events...)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	eventsFile := filepath.Join(tmpDir, "run.jsonl")
+	args := []string{"mooncake", "run", "--config", configPath, "--raw",
+		"--artifacts-dir", filepath.Join(tmpDir, "artifacts"),
+		"--events-file", eventsFile,
+		"--events-webhook", webhook.URL, "--events-webhook-secret-file", secretFile}
+	if err := createApp().Run(args); err != nil {
+		t.Fatalf("run with event sinks error = %v", err)
+	}
+
+	schemaFile := filepath.Join(tmpDir, "events.schema.json")
+	if err := createApp().Run([]string{"mooncake", "schema", "events", "--output", schemaFile}); err != nil {
+		t.Fatalf("schema events error = %v", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	schema, err := compiler.Compile(schemaFile)
+	if err != nil {
+		t.Fatalf("compiling the events schema: %v", err)
+	}
+
+	data, err := os.ReadFile(eventsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	types := make(map[string]bool)
+	for _, line := range lines {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid line %s: %v", line, err)
+		}
+		if err := schema.Validate(record); err != nil {
+			t.Errorf("record %s doesn't match the schema: %v", line, err)
+		}
+		if record["host"] != localHostname() || record["run_id"] == nil {
+			t.Errorf("record %s: unexpected host or run ID", line)
+		}
+		types[record["type"].(string)] = true
+	}
+	for _, want := range []string{"run.started", "step.completed", "run.completed"} {
+		if !types[want] {
+			t.Errorf("events file has no %s event", want)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(delivered) != len(lines) {
+		t.Errorf("webhook received %d events, want %d", len(delivered), len(lines))
+	}
+}
+
+func TestOpenEventSinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	emptySecret := filepath.Join(tmpDir, "empty")
+	if err := os.WriteFile(emptySecret, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"secret without webhook", []string{"--events-webhook-secret-file", emptySecret}, "requires --events-webhook"},
+		{"invalid webhook", []string{"--events-webhook", "ftp://example.com"}, "invalid webhook URL"},
+		{"empty secret", []string{"--events-webhook", "http://127.0.0.1:1", "--events-webhook-secret-file", emptySecret}, "is empty"},
+		{"missing secret", []string{"--events-webhook", "http://127.0.0.1:1", "--events-webhook-secret-file", filepath.Join(tmpDir, "missing")}, "failed to read webhook secret"},
+		{"unwritable file", []string{"--events-file", filepath.Join(tmpDir, "missing", "run.jsonl")}, "failed to open events file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &cli.App{
+				Flags:  eventSinkFlags(),
+				Action: func(c *cli.Context) error { _, err := openEventSinks(c); return err },
+			}
+			err := app.Run(append([]string{"mooncake"}, tt.args...))
+			if err == nil || !contains(err.Error(), tt.want) {
+				t.Errorf("openEventSinks(%v) error = %v, want %q", tt.args, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunTracing(t *testing.T) {
+	tmpDir := t.TempDir()
+	marker := filepath.Join(tmpDir, "marker")
+	configPath := filepath.Join(tmpDir, "config.yml")
+	config := `- name: group
+  block:
+    - name: flaky
+      shell: test -f ` + marker + ` || { touch ` + marker + `; exit 1; }
+      retries: 1
+      retry_delay: 10ms
+    - name: check
+      assert:
+        file:
+          path: ` + marker + `
+          exists: true
+`
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type span struct {
+		TraceID      string `json:"traceId"`
+		SpanID       string `json:"spanId"`
+		ParentSpanID string `json:"parentSpanId"`
+		Name         string `json:"name"`
+		Attributes   []struct {
+			Key string `json:"key"`
+		} `json:"attributes"`
+		Events []struct {
+			Name string `json:"name"`
+		} `json:"events"`
+	}
+	var mu sync.Mutex
+	spans := make(map[string]span)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					spans[s.Name] = s
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	args := []string{"mooncake", "run", "--config", configPath, "--raw", "--otlp-endpoint", collector.URL}
+	if err := createApp().Run(args); err != nil {
+		t.Fatalf("run with tracing error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	run, group, flaky, check := spans["mooncake run"], spans["group"], spans["flaky"], spans["check"]
+	if run.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || run.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("run span = %+v, want a child of TRACEPARENT", run)
+	}
+	if group.ParentSpanID != run.SpanID || flaky.ParentSpanID != group.SpanID || check.ParentSpanID != group.SpanID {
+		t.Errorf("spans = %+v, want the block steps nested in the block and the block in the run", spans)
+	}
+	if len(flaky.Events) != 1 || flaky.Events[0].Name != "retry" {
+		t.Errorf("flaky step events = %+v, want a retry", flaky.Events)
+	}
+	if len(check.Events) != 1 || check.Events[0].Name != "assert.passed" {
+		t.Errorf("assert step events = %+v, want assert.passed", check.Events)
+	}
+	hasOrigin := false
+	for _, attribute := range flaky.Attributes {
+		hasOrigin = hasOrigin || attribute.Key == "code.lineno"
+	}
+	if !hasOrigin {
+		t.Errorf("flaky step attributes = %+v, want its origin", flaky.Attributes)
+	}
+
+	for _, invalid := range [][]string{
+		{"--otlp-endpoint", "localhost:4318"},
+		{"--otlp-header", "Authorization=Bearer t"},
+		{"--otlp-endpoint", collector.URL, "--otlp-header", "no-value"},
+	} {
+		args := append([]string{"mooncake", "run", "--config", configPath, "--raw"}, invalid...)
+		if err := createApp().Run(args); err == nil {
+			t.Errorf("run %v succeeded", invalid)
+		}
+	}
+}
+
+func TestVaultCommands(t *testing.T) {
+	t.Cleanup(func() { vault.SetPasswordProvider(nil) })
+	tmpDir := t.TempDir()
+	passwordFile := filepath.Join(tmpDir, "vault-pass")
+	newPasswordFile := filepath.Join(tmpDir, "new-vault-pass")
+	for path, password := range map[string]string{passwordFile: "pw\n", newPasswordFile: "new-pw\n"} {
+		if err := os.WriteFile(path, []byte(password), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	varsPath := filepath.Join(tmpDir, "secrets.yml")
+	if err := os.WriteFile(varsPath, []byte("api_token: vault-cmd-token\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createApp().Run([]string{"mooncake", "vault", "encrypt", "--vault-password-file", passwordFile, varsPath}); err != nil {
+		t.Fatalf("vault encrypt error = %v", err)
+	}
+	data, _ := os.ReadFile(varsPath)
+	if !vault.IsEncrypted(data) {
+		t.Fatalf("vars file after encrypt = %s", data)
+	}
+	if info, _ := os.Stat(varsPath); info.Mode().Perm() != 0640 {
+		t.Errorf("mode after encrypt = %04o, want 0640", info.Mode().Perm())
+	}
+	if err := createApp().Run([]string{"mooncake", "vault", "encrypt", "--vault-password-file", passwordFile, varsPath}); err == nil {
+		t.Error("encrypting an encrypted file succeeded")
+	}
+
+	// Runs decrypt --vars transparently
+	configPath := filepath.Join(tmpDir, "config.yml")
+	outPath := filepath.Join(tmpDir, "token")
+	config := fmt.Sprintf("- name: write token\n  file:\n    path: %s\n    content: \"{{ api_token }}\"\n", outPath)
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	run := []string{"mooncake", "run", "--config", configPath, "--vars", varsPath, "--raw",
+		"--artifacts-dir", filepath.Join(tmpDir, "artifacts")}
+	if err := createApp().Run(append(run, "--vault-password-file", passwordFile)); err != nil {
+		t.Fatalf("run with an encrypted vars file error = %v", err)
+	}
+	if content, _ := os.ReadFile(outPath); string(content) != "vault-cmd-token" {
+		t.Errorf("written token = %q", content)
+	}
+	t.Setenv(vault.PasswordEnvVar, "wrong")
+	if err := createApp().Run(run); err == nil || !strings.Contains(err.Error(), "wrong vault password") {
+		t.Errorf("run with a wrong vault password error = %v", err)
+	}
+
+	if err := createApp().Run([]string{"mooncake", "vault", "rekey", "--vault-password-file", passwordFile,
+		"--new-vault-password-file", newPasswordFile, varsPath}); err != nil {
+		t.Fatalf("vault rekey error = %v", err)
+	}
+
+	// $EDITOR edits the decrypted file
+	editor := filepath.Join(tmpDir, "editor.sh")
+	if err := os.WriteFile(editor, []byte("#!/bin/sh\necho 'db_password: hunter22' >> \"$1\"\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EDITOR", editor)
+	t.Setenv(vault.PasswordEnvVar, "new-pw")
+	if err := createApp().Run([]string{"mooncake", "vault", "edit", varsPath}); err != nil {
+		t.Fatalf("vault edit error = %v", err)
+	}
+
+	var stdout bytes.Buffer
+	app := createApp()
+	app.Writer = &stdout
+	if err := app.Run([]string{"mooncake", "vault", "decrypt", "--output", "-", varsPath}); err != nil {
+		t.Fatalf("vault decrypt error = %v", err)
+	}
+	if stdout.String() != "api_token: vault-cmd-token\ndb_password: hunter22\n" {
+		t.Errorf("decrypted file = %q", stdout.String())
+	}
+	if data, _ := os.ReadFile(varsPath); !vault.IsEncrypted(data) {
+		t.Error("decrypt --output - changed the file")
+	}
+
+	if err := createApp().Run([]string{"mooncake", "vault", "decrypt", varsPath}); err != nil {
+		t.Fatalf("vault decrypt in place error = %v", err)
+	}
+	if data, _ := os.ReadFile(varsPath); vault.IsEncrypted(data) {
+		t.Error("vault decrypt left the file encrypted")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/inventory"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/sinks"
+	"github.com/alehatsman/mooncake/internal/tracing"
+	"github.com/urfave/cli/v2"
+)
+
+// defaultConcurrency is the number of hosts of an inventory run at once.
+const defaultConcurrency = 5
+
+// validateInventoryFlags checks the flags of runs on the hosts of an inventory.
+func validateInventoryFlags(c *cli.Context) error {
+	if c.String("inventory") == "" {
+		for _, name := range []string{"limit", "concurrency", "fail-fast", "continue"} {
+			if c.IsSet(name) {
+				return fmt.Errorf("--%s requires --inventory", name)
+			}
+		}
+		return nil
+	}
+	for _, name := range []string{"host", "root", "from-plan", "resume"} {
+		if c.IsSet(name) {
+			return fmt.Errorf("--inventory cannot be combined with --%s", name)
+		}
+	}
+	if c.Bool("fail-fast") && c.Bool("continue") {
+		return fmt.Errorf("--fail-fast and --continue are mutually exclusive")
+	}
+	if c.Int("concurrency") < 1 {
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+	return nil
+}
+
+// runInventory applies the config to the hosts of an inventory selected by --limit
+// and prints a summary per host.
+func runInventory(c *cli.Context, startConfig executor.StartConfig, level int, outputFormat string, eventSinks []sinks.Sink, tracer *tracing.Exporter) error {
+	inv, err := inventory.Load(c.String("inventory"))
+	if err != nil {
+		return err
+	}
+	hosts, err := inv.Select(c.String("limit"))
+	if err != nil {
+		return err
+	}
+
+	// Stop the run gracefully on SIGINT/SIGTERM
+	ctx, stop := withInterrupt(c.Context)
+	defer stop()
+	startConfig.Context = ctx
+
+	// Each host prints its events labeled with its name (the TUI shows one run)
+	newPublisher := func(host *inventory.Host) events.Publisher {
+		publisher := events.NewPublisher()
+		subscriber := logger.NewConsoleSubscriber(level, outputFormat)
+		subscriber.SetHost(host.Name)
+		publisher.Subscribe(subscriber)
+		subscribeEventSinks(publisher, eventSinks, host.Name)
+		subscribeTracer(publisher, tracer, host.Name)
+		return publisher
+	}
+
+	summary, err := executor.StartHosts(executor.HostsConfig{
+		StartConfig: startConfig,
+		Inventory:   inv,
+		Hosts:       hosts,
+		Concurrency: c.Int("concurrency"),
+		FailFast:    c.Bool("fail-fast"),
+	}, logger.NewLogger(level), newPublisher)
+	if summary != nil {
+		if outputFormat == outputFormatJSON {
+			if encodeErr := json.NewEncoder(os.Stdout).Encode(summary); encodeErr != nil {
+				return encodeErr
+			}
+		} else {
+			writeHostsSummary(os.Stdout, summary)
+		}
+	}
+	return err
+}
+
+// writeHostsSummary prints the outcome of a run on several hosts, one host per line.
+func writeHostsSummary(w io.Writer, summary *executor.HostsSummary) {
+	nameWidth := len("HOST")
+	for _, host := range summary.Hosts {
+		nameWidth = max(nameWidth, len(host.Host))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "%-*s  %-10s %8s %8s %10s\n", nameWidth, "HOST", "STATUS", "CHANGED", "FAILED", "DURATION")
+	for _, host := range summary.Hosts {
+		fmt.Fprintf(w, "%-*s  %-10s %8d %8d %8dms\n", nameWidth, host.Host, host.Status, host.ChangedSteps, host.FailedSteps, host.DurationMs)
+	}
+
+	var failures []executor.HostResult
+	for _, host := range summary.Hosts {
+		if host.Error != "" {
+			failures = append(failures, host)
+		}
+	}
+	if len(failures) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Failures:")
+		for _, host := range failures {
+			fmt.Fprintf(w, "  %s: %s\n", host.Host, firstLine(host.Error))
+			if host.ResumeCommand != "" {
+				fmt.Fprintf(w, "    Resume with: %s\n", host.ResumeCommand)
+			}
+		}
+	}
+
+	fmt.Fprintln(w)
+	counts := []string{fmt.Sprintf("%d ok", summary.Succeeded)}
+	if summary.Failed > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", summary.Failed))
+	}
+	if summary.Cancelled > 0 {
+		counts = append(counts, fmt.Sprintf("%d cancelled", summary.Cancelled))
+	}
+	if summary.Skipped > 0 {
+		counts = append(counts, fmt.Sprintf("%d skipped", summary.Skipped))
+	}
+	fmt.Fprintf(w, "Hosts: %s; %d changed\n", strings.Join(counts, ", "), summary.Changed)
+}
+
+// firstLine returns the first line of a message.
+func firstLine(message string) string {
+	line, _, _ := strings.Cut(message, "\n")
+	return line
+}
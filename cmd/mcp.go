@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/mcp"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+// mcpCommand creates the mcp command, which serves mooncake to AI agents.
+func mcpCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "mcp",
+		Usage: "Serve mooncake as Model Context Protocol tools over stdio",
+		Description: `Run an MCP server on stdin/stdout, for AI agents and editors.
+
+Tools: facts, actions_list, schema, validate, plan, run and artifacts.
+Runs are dry runs unless the server is started with --allow-run and the
+agent sets dry_run to false. Logs are written to stderr.
+
+Example client configuration:
+  {"mcpServers": {"mooncake": {"command": "mooncake", "args": ["mcp"]}}}`,
+		Flags: append([]cli.Flag{
+			&cli.BoolFlag{
+				Name:  "allow-run",
+				Usage: "Allow the run tool to apply configs (default: dry runs only)",
+			},
+			&cli.StringFlag{
+				Name:  "artifacts-dir",
+				Value: artifacts.DefaultBaseDir,
+				Usage: "Directory runs save their artifacts to, read by the artifacts tool",
+			},
+			&cli.StringFlag{
+				Name:  "sudo-pass-file",
+				Usage: "Read the sudo password of runs from file (must have 0600 permissions)",
+			},
+			&cli.StringFlag{
+				Name:  "log-level",
+				Value: "error",
+				Usage: "Log level of plans and runs, written to stderr: debug, info or error",
+			},
+		}, vaultPasswordFlags(false)...),
+		Action: mcpAction,
+	}
+}
+
+// mcpAction serves MCP until stdin is closed.
+func mcpAction(c *cli.Context) error {
+	level, err := logger.ParseLogLevel(c.String("log-level"))
+	if err != nil {
+		return err
+	}
+	if err := useVaultPassword(c); err != nil {
+		return err
+	}
+	// Stdout carries the protocol
+	output := color.Output
+	color.Output = os.Stderr
+	defer func() { color.Output = output }()
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := mcp.NewServer(mcp.Options{
+		AllowRun:     c.Bool("allow-run"),
+		ArtifactsDir: c.String("artifacts-dir"),
+		SudoPassFile: c.String("sudo-pass-file"),
+		Log:          logger.NewLogger(level),
+	})
+	return server.Serve(ctx, c.App.Reader, c.App.Writer)
+}
@@ -2,8 +2,11 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -12,6 +15,7 @@ import (
 
 	"github.com/alehatsman/mooncake/internal/actions"
 	"github.com/alehatsman/mooncake/internal/agent"
+	"github.com/alehatsman/mooncake/internal/artifacts"
 	"github.com/alehatsman/mooncake/internal/config"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
@@ -19,7 +23,13 @@ import (
 	"github.com/alehatsman/mooncake/internal/facts"
 	"github.com/alehatsman/mooncake/internal/logger"
 	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/policy"
 	_ "github.com/alehatsman/mooncake/internal/register" // Register action handlers
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/sinks"
+	"github.com/alehatsman/mooncake/internal/tracing"
+	"github.com/alehatsman/mooncake/internal/transport"
+	"github.com/alehatsman/mooncake/internal/version"
 	"github.com/urfave/cli/v2"
 	"gopkg.in/yaml.v3"
 )
@@ -37,8 +47,11 @@ const (
 	yamlIndentSpaces = 2
 
 	// Exit codes
-	exitCodeValidationError = 2 // Configuration validation failed
-	exitCodeRuntimeError    = 3 // Runtime error during execution
+	exitCodeStepFailed      = 1   // One or more steps failed
+	exitCodeValidationError = 2   // Configuration validation failed
+	exitCodeRuntimeError    = 3   // Runtime error during execution
+	exitCodeCancelled       = 130 // Run interrupted or exceeded --timeout
+	exitCodeDrift           = 2   // mooncake drift found drifted resources
 )
 
 // parseTags parses a comma-separated tag string into a slice of trimmed tags
@@ -59,10 +72,38 @@ func parseTags(tagsStr string) []string {
 
 
 func run(c *cli.Context) error {
+	if err := validateInventoryFlags(c); err != nil {
+		return err
+	}
+	if c.String("root") != "" && c.String("host") != "" {
+		return fmt.Errorf("--root cannot be combined with --host")
+	}
+	if err := useVaultPassword(c); err != nil {
+		return err
+	}
+	runPolicy, err := loadPolicy(c)
+	if err != nil {
+		return err
+	}
+
+	eventSinks, err := openEventSinks(c)
+	if err != nil {
+		return err
+	}
+	defer closeEventSinks(eventSinks)
+	tracer, err := openTracer(c)
+	if err != nil {
+		return err
+	}
+	defer closeTracer(tracer)
+
 	// Check if running from plan
 	fromPlan := c.String("from-plan")
 	if fromPlan != "" {
-		return runFromPlan(c, fromPlan)
+		if c.String("resume") != "" {
+			return fmt.Errorf("--resume cannot be combined with --from-plan (the resumed run's plan is used)")
+		}
+		return runFromPlan(c, fromPlan, runPolicy, eventSinks, tracer)
 	}
 
 	raw := c.Bool("raw")
@@ -70,6 +111,10 @@ func run(c *cli.Context) error {
 	logLevel := c.String("log-level")
 	outputFormat := c.String("output-format")
 
+	if c.Bool("diff") && !dryRun {
+		return fmt.Errorf("--diff requires --dry-run")
+	}
+
 	// Force raw mode for dry-run
 	if dryRun {
 		raw = true
@@ -88,25 +133,8 @@ func run(c *cli.Context) error {
 	// Parse tags from comma-separated string
 	tags := parseTags(c.String("tags"))
 
-	// Validate password input methods (mutual exclusion)
-	passwordMethods := 0
-	if c.String("sudo-pass") != "" {
-		passwordMethods++
-	}
-	if c.Bool("ask-become-pass") {
-		passwordMethods++
-	}
-	if c.String("sudo-pass-file") != "" {
-		passwordMethods++
-	}
-
-	if passwordMethods > 1 {
-		return fmt.Errorf("only one password method can be specified (--sudo-pass, --ask-become-pass, --sudo-pass-file)")
-	}
-
-	// Security warning for --sudo-pass
-	if c.String("sudo-pass") != "" && !c.Bool("insecure-sudo-pass") {
-		return fmt.Errorf("--sudo-pass requires --insecure-sudo-pass flag (WARNING: password will be visible in shell history and process list)")
+	if err := validatePasswordFlags(c); err != nil {
+		return err
 	}
 
 	// Collect facts early if facts-json requested
@@ -119,11 +147,6 @@ func run(c *cli.Context) error {
 		}
 	}
 
-	// Always use event-driven architecture
-	// Create event publisher
-	publisher := events.NewPublisher()
-	defer publisher.Close()
-
 	// Parse log level for subscriber
 	level := logger.InfoLevel
 	switch logLevel {
@@ -133,6 +156,43 @@ func run(c *cli.Context) error {
 		level = logger.ErrorLevel
 	}
 
+	startConfig := executor.StartConfig{
+		ConfigFilePath:   c.String("config"),
+		VarsFilePath:     c.String("vars"),
+		SudoPass:         c.String("sudo-pass"),
+		SudoPassFile:     c.String("sudo-pass-file"),
+		AskBecomePass:    c.Bool("ask-become-pass"),
+		InsecureSudoPass: c.Bool("insecure-sudo-pass"),
+		Tags:             tags,
+		DryRun:           dryRun,
+		Diff:             c.Bool("diff"),
+		KeepGoing:        c.Bool("keep-going"),
+		Parallel:         c.Int("parallel"),
+		Timeout:          c.Duration("timeout"),
+		ResumeRunID:      c.String("resume"),
+		StartAt:          c.String("start-at-step"),
+		Force:            c.Bool("force"),
+		Host:             c.String("host"),
+		Root:             c.String("root"),
+		Policy:           runPolicy,
+
+		// Artifact configuration
+		ArtifactsDir:      c.String("artifacts-dir"),
+		CaptureFullOutput: c.Bool("capture-full-output"),
+		MaxOutputBytes:    c.Int("max-output-bytes"),
+		MaxOutputLines:    c.Int("max-output-lines"),
+	}
+
+	// Apply the config to the hosts of an inventory
+	if c.String("inventory") != "" {
+		return runInventory(c, startConfig, level, outputFormat, eventSinks, tracer)
+	}
+
+	// Always use event-driven architecture
+	// Create event publisher
+	publisher := events.NewPublisher()
+	defer publisher.Close()
+
 	// Create appropriate subscriber based on mode
 	if !raw && logger.IsTUISupported() {
 		// Use TUI subscriber for animated display
@@ -151,30 +211,161 @@ func run(c *cli.Context) error {
 		subscriber := logger.NewConsoleSubscriber(level, outputFormat)
 		publisher.Subscribe(subscriber)
 	}
+	subscribeEventSinks(publisher, eventSinks, startConfig.Host)
+	subscribeTracer(publisher, tracer, startConfig.Host)
 
 	// Create a minimal logger for internal use (errors, etc.)
 	internalLog := logger.NewLogger(level)
 
+	// Stop the run gracefully on SIGINT/SIGTERM
+	ctx, stop := withInterrupt(c.Context)
+	defer stop()
+
 	// Execute with event publisher
-	return executor.Start(executor.StartConfig{
+	startConfig.Context = ctx
+	return executor.Start(startConfig, internalLog, publisher)
+}
+
+// validatePasswordFlags checks the sudo password flags of a command.
+func validatePasswordFlags(c *cli.Context) error {
+	// Validate password input methods (mutual exclusion)
+	passwordMethods := 0
+	if c.String("sudo-pass") != "" {
+		passwordMethods++
+	}
+	if c.Bool("ask-become-pass") {
+		passwordMethods++
+	}
+	if c.String("sudo-pass-file") != "" {
+		passwordMethods++
+	}
+
+	if passwordMethods > 1 {
+		return fmt.Errorf("only one password method can be specified (--sudo-pass, --ask-become-pass, --sudo-pass-file)")
+	}
+
+	// Security warning for --sudo-pass
+	if c.String("sudo-pass") != "" && !c.Bool("insecure-sudo-pass") {
+		return fmt.Errorf("--sudo-pass requires --insecure-sudo-pass flag (WARNING: password will be visible in shell history and process list)")
+	}
+	return nil
+}
+
+// undoCommand reverts the changes of a run recorded in its journal.
+func undoCommand(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: mooncake undo <run-id>")
+	}
+	if err := validatePasswordFlags(c); err != nil {
+		return err
+	}
+
+	ctx, stop := withInterrupt(c.Context)
+	defer stop()
+
+	return executor.Undo(executor.UndoConfig{
+		RunID:            c.Args().First(),
+		ArtifactsDir:     c.String("artifacts-dir"),
+		DryRun:           c.Bool("dry-run"),
+		Force:            c.Bool("force"),
+		SudoPass:         c.String("sudo-pass"),
+		SudoPassFile:     c.String("sudo-pass-file"),
+		AskBecomePass:    c.Bool("ask-become-pass"),
+		InsecureSudoPass: c.Bool("insecure-sudo-pass"),
+		Context:          ctx,
+	}, logger.NewLogger(logger.InfoLevel))
+}
+
+// driftCommand checks the system against a config without changing it and
+// reports the drifted resources. Exits with exitCodeDrift if there are any.
+func driftCommand(c *cli.Context) error {
+	format := c.String("format")
+	if format != outputFormatText && format != outputFormatJSON {
+		return fmt.Errorf("invalid format: %s (must be 'text' or 'json')", format)
+	}
+	if err := validatePasswordFlags(c); err != nil {
+		return err
+	}
+	if err := useVaultPassword(c); err != nil {
+		return err
+	}
+
+	ctx, stop := withInterrupt(c.Context)
+	defer stop()
+
+	report, err := executor.Drift(executor.DriftConfig{
 		ConfigFilePath:   c.String("config"),
 		VarsFilePath:     c.String("vars"),
+		Tags:             parseTags(c.String("tags")),
 		SudoPass:         c.String("sudo-pass"),
 		SudoPassFile:     c.String("sudo-pass-file"),
 		AskBecomePass:    c.Bool("ask-become-pass"),
 		InsecureSudoPass: c.Bool("insecure-sudo-pass"),
-		Tags:             tags,
-		DryRun:           dryRun,
+		Context:          ctx,
+	}, logger.NewLogger(logger.ErrorLevel))
+	if err != nil {
+		return err
+	}
 
-		// Artifact configuration
-		ArtifactsDir:      c.String("artifacts-dir"),
-		CaptureFullOutput: c.Bool("capture-full-output"),
-		MaxOutputBytes:    c.Int("max-output-bytes"),
-		MaxOutputLines:    c.Int("max-output-lines"),
-	}, internalLog, publisher)
+	if format == outputFormatJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		writeDriftText(os.Stdout, report)
+	}
+
+	if report.HasDrift() {
+		os.Exit(exitCodeDrift)
+	}
+	return nil
+}
+
+// writeDriftText prints a drift report: the drifted resources grouped by step,
+// with a diff of drifted file contents, and the steps that couldn't be checked.
+func writeDriftText(w io.Writer, report *executor.DriftReport) {
+	if report.HasDrift() {
+		fmt.Fprintln(w, "Drifted:")
+	}
+	for _, step := range report.Drifted {
+		fmt.Fprintf(w, "  %s [%s]\n", step.Name, step.StepID)
+		for _, resource := range step.Resources {
+			fmt.Fprintf(w, "    %s %s: %s\n", resource.Kind, resource.Resource, resource.Detail)
+		}
+		if step.Diff != "" {
+			for _, line := range strings.Split(strings.TrimSuffix(step.Diff, "\n"), "\n") {
+				fmt.Fprintf(w, "      %s\n", line)
+			}
+		}
+	}
+
+	if len(report.Unchecked) > 0 {
+		if report.HasDrift() {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "Not checked:")
+		for _, step := range report.Unchecked {
+			fmt.Fprintf(w, "  %s [%s] (%s): %s\n", step.Name, step.StepID, step.Action, step.Reason)
+		}
+	}
+
+	if report.HasDrift() || len(report.Unchecked) > 0 {
+		fmt.Fprintln(w)
+	}
+	if report.HasDrift() {
+		fmt.Fprintf(w, "Drift: %d resources in %d of %d checked steps", report.DriftedResources(), len(report.Drifted), report.CheckedSteps)
+	} else {
+		fmt.Fprintf(w, "No drift: %d steps checked", report.CheckedSteps)
+	}
+	if len(report.Unchecked) > 0 {
+		fmt.Fprintf(w, ", %d not checked", len(report.Unchecked))
+	}
+	fmt.Fprintln(w)
 }
 
-func runFromPlan(c *cli.Context, planPath string) error {
+func runFromPlan(c *cli.Context, planPath string, runPolicy *policy.Policy, eventSinks []sinks.Sink, tracer *tracing.Exporter) error {
 	// Load plan from file
 	planData, err := plan.LoadPlanFromFile(planPath)
 	if err != nil {
@@ -185,6 +376,39 @@ func runFromPlan(c *cli.Context, planPath string) error {
 	dryRun := c.Bool("dry-run")
 	logLevel := c.String("log-level")
 
+	if c.Bool("diff") && !dryRun {
+		return fmt.Errorf("--diff requires --dry-run")
+	}
+
+	// Stop the run gracefully on SIGINT/SIGTERM
+	ctx, stop := withInterrupt(c.Context)
+	defer stop()
+
+	// Connect to the target host or open the alternate root, and check the plan
+	// against its facts
+	var target transport.Transport
+	var targetFacts *facts.Facts
+	if host := c.String("host"); host != "" {
+		sshTarget, hostFacts, err := executor.ConnectHost(ctx, host)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = sshTarget.Close() }()
+		target, targetFacts = sshTarget, hostFacts
+	} else if root := c.String("root"); root != "" {
+		chroot, rootFacts, err := executor.OpenRoot(root)
+		if err != nil {
+			return err
+		}
+		target, targetFacts = chroot, rootFacts
+	} else {
+		targetFacts = facts.Collect()
+	}
+
+	if err := verifyPlan(planData, targetFacts, c.String("verify-key"), c.Bool("allow-drift")); err != nil {
+		return err
+	}
+
 	// Always use event-driven architecture
 	publisher := events.NewPublisher()
 	defer publisher.Close()
@@ -201,12 +425,69 @@ func runFromPlan(c *cli.Context, planPath string) error {
 	// Create console subscriber for text output
 	subscriber := logger.NewConsoleSubscriber(level, outputFormatText)
 	publisher.Subscribe(subscriber)
+	subscribeEventSinks(publisher, eventSinks, c.String("host"))
+	subscribeTracer(publisher, tracer, c.String("host"))
 
 	// Create minimal logger for internal use
 	internalLog := logger.NewLogger(level)
 
 	// Execute plan with event publisher
-	return executor.ExecutePlan(planData, c.String("sudo-pass"), dryRun, internalLog, publisher)
+	return executor.ExecutePlanWithOptions(planData, executor.PlanOptions{
+		SudoPass:  c.String("sudo-pass"),
+		DryRun:    dryRun,
+		Diff:      c.Bool("diff"),
+		KeepGoing: c.Bool("keep-going"),
+		Parallel:  c.Int("parallel"),
+		Context:   ctx,
+		Timeout:   c.Duration("timeout"),
+		StartAt:   c.String("start-at-step"),
+		Transport: target,
+		Policy:    runPolicy,
+	}, internalLog, publisher)
+}
+
+// verifyPlan checks that a saved plan may run on the host with the given facts. The signature is
+// checked first: against verifyKeyPath if given (then the plan must be signed),
+// otherwise against the key embedded in a signed plan. A signature failure always
+// refuses the plan. Then the plan fingerprint is compared with the host's facts
+// and the plan's sources; mismatches refuse the plan unless allowDrift is set, in
+// which case they're printed as warnings.
+func verifyPlan(p *plan.Plan, hostFacts *facts.Facts, verifyKeyPath string, allowDrift bool) error {
+	var trusted ed25519.PublicKey
+	if verifyKeyPath != "" {
+		key, err := security.LoadVerifyKey(verifyKeyPath)
+		if err != nil {
+			return err
+		}
+		trusted = key
+	}
+	if trusted != nil || p.Signature != nil {
+		if err := p.VerifySignature(trusted); err != nil {
+			return fmt.Errorf("refusing to run plan: %w", err)
+		}
+	}
+
+	err := p.VerifyFingerprint(hostFacts)
+	if err == nil {
+		return nil
+	}
+	if allowDrift {
+		log.Printf("Warning: %v", err)
+		return nil
+	}
+	return fmt.Errorf("refusing to run: %w\nRebuild the plan on this host, or use --allow-drift to run it anyway", err)
+}
+
+// keygenCommand generates an ed25519 key pair for signing plans.
+func keygenCommand(c *cli.Context) error {
+	keyPath := c.String("out")
+	publicKey, err := security.GenerateSigningKey(keyPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Signing key saved to %s\n", keyPath)
+	fmt.Printf("Public key saved to %s.pub (key ID %s)\n", keyPath, security.KeyID(publicKey))
+	return nil
 }
 
 func factsCommand(c *cli.Context) error {
@@ -268,9 +549,9 @@ func actionsListCommand(c *cli.Context) error {
 // displayActionsTable displays actions in a formatted table.
 func displayActionsTable(actionsList []actions.ActionMetadata) {
 	// Print header
-	fmt.Printf("%-15s %-10s %-25s %-8s %-8s\n",
-		"ACTION", "CATEGORY", "PLATFORMS", "SUDO", "CHECK")
-	fmt.Println(strings.Repeat("-", 80))
+	fmt.Printf("%-15s %-10s %-25s %-8s %-8s %-8s %-8s\n",
+		"ACTION", "CATEGORY", "PLATFORMS", "SUDO", "CHECK", "REMOTE", "ROOT")
+	fmt.Println(strings.Repeat("-", 98))
 
 	// Print each action
 	for _, meta := range actionsList {
@@ -295,12 +576,26 @@ func displayActionsTable(actionsList []actions.ActionMetadata) {
 			check = "yes"
 		}
 
-		fmt.Printf("%-15s %-10s %-25s %-8s %-8s\n",
+		// Format remote support
+		remote := "no"
+		if meta.SupportsRemote {
+			remote = "yes"
+		}
+
+		// Format alternate root support
+		root := "no"
+		if meta.SupportsRemote || meta.SupportsRoot {
+			root = "yes"
+		}
+
+		fmt.Printf("%-15s %-10s %-25s %-8s %-8s %-8s %-8s\n",
 			meta.Name,
 			meta.Category,
 			platforms,
 			sudo,
-			check)
+			check,
+			remote,
+			root)
 	}
 }
 
@@ -321,39 +616,56 @@ func planCommand(c *cli.Context) error {
 	outputPath := c.String("output")
 	format := c.String("format")
 	showOrigins := c.Bool("show-origins")
+	showDiff := c.Bool("diff")
+	signKeyPath := c.String("sign-key")
+
+	if showDiff && (outputPath != "" || format != outputFormatText) {
+		return fmt.Errorf("--diff requires text format and cannot be combined with --output")
+	}
+	if signKeyPath != "" && outputPath == "" {
+		return fmt.Errorf("--sign-key requires --output")
+	}
+	if configPath == "" {
+		return fmt.Errorf("--config is required")
+	}
+	if err := useVaultPassword(c); err != nil {
+		return err
+	}
+	runPolicy, err := loadPolicy(c)
+	if err != nil {
+		return err
+	}
 
 	// Parse tags
 	tags := parseTags(c.String("tags"))
 
-	// Load variables if specified
-	var variables map[string]interface{}
-	if varsPath != "" {
-		vars, err := config.ReadVariables(varsPath)
-		if err != nil {
-			return fmt.Errorf("failed to read variables: %w", err)
-		}
-		variables = vars
-	} else {
-		variables = make(map[string]interface{})
-	}
-
-	// Build plan (planner will inject system facts automatically)
-	planner, err := plan.NewPlanner()
+	planData, err := buildPlan(configPath, varsPath, tags)
 	if err != nil {
 		return err
 	}
-	planData, err := planner.BuildPlan(plan.PlannerConfig{
-		ConfigPath: configPath,
-		Variables:  variables,
-		Tags:       tags,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to build plan: %w", err)
+	if runPolicy != nil {
+		if err := checkPolicy(planData, runPolicy); err != nil {
+			return err
+		}
 	}
+	// Plans are shown and saved without secrets, but dry-run with them
+	shown := planData.Redact()
 
 	// Save to file if output path specified
 	if outputPath != "" {
-		if err := plan.SavePlanToFile(planData, outputPath); err != nil {
+		if shown.Redacted {
+			fmt.Fprintln(os.Stderr, "Warning: secrets are redacted from the plan, so it can't be run: run the config instead")
+		}
+		if signKeyPath != "" {
+			key, err := security.LoadSigningKey(signKeyPath)
+			if err != nil {
+				return err
+			}
+			if err := shown.Sign(key); err != nil {
+				return fmt.Errorf("failed to sign plan: %w", err)
+			}
+		}
+		if err := plan.SavePlanToFile(shown, outputPath); err != nil {
 			return fmt.Errorf("failed to save plan: %w", err)
 		}
 		fmt.Printf("Plan saved to %s\n", outputPath)
@@ -363,16 +675,79 @@ func planCommand(c *cli.Context) error {
 	// Format and display plan
 	switch format {
 	case outputFormatJSON:
-		return formatPlanJSON(planData)
+		return formatPlanJSON(shown)
 	case outputFormatYAML:
-		return formatPlanYAML(planData)
+		return formatPlanYAML(shown)
 	case outputFormatText:
-		return formatPlanText(planData, showOrigins)
+		if err := formatPlanText(shown, showOrigins); err != nil {
+			return err
+		}
+		if showDiff {
+			return formatPlanChanges(planData)
+		}
+		return nil
 	default:
 		return fmt.Errorf("unsupported format: %s (use text, json, or yaml)", format)
 	}
 }
 
+// planChanges collects the predicted changes of a dry run.
+type planChanges struct {
+	diffs   []events.StepDiffData
+	summary *events.RunCompletedData
+}
+
+// OnEvent implements events.Subscriber.
+func (p *planChanges) OnEvent(event events.Event) {
+	switch data := event.Data.(type) {
+	case events.StepDiffData:
+		p.diffs = append(p.diffs, data)
+	case events.RunCompletedData:
+		p.summary = &data
+	}
+}
+
+// Close implements events.Subscriber.
+func (p *planChanges) Close() {}
+
+// formatPlanChanges dry-runs the plan and prints the changes the handlers predict,
+// with a diff of every file that would change.
+func formatPlanChanges(p *plan.Plan) error {
+	changes := &planChanges{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(changes)
+	defer publisher.Close()
+
+	execErr := executor.ExecutePlanWithOptions(p, executor.PlanOptions{DryRun: true, Diff: true},
+		logger.NewLogger(logger.ErrorLevel), publisher)
+
+	fmt.Println()
+	fmt.Println("Changes:")
+	if len(changes.diffs) == 0 {
+		fmt.Println("  No file changes")
+	}
+	for _, stepDiff := range changes.diffs {
+		fmt.Printf("  %s [%s]\n", stepDiff.Name, stepDiff.StepID)
+		for _, line := range strings.Split(strings.TrimSuffix(stepDiff.Diff, "\n"), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+
+	if changes.summary != nil {
+		fmt.Println()
+		fmt.Printf("Plan: %d to change, %d unchanged", changes.summary.ChangedSteps, changes.summary.UnchangedSteps)
+		if changes.summary.UncheckedSteps > 0 {
+			fmt.Printf(", %d not checked", changes.summary.UncheckedSteps)
+		}
+		fmt.Println()
+	}
+
+	if execErr != nil {
+		return fmt.Errorf("dry run failed: %w", execErr)
+	}
+	return nil
+}
+
 func formatPlanJSON(p *plan.Plan) error {
 	encoder := json.NewEncoder(os.Stdout)
 	encoder.SetIndent("", "  ")
@@ -395,6 +770,9 @@ func formatPlanText(p *plan.Plan, showOrigins bool) error {
 	if len(p.Tags) > 0 {
 		fmt.Printf("Tags: %s\n", strings.Join(p.Tags, ", "))
 	}
+	if p.Strategy != "" {
+		fmt.Printf("Strategy: %s\n", p.Strategy)
+	}
 	fmt.Printf("Steps: %d\n\n", len(p.Steps))
 
 	for i, step := range p.Steps {
@@ -412,6 +790,10 @@ func formatPlanText(p *plan.Plan, showOrigins bool) error {
 			actionType = "vars"
 		} else if step.IncludeVars != nil {
 			actionType = "include_vars"
+		} else if step.Block != nil {
+			actionType = "block"
+		} else if step.FlushHandlers {
+			actionType = "flush_handlers"
 		}
 		fmt.Printf("    Action: %s\n", actionType)
 
@@ -436,12 +818,54 @@ func formatPlanText(p *plan.Plan, showOrigins bool) error {
 				step.LoopContext.First, step.LoopContext.Last)
 		}
 
+		if len(step.Notify) > 0 {
+			fmt.Printf("    Notify: %s\n", strings.Join(step.Notify, ", "))
+		}
+
+		if len(step.DependsOn) > 0 {
+			fmt.Printf("    Depends on: %s\n", strings.Join(step.DependsOn, ", "))
+		}
+
+		if step.Block != nil {
+			formatPlanStepGroup("Block", step.Block, "    ")
+			formatPlanStepGroup("Rescue", step.Rescue, "    ")
+			formatPlanStepGroup("Always", step.Always, "    ")
+		}
+
+		fmt.Println()
+	}
+
+	if len(p.Handlers) > 0 {
+		formatPlanStepGroup("Handlers", p.Handlers, "")
 		fmt.Println()
 	}
 
 	return nil
 }
 
+// formatPlanStepGroup prints the nested steps of a block/rescue/always section.
+func formatPlanStepGroup(title string, steps []config.Step, indent string) {
+	if len(steps) == 0 {
+		return
+	}
+
+	fmt.Printf("%s%s:\n", indent, title)
+	for _, step := range steps {
+		status := ""
+		if step.Skipped {
+			status = " SKIPPED (tags)"
+		}
+		fmt.Printf("%s  - %s (ID: %s, Action: %s)%s\n", indent, step.Name, step.ID, step.ActionType, status)
+
+		if step.Block != nil {
+			nested := indent + "    "
+			formatPlanStepGroup("Block", step.Block, nested)
+			formatPlanStepGroup("Rescue", step.Rescue, nested)
+			formatPlanStepGroup("Always", step.Always, nested)
+		}
+	}
+}
+
 func agentRunCommand(c *cli.Context) error {
 	goal := c.String("goal")
 	planPath := c.String("plan")
@@ -458,6 +882,14 @@ func agentRunCommand(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to get working directory: %w", err)
 	}
+	runPolicy, err := loadPolicy(c)
+	if err != nil {
+		return err
+	}
+	box, err := loadSandbox(c)
+	if err != nil {
+		return err
+	}
 
 	opts := agent.RunOptions{
 		Goal:          goal,
@@ -467,6 +899,8 @@ func agentRunCommand(c *cli.Context) error {
 		Provider:      provider,
 		Model:         model,
 		MaxIterations: maxIterations,
+		Policy:        runPolicy,
+		Sandbox:       box,
 	}
 
 	if provider == "claude" {
@@ -531,6 +965,17 @@ func printAgentSummary(log *agent.IterationLog) {
 			fmt.Printf("  %s\n", artifact)
 		}
 	}
+
+	if len(log.FailureReasons) > 0 {
+		fmt.Println("\nFailure reasons:")
+		for _, reason := range log.FailureReasons {
+			label := reason.Type
+			if reason.Rule != "" {
+				label += " " + reason.Rule
+			}
+			fmt.Printf("  %s: %s\n", label, reason.Message)
+		}
+	}
 }
 
 func validateCommand(c *cli.Context) error {
@@ -544,6 +989,16 @@ func validateCommand(c *cli.Context) error {
 		os.Exit(exitCodeRuntimeError)
 	}
 
+	// Check the plan against the policy once the config is valid
+	if c.String("policy") != "" && !config.HasErrors(diagnostics) {
+		policyDiagnostics, err := checkConfigPolicy(c, configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking policy: %v\n", err)
+			os.Exit(exitCodeRuntimeError)
+		}
+		diagnostics = append(diagnostics, policyDiagnostics...)
+	}
+
 	// Check for validation errors
 	hasErrors := config.HasErrors(diagnostics)
 
@@ -591,16 +1046,20 @@ func createApp() *cli.App {
 	app := &cli.App{
 		Name:                 "mooncake",
 		Usage:                "Space fighters provisioning tool, Chookity!",
+		Version:              version.Version,
 		EnableBashCompletion: true,
 
 		Commands: []*cli.Command{
 			presetsCommand(),
 			docsCommand(),
 			schemaCommand(),
+			mcpCommand(),
+			serveCommand(),
+			vaultCommand(),
 			{
 				Name:  "run",
 				Usage: "Run a space fighter",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:     "config",
 						Aliases:  []string{"c"},
@@ -651,6 +1110,25 @@ func createApp() *cli.App {
 						Value: false,
 						Usage: "Preview what would be executed without making changes",
 					},
+					&cli.BoolFlag{
+						Name:  "diff",
+						Value: false,
+						Usage: "Show a diff of the files each step would change (requires --dry-run)",
+					},
+					&cli.BoolFlag{
+						Name:  "keep-going",
+						Value: false,
+						Usage: "Continue after a failed step, skipping only steps that depend on it",
+					},
+					&cli.IntFlag{
+						Name:  "parallel",
+						Value: 0,
+						Usage: "Run up to N independent steps at once, following depends_on (1 = sequential; default: sequential, or 4 if the config sets strategy: parallel)",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Maximum duration of the whole run (e.g., 30m); the running step is cancelled when it expires",
+					},
 					&cli.StringFlag{
 						Name:  "output-format",
 						Value: "text",
@@ -680,17 +1158,107 @@ func createApp() *cli.App {
 						Name:  "from-plan",
 						Usage: "Execute from saved plan file (JSON or YAML)",
 					},
+					&cli.StringFlag{
+						Name:  "verify-key",
+						Usage: "Require the --from-plan plan to be signed by this public key (see 'mooncake keygen')",
+					},
+					&cli.BoolFlag{
+						Name:  "allow-drift",
+						Usage: "Run the --from-plan plan even if it was built on another host, by another mooncake version or from changed sources",
+					},
+					&cli.StringFlag{
+						Name:  "resume",
+						Usage: "Resume a failed run by its run ID, skipping the steps it completed (uses its saved plan unless --config is given)",
+					},
+					&cli.StringFlag{
+						Name:  "start-at-step",
+						Usage: "Skip the steps before the step with this ID or name (see 'mooncake plan')",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Resume even if the plan has changed since the resumed run",
+					},
 					&cli.StringFlag{
 						Name:  "facts-json",
 						Usage: "Path to write collected facts as JSON",
 					},
-				},
+					&cli.StringFlag{
+						Name:  "host",
+						Usage: "Apply the config to a remote host over SSH ([user@]host[:port]); the plan is built with the host's facts",
+					},
+					&cli.StringFlag{
+						Name:  "root",
+						Usage: "Apply the config to an alternate root directory, such as a mounted image: paths are resolved under it and commands run in it with chroot",
+					},
+					&cli.StringFlag{
+						Name:    "inventory",
+						Aliases: []string{"i"},
+						Usage:   "Apply the config to the hosts of an inventory file, each with its own facts, variables and plan",
+					},
+					&cli.StringFlag{
+						Name:  "limit",
+						Usage: "Only run on these inventory hosts or groups (comma-separated, globs allowed, !name excludes)",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: defaultConcurrency,
+						Usage: "Run on up to N inventory hosts at once",
+					},
+					&cli.BoolFlag{
+						Name:  "fail-fast",
+						Usage: "Stop all inventory hosts after the first host fails",
+					},
+					&cli.BoolFlag{
+						Name:  "continue",
+						Usage: "Run every inventory host to completion even if others fail (default)",
+					},
+					policyFlag("Check the plan and every step against the policy in file, and refuse to run what it doesn't allow"),
+				}, append(append(eventSinkFlags(), tracingFlags()...), vaultPasswordFlags(true)...)...),
 				Action: run,
 			},
 			{
-				Name:  "plan",
-				Usage: "Generate and display execution plan",
+				Name:      "undo",
+				Usage:     "Undo the changes of a run, using the journal saved in its artifacts",
+				ArgsUsage: "<run-id>",
 				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "artifacts-dir",
+						Value: artifacts.DefaultBaseDir,
+						Usage: "Directory the run stored its artifacts in",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Show what would be undone without making changes",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Undo even if files were modified since the run, discarding the modifications",
+					},
+					&cli.StringFlag{
+						Name:    "sudo-pass",
+						Aliases: []string{"s"},
+						Usage:   "Sudo password for changes made with become: true (requires --insecure-sudo-pass)",
+					},
+					&cli.BoolFlag{
+						Name:    "ask-become-pass",
+						Aliases: []string{"K"},
+						Usage:   "Prompt for sudo password interactively (recommended)",
+					},
+					&cli.StringFlag{
+						Name:  "sudo-pass-file",
+						Usage: "Read sudo password from file (must have 0600 permissions)",
+					},
+					&cli.BoolFlag{
+						Name:  "insecure-sudo-pass",
+						Usage: "Allow --sudo-pass flag (WARNING: password visible in shell history)",
+					},
+				},
+				Action: undoCommand,
+			},
+			{
+				Name:  "drift",
+				Usage: "Report the resources that drifted from a config, without changing anything (exits 2 on drift)",
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:     "config",
 						Aliases:  []string{"c"},
@@ -707,6 +1275,53 @@ func createApp() *cli.App {
 						Aliases: []string{"t"},
 						Usage:   "Filter steps by tags (comma-separated)",
 					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   "text",
+						Usage:   "Output format: text or json",
+					},
+					&cli.StringFlag{
+						Name:    "sudo-pass",
+						Aliases: []string{"s"},
+						Usage:   "Sudo password for checks of steps with become: true (requires --insecure-sudo-pass)",
+					},
+					&cli.BoolFlag{
+						Name:    "ask-become-pass",
+						Aliases: []string{"K"},
+						Usage:   "Prompt for sudo password interactively (recommended)",
+					},
+					&cli.StringFlag{
+						Name:  "sudo-pass-file",
+						Usage: "Read sudo password from file (must have 0600 permissions)",
+					},
+					&cli.BoolFlag{
+						Name:  "insecure-sudo-pass",
+						Usage: "Allow --sudo-pass flag (WARNING: password visible in shell history)",
+					},
+				}, vaultPasswordFlags(true)...),
+				Action: driftCommand,
+			},
+			{
+				Name:  "plan",
+				Usage: "Generate and display execution plan",
+				Flags: append([]cli.Flag{
+					// Not marked Required, which would also apply to 'plan diff'
+					&cli.StringFlag{
+						Name:    "config",
+						Aliases: []string{"c"},
+						Usage:   "Path to configuration file (required)",
+					},
+					&cli.StringFlag{
+						Name:    "vars",
+						Aliases: []string{"v"},
+						Usage:   "Path to variables file",
+					},
+					&cli.StringFlag{
+						Name:    "tags",
+						Aliases: []string{"t"},
+						Usage:   "Filter steps by tags (comma-separated)",
+					},
 					&cli.StringFlag{
 						Name:    "format",
 						Aliases: []string{"f"},
@@ -718,13 +1333,37 @@ func createApp() *cli.App {
 						Value: false,
 						Usage: "Show origin file:line:col for each step",
 					},
+					&cli.BoolFlag{
+						Name:  "diff",
+						Value: false,
+						Usage: "Dry-run the plan and show the predicted changes with file diffs",
+					},
 					&cli.StringFlag{
 						Name:    "output",
 						Aliases: []string{"o"},
 						Usage:   "Save plan to file (format determined by extension: .json, .yaml, .yml)",
 					},
+					&cli.StringFlag{
+						Name:  "sign-key",
+						Usage: "Sign the saved plan with this private key (see 'mooncake keygen'; requires --output)",
+					},
+					policyFlag("Fail if the plan violates the policy in file"),
+				}, vaultPasswordFlags(true)...),
+				Action:      planCommand,
+				Subcommands: []*cli.Command{planDiffCommand()},
+			},
+			{
+				Name:  "keygen",
+				Usage: "Generate an ed25519 key pair for signing plans",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "out",
+						Aliases:  []string{"o"},
+						Required: true,
+						Usage:    "Path to write the private key to (the public key is written to <path>.pub)",
+					},
 				},
-				Action: planCommand,
+				Action: keygenCommand,
 			},
 			{
 				Name:  "facts",
@@ -765,7 +1404,7 @@ func createApp() *cli.App {
 					{
 						Name:  "run",
 						Usage: "Execute agent iteration",
-						Flags: []cli.Flag{
+						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:     "goal",
 								Aliases:  []string{"g"},
@@ -795,7 +1434,8 @@ func createApp() *cli.App {
 								Value: 5,
 								Usage: "Maximum iterations for loop mode",
 							},
-						},
+							policyFlag("Check the plans against the policy in file (default: no become, packages, services or downloads, and writes only under the current directory)"),
+						}, sandboxFlags()...),
 						Action: agentRunCommand,
 					},
 				},
@@ -821,6 +1461,7 @@ func createApp() *cli.App {
 						Value:   "text",
 						Usage:   "Output format: text or json",
 					},
+					policyFlag("Also check the plan of the config against the policy in file"),
 				},
 				Action: validateCommand,
 			},
@@ -834,6 +1475,20 @@ func main() {
 	app := createApp()
 
 	if err := app.Run(os.Args); err != nil {
+		var resumableErr *executor.ResumableError
+		if errors.As(err, &resumableErr) {
+			fmt.Fprintf(os.Stderr, "Resume with: %s\n", resumableErr.ResumeCommand())
+		}
+		var cancelErr *executor.CancelledError
+		if errors.As(err, &cancelErr) {
+			// Interrupted or timed out; the run summary shows where it stopped
+			os.Exit(exitCodeCancelled)
+		}
+		var stepErr *executor.StepError
+		if errors.As(err, &stepErr) {
+			// Step failures are already reported by the run summary
+			os.Exit(exitCodeStepFailed)
+		}
 		log.Fatal(err)
 	}
 }
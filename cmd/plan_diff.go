@@ -0,0 +1,413 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	outputFormatMarkdown = "markdown"
+
+	// planDiffValueMax is the longest field value shown in text and Markdown output
+	planDiffValueMax = 120
+)
+
+func planDiffCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "diff",
+		Usage:     "Compare two plans: two saved plan files, or a config at two git revisions",
+		ArgsUsage: "[old-plan new-plan]",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Value:   "text",
+				Usage:   "Output format: text, json, or markdown",
+			},
+			&cli.StringFlag{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "Path to configuration file, to compare it at --base and --head",
+			},
+			&cli.StringFlag{
+				Name:    "vars",
+				Aliases: []string{"v"},
+				Usage:   "Path to variables file (read at each revision)",
+			},
+			&cli.StringFlag{
+				Name:    "tags",
+				Aliases: []string{"t"},
+				Usage:   "Filter steps by tags (comma-separated)",
+			},
+			&cli.StringFlag{
+				Name:  "base",
+				Usage: "Git revision to build the old plan from (requires --config)",
+			},
+			&cli.StringFlag{
+				Name:  "head",
+				Usage: "Git revision to build the new plan from (default: the working tree)",
+			},
+		}, vaultPasswordFlags(true)...),
+		Action: planDiffAction,
+	}
+}
+
+func planDiffAction(c *cli.Context) error {
+	format := c.String("format")
+	if format != outputFormatText && format != outputFormatJSON && format != outputFormatMarkdown {
+		return fmt.Errorf("invalid format: %s (must be 'text', 'json' or 'markdown')", format)
+	}
+	if err := useVaultPassword(c); err != nil {
+		return err
+	}
+
+	var oldPlan, newPlan *plan.Plan
+	var oldLabel, newLabel string
+	switch {
+	case c.NArg() == 2:
+		if c.String("config") != "" || c.String("base") != "" || c.String("head") != "" {
+			return fmt.Errorf("plan files can't be combined with --config, --base or --head")
+		}
+		oldLabel, newLabel = c.Args().Get(0), c.Args().Get(1)
+		var err error
+		if oldPlan, err = plan.LoadPlanFromFile(oldLabel); err != nil {
+			return fmt.Errorf("failed to load plan: %w", err)
+		}
+		if newPlan, err = plan.LoadPlanFromFile(newLabel); err != nil {
+			return fmt.Errorf("failed to load plan: %w", err)
+		}
+	case c.NArg() == 0 && c.String("base") != "":
+		configPath := c.String("config")
+		if configPath == "" {
+			return fmt.Errorf("--base requires --config")
+		}
+		varsPath, tags := c.String("vars"), parseTags(c.String("tags"))
+		base, head := c.String("base"), c.String("head")
+
+		var err error
+		oldLabel = configPath + "@" + base
+		if oldPlan, err = buildPlanAtRevision(configPath, varsPath, tags, base); err != nil {
+			return err
+		}
+		if head == "" {
+			newLabel = configPath
+			newPlan, err = buildPlan(configPath, varsPath, tags)
+		} else {
+			newLabel = configPath + "@" + head
+			newPlan, err = buildPlanAtRevision(configPath, varsPath, tags, head)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("plan diff needs two plan files, or --config with --base")
+	}
+
+	diff, err := plan.DiffPlans(oldPlan.Redact(), newPlan.Redact())
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case outputFormatJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	case outputFormatMarkdown:
+		writePlanDiffMarkdown(os.Stdout, oldLabel, newLabel, diff)
+	default:
+		writePlanDiffText(os.Stdout, oldLabel, newLabel, diff)
+	}
+	return nil
+}
+
+// buildPlan builds the plan of a config, reading variables from varsPath if given.
+func buildPlan(configPath, varsPath string, tags []string) (*plan.Plan, error) {
+	variables := make(map[string]interface{})
+	if varsPath != "" {
+		vars, err := config.ReadVariables(varsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read variables: %w", err)
+		}
+		variables = vars
+	}
+
+	// Planner will inject system facts automatically
+	planner, err := plan.NewPlanner()
+	if err != nil {
+		return nil, err
+	}
+	planData, err := planner.BuildPlan(plan.PlannerConfig{
+		ConfigPath: configPath,
+		Variables:  variables,
+		Tags:       tags,
+		VarsPath:   varsPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build plan: %w", err)
+	}
+	return planData, nil
+}
+
+// buildPlanAtRevision builds the plan of a config as it is at a git revision of
+// its repository. The repository tree at that revision is exported to a temporary
+// directory; a vars file inside the repository is read from there too.
+func buildPlanAtRevision(configPath, varsPath string, tags []string, rev string) (*plan.Plan, error) {
+	absConfig, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	top, err := git(filepath.Dir(absConfig), "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a git repository: %w", configPath, err)
+	}
+	top = strings.TrimSpace(top)
+
+	archive, err := git(top, "archive", "--format=tar", rev)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export revision %s: %w", rev, err)
+	}
+	checkout, err := os.MkdirTemp("", "mooncake-plan-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(checkout) }()
+	if err := extractTar(strings.NewReader(archive), checkout); err != nil {
+		return nil, fmt.Errorf("failed to export revision %s: %w", rev, err)
+	}
+
+	// inCheckout maps a path in the repository to the same path in the checkout.
+	// Symlinks are resolved first, as git does for the top-level directory.
+	inCheckout := func(path string) (string, error) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+			abs = filepath.Join(dir, filepath.Base(abs))
+		}
+		rel, err := filepath.Rel(top, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%s is outside the repository %s", path, top)
+		}
+		return filepath.Join(checkout, rel), nil
+	}
+	revConfig, err := inCheckout(absConfig)
+	if err != nil {
+		return nil, err
+	}
+	if varsPath != "" {
+		if revVars, err := inCheckout(varsPath); err == nil {
+			varsPath = revVars
+		}
+	}
+
+	planData, err := buildPlan(revConfig, varsPath, tags)
+	if err != nil {
+		return nil, fmt.Errorf("revision %s: %w", rev, err)
+	}
+	return planData, nil
+}
+
+// git runs a git command in dir and returns its output.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...) // #nosec G204 -- fixed git subcommands, revision from CLI argument
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", errors.New(msg)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// extractTar extracts the directories, files and symlinks of a tar archive to dir.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Clean(header.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0750); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode).Perm()) // #nosec G304 -- target is inside dir
+			if err != nil {
+				return err
+			}
+			// #nosec G110 -- the archive is the user's own repository
+			if _, err := io.Copy(file, tr); err != nil {
+				_ = file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writePlanDiffText prints a plan diff: + added, - removed, ~ modified steps with
+// their changed fields, and a summary.
+func writePlanDiffText(w io.Writer, oldLabel, newLabel string, diff *plan.Diff) {
+	_, _ = fmt.Fprintf(w, "Plan diff: %s -> %s\n", oldLabel, newLabel)
+	if !diff.Empty() {
+		_, _ = fmt.Fprintln(w)
+	}
+	for _, step := range diff.Removed {
+		_, _ = fmt.Fprintf(w, "- %s\n", formatStepRef(step))
+	}
+	for _, step := range diff.Added {
+		_, _ = fmt.Fprintf(w, "+ %s\n", formatStepRef(step))
+	}
+	for _, change := range diff.Modified {
+		_, _ = fmt.Fprintf(w, "~ %s\n", formatStepRef(changedStepRef(change)))
+		for _, field := range change.Fields {
+			_, _ = fmt.Fprintf(w, "    %s: %s -> %s\n", field.Path, formatFieldValue(field.Old), formatFieldValue(field.New))
+		}
+	}
+	_, _ = fmt.Fprintf(w, "\n%s\n", planDiffSummary(diff))
+}
+
+// writePlanDiffMarkdown prints a plan diff as Markdown, e.g. for a PR comment.
+func writePlanDiffMarkdown(w io.Writer, oldLabel, newLabel string, diff *plan.Diff) {
+	_, _ = fmt.Fprintf(w, "### Plan diff\n\n`%s` → `%s`: %s\n", oldLabel, newLabel, planDiffSummary(diff))
+
+	if len(diff.Added) > 0 {
+		_, _ = fmt.Fprintf(w, "\n#### Added\n\n")
+		for _, step := range diff.Added {
+			_, _ = fmt.Fprintf(w, "- %s\n", formatStepRefMarkdown(step))
+		}
+	}
+	if len(diff.Removed) > 0 {
+		_, _ = fmt.Fprintf(w, "\n#### Removed\n\n")
+		for _, step := range diff.Removed {
+			_, _ = fmt.Fprintf(w, "- %s\n", formatStepRefMarkdown(step))
+		}
+	}
+	if len(diff.Modified) > 0 {
+		_, _ = fmt.Fprintf(w, "\n#### Modified\n")
+		for _, change := range diff.Modified {
+			_, _ = fmt.Fprintf(w, "\n- %s\n\n", formatStepRefMarkdown(changedStepRef(change)))
+			_, _ = fmt.Fprintf(w, "  | Field | Old | New |\n  |---|---|---|\n")
+			for _, field := range change.Fields {
+				_, _ = fmt.Fprintf(w, "  | `%s` | %s | %s |\n", field.Path, markdownValue(field.Old), markdownValue(field.New))
+			}
+		}
+	}
+}
+
+func planDiffSummary(diff *plan.Diff) string {
+	if diff.Empty() {
+		return fmt.Sprintf("no changes, %d steps unchanged", diff.Unchanged)
+	}
+	return fmt.Sprintf("%d added, %d removed, %d modified, %d unchanged",
+		len(diff.Added), len(diff.Removed), len(diff.Modified), diff.Unchanged)
+}
+
+// changedStepRef returns the new step of a change, showing the old ID too if the
+// step was renumbered.
+func changedStepRef(change plan.StepChange) plan.StepRef {
+	ref := change.New
+	if change.Old.ID != change.New.ID {
+		ref.ID = change.Old.ID + " -> " + change.New.ID
+	}
+	return ref
+}
+
+func formatStepRef(step plan.StepRef) string {
+	s := fmt.Sprintf("[%s] ", step.ID)
+	if step.Name != "" {
+		s += step.Name + " "
+	}
+	kind := step.Action
+	if step.Handler {
+		kind = "handler, " + kind
+	}
+	s += "(" + kind + ")"
+	if step.Origin != "" {
+		s += " " + step.Origin
+	}
+	return s
+}
+
+func formatStepRefMarkdown(step plan.StepRef) string {
+	s := fmt.Sprintf("`%s`", step.ID)
+	if step.Name != "" {
+		s += " **" + markdownCell(step.Name) + "**"
+	}
+	kind := step.Action
+	if step.Handler {
+		kind = "handler, " + kind
+	}
+	s += " (" + kind + ")"
+	if step.Origin != "" {
+		s += fmt.Sprintf(" — `%s`", step.Origin)
+	}
+	return s
+}
+
+// formatFieldValue formats a field value as JSON, shortened to planDiffValueMax runes.
+func formatFieldValue(value interface{}) string {
+	if value == nil {
+		return "(none)"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	runes := []rune(string(data))
+	if len(runes) > planDiffValueMax {
+		return string(runes[:planDiffValueMax]) + "…"
+	}
+	return string(runes)
+}
+
+// markdownValue formats a field value as a code span for a Markdown table cell.
+func markdownValue(value interface{}) string {
+	if value == nil {
+		return "(none)"
+	}
+	return "`" + strings.ReplaceAll(markdownCell(formatFieldValue(value)), "`", "'") + "`"
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
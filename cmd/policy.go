@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/policy"
+	"github.com/urfave/cli/v2"
+)
+
+// policyFlag is the flag of the policy the steps of a command are checked against.
+func policyFlag(usage string) cli.Flag {
+	return &cli.StringFlag{
+		Name:    "policy",
+		EnvVars: []string{"MOONCAKE_POLICY"},
+		Usage:   usage,
+	}
+}
+
+// loadPolicy loads the policy file of --policy, or returns nil without it.
+func loadPolicy(c *cli.Context) (*policy.Policy, error) {
+	path := c.String("policy")
+	if path == "" {
+		return nil, nil
+	}
+	return policy.Load(path)
+}
+
+// checkPolicy prints the policy violations of a plan and fails if it has any.
+func checkPolicy(p *plan.Plan, runPolicy *policy.Policy) error {
+	diagnostics, err := runPolicy.CheckPlan(p)
+	if err != nil {
+		return err
+	}
+	if !config.HasErrors(diagnostics) {
+		return nil
+	}
+	fmt.Fprintln(os.Stderr, config.FormatDiagnosticsWithContext(diagnostics))
+	return fmt.Errorf("the plan violates the policy (%d violation(s))", len(diagnostics))
+}
+
+// checkConfigPolicy builds the plan of a config with the variables file of
+// --vars and returns its violations of the policy of --policy.
+func checkConfigPolicy(c *cli.Context, configPath string) ([]config.Diagnostic, error) {
+	runPolicy, err := loadPolicy(c)
+	if err != nil {
+		return nil, err
+	}
+	planData, err := buildPlan(configPath, c.String("vars"), nil)
+	if err != nil {
+		return nil, err
+	}
+	return runPolicy.CheckPlan(planData)
+}
@@ -48,8 +48,9 @@ Use subcommands for non-interactive operations.`,
 				Name:  "insecure-sudo-pass",
 				Usage: "Allow --sudo-pass flag (WARNING: password visible in shell history)",
 			},
+			requireSignedFlag(),
 		},
-		Subcommands: []*cli.Command{
+		Subcommands: append([]*cli.Command{
 			{
 				Name:      "add",
 				Usage:     "Add a preset from URL, git repository, or local path",
@@ -64,14 +65,20 @@ Sources can be:
 
 The preset is cached in ~/.mooncake/cache/presets/ and installed to ~/.mooncake/presets/.
 
+Signatures published next to the preset (<url>.sig or <url>.minisig) are
+verified against the trust store (see 'mooncake presets trust'). Presets with
+an invalid signature are refused, as are unsigned ones with --require-signed.
+
 Examples:
   mooncake presets add https://raw.githubusercontent.com/user/repo/main/presets/foo.yml
-  mooncake presets add ./local-presets/custom.yml`,
+  mooncake presets add ./local-presets/custom.yml
+  mooncake presets add --require-signed https://example.com/presets/foo.yml`,
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:  "name",
 						Usage: "Override preset name (extracted from file by default)",
 					},
+					requireSignedFlag(),
 				},
 			},
 			{
@@ -126,6 +133,7 @@ Examples:
 						Aliases: []string{"p"},
 						Usage:   "Set parameter value (format: key=value, can be used multiple times)",
 					},
+					requireSignedFlag(),
 				},
 			},
 			{
@@ -170,7 +178,7 @@ It does not delete the preset files from disk.`,
 					},
 				},
 			},
-		},
+		}, presetSigningCommands()...),
 		Action: interactiveSelectorAction,
 	}
 }
@@ -539,6 +547,12 @@ func executePresetInstall(c *cli.Context, name string) error {
 	if c.String("sudo-pass") != "" && !c.Bool("insecure-sudo-pass") {
 		return fmt.Errorf("--sudo-pass requires --insecure-sudo-pass flag (WARNING: password will be visible in shell history and process list)")
 	}
+
+	// Verify the signature of the preset before loading it
+	if err := verifyInstalledPreset(c, name); err != nil {
+		return err
+	}
+
 	// Load the preset to validate it exists
 	preset, err := presets.LoadPreset(name)
 	if err != nil {
@@ -811,6 +825,11 @@ func uninstallPresetAction(c *cli.Context) error {
 		return fmt.Errorf("--sudo-pass requires --insecure-sudo-pass flag (WARNING: password will be visible in shell history and process list)")
 	}
 
+	// Verify the signature of the preset before loading it
+	if err := verifyInstalledPreset(c, name); err != nil {
+		return err
+	}
+
 	// Load the preset to validate it exists
 	preset, err := presets.LoadPreset(name)
 	if err != nil {
@@ -968,6 +987,18 @@ func addPresetAction(c *cli.Context) error {
 
 	fmt.Printf("Found preset: %s\n", presetName)
 
+	// Verify the signature: of the file of flat presets, of the whole
+	// directory of directory presets
+	signedPath := presetFile
+	if filepath.Base(presetFile) == "preset.yml" && filepath.Dir(presetFile) != cachedDir {
+		signedPath = filepath.Dir(presetFile)
+	}
+	signer, err := verifyPresetSignature(c, presetName, signedPath, manifest.Get(presetName))
+	if err != nil {
+		_ = os.RemoveAll(cachedDir) // Clean up
+		return err
+	}
+
 	// Calculate SHA256 of preset file
 	sha256hash, err := registry.CalculateSHA256(presetFile)
 	if err != nil {
@@ -990,6 +1021,10 @@ func addPresetAction(c *cli.Context) error {
 		SHA256:      sha256hash,
 		InstalledAt: time.Now(),
 	}
+	if signer != nil {
+		entry.Signer = signer.Name
+		entry.SignerKeyID = signer.KeyID
+	}
 	manifest.Add(entry)
 
 	if err := manifest.Save(); err != nil {
@@ -1005,6 +1040,9 @@ func addPresetAction(c *cli.Context) error {
 	fmt.Printf("\n✓ Preset '%s' added successfully\n", presetName)
 	fmt.Printf("  Source:  %s\n", source)
 	fmt.Printf("  SHA256:  %s\n", sha256hash[:16]+"...")
+	if signer != nil {
+		fmt.Printf("  Signer:  %s\n", signer)
+	}
 	fmt.Printf("  Cached:  %s\n", finalCacheDir)
 	fmt.Printf("\nUse in your mooncake.yml:\n")
 	fmt.Printf("  - preset: %s\n", presetName)
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/alehatsman/mooncake/internal/presets"
+	"github.com/alehatsman/mooncake/internal/registry"
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/urfave/cli/v2"
+)
+
+// requireSignedFlag is the flag refusing presets that aren't signed by a
+// trusted publisher.
+func requireSignedFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    "require-signed",
+		EnvVars: []string{"MOONCAKE_REQUIRE_SIGNED_PRESETS"},
+		Usage:   "Refuse presets that aren't signed by a key of the trust store (see 'mooncake presets trust')",
+	}
+}
+
+// presetSigningCommands creates the presets subcommands for signing presets
+// and managing the trust store.
+func presetSigningCommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:      "sign",
+			Usage:     "Sign a preset file or directory with an ed25519 key",
+			ArgsUsage: "<preset-path>",
+			Action:    signPresetAction,
+			Description: `Write a detached signature of a preset, covering all its files: <name>.yml.sig
+next to a flat preset, preset.sig inside a directory preset. Publish it with
+the preset; users who trust the public key can then verify it.
+
+Examples:
+  mooncake keygen --out publisher.key
+  mooncake presets sign --key publisher.key ./presets/foo/`,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "key",
+					Required: true,
+					Usage:    "Private key to sign with (see 'mooncake keygen')",
+				},
+			},
+		},
+		{
+			Name:      "manifest",
+			Usage:     "Print the manifest a preset signature covers",
+			ArgsUsage: "<preset-path>",
+			Action:    presetManifestAction,
+			Description: `Print the SHA-256 of every file of a preset, as signatures cover them.
+To sign a preset with minisign instead of 'mooncake presets sign':
+
+  mooncake presets manifest foo.yml > foo.manifest
+  minisign -S -m foo.manifest -x foo.yml.minisig`,
+		},
+		{
+			Name:  "trust",
+			Usage: "Manage the keys of trusted preset publishers",
+			Description: `The trust store (~/.mooncake/trust) holds the public keys of publishers whose
+signed presets 'presets add' and 'presets install' accept. Keys are ed25519
+public keys of 'mooncake keygen' or minisign public keys.`,
+			Subcommands: []*cli.Command{
+				{
+					Name:      "add",
+					Usage:     "Trust the presets signed by a public key",
+					ArgsUsage: "<name> <public-key-file>",
+					Action:    trustAddAction,
+				},
+				{
+					Name:   "list",
+					Usage:  "List the trusted keys",
+					Action: trustListAction,
+				},
+				{
+					Name:      "remove",
+					Usage:     "Stop trusting a key",
+					ArgsUsage: "<name>",
+					Action:    trustRemoveAction,
+				},
+			},
+		},
+	}
+}
+
+// verifyInstalledPreset locates an installed preset and checks its signature
+// against the trust store and its registry entry, printing its signer.
+func verifyInstalledPreset(c *cli.Context, name string) error {
+	presetPath, err := presets.Locate(name)
+	if err != nil {
+		return err
+	}
+	var entry *registry.ManifestEntry
+	if cacheDir, cacheErr := registry.DefaultCacheDir(); cacheErr == nil {
+		if manifest, manifestErr := registry.LoadManifest(cacheDir); manifestErr == nil {
+			entry = manifest.Get(name)
+		}
+	}
+	signer, err := verifyPresetSignature(c, name, presetPath, entry)
+	if err != nil {
+		return err
+	}
+	if signer != nil {
+		fmt.Printf("✓ Preset '%s' is signed by %s\n", name, signer)
+	}
+	return nil
+}
+
+// verifyPresetSignature checks the signature of the preset at path against the
+// trust store and returns its signer, or nil for presets that aren't signed by
+// a trusted key. An invalid signature always fails; unsigned and untrusted
+// presets fail with --require-signed, or if entry, the registry entry of the
+// preset, records a signer, and are reported otherwise.
+func verifyPresetSignature(c *cli.Context, name string, path string, entry *registry.ManifestEntry) (*registry.Signer, error) {
+	store, err := loadTrustStore()
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := registry.VerifyPreset(path, store)
+	if err == nil {
+		return signer, nil
+	}
+	if !errors.Is(err, registry.ErrUnsigned) && !errors.Is(err, registry.ErrUntrusted) {
+		return nil, fmt.Errorf("preset '%s': %w", name, err)
+	}
+	if entry != nil && entry.Signer != "" {
+		return nil, fmt.Errorf("preset '%s': %w, but it was signed by %s (key %s) when added", name, err, entry.Signer, entry.SignerKeyID)
+	}
+	if c.Bool("require-signed") {
+		return nil, fmt.Errorf("preset '%s': %w (--require-signed)", name, err)
+	}
+	// Unsigned presets that weren't added from a source are the user's own
+	if entry != nil || errors.Is(err, registry.ErrUntrusted) {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", name, err)
+	}
+	return nil, nil
+}
+
+// signPresetAction signs a preset with an ed25519 key
+func signPresetAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("preset path required\n\nUsage: mooncake presets sign --key <key> <preset-path>")
+	}
+
+	key, err := security.LoadSigningKey(c.String("key"))
+	if err != nil {
+		return err
+	}
+	sigPath, err := registry.SignPreset(c.Args().First(), key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Signature saved to %s (key ID %s)\n", sigPath, security.KeyID(key.Public().(ed25519.PublicKey)))
+	return nil
+}
+
+// presetManifestAction prints the manifest of a preset
+func presetManifestAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("preset path required\n\nUsage: mooncake presets manifest <preset-path>")
+	}
+
+	manifest, err := registry.PresetManifest(c.Args().First())
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(manifest)
+	return err
+}
+
+// loadTrustStore loads the default trust store
+func loadTrustStore() (*registry.TrustStore, error) {
+	trustDir, err := registry.DefaultTrustDir()
+	if err != nil {
+		return nil, err
+	}
+	return registry.LoadTrustStore(trustDir)
+}
+
+// trustAddAction adds a public key to the trust store
+func trustAddAction(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("name and public key file required\n\nUsage: mooncake presets trust add <name> <public-key-file>")
+	}
+
+	store, err := loadTrustStore()
+	if err != nil {
+		return err
+	}
+	key, err := store.Add(c.Args().Get(0), c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Trusting presets signed by %s (%s key %s)\n", key.Name, key.Format, key.KeyID)
+	return nil
+}
+
+// trustListAction lists the keys of the trust store
+func trustListAction(c *cli.Context) error {
+	store, err := loadTrustStore()
+	if err != nil {
+		return err
+	}
+	if len(store.Keys) == 0 {
+		fmt.Printf("No trusted keys in %s\n", store.Dir)
+		return nil
+	}
+
+	for _, key := range store.Keys {
+		fmt.Printf("%-20s %-9s %s\n", key.Name, key.Format, key.KeyID)
+	}
+	return nil
+}
+
+// trustRemoveAction removes a key from the trust store
+func trustRemoveAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("key name required\n\nUsage: mooncake presets trust remove <name>")
+	}
+
+	store, err := loadTrustStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Remove(c.Args().First()); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Removed %s from the trust store\n", c.Args().First())
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/alehatsman/mooncake/internal/sandbox"
+	"github.com/urfave/cli/v2"
+)
+
+// sandboxFlags are the flags of the sandbox the commands of a run execute in.
+func sandboxFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "sandbox",
+			Usage: "Run shell and command steps in a sandbox (Linux): the repository is writable, the rest of the filesystem read-only, and there is no network",
+		},
+		&cli.BoolFlag{
+			Name:  "sandbox-network",
+			Usage: "Allow network access in the sandbox",
+		},
+		&cli.DurationFlag{
+			Name:  "sandbox-cpu",
+			Usage: "CPU time limit of each command in the sandbox (e.g., 5m)",
+		},
+		&cli.StringFlag{
+			Name:  "sandbox-memory",
+			Usage: "Memory (address space) limit of each process in the sandbox (e.g., 2GB)",
+		},
+		&cli.DurationFlag{
+			Name:  "sandbox-timeout",
+			Usage: "Wall-clock time limit of each command in the sandbox (e.g., 10m)",
+		},
+	}
+}
+
+// loadSandbox returns the sandbox of --sandbox and its limits, or nil without
+// it. The writable paths are left to the caller.
+func loadSandbox(c *cli.Context) (*sandbox.Config, error) {
+	if !c.Bool("sandbox") {
+		for _, name := range []string{"sandbox-network", "sandbox-cpu", "sandbox-memory", "sandbox-timeout"} {
+			if c.IsSet(name) {
+				return nil, fmt.Errorf("--%s requires --sandbox", name)
+			}
+		}
+		return nil, nil
+	}
+	if err := sandbox.Supported(); err != nil {
+		return nil, err
+	}
+
+	box := &sandbox.Config{
+		Network: c.Bool("sandbox-network"),
+		CPU:     c.Duration("sandbox-cpu"),
+		Timeout: c.Duration("sandbox-timeout"),
+	}
+	if box.CPU < 0 || box.Timeout < 0 {
+		return nil, fmt.Errorf("--sandbox-cpu and --sandbox-timeout must be positive")
+	}
+	if memory := c.String("sandbox-memory"); memory != "" {
+		size, err := sandbox.ParseSize(memory)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid --sandbox-memory %q: must be a positive size (e.g., 2GB)", memory)
+		}
+		box.Memory = size
+	}
+	return box, nil
+}
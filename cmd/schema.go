@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
+	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/schemagen"
 	"github.com/urfave/cli/v2"
 )
@@ -31,7 +33,8 @@ Examples:
   mooncake schema generate --format yaml --output schema.yml
   mooncake schema generate --format openapi --output openapi.json
   mooncake schema generate --format typescript --output mooncake.d.ts
-  mooncake schema validate --schema schema.json --config config.yml`,
+  mooncake schema validate --schema schema.json --config config.yml
+  mooncake schema events --output events.schema.json`,
 		Subcommands: []*cli.Command{
 			{
 				Name:  "generate",
@@ -78,6 +81,18 @@ Examples:
 				},
 				Action: validateSchemaAction,
 			},
+			{
+				Name:  "events",
+				Usage: "Generate the JSON Schema of event records (--events-file, --events-webhook, --events-syslog)",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Output file (default: stdout)",
+					},
+				},
+				Action: eventsSchemaAction,
+			},
 		},
 	}
 }
@@ -232,3 +247,23 @@ func validateSchemaAction(c *cli.Context) error {
 	os.Exit(1)
 	return nil
 }
+
+// eventsSchemaAction handles the schema events command.
+func eventsSchemaAction(c *cli.Context) error {
+	data, err := json.MarshalIndent(events.Schema(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode events schema: %w", err)
+	}
+	data = append(data, '\n')
+
+	output := c.String("output")
+	if output == "" {
+		_, err = c.App.Writer.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0600); err != nil {
+		return fmt.Errorf("failed to write events schema: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Generated events schema to %s\n", output)
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/api"
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/urfave/cli/v2"
+)
+
+// tokenEnvVar holds the API token of mooncake serve, unless --token-file is set.
+const tokenEnvVar = "MOONCAKE_API_TOKEN"
+
+// shutdownTimeout bounds how long mooncake serve waits for requests to finish
+// when it stops.
+const shutdownTimeout = 10 * time.Second
+
+// serveCommand creates the serve command, which runs the local HTTP API.
+func serveCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Serve a local HTTP API to validate, plan and queue runs",
+		Description: `Run an HTTP API for local tools and UIs.
+
+Endpoints (all but /v1/health require "Authorization: Bearer <token>"):
+  GET  /v1/health                        Server status
+  GET  /v1/facts                         System facts
+  POST /v1/validate                      Validate a config
+  POST /v1/plan                          Build the plan of a config
+  POST /v1/runs                          Queue a run
+  GET  /v1/runs                          Runs of this server and the artifacts directory
+  GET  /v1/runs/{id}                     Status and summary of a run
+  POST /v1/runs/{id}/cancel              Cancel a queued or running run
+  GET  /v1/runs/{id}/events              Events of a run, as Server-Sent Events
+  GET  /v1/runs/{id}/artifacts/{file}    Artifact file of a run
+
+Runs are executed one at a time, in the order they were queued. The token is
+read from --token-file or $MOONCAKE_API_TOKEN; without them, a token is
+generated and printed to stderr. GET requests also accept the token as the
+access_token query parameter, for browser EventSource streams.`,
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "listen",
+				Value: "127.0.0.1:8787",
+				Usage: "Address to listen on: host:port, or unix:PATH for a unix socket",
+			},
+			&cli.StringFlag{
+				Name:  "token-file",
+				Usage: "Read the API token from file",
+			},
+			&cli.StringFlag{
+				Name:  "artifacts-dir",
+				Value: artifacts.DefaultBaseDir,
+				Usage: "Directory runs save their artifacts to, and past runs are read from",
+			},
+			&cli.StringFlag{
+				Name:  "sudo-pass-file",
+				Usage: "Read the sudo password of runs from file (must have 0600 permissions)",
+			},
+			&cli.StringFlag{
+				Name:  "log-level",
+				Value: "info",
+				Usage: "Log level of runs: debug, info or error",
+			},
+		}, append(eventSinkFlags(), vaultPasswordFlags(false)...)...),
+		Action: serveAction,
+	}
+}
+
+// serveAction serves the API until interrupted.
+func serveAction(c *cli.Context) error {
+	level, err := logger.ParseLogLevel(c.String("log-level"))
+	if err != nil {
+		return err
+	}
+	token, generated, err := apiToken(c.String("token-file"))
+	if err != nil {
+		return err
+	}
+	if err := useVaultPassword(c); err != nil {
+		return err
+	}
+	eventSinks, err := openEventSinks(c)
+	if err != nil {
+		return err
+	}
+	defer closeEventSinks(eventSinks)
+	server, err := api.NewServer(api.Options{
+		Token:        token,
+		ArtifactsDir: c.String("artifacts-dir"),
+		SudoPassFile: c.String("sudo-pass-file"),
+		Log:          logger.NewLogger(level),
+		Sinks:        eventSinks,
+	})
+	if err != nil {
+		return err
+	}
+
+	listener, err := listen(c.String("listen"))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.App.ErrWriter, "Listening on %s\n", c.String("listen"))
+	if generated {
+		fmt.Fprintf(c.App.ErrWriter, "API token: %s\n", token)
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		_ = server.Run(ctx)
+	}()
+
+	httpServer := &http.Server{Handler: server.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- httpServer.Serve(listener) }()
+
+	select {
+	case err = <-serveErr:
+		stop()
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err = httpServer.Shutdown(shutdownCtx)
+	}
+	<-workerDone
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// apiToken returns the API token from tokenFile or $MOONCAKE_API_TOKEN, or a
+// new random token.
+func apiToken(tokenFile string) (token string, generated bool, err error) {
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile) // #nosec G304 -- user-provided token file
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read token file: %w", err)
+		}
+		if token = strings.TrimSpace(string(data)); token == "" {
+			return "", false, fmt.Errorf("token file %s is empty", tokenFile)
+		}
+		return token, false, nil
+	}
+	if token = os.Getenv(tokenEnvVar); token != "" {
+		return token, false, nil
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", false, err
+	}
+	return hex.EncodeToString(random), true, nil
+}
+
+// listen listens on a TCP address or, with the unix: prefix, on a unix socket
+// only accessible to the current user.
+func listen(address string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(address, "unix:")
+	if !isUnix {
+		return net.Listen("tcp", address)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("socket %s is already in use", path)
+		}
+		// Stale socket of a previous server
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// withInterrupt returns a context that is cancelled on the first SIGINT or SIGTERM,
+// with the signal as the cancellation cause. The running step is stopped and the run
+// winds down (events flushed, artifacts written). A second signal terminates the
+// process immediately.
+func withInterrupt(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-signals:
+			// Restore default handling so another signal exits right away
+			signal.Stop(signals)
+			fmt.Fprintf(os.Stderr, "\nReceived %s, stopping run (press Ctrl-C again to exit immediately)\n", sig)
+			cancel(fmt.Errorf("received %s", sig))
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel(context.Canceled)
+	}
+}
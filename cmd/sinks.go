@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/sinks"
+	"github.com/urfave/cli/v2"
+)
+
+// syslogTag is the tag of the syslog messages of event sinks.
+const syslogTag = "mooncake"
+
+// eventSinkFlags are the flags of the event sinks of runs. They can be set by
+// environment variables, to ship the events of every run on a machine.
+func eventSinkFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "events-file",
+			EnvVars: []string{"MOONCAKE_EVENTS_FILE"},
+			Usage:   "Append the events of runs to a JSON lines file",
+		},
+		&cli.StringFlag{
+			Name:    "events-webhook",
+			EnvVars: []string{"MOONCAKE_EVENTS_WEBHOOK"},
+			Usage:   "POST the events of runs to a URL in batches",
+		},
+		&cli.StringFlag{
+			Name:    "events-webhook-secret-file",
+			EnvVars: []string{"MOONCAKE_EVENTS_WEBHOOK_SECRET_FILE"},
+			Usage:   "Sign webhook requests with the secret in file (HMAC-SHA256, X-Mooncake-Signature header)",
+		},
+		&cli.BoolFlag{
+			Name:    "events-syslog",
+			EnvVars: []string{"MOONCAKE_EVENTS_SYSLOG"},
+			Usage:   "Write the events of runs to the local syslog (collected by journald on systemd hosts)",
+		},
+	}
+}
+
+// openEventSinks opens the event sinks selected by the flags. The caller closes
+// them with closeEventSinks.
+func openEventSinks(c *cli.Context) ([]sinks.Sink, error) {
+	if c.IsSet("events-webhook-secret-file") && c.String("events-webhook") == "" {
+		return nil, fmt.Errorf("--events-webhook-secret-file requires --events-webhook")
+	}
+
+	var opened []sinks.Sink
+	fail := func(err error) ([]sinks.Sink, error) {
+		closeEventSinks(opened)
+		return nil, err
+	}
+	if path := c.String("events-file"); path != "" {
+		sink, err := sinks.NewFileSink(path)
+		if err != nil {
+			return fail(err)
+		}
+		opened = append(opened, sink)
+	}
+	if webhookURL := c.String("events-webhook"); webhookURL != "" {
+		var secret []byte
+		if path := c.String("events-webhook-secret-file"); path != "" {
+			data, err := os.ReadFile(path) // #nosec G304 -- user-provided secret file
+			if err != nil {
+				return fail(fmt.Errorf("failed to read webhook secret: %w", err))
+			}
+			if secret = []byte(strings.TrimSpace(string(data))); len(secret) == 0 {
+				return fail(fmt.Errorf("webhook secret file %s is empty", path))
+			}
+		}
+		sink, err := sinks.NewWebhookSink(sinks.WebhookOptions{URL: webhookURL, Secret: secret})
+		if err != nil {
+			return fail(err)
+		}
+		opened = append(opened, sink)
+	}
+	if c.Bool("events-syslog") {
+		sink, err := sinks.NewSyslogSink("", "", syslogTag)
+		if err != nil {
+			return fail(err)
+		}
+		opened = append(opened, sink)
+	}
+	return opened, nil
+}
+
+// closeEventSinks closes event sinks, delivering their pending events. Errors
+// are printed as warnings: the run is over.
+func closeEventSinks(opened []sinks.Sink) {
+	for _, sink := range opened {
+		if err := sink.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+}
+
+// subscribeEventSinks subscribes the sinks to the events of a run on host: the
+// remote host of the run, or this host.
+func subscribeEventSinks(publisher events.Publisher, opened []sinks.Sink, host string) {
+	if len(opened) == 0 {
+		return
+	}
+	if host == "" {
+		host = localHostname()
+	}
+	publisher.Subscribe(sinks.NewSubscriber(host, opened...))
+}
+
+// localHostname returns the name of this host, or "localhost" if it is unknown.
+func localHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "localhost"
+	}
+	return hostname
+}
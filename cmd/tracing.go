@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/tracing"
+	"github.com/urfave/cli/v2"
+)
+
+// tracingFlags are the flags of the OTLP trace exporter of runs. They read the
+// standard OpenTelemetry environment variables.
+func tracingFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "otlp-endpoint",
+			EnvVars: []string{"OTEL_EXPORTER_OTLP_ENDPOINT"},
+			Usage:   "Export runs as traces to an OTLP/HTTP collector (base URL, e.g. http://localhost:4318)",
+		},
+		&cli.StringSliceFlag{
+			Name:    "otlp-header",
+			EnvVars: []string{"OTEL_EXPORTER_OTLP_HEADERS"},
+			Usage:   "Header of OTLP requests, as key=value (repeatable)",
+		},
+	}
+}
+
+// openTracer returns the trace exporter selected by the flags, or nil. The
+// caller closes it with closeTracer.
+func openTracer(c *cli.Context) (*tracing.Exporter, error) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if c.IsSet("otlp-endpoint") || endpoint == "" {
+		endpoint = c.String("otlp-endpoint")
+		if endpoint == "" {
+			if c.IsSet("otlp-header") {
+				return nil, fmt.Errorf("--otlp-header requires --otlp-endpoint")
+			}
+			return nil, nil
+		}
+		endpoint = tracing.TracesEndpoint(endpoint)
+	}
+
+	headers := make(map[string]string)
+	for _, header := range c.StringSlice("otlp-header") {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid OTLP header %q: want key=value", header)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return tracing.NewExporter(tracing.ExporterOptions{
+		Endpoint:    endpoint,
+		Headers:     headers,
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+	})
+}
+
+// closeTracer exports the pending spans. Errors are printed as warnings: the
+// run is over.
+func closeTracer(exporter *tracing.Exporter) {
+	if exporter == nil {
+		return
+	}
+	if err := exporter.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// subscribeTracer subscribes the spans of a run on host to exporter. The run
+// joins the trace of $TRACEPARENT, if set.
+func subscribeTracer(publisher events.Publisher, exporter *tracing.Exporter, host string) {
+	if exporter == nil {
+		return
+	}
+	if host == "" {
+		host = localHostname()
+	}
+	opts := tracing.Options{Host: host}
+	if traceparent := os.Getenv(tracing.TraceparentEnvVar); traceparent != "" {
+		parent, err := tracing.ParseTraceparent(traceparent)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v, starting a new trace\n", err)
+		} else {
+			parent.TraceState = os.Getenv(tracing.TracestateEnvVar)
+			opts.Parent = parent
+		}
+	}
+	publisher.Subscribe(tracing.NewSubscriber(exporter, opts))
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/vault"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+// vaultPasswordFlags are the flags of the password of encrypted variables
+// files. With ask, the password can be prompted for.
+func vaultPasswordFlags(ask bool) []cli.Flag {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:    "vault-password-file",
+			EnvVars: []string{"MOONCAKE_VAULT_PASSWORD_FILE"},
+			Usage:   "Read the password of encrypted variables files from file (must have 0600 permissions)",
+		},
+	}
+	if ask {
+		flags = append(flags, &cli.BoolFlag{
+			Name:  "ask-vault-pass",
+			Usage: "Prompt for the password of encrypted variables files",
+		})
+	}
+	return flags
+}
+
+// useVaultPassword sets the password of the encrypted variables files read by
+// the command: from --vault-password-file, $MOONCAKE_VAULT_PASSWORD or, with
+// --ask-vault-pass, a prompt before anything runs.
+func useVaultPassword(c *cli.Context) error {
+	if c.Bool("ask-vault-pass") {
+		if c.String("vault-password-file") != "" {
+			return fmt.Errorf("only one vault password method can be specified (--ask-vault-pass, --vault-password-file)")
+		}
+		password, err := (&security.InteractivePasswordProvider{Prompt: "Vault password: "}).GetPassword()
+		if err != nil {
+			return err
+		}
+		vault.SetPassword(password)
+		return nil
+	}
+	vault.SetPasswordProvider(vaultPasswordProvider(c.String("vault-password-file")))
+	return nil
+}
+
+// vaultPasswordProvider returns the provider of the vault password of file or
+// $MOONCAKE_VAULT_PASSWORD, or nil.
+func vaultPasswordProvider(file string) security.PasswordProvider {
+	if file != "" {
+		return &security.FilePasswordProvider{FilePath: file}
+	}
+	if os.Getenv(vault.PasswordEnvVar) != "" {
+		return &security.EnvVarPasswordProvider{Name: vault.PasswordEnvVar}
+	}
+	return nil
+}
+
+// vaultPassword returns the password of the vault subcommands from provider or,
+// without one, a prompt. New passwords are prompted for twice.
+func vaultPassword(provider security.PasswordProvider, flag, prompt string, confirm bool) (string, error) {
+	if provider != nil {
+		return provider.GetPassword()
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("no vault password: use --%s or $%s", flag, vault.PasswordEnvVar)
+	}
+	password, err := (&security.InteractivePasswordProvider{Prompt: prompt}).GetPassword()
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", fmt.Errorf("vault password is empty")
+	}
+	if confirm {
+		again, err := (&security.InteractivePasswordProvider{Prompt: "Confirm " + strings.ToLower(prompt[:1]) + prompt[1:]}).GetPassword()
+		if err != nil {
+			return "", err
+		}
+		if again != password {
+			return "", fmt.Errorf("vault passwords don't match")
+		}
+	}
+	return password, nil
+}
+
+// currentVaultPassword returns the password of the files of a vault subcommand.
+func currentVaultPassword(c *cli.Context, prompt string, confirm bool) (string, error) {
+	return vaultPassword(vaultPasswordProvider(c.String("vault-password-file")), "vault-password-file", prompt, confirm)
+}
+
+func vaultCommand() *cli.Command {
+	passwordFlag := vaultPasswordFlags(false)
+	return &cli.Command{
+		Name:  "vault",
+		Usage: "Encrypt variables files",
+		Description: `Encrypted variables files are read by --vars and include_vars like plain
+ones, with the password of --vault-password-file, $MOONCAKE_VAULT_PASSWORD
+or --ask-vault-pass. Their values are redacted from the output of runs.
+
+Without --vault-password-file or $MOONCAKE_VAULT_PASSWORD, the vault
+subcommands prompt for the password.`,
+		Subcommands: []*cli.Command{
+			{
+				Name:      "encrypt",
+				Usage:     "Encrypt files in place",
+				ArgsUsage: "FILE...",
+				Flags:     passwordFlag,
+				Action:    vaultEncryptAction,
+			},
+			{
+				Name:      "decrypt",
+				Usage:     "Decrypt files in place, or a file to --output",
+				ArgsUsage: "FILE...",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Write the decrypted file to a path, or - for stdout, instead of in place",
+					},
+				}, passwordFlag...),
+				Action: vaultDecryptAction,
+			},
+			{
+				Name:      "edit",
+				Usage:     "Edit an encrypted file in $EDITOR, creating it if it doesn't exist",
+				ArgsUsage: "FILE",
+				Flags:     passwordFlag,
+				Action:    vaultEditAction,
+			},
+			{
+				Name:      "rekey",
+				Usage:     "Change the password of encrypted files",
+				ArgsUsage: "FILE...",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "new-vault-password-file",
+						Usage: "Read the new password from file (must have 0600 permissions)",
+					},
+				}, passwordFlag...),
+				Action: vaultRekeyAction,
+			},
+		},
+	}
+}
+
+// vaultEncryptAction handles the vault encrypt command.
+func vaultEncryptAction(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("usage: mooncake vault encrypt FILE...")
+	}
+	files, err := readVaultFiles(c.Args().Slice())
+	if err != nil {
+		return err
+	}
+	for path, data := range files {
+		if vault.IsEncrypted(data) {
+			return fmt.Errorf("%s is already encrypted", path)
+		}
+	}
+	password, err := currentVaultPassword(c, "New vault password: ", true)
+	if err != nil {
+		return err
+	}
+	for _, path := range c.Args().Slice() {
+		encrypted, err := vault.Encrypt(files[path], password)
+		if err != nil {
+			return err
+		}
+		if err := writeVaultFile(path, encrypted); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✓ Encrypted %s\n", path)
+	}
+	return nil
+}
+
+// vaultDecryptAction handles the vault decrypt command.
+func vaultDecryptAction(c *cli.Context) error {
+	output := c.String("output")
+	if c.NArg() == 0 || (output != "" && c.NArg() != 1) {
+		return fmt.Errorf("usage: mooncake vault decrypt FILE... or mooncake vault decrypt --output PATH FILE")
+	}
+	files, err := readVaultFiles(c.Args().Slice())
+	if err != nil {
+		return err
+	}
+	for path, data := range files {
+		if !vault.IsEncrypted(data) {
+			return fmt.Errorf("%s is not encrypted", path)
+		}
+	}
+	password, err := currentVaultPassword(c, "Vault password: ", false)
+	if err != nil {
+		return err
+	}
+	for _, path := range c.Args().Slice() {
+		plaintext, err := vault.Decrypt(files[path], password)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+		switch output {
+		case "-":
+			_, err = c.App.Writer.Write(plaintext)
+			return err
+		case "":
+			err = writeVaultFile(path, plaintext)
+		default:
+			err = os.WriteFile(output, plaintext, 0600)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✓ Decrypted %s\n", path)
+	}
+	return nil
+}
+
+// vaultEditAction handles the vault edit command. The file is decrypted to a
+// private temporary directory, removed once the editor exits.
+func vaultEditAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: mooncake vault edit FILE")
+	}
+	path := c.Args().First()
+
+	// #nosec G304 -- user-provided vault file
+	data, err := os.ReadFile(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if exists && !vault.IsEncrypted(data) {
+		return fmt.Errorf("%s is not encrypted: encrypt it with mooncake vault encrypt", path)
+	}
+
+	password, err := currentVaultPassword(c, "Vault password: ", !exists)
+	if err != nil {
+		return err
+	}
+	var plaintext []byte
+	if exists {
+		if plaintext, err = vault.Decrypt(data, password); err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "mooncake-vault-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	tmp := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(tmp, plaintext, 0600); err != nil {
+		return err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	// #nosec G204 -- $EDITOR is the user's choice of editor
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", tmp)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor failed, %s is unchanged: %w", path, err)
+	}
+
+	// #nosec G304 -- temporary file written above
+	edited, err := os.ReadFile(tmp)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(edited, plaintext) {
+		fmt.Fprintf(os.Stderr, "%s is unchanged\n", path)
+		return nil
+	}
+	encrypted, err := vault.Encrypt(edited, password)
+	if err != nil {
+		return err
+	}
+	if err := writeVaultFile(path, encrypted); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✓ Saved %s\n", path)
+	return nil
+}
+
+// vaultRekeyAction handles the vault rekey command.
+func vaultRekeyAction(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return fmt.Errorf("usage: mooncake vault rekey FILE...")
+	}
+	files, err := readVaultFiles(c.Args().Slice())
+	if err != nil {
+		return err
+	}
+	password, err := currentVaultPassword(c, "Vault password: ", false)
+	if err != nil {
+		return err
+	}
+	plaintexts := make(map[string][]byte, len(files))
+	for path, data := range files {
+		if plaintexts[path], err = vault.Decrypt(data, password); err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+	}
+
+	var newProvider security.PasswordProvider
+	if file := c.String("new-vault-password-file"); file != "" {
+		newProvider = &security.FilePasswordProvider{FilePath: file}
+	}
+	newPassword, err := vaultPassword(newProvider, "new-vault-password-file", "New vault password: ", true)
+	if err != nil {
+		return err
+	}
+	for _, path := range c.Args().Slice() {
+		encrypted, err := vault.Encrypt(plaintexts[path], newPassword)
+		if err != nil {
+			return err
+		}
+		if err := writeVaultFile(path, encrypted); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✓ Rekeyed %s\n", path)
+	}
+	return nil
+}
+
+// readVaultFiles reads the files of the vault subcommands, before any is
+// changed.
+func readVaultFiles(paths []string) (map[string][]byte, error) {
+	files := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		// #nosec G304 -- user-provided vault file
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		files[path] = data
+	}
+	return files, nil
+}
+
+// writeVaultFile replaces a file atomically, keeping its permissions (0600 for
+// new files).
+func writeVaultFile(path string, data []byte) error {
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
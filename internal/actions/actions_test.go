@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -95,6 +96,10 @@ func (m *mockContext) GetCurrentStepID() string {
 	return m.stepID
 }
 
+func (m *mockContext) GetContext() context.Context {
+	return context.Background()
+}
+
 func (m *mockContext) GetEvaluator() expression.Evaluator {
 	return expression.NewExprEvaluator()
 }
@@ -419,9 +424,7 @@ func TestRegistry_ThreadSafety(t *testing.T) {
 				metadata: ActionMetadata{Name: fmt.Sprintf("concurrent_%d", idx)},
 			}
 			if err := reg.Register(handler); err != nil {
-
-				t.Fatalf("Register failed: %v", err)
-
+				t.Errorf("Register failed: %v", err)
 			}
 		}(i)
 	}
@@ -846,3 +849,30 @@ func TestRegistry_StressTest(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestContentDrift(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after []byte
+		want          string
+	}{
+		{"missing", nil, []byte("a\n"), "missing"},
+		{"missing empty file", nil, []byte{}, "missing"},
+		{"differs", []byte("a\n"), []byte("b\n"), "content differs"},
+		{"equal", []byte("a\n"), []byte("a\n"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drift := ContentDrift("/etc/app.conf", tt.before, tt.after)
+			if tt.want == "" {
+				if drift != nil {
+					t.Errorf("ContentDrift() = %+v, want none", drift)
+				}
+				return
+			}
+			if len(drift) != 1 || drift[0].Kind != DriftFile || drift[0].Resource != "/etc/app.conf" || drift[0].Detail != tt.want {
+				t.Errorf("ContentDrift() = %+v, want file drift %q", drift, tt.want)
+			}
+		})
+	}
+}
@@ -97,7 +97,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 
 	// Determine assertion type and execute
 	if assert.Command != nil {
-		expected, actual, err = h.executeAssertCommand(assert.Command, ec)
+		expected, actual, err = h.executeAssertCommand(step, assert.Command, ec)
 	} else if assert.File != nil {
 		expected, actual, err = h.executeAssertFile(assert.File, ec)
 	} else if assert.HTTP != nil {
@@ -121,6 +121,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 			Expected: expected,
 			Actual:   actual,
 			Failed:   true,
+			StepID:   ec.CurrentStepID,
 		}
 		if isAssertion {
 			failureData.Type = assertionErr.Type
@@ -134,6 +135,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 		Expected: expected,
 		Actual:   actual,
 		Failed:   false,
+		StepID:   ec.CurrentStepID,
 	})
 
 	return result, nil
@@ -202,7 +204,7 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 }
 
 // executeAssertCommand executes a command assertion.
-func (h *Handler) executeAssertCommand(assertCmd *config.AssertCommand, ec *executor.ExecutionContext) (string, string, error) {
+func (h *Handler) executeAssertCommand(step *config.Step, assertCmd *config.AssertCommand, ec *executor.ExecutionContext) (string, string, error) {
 	// Render command with variables
 	cmd, err := ec.Template.Render(assertCmd.Cmd, ec.Variables)
 	if err != nil {
@@ -216,8 +218,14 @@ func (h *Handler) executeAssertCommand(assertCmd *config.AssertCommand, ec *exec
 
 	// Execute command
 	// #nosec G204 -- Command from user config is intentional functionality
-	shellCmd := exec.Command("bash", "-c", cmd)
+	shellCmd := ec.LocalCommand("bash", "-c", cmd)
 	shellCmd.Dir = ec.CurrentDir
+	// Run the command in the sandbox of the run, if it has one
+	reports, err := ec.SandboxCommand(step, shellCmd)
+	if err != nil {
+		return "", "", err
+	}
+	defer reports.Close()
 
 	output, execErr := shellCmd.CombinedOutput()
 	exitCode := 0
@@ -242,12 +250,12 @@ func (h *Handler) executeAssertCommand(assertCmd *config.AssertCommand, ec *exec
 	if exitCode != expectedExitCode {
 		expected := fmt.Sprintf("exit code %d", expectedExitCode)
 		actual := fmt.Sprintf("exit code %d", exitCode)
-		return expected, actual, &executor.AssertionError{
+		return expected, actual, executor.SandboxError(reports, string(output), &executor.AssertionError{
 			Type:     "command",
 			Expected: expected,
 			Actual:   actual,
 			Details:  fmt.Sprintf("command: %s\noutput: %s", cmd, strings.TrimSpace(string(output))),
-		}
+		})
 	}
 
 	return fmt.Sprintf("exit code %d", expectedExitCode),
@@ -474,7 +482,7 @@ func (h *Handler) executeAssertHTTP(assertHTTP *config.AssertHTTP, ec *executor.
 	}
 
 	// Create HTTP request
-	req, reqErr := http.NewRequest(method, url, bodyReader)
+	req, reqErr := http.NewRequestWithContext(ec.GetContext(), method, url, bodyReader)
 	if reqErr != nil {
 		return "", "", &executor.SetupError{
 			Component: "http request",
@@ -653,7 +661,7 @@ func (h *Handler) executeAssertGitClean(assertGit *config.AssertGitClean, ec *ex
 
 	// Check if we're in a git repository
 	// #nosec G204 -- Git command is controlled and safe
-	checkCmd := exec.Command("git", "rev-parse", "--git-dir")
+	checkCmd := ec.LocalCommand("git", "rev-parse", "--git-dir")
 	checkCmd.Dir = ec.CurrentDir
 	if err := checkCmd.Run(); err != nil {
 		return "", "", &executor.AssertionError{
@@ -667,7 +675,7 @@ func (h *Handler) executeAssertGitClean(assertGit *config.AssertGitClean, ec *ex
 
 	// Get git status
 	// #nosec G204 -- Git command is controlled and safe
-	statusCmd := exec.Command("git", "status", "--porcelain")
+	statusCmd := ec.LocalCommand("git", "status", "--porcelain")
 	statusCmd.Dir = ec.CurrentDir
 	output, err := statusCmd.CombinedOutput()
 	if err != nil {
@@ -724,7 +732,7 @@ func (h *Handler) executeAssertGitDiff(assertDiff *config.AssertGitDiff, ec *exe
 
 	// Check if we're in a git repository
 	// #nosec G204 -- Git command is controlled and safe
-	checkCmd := exec.Command("git", "rev-parse", "--git-dir")
+	checkCmd := ec.LocalCommand("git", "rev-parse", "--git-dir")
 	checkCmd.Dir = ec.CurrentDir
 	if err := checkCmd.Run(); err != nil {
 		return "", "", &executor.AssertionError{
@@ -755,7 +763,7 @@ func (h *Handler) executeAssertGitDiff(assertDiff *config.AssertGitDiff, ec *exe
 
 	// Execute git diff
 	// #nosec G204 -- Git command with controlled arguments
-	diffCmd := exec.Command("git", diffArgs...)
+	diffCmd := ec.LocalCommand("git", diffArgs...)
 	diffCmd.Dir = ec.CurrentDir
 	output, diffErr := diffCmd.CombinedOutput()
 
@@ -12,12 +12,12 @@ import (
 	"os/exec"
 	"runtime"
 	"strings"
-	"time"
 
 	"github.com/alehatsman/mooncake/internal/actions"
 	"github.com/alehatsman/mooncake/internal/config"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/transport"
 )
 
 // Handler implements the Handler interface for command actions.
@@ -35,6 +35,7 @@ func (Handler) Metadata() actions.ActionMetadata {
 		Description:        "Execute commands directly without shell interpolation",
 		Category:           actions.CategoryCommand,
 		SupportsDryRun:     true,
+		SupportsRemote:     true,
 		SupportsBecome:     true,
 		EmitsEvents:        []string{},
 		Version:            "1.0.0",
@@ -57,7 +58,7 @@ func (h *Handler) Validate(step *config.Step) error {
 	return nil
 }
 
-// Execute runs the command action with retry logic if configured.
+// Execute runs the command action. Retries and timeout are applied by the executor.
 func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Result, error) {
 	cmdAction := step.Command
 
@@ -73,44 +74,10 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 
 	ctx.GetLogger().Debugf("  Executing: %s", strings.Join(renderedArgv, " "))
 
-	// Execute with retry logic
-	return h.executeWithRetry(ctx, step, renderedArgv)
+	return h.executeCommand(ctx, step, renderedArgv)
 }
 
-// executeWithRetry executes the command with retry logic if configured.
-func (h *Handler) executeWithRetry(ctx actions.Context, step *config.Step, renderedArgv []string) (actions.Result, error) {
-	maxAttempts := step.Retries + 1
-
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		if attempt > 1 {
-			ctx.GetLogger().Debugf("  Retry attempt %d/%d", attempt, maxAttempts)
-		}
-
-		result, err := h.executeCommand(ctx, step, renderedArgv)
-		if err == nil {
-			return result, nil
-		}
-
-		// If this was the last attempt or no more retries, return the error
-		if attempt >= maxAttempts {
-			return result, err
-		}
-
-		// Sleep before retry if configured
-		if step.RetryDelay != "" {
-			delay, parseErr := time.ParseDuration(step.RetryDelay)
-			if parseErr == nil && delay > 0 {
-				ctx.GetLogger().Debugf("  Waiting %v before retry", delay)
-				time.Sleep(delay)
-			}
-		}
-	}
-
-	// Should never reach here
-	return nil, fmt.Errorf("retry logic failed unexpectedly")
-}
-
-// executeCommand executes a command once without retry logic.
+// executeCommand executes a command once.
 func (h *Handler) executeCommand(ctx actions.Context, step *config.Step, renderedArgv []string) (actions.Result, error) {
 	// We need access to SudoPass and other fields not in Context interface
 	ec, ok := ctx.(*executor.ExecutionContext)
@@ -118,45 +85,37 @@ func (h *Handler) executeCommand(ctx actions.Context, step *config.Step, rendere
 		return nil, fmt.Errorf("context is not an ExecutionContext")
 	}
 
-	// Create command with timeout context
-	execCtx := context.Background()
-	var cancel context.CancelFunc
-	if step.Timeout != "" {
-		timeout, err := time.ParseDuration(step.Timeout)
-		if err != nil {
-			return nil, fmt.Errorf("invalid timeout duration: %w", err)
-		}
-		execCtx, cancel = context.WithTimeout(execCtx, timeout)
-		defer cancel()
-	}
-
-	// Create the command
-	cmd, err := h.createDirectCommand(execCtx, step, renderedArgv, ec)
-	if err != nil {
-		return nil, err
-	}
-
-	// Configure environment variables
-	if len(step.Env) > 0 {
-		envVars := make([]string, 0, len(step.Env))
-		for key, value := range step.Env {
-			rendered, renderErr := ctx.GetTemplate().Render(value, ctx.GetVariables())
-			if renderErr != nil {
-				return nil, fmt.Errorf("failed to render env var %s: %w", key, renderErr)
-			}
-			envVars = append(envVars, fmt.Sprintf("%s=%s", key, rendered))
+	// Render environment variables
+	var envVars []string
+	for key, value := range step.Env {
+		rendered, renderErr := ctx.GetTemplate().Render(value, ctx.GetVariables())
+		if renderErr != nil {
+			return nil, fmt.Errorf("failed to render env var %s: %w", key, renderErr)
 		}
-		cmd.Env = append(cmd.Environ(), envVars...)
+		envVars = append(envVars, fmt.Sprintf("%s=%s", key, rendered))
 	}
 
-	// Set working directory if specified
+	// Render working directory if specified
+	var dir string
 	if step.Cwd != "" {
 		rendered, renderErr := ctx.GetTemplate().Render(step.Cwd, ctx.GetVariables())
 		if renderErr != nil {
 			return nil, fmt.Errorf("failed to render cwd: %w", renderErr)
 		}
-		cmd.Dir = rendered
+		dir = rendered
+	}
+
+	// Create the command under the step context (step timeout, run cancellation)
+	cmd, err := h.createDirectCommand(ctx.GetContext(), step, renderedArgv, envVars, dir, ec)
+	if err != nil {
+		return nil, err
+	}
+	// Run the command in the sandbox of the step, if it has one
+	reports, err := ec.SandboxCommand(step, cmd)
+	if err != nil {
+		return nil, err
 	}
+	defer reports.Close()
 
 	// Capture stdout and stderr
 	var stdout, stderr bytes.Buffer
@@ -195,7 +154,7 @@ func (h *Handler) executeCommand(ctx actions.Context, step *config.Step, rendere
 		}
 
 		if result.Failed {
-			return result, fmt.Errorf("command failed with exit code %d", result.Rc)
+			return result, executor.SandboxError(reports, result.Stderr, fmt.Errorf("command failed with exit code %d", result.Rc))
 		}
 	} else {
 		result.Rc = 0
@@ -237,8 +196,8 @@ func (h *Handler) executeCommand(ctx actions.Context, step *config.Step, rendere
 	return result, nil
 }
 
-// createDirectCommand creates the exec.Cmd for direct command execution (no shell).
-func (h *Handler) createDirectCommand(ctx context.Context, step *config.Step, argv []string, ec *executor.ExecutionContext) (*exec.Cmd, error) {
+// createDirectCommand creates the exec.Cmd for direct command execution (no shell) on the target host.
+func (h *Handler) createDirectCommand(ctx context.Context, step *config.Step, argv, env []string, dir string, ec *executor.ExecutionContext) (*exec.Cmd, error) {
 	if len(argv) == 0 {
 		return nil, fmt.Errorf("empty argv")
 	}
@@ -260,7 +219,7 @@ func (h *Handler) createDirectCommand(ctx context.Context, step *config.Step, ar
 		args = append(args, argv...)
 
 		// #nosec G204 - This is a provisioning tool designed to execute commands
-		command := exec.CommandContext(ctx, "sudo", args...)
+		command := ec.GetTransport().Command(ctx, transport.Cmd{Name: "sudo", Args: args, Env: env, Dir: dir})
 
 		// Handle stdin: sudo password comes first, then user stdin if provided
 		if step.Command.Stdin != "" {
@@ -277,7 +236,7 @@ func (h *Handler) createDirectCommand(ctx context.Context, step *config.Step, ar
 
 	// Direct command execution without shell
 	// #nosec G204 - This is a provisioning tool designed to execute commands
-	command := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	command := ec.GetTransport().Command(ctx, transport.Cmd{Name: argv[0], Args: argv[1:], Env: env, Dir: dir})
 
 	// Handle stdin for non-sudo commands
 	if step.Command.Stdin != "" {
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"os"
 	"runtime"
 	"strings"
@@ -379,9 +380,13 @@ func TestHandler_Execute_WithTimeout(t *testing.T) {
 		Command: &config.CommandAction{
 			Argv: argv,
 		},
-		Timeout: "500ms",
 	}
 
+	// The executor applies the step timeout through the step context
+	stepCtx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	ctx.Context = stepCtx
+
 	start := time.Now()
 	_, err := h.Execute(ctx, step)
 	elapsed := time.Since(start)
@@ -418,82 +423,6 @@ func TestHandler_Execute_WithTimeout_Success(t *testing.T) {
 	}
 }
 
-func TestHandler_Execute_WithInvalidTimeout(t *testing.T) {
-	h := &Handler{}
-	ctx := newMockExecutionContext()
-
-	step := &config.Step{
-		Command: &config.CommandAction{
-			Argv: []string{"echo", "hello"},
-		},
-		Timeout: "invalid",
-	}
-
-	_, err := h.Execute(ctx, step)
-	if err == nil {
-		t.Error("Execute() should return error for invalid timeout")
-	}
-	if !strings.Contains(err.Error(), "timeout") {
-		t.Errorf("Error should mention timeout, got: %v", err)
-	}
-}
-
-func TestHandler_Execute_WithRetry(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping retry test in short mode")
-	}
-
-	h := &Handler{}
-	ctx := newMockExecutionContext()
-
-	// Command that always fails
-	step := &config.Step{
-		Command: &config.CommandAction{
-			Argv: []string{"ls", "/nonexistent/path/12345"},
-		},
-		Retries: 2,
-	}
-
-	_, err := h.Execute(ctx, step)
-
-	if err == nil {
-		t.Error("Execute() should fail after retries")
-	}
-
-	// Just verify that retries happened and command still failed
-	// (timing is not reliable in tests)
-}
-
-func TestHandler_Execute_WithRetryDelay(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping retry delay test in short mode")
-	}
-
-	h := &Handler{}
-	ctx := newMockExecutionContext()
-
-	step := &config.Step{
-		Command: &config.CommandAction{
-			Argv: []string{"ls", "/nonexistent/path/12345"},
-		},
-		Retries:    2,
-		RetryDelay: "100ms",
-	}
-
-	start := time.Now()
-	_, err := h.Execute(ctx, step)
-	elapsed := time.Since(start)
-
-	if err == nil {
-		t.Error("Execute() should fail after retries")
-	}
-
-	// Should wait at least 200ms total (2 retries * 100ms each)
-	if elapsed < 200*time.Millisecond {
-		t.Errorf("Execute() took %v, expected at least 200ms for retry delays", elapsed)
-	}
-}
-
 func TestHandler_Execute_WithChangedWhen(t *testing.T) {
 	h := &Handler{}
 
@@ -10,22 +10,24 @@ package copy
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
-	"os/user"
 	"runtime"
 	"strconv"
 	"time"
 
 	"github.com/alehatsman/mooncake/internal/actions"
 	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/diff"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/transport"
 	"github.com/alehatsman/mooncake/internal/utils"
 )
 
+// maxDiffSize is the largest file whose content Check diffs.
+const maxDiffSize = 1 << 20
+
 // Handler implements the Handler interface for copy actions.
 type Handler struct{}
 
@@ -41,6 +43,7 @@ func (Handler) Metadata() actions.ActionMetadata {
 		Description:        "Copy files with checksum verification and atomic writes",
 		Category:           actions.CategoryFile,
 		SupportsDryRun:     true,
+		SupportsRemote:     true,
 		SupportsBecome:     true,
 		EmitsEvents:        []string{string(events.EventFileCopied)},
 		Version:            "1.0.0",
@@ -90,6 +93,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	if err != nil {
 		return nil, fmt.Errorf("failed to expand dest path: %w", err)
 	}
+	ec.JournalPath(renderedDest, step.Become)
 
 	// Create result
 	result := executor.NewResult()
@@ -127,7 +131,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	}
 
 	// Check if destination exists
-	destInfo, err := os.Stat(renderedDest)
+	destInfo, err := ec.GetTransport().Stat(renderedDest)
 	destExists := err == nil
 
 	// Determine if copy is needed
@@ -154,7 +158,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	// Create backup if requested and dest exists
 	if copyAction.Backup && destExists {
 		ctx.GetLogger().Debugf("  Creating backup of: %s", renderedDest)
-		backupPath, err := utils.CreateBackup(renderedDest)
+		backupPath, err := h.createBackup(renderedDest, ec)
 		if err != nil {
 			result.Failed = true
 			return result, fmt.Errorf("failed to create backup: %w", err)
@@ -181,7 +185,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	// Verify destination checksum if provided
 	if copyAction.Checksum != "" {
 		ctx.GetLogger().Debugf("  Verifying destination checksum: %s", copyAction.Checksum)
-		matches, err := utils.VerifyChecksum(renderedDest, copyAction.Checksum)
+		matches, err := h.verifyDestChecksum(renderedDest, copyAction.Checksum, ec)
 		if err != nil {
 			result.Failed = true
 			return result, fmt.Errorf("failed to verify destination checksum: %w", err)
@@ -239,7 +243,7 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	}
 
 	// Check if destination exists
-	destInfo, err := os.Stat(renderedDest)
+	destInfo, err := ec.GetTransport().Stat(renderedDest)
 	destExists := err == nil
 
 	// Determine if copy is needed
@@ -276,6 +280,70 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	return nil
 }
 
+// Check predicts whether Execute would copy the file, with a diff of the content
+// for files up to maxDiffSize.
+func (h *Handler) Check(ctx actions.Context, step *config.Step) (actions.CheckResult, error) {
+	copyAction := step.Copy
+
+	ec, ok := ctx.(*executor.ExecutionContext)
+	if !ok {
+		return actions.CheckResult{}, fmt.Errorf("context is not an ExecutionContext")
+	}
+
+	renderedSrc, err := ec.PathUtil.ExpandPath(copyAction.Src, ec.CurrentDir, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to expand src path: %w", err)
+	}
+
+	renderedDest, err := ec.PathUtil.ExpandPath(copyAction.Dest, ec.CurrentDir, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to expand dest path: %w", err)
+	}
+
+	srcInfo, err := os.Stat(renderedSrc)
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	// Same idempotency rule as Execute: size and modification time
+	destInfo, err := ec.GetTransport().Stat(renderedDest)
+	destExists := err == nil
+	upToDate := destExists && destInfo.Size() == srcInfo.Size() && destInfo.ModTime().Equal(srcInfo.ModTime())
+	if upToDate && !copyAction.Force {
+		return actions.CheckResult{}, nil
+	}
+
+	check := actions.CheckResult{Changed: true}
+	switch {
+	case !destExists:
+		check.Drift = []actions.Drift{{Kind: actions.DriftFile, Resource: renderedDest, Detail: "missing"}}
+	case destInfo.Size() != srcInfo.Size():
+		check.Drift = []actions.Drift{{Kind: actions.DriftFile, Resource: renderedDest, Detail: "content differs"}}
+	case !upToDate:
+		check.Drift = []actions.Drift{{Kind: actions.DriftFile, Resource: renderedDest, Detail: "modification time differs"}}
+	}
+	if srcInfo.Size() > maxDiffSize || (destExists && destInfo.Size() > maxDiffSize) {
+		return check, nil
+	}
+
+	// #nosec G304 -- File paths from user config are intentional
+	srcContent, err := os.ReadFile(renderedSrc)
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to read source: %w", err)
+	}
+	var destContent []byte
+	if destExists {
+		if destContent, err = ec.GetTransport().ReadFile(renderedDest); err != nil {
+			return actions.CheckResult{}, fmt.Errorf("failed to read destination: %w", err)
+		}
+	}
+	check.Diff = diff.File(renderedDest, destContent, srcContent)
+	if destExists && !upToDate && !bytes.Equal(destContent, srcContent) {
+		check.Drift = actions.ContentDrift(renderedDest, destContent, srcContent)
+	}
+	return check, nil
+}
+
 // Helper functions
 
 func (h *Handler) formatMode(mode os.FileMode) string {
@@ -295,45 +363,32 @@ func (h *Handler) parseFileMode(modeStr string, defaultMode os.FileMode) os.File
 	return os.FileMode(mode)
 }
 
-func (h *Handler) copyFile(src, dest string, mode os.FileMode, step *config.Step, ec *executor.ExecutionContext, ctx actions.Context) error {
+func (h *Handler) copyFile(src, dest string, mode os.FileMode, step *config.Step, ec *executor.ExecutionContext, _ actions.Context) error {
 	// #nosec G304 -- File path from user config is intentional
-	srcFile, err := os.Open(src)
+	content, err := os.ReadFile(src)
 	if err != nil {
 		return fmt.Errorf("failed to open source: %w", err)
 	}
-	defer func() {
-		if closeErr := srcFile.Close(); closeErr != nil {
-			ctx.GetLogger().Debugf("Failed to close source file: %v", closeErr)
-		}
-	}()
 
-	// Create temporary file for atomic write
-	tmpFile, err := os.CreateTemp("", "mooncake-copy-*")
+	// Create temporary file on the target host for atomic write
+	target := ec.GetTransport()
+	tmpPath, err := target.TempFile()
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
-	tmpPath := tmpFile.Name()
 	defer func() {
-		if closeErr := tmpFile.Close(); closeErr != nil {
-			ctx.GetLogger().Debugf("Failed to close temp file: %v", closeErr)
-		}
-		if removeErr := os.Remove(tmpPath); removeErr != nil {
-			ctx.GetLogger().Debugf("Failed to remove temp file %s: %v", tmpPath, removeErr)
+		if removeErr := target.Remove(tmpPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			ec.Logger.Debugf("Failed to remove temp file %s: %v", tmpPath, removeErr)
 		}
 	}()
 
 	// Copy contents
-	if _, err := io.Copy(tmpFile, srcFile); err != nil {
+	if err := target.WriteFile(tmpPath, content, 0600); err != nil {
 		return fmt.Errorf("failed to copy contents: %w", err)
 	}
 
-	// Close temp file before moving
-	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("failed to close temp file: %w", err)
-	}
-
 	// Set permissions on temp file
-	if err := os.Chmod(tmpPath, mode); err != nil {
+	if err := target.Chmod(tmpPath, mode); err != nil {
 		return fmt.Errorf("failed to set permissions: %w", err)
 	}
 
@@ -346,12 +401,12 @@ func (h *Handler) copyFile(src, dest string, mode os.FileMode, step *config.Step
 			return fmt.Errorf("step requires sudo but no password provided")
 		}
 		// Use sudo for final move
-		cmd := fmt.Sprintf("mv %q %q", tmpPath, dest)
+		cmd := fmt.Sprintf("mv %s %s", transport.Quote(tmpPath), transport.Quote(dest))
 		if err := h.executeSudoCommand(cmd, step, ec); err != nil {
 			return fmt.Errorf("failed to move file with sudo: %w", err)
 		}
 	} else {
-		if err := os.Rename(tmpPath, dest); err != nil {
+		if err := target.Rename(tmpPath, dest); err != nil {
 			return fmt.Errorf("failed to move file: %w", err)
 		}
 	}
@@ -359,35 +414,45 @@ func (h *Handler) copyFile(src, dest string, mode os.FileMode, step *config.Step
 	return nil
 }
 
-func (h *Handler) setOwnership(path, owner, group string, step *config.Step, ec *executor.ExecutionContext) error {
-	if owner == "" && group == "" {
-		return nil
+// createBackup copies a destination file to a timestamped .bak file next to it,
+// with the same mode, and returns the backup path.
+func (h *Handler) createBackup(path string, ec *executor.ExecutionContext) (string, error) {
+	target := ec.GetTransport()
+	info, err := target.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("source file does not exist: %s", path)
+	}
+	content, err := target.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source file: %w", err)
 	}
 
-	if step.Become || runtime.GOOS != "linux" {
-		return h.chownWithBecome(path, owner, group, step, ec)
+	backupPath := fmt.Sprintf("%s.%s.bak", path, time.Now().Format("20060102-150405"))
+	if err := target.WriteFile(backupPath, content, info.Mode()&os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to write backup file: %w", err)
 	}
+	return backupPath, nil
+}
 
-	// Parse owner and group
-	uid := -1
-	gid := -1
-	var err error
+// verifyDestChecksum verifies the checksum of a destination file.
+func (h *Handler) verifyDestChecksum(path, expected string, ec *executor.ExecutionContext) (bool, error) {
+	content, err := ec.GetTransport().ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open file: %w", err)
+	}
+	return utils.VerifyDataChecksum(content, expected)
+}
 
-	if owner != "" {
-		uid, err = h.parseUserID(owner)
-		if err != nil {
-			return fmt.Errorf("failed to parse owner: %w", err)
-		}
+func (h *Handler) setOwnership(path, owner, group string, step *config.Step, ec *executor.ExecutionContext) error {
+	if owner == "" && group == "" {
+		return nil
 	}
 
-	if group != "" {
-		gid, err = h.parseGroupID(group)
-		if err != nil {
-			return fmt.Errorf("failed to parse group: %w", err)
-		}
+	if step.Become || runtime.GOOS != "linux" {
+		return h.chownWithBecome(path, owner, group, step, ec)
 	}
 
-	return os.Chown(path, uid, gid)
+	return ec.GetTransport().Chown(path, owner, group)
 }
 
 func (h *Handler) chownWithBecome(path, owner, group string, step *config.Step, ec *executor.ExecutionContext) error {
@@ -412,53 +477,13 @@ func (h *Handler) chownWithBecome(path, owner, group string, step *config.Step,
 		ownerGroup = ":" + group
 	}
 
-	cmd := fmt.Sprintf("chown %s %q", ownerGroup, path)
+	cmd := fmt.Sprintf("chown %s %s", transport.Quote(ownerGroup), transport.Quote(path))
 	return h.executeSudoCommand(cmd, step, ec)
 }
 
-func (h *Handler) parseUserID(owner string) (int, error) {
-	// Try as UID first
-	if uid, err := strconv.Atoi(owner); err == nil {
-		return uid, nil
-	}
-
-	// Lookup username
-	u, err := user.Lookup(owner)
-	if err != nil {
-		return -1, fmt.Errorf("user not found: %s", owner)
-	}
-
-	uid, err := strconv.Atoi(u.Uid)
-	if err != nil {
-		return -1, fmt.Errorf("invalid UID: %s", u.Uid)
-	}
-
-	return uid, nil
-}
-
-func (h *Handler) parseGroupID(group string) (int, error) {
-	// Try as GID first
-	if gid, err := strconv.Atoi(group); err == nil {
-		return gid, nil
-	}
-
-	// Lookup group name
-	g, err := user.LookupGroup(group)
-	if err != nil {
-		return -1, fmt.Errorf("group not found: %s", group)
-	}
-
-	gid, err := strconv.Atoi(g.Gid)
-	if err != nil {
-		return -1, fmt.Errorf("invalid GID: %s", g.Gid)
-	}
-
-	return gid, nil
-}
-
 func (h *Handler) executeSudoCommand(command string, _ *config.Step, ec *executor.ExecutionContext) error {
 	// #nosec G204 - This is a provisioning tool designed to execute commands
-	cmd := exec.Command("sudo", "-S", "sh", "-c", command)
+	cmd := ec.Command("sudo", "-S", "sh", "-c", command)
 	cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 
 	var stderr bytes.Buffer
@@ -8,7 +8,6 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -477,6 +476,59 @@ func TestHandler_Execute_IdempotencyByTime(t *testing.T) {
 	}
 }
 
+func TestHandler_Check(t *testing.T) {
+	h := &Handler{}
+
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "source.txt")
+	destPath := filepath.Join(tmpDir, "dest.txt")
+	if err := os.WriteFile(srcPath, []byte("new\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(destPath, []byte("older\n"), 0644); err != nil {
+		t.Fatalf("Failed to create dest file: %v", err)
+	}
+
+	ec := mockExecutionContext()
+	step := &config.Step{Copy: &config.Copy{Src: srcPath, Dest: destPath}}
+
+	check, err := h.Check(ec, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !check.Changed || !strings.Contains(check.Diff, "-older\n+new\n") {
+		t.Errorf("Check() = %+v, want a change from older to new", check)
+	}
+	if len(check.Drift) != 1 || check.Drift[0].Detail != "content differs" {
+		t.Errorf("Check().Drift = %+v, want content drift", check.Drift)
+	}
+
+	// Same size and modification time: up to date, as for Execute
+	if err := os.WriteFile(destPath, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srcInfo, _ := os.Stat(srcPath)
+	if err := os.Chtimes(destPath, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	check, err = h.Check(ec, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if check.Changed || check.Diff != "" {
+		t.Errorf("Check() = %+v, want no change", check)
+	}
+
+	step.Copy.Force = true
+	check, err = h.Check(ec, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !check.Changed || check.Diff != "" || len(check.Drift) != 0 {
+		t.Errorf("Check() with force = %+v, want a change with identical content and no drift", check)
+	}
+}
+
 func TestHandler_Execute_ForceCopy(t *testing.T) {
 	h := &Handler{}
 
@@ -1087,57 +1139,6 @@ func TestHandler_formatMode(t *testing.T) {
 	}
 }
 
-func TestHandler_parseUserID(t *testing.T) {
-	h := &Handler{}
-
-	// Test with numeric UID
-	uid, err := h.parseUserID("1000")
-	if err != nil {
-		t.Errorf("parseUserID() with numeric UID error = %v", err)
-	}
-	if uid != 1000 {
-		t.Errorf("parseUserID() = %d, want 1000", uid)
-	}
-
-	// Test with current user
-	currentUser, err := user.Current()
-	if err == nil {
-		uid, err := h.parseUserID(currentUser.Username)
-		if err != nil {
-			t.Errorf("parseUserID() with username error = %v", err)
-		}
-		expectedUID, _ := strconv.Atoi(currentUser.Uid)
-		if uid != expectedUID {
-			t.Errorf("parseUserID() = %d, want %d", uid, expectedUID)
-		}
-	}
-
-	// Test with invalid user
-	_, err = h.parseUserID("nonexistentuser12345")
-	if err == nil {
-		t.Error("parseUserID() should error with nonexistent user")
-	}
-}
-
-func TestHandler_parseGroupID(t *testing.T) {
-	h := &Handler{}
-
-	// Test with numeric GID
-	gid, err := h.parseGroupID("1000")
-	if err != nil {
-		t.Errorf("parseGroupID() with numeric GID error = %v", err)
-	}
-	if gid != 1000 {
-		t.Errorf("parseGroupID() = %d, want 1000", gid)
-	}
-
-	// Test with invalid group
-	_, err = h.parseGroupID("nonexistentgroup12345")
-	if err == nil {
-		t.Error("parseGroupID() should error with nonexistent group")
-	}
-}
-
 func TestHandler_Execute_OwnershipWithoutBecome(t *testing.T) {
 	// Skip on non-Linux or if not running as root
 	if runtime.GOOS != "linux" {
@@ -1506,32 +1507,6 @@ func TestHandler_Execute_MultipleBackups(t *testing.T) {
 	t.Logf("Created %d backup files (may be less than 3 due to backup logic)", len(files))
 }
 
-func TestHandler_ParseUserID_RootUser(t *testing.T) {
-	h := &Handler{}
-
-	// Test with root user (should exist on all Unix systems)
-	if runtime.GOOS != "windows" {
-		uid, err := h.parseUserID("root")
-		if err != nil {
-			t.Errorf("parseUserID('root') error = %v", err)
-		} else if uid != 0 {
-			t.Errorf("parseUserID('root') = %d, want 0", uid)
-		}
-	}
-}
-
-func TestHandler_ParseGroupID_RootGroup(t *testing.T) {
-	h := &Handler{}
-
-	// Test with numeric GID 0 (root)
-	gid, err := h.parseGroupID("0")
-	if err != nil {
-		t.Errorf("parseGroupID('0') error = %v", err)
-	} else if gid != 0 {
-		t.Errorf("parseGroupID('0') = %d, want 0", gid)
-	}
-}
-
 func TestHandler_Execute_CopyWithDifferentTimestamps(t *testing.T) {
 	h := &Handler{}
 	tmpDir := t.TempDir()
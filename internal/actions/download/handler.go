@@ -14,7 +14,7 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"time"
@@ -24,6 +24,7 @@ import (
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/transport"
 	"github.com/alehatsman/mooncake/internal/utils"
 )
 
@@ -46,6 +47,7 @@ func (Handler) Metadata() actions.ActionMetadata {
 		Description:        "Download files from URLs with checksum verification",
 		Category:           actions.CategoryNetwork,
 		SupportsDryRun:     true,
+		SupportsRoot:       true,
 		SupportsBecome:     true,
 		EmitsEvents:        []string{string(events.EventFileDownloaded)},
 		Version:            "1.0.0",
@@ -96,6 +98,13 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	if err != nil {
 		return nil, fmt.Errorf("failed to expand dest path: %w", err)
 	}
+	ec.JournalPath(renderedDest, step.Become)
+
+	// The file is written on this host, under the root in alternate roots
+	hostDest, err := transport.HostPath(ec.GetTransport(), renderedDest)
+	if err != nil {
+		return nil, err
+	}
 
 	// Create result
 	result := executor.NewResult()
@@ -108,14 +117,14 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	}()
 
 	// Check if destination exists
-	_, err = os.Stat(renderedDest)
+	_, err = os.Stat(hostDest)
 	destExists := err == nil
 
 	// If destination exists and checksum is provided, check if we need to re-download
 	needsDownload := !destExists || downloadAction.Force
 	if destExists && !downloadAction.Force && downloadAction.Checksum != "" {
 		// Verify existing file checksum for idempotency
-		matches, checksumErr := utils.VerifyChecksum(renderedDest, downloadAction.Checksum)
+		matches, checksumErr := utils.VerifyChecksum(hostDest, downloadAction.Checksum)
 		if checksumErr != nil {
 			ctx.GetLogger().Debugf("  Unable to verify checksum of existing file: %v", checksumErr)
 			needsDownload = true
@@ -141,7 +150,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	// Create backup if requested and dest exists
 	if downloadAction.Backup && destExists {
 		ctx.GetLogger().Debugf("  Creating backup of: %s", renderedDest)
-		backupPath, err := utils.CreateBackup(renderedDest)
+		backupPath, err := utils.CreateBackup(hostDest)
 		if err != nil {
 			result.Failed = true
 			return result, fmt.Errorf("failed to create backup: %w", err)
@@ -164,7 +173,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 			ctx.GetLogger().Debugf("  Retry attempt %d/%d", attempt, maxRetries)
 		}
 
-		downloadedSize, downloadErr = h.downloadFile(renderedURL, renderedDest, downloadAction, mode, step, ec, ctx)
+		downloadedSize, downloadErr = h.downloadFile(renderedURL, hostDest, downloadAction, mode, step, ec, ctx)
 		if downloadErr == nil {
 			break // Success
 		}
@@ -191,7 +200,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	// Verify checksum if provided
 	if downloadAction.Checksum != "" {
 		ctx.GetLogger().Debugf("  Verifying checksum: %s", downloadAction.Checksum)
-		matches, err := utils.VerifyChecksum(renderedDest, downloadAction.Checksum)
+		matches, err := utils.VerifyChecksum(hostDest, downloadAction.Checksum)
 		if err != nil {
 			result.Failed = true
 			return result, fmt.Errorf("failed to verify checksum: %w", err)
@@ -242,14 +251,19 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 		renderedDest = downloadAction.Dest
 	}
 
+	hostDest, err := transport.HostPath(ec.GetTransport(), renderedDest)
+	if err != nil {
+		return err
+	}
+
 	// Check if destination exists
-	_, err = os.Stat(renderedDest)
+	_, err = os.Stat(hostDest)
 	destExists := err == nil
 
 	// Determine if download is needed
 	needsDownload := !destExists || downloadAction.Force
 	if destExists && !downloadAction.Force && downloadAction.Checksum != "" {
-		matches, checksumErr := utils.VerifyChecksum(renderedDest, downloadAction.Checksum)
+		matches, checksumErr := utils.VerifyChecksum(hostDest, downloadAction.Checksum)
 		if checksumErr == nil && matches {
 			needsDownload = false
 		}
@@ -315,17 +329,12 @@ func (h *Handler) downloadFile(url, dest string, action *config.Download, mode o
 			return 0, fmt.Errorf("invalid timeout duration %q: %w", action.Timeout, err)
 		}
 		client.Timeout = timeout
-	} else if step.Timeout != "" {
-		// Fall back to step-level timeout if available
-		timeout, err := time.ParseDuration(step.Timeout)
-		if err == nil {
-			client.Timeout = timeout
-		}
 	}
 
 	// Create HTTP request
 	// #nosec G107 -- URL comes from user-provided YAML configuration
-	req, err := http.NewRequest("GET", url, nil)
+	// The step context carries the step-level timeout
+	req, err := http.NewRequestWithContext(ec.GetContext(), http.MethodGet, url, nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
@@ -352,8 +361,13 @@ func (h *Handler) downloadFile(url, dest string, action *config.Download, mode o
 		return 0, fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
 	}
 
-	// Create temporary file for atomic write
-	tmpFile, err := os.CreateTemp("", "mooncake-download-*")
+	// Create temporary file for atomic write, next to the destination so the move
+	// stays on one file system (such as the one of an alternate root)
+	tmpDir := filepath.Dir(dest)
+	if step.Become {
+		tmpDir = "" // The destination directory may only be writable with sudo
+	}
+	tmpFile, err := os.CreateTemp(tmpDir, ".mooncake-download-*")
 	if err != nil {
 		return 0, fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -392,7 +406,7 @@ func (h *Handler) downloadFile(url, dest string, action *config.Download, mode o
 			return 0, fmt.Errorf("step requires sudo but no password provided")
 		}
 		// Use sudo for final move
-		cmd := fmt.Sprintf("mv %q %q", tmpPath, dest)
+		cmd := fmt.Sprintf("mv %s %s", transport.Quote(tmpPath), transport.Quote(dest))
 		if err := h.executeSudoCommand(cmd, step, ec); err != nil {
 			return 0, fmt.Errorf("failed to move file with sudo: %w", err)
 		}
@@ -407,7 +421,7 @@ func (h *Handler) downloadFile(url, dest string, action *config.Download, mode o
 
 func (h *Handler) executeSudoCommand(command string, _ *config.Step, ec *executor.ExecutionContext) error {
 	// #nosec G204 - This is a provisioning tool designed to execute commands
-	cmd := exec.Command("sudo", "-S", "sh", "-c", command)
+	cmd := ec.LocalCommand("sudo", "-S", "sh", "-c", command)
 	cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 
 	var stderr bytes.Buffer
@@ -13,25 +13,25 @@ import (
 	"bytes"
 	"fmt"
 	"os"
-	"os/exec"
-	"os/user"
 	"runtime"
 	"strconv"
 	"time"
 
 	"github.com/alehatsman/mooncake/internal/actions"
 	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/diff"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/transport"
 )
 
 const (
 	defaultFileMode os.FileMode = 0644
 	defaultDirMode  os.FileMode = 0755
-	actionTypeFile                = "file"
-	stateLink                     = "link"
-	stateHardlink                 = "hardlink"
+	actionTypeFile              = "file"
+	stateLink                   = "link"
+	stateHardlink               = "hardlink"
 )
 
 // Handler implements the Handler interface for file actions.
@@ -45,10 +45,11 @@ func init() {
 // Metadata returns metadata about the file action.
 func (Handler) Metadata() actions.ActionMetadata {
 	return actions.ActionMetadata{
-		Name:        "file",
-		Description: "Manage files, directories, links, and permissions",
-		Category:    actions.CategoryFile,
+		Name:           "file",
+		Description:    "Manage files, directories, links, and permissions",
+		Category:       actions.CategoryFile,
 		SupportsDryRun: true,
+		SupportsRemote: true,
 		SupportsBecome: true,
 		EmitsEvents: []string{
 			string(events.EventFileCreated),
@@ -137,6 +138,16 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 		state = actionTypeFile
 	}
 
+	// Record the previous state of the path so the change can be undone
+	if state == "absent" || (state == "perms" && file.Recurse) {
+		ec.JournalTree(renderedPath, step.Become)
+	} else {
+		ec.JournalPath(renderedPath, step.Become)
+	}
+	if state == actionTypeFile && file.Backup {
+		ec.JournalPath(renderedPath+".bak", false)
+	}
+
 	// Dispatch based on state
 	switch state {
 	case "directory":
@@ -211,8 +222,158 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	return nil
 }
 
+// Check predicts whether Execute would change anything, with a diff of file content.
+func (h *Handler) Check(ctx actions.Context, step *config.Step) (actions.CheckResult, error) {
+	file := step.File
+
+	ec, ok := ctx.(*executor.ExecutionContext)
+	if !ok {
+		return actions.CheckResult{}, fmt.Errorf("context is not an ExecutionContext")
+	}
+
+	renderedPath, err := ec.PathUtil.ExpandPath(file.Path, ec.CurrentDir, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to expand path: %w", err)
+	}
+
+	state := file.State
+	if state == "" {
+		state = actionTypeFile
+	}
+
+	switch state {
+	case "directory":
+		info, err := ec.GetTransport().Stat(renderedPath)
+		if os.IsNotExist(err) {
+			return actions.CheckResult{Changed: true, Drift: []actions.Drift{
+				{Kind: actions.DriftFile, Resource: renderedPath, Detail: "missing"},
+			}}, nil
+		}
+		if err == nil && !info.IsDir() {
+			return actions.CheckResult{Drift: []actions.Drift{
+				{Kind: actions.DriftFile, Resource: renderedPath, Detail: "not a directory"},
+			}}, nil
+		}
+		return actions.CheckResult{}, nil
+
+	case "absent":
+		info, err := ec.GetTransport().Lstat(renderedPath)
+		if os.IsNotExist(err) {
+			return actions.CheckResult{}, nil
+		}
+		if err != nil {
+			return actions.CheckResult{}, fmt.Errorf("failed to stat path: %w", err)
+		}
+		drift := []actions.Drift{{Kind: actions.DriftFile, Resource: renderedPath, Detail: "present, want absent"}}
+		if !info.Mode().IsRegular() {
+			return actions.CheckResult{Changed: true, Drift: drift}, nil
+		}
+		existingContent, err := ec.GetTransport().ReadFile(renderedPath)
+		if err != nil {
+			return actions.CheckResult{}, fmt.Errorf("failed to read file: %w", err)
+		}
+		return actions.CheckResult{Changed: true, Diff: diff.File(renderedPath, existingContent, nil), Drift: drift}, nil
+
+	case "touch":
+		// Touching updates the timestamps of an existing file too
+		check := actions.CheckResult{Changed: true}
+		if _, err := ec.GetTransport().Stat(renderedPath); os.IsNotExist(err) {
+			check.Drift = []actions.Drift{{Kind: actions.DriftFile, Resource: renderedPath, Detail: "missing"}}
+		}
+		return check, nil
+
+	case stateLink, stateHardlink:
+		expandedSrc, err := h.expandSrc(ctx, ec, file)
+		if err != nil {
+			return actions.CheckResult{}, err
+		}
+		detail := ""
+		if state == stateLink {
+			linkTarget, err := ec.GetTransport().Readlink(renderedPath)
+			switch {
+			case os.IsNotExist(err):
+				detail = "missing"
+			case err != nil:
+				detail = "not a symlink"
+			case linkTarget != expandedSrc:
+				detail = fmt.Sprintf("links to %s, want %s", linkTarget, expandedSrc)
+			}
+		} else {
+			srcInfo, err1 := ec.GetTransport().Stat(expandedSrc)
+			dstInfo, err2 := ec.GetTransport().Stat(renderedPath)
+			switch {
+			case os.IsNotExist(err2):
+				detail = "missing"
+			case err1 != nil || err2 != nil || !transport.SameFile(srcInfo, dstInfo):
+				detail = fmt.Sprintf("not a hard link to %s", expandedSrc)
+			}
+		}
+		if detail == "" {
+			return actions.CheckResult{}, nil
+		}
+		return actions.CheckResult{Changed: true, Drift: []actions.Drift{
+			{Kind: actions.DriftFile, Resource: renderedPath, Detail: detail},
+		}}, nil
+
+	case "perms":
+		fileInfo, err := ec.GetTransport().Stat(renderedPath)
+		if err != nil {
+			return actions.CheckResult{}, fmt.Errorf("failed to stat file: %w", err)
+		}
+		mode := h.parseFileMode(file.Mode, defaultFileMode)
+		currentMode := fileInfo.Mode() & os.ModePerm
+		if currentMode == mode {
+			return actions.CheckResult{}, nil
+		}
+		return actions.CheckResult{Changed: true, Drift: []actions.Drift{{
+			Kind:     actions.DriftPermission,
+			Resource: renderedPath,
+			Detail:   fmt.Sprintf("mode %s, want %s", h.formatMode(currentMode), h.formatMode(mode)),
+		}}}, nil
+
+	case actionTypeFile:
+		renderedContent, err := ctx.GetTemplate().Render(file.Content, ctx.GetVariables())
+		if err != nil {
+			return actions.CheckResult{}, fmt.Errorf("failed to render content: %w", err)
+		}
+		content := []byte(renderedContent)
+
+		existingContent, err := ec.GetTransport().ReadFile(renderedPath)
+		if os.IsNotExist(err) {
+			return actions.CheckResult{
+				Changed: true,
+				Diff:    diff.File(renderedPath, nil, content),
+				Drift:   actions.ContentDrift(renderedPath, nil, content),
+			}, nil
+		}
+		if err != nil {
+			return actions.CheckResult{}, fmt.Errorf("failed to read file: %w", err)
+		}
+		return actions.CheckResult{
+			Changed: !bytes.Equal(existingContent, content),
+			Diff:    diff.File(renderedPath, existingContent, content),
+			Drift:   actions.ContentDrift(renderedPath, existingContent, content),
+		}, nil
+	}
+
+	return actions.CheckResult{}, fmt.Errorf("unknown file state: %s", state)
+}
+
 // Helper functions
 
+// expandSrc renders and expands the src path of a link.
+func (h *Handler) expandSrc(ctx actions.Context, ec *executor.ExecutionContext, file *config.File) (string, error) {
+	renderedSrc, err := ctx.GetTemplate().Render(file.Src, ctx.GetVariables())
+	if err != nil {
+		return "", fmt.Errorf("failed to render src: %w", err)
+	}
+	expandedSrc, err := ec.PathUtil.ExpandPath(renderedSrc, ec.CurrentDir, ctx.GetVariables())
+	if err != nil {
+		return "", fmt.Errorf("failed to expand src path: %w", err)
+	}
+	return expandedSrc, nil
+}
+
 func (h *Handler) formatMode(mode os.FileMode) string {
 	return fmt.Sprintf("%#o", mode)
 }
@@ -236,7 +397,7 @@ func (h *Handler) createDirectory(ctx actions.Context, ec *executor.ExecutionCon
 	mode := h.parseFileMode(file.Mode, defaultDirMode)
 
 	// Check if directory already exists
-	if _, err := os.Stat(renderedPath); os.IsNotExist(err) {
+	if _, err := ec.GetTransport().Stat(renderedPath); os.IsNotExist(err) {
 		result.Changed = true
 	}
 
@@ -283,8 +444,7 @@ func (h *Handler) createOrUpdateFile(ctx actions.Context, ec *executor.Execution
 	content := []byte(renderedContent)
 
 	// Check if file exists and content has changed
-	// #nosec G304 -- File path from user config is intentional
-	existingContent, err := os.ReadFile(renderedPath)
+	existingContent, err := ec.GetTransport().ReadFile(renderedPath)
 	fileExists := (err == nil)
 	contentChanged := !fileExists || !bytes.Equal(existingContent, content)
 
@@ -295,7 +455,7 @@ func (h *Handler) createOrUpdateFile(ctx actions.Context, ec *executor.Execution
 	// Create backup if requested and file exists
 	if file.Backup && fileExists {
 		backupPath := renderedPath + ".bak"
-		if err := os.WriteFile(backupPath, existingContent, 0600); err != nil {
+		if err := ec.GetTransport().WriteFile(backupPath, existingContent, 0600); err != nil {
 			ctx.GetLogger().Debugf("  Warning: failed to create backup: %v", err)
 		} else {
 			ctx.GetLogger().Debugf("  Created backup: %s", backupPath)
@@ -341,7 +501,7 @@ func (h *Handler) createOrUpdateFile(ctx actions.Context, ec *executor.Execution
 
 func (h *Handler) removeFileOrDirectory(ctx actions.Context, ec *executor.ExecutionContext, file *config.File, renderedPath string, result *executor.Result, step *config.Step) error {
 	// Check if path exists
-	fileInfo, err := os.Stat(renderedPath)
+	fileInfo, err := ec.GetTransport().Stat(renderedPath)
 	if os.IsNotExist(err) {
 		// Already absent
 		result.Changed = false
@@ -384,7 +544,7 @@ func (h *Handler) touchFile(ctx actions.Context, ec *executor.ExecutionContext,
 	mode := h.parseFileMode(file.Mode, defaultFileMode)
 
 	// Check if file exists
-	_, err := os.Stat(renderedPath)
+	_, err := ec.GetTransport().Stat(renderedPath)
 	fileExists := (err == nil)
 
 	if !fileExists {
@@ -402,12 +562,12 @@ func (h *Handler) touchFile(ctx actions.Context, ec *executor.ExecutionContext,
 		ctx.GetLogger().Debugf("  Touching file: %s", renderedPath)
 		if step.Become {
 			// Use touch command with sudo
-			if err := h.executeSudoCommand(fmt.Sprintf("touch %s", renderedPath), step, ec); err != nil {
+			if err := h.executeSudoCommand("touch "+transport.Quote(renderedPath), step, ec); err != nil {
 				result.Failed = true
 				return fmt.Errorf("failed to touch file: %w", err)
 			}
 		} else {
-			if err := os.Chtimes(renderedPath, now, now); err != nil {
+			if err := ec.GetTransport().Chtimes(renderedPath, now, now); err != nil {
 				result.Failed = true
 				return fmt.Errorf("failed to touch file: %w", err)
 			}
@@ -439,7 +599,7 @@ func (h *Handler) createSymlink(ctx actions.Context, ec *executor.ExecutionConte
 	}
 
 	// Check if link already exists with correct target
-	if linkTarget, err := os.Readlink(renderedPath); err == nil {
+	if linkTarget, err := ec.GetTransport().Readlink(renderedPath); err == nil {
 		if linkTarget == expandedSrc {
 			// Already correct
 			result.Changed = false
@@ -447,7 +607,7 @@ func (h *Handler) createSymlink(ctx actions.Context, ec *executor.ExecutionConte
 		}
 		// Wrong target, remove it
 		if file.Force {
-			if err := os.Remove(renderedPath); err != nil {
+			if err := ec.GetTransport().Remove(renderedPath); err != nil {
 				return fmt.Errorf("failed to remove existing link: %w", err)
 			}
 		} else {
@@ -459,13 +619,13 @@ func (h *Handler) createSymlink(ctx actions.Context, ec *executor.ExecutionConte
 	ctx.GetLogger().Debugf("  Creating symlink: %s -> %s", renderedPath, expandedSrc)
 
 	if step.Become {
-		cmd := fmt.Sprintf("ln -s %s %s", expandedSrc, renderedPath)
+		cmd := fmt.Sprintf("ln -s %s %s", transport.Quote(expandedSrc), transport.Quote(renderedPath))
 		if err := h.executeSudoCommand(cmd, step, ec); err != nil {
 			result.Failed = true
 			return fmt.Errorf("failed to create symlink: %w", err)
 		}
 	} else {
-		if err := os.Symlink(expandedSrc, renderedPath); err != nil {
+		if err := ec.GetTransport().Symlink(expandedSrc, renderedPath); err != nil {
 			result.Failed = true
 			return fmt.Errorf("failed to create symlink: %w", err)
 		}
@@ -502,18 +662,18 @@ func (h *Handler) createHardlink(ctx actions.Context, ec *executor.ExecutionCont
 	}
 
 	// Check if hardlink already exists
-	if _, err := os.Stat(renderedPath); err == nil {
+	if _, err := ec.GetTransport().Stat(renderedPath); err == nil {
 		// File exists - check if it's the same inode
-		srcInfo, err1 := os.Stat(expandedSrc)
-		dstInfo, err2 := os.Stat(renderedPath)
-		if err1 == nil && err2 == nil && os.SameFile(srcInfo, dstInfo) {
+		srcInfo, err1 := ec.GetTransport().Stat(expandedSrc)
+		dstInfo, err2 := ec.GetTransport().Stat(renderedPath)
+		if err1 == nil && err2 == nil && transport.SameFile(srcInfo, dstInfo) {
 			// Already hard linked
 			result.Changed = false
 			return nil
 		}
 		// Different file, remove if force
 		if file.Force {
-			if err := os.Remove(renderedPath); err != nil {
+			if err := ec.GetTransport().Remove(renderedPath); err != nil {
 				return fmt.Errorf("failed to remove existing file: %w", err)
 			}
 		} else {
@@ -525,13 +685,13 @@ func (h *Handler) createHardlink(ctx actions.Context, ec *executor.ExecutionCont
 	ctx.GetLogger().Debugf("  Creating hardlink: %s -> %s", renderedPath, expandedSrc)
 
 	if step.Become {
-		cmd := fmt.Sprintf("ln %s %s", expandedSrc, renderedPath)
+		cmd := fmt.Sprintf("ln %s %s", transport.Quote(expandedSrc), transport.Quote(renderedPath))
 		if err := h.executeSudoCommand(cmd, step, ec); err != nil {
 			result.Failed = true
 			return fmt.Errorf("failed to create hardlink: %w", err)
 		}
 	} else {
-		if err := os.Link(expandedSrc, renderedPath); err != nil {
+		if err := ec.GetTransport().Link(expandedSrc, renderedPath); err != nil {
 			result.Failed = true
 			return fmt.Errorf("failed to create hardlink: %w", err)
 		}
@@ -558,7 +718,7 @@ func (h *Handler) setPermissions(ctx actions.Context, ec *executor.ExecutionCont
 	mode := h.parseFileMode(file.Mode, defaultFileMode)
 
 	// Get current permissions
-	fileInfo, err := os.Stat(renderedPath)
+	fileInfo, err := ec.GetTransport().Stat(renderedPath)
 	if err != nil {
 		return fmt.Errorf("failed to stat file: %w", err)
 	}
@@ -571,9 +731,9 @@ func (h *Handler) setPermissions(ctx actions.Context, ec *executor.ExecutionCont
 	ctx.GetLogger().Debugf("  Setting permissions: %s (mode: %s)", renderedPath, h.formatMode(mode))
 
 	if step.Become {
-		cmd := fmt.Sprintf("chmod %s %s", file.Mode, renderedPath)
+		cmd := fmt.Sprintf("chmod %s %s", transport.Quote(file.Mode), transport.Quote(renderedPath))
 		if file.Recurse {
-			cmd = fmt.Sprintf("chmod -R %s %s", file.Mode, renderedPath)
+			cmd = fmt.Sprintf("chmod -R %s %s", transport.Quote(file.Mode), transport.Quote(renderedPath))
 		}
 		if err := h.executeSudoCommand(cmd, step, ec); err != nil {
 			result.Failed = true
@@ -584,7 +744,7 @@ func (h *Handler) setPermissions(ctx actions.Context, ec *executor.ExecutionCont
 			// Recursive not implemented without become for now
 			return fmt.Errorf("recursive permission changes require become: true")
 		}
-		if err := os.Chmod(renderedPath, mode); err != nil {
+		if err := ec.GetTransport().Chmod(renderedPath, mode); err != nil {
 			result.Failed = true
 			return fmt.Errorf("failed to set permissions: %w", err)
 		}
@@ -621,8 +781,7 @@ func (h *Handler) setPermissions(ctx actions.Context, ec *executor.ExecutionCont
 
 func (h *Handler) createFileWithBecome(path string, content []byte, mode os.FileMode, step *config.Step, ec *executor.ExecutionContext) error {
 	if !step.Become {
-		// #nosec G306 -- Mode is user-configurable for provisioning
-		return os.WriteFile(path, content, mode)
+		return ec.GetTransport().WriteFile(path, content, mode)
 	}
 
 	if !security.IsBecomeSupported() {
@@ -633,18 +792,17 @@ func (h *Handler) createFileWithBecome(path string, content []byte, mode os.File
 		return fmt.Errorf("step requires sudo but no password provided")
 	}
 
-	// Create temp file
-	tmpFile, err := os.CreateTemp("", "mooncake-*")
+	// Create temp file on the target host
+	tmpPath, err := ec.GetTransport().TempFile()
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
-	tmpPath := tmpFile.Name()
 	defer func() {
-		_ = os.Remove(tmpPath)
+		_ = ec.GetTransport().Remove(tmpPath)
 	}()
 
 	// Write content to temp file
-	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+	if err := ec.GetTransport().WriteFile(tmpPath, content, 0600); err != nil {
 		return fmt.Errorf("failed to write temp file: %w", err)
 	}
 
@@ -654,7 +812,7 @@ func (h *Handler) createFileWithBecome(path string, content []byte, mode os.File
 
 func (h *Handler) createDirectoryWithBecome(path string, mode os.FileMode, step *config.Step, ec *executor.ExecutionContext) error {
 	if !step.Become {
-		return os.MkdirAll(path, mode)
+		return ec.GetTransport().MkdirAll(path, mode)
 	}
 
 	if !security.IsBecomeSupported() {
@@ -665,16 +823,16 @@ func (h *Handler) createDirectoryWithBecome(path string, mode os.FileMode, step
 		return fmt.Errorf("step requires sudo but no password provided")
 	}
 
-	cmd := fmt.Sprintf("mkdir -p -m %s %s", h.formatMode(mode), path)
+	cmd := fmt.Sprintf("mkdir -p -m %s %s", h.formatMode(mode), transport.Quote(path))
 	return h.executeSudoCommand(cmd, step, ec)
 }
 
 func (h *Handler) removeWithBecome(path string, isDir bool, _ bool, step *config.Step, ec *executor.ExecutionContext) error {
 	if !step.Become {
 		if isDir {
-			return os.RemoveAll(path)
+			return ec.GetTransport().RemoveAll(path)
 		}
-		return os.Remove(path)
+		return ec.GetTransport().Remove(path)
 	}
 
 	if !security.IsBecomeSupported() {
@@ -685,9 +843,9 @@ func (h *Handler) removeWithBecome(path string, isDir bool, _ bool, step *config
 		return fmt.Errorf("step requires sudo but no password provided")
 	}
 
-	cmd := fmt.Sprintf("rm -f %s", path)
+	cmd := "rm -f " + transport.Quote(path)
 	if isDir {
-		cmd = fmt.Sprintf("rm -rf %s", path)
+		cmd = "rm -rf " + transport.Quote(path)
 	}
 	return h.executeSudoCommand(cmd, step, ec)
 }
@@ -701,26 +859,7 @@ func (h *Handler) setOwnership(path, owner, group string, recurse bool, step *co
 		return h.chownWithBecome(path, owner, group, recurse, step, ec)
 	}
 
-	// Parse owner and group
-	uid := -1
-	gid := -1
-	var err error
-
-	if owner != "" {
-		uid, err = h.parseUserID(owner)
-		if err != nil {
-			return fmt.Errorf("failed to parse owner: %w", err)
-		}
-	}
-
-	if group != "" {
-		gid, err = h.parseGroupID(group)
-		if err != nil {
-			return fmt.Errorf("failed to parse group: %w", err)
-		}
-	}
-
-	return os.Chown(path, uid, gid)
+	return ec.GetTransport().Chown(path, owner, group)
 }
 
 func (h *Handler) chownWithBecome(path, owner, group string, recurse bool, step *config.Step, ec *executor.ExecutionContext) error {
@@ -745,63 +884,23 @@ func (h *Handler) chownWithBecome(path, owner, group string, recurse bool, step
 		ownerGroup = ":" + group
 	}
 
-	cmd := fmt.Sprintf("chown %s %s", ownerGroup, path)
+	cmd := fmt.Sprintf("chown %s %s", transport.Quote(ownerGroup), transport.Quote(path))
 	if recurse {
-		cmd = fmt.Sprintf("chown -R %s %s", ownerGroup, path)
+		cmd = fmt.Sprintf("chown -R %s %s", transport.Quote(ownerGroup), transport.Quote(path))
 	}
 
 	return h.executeSudoCommand(cmd, step, ec)
 }
 
-func (h *Handler) parseUserID(owner string) (int, error) {
-	// Try as UID first
-	if uid, err := strconv.Atoi(owner); err == nil {
-		return uid, nil
-	}
-
-	// Lookup username
-	u, err := user.Lookup(owner)
-	if err != nil {
-		return -1, fmt.Errorf("user not found: %s", owner)
-	}
-
-	uid, err := strconv.Atoi(u.Uid)
-	if err != nil {
-		return -1, fmt.Errorf("invalid UID: %s", u.Uid)
-	}
-
-	return uid, nil
-}
-
-func (h *Handler) parseGroupID(group string) (int, error) {
-	// Try as GID first
-	if gid, err := strconv.Atoi(group); err == nil {
-		return gid, nil
-	}
-
-	// Lookup group name
-	g, err := user.LookupGroup(group)
-	if err != nil {
-		return -1, fmt.Errorf("group not found: %s", group)
-	}
-
-	gid, err := strconv.Atoi(g.Gid)
-	if err != nil {
-		return -1, fmt.Errorf("invalid GID: %s", g.Gid)
-	}
-
-	return gid, nil
-}
-
 func (h *Handler) executeSudoFileOperation(tmpPath, destPath string, mode os.FileMode, step *config.Step, ec *executor.ExecutionContext) error {
 	// Move file and set permissions with sudo
-	cmd := fmt.Sprintf("mv %s %s && chmod %s %s", tmpPath, destPath, h.formatMode(mode), destPath)
+	cmd := fmt.Sprintf("mv %s %s && chmod %s %s", transport.Quote(tmpPath), transport.Quote(destPath), h.formatMode(mode), transport.Quote(destPath))
 	return h.executeSudoCommand(cmd, step, ec)
 }
 
 func (h *Handler) executeSudoCommand(command string, _ *config.Step, ec *executor.ExecutionContext) error {
 	// #nosec G204 - This is a provisioning tool designed to execute commands
-	cmd := exec.Command("sudo", "-S", "sh", "-c", command)
+	cmd := ec.Command("sudo", "-S", "sh", "-c", command)
 	cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 
 	var stderr bytes.Buffer
@@ -5,7 +5,6 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -1441,57 +1440,6 @@ func TestHandler_formatMode(t *testing.T) {
 	}
 }
 
-func TestHandler_parseUserID(t *testing.T) {
-	h := &Handler{}
-
-	// Test with numeric UID
-	uid, err := h.parseUserID("1000")
-	if err != nil {
-		t.Errorf("parseUserID() with numeric UID error = %v", err)
-	}
-	if uid != 1000 {
-		t.Errorf("parseUserID() = %d, want 1000", uid)
-	}
-
-	// Test with current user
-	currentUser, err := user.Current()
-	if err == nil {
-		uid, err := h.parseUserID(currentUser.Username)
-		if err != nil {
-			t.Errorf("parseUserID() with username error = %v", err)
-		}
-		expectedUID, _ := strconv.Atoi(currentUser.Uid)
-		if uid != expectedUID {
-			t.Errorf("parseUserID() = %d, want %d", uid, expectedUID)
-		}
-	}
-
-	// Test with invalid user
-	_, err = h.parseUserID("nonexistentuser12345")
-	if err == nil {
-		t.Error("parseUserID() should error with nonexistent user")
-	}
-}
-
-func TestHandler_parseGroupID(t *testing.T) {
-	h := &Handler{}
-
-	// Test with numeric GID
-	gid, err := h.parseGroupID("1000")
-	if err != nil {
-		t.Errorf("parseGroupID() with numeric GID error = %v", err)
-	}
-	if gid != 1000 {
-		t.Errorf("parseGroupID() = %d, want 1000", gid)
-	}
-
-	// Test with invalid group
-	_, err = h.parseGroupID("nonexistentgroup12345")
-	if err == nil {
-		t.Error("parseGroupID() should error with nonexistent group")
-	}
-}
-
 func TestHandler_Execute_DirectoryWithMode(t *testing.T) {
 	h := &Handler{}
 
@@ -2062,32 +2010,6 @@ func TestHandler_ChownWithBecome(t *testing.T) {
 	t.Logf("chownWithBecome error (expected): %v", err)
 }
 
-func TestHandler_ParseUserID_WithUsername(t *testing.T) {
-	h := &Handler{}
-
-	// Test with root user (should exist on all Unix systems)
-	if runtime.GOOS != "windows" {
-		uid, err := h.parseUserID("root")
-		if err != nil {
-			t.Errorf("parseUserID('root') error = %v", err)
-		} else if uid != 0 {
-			t.Errorf("parseUserID('root') = %d, want 0", uid)
-		}
-	}
-}
-
-func TestHandler_ParseGroupID_WithGroupName(t *testing.T) {
-	h := &Handler{}
-
-	// Test with numeric GID
-	gid, err := h.parseGroupID("0")
-	if err != nil {
-		t.Errorf("parseGroupID('0') error = %v", err)
-	} else if gid != 0 {
-		t.Errorf("parseGroupID('0') = %d, want 0", gid)
-	}
-}
-
 func TestHandler_TouchFile_WithOwnership(t *testing.T) {
 	h := &Handler{}
 	tmpDir := t.TempDir()
@@ -2258,3 +2180,198 @@ func TestHandler_Execute_PermsWithOwnership(t *testing.T) {
 		t.Logf("perms with ownership error (may be expected): %v", err)
 	}
 }
+
+// TestHandler_Check verifies that Check predicts the Changed flag of Execute.
+func TestHandler_Check(t *testing.T) {
+	h := &Handler{}
+	var _ actions.Checker = h
+
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, dir string)
+		file      func(dir string) *config.File
+		want      bool
+		wantDiff  string
+		wantDrift string
+	}{
+		{
+			name:      "create file",
+			file:      func(dir string) *config.File { return &config.File{Path: filepath.Join(dir, "f"), Content: "a\n"} },
+			want:      true,
+			wantDiff:  "--- /dev/null\n",
+			wantDrift: "missing",
+		},
+		{
+			name:      "update file",
+			setup:     writeTestFile("f", "a\n"),
+			file:      func(dir string) *config.File { return &config.File{Path: filepath.Join(dir, "f"), Content: "b\n"} },
+			want:      true,
+			wantDiff:  "-a\n+b\n",
+			wantDrift: "content differs",
+		},
+		{
+			name:  "file unchanged",
+			setup: writeTestFile("f", "a\n"),
+			file:  func(dir string) *config.File { return &config.File{Path: filepath.Join(dir, "f"), Content: "a\n"} },
+		},
+		{
+			name:      "remove file",
+			setup:     writeTestFile("f", "a\n"),
+			file:      func(dir string) *config.File { return &config.File{Path: filepath.Join(dir, "f"), State: "absent"} },
+			want:      true,
+			wantDiff:  "+++ /dev/null\n",
+			wantDrift: "present, want absent",
+		},
+		{
+			name: "already absent",
+			file: func(dir string) *config.File { return &config.File{Path: filepath.Join(dir, "f"), State: "absent"} },
+		},
+		{
+			name:      "create directory",
+			file:      func(dir string) *config.File { return &config.File{Path: filepath.Join(dir, "d"), State: "directory"} },
+			want:      true,
+			wantDrift: "missing",
+		},
+		{
+			name: "directory exists",
+			file: func(dir string) *config.File { return &config.File{Path: dir, State: "directory"} },
+		},
+		{
+			name:  "permissions unchanged",
+			setup: writeTestFile("f", "a\n"),
+			file: func(dir string) *config.File {
+				return &config.File{Path: filepath.Join(dir, "f"), State: "perms", Mode: "0644"}
+			},
+		},
+		{
+			name:  "permissions changed",
+			setup: writeTestFile("f", "a\n"),
+			file: func(dir string) *config.File {
+				return &config.File{Path: filepath.Join(dir, "f"), State: "perms", Mode: "0600"}
+			},
+			want:      true,
+			wantDrift: "mode 0644, want 0600",
+		},
+		{
+			name:  "create symlink",
+			setup: writeTestFile("f", "a\n"),
+			file: func(dir string) *config.File {
+				return &config.File{Path: filepath.Join(dir, "l"), State: stateLink, Src: filepath.Join(dir, "f")}
+			},
+			want:      true,
+			wantDrift: "missing",
+		},
+		{
+			name: "symlink exists",
+			setup: func(t *testing.T, dir string) {
+				writeTestFile("f", "a\n")(t, dir)
+				if err := os.Symlink(filepath.Join(dir, "f"), filepath.Join(dir, "l")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			file: func(dir string) *config.File {
+				return &config.File{Path: filepath.Join(dir, "l"), State: stateLink, Src: filepath.Join(dir, "f")}
+			},
+		},
+		{
+			name: "symlink to another target",
+			setup: func(t *testing.T, dir string) {
+				writeTestFile("f", "a\n")(t, dir)
+				if err := os.Symlink(filepath.Join(dir, "other"), filepath.Join(dir, "l")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			file: func(dir string) *config.File {
+				return &config.File{Path: filepath.Join(dir, "l"), State: stateLink, Src: filepath.Join(dir, "f"), Force: true}
+			},
+			want:      true,
+			wantDrift: "other, want ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+			step := &config.Step{File: tt.file(dir)}
+
+			check, err := h.Check(mockExecutionContext(), step)
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if check.Changed != tt.want {
+				t.Errorf("Check().Changed = %v, want %v", check.Changed, tt.want)
+			}
+			if !strings.Contains(check.Diff, tt.wantDiff) || (tt.wantDiff == "") != (check.Diff == "") {
+				t.Errorf("Check().Diff = %q, want it to contain %q", check.Diff, tt.wantDiff)
+			}
+			var drift string
+			for _, d := range check.Drift {
+				drift += d.Detail
+			}
+			if !strings.Contains(drift, tt.wantDrift) || (tt.wantDrift == "") != (drift == "") {
+				t.Errorf("Check().Drift = %+v, want detail %q", check.Drift, tt.wantDrift)
+			}
+
+			result, err := h.Execute(mockExecutionContext(), step)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if changed := result.(*executor.Result).Changed; changed != check.Changed {
+				t.Errorf("Execute().Changed = %v, Check predicted %v", changed, check.Changed)
+			}
+		})
+	}
+}
+
+// writeTestFile returns a setup function writing a file to the test directory.
+func writeTestFile(name, content string) func(t *testing.T, dir string) {
+	return func(t *testing.T, dir string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHandler_Execute_BecomeQuotesPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sudo not available on Windows")
+	}
+	// A sudo that reads the password and runs the command as is
+	binDir := t.TempDir()
+	fakeSudo := "#!/bin/sh\nread -r _\nshift\nexec \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "sudo"), []byte(fakeSudo), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+	filePath := filepath.Join(tmpDir, "a b $(touch pwned)")
+
+	h := &Handler{}
+	ec := mockExecutionContext()
+	ec.SudoPass = "secret"
+	step := &config.Step{
+		Become: true,
+		File: &config.File{
+			Path:    filePath,
+			State:   "file",
+			Content: "hello",
+			Mode:    "0640",
+		},
+	}
+	if _, err := h.Execute(ec, step); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if content, err := os.ReadFile(filePath); err != nil || string(content) != "hello" {
+		t.Errorf("file content = %q, %v, want %q", content, err, "hello")
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "pwned")); err == nil {
+		t.Error("a command in the path was run by the shell")
+	}
+}
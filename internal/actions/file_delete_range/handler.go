@@ -19,6 +19,7 @@ import (
 
 	"github.com/alehatsman/mooncake/internal/actions"
 	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/diff"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/pathutil"
@@ -115,6 +116,10 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	if err != nil {
 		return result, fmt.Errorf("failed to expand path: %w", err)
 	}
+	ec.JournalPath(renderedPath, step.Become)
+	if fdr.Backup {
+		ec.JournalPath(renderedPath+".bak", false)
+	}
 
 	// Validate path safety
 	if pathErr := pathutil.ValidateNoPathTraversal(renderedPath); pathErr != nil {
@@ -250,6 +255,54 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	return nil
 }
 
+// Check performs the deletion in memory and diffs the result against the file.
+func (h *Handler) Check(ctx actions.Context, step *config.Step) (actions.CheckResult, error) {
+	fdr := step.FileDeleteRange
+
+	ec, ok := ctx.(*executor.ExecutionContext)
+	if !ok {
+		return actions.CheckResult{}, fmt.Errorf("context is not an ExecutionContext")
+	}
+
+	renderedPath, err := ec.PathUtil.ExpandPath(fdr.Path, ec.CurrentDir, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to expand path: %w", err)
+	}
+
+	// #nosec G304 -- File path from user config is intentional for configuration management
+	originalContent, err := os.ReadFile(renderedPath)
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to read file %s: %w", renderedPath, err)
+	}
+
+	renderedStartAnchor, err := ctx.GetTemplate().Render(fdr.StartAnchor, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to render start_anchor: %w", err)
+	}
+
+	renderedEndAnchor, err := ctx.GetTemplate().Render(fdr.EndAnchor, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to render end_anchor: %w", err)
+	}
+
+	newContent, _, err := h.performDeletion(
+		string(originalContent),
+		renderedStartAnchor,
+		renderedEndAnchor,
+		fdr.Regex,
+		fdr.Inclusive,
+	)
+	if err != nil {
+		return actions.CheckResult{}, err
+	}
+
+	return actions.CheckResult{
+		Changed: string(originalContent) != newContent,
+		Diff:    diff.File(renderedPath, originalContent, []byte(newContent)),
+		Drift:   actions.ContentDrift(renderedPath, originalContent, []byte(newContent)),
+	}, nil
+}
+
 // performDeletion performs the actual range deletion
 func (h *Handler) performDeletion(content, startAnchor, endAnchor string, useRegex, inclusive bool) (newContent string, deletedLines int, err error) {
 	lines := strings.Split(content, "\n")
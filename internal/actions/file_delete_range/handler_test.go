@@ -3,6 +3,7 @@ package file_delete_range
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/alehatsman/mooncake/internal/actions"
@@ -192,6 +193,47 @@ func TestHandler_Execute_ExclusiveDelete(t *testing.T) {
 	}
 }
 
+func TestHandler_Check(t *testing.T) {
+	handler := &Handler{}
+	ctx := createTestContext(t)
+
+	testFile := filepath.Join(ctx.CurrentDir, "test.txt")
+	originalContent := "line1\n// BEGIN\nold code\n// END\nline5\n"
+	if err := os.WriteFile(testFile, []byte(originalContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	step := &config.Step{
+		FileDeleteRange: &config.FileDeleteRange{
+			Path:        testFile,
+			StartAnchor: "// BEGIN",
+			EndAnchor:   "// END",
+		},
+	}
+
+	check, err := handler.Check(ctx, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !check.Changed || !strings.Contains(check.Diff, " // BEGIN\n-old code\n // END\n") {
+		t.Errorf("Check() = %+v, want old code deleted", check)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != originalContent {
+		t.Errorf("Check() modified the file: %q", content)
+	}
+
+	if _, err := handler.Execute(ctx, step); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	check, err = handler.Check(ctx, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if check.Changed || check.Diff != "" {
+		t.Errorf("Check() after Execute = %+v, want no change", check)
+	}
+}
+
 func TestHandler_Execute_InclusiveDelete(t *testing.T) {
 	handler := &Handler{}
 	ctx := createTestContext(t)
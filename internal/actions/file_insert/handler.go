@@ -20,6 +20,7 @@ import (
 
 	"github.com/alehatsman/mooncake/internal/actions"
 	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/diff"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/pathutil"
@@ -125,6 +126,10 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	if err != nil {
 		return result, fmt.Errorf("failed to expand path: %w", err)
 	}
+	ec.JournalPath(renderedPath, step.Become)
+	if fi.Backup {
+		ec.JournalPath(renderedPath+".bak", false)
+	}
 
 	// Validate path safety
 	if pathErr := pathutil.ValidateNoPathTraversal(renderedPath); pathErr != nil {
@@ -255,6 +260,55 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	return nil
 }
 
+// Check performs the insertion in memory and diffs the result against the file.
+func (h *Handler) Check(ctx actions.Context, step *config.Step) (actions.CheckResult, error) {
+	fi := step.FileInsert
+
+	ec, ok := ctx.(*executor.ExecutionContext)
+	if !ok {
+		return actions.CheckResult{}, fmt.Errorf("context is not an ExecutionContext")
+	}
+
+	renderedPath, err := ec.PathUtil.ExpandPath(fi.Path, ec.CurrentDir, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to expand path: %w", err)
+	}
+
+	// #nosec G304 -- File path from user config is intentional for configuration management
+	originalContent, err := os.ReadFile(renderedPath)
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to read file %s: %w", renderedPath, err)
+	}
+
+	renderedAnchor, err := ctx.GetTemplate().Render(fi.Anchor, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to render anchor: %w", err)
+	}
+
+	renderedContent, err := ctx.GetTemplate().Render(fi.Content, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to render content: %w", err)
+	}
+
+	newContent, _, err := h.performInsertion(
+		string(originalContent),
+		renderedAnchor,
+		renderedContent,
+		fi.Position,
+		fi.Regex,
+		fi.AllowMultiple,
+	)
+	if err != nil {
+		return actions.CheckResult{}, err
+	}
+
+	return actions.CheckResult{
+		Changed: string(originalContent) != newContent,
+		Diff:    diff.File(renderedPath, originalContent, []byte(newContent)),
+		Drift:   actions.ContentDrift(renderedPath, originalContent, []byte(newContent)),
+	}, nil
+}
+
 // performInsertion performs the actual text insertion
 func (h *Handler) performInsertion(content, anchor, insertion, position string, useRegex, allowMultiple bool) (newContent string, count int, err error) {
 	lines := strings.Split(content, "\n")
@@ -3,6 +3,7 @@ package file_insert
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/alehatsman/mooncake/internal/actions"
@@ -208,6 +209,45 @@ func TestHandler_Execute_InsertAfter(t *testing.T) {
 	}
 }
 
+func TestHandler_Check(t *testing.T) {
+	handler := &Handler{}
+	ctx := createTestContext(t)
+
+	testFile := filepath.Join(ctx.CurrentDir, "test.txt")
+	originalContent := "line1\nimport foo\nline3"
+	if err := os.WriteFile(testFile, []byte(originalContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	step := &config.Step{
+		FileInsert: &config.FileInsert{
+			Path:     testFile,
+			Anchor:   "import foo",
+			Position: "after",
+			Content:  "import bar",
+		},
+	}
+
+	check, err := handler.Check(ctx, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !check.Changed || !strings.Contains(check.Diff, " import foo\n+import bar\n") {
+		t.Errorf("Check() = %+v, want import bar inserted", check)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != originalContent {
+		t.Errorf("Check() modified the file: %q", content)
+	}
+
+	result, err := handler.Execute(ctx, step)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if changed := result.(*executor.Result).Changed; changed != check.Changed {
+		t.Errorf("Execute().Changed = %v, Check predicted %v", changed, check.Changed)
+	}
+}
+
 func TestHandler_Execute_InsertBefore(t *testing.T) {
 	handler := &Handler{}
 	ctx := createTestContext(t)
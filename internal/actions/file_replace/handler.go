@@ -20,6 +20,7 @@ import (
 
 	"github.com/alehatsman/mooncake/internal/actions"
 	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/diff"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/pathutil"
@@ -116,6 +117,10 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	if err != nil {
 		return result, fmt.Errorf("failed to expand path: %w", err)
 	}
+	ec.JournalPath(renderedPath, step.Become)
+	if fr.Backup {
+		ec.JournalPath(renderedPath+".bak", false)
+	}
 
 	// Validate path safety (no traversal outside working dir)
 	if pathErr := pathutil.ValidateNoPathTraversal(renderedPath); pathErr != nil {
@@ -254,6 +259,55 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	return nil
 }
 
+// Check performs the replacement in memory and diffs the result against the file.
+func (h *Handler) Check(ctx actions.Context, step *config.Step) (actions.CheckResult, error) {
+	fr := step.FileReplace
+
+	ec, ok := ctx.(*executor.ExecutionContext)
+	if !ok {
+		return actions.CheckResult{}, fmt.Errorf("context is not an ExecutionContext")
+	}
+
+	renderedPath, err := ec.PathUtil.ExpandPath(fr.Path, ec.CurrentDir, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to expand path: %w", err)
+	}
+
+	// #nosec G304 -- File path from user config is intentional for configuration management
+	originalContent, err := os.ReadFile(renderedPath)
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to read file %s: %w", renderedPath, err)
+	}
+
+	renderedPattern, err := ctx.GetTemplate().Render(fr.Pattern, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to render pattern: %w", err)
+	}
+
+	renderedReplace, err := ctx.GetTemplate().Render(fr.Replace, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to render replacement: %w", err)
+	}
+
+	newContent, replacementCount, err := h.performReplace(string(originalContent), renderedPattern, renderedReplace, fr)
+	if err != nil {
+		return actions.CheckResult{}, err
+	}
+
+	if string(originalContent) == newContent {
+		if !fr.AllowNoMatch && replacementCount == 0 {
+			return actions.CheckResult{}, fmt.Errorf("no matches found for pattern: %s", renderedPattern)
+		}
+		return actions.CheckResult{}, nil
+	}
+
+	return actions.CheckResult{
+		Changed: true,
+		Diff:    diff.File(renderedPath, originalContent, []byte(newContent)),
+		Drift:   actions.ContentDrift(renderedPath, originalContent, []byte(newContent)),
+	}, nil
+}
+
 // performReplace performs the actual text replacement
 func (h *Handler) performReplace(content, pattern, replacement string, fr *config.FileReplace) (newContent string, count int, err error) {
 	// Determine replacement count limit (-1 = all)
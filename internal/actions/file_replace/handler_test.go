@@ -3,6 +3,7 @@ package file_replace
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/alehatsman/mooncake/internal/actions"
@@ -198,6 +199,48 @@ func TestHandler_Execute_LiteralReplacement(t *testing.T) {
 	}
 }
 
+func TestHandler_Check(t *testing.T) {
+	handler := &Handler{}
+	ctx := createTestContext(t)
+
+	testFile := filepath.Join(ctx.CurrentDir, "test.txt")
+	originalContent := "port=80\nhost=localhost\n"
+	if err := os.WriteFile(testFile, []byte(originalContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	step := &config.Step{
+		FileReplace: &config.FileReplace{
+			Path:         testFile,
+			Pattern:      "port=80\n",
+			Replace:      "port=8080\n",
+			AllowNoMatch: true,
+		},
+	}
+
+	check, err := handler.Check(ctx, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !check.Changed || !strings.Contains(check.Diff, "-port=80\n+port=8080\n") {
+		t.Errorf("Check() = %+v, want the port replaced", check)
+	}
+	if content, _ := os.ReadFile(testFile); string(content) != originalContent {
+		t.Errorf("Check() modified the file: %q", content)
+	}
+
+	if _, err := handler.Execute(ctx, step); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	check, err = handler.Check(ctx, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if check.Changed || check.Diff != "" {
+		t.Errorf("Check() after Execute = %+v, want no change", check)
+	}
+}
+
 func TestHandler_Execute_RegexReplacement(t *testing.T) {
 	handler := &Handler{}
 	ctx := createTestContext(t)
@@ -33,6 +33,8 @@
 package actions
 
 import (
+	"bytes"
+
 	"github.com/alehatsman/mooncake/internal/config"
 )
 
@@ -76,6 +78,15 @@ type ActionMetadata struct {
 	// SupportsBecome indicates whether this action supports privilege escalation (sudo)
 	SupportsBecome bool
 
+	// SupportsRemote indicates whether this action can run on a remote host, i.e. it
+	// runs its commands and accesses its files through the execution context's transport
+	SupportsRemote bool
+
+	// SupportsRoot indicates whether this action can run in an alternate root
+	// (--root): it goes through the transport, or maps its paths with transport.HostPath.
+	// Actions that support remote hosts also support alternate roots.
+	SupportsRoot bool
+
 	// EmitsEvents lists the event types this action emits (e.g., "file.created", "notify.sent")
 	EmitsEvents []string
 
@@ -141,6 +152,69 @@ type Handler interface {
 	DryRun(ctx Context, step *config.Step) error
 }
 
+// Checker is implemented by handlers that can predict whether a step would change
+// anything, without changing it.
+//
+// Unlike DryRun, which only describes the action, Check compares the current state
+// of the system (file contents, installed packages, service state) with the state
+// the step asks for. The executor calls it in dry-run mode after DryRun, and uses
+// the result for the "to change / unchanged" summary, handler notifications and
+// --diff output. `mooncake drift` reports the drift it finds.
+//
+// Like DryRun, Check must NOT make any changes. Read-only probes (reading files,
+// querying the package manager or service manager) are fine.
+type Checker interface {
+	// Check returns the predicted outcome of executing the step.
+	Check(ctx Context, step *config.Step) (CheckResult, error)
+}
+
+// CheckResult is the predicted outcome of a step.
+type CheckResult struct {
+	// Changed is true if Execute would modify system state.
+	Changed bool
+
+	// Diff is a unified diff of the file contents Execute would write (see the
+	// diff package). Empty if no file contents would change.
+	Diff string
+
+	// Drift lists the resources whose actual state differs from the state the step
+	// asks for. Steps that act every time (a restart, an upgrade) can be Changed
+	// without drift.
+	Drift []Drift
+}
+
+// Kinds of drifted resources.
+const (
+	DriftFile       = "file"
+	DriftPermission = "permission"
+	DriftPackage    = "package"
+	DriftService    = "service"
+)
+
+// Drift describes a resource whose actual state differs from the state a step asks for.
+type Drift struct {
+	// Kind is the kind of resource (DriftFile, DriftPackage, etc.)
+	Kind string `json:"kind"`
+
+	// Resource is the path, package name or service name
+	Resource string `json:"resource"`
+
+	// Detail says how the resource differs (e.g., "missing", "mode 0600, want 0644")
+	Detail string `json:"detail"`
+}
+
+// ContentDrift returns the drift of a file with content before when a step wants
+// content after, or nil if they're equal. A nil before means the file is missing.
+func ContentDrift(path string, before, after []byte) []Drift {
+	if before == nil {
+		return []Drift{{Kind: DriftFile, Resource: path, Detail: "missing"}}
+	}
+	if bytes.Equal(before, after) {
+		return nil
+	}
+	return []Drift{{Kind: DriftFile, Resource: path, Detail: "content differs"}}
+}
+
 // HandlerFunc is a function type that implements Handler for simple actions.
 // This allows creating handlers without defining a new type.
 type HandlerFunc struct {
@@ -31,6 +31,7 @@ func (Handler) Metadata() actions.ActionMetadata {
 		Description:        "Load variables from YAML files",
 		Category:           actions.CategoryData,
 		SupportsDryRun:     true,
+		SupportsRemote:     true,
 		SupportsBecome:     false,
 		EmitsEvents:        []string{string(events.EventVarsLoaded)},
 		Version:            "1.0.0",
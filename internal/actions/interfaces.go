@@ -1,6 +1,8 @@
 package actions
 
 import (
+	"context"
+
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/expression"
 	"github.com/alehatsman/mooncake/internal/logger"
@@ -118,6 +120,17 @@ type Context interface {
 	//   - Creating temporary files (include step ID to avoid conflicts)
 	//   - Logging (though step ID is usually added automatically)
 	GetCurrentStepID() string
+
+	// GetContext returns the context of the current step attempt.
+	//
+	// The context is cancelled when:
+	//   - The step timeout expires (timeout: field)
+	//   - The run timeout expires (--timeout flag)
+	//   - The run is interrupted (SIGINT/SIGTERM)
+	//
+	// Pass it to everything that can block: exec.CommandContext,
+	// http.NewRequestWithContext, polling loops. Never returns nil.
+	GetContext() context.Context
 }
 
 // Result represents the outcome of an action execution.
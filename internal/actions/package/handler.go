@@ -12,6 +12,7 @@ package package_handler
 import (
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 
@@ -19,6 +20,7 @@ import (
 	"github.com/alehatsman/mooncake/internal/config"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/transport"
 )
 
 // Package manager constants
@@ -57,12 +59,13 @@ func (h *Handler) Metadata() actions.ActionMetadata {
 		Description:        "Manage system packages (install/remove/update)",
 		Category:           actions.CategorySystem,
 		SupportsDryRun:     true,
+		SupportsRemote:     true,
 		SupportsBecome:     true,
 		EmitsEvents:        []string{string(events.EventPackageManaged)},
 		Version:            "1.0.0",
 		SupportedPlatforms: []string{"linux", "darwin", "windows", "freebsd"}, // Multiple package managers supported
-		RequiresSudo:       true,                                               // Typically requires elevated privileges
-		ImplementsCheck:    true,                                               // Checks if package is installed before installing
+		RequiresSudo:       true,                                              // Typically requires elevated privileges
+		ImplementsCheck:    true,                                              // Checks if package is installed before installing
 	}
 }
 
@@ -186,6 +189,43 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	return nil
 }
 
+// Check predicts whether Execute would install or remove a package by querying
+// the package manager. Upgrades and state latest always report a change, as
+// Execute does.
+func (h *Handler) Check(ctx actions.Context, step *config.Step) (actions.CheckResult, error) {
+	pkg := step.Package
+
+	ec, ok := ctx.(*executor.ExecutionContext)
+	if !ok {
+		return actions.CheckResult{}, fmt.Errorf("context is not an ExecutionContext")
+	}
+
+	manager, err := h.determinePackageManager(pkg.Manager, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to determine package manager: %w", err)
+	}
+
+	state := pkg.State
+	if state == "" {
+		state = statePresent
+	}
+	var check actions.CheckResult
+	for _, name := range h.buildPackageList(pkg) {
+		installed, err := h.isPackageInstalled(ec, manager, name)
+		if err != nil {
+			return actions.CheckResult{}, fmt.Errorf("failed to check if package %q is installed: %w", name, err)
+		}
+		switch {
+		case !installed && state != stateAbsent:
+			check.Drift = append(check.Drift, actions.Drift{Kind: actions.DriftPackage, Resource: name, Detail: "not installed"})
+		case installed && state == stateAbsent:
+			check.Drift = append(check.Drift, actions.Drift{Kind: actions.DriftPackage, Resource: name, Detail: "installed, want absent"})
+		}
+	}
+	check.Changed = len(check.Drift) > 0 || pkg.Upgrade || state == stateLatest
+	return check, nil
+}
+
 // determinePackageManager determines which package manager to use.
 func (h *Handler) determinePackageManager(specified string, variables map[string]interface{}) (string, error) {
 	// If explicitly specified, use it
@@ -283,7 +323,10 @@ func (h *Handler) updateCache(ec *executor.ExecutionContext, manager string) err
 
 	// Execute the update command
 	// #nosec G204 - Package manager commands are validated
-	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	cmd, err := h.command(ec, cmdArgs)
+	if err != nil {
+		return err
+	}
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
@@ -317,7 +360,10 @@ func (h *Handler) installPackages(ec *executor.ExecutionContext, manager string,
 
 		// Execute the install command
 		// #nosec G204 - Package manager commands are validated
-		cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+		cmd, err := h.command(ec, cmdArgs)
+		if err != nil {
+			return nil, err
+		}
 		output, execErr := cmd.CombinedOutput()
 
 		if execErr != nil {
@@ -325,6 +371,9 @@ func (h *Handler) installPackages(ec *executor.ExecutionContext, manager string,
 			return nil, fmt.Errorf("failed to install package %q: %w", pkg, execErr)
 		}
 
+		if !installed {
+			ec.JournalPackage(manager, pkg, true)
+		}
 		result.SetChanged(true)
 	}
 
@@ -354,7 +403,10 @@ func (h *Handler) removePackages(ec *executor.ExecutionContext, manager string,
 
 		// Execute the remove command
 		// #nosec G204 - Package manager commands are validated
-		cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+		cmd, err := h.command(ec, cmdArgs)
+		if err != nil {
+			return nil, err
+		}
 		output, execErr := cmd.CombinedOutput()
 
 		if execErr != nil {
@@ -362,6 +414,7 @@ func (h *Handler) removePackages(ec *executor.ExecutionContext, manager string,
 			return nil, fmt.Errorf("failed to remove package %q: %w", pkg, execErr)
 		}
 
+		ec.JournalPackage(manager, pkg, false)
 		result.SetChanged(true)
 	}
 
@@ -378,7 +431,10 @@ func (h *Handler) executeUpgrade(ec *executor.ExecutionContext, manager string,
 
 	// Execute the upgrade command
 	// #nosec G204 - Package manager commands are validated
-	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	cmd, err := h.command(ec, cmdArgs)
+	if err != nil {
+		return nil, err
+	}
 	output, execErr := cmd.CombinedOutput()
 
 	if execErr != nil {
@@ -422,14 +478,61 @@ func (h *Handler) isPackageInstalled(ec *executor.ExecutionContext, manager, pkg
 	ec.Logger.Debugf("    Checking if installed: %s", strings.Join(checkCmd, " "))
 
 	// Execute the check command
-	cmd := exec.Command(checkCmd[0], checkCmd[1:]...) // #nosec G204 -- checkCmd built from validated package managers
-	err := cmd.Run()
+	cmd, err := h.command(ec, checkCmd)
+	if err != nil {
+		return false, err
+	}
 
 	// If command succeeds (exit code 0), package is installed
-	return err == nil, nil
+	return cmd.Run() == nil, nil
+}
+
+// command returns the command running a package manager tool, cmdArgs[0], with
+// its arguments on the target host. In alternate roots (--root), the tool of this
+// host manages the packages of the root with its root option, so the root doesn't
+// need a working package manager.
+func (h *Handler) command(ec *executor.ExecutionContext, cmdArgs []string) (*exec.Cmd, error) {
+	chroot, ok := ec.GetTransport().(*transport.Chroot)
+	if !ok {
+		return ec.Command(cmdArgs[0], cmdArgs[1:]...), nil
+	}
+	args, err := h.rootArgs(cmdArgs, chroot.Root)
+	if err != nil {
+		return nil, err
+	}
+	return ec.LocalCommand(args[0], args[1:]...), nil // #nosec G204 -- args built from validated package managers
+}
+
+// rootArgs adds the options that make a package manager tool act on the packages
+// of an alternate root to its arguments.
+func (h *Handler) rootArgs(cmdArgs []string, root string) ([]string, error) {
+	var options []string
+	switch cmdArgs[0] {
+	case "apt-get":
+		// apt reads its configuration and state from the root and runs dpkg in it
+		options = []string{
+			"-o", "Dir=" + root,
+			"-o", "Dir::State::Status=" + filepath.Join(root, "var/lib/dpkg/status"),
+			"-o", "DPkg::Chroot-Directory=" + root,
+		}
+	case "dpkg":
+		options = []string{"--root=" + root}
+	case pmDnf, pmYum:
+		options = []string{"--installroot=" + root}
+	case "rpm", pmPacman, pmZypper, pmApk:
+		options = []string{"--root", root}
+	default:
+		return nil, fmt.Errorf("%s can't manage the packages of an alternate root", cmdArgs[0])
+	}
+
+	args := make([]string, 0, len(cmdArgs)+len(options))
+	args = append(args, cmdArgs[0])
+	args = append(args, options...)
+	return append(args, cmdArgs[1:]...), nil
 }
 
 // buildInstallCommand builds the install command for a package manager.
+//
 //nolint:dupl,unparam // Similar structure to buildRemoveCommand; upgrade parameter for future use
 func (h *Handler) buildInstallCommand(manager, pkg string, upgrade bool, extra []string) []string {
 	// Preallocate: base command (3) + extra + package name (1)
@@ -468,6 +571,7 @@ func (h *Handler) buildInstallCommand(manager, pkg string, upgrade bool, extra [
 }
 
 // buildRemoveCommand builds the remove command for a package manager.
+//
 //nolint:dupl // Similar structure to buildInstallCommand but different semantics
 func (h *Handler) buildRemoveCommand(manager, pkg string, extra []string) []string {
 	// Preallocate: base command (3) + extra + package name (1)
@@ -2,6 +2,8 @@
 package package_handler
 
 import (
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
@@ -15,6 +17,7 @@ import (
 	"github.com/alehatsman/mooncake/internal/pathutil"
 	"github.com/alehatsman/mooncake/internal/security"
 	"github.com/alehatsman/mooncake/internal/template"
+	"github.com/alehatsman/mooncake/internal/transport"
 )
 
 // newMockExecutionContext creates a mock that can be cast to *executor.ExecutionContext
@@ -1268,6 +1271,129 @@ func TestHandler_IsPackageInstalled_NotInstalled(t *testing.T) {
 	}
 }
 
+func TestHandler_Check(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as fake dpkg")
+	}
+
+	// Fake dpkg that only knows the "curl" package
+	binDir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$2\" = curl ]\n"
+	if err := os.WriteFile(filepath.Join(binDir, "dpkg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+
+	tests := []struct {
+		name      string
+		pkg       config.Package
+		want      bool
+		wantDrift string
+	}{
+		{"installed", config.Package{Name: "curl"}, false, ""},
+		{"not installed", config.Package{Names: []string{"curl", "jq"}}, true, "jq: not installed"},
+		{"absent not installed", config.Package{Name: "jq", State: "absent"}, false, ""},
+		{"absent installed", config.Package{Name: "curl", State: "absent"}, true, "curl: installed, want absent"},
+		{"latest", config.Package{Name: "curl", State: "latest"}, true, ""},
+		{"latest not installed", config.Package{Name: "jq", State: "latest"}, true, "jq: not installed"},
+		{"upgrade", config.Package{Upgrade: true}, true, ""},
+	}
+
+	h := &Handler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkg := tt.pkg
+			pkg.Manager = "apt"
+			check, err := h.Check(newMockExecutionContext(), &config.Step{Package: &pkg})
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if check.Changed != tt.want {
+				t.Errorf("Check().Changed = %v, want %v", check.Changed, tt.want)
+			}
+			var drift []string
+			for _, d := range check.Drift {
+				drift = append(drift, d.Resource+": "+d.Detail)
+			}
+			if got := strings.Join(drift, ", "); got != tt.wantDrift {
+				t.Errorf("Check().Drift = %q, want %q", got, tt.wantDrift)
+			}
+		})
+	}
+}
+
+func TestHandler_Check_AlternateRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as fake dpkg")
+	}
+
+	// Fake dpkg of this host that only knows the "curl" package of the root
+	root, err := transport.NewChroot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	binDir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = \"--root=" + root.Root + "\" ] && [ \"$3\" = curl ]\n"
+	if err := os.WriteFile(filepath.Join(binDir, "dpkg"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+
+	ec := newMockExecutionContext()
+	ec.Transport = root
+	h := &Handler{}
+	check, err := h.Check(ec, &config.Step{Package: &config.Package{Names: []string{"curl", "jq"}, Manager: "apt"}})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if len(check.Drift) != 1 || check.Drift[0].Resource != "jq" {
+		t.Errorf("Check().Drift = %v, want jq not installed", check.Drift)
+	}
+
+	_, err = h.Check(ec, &config.Step{Package: &config.Package{Name: "wget", Manager: "brew"}})
+	if err == nil || !strings.Contains(err.Error(), "brew can't manage the packages of an alternate root") {
+		t.Errorf("Check(brew) error = %v, want alternate root error", err)
+	}
+}
+
+func TestHandler_RootArgs(t *testing.T) {
+	h := &Handler{}
+	tests := []struct {
+		cmdArgs []string
+		want    []string
+	}{
+		{
+			[]string{"apt-get", "install", "-y", "curl"},
+			[]string{"apt-get", "-o", "Dir=/mnt/image", "-o", "Dir::State::Status=/mnt/image/var/lib/dpkg/status",
+				"-o", "DPkg::Chroot-Directory=/mnt/image", "install", "-y", "curl"},
+		},
+		{[]string{"dpkg", "-s", "curl"}, []string{"dpkg", "--root=/mnt/image", "-s", "curl"}},
+		{[]string{"dnf", "install", "-y", "curl"}, []string{"dnf", "--installroot=/mnt/image", "install", "-y", "curl"}},
+		{[]string{"yum", "makecache"}, []string{"yum", "--installroot=/mnt/image", "makecache"}},
+		{[]string{"rpm", "-q", "curl"}, []string{"rpm", "--root", "/mnt/image", "-q", "curl"}},
+		{[]string{"pacman", "-S", "--noconfirm", "curl"}, []string{"pacman", "--root", "/mnt/image", "-S", "--noconfirm", "curl"}},
+		{[]string{"zypper", "install", "-y", "curl"}, []string{"zypper", "--root", "/mnt/image", "install", "-y", "curl"}},
+		{[]string{"apk", "add", "curl"}, []string{"apk", "--root", "/mnt/image", "add", "curl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmdArgs[0], func(t *testing.T) {
+			got, err := h.rootArgs(tt.cmdArgs, "/mnt/image")
+			if err != nil {
+				t.Fatalf("rootArgs() error = %v", err)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("rootArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, tool := range []string{"brew", "port", "choco", "scoop"} {
+		if _, err := h.rootArgs([]string{tool, "install", "curl"}, "/mnt/image"); err == nil {
+			t.Errorf("rootArgs(%s) should error", tool)
+		}
+	}
+}
+
 func TestHandler_BuildInstallCommand_AllManagers(t *testing.T) {
 	h := &Handler{}
 
@@ -65,6 +65,7 @@ func (h *Handler) Metadata() actions.ActionMetadata {
 		Description:        "Execute a preset by expanding it into steps",
 		Category:           actions.CategorySystem,
 		SupportsDryRun:     true,
+		SupportsRemote:     true,
 		SupportedPlatforms: []string{}, // All platforms (meta-action)
 		RequiresSudo:       false,      // Depends on constituent steps
 		ImplementsCheck:    false,      // Meta-action, delegates to steps
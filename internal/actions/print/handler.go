@@ -29,6 +29,7 @@ func (h *Handler) Metadata() actions.ActionMetadata {
 		Description:        "Display messages to the user",
 		Category:           actions.CategoryOutput,
 		SupportsDryRun:     true,
+		SupportsRemote:     true,
 		SupportsBecome:     false,
 		EmitsEvents:        []string{string(events.EventPrintMessage)},
 		Version:            "1.0.0",
@@ -1,6 +1,7 @@
 package print
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -59,6 +60,10 @@ func (m *mockContext) GetCurrentStepID() string {
 	return m.stepID
 }
 
+func (m *mockContext) GetContext() context.Context {
+	return context.Background()
+}
+
 func (m *mockContext) GetEvaluator() expression.Evaluator {
 	return expression.NewExprEvaluator()
 }
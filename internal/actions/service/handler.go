@@ -15,6 +15,7 @@ import (
 
 	"github.com/alehatsman/mooncake/internal/actions"
 	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/diff"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/security"
@@ -42,9 +43,10 @@ func (h *Handler) Metadata() actions.ActionMetadata {
 		Description:        "Manage services across platforms (systemd, launchd, Windows)",
 		Category:           actions.CategorySystem,
 		SupportsDryRun:     true,
+		SupportsRemote:     true,
 		SupportedPlatforms: []string{"linux", "darwin", "windows"}, // Platform-specific implementations
-		RequiresSudo:       true,                                    // Typically requires elevated privileges
-		ImplementsCheck:    true,                                    // Checks service state before changes
+		RequiresSudo:       true,                                   // Typically requires elevated privileges
+		ImplementsCheck:    true,                                   // Checks service state before changes
 	}
 }
 
@@ -128,6 +130,117 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	return nil
 }
 
+// Check predicts whether Execute would change the service: unit and drop-in files
+// are diffed against their rendered content, and the service state and enablement
+// are queried. Only systemd is supported.
+func (h *Handler) Check(ctx actions.Context, step *config.Step) (actions.CheckResult, error) {
+	ec, ok := ctx.(*executor.ExecutionContext)
+	if !ok {
+		return actions.CheckResult{}, fmt.Errorf("invalid context type")
+	}
+
+	serviceAction := step.Service
+	if serviceAction == nil {
+		return actions.CheckResult{}, fmt.Errorf("service action requires service configuration")
+	}
+
+	renderedName, err := ec.Template.Render(serviceAction.Name, ec.Variables)
+	if err != nil {
+		return actions.CheckResult{}, &executor.RenderError{Field: "service.name", Cause: err}
+	}
+
+	if targetOS := ec.TargetOS(); targetOS != "linux" {
+		return actions.CheckResult{}, fmt.Errorf("service check not supported on %s", targetOS)
+	}
+	return checkSystemdService(renderedName, serviceAction, *step, ec)
+}
+
+// checkSystemdService predicts the changes handleSystemdService would make.
+func checkSystemdService(serviceName string, serviceAction *config.ServiceAction, step config.Step, ec *executor.ExecutionContext) (actions.CheckResult, error) {
+	var check actions.CheckResult
+
+	checkFile := func(path, content string) error {
+		existingContent, err := ec.GetTransport().ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return &executor.FileOperationError{Operation: "read", Path: path, Cause: err}
+		}
+		if err == nil && string(existingContent) == content {
+			return nil
+		}
+		check.Changed = true
+		check.Diff += diff.File(path, existingContent, []byte(content))
+		check.Drift = append(check.Drift, actions.ContentDrift(path, existingContent, []byte(content))...)
+		return nil
+	}
+
+	if serviceAction.Unit != nil {
+		content, err := renderTemplateOrContent(serviceAction.Unit.SrcTemplate, serviceAction.Unit.Content, "service.unit", ec)
+		if err != nil {
+			return actions.CheckResult{}, err
+		}
+		if err := checkFile(systemdUnitPath(serviceName, serviceAction.Unit), content); err != nil {
+			return actions.CheckResult{}, err
+		}
+	}
+
+	if serviceAction.Dropin != nil {
+		if serviceAction.Dropin.Name == "" {
+			return actions.CheckResult{}, &executor.StepValidationError{Field: "service.dropin.name", Message: "drop-in name is required"}
+		}
+		content, err := renderTemplateOrContent(serviceAction.Dropin.SrcTemplate, serviceAction.Dropin.Content, "service.dropin", ec)
+		if err != nil {
+			return actions.CheckResult{}, err
+		}
+		if err := checkFile(systemdDropinPath(serviceName, serviceAction.Dropin), content); err != nil {
+			return actions.CheckResult{}, err
+		}
+	}
+
+	switch serviceAction.State {
+	case ServiceStateRestarted, ServiceStateReloaded:
+		check.Changed = true
+	case ServiceStateStarted, ServiceStateStopped:
+		currentState, err := getSystemdServiceState(serviceName, step, ec)
+		if err != nil {
+			return actions.CheckResult{}, err
+		}
+		var stateChanged bool
+		if serviceAction.State == ServiceStateStarted {
+			stateChanged = currentState != "active"
+		} else {
+			stateChanged = currentState != "inactive" && currentState != "failed"
+		}
+		if stateChanged {
+			if currentState == "" {
+				currentState = "unknown"
+			}
+			check.Changed = true
+			check.Drift = append(check.Drift, actions.Drift{
+				Kind:     actions.DriftService,
+				Resource: serviceName,
+				Detail:   fmt.Sprintf("%s, want %s", currentState, serviceAction.State),
+			})
+		}
+	}
+
+	if serviceAction.Enabled != nil {
+		isEnabled, err := isSystemdServiceEnabled(serviceName, step, ec)
+		if err != nil {
+			return actions.CheckResult{}, err
+		}
+		if isEnabled != *serviceAction.Enabled {
+			check.Changed = true
+			detail := "disabled, want enabled"
+			if isEnabled {
+				detail = "enabled, want disabled"
+			}
+			check.Drift = append(check.Drift, actions.Drift{Kind: actions.DriftService, Resource: serviceName, Detail: detail})
+		}
+	}
+
+	return check, nil
+}
+
 // HandleService manages services across different platforms (systemd, launchd, Windows).
 func HandleService(step config.Step, ec *executor.ExecutionContext) error {
 	serviceAction := step.Service
@@ -165,7 +278,7 @@ func HandleService(step config.Step, ec *executor.ExecutionContext) error {
 	}
 
 	// Dispatch to platform-specific handler
-	switch runtime.GOOS {
+	switch targetOS := ec.TargetOS(); targetOS {
 	case "linux":
 		return handleSystemdService(renderedName, serviceAction, step, ec)
 	case "darwin":
@@ -175,7 +288,7 @@ func HandleService(step config.Step, ec *executor.ExecutionContext) error {
 	default:
 		return &executor.SetupError{
 			Component: "service",
-			Issue:     fmt.Sprintf("service management not supported on %s", runtime.GOOS),
+			Issue:     fmt.Sprintf("service management not supported on %s", targetOS),
 		}
 	}
 }
@@ -332,14 +445,22 @@ func handleSystemdService(serviceName string, serviceAction *config.ServiceActio
 	return nil
 }
 
+// systemdUnitPath returns the path of a unit file, by default in the system unit directory.
+func systemdUnitPath(serviceName string, unit *config.ServiceUnit) string {
+	if unit.Dest != "" {
+		return unit.Dest
+	}
+	return fmt.Sprintf("/etc/systemd/system/%s.service", serviceName)
+}
+
+// systemdDropinPath returns the path of a drop-in file.
+func systemdDropinPath(serviceName string, dropin *config.ServiceDropin) string {
+	return filepath.Join(fmt.Sprintf("/etc/systemd/system/%s.service.d", serviceName), dropin.Name)
+}
+
 // manageSystemdUnitFile creates or updates a systemd unit file.
 func manageSystemdUnitFile(serviceName string, unit *config.ServiceUnit, step config.Step, ec *executor.ExecutionContext) (bool, error) {
-	// Determine unit file path
-	unitPath := unit.Dest
-	if unitPath == "" {
-		// Default to system unit directory
-		unitPath = fmt.Sprintf("/etc/systemd/system/%s.service", serviceName)
-	}
+	unitPath := systemdUnitPath(serviceName, unit)
 
 	// Render content from template or inline
 	content, err := renderTemplateOrContent(unit.SrcTemplate, unit.Content, "service.unit", ec)
@@ -348,14 +469,14 @@ func manageSystemdUnitFile(serviceName string, unit *config.ServiceUnit, step co
 	}
 
 	// Check if file exists and has same content (idempotency)
-	// #nosec G304 - This is a provisioning tool that manages service unit files
-	existingContent, readErr := os.ReadFile(unitPath)
+	existingContent, readErr := ec.GetTransport().ReadFile(unitPath)
 	if readErr == nil && string(existingContent) == content {
 		ec.Logger.Debugf("  Unit file %s already up to date", unitPath)
 		return false, nil
 	}
 
 	// Write unit file (may require sudo)
+	ec.JournalPath(unitPath, step.Become)
 	if err := writeFileWithPrivileges(unitPath, []byte(content), unit.Mode, step, ec); err != nil {
 		return false, err
 	}
@@ -370,9 +491,8 @@ func manageSystemdDropin(serviceName string, dropin *config.ServiceDropin, step
 		return false, &executor.StepValidationError{Field: "service.dropin.name", Message: "drop-in name is required"}
 	}
 
-	// Drop-in directory path
-	dropinDir := fmt.Sprintf("/etc/systemd/system/%s.service.d", serviceName)
-	dropinPath := filepath.Join(dropinDir, dropin.Name)
+	dropinPath := systemdDropinPath(serviceName, dropin)
+	dropinDir := filepath.Dir(dropinPath)
 
 	// Render content from template or inline
 	content, err := renderTemplateOrContent(dropin.SrcTemplate, dropin.Content, "service.dropin", ec)
@@ -381,16 +501,17 @@ func manageSystemdDropin(serviceName string, dropin *config.ServiceDropin, step
 	}
 
 	// Check if file exists and has same content (idempotency)
-	// #nosec G304 - This is a provisioning tool that manages service drop-in files
-	existingContent, readErr := os.ReadFile(dropinPath)
+	existingContent, readErr := ec.GetTransport().ReadFile(dropinPath)
 	if readErr == nil && string(existingContent) == content {
 		ec.Logger.Debugf("  Drop-in file %s already up to date", dropinPath)
 		return false, nil
 	}
 
+	ec.JournalPath(dropinPath, step.Become)
+
 	// Ensure drop-in directory exists
 	// #nosec G301 - Drop-in directories need to be readable by systemd (0755 is appropriate)
-	if err := os.MkdirAll(dropinDir, 0755); err != nil {
+	if err := ec.GetTransport().MkdirAll(dropinDir, 0755); err != nil {
 		if os.IsPermission(err) && !step.Become {
 			return false, &executor.FileOperationError{
 				Operation: "mkdir",
@@ -428,10 +549,10 @@ func systemdDaemonReload(step config.Step, ec *executor.ExecutionContext) error
 				Issue:     "no password provided. Use --sudo-pass flag",
 			}
 		}
-		cmd = exec.Command("sudo", "-S", "systemctl", "daemon-reload")
+		cmd = ec.Command("sudo", "-S", "systemctl", "daemon-reload")
 		cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 	} else {
-		cmd = exec.Command("systemctl", "daemon-reload")
+		cmd = ec.Command("systemctl", "daemon-reload")
 	}
 
 	output, err := cmd.CombinedOutput()
@@ -499,11 +620,11 @@ func manageSystemdServiceState(serviceName, desiredState string, step config.Ste
 			}
 		}
 		// #nosec G204 - This is a provisioning tool that manages systemd services with validated actions
-		cmd = exec.Command("sudo", "-S", "systemctl", action, serviceName)
+		cmd = ec.Command("sudo", "-S", "systemctl", action, serviceName)
 		cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 	} else {
 		// #nosec G204 - This is a provisioning tool that manages systemd services with validated actions
-		cmd = exec.Command("systemctl", action, serviceName)
+		cmd = ec.Command("systemctl", action, serviceName)
 	}
 
 	output, err := cmd.CombinedOutput()
@@ -518,6 +639,10 @@ func manageSystemdServiceState(serviceName, desiredState string, step config.Ste
 		}
 	}
 
+	// Restarts and reloads leave the service running, so only starts and stops can be undone
+	if action == "start" || action == "stop" {
+		ec.JournalServiceActive(serviceName, currentState == "active", step.Become)
+	}
 	return true, nil
 }
 
@@ -531,10 +656,10 @@ func getSystemdServiceState(serviceName string, step config.Step, ec *executor.E
 				Issue:     "no password provided. Use --sudo-pass flag",
 			}
 		}
-		cmd = exec.Command("sudo", "-S", "systemctl", "is-active", serviceName)
+		cmd = ec.Command("sudo", "-S", "systemctl", "is-active", serviceName)
 		cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 	} else {
-		cmd = exec.Command("systemctl", "is-active", serviceName)
+		cmd = ec.Command("systemctl", "is-active", serviceName)
 	}
 
 	output, _ := cmd.Output() // Ignore error, is-active returns non-zero for inactive services
@@ -581,11 +706,11 @@ func manageSystemdServiceEnabled(serviceName string, shouldBeEnabled bool, step
 			}
 		}
 		// #nosec G204 - This is a provisioning tool that manages systemd services with validated actions
-		cmd = exec.Command("sudo", "-S", "systemctl", action, serviceName)
+		cmd = ec.Command("sudo", "-S", "systemctl", action, serviceName)
 		cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 	} else {
 		// #nosec G204 - This is a provisioning tool that manages systemd services with validated actions
-		cmd = exec.Command("systemctl", action, serviceName)
+		cmd = ec.Command("systemctl", action, serviceName)
 	}
 
 	output, err := cmd.CombinedOutput()
@@ -600,6 +725,7 @@ func manageSystemdServiceEnabled(serviceName string, shouldBeEnabled bool, step
 		}
 	}
 
+	ec.JournalServiceEnabled(serviceName, isEnabled, step.Become)
 	return true, nil
 }
 
@@ -613,10 +739,10 @@ func isSystemdServiceEnabled(serviceName string, step config.Step, ec *executor.
 				Issue:     "no password provided. Use --sudo-pass flag",
 			}
 		}
-		cmd = exec.Command("sudo", "-S", "systemctl", "is-enabled", serviceName)
+		cmd = ec.Command("sudo", "-S", "systemctl", "is-enabled", serviceName)
 		cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 	} else {
-		cmd = exec.Command("systemctl", "is-enabled", serviceName)
+		cmd = ec.Command("systemctl", "is-enabled", serviceName)
 	}
 
 	output, _ := cmd.Output() // Ignore error, is-enabled returns non-zero for disabled services
@@ -634,7 +760,7 @@ func writeFileWithPrivileges(path string, content []byte, mode string, step conf
 	fileMode := parseFileMode(mode, 0644)
 
 	// Try direct write first
-	if err := os.WriteFile(path, content, fileMode); err != nil {
+	if err := ec.GetTransport().WriteFile(path, content, fileMode); err != nil {
 		if os.IsPermission(err) && step.Become {
 			// Use sudo to write file
 			return writeFileWithSudo(path, content, fileMode, ec)
@@ -661,25 +787,21 @@ func writeFileWithSudo(path string, content []byte, mode os.FileMode, ec *execut
 		}
 	}
 
-	// Write to temporary file first
-	tmpFile, err := os.CreateTemp("", "mooncake-unit-*")
+	// Write to temporary file on the target host first
+	target := ec.GetTransport()
+	tmpPath, err := target.TempFile()
 	if err != nil {
 		return &executor.FileOperationError{Operation: "create temp", Path: path, Cause: err}
 	}
-	tmpPath := tmpFile.Name()
-	defer func() { _ = os.Remove(tmpPath) }() // Best-effort cleanup
+	defer func() { _ = target.Remove(tmpPath) }() // Best-effort cleanup
 
-	if _, err := tmpFile.Write(content); err != nil {
-		_ = tmpFile.Close() // Best-effort cleanup on error path
+	if err := target.WriteFile(tmpPath, content, 0600); err != nil {
 		return &executor.FileOperationError{Operation: "write temp", Path: tmpPath, Cause: err}
 	}
-	if err := tmpFile.Close(); err != nil {
-		return &executor.FileOperationError{Operation: "close temp", Path: tmpPath, Cause: err}
-	}
 
 	// Use sudo to copy temp file to target location
 	// #nosec G204 - This is a provisioning tool that needs to copy files with elevated privileges
-	cmd := exec.Command("sudo", "-S", "cp", tmpPath, path)
+	cmd := ec.Command("sudo", "-S", "cp", tmpPath, path)
 	cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -695,7 +817,7 @@ func writeFileWithSudo(path string, content []byte, mode os.FileMode, ec *execut
 
 	// Set file permissions with sudo
 	// #nosec G204 - This is a provisioning tool that needs to set file permissions with elevated privileges
-	cmd = exec.Command("sudo", "-S", "chmod", fmt.Sprintf("%o", mode), path)
+	cmd = ec.Command("sudo", "-S", "chmod", fmt.Sprintf("%o", mode), path)
 	cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -846,8 +968,7 @@ func manageLaunchdPlist(serviceName string, unit *config.ServiceUnit, isSystem b
 	}
 
 	// Check if file exists and has same content (idempotency)
-	// #nosec G304 - This is a provisioning tool that reads plist files from validated paths
-	existingContent, readErr := os.ReadFile(plistPath)
+	existingContent, readErr := ec.GetTransport().ReadFile(plistPath)
 	if readErr == nil && string(existingContent) == content {
 		ec.Logger.Debugf("  Plist file %s already up to date", plistPath)
 		return false, nil
@@ -856,7 +977,7 @@ func manageLaunchdPlist(serviceName string, unit *config.ServiceUnit, isSystem b
 	// Ensure parent directory exists
 	plistDir := filepath.Dir(plistPath)
 	// #nosec G301 - Plist directories need to be readable by launchd (0755 is appropriate)
-	if err := os.MkdirAll(plistDir, 0755); err != nil {
+	if err := ec.GetTransport().MkdirAll(plistDir, 0755); err != nil {
 		return false, &executor.FileOperationError{Operation: "mkdir", Path: plistDir, Cause: err}
 	}
 
@@ -879,10 +1000,10 @@ func isLaunchdServiceLoaded(serviceID string, step config.Step, ec *executor.Exe
 				Issue:     "no password provided. Use --sudo-pass flag",
 			}
 		}
-		cmd = exec.Command("sudo", "-S", "launchctl", "print", serviceID)
+		cmd = ec.Command("sudo", "-S", "launchctl", "print", serviceID)
 		cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 	} else {
-		cmd = exec.Command("launchctl", "print", serviceID)
+		cmd = ec.Command("launchctl", "print", serviceID)
 	}
 
 	output, err := cmd.CombinedOutput()
@@ -997,11 +1118,11 @@ func executeLaunchctlCommand(command, domain, plistPath string, step config.Step
 			}
 		}
 		// #nosec G204 - This is a provisioning tool that manages launchd services with validated commands
-		cmd = exec.Command("sudo", "-S", "launchctl", command, domain, plistPath)
+		cmd = ec.Command("sudo", "-S", "launchctl", command, domain, plistPath)
 		cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 	} else {
 		// #nosec G204 - This is a provisioning tool that manages launchd services with validated commands
-		cmd = exec.Command("launchctl", command, domain, plistPath)
+		cmd = ec.Command("launchctl", command, domain, plistPath)
 	}
 
 	output, err := cmd.CombinedOutput()
@@ -1083,10 +1204,10 @@ func launchdKickstart(serviceID string, kill bool, step config.Step, ec *executo
 		sudoArgs = append(sudoArgs, "-S", "launchctl")
 		sudoArgs = append(sudoArgs, args...)
 		// #nosec G204 - This is a provisioning tool that manages launchd services with validated commands
-		cmd = exec.Command("sudo", sudoArgs...)
+		cmd = ec.Command("sudo", sudoArgs...)
 		cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 	} else {
-		cmd = exec.Command("launchctl", args...)
+		cmd = ec.Command("launchctl", args...)
 	}
 
 	output, err := cmd.CombinedOutput()
@@ -1122,10 +1243,10 @@ func launchdKill(serviceID string, step config.Step, ec *executor.ExecutionConte
 				Issue:     "no password provided. Use --sudo-pass flag",
 			}
 		}
-		cmd = exec.Command("sudo", "-S", "launchctl", "kill", "SIGTERM", serviceID)
+		cmd = ec.Command("sudo", "-S", "launchctl", "kill", "SIGTERM", serviceID)
 		cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 	} else {
-		cmd = exec.Command("launchctl", "kill", "SIGTERM", serviceID)
+		cmd = ec.Command("launchctl", "kill", "SIGTERM", serviceID)
 	}
 
 	output, err := cmd.CombinedOutput()
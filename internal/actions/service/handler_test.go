@@ -346,6 +346,96 @@ func TestHandler_DryRun_TemplateRenderFailure(t *testing.T) {
 	}
 }
 
+func TestHandler_Check(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("service check is only supported with systemd")
+	}
+
+	// Fake systemctl reporting an active, enabled service
+	binDir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\n  is-active) echo active ;;\n  is-enabled) echo enabled ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(binDir, "systemctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir)
+
+	unitPath := filepath.Join(t.TempDir(), "app.service")
+	if err := os.WriteFile(unitPath, []byte("[Service]\nExecStart=/usr/bin/app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	enabled, disabled := true, false
+	tests := []struct {
+		name      string
+		action    config.ServiceAction
+		want      bool
+		wantDiff  string
+		wantDrift string
+	}{
+		{
+			name:   "already started and enabled",
+			action: config.ServiceAction{State: ServiceStateStarted, Enabled: &enabled},
+		},
+		{
+			name:      "stop",
+			action:    config.ServiceAction{State: ServiceStateStopped},
+			want:      true,
+			wantDrift: "app: active, want stopped",
+		},
+		{
+			name:   "restart",
+			action: config.ServiceAction{State: ServiceStateRestarted},
+			want:   true,
+		},
+		{
+			name:      "disable",
+			action:    config.ServiceAction{Enabled: &disabled},
+			want:      true,
+			wantDrift: "app: enabled, want disabled",
+		},
+		{
+			name: "unit up to date",
+			action: config.ServiceAction{
+				Unit: &config.ServiceUnit{Dest: unitPath, Content: "[Service]\nExecStart=/usr/bin/app\n"},
+			},
+		},
+		{
+			name: "unit changed",
+			action: config.ServiceAction{
+				Unit: &config.ServiceUnit{Dest: unitPath, Content: "[Service]\nExecStart=/usr/bin/app --verbose\n"},
+			},
+			want:      true,
+			wantDiff:  "-ExecStart=/usr/bin/app\n+ExecStart=/usr/bin/app --verbose\n",
+			wantDrift: unitPath + ": content differs",
+		},
+	}
+
+	h := &Handler{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := tt.action
+			action.Name = "app"
+			check, err := h.Check(newMockExecutionContext(), &config.Step{Service: &action})
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if check.Changed != tt.want {
+				t.Errorf("Check().Changed = %v, want %v", check.Changed, tt.want)
+			}
+			if !strings.Contains(check.Diff, tt.wantDiff) || (tt.wantDiff == "") != (check.Diff == "") {
+				t.Errorf("Check().Diff = %q, want it to contain %q", check.Diff, tt.wantDiff)
+			}
+			var drift []string
+			for _, d := range check.Drift {
+				drift = append(drift, d.Resource+": "+d.Detail)
+			}
+			if got := strings.Join(drift, ", "); got != tt.wantDrift {
+				t.Errorf("Check().Drift = %q, want %q", got, tt.wantDrift)
+			}
+		})
+	}
+}
+
 func TestValidateServiceStates(t *testing.T) {
 	validStates := []string{
 		ServiceStateStarted,
@@ -4,7 +4,7 @@
 // - Multiple interpreters (bash, sh, pwsh, cmd)
 // - Sudo/become privilege escalation
 // - Environment variables and working directory
-// - Timeout and retry logic
+// - Timeout and cancellation via the step context (retries are handled by the executor)
 // - Stdin, stdout, stderr handling
 // - Result overrides (changed_when, failed_when)
 package shell
@@ -15,7 +15,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -26,7 +25,9 @@ import (
 	"github.com/alehatsman/mooncake/internal/config"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/sandbox"
 	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/transport"
 )
 
 // Handler implements the Handler interface for shell actions.
@@ -44,6 +45,7 @@ func (h *Handler) Metadata() actions.ActionMetadata {
 		Description:    "Execute shell commands",
 		Category:       actions.CategoryCommand,
 		SupportsDryRun: true,
+		SupportsRemote: true,
 		SupportsBecome: true,
 		EmitsEvents: []string{
 			string(events.EventStepStdout),
@@ -98,8 +100,8 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 
 	ctx.GetLogger().Debugf("  Executing: %s", renderedCommand)
 
-	// Execute with retries
-	return h.executeWithRetry(ctx, step, renderedCommand)
+	// Retries and timeout are applied by the executor
+	return h.executeShellCommand(ctx, step, renderedCommand)
 }
 
 // DryRun logs what would be executed.
@@ -122,48 +124,6 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	return nil
 }
 
-// executeWithRetry wraps command execution with retry logic
-func (h *Handler) executeWithRetry(ctx actions.Context, step *config.Step, renderedCommand string) (actions.Result, error) {
-	maxAttempts := step.Retries + 1
-	if maxAttempts < 1 {
-		maxAttempts = 1
-	}
-
-	var lastResult actions.Result
-	var lastErr error
-
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		if attempt > 1 {
-			ctx.GetLogger().Debugf("  Retry attempt %d/%d", attempt-1, step.Retries)
-		}
-
-		result, err := h.executeShellCommand(ctx, step, renderedCommand)
-		if err == nil {
-			return result, nil
-		}
-
-		lastResult = result
-		lastErr = err
-
-		// Don't sleep after the last attempt
-		if attempt < maxAttempts && step.RetryDelay != "" {
-			delay, parseErr := time.ParseDuration(step.RetryDelay)
-			if parseErr != nil {
-				ctx.GetLogger().Debugf("  Invalid retry_delay %q: %v", step.RetryDelay, parseErr)
-			} else {
-				ctx.GetLogger().Debugf("  Waiting %s before retry...", step.RetryDelay)
-				time.Sleep(delay)
-			}
-		}
-	}
-
-	// All attempts failed
-	if step.Retries > 0 {
-		return lastResult, fmt.Errorf("command failed after %d attempts: %w", maxAttempts, lastErr)
-	}
-	return lastResult, lastErr
-}
-
 // executeShellCommand executes the actual shell command
 func (h *Handler) executeShellCommand(ctx actions.Context, step *config.Step, renderedCommand string) (actions.Result, error) {
 	// Create result
@@ -174,47 +134,32 @@ func (h *Handler) executeShellCommand(ctx actions.Context, step *config.Step, re
 		result.Duration = result.EndTime.Sub(result.StartTime)
 	}()
 
-	// Setup context with timeout
-	cmdCtx, cancel, err := h.setupCommandContext(step)
+	// Configure environment
+	env, dir, err := h.commandEnvironment(ctx, step)
 	if err != nil {
 		return result, err
 	}
-	if cancel != nil {
-		defer cancel()
-	}
 
-	// Create command
-	command, err := h.createShellCommand(cmdCtx, ctx, step, renderedCommand)
+	// Create command under the step context (step timeout, run cancellation)
+	command, err := h.createShellCommand(ctx.GetContext(), ctx, step, renderedCommand, env, dir)
 	if err != nil {
 		return result, err
 	}
 
-	// Configure environment
-	if err := h.configureCommandEnvironment(command, ctx, step); err != nil {
-		return result, err
+	// Run the command in the sandbox of the step, if it has one
+	var reports *sandbox.Reports
+	if ec, ok := ctx.(*executor.ExecutionContext); ok {
+		if reports, err = ec.SandboxCommand(step, command); err != nil {
+			return result, err
+		}
+		defer reports.Close()
 	}
 
 	// Execute and capture output
 	stdout, stderr, execErr := h.executeAndCaptureOutput(command, ctx, step)
 
 	// Process result
-	return h.processCommandResult(ctx, step, result, stdout, stderr, execErr)
-}
-
-// setupCommandContext creates a context with timeout if specified
-func (h *Handler) setupCommandContext(step *config.Step) (context.Context, context.CancelFunc, error) {
-	cmdCtx := context.Background()
-	var cancel context.CancelFunc
-
-	if step.Timeout != "" {
-		timeout, err := time.ParseDuration(step.Timeout)
-		if err != nil {
-			return nil, nil, fmt.Errorf("invalid timeout duration: %w", err)
-		}
-		cmdCtx, cancel = context.WithTimeout(cmdCtx, timeout)
-	}
-
-	return cmdCtx, cancel, nil
+	return h.processCommandResult(ctx, step, result, stdout, stderr, execErr, reports)
 }
 
 // getInterpreter determines the shell interpreter to use
@@ -229,8 +174,8 @@ func (h *Handler) getInterpreter(shellAction *config.ShellAction) string {
 	return "bash"
 }
 
-// createShellCommand creates the exec.Cmd with or without sudo
-func (h *Handler) createShellCommand(cmdCtx context.Context, ctx actions.Context, step *config.Step, renderedCommand string) (*exec.Cmd, error) {
+// createShellCommand creates the exec.Cmd with or without sudo, on the target host
+func (h *Handler) createShellCommand(cmdCtx context.Context, ctx actions.Context, step *config.Step, renderedCommand string, env []string, dir string) (*exec.Cmd, error) {
 	interpreter := h.getInterpreter(step.Shell)
 
 	// Get ExecutionContext to access SudoPass
@@ -257,7 +202,7 @@ func (h *Handler) createShellCommand(cmdCtx context.Context, ctx actions.Context
 		args = append(args, "--", interpreter, "-c", renderedCommand)
 
 		// #nosec G204 - This is a provisioning tool designed to execute shell commands
-		command := exec.CommandContext(cmdCtx, "sudo", args...)
+		command := ec.GetTransport().Command(cmdCtx, transport.Cmd{Name: "sudo", Args: args, Env: env, Dir: dir})
 
 		// Handle stdin
 		if step.Shell.Stdin != "" {
@@ -273,7 +218,12 @@ func (h *Handler) createShellCommand(cmdCtx context.Context, ctx actions.Context
 	}
 
 	// #nosec G204 - This is a provisioning tool designed to execute shell commands
-	command := exec.CommandContext(cmdCtx, interpreter, "-c", renderedCommand)
+	command := ec.GetTransport().Command(cmdCtx, transport.Cmd{
+		Name: interpreter,
+		Args: []string{"-c", renderedCommand},
+		Env:  env,
+		Dir:  dir,
+	})
 
 	// Handle stdin for non-sudo commands
 	if step.Shell.Stdin != "" {
@@ -287,31 +237,30 @@ func (h *Handler) createShellCommand(cmdCtx context.Context, ctx actions.Context
 	return command, nil
 }
 
-// configureCommandEnvironment sets environment variables and working directory
-func (h *Handler) configureCommandEnvironment(command *exec.Cmd, ctx actions.Context, step *config.Step) error {
-	// Set environment variables
-	if len(step.Env) > 0 {
-		envVars := os.Environ()
-		for key, value := range step.Env {
-			renderedValue, err := ctx.GetTemplate().Render(value, ctx.GetVariables())
-			if err != nil {
-				return fmt.Errorf("failed to render env var %s: %w", key, err)
-			}
-			envVars = append(envVars, fmt.Sprintf("%s=%s", key, renderedValue))
+// commandEnvironment renders the environment variables added for the command
+// and its working directory
+func (h *Handler) commandEnvironment(ctx actions.Context, step *config.Step) ([]string, string, error) {
+	// Render environment variables
+	var envVars []string
+	for key, value := range step.Env {
+		renderedValue, err := ctx.GetTemplate().Render(value, ctx.GetVariables())
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to render env var %s: %w", key, err)
 		}
-		command.Env = envVars
+		envVars = append(envVars, fmt.Sprintf("%s=%s", key, renderedValue))
 	}
 
-	// Set working directory
+	// Render working directory
+	var dir string
 	if step.Cwd != "" {
 		renderedCwd, err := ctx.GetTemplate().Render(step.Cwd, ctx.GetVariables())
 		if err != nil {
-			return fmt.Errorf("failed to render cwd: %w", err)
+			return nil, "", fmt.Errorf("failed to render cwd: %w", err)
 		}
-		command.Dir = renderedCwd
+		dir = renderedCwd
 	}
 
-	return nil
+	return envVars, dir, nil
 }
 
 // executeAndCaptureOutput runs the command and captures stdout/stderr
@@ -401,7 +350,7 @@ func (h *Handler) streamOutput(pipe io.Reader, buf *bytes.Buffer, ctx actions.Co
 }
 
 // processCommandResult processes the command execution result
-func (h *Handler) processCommandResult(ctx actions.Context, step *config.Step, result *executor.Result, stdout, stderr string, execErr error) (*executor.Result, error) {
+func (h *Handler) processCommandResult(ctx actions.Context, step *config.Step, result *executor.Result, stdout, stderr string, execErr error, reports *sandbox.Reports) (*executor.Result, error) {
 	result.Stdout = stdout
 	result.Stderr = stderr
 
@@ -426,7 +375,7 @@ func (h *Handler) processCommandResult(ctx actions.Context, step *config.Step, r
 
 	// Return error if command failed (after overrides)
 	if result.Failed {
-		return result, fmt.Errorf("command failed with exit code %d", result.Rc)
+		return result, executor.SandboxError(reports, stderr, fmt.Errorf("command failed with exit code %d", result.Rc))
 	}
 
 	return result, nil
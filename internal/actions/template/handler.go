@@ -9,14 +9,15 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"strconv"
 	"time"
 
 	"github.com/alehatsman/mooncake/internal/actions"
 	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/diff"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/transport"
 	"github.com/alehatsman/mooncake/internal/utils"
 )
 
@@ -39,6 +40,7 @@ func (Handler) Metadata() actions.ActionMetadata {
 		Description:        "Render template files and write to destination",
 		Category:           actions.CategoryFile,
 		SupportsDryRun:     true,
+		SupportsRemote:     true,
 		SupportsBecome:     true,
 		EmitsEvents:        []string{string(events.EventTemplateRender)},
 		Version:            "1.0.0",
@@ -95,6 +97,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	if err != nil {
 		return nil, fmt.Errorf("failed to expand dest path: %w", err)
 	}
+	ec.JournalPath(dest, step.Become)
 
 	ctx.GetLogger().Debugf("Templating src=\"%s\" dest=\"%s\"", src, dest)
 
@@ -142,8 +145,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	}
 
 	// Check if content would change
-	// #nosec G304 -- Template destination path from user config is intentional
-	existingContent, err := os.ReadFile(dest)
+	existingContent, err := ec.GetTransport().ReadFile(dest)
 	if err != nil || !bytes.Equal(existingContent, []byte(output)) {
 		result.Changed = true
 	}
@@ -226,8 +228,7 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	}
 
 	// Compare with existing content
-	// #nosec G304 -- Template destination path from user config is intentional
-	existingContent, err := os.ReadFile(dest)
+	existingContent, err := ec.GetTransport().ReadFile(dest)
 	if err != nil {
 		// File doesn't exist - will be created
 		ctx.GetLogger().Infof("  [DRY-RUN] Would create file from template: %s -> %s (size: %d bytes, mode: %s)",
@@ -248,6 +249,58 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	return nil
 }
 
+// Check renders the template and compares it with the destination file.
+func (h *Handler) Check(ctx actions.Context, step *config.Step) (actions.CheckResult, error) {
+	tmpl := step.Template
+
+	ec, ok := ctx.(*executor.ExecutionContext)
+	if !ok {
+		return actions.CheckResult{}, fmt.Errorf("context is not an ExecutionContext")
+	}
+
+	baseDir := ec.CurrentDir
+	if ec.PresetBaseDir != "" {
+		baseDir = ec.PresetBaseDir
+	}
+
+	src, err := ec.PathUtil.ExpandPath(tmpl.Src, baseDir, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to expand src path: %w", err)
+	}
+
+	dest, err := ec.PathUtil.ExpandPath(tmpl.Dest, ec.CurrentDir, ctx.GetVariables())
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to expand dest path: %w", err)
+	}
+
+	variables := ctx.GetVariables()
+	if tmpl.Vars != nil && len(*tmpl.Vars) > 0 {
+		variables = utils.MergeVariables(ctx.GetVariables(), *tmpl.Vars)
+	}
+
+	output, err := h.readAndRenderTemplate(src, ctx, variables, ec)
+	if err != nil {
+		return actions.CheckResult{}, err
+	}
+
+	existingContent, err := ec.GetTransport().ReadFile(dest)
+	if os.IsNotExist(err) {
+		return actions.CheckResult{
+			Changed: true,
+			Diff:    diff.File(dest, nil, []byte(output)),
+			Drift:   actions.ContentDrift(dest, nil, []byte(output)),
+		}, nil
+	}
+	if err != nil {
+		return actions.CheckResult{}, fmt.Errorf("failed to read destination: %w", err)
+	}
+	return actions.CheckResult{
+		Changed: !bytes.Equal(existingContent, []byte(output)),
+		Diff:    diff.File(dest, existingContent, []byte(output)),
+		Drift:   actions.ContentDrift(dest, existingContent, []byte(output)),
+	}, nil
+}
+
 // Helper functions
 
 func (h *Handler) formatMode(mode os.FileMode) string {
@@ -294,22 +347,20 @@ func (h *Handler) readAndRenderTemplate(src string, ctx actions.Context, variabl
 
 func (h *Handler) createFileWithBecome(path string, content []byte, mode os.FileMode, step *config.Step, ec *executor.ExecutionContext) error {
 	if !step.Become {
-		// #nosec G306 -- Mode is user-configurable for provisioning
-		return os.WriteFile(path, content, mode)
+		return ec.GetTransport().WriteFile(path, content, mode)
 	}
 
 	// Use sudo to write file
-	tmpFile, err := os.CreateTemp("", "mooncake-template-*")
+	tmpPath, err := ec.GetTransport().TempFile()
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
-	tmpPath := tmpFile.Name()
 	defer func() {
-		_ = os.Remove(tmpPath)
+		_ = ec.GetTransport().Remove(tmpPath)
 	}()
 
 	// Write content to temp file
-	if err := os.WriteFile(tmpPath, content, 0600); err != nil {
+	if err := ec.GetTransport().WriteFile(tmpPath, content, 0600); err != nil {
 		return fmt.Errorf("failed to write temp file: %w", err)
 	}
 
@@ -318,13 +369,13 @@ func (h *Handler) createFileWithBecome(path string, content []byte, mode os.File
 }
 
 func (h *Handler) executeSudoFileOperation(tmpPath, destPath string, mode os.FileMode, step *config.Step, ec *executor.ExecutionContext) error {
-	cmd := fmt.Sprintf("mv %s %s && chmod %s %s", tmpPath, destPath, h.formatMode(mode), destPath)
+	cmd := fmt.Sprintf("mv %s %s && chmod %s %s", transport.Quote(tmpPath), transport.Quote(destPath), h.formatMode(mode), transport.Quote(destPath))
 	return h.executeSudoCommand(cmd, step, ec)
 }
 
 func (h *Handler) executeSudoCommand(command string, _ *config.Step, ec *executor.ExecutionContext) error {
 	// #nosec G204 - This is a provisioning tool designed to execute commands
-	cmd := exec.Command("sudo", "-S", "sh", "-c", command)
+	cmd := ec.Command("sudo", "-S", "sh", "-c", command)
 	cmd.Stdin = bytes.NewBufferString(ec.SudoPass + "\n")
 
 	var stderr bytes.Buffer
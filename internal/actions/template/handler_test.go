@@ -3,6 +3,7 @@ package template
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/alehatsman/mooncake/internal/actions"
@@ -410,6 +411,52 @@ func TestHandler_Execute_Idempotency(t *testing.T) {
 	}
 }
 
+func TestHandler_Check(t *testing.T) {
+	h := &Handler{}
+	tmpDir := t.TempDir()
+
+	srcPath := filepath.Join(tmpDir, "template.j2")
+	if err := os.WriteFile(srcPath, []byte("port={{ port }}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write template file: %v", err)
+	}
+	destPath := filepath.Join(tmpDir, "app.conf")
+
+	ctx := testutil.NewMockContext()
+	ctx.Variables = map[string]interface{}{"port": 8080}
+	execCtx := newTestExecutionContext(ctx, tmpDir)
+	step := &config.Step{Template: &config.Template{Src: srcPath, Dest: destPath}}
+
+	check, err := h.Check(execCtx, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !check.Changed || !strings.Contains(check.Diff, "--- /dev/null\n+++ "+destPath+"\n") {
+		t.Errorf("Check() = %+v, want a change creating %s", check, destPath)
+	}
+
+	if err := os.WriteFile(destPath, []byte("port=80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check, err = h.Check(execCtx, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if !check.Changed || !strings.Contains(check.Diff, "-port=80\n+port=8080\n") {
+		t.Errorf("Check() = %+v, want a change updating the port", check)
+	}
+
+	if _, err := h.Execute(execCtx, step); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	check, err = h.Check(execCtx, step)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if check.Changed || check.Diff != "" {
+		t.Errorf("Check() after Execute = %+v, want no change", check)
+	}
+}
+
 func TestHandler_Execute_MissingTemplateFile(t *testing.T) {
 	h := &Handler{}
 
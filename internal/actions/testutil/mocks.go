@@ -2,6 +2,7 @@
 package testutil
 
 import (
+	"context"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/expression"
 	"github.com/alehatsman/mooncake/internal/logger"
@@ -45,6 +46,10 @@ func (m *MockContext) GetCurrentStepID() string {
 	return m.StepID
 }
 
+func (m *MockContext) GetContext() context.Context {
+	return context.Background()
+}
+
 func (m *MockContext) GetEvaluator() expression.Evaluator {
 	return expression.NewExprEvaluator()
 }
@@ -25,6 +25,7 @@ import (
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/pathutil"
+	"github.com/alehatsman/mooncake/internal/transport"
 )
 
 const (
@@ -78,6 +79,7 @@ func (Handler) Metadata() actions.ActionMetadata {
 		Description:        "Extract archive files (tar, tar.gz, zip) with path traversal protection",
 		Category:           actions.CategoryFile,
 		SupportsDryRun:     true,
+		SupportsRoot:       true,
 		SupportsBecome:     false,
 		EmitsEvents:        []string{string(events.EventArchiveExtracted)},
 		Version:            "1.0.0",
@@ -135,6 +137,16 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 		}
 	}
 
+	// The archive is read and extracted on this host, under the root in alternate roots
+	hostSrc, err := transport.HostPath(ec.GetTransport(), renderedSrc)
+	if err != nil {
+		return nil, err
+	}
+	hostDest, err := transport.HostPath(ec.GetTransport(), renderedDest)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create result
 	result := executor.NewResult()
 	result.StartTime = time.Now()
@@ -147,14 +159,18 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 
 	// Check idempotency - skip if creates path exists
 	if renderedCreates != "" {
-		if _, statErr := os.Stat(renderedCreates); statErr == nil {
+		hostCreates, err := transport.HostPath(ec.GetTransport(), renderedCreates)
+		if err != nil {
+			return nil, err
+		}
+		if _, statErr := os.Stat(hostCreates); statErr == nil {
 			ctx.GetLogger().Debugf("  Skipping extraction: creates path exists: %s", renderedCreates)
 			return result, nil
 		}
 	}
 
 	// Verify source exists and is a file
-	srcInfo, err := os.Stat(renderedSrc)
+	srcInfo, err := os.Stat(hostSrc)
 	if err != nil {
 		result.Failed = true
 		return result, fmt.Errorf("failed to stat source: %w", err)
@@ -174,7 +190,7 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	// Ensure destination directory exists
 	mode := h.parseFileMode(unarchiveAction.Mode, defaultDirMode)
 	ctx.GetLogger().Debugf("  Ensuring destination directory: %s", renderedDest)
-	if mkdirErr := os.MkdirAll(renderedDest, mode); mkdirErr != nil {
+	if mkdirErr := os.MkdirAll(hostDest, mode); mkdirErr != nil {
 		result.Failed = true
 		return result, fmt.Errorf("failed to create destination directory: %w", mkdirErr)
 	}
@@ -184,11 +200,11 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 	var stats *ExtractionStats
 	switch format {
 	case ArchiveTar:
-		stats, err = h.extractTarArchive(renderedSrc, renderedDest, unarchiveAction.StripComponents, mode, ctx)
+		stats, err = h.extractTarArchive(hostSrc, hostDest, unarchiveAction.StripComponents, mode, ctx)
 	case ArchiveTarGz:
-		stats, err = h.extractTarGzArchive(renderedSrc, renderedDest, unarchiveAction.StripComponents, mode, ctx)
+		stats, err = h.extractTarGzArchive(hostSrc, hostDest, unarchiveAction.StripComponents, mode, ctx)
 	case ArchiveZip:
-		stats, err = h.extractZipArchive(renderedSrc, renderedDest, unarchiveAction.StripComponents, mode, ctx)
+		stats, err = h.extractZipArchive(hostSrc, hostDest, unarchiveAction.StripComponents, mode, ctx)
 	default:
 		result.Failed = true
 		return result, fmt.Errorf("unsupported archive format")
@@ -249,7 +265,11 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 	if unarchiveAction.Creates != "" {
 		renderedCreates, err := ec.PathUtil.ExpandPath(unarchiveAction.Creates, ec.CurrentDir, ctx.GetVariables())
 		if err == nil {
-			if _, statErr := os.Stat(renderedCreates); statErr == nil {
+			hostCreates, err := transport.HostPath(ec.GetTransport(), renderedCreates)
+			if err != nil {
+				return err
+			}
+			if _, statErr := os.Stat(hostCreates); statErr == nil {
 				ctx.GetLogger().Infof("  [DRY-RUN] Would skip extraction: creates path exists: %s", renderedCreates)
 				return nil
 			}
@@ -29,6 +29,7 @@ func (h *Handler) Metadata() actions.ActionMetadata {
 		Description:        "Set variables for use in subsequent steps",
 		Category:           actions.CategoryData,
 		SupportsDryRun:     true,
+		SupportsRemote:     true,
 		SupportsBecome:     false,
 		EmitsEvents:        []string{string(events.EventVarsSet)},
 		Version:            "1.0.0",
@@ -131,12 +131,12 @@ func (h *Handler) Execute(ctx actions.Context, step *config.Step) (actions.Resul
 
 	ec.Logger.Infof("Waiting for condition: %s (timeout: %s, interval: %s)", wait.Condition, timeout, interval)
 
-	// Create timeout context
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), timeoutDuration)
+	// Create timeout context (within the step timeout, if any)
+	timeoutCtx, cancel := context.WithTimeout(ec.GetContext(), timeoutDuration)
 	defer cancel()
 
 	// Create condition checker
-	checker, checkerErr := h.createChecker(wait, ec)
+	checker, checkerErr := h.createChecker(step, wait, ec)
 	if checkerErr != nil {
 		return nil, checkerErr
 	}
@@ -223,7 +223,7 @@ func (h *Handler) DryRun(ctx actions.Context, step *config.Step) error {
 }
 
 // createChecker creates a condition checker function.
-func (h *Handler) createChecker(wait *config.WaitAction, ec *executor.ExecutionContext) (func() (bool, error), error) {
+func (h *Handler) createChecker(step *config.Step, wait *config.WaitAction, ec *executor.ExecutionContext) (func() (bool, error), error) {
 	switch wait.Condition {
 	case conditionFileExists:
 		return h.createFileExistsChecker(*wait.Path, ec, true)
@@ -232,7 +232,7 @@ func (h *Handler) createChecker(wait *config.WaitAction, ec *executor.ExecutionC
 	case conditionGitClean:
 		return h.createGitCleanChecker(wait, ec)
 	case conditionCommand:
-		return h.createCommandChecker(wait, ec)
+		return h.createCommandChecker(step, wait, ec)
 	case conditionHTTP:
 		return h.createHTTPChecker(wait, ec)
 	case conditionPort:
@@ -309,7 +309,7 @@ func (h *Handler) createGitCleanChecker(wait *config.WaitAction, ec *executor.Ex
 	return func() (bool, error) {
 		// Check if we're in a git repository
 		// #nosec G204 -- Git command is controlled and safe
-		checkCmd := exec.Command("git", "rev-parse", "--git-dir")
+		checkCmd := ec.LocalCommand("git", "rev-parse", "--git-dir")
 		checkCmd.Dir = ec.CurrentDir
 		if err := checkCmd.Run(); err != nil {
 			return false, fmt.Errorf("not a git repository: %s", ec.CurrentDir)
@@ -317,7 +317,7 @@ func (h *Handler) createGitCleanChecker(wait *config.WaitAction, ec *executor.Ex
 
 		// Get git status
 		// #nosec G204 -- Git command is controlled and safe
-		statusCmd := exec.Command("git", "status", "--porcelain")
+		statusCmd := ec.LocalCommand("git", "status", "--porcelain")
 		statusCmd.Dir = ec.CurrentDir
 		output, err := statusCmd.CombinedOutput()
 		if err != nil {
@@ -344,7 +344,7 @@ func (h *Handler) createGitCleanChecker(wait *config.WaitAction, ec *executor.Ex
 }
 
 // createCommandChecker creates a command success checker.
-func (h *Handler) createCommandChecker(wait *config.WaitAction, ec *executor.ExecutionContext) (func() (bool, error), error) {
+func (h *Handler) createCommandChecker(step *config.Step, wait *config.WaitAction, ec *executor.ExecutionContext) (func() (bool, error), error) {
 	// Render command with variables
 	cmd, err := ec.Template.Render(*wait.Cmd, ec.Variables)
 	if err != nil {
@@ -359,10 +359,16 @@ func (h *Handler) createCommandChecker(wait *config.WaitAction, ec *executor.Exe
 	return func() (bool, error) {
 		// Execute command
 		// #nosec G204 -- Command from user config is intentional functionality
-		shellCmd := exec.Command("bash", "-c", cmd)
+		shellCmd := ec.LocalCommand("bash", "-c", cmd)
 		shellCmd.Dir = ec.CurrentDir
+		// Run the command in the sandbox of the run, if it has one
+		reports, err := ec.SandboxCommand(step, shellCmd)
+		if err != nil {
+			return false, err
+		}
 
-		err := shellCmd.Run()
+		err = shellCmd.Run()
+		reports.Close()
 		exitCode := 0
 		if err != nil {
 			if exitError, ok := err.(*exec.ExitError); ok {
@@ -395,7 +401,11 @@ func (h *Handler) createHTTPChecker(wait *config.WaitAction, ec *executor.Execut
 	}
 
 	return func() (bool, error) {
-		resp, err := client.Get(url) //nolint:noctx,gosec // Context not available in checker, URL from config is intentional
+		req, err := http.NewRequestWithContext(ec.GetContext(), http.MethodGet, url, nil) // #nosec G107 -- URL from config is intentional
+		if err != nil {
+			return false, err
+		}
+		resp, err := client.Do(req)
 		if err != nil {
 			return false, nil // Don't error, just return false to continue polling
 		}
@@ -28,6 +28,11 @@ func RunLoop(opts RunOptions) (*LoopResult, error) {
 		opts.MaxIterations = defaultMaxIterations
 	}
 
+	box, err := runSandbox(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := llm.NewClient()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Claude client: %w", err)
@@ -95,7 +100,8 @@ func RunLoop(opts RunOptions) (*LoopResult, error) {
 			}, nil
 		}
 
-		tmpFile, err := os.CreateTemp("", "mooncake-plan-*.yml")
+		// In the repo root, so the relative paths of the plan are relative to it
+		tmpFile, err := os.CreateTemp(opts.RepoRoot, ".mooncake-plan-*.yml")
 		if err != nil {
 			return nil, fmt.Errorf("failed to create temp file: %w", err)
 		}
@@ -135,6 +141,8 @@ func RunLoop(opts RunOptions) (*LoopResult, error) {
 		execErr := executor.Start(executor.StartConfig{
 			ConfigFilePath: tmpFile.Name(),
 			DryRun:         false,
+			Policy:         runPolicy(opts),
+			Sandbox:        box,
 		}, log, publisher)
 
 		publisher.Close()
@@ -161,6 +169,7 @@ func RunLoop(opts RunOptions) (*LoopResult, error) {
 		if execErr != nil {
 			iterLog.Status = "execution_failed"
 			iterLog.ExecutionError = execErr.Error()
+			iterLog.FailureReasons = failureReasons(execErr)
 			_, _ = WriteIterationLog(opts.RepoRoot, iterLog)
 			iterations = append(iterations, *iterLog)
 			lastIteration = &IterationSummary{
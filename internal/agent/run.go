@@ -1,14 +1,18 @@
 package agent
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/alehatsman/mooncake/internal/config"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/executor"
 	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/policy"
+	"github.com/alehatsman/mooncake/internal/sandbox"
 	"github.com/alehatsman/mooncake/internal/snapshot"
 )
 
@@ -27,12 +31,18 @@ func Run(opts RunOptions) (*IterationLog, error) {
 
 	planHash := ComputePlanHash(planBytes)
 
+	box, err := runSandbox(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	_, err = snapshot.Collect(opts.RepoRoot)
 	if err != nil {
 		return nil, fmt.Errorf("failed to collect snapshot: %w", err)
 	}
 
-	tmpFile, err := os.CreateTemp("", "mooncake-plan-*.yml")
+	// In the repo root, so the relative paths of the plan are relative to it
+	tmpFile, err := os.CreateTemp(opts.RepoRoot, ".mooncake-plan-*.yml")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -64,6 +74,8 @@ func Run(opts RunOptions) (*IterationLog, error) {
 	execErr := executor.Start(executor.StartConfig{
 		ConfigFilePath: tmpFile.Name(),
 		DryRun:         false,
+		Policy:         runPolicy(opts),
+		Sandbox:        box,
 	}, log, publisher)
 
 	if execErr != nil {
@@ -133,15 +145,69 @@ func stripMarkdownFences(data []byte) []byte {
 	return []byte(content)
 }
 
+// runPolicy returns the policy the plans of an agent run are checked against.
+func runPolicy(opts RunOptions) *policy.Policy {
+	if opts.Policy != nil {
+		return opts.Policy
+	}
+	return policy.ForAgent(opts.RepoRoot)
+}
+
+// runSandbox returns the sandbox of the commands of an agent run, with the
+// repository root writable by default, or nil.
+func runSandbox(opts RunOptions) (*sandbox.Config, error) {
+	if opts.Sandbox == nil {
+		return nil, nil
+	}
+	box := *opts.Sandbox
+	if len(box.Writable) == 0 {
+		root, err := filepath.Abs(opts.RepoRoot)
+		if err == nil {
+			root, err = filepath.EvalSymlinks(root)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the repository root for the sandbox: %w", err)
+		}
+		box.Writable = []string{root}
+	}
+	return &box, nil
+}
+
+// failureReasons returns the sandbox and policy violations that made an
+// execution fail.
+func failureReasons(err error) []FailureReason {
+	var reasons []FailureReason
+	var sandboxErr *sandbox.ViolationError
+	if errors.As(err, &sandboxErr) {
+		reasons = append(reasons, FailureReason{Type: executor.FailureReasonSandbox, Rule: sandboxErr.Kind, Message: sandboxErr.Message})
+	}
+	var policyErr *policy.ViolationError
+	if errors.As(err, &policyErr) {
+		for _, violation := range policyErr.Violations {
+			reasons = append(reasons, FailureReason{Type: executor.FailureReasonPolicy, Rule: violation.Rule, Message: violation.Message})
+		}
+	}
+	// Plans rejected before they run
+	var setupErr *executor.SetupError
+	var validationErr *config.ValidationError
+	if errors.As(err, &setupErr) && setupErr.Component == "policy" && errors.As(setupErr, &validationErr) {
+		for _, diagnostic := range validationErr.Diagnostics {
+			reasons = append(reasons, FailureReason{Type: executor.FailureReasonPolicy, Message: diagnostic.Message})
+		}
+	}
+	return reasons
+}
+
 func writeFailureLog(repoRoot string, iterNum int, goal, planHash string, execErr error) error {
 	log := &IterationLog{
-		Iteration:    iterNum,
-		Goal:         goal,
-		PlanHash:     planHash,
-		Status:       "failed",
-		ChangedFiles: []string{},
-		DiffStat:     DiffStat{},
-		Artifacts:    []string{},
+		Iteration:      iterNum,
+		Goal:           goal,
+		PlanHash:       planHash,
+		Status:         "failed",
+		ChangedFiles:   []string{},
+		DiffStat:       DiffStat{},
+		Artifacts:      []string{},
+		FailureReasons: failureReasons(execErr),
 	}
 
 	if _, err := WriteIterationLog(repoRoot, log); err != nil {
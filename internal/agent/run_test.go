@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	_ "github.com/alehatsman/mooncake/internal/register"
+	"github.com/alehatsman/mooncake/internal/sandbox"
 )
 
 func TestStripMarkdownFences(t *testing.T) {
@@ -49,11 +51,9 @@ func TestStripMarkdownFences(t *testing.T) {
 	}
 }
 
-func TestRunIntegration(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping integration test in short mode")
-	}
-
+// initTestRepo returns a git repository with test.txt committed.
+func initTestRepo(t *testing.T) string {
+	t.Helper()
 	tmpDir := t.TempDir()
 
 	cmd := exec.Command("git", "init")
@@ -74,8 +74,7 @@ func TestRunIntegration(t *testing.T) {
 		t.Fatalf("Failed to config git: %v", err)
 	}
 
-	testFile := filepath.Join(tmpDir, "test.txt")
-	if err := os.WriteFile(testFile, []byte("initial"), 0644); err != nil {
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("initial"), 0644); err != nil {
 		t.Fatalf("Failed to write test file: %v", err)
 	}
 
@@ -91,6 +90,17 @@ func TestRunIntegration(t *testing.T) {
 		t.Fatalf("Failed to git commit: %v", err)
 	}
 
+	return tmpDir
+}
+
+func TestRunIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	tmpDir := initTestRepo(t)
+	testFile := filepath.Join(tmpDir, "test.txt")
+
 	plan := fmt.Sprintf(`- file:
     path: %s
     content: "modified"
@@ -125,3 +135,90 @@ func TestRunIntegration(t *testing.T) {
 		t.Errorf("Iteration log was not created")
 	}
 }
+
+func TestRunEnforcesPolicy(t *testing.T) {
+	tmpDir := initTestRepo(t)
+
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	plan := fmt.Sprintf(`- file:
+    path: inside.txt
+    content: "inside"
+- file:
+    path: %s
+    content: "outside"
+`, outside)
+	planPath := filepath.Join(tmpDir, "plan.yml")
+	if err := os.WriteFile(planPath, []byte(plan), 0644); err != nil {
+		t.Fatalf("Failed to write plan: %v", err)
+	}
+
+	_, err := Run(RunOptions{Goal: "test goal", PlanPath: planPath, RepoRoot: tmpDir})
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Fatalf("Run() error = %v, want a policy violation", err)
+	}
+	for _, path := range []string{outside, filepath.Join(tmpDir, "inside.txt")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was written, want the plan rejected before it runs", path)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, ".mooncake/iterations/00001.json"))
+	if err != nil {
+		t.Fatalf("Failed to read iteration log: %v", err)
+	}
+	var log IterationLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("Failed to parse iteration log: %v", err)
+	}
+	if len(log.FailureReasons) != 1 || log.FailureReasons[0].Type != "policy" {
+		t.Errorf("failure reasons = %+v, want the policy violation", log.FailureReasons)
+	}
+}
+
+func TestRunRecordsSandboxViolations(t *testing.T) {
+	if err := sandbox.Supported(); err != nil {
+		t.Skip(err)
+	}
+	tmpDir := initTestRepo(t)
+
+	// The package directory is outside /tmp, which is private in the sandbox
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(wd, "sandbox-escape.txt")
+	t.Cleanup(func() { _ = os.Remove(outside) })
+	plan := fmt.Sprintf(`- shell: echo inside > %s/inside.txt
+- shell: echo outside > %s
+`, tmpDir, outside)
+	planPath := filepath.Join(tmpDir, "plan.yml")
+	if err := os.WriteFile(planPath, []byte(plan), 0644); err != nil {
+		t.Fatalf("Failed to write plan: %v", err)
+	}
+
+	_, err = Run(RunOptions{Goal: "test goal", PlanPath: planPath, RepoRoot: tmpDir, Sandbox: &sandbox.Config{}})
+	if err != nil && strings.Contains(err.Error(), "failed to set up the sandbox") {
+		t.Skipf("sandbox not available: %v", err)
+	}
+	if err == nil {
+		t.Fatal("Run() succeeded, want the write outside the repository denied")
+	}
+	if _, statErr := os.Stat(outside); !os.IsNotExist(statErr) {
+		t.Error("the file outside the repository was written")
+	}
+	if _, statErr := os.Stat(filepath.Join(tmpDir, "inside.txt")); statErr != nil {
+		t.Errorf("the file in the repository wasn't written: %v", statErr)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, ".mooncake/iterations/00001.json"))
+	if err != nil {
+		t.Fatalf("Failed to read iteration log: %v", err)
+	}
+	var log IterationLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("Failed to parse iteration log: %v", err)
+	}
+	if len(log.FailureReasons) != 1 || log.FailureReasons[0].Type != "sandbox" || log.FailureReasons[0].Rule != sandbox.KindWrite {
+		t.Errorf("failure reasons = %+v, want a sandbox write violation", log.FailureReasons)
+	}
+}
@@ -1,5 +1,10 @@
 package agent
 
+import (
+	"github.com/alehatsman/mooncake/internal/policy"
+	"github.com/alehatsman/mooncake/internal/sandbox"
+)
+
 type Snapshot struct {
 	Branch       string   `json:"branch"`
 	Head         string   `json:"head"`
@@ -21,6 +26,17 @@ type IterationLog struct {
 	ValidationError  string   `json:"validation_error,omitempty"`
 	ExecutionError   string   `json:"execution_error,omitempty"`
 	AssertionsFailed int      `json:"assertions_failed,omitempty"`
+
+	// FailureReasons are the sandbox and policy violations that made the
+	// execution fail.
+	FailureReasons []FailureReason `json:"failure_reasons,omitempty"`
+}
+
+// FailureReason is a violation that made the execution of a plan fail.
+type FailureReason struct {
+	Type    string `json:"type"`           // sandbox or policy
+	Rule    string `json:"rule,omitempty"` // The limit of the sandbox or the rule of the policy
+	Message string `json:"message"`
 }
 
 type DiffStat struct {
@@ -37,6 +53,15 @@ type RunOptions struct {
 	Provider      string
 	Model         string
 	MaxIterations int
+
+	// Policy constrains what the plans may do. Nil uses policy.ForAgent with
+	// RepoRoot.
+	Policy *policy.Policy
+
+	// Sandbox runs the commands of the shell and command steps of the plans
+	// in a sandbox where RepoRoot is writable, unless it sets writable paths.
+	// Nil runs them without one.
+	Sandbox *sandbox.Config
 }
 
 type PlanInput struct {
@@ -0,0 +1,538 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/sinks"
+)
+
+// maxFinishedRuns is the number of finished runs kept in memory, with their
+// events. Older runs are read from the artifacts directory.
+const maxFinishedRuns = 100
+
+// keepAliveInterval is the interval of comments sent on idle event streams, so
+// proxies don't close them.
+const keepAliveInterval = 15 * time.Second
+
+// RunStatus is the status of a run.
+type RunStatus string
+
+// Run statuses.
+const (
+	StatusQueued    RunStatus = "queued"
+	StatusRunning   RunStatus = "running"
+	StatusSucceeded RunStatus = "succeeded"
+	StatusFailed    RunStatus = "failed"
+	StatusCancelled RunStatus = "cancelled"
+	StatusUnknown   RunStatus = "unknown" // Run of the artifacts directory without summary
+)
+
+// RunRequest is the body of POST /v1/runs.
+type RunRequest struct {
+	ConfigRequest
+	Vars      string                 `json:"vars,omitempty"`      // Path of a variables file
+	Variables map[string]interface{} `json:"variables,omitempty"` // Variables, overriding those of the file
+	Tags      []string               `json:"tags,omitempty"`
+	DryRun    bool                   `json:"dry_run,omitempty"`
+	Diff      bool                   `json:"diff,omitempty"` // Emit predicted file changes in a dry run
+	KeepGoing bool                   `json:"keep_going,omitempty"`
+	Timeout   string                 `json:"timeout,omitempty"` // Maximum duration of the run, e.g. "10m"
+}
+
+// Run describes a run: one submitted to the server, or one read from the
+// artifacts directory.
+type Run struct {
+	ID            string                `json:"id"`
+	Status        RunStatus             `json:"status"`
+	DryRun        bool                  `json:"dry_run,omitempty"`
+	SubmittedAt   *time.Time            `json:"submitted_at,omitempty"`
+	StartedAt     *time.Time            `json:"started_at,omitempty"`
+	FinishedAt    *time.Time            `json:"finished_at,omitempty"`
+	Error         string                `json:"error,omitempty"`
+	ResumeCommand string                `json:"resume_command,omitempty"`
+	Summary       *artifacts.RunSummary `json:"summary,omitempty"` // Read from summary.json once finished
+}
+
+// run is a run submitted to the server. Its fields are guarded by Server.mu.
+type run struct {
+	Run
+	request RunRequest
+	config  string // Path of the config file
+	cleanup func() // Removes the inline config, if any
+	cancel  context.CancelCauseFunc
+
+	events  []streamEvent
+	changed chan struct{} // Closed and replaced when events are added or the run finishes
+}
+
+// streamEvent is an event of a run, encoded for event streams.
+type streamEvent struct {
+	Type events.EventType
+	Data []byte
+}
+
+func (r *run) finished() bool {
+	return r.FinishedAt != nil
+}
+
+// notify wakes up the event streams of the run.
+func (r *run) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// Run executes queued runs one at a time until ctx is done. Then the running
+// run is cancelled and queued runs are cancelled without starting.
+func (s *Server) Run(ctx context.Context) error {
+	for {
+		r, runCtx := s.next(ctx)
+		if r == nil {
+			select {
+			case <-s.wake:
+				continue
+			case <-ctx.Done():
+				s.cancelQueued("server shut down")
+				return ctx.Err()
+			}
+		}
+		s.execute(runCtx, r)
+	}
+}
+
+// next marks the oldest queued run as running and returns it with its context,
+// or nil if no run is queued.
+func (s *Server) next(ctx context.Context) (*run, context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+	for _, r := range s.order {
+		if r.Status != StatusQueued {
+			continue
+		}
+		now := time.Now()
+		r.Status, r.StartedAt = StatusRunning, &now
+		runCtx, cancel := context.WithCancelCause(ctx)
+		r.cancel = cancel
+		r.notify()
+		return r, runCtx
+	}
+	return nil, nil
+}
+
+// execute runs r, streaming its events to its subscribers.
+func (s *Server) execute(ctx context.Context, r *run) {
+	var timeout time.Duration
+	if r.request.Timeout != "" {
+		// Checked when the run was submitted
+		timeout, _ = time.ParseDuration(r.request.Timeout)
+	}
+
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(&runStream{server: s, run: r})
+	if len(s.opts.Sinks) > 0 {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "localhost"
+		}
+		publisher.Subscribe(sinks.NewSubscriber(host, s.opts.Sinks...))
+	}
+	err := executor.Start(executor.StartConfig{
+		ConfigFilePath: r.config,
+		VarsFilePath:   r.request.Vars,
+		Vars:           r.request.Variables,
+		Tags:           r.request.Tags,
+		DryRun:         r.request.DryRun,
+		Diff:           r.request.Diff && r.request.DryRun,
+		KeepGoing:      r.request.KeepGoing,
+		Context:        ctx,
+		Timeout:        timeout,
+		SudoPassFile:   s.opts.SudoPassFile,
+		ArtifactsDir:   s.opts.ArtifactsDir,
+		RunID:          r.ID,
+	}, s.opts.Log, publisher)
+	publisher.Flush()
+	publisher.Close()
+
+	summary := artifacts.ReadSummary(artifacts.RunDir(s.opts.ArtifactsDir, r.ID))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.cancel(nil)
+	r.Summary = summary
+	switch {
+	case err == nil:
+		r.Status = StatusSucceeded
+	case errors.As(err, new(*executor.CancelledError)):
+		r.Status = StatusCancelled
+	default:
+		r.Status = StatusFailed
+	}
+	if err != nil {
+		var resumableErr *executor.ResumableError
+		if errors.As(err, &resumableErr) {
+			r.ResumeCommand = resumableErr.ResumeCommand()
+			err = resumableErr.Err
+		}
+		r.Error = err.Error()
+	}
+	s.finishLocked(r)
+}
+
+// finishLocked marks r as finished and forgets the oldest finished runs beyond
+// maxFinishedRuns. s.mu must be held.
+func (s *Server) finishLocked(r *run) {
+	now := time.Now()
+	r.FinishedAt = &now
+	r.cleanup()
+	r.notify()
+
+	finished := 0
+	for i := len(s.order) - 1; i >= 0; i-- {
+		old := s.order[i]
+		if !old.finished() {
+			continue
+		}
+		if finished++; finished > maxFinishedRuns {
+			delete(s.runs, old.ID)
+			s.order = append(s.order[:i], s.order[i+1:]...)
+		}
+	}
+}
+
+// cancelQueued cancels the runs that haven't started.
+func (s *Server) cancelQueued(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.order {
+		if r.Status == StatusQueued {
+			r.Status, r.Error = StatusCancelled, reason
+			s.finishLocked(r)
+		}
+	}
+}
+
+// runStream keeps the events of a run for its event streams.
+type runStream struct {
+	server *Server
+	run    *run
+}
+
+// OnEvent implements events.Subscriber.
+func (rs *runStream) OnEvent(event events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		rs.server.opts.Log.Errorf("Failed to encode event %s: %v", event.Type, err)
+		return
+	}
+	rs.server.mu.Lock()
+	defer rs.server.mu.Unlock()
+	rs.run.events = append(rs.run.events, streamEvent{Type: event.Type, Data: data})
+	rs.run.notify()
+}
+
+// Close implements events.Subscriber.
+func (rs *runStream) Close() {}
+
+func (s *Server) handleSubmitRun(w http.ResponseWriter, r *http.Request) {
+	var req RunRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Timeout != "" {
+		if _, err := time.ParseDuration(req.Timeout); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout: %w", err))
+			return
+		}
+	}
+	if req.Config != "" {
+		if _, err := os.Stat(req.Config); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read config: %w", err))
+			return
+		}
+	}
+	configPath, cleanup, err := req.configFile()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	id, err := newRunID()
+	if err != nil {
+		cleanup()
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	now := time.Now()
+	queued := &run{
+		Run:     Run{ID: id, Status: StatusQueued, DryRun: req.DryRun, SubmittedAt: &now},
+		request: req,
+		config:  configPath,
+		cleanup: cleanup,
+		changed: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.runs[id] = queued
+	s.order = append(s.order, queued)
+	info := queued.Run
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	w.Header().Set("Location", "/v1/runs/"+id)
+	writeJSON(w, http.StatusAccepted, info)
+}
+
+// newRunID returns a run ID in the format of the artifacts directory: the
+// submission time and a random suffix.
+func newRunID() (string, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix), nil
+}
+
+func (s *Server) handleListRuns(w http.ResponseWriter, _ *http.Request) {
+	runs := []Run{}
+	seen := make(map[string]bool)
+	s.mu.Lock()
+	for _, r := range s.order {
+		runs = append(runs, r.Run)
+		seen[r.ID] = true
+	}
+	s.mu.Unlock()
+
+	past, err := artifacts.ListRuns(s.opts.ArtifactsDir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, info := range past {
+		if !seen[info.RunID] {
+			runs = append(runs, describePastRun(info))
+		}
+	}
+	// Run IDs start with their start time
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].ID > runs[j].ID
+	})
+	writeJSON(w, http.StatusOK, map[string][]Run{"runs": runs})
+}
+
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	submitted, ok := s.runs[id]
+	var info Run
+	if ok {
+		info = submitted.Run
+	}
+	s.mu.Unlock()
+	if ok {
+		writeJSON(w, http.StatusOK, info)
+		return
+	}
+	if !s.isPastRun(id) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run not found: %s", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.pastRun(id))
+}
+
+func (s *Server) handleCancelRun(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	submitted, ok := s.runs[id]
+	switch {
+	case !ok:
+		writeError(w, http.StatusNotFound, fmt.Errorf("run not found: %s", id))
+		return
+	case submitted.finished():
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s has already finished", id))
+		return
+	case submitted.Status == StatusQueued:
+		submitted.Status, submitted.Error = StatusCancelled, "cancelled before starting"
+		s.finishLocked(submitted)
+	default:
+		submitted.cancel(fmt.Errorf("cancelled through the API"))
+	}
+	writeJSON(w, http.StatusAccepted, submitted.Run)
+}
+
+// handleRunEvents streams the events of a run with Server-Sent Events: one
+// message per event, with the event type as name and the event as data, then
+// an "end" message with the run. Streams can be resumed with Last-Event-ID.
+func (s *Server) handleRunEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	s.mu.Lock()
+	submitted, ok := s.runs[id]
+	s.mu.Unlock()
+	if !ok && !s.isPastRun(id) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run not found: %s", id))
+		return
+	}
+	flusher, canFlush := w.(http.Flusher)
+	if !canFlush {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	next, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	if next < 0 {
+		next = 0
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if !ok {
+		s.replayEvents(w, id, next)
+		writeSSE(w, "", "end", s.pastRun(id))
+		flusher.Flush()
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		s.mu.Lock()
+		pending := submitted.events[min(next, len(submitted.events)):]
+		done := submitted.finished()
+		changed := submitted.changed
+		info := submitted.Run
+		s.mu.Unlock()
+
+		for _, event := range pending {
+			next++
+			writeSSE(w, strconv.Itoa(next), string(event.Type), json.RawMessage(event.Data))
+		}
+		if done {
+			writeSSE(w, "", "end", info)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// replayEvents streams the events.jsonl file of a past run, skipping the
+// first skip events.
+func (s *Server) replayEvents(w http.ResponseWriter, id string, skip int) {
+	file, err := os.Open(filepath.Join(artifacts.RunDir(s.opts.ArtifactsDir, id), "events.jsonl")) // #nosec G304 -- run ID checked by isPastRun
+	if err != nil {
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxBodyBytes)
+	n := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var event struct {
+			Type events.EventType `json:"type"`
+		}
+		if len(line) == 0 || json.Unmarshal(line, &event) != nil {
+			continue
+		}
+		if n++; n <= skip {
+			continue
+		}
+		writeSSE(w, strconv.Itoa(n), string(event.Type), json.RawMessage(line))
+	}
+}
+
+// writeSSE writes a Server-Sent Events message with v as JSON data.
+func writeSSE(w http.ResponseWriter, id, name string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	if id != "" {
+		_, _ = fmt.Fprintf(w, "id: %s\n", id)
+	}
+	_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
+
+func (s *Server) handleRunArtifact(w http.ResponseWriter, r *http.Request) {
+	id, file := r.PathValue("id"), r.PathValue("file")
+	if !s.isPastRun(id) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run not found: %s", id))
+		return
+	}
+	if !filepath.IsLocal(file) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid artifact path: %s", file))
+		return
+	}
+	path := filepath.Join(artifacts.RunDir(s.opts.ArtifactsDir, id), filepath.FromSlash(file))
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		writeError(w, http.StatusNotFound, fmt.Errorf("artifact not found: %s", file))
+		return
+	}
+	if strings.HasSuffix(path, ".jsonl") {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	http.ServeFile(w, r, path)
+}
+
+// isPastRun reports whether id is a run of the artifacts directory.
+func (s *Server) isPastRun(id string) bool {
+	if id == "" || !filepath.IsLocal(id) || strings.ContainsAny(id, `/\`) {
+		return false
+	}
+	info, err := os.Stat(artifacts.RunDir(s.opts.ArtifactsDir, id))
+	return err == nil && info.IsDir()
+}
+
+// pastRun describes a run of the artifacts directory.
+func (s *Server) pastRun(id string) Run {
+	return describePastRun(artifacts.RunInfo{RunID: id, Summary: artifacts.ReadSummary(artifacts.RunDir(s.opts.ArtifactsDir, id))})
+}
+
+// describePastRun describes a run of the artifacts directory from its summary.
+func describePastRun(past artifacts.RunInfo) Run {
+	info := Run{ID: past.RunID, Status: StatusUnknown, Summary: past.Summary}
+	if info.Summary != nil {
+		info.Status = StatusFailed
+		if info.Summary.Success {
+			info.Status = StatusSucceeded
+		}
+		info.StartedAt, info.FinishedAt = &info.Summary.StartTime, &info.Summary.EndTime
+		info.Error = info.Summary.ErrorMessage
+	}
+	return info
+}
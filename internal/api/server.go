@@ -0,0 +1,280 @@
+// Package api serves mooncake over a local HTTP API: validate and plan configs,
+// queue runs and stream their events with Server-Sent Events, and read the runs
+// of the artifacts directory.
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/facts"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/sinks"
+	"github.com/alehatsman/mooncake/internal/utils"
+	"github.com/alehatsman/mooncake/internal/version"
+)
+
+// maxBodyBytes limits the size of request bodies.
+const maxBodyBytes = 10 << 20
+
+// Options configures a Server.
+type Options struct {
+	// Token authenticates requests, sent as "Authorization: Bearer <token>".
+	// Required.
+	Token string
+
+	// ArtifactsDir is where runs save their artifacts, and where past runs are
+	// read from (default: artifacts.DefaultBaseDir).
+	ArtifactsDir string
+
+	// SudoPassFile is the sudo password file of runs with become steps.
+	SudoPassFile string
+
+	// Log receives the logs of plans and runs. Nil discards them.
+	Log logger.Logger
+
+	// Sinks receive the events of runs, in addition to the event streams of the
+	// API. They are not closed by the server.
+	Sinks []sinks.Sink
+}
+
+// Server is the HTTP API. Requests are handled concurrently; runs are queued
+// and executed one at a time by Run.
+type Server struct {
+	opts Options
+
+	mu    sync.Mutex
+	runs  map[string]*run // Runs submitted to this server, by ID
+	order []*run          // Runs submitted to this server, oldest first
+	wake  chan struct{}   // Signals a queued run to the worker
+}
+
+// ConfigRequest identifies the config of a request: the path of a config file
+// on the server, or the YAML of a config, which can't include files by
+// relative path.
+type ConfigRequest struct {
+	Config     string `json:"config,omitempty"`
+	ConfigYAML string `json:"config_yaml,omitempty"`
+}
+
+// PlanRequest is the body of POST /v1/plan.
+type PlanRequest struct {
+	ConfigRequest
+	Vars      string                 `json:"vars,omitempty"`      // Path of a variables file
+	Variables map[string]interface{} `json:"variables,omitempty"` // Variables, overriding those of the file
+	Tags      []string               `json:"tags,omitempty"`
+	Diff      bool                   `json:"diff,omitempty"` // Dry-run the plan to predict its file changes
+}
+
+// ValidateResult is the response of POST /v1/validate, as printed by
+// mooncake validate --format json.
+type ValidateResult struct {
+	Valid       bool                `json:"valid"`
+	Diagnostics []config.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// PlanResult is the response of POST /v1/plan.
+type PlanResult struct {
+	Plan *plan.Plan `json:"plan"`
+
+	// Changes are the file changes a run would make, predicted by a dry run (diff only)
+	Changes []events.StepDiffData `json:"changes,omitempty"`
+
+	// Summary is the summary of the dry run (diff only)
+	Summary *events.RunCompletedData `json:"summary,omitempty"`
+}
+
+// NewServer returns a server with the given options.
+func NewServer(opts Options) (*Server, error) {
+	if opts.Token == "" {
+		return nil, fmt.Errorf("an API token is required")
+	}
+	if opts.ArtifactsDir == "" {
+		opts.ArtifactsDir = artifacts.DefaultBaseDir
+	}
+	if opts.Log == nil {
+		opts.Log = logger.NewTestLogger()
+	}
+	return &Server{opts: opts, runs: make(map[string]*run), wake: make(chan struct{}, 1)}, nil
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/health", s.handleHealth)
+	mux.Handle("GET /v1/facts", s.authenticated(s.handleFacts))
+	mux.Handle("POST /v1/validate", s.authenticated(s.handleValidate))
+	mux.Handle("POST /v1/plan", s.authenticated(s.handlePlan))
+	mux.Handle("POST /v1/runs", s.authenticated(s.handleSubmitRun))
+	mux.Handle("GET /v1/runs", s.authenticated(s.handleListRuns))
+	mux.Handle("GET /v1/runs/{id}", s.authenticated(s.handleGetRun))
+	mux.Handle("POST /v1/runs/{id}/cancel", s.authenticated(s.handleCancelRun))
+	mux.Handle("GET /v1/runs/{id}/events", s.authenticated(s.handleRunEvents))
+	mux.Handle("GET /v1/runs/{id}/artifacts/{file...}", s.authenticated(s.handleRunArtifact))
+	return mux
+}
+
+// authenticated requires the API token, as a bearer token or, for GET requests
+// such as browser EventSource streams, as the access_token query parameter.
+func (s *Server) authenticated(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && r.Method == http.MethodGet {
+			token = r.URL.Query().Get("access_token")
+		}
+		if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mooncake"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid or missing API token"))
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "version": version.Version})
+}
+
+func (s *Server) handleFacts(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, facts.Collect())
+}
+
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	var req ConfigRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	configPath, cleanup, err := req.configFile()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cleanup()
+
+	_, diagnostics, err := config.ReadConfigWithValidation(configPath)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read config: %w", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, ValidateResult{Valid: !config.HasErrors(diagnostics), Diagnostics: diagnostics})
+}
+
+func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
+	defer security.BeginRun()()
+
+	var req PlanRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	configPath, cleanup, err := req.configFile()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer cleanup()
+
+	variables := make(map[string]interface{})
+	if req.Vars != "" {
+		if variables, err = config.ReadVariables(req.Vars); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to read variables: %w", err))
+			return
+		}
+	}
+	planner, err := plan.NewPlanner()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	planData, err := planner.BuildPlan(plan.PlannerConfig{
+		ConfigPath: configPath,
+		Variables:  utils.MergeVariables(variables, req.Variables),
+		Tags:       req.Tags,
+		VarsPath:   req.Vars,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to build plan: %w", err))
+		return
+	}
+
+	result := &PlanResult{Plan: planData.Redact()}
+	if req.Diff {
+		recorder := &events.Recorder{}
+		publisher := events.NewSyncPublisher()
+		publisher.Subscribe(recorder)
+		err := executor.ExecutePlanWithOptions(planData, executor.PlanOptions{DryRun: true, Diff: true, Context: r.Context()}, s.opts.Log, publisher)
+		publisher.Close()
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, fmt.Errorf("dry run failed: %w", err))
+			return
+		}
+		result.Changes, result.Summary = recorder.Diffs, recorder.Summary
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// configFile returns the path of the config file of a request. Inline configs
+// are written to a temporary directory, removed by cleanup.
+func (c ConfigRequest) configFile() (path string, cleanup func(), err error) {
+	switch {
+	case c.Config != "" && c.ConfigYAML != "":
+		return "", nil, fmt.Errorf("config and config_yaml are mutually exclusive")
+	case c.Config != "":
+		return c.Config, func() {}, nil
+	case c.ConfigYAML == "":
+		return "", nil, fmt.Errorf("config or config_yaml is required")
+	}
+
+	dir, err := os.MkdirTemp("", "mooncake-api-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { _ = os.RemoveAll(dir) }
+	path = filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(c.ConfigYAML), 0600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
+
+// readJSON decodes a JSON request body, rejecting unknown fields.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return fmt.Errorf("request body larger than %d bytes", maxBodyBytes)
+		}
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(v)
+}
+
+// writeError writes an error response: {"error": "..."}.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,403 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/events"
+	_ "github.com/alehatsman/mooncake/internal/register" // Register action handlers
+	"github.com/alehatsman/mooncake/internal/sinks"
+)
+
+const testToken = "test-token"
+
+// startServer starts a server with its worker, stopped at the end of the test.
+// The token of opts is testToken.
+func startServer(t *testing.T, opts Options) *httptest.Server {
+	t.Helper()
+	opts.Token = testToken
+	server, err := NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = server.Run(ctx)
+	}()
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		ts.Close()
+	})
+	return ts
+}
+
+// call sends a request with the test token and decodes the JSON response into
+// v, if not nil.
+func call(t *testing.T, ts *httptest.Server, method, path string, body, v interface{}) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil {
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("%s %s: invalid response %s: %v", method, path, data, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// sseMessage is a Server-Sent Events message.
+type sseMessage struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// streamEvents reads the event stream of a run until its end message.
+func streamEvents(t *testing.T, ts *httptest.Server, id, lastEventID string) []sseMessage {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/runs/"+id+"/events?access_token="+testToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("events status = %d, content type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	var messages []sseMessage
+	var msg sseMessage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if msg.Event != "" {
+				messages = append(messages, msg)
+				if msg.Event == "end" {
+					return messages
+				}
+			}
+			msg = sseMessage{}
+		case strings.HasPrefix(line, "id: "):
+			msg.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			msg.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("event stream of %s ended without end message: %v", id, scanner.Err())
+	return nil
+}
+
+// waitRun waits until a run has finished.
+func waitRun(t *testing.T, ts *httptest.Server, id string) Run {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var info Run
+		if status := call(t, ts, http.MethodGet, "/v1/runs/"+id, nil, &info); status != http.StatusOK {
+			t.Fatalf("GET run status = %d", status)
+		}
+		if info.FinishedAt != nil {
+			return info
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("run %s didn't finish", id)
+	return Run{}
+}
+
+func TestNewServer(t *testing.T) {
+	if _, err := NewServer(Options{}); err == nil {
+		t.Error("NewServer() without token succeeded")
+	}
+}
+
+func TestHandler_Auth(t *testing.T) {
+	ts := startServer(t, Options{ArtifactsDir: t.TempDir()})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header string
+		want   int
+	}{
+		{"health without token", http.MethodGet, "/v1/health", "", http.StatusOK},
+		{"no token", http.MethodGet, "/v1/runs", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/v1/runs", "Bearer wrong", http.StatusUnauthorized},
+		{"bearer token", http.MethodGet, "/v1/runs", "Bearer " + testToken, http.StatusOK},
+		{"query token", http.MethodGet, "/v1/runs?access_token=" + testToken, "", http.StatusOK},
+		{"query token on POST", http.MethodPost, "/v1/runs?access_token=" + testToken, "", http.StatusUnauthorized},
+		{"unknown path", http.MethodGet, "/v1/nothing", "Bearer " + testToken, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_ValidateAndPlan(t *testing.T) {
+	ts := startServer(t, Options{ArtifactsDir: t.TempDir()})
+	tmpDir := t.TempDir()
+
+	var facts map[string]interface{}
+	if status := call(t, ts, http.MethodGet, "/v1/facts", nil, &facts); status != http.StatusOK || facts["OS"] == nil {
+		t.Errorf("facts = %d, %v", status, facts)
+	}
+
+	var valid ValidateResult
+	if status := call(t, ts, http.MethodPost, "/v1/validate", map[string]string{"config_yaml": "- name: greet\n  print: hello\n"}, &valid); status != http.StatusOK || !valid.Valid {
+		t.Errorf("validate = %d, %+v", status, valid)
+	}
+	var invalid ValidateResult
+	if status := call(t, ts, http.MethodPost, "/v1/validate", map[string]string{"config_yaml": "- name: bad\n  shell: echo\n  print: hi\n"}, &invalid); status != http.StatusOK || invalid.Valid || len(invalid.Diagnostics) == 0 {
+		t.Errorf("validate invalid = %d, %+v", status, invalid)
+	}
+
+	badRequests := []interface{}{
+		map[string]string{},
+		map[string]string{"config": "a.yml", "config_yaml": "[]"},
+		map[string]string{"config_yaml": "[]", "unknown": "field"},
+	}
+	for _, body := range badRequests {
+		var resp map[string]string
+		if status := call(t, ts, http.MethodPost, "/v1/validate", body, &resp); status != http.StatusBadRequest || resp["error"] == "" {
+			t.Errorf("validate %v = %d, %v", body, status, resp)
+		}
+	}
+
+	target := filepath.Join(tmpDir, "greeting.txt")
+	var result PlanResult
+	status := call(t, ts, http.MethodPost, "/v1/plan", PlanRequest{
+		ConfigRequest: ConfigRequest{ConfigYAML: "- name: write\n  file:\n    path: " + target + "\n    content: \"{{ greeting }}\"\n"},
+		Variables:     map[string]interface{}{"greeting": "hi"},
+		Diff:          true,
+	}, &result)
+	if status != http.StatusOK || result.Plan == nil || len(result.Plan.Steps) != 1 {
+		t.Fatalf("plan = %d, %+v", status, result)
+	}
+	if len(result.Changes) != 1 || !strings.Contains(result.Changes[0].Diff, "hi") || result.Summary == nil {
+		t.Errorf("plan changes = %+v, summary = %+v", result.Changes, result.Summary)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("plan created %s", target)
+	}
+
+	var planErr map[string]string
+	if status := call(t, ts, http.MethodPost, "/v1/plan", map[string]string{"config": filepath.Join(tmpDir, "missing.yml")}, &planErr); status != http.StatusBadRequest {
+		t.Errorf("plan of a missing config = %d, %v", status, planErr)
+	}
+}
+
+func TestHandler_Runs(t *testing.T) {
+	artifactsDir := t.TempDir()
+	tmpDir := t.TempDir()
+	ts := startServer(t, Options{ArtifactsDir: artifactsDir})
+
+	target := filepath.Join(tmpDir, "greeting.txt")
+	configPath := filepath.Join(tmpDir, "config.yml")
+	config := "- name: wait\n  shell: sleep 0.3\n- name: write\n  file:\n    path: " + target + "\n    content: hello\n"
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var first, second Run
+	if status := call(t, ts, http.MethodPost, "/v1/runs", RunRequest{ConfigRequest: ConfigRequest{Config: configPath}}, &first); status != http.StatusAccepted || first.Status != StatusQueued {
+		t.Fatalf("submit = %d, %+v", status, first)
+	}
+	if status := call(t, ts, http.MethodPost, "/v1/runs", RunRequest{ConfigRequest: ConfigRequest{ConfigYAML: "- name: fail\n  shell: exit 3\n"}}, &second); status != http.StatusAccepted {
+		t.Fatalf("submit second = %d, %+v", status, second)
+	}
+
+	// Plans can be made while a run is in progress
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result PlanResult
+			if status := call(t, ts, http.MethodPost, "/v1/plan", map[string]string{"config": configPath}, &result); status != http.StatusOK {
+				t.Errorf("concurrent plan = %d", status)
+			}
+		}()
+	}
+
+	messages := streamEvents(t, ts, first.ID, "")
+	wg.Wait()
+	var types []string
+	for _, msg := range messages {
+		types = append(types, msg.Event)
+	}
+	if types[0] != "run.started" || !strings.Contains(strings.Join(types, " "), "step.completed") || types[len(types)-1] != "end" {
+		t.Errorf("event types = %v", types)
+	}
+	var end Run
+	if err := json.Unmarshal([]byte(messages[len(messages)-1].Data), &end); err != nil || end.Status != StatusSucceeded {
+		t.Errorf("end = %+v, %v", end, err)
+	}
+
+	// The second run only starts after the first
+	secondInfo := waitRun(t, ts, second.ID)
+	if secondInfo.Status != StatusFailed || secondInfo.Error == "" || secondInfo.StartedAt.Before(*end.FinishedAt) {
+		t.Errorf("second run = %+v, first finished at %v", secondInfo, end.FinishedAt)
+	}
+	if content, err := os.ReadFile(target); err != nil || string(content) != "hello" {
+		t.Errorf("run output = %q, %v", content, err)
+	}
+
+	firstInfo := waitRun(t, ts, first.ID)
+	if firstInfo.Summary == nil || !firstInfo.Summary.Success || firstInfo.Summary.RunID != first.ID {
+		t.Errorf("first run summary = %+v", firstInfo.Summary)
+	}
+
+	// Resuming a stream only sends later events
+	resumed := streamEvents(t, ts, first.ID, messages[1].ID)
+	if len(resumed) != len(messages)-2 {
+		t.Errorf("resumed stream has %d messages, want %d", len(resumed), len(messages)-2)
+	}
+
+	var summary map[string]interface{}
+	if status := call(t, ts, http.MethodGet, "/v1/runs/"+first.ID+"/artifacts/summary.json", nil, &summary); status != http.StatusOK || summary["run_id"] != first.ID {
+		t.Errorf("summary artifact = %d, %v", status, summary)
+	}
+	if status := call(t, ts, http.MethodGet, "/v1/runs/"+first.ID+"/artifacts/..%2F..%2Fsecret", nil, nil); status == http.StatusOK {
+		t.Error("artifact outside the run directory was served")
+	}
+
+	// A new server reads past runs from the artifacts directory
+	restarted := startServer(t, Options{ArtifactsDir: artifactsDir})
+	var list struct {
+		Runs []Run `json:"runs"`
+	}
+	if status := call(t, restarted, http.MethodGet, "/v1/runs", nil, &list); status != http.StatusOK || len(list.Runs) != 2 {
+		t.Fatalf("runs = %d, %+v", status, list)
+	}
+	var past Run
+	if status := call(t, restarted, http.MethodGet, "/v1/runs/"+first.ID, nil, &past); status != http.StatusOK || past.Status != StatusSucceeded || past.Summary == nil {
+		t.Errorf("past run = %d, %+v", status, past)
+	}
+	replayed := streamEvents(t, restarted, first.ID, "")
+	if len(replayed) != len(messages) || replayed[0].Event != "run.started" || replayed[0].ID != "1" {
+		t.Errorf("replayed %d messages, want %d: %+v", len(replayed), len(messages), replayed[0])
+	}
+	if status := call(t, restarted, http.MethodGet, "/v1/runs/missing", nil, nil); status != http.StatusNotFound {
+		t.Errorf("missing run = %d", status)
+	}
+}
+
+func TestHandler_CancelRun(t *testing.T) {
+	ts := startServer(t, Options{ArtifactsDir: t.TempDir()})
+
+	var running, queued Run
+	call(t, ts, http.MethodPost, "/v1/runs", RunRequest{ConfigRequest: ConfigRequest{ConfigYAML: "- name: wait\n  shell: sleep 10\n"}}, &running)
+	call(t, ts, http.MethodPost, "/v1/runs", RunRequest{ConfigRequest: ConfigRequest{ConfigYAML: "- name: greet\n  print: hello\n"}}, &queued)
+
+	var cancelled Run
+	if status := call(t, ts, http.MethodPost, "/v1/runs/"+queued.ID+"/cancel", nil, &cancelled); status != http.StatusAccepted || cancelled.Status != StatusCancelled {
+		t.Errorf("cancel queued = %d, %+v", status, cancelled)
+	}
+	if status := call(t, ts, http.MethodPost, "/v1/runs/"+queued.ID+"/cancel", nil, nil); status != http.StatusConflict {
+		t.Errorf("cancel finished = %d", status)
+	}
+
+	// Wait for the first run to start before cancelling it
+	deadline := time.Now().Add(5 * time.Second)
+	for info := (Run{}); info.Status != StatusRunning && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		call(t, ts, http.MethodGet, "/v1/runs/"+running.ID, nil, &info)
+	}
+	if status := call(t, ts, http.MethodPost, "/v1/runs/"+running.ID+"/cancel", nil, nil); status != http.StatusAccepted {
+		t.Errorf("cancel running = %d", status)
+	}
+	if info := waitRun(t, ts, running.ID); info.Status != StatusCancelled {
+		t.Errorf("cancelled run = %+v", info)
+	}
+	if status := call(t, ts, http.MethodPost, "/v1/runs/missing/cancel", nil, nil); status != http.StatusNotFound {
+		t.Errorf("cancel missing = %d", status)
+	}
+}
+
+func TestHandler_RunSinks(t *testing.T) {
+	eventsFile := filepath.Join(t.TempDir(), "run.jsonl")
+	sink, err := sinks.NewFileSink(eventsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sink.Close() }()
+	ts := startServer(t, Options{ArtifactsDir: t.TempDir(), Sinks: []sinks.Sink{sink}})
+
+	var submitted Run
+	if status := call(t, ts, http.MethodPost, "/v1/runs", RunRequest{ConfigRequest: ConfigRequest{ConfigYAML: "- name: greet\n  print: hello\n"}}, &submitted); status != http.StatusAccepted {
+		t.Fatalf("submit = %d, %+v", status, submitted)
+	}
+	waitRun(t, ts, submitted.ID)
+
+	data, err := os.ReadFile(eventsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first events.Record
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Type != events.EventRunStarted || first.RunID != submitted.ID {
+		t.Errorf("first record = %+v, %v, want run.started of run %s", first, err, submitted.ID)
+	}
+}
@@ -0,0 +1,81 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+const (
+	// DefaultBaseDir is the artifacts directory used to resume runs when none is given.
+	DefaultBaseDir = ".mooncake"
+
+	// PlanFile is the name of the plan file in a run directory.
+	PlanFile = "plan.json"
+
+	// CheckpointFile is the name of the checkpoint file in a run directory.
+	CheckpointFile = "checkpoint.json"
+)
+
+// Checkpoint records the progress of a run so a later run can resume it.
+type Checkpoint struct {
+	RunID        string                 `json:"run_id"`
+	PlanHash     string                 `json:"plan_hash"`                // Hash of the plan the run executed (see plan.Plan.Hash)
+	Completed    []string               `json:"completed"`                // IDs of the top-level steps that finished, in order
+	Variables    map[string]interface{} `json:"variables,omitempty"`      // Results registered by the completed steps
+	Handlers     []string               `json:"handlers,omitempty"`       // Notified handlers that haven't run yet
+	FailedStepID string                 `json:"failed_step_id,omitempty"` // First step that failed, if any
+	Redacted     bool                   `json:"redacted,omitempty"`       // Secrets were redacted from Variables
+	UpdatedAt    time.Time              `json:"updated_at"`
+}
+
+// RunDir returns the directory of a run inside the artifacts base directory.
+func RunDir(baseDir, runID string) string {
+	return filepath.Join(baseDir, "runs", runID)
+}
+
+// SaveCheckpoint writes the checkpoint to the run directory.
+// The file is replaced atomically, so an interrupted write keeps the previous checkpoint.
+// Registered secrets are redacted from the variables, and the saved checkpoint
+// is marked Redacted: its variables can't be restored, so it can't be resumed.
+func SaveCheckpoint(runDir string, checkpoint *Checkpoint) error {
+	saved := *checkpoint
+	saved.Variables, saved.Redacted = security.RedactValue(checkpoint.Variables)
+	data, err := json.MarshalIndent(&saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	path := filepath.Join(runDir, CheckpointFile)
+	tmpPath := path + ".tmp"
+	// #nosec G306 -- Artifact files are intentionally readable
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// LoadCheckpoint reads the checkpoint of a run directory.
+func LoadCheckpoint(runDir string) (*Checkpoint, error) {
+	// #nosec G304 -- Artifact file path is intentional functionality
+	data, err := os.ReadFile(filepath.Join(runDir, CheckpointFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no checkpoint in %s (was the run started with --artifacts-dir?)", runDir)
+		}
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+	return &checkpoint, nil
+}
@@ -0,0 +1,103 @@
+package artifacts
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+func TestSaveLoadCheckpoint(t *testing.T) {
+	runDir := t.TempDir()
+
+	checkpoint := &Checkpoint{
+		RunID:        "20260101-120000-abcdef",
+		PlanHash:     "1234",
+		Completed:    []string{"step-0001", "step-0002"},
+		Variables:    map[string]interface{}{"go_version": map[string]interface{}{"rc": float64(0)}},
+		Handlers:     []string{"restart"},
+		FailedStepID: "step-0003",
+		UpdatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+
+	if err := SaveCheckpoint(runDir, checkpoint); err != nil {
+		t.Fatalf("SaveCheckpoint failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, CheckpointFile+".tmp")); !os.IsNotExist(err) {
+		t.Error("temporary checkpoint file should be renamed")
+	}
+
+	loaded, err := LoadCheckpoint(runDir)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, checkpoint) {
+		t.Errorf("LoadCheckpoint = %+v, want %+v", loaded, checkpoint)
+	}
+}
+
+func TestSaveCheckpoint_RedactsSecrets(t *testing.T) {
+	t.Cleanup(security.ResetSecrets)
+	security.RegisterSecret("checkpoint-secret-token")
+	runDir := t.TempDir()
+
+	checkpoint := &Checkpoint{
+		RunID:     "20260101-120000-abcdef",
+		Variables: map[string]interface{}{"token": map[string]interface{}{"stdout": "checkpoint-secret-token"}},
+	}
+	if err := SaveCheckpoint(runDir, checkpoint); err != nil {
+		t.Fatalf("SaveCheckpoint failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(runDir, CheckpointFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "checkpoint-secret-token") || !strings.Contains(string(data), "[REDACTED]") {
+		t.Errorf("checkpoint should have the secret redacted:\n%s", data)
+	}
+	if loaded, err := LoadCheckpoint(runDir); err != nil || !loaded.Redacted {
+		t.Errorf("LoadCheckpoint = %+v, %v, want a checkpoint marked redacted", loaded, err)
+	}
+	if checkpoint.Variables["token"].(map[string]interface{})["stdout"] != "checkpoint-secret-token" {
+		t.Error("SaveCheckpoint modified the checkpoint")
+	}
+}
+
+func TestLoadCheckpoint_Missing(t *testing.T) {
+	_, err := LoadCheckpoint(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "no checkpoint") {
+		t.Errorf("LoadCheckpoint error = %v, want missing checkpoint error", err)
+	}
+}
+
+func TestNewWriter_UniqueRunDir(t *testing.T) {
+	cfg := Config{BaseDir: t.TempDir()}
+
+	first, err := NewWriter(cfg, createTestPlan(), createTestFacts())
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	defer first.Close()
+
+	// Same plan and host within the same second
+	second, err := NewWriter(cfg, createTestPlan(), createTestFacts())
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	defer second.Close()
+
+	if !strings.HasPrefix(second.RunID(), first.RunID()) {
+		t.Skip("runs started in different seconds")
+	}
+	if second.RunID() != first.RunID()+"-2" {
+		t.Errorf("second RunID = %q, want %q", second.RunID(), first.RunID()+"-2")
+	}
+	if second.RunDir() != RunDir(cfg.BaseDir, second.RunID()) {
+		t.Errorf("RunDir = %q, want it to match RunID", second.RunDir())
+	}
+}
@@ -0,0 +1,369 @@
+package artifacts
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournalFile is the name of the change journal in a run directory.
+const JournalFile = "journal.jsonl"
+
+// NoJournalFile records why a run directory has no change journal.
+const NoJournalFile = "no-journal"
+
+// MaxJournalContent is the largest file whose content is kept in the journal.
+// Larger files are recorded by hash only, so their changes can't be undone.
+const MaxJournalContent = 16 << 20
+
+// Journal entry kinds
+const (
+	EntryFile       = "file"       // A path was created, changed or removed
+	EntryPackage    = "package"    // A package was installed or removed
+	EntryService    = "service"    // A service was started, stopped, enabled or disabled
+	EntryUnrecorded = "unrecorded" // A step changed something the journal can't record
+)
+
+// File types of a FileState
+const (
+	FileAbsent  = "absent"
+	FileRegular = "file"
+	FileDir     = "dir"
+	FileSymlink = "symlink"
+	FileOther   = "other" // Devices, sockets and paths that couldn't be read
+)
+
+// FileState is the state of a path before or after a step changed it.
+type FileState struct {
+	Type    string      `json:"type"`
+	Mode    os.FileMode `json:"mode,omitempty"`    // Permission bits
+	Size    int64       `json:"size,omitempty"`    // Size of a regular file
+	SHA256  string      `json:"sha256,omitempty"`  // Hash of a regular file's content
+	Content []byte      `json:"content,omitempty"` // Content of a regular file, kept in before states
+	Target  string      `json:"target,omitempty"`  // Target of a symlink
+}
+
+// Restorable reports whether a path can be put back in this state.
+func (s *FileState) Restorable() bool {
+	switch s.Type {
+	case FileAbsent, FileDir, FileSymlink:
+		return true
+	case FileRegular:
+		return s.SHA256 != "" && (s.Content != nil || s.Size == 0)
+	}
+	return false
+}
+
+// Matches reports whether two states are the same, ignoring kept content.
+func (s *FileState) Matches(other *FileState) bool {
+	if s.Type != other.Type {
+		return false
+	}
+	switch s.Type {
+	case FileRegular:
+		return s.Mode == other.Mode && s.SHA256 == other.SHA256 && s.SHA256 != ""
+	case FileDir:
+		return s.Mode == other.Mode
+	case FileSymlink:
+		return s.Target == other.Target
+	case FileOther:
+		return false
+	}
+	return true
+}
+
+// PackageChange is a package installed or removed by a step.
+type PackageChange struct {
+	Manager   string `json:"manager"`
+	Name      string `json:"name"`
+	Installed bool   `json:"installed"` // Whether the step installed (true) or removed (false) the package
+}
+
+// ServiceChange is a change of a service's state by a step. Only the fields
+// the step changed are set.
+type ServiceChange struct {
+	Name       string `json:"name"`
+	WasActive  *bool  `json:"was_active,omitempty"`
+	WasEnabled *bool  `json:"was_enabled,omitempty"`
+}
+
+// JournalEntry is one change recorded in the journal of a run.
+type JournalEntry struct {
+	Kind     string         `json:"kind"`
+	StepID   string         `json:"step_id"`
+	StepName string         `json:"step_name,omitempty"`
+	Action   string         `json:"action,omitempty"`
+	Become   bool           `json:"become,omitempty"` // The change was made with sudo
+	Path     string         `json:"path,omitempty"`
+	Before   *FileState     `json:"before,omitempty"`
+	After    *FileState     `json:"after,omitempty"`
+	Package  *PackageChange `json:"package,omitempty"`
+	Service  *ServiceChange `json:"service,omitempty"`
+	Time     time.Time      `json:"time"`
+}
+
+// Journal records the changes a run makes, so `mooncake undo` can revert them.
+//
+// Handlers record the state of a path before they change it. When the step
+// finishes, Commit records the state the step left each path in and appends
+// the entries to the journal file. The file holds the previous content of
+// changed files, so it is only readable by its owner.
+//
+// A nil Journal records nothing.
+type Journal struct {
+	mu      sync.Mutex
+	file    *os.File
+	pending map[string][]JournalEntry // By step ID
+}
+
+// OpenJournal creates the journal of the run directory, or appends to an existing one.
+func OpenJournal(runDir string) (*Journal, error) {
+	// #nosec G304 -- Artifact file path is intentional functionality
+	file, err := os.OpenFile(filepath.Join(runDir, JournalFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	return &Journal{file: file, pending: make(map[string][]JournalEntry)}, nil
+}
+
+// RecordPath records the state of path before a step changes it. Missing parent
+// directories are recorded first, since the step may create them.
+func (j *Journal) RecordPath(stepID, path string, become bool) {
+	if j == nil {
+		return
+	}
+	var missing []string
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); !os.IsNotExist(err) {
+			break
+		}
+		missing = append(missing, dir)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := len(missing) - 1; i >= 0; i-- {
+		j.addFile(stepID, missing[i], &FileState{Type: FileAbsent}, become)
+	}
+	j.addFile(stepID, path, Snapshot(path, true), become)
+}
+
+// RecordTree records path and everything below it before a step removes them.
+// Entries below a directory are recorded before the directory itself, so undoing
+// the journal in reverse creates the directory first.
+func (j *Journal) RecordTree(stepID, path string, become bool) {
+	if j == nil {
+		return
+	}
+	var paths []string
+	_ = filepath.WalkDir(path, func(p string, _ fs.DirEntry, err error) error {
+		paths = append(paths, p)
+		return nil
+	})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := len(paths) - 1; i >= 0; i-- {
+		j.addFile(stepID, paths[i], Snapshot(paths[i], true), become)
+	}
+}
+
+// addFile adds a file entry to the pending entries of a step. A path already
+// recorded by the step keeps its first state. Callers hold j.mu.
+func (j *Journal) addFile(stepID, path string, before *FileState, become bool) {
+	for _, entry := range j.pending[stepID] {
+		if entry.Kind == EntryFile && entry.Path == path {
+			return
+		}
+	}
+	j.pending[stepID] = append(j.pending[stepID], JournalEntry{
+		Kind:   EntryFile,
+		StepID: stepID,
+		Become: become,
+		Path:   path,
+		Before: before,
+	})
+}
+
+// Record adds a package or service change made by a step.
+func (j *Journal) Record(entry JournalEntry) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.pending[entry.StepID] = append(j.pending[entry.StepID], entry)
+}
+
+// Commit writes the changes recorded for a finished step to the journal. Paths the
+// step left unchanged are dropped. A changed step that recorded nothing gets an
+// unrecorded entry, so undo can tell which changes it can't revert.
+func (j *Journal) Commit(stepID, stepName, action string, changed bool) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	recorded := j.pending[stepID]
+	delete(j.pending, stepID)
+
+	now := time.Now()
+	var entries []JournalEntry
+	for _, entry := range recorded {
+		if entry.Kind == EntryFile {
+			entry.After = Snapshot(entry.Path, false)
+			if entry.After.Matches(entry.Before) {
+				continue
+			}
+		}
+		entry.StepName = stepName
+		entry.Action = action
+		entry.Time = now
+		entries = append(entries, entry)
+	}
+	if changed && len(recorded) == 0 {
+		entries = append(entries, JournalEntry{
+			Kind:     EntryUnrecorded,
+			StepID:   stepID,
+			StepName: stepName,
+			Action:   action,
+			Time:     now,
+		})
+	}
+
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode journal entry: %w", err)
+		}
+		if _, err := j.file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed to write journal: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// SkipJournal records in the run directory why the run keeps no journal, so
+// LoadJournal can report it.
+func SkipJournal(runDir, reason string) error {
+	// #nosec G306 -- Artifact files are intentionally readable
+	if err := os.WriteFile(filepath.Join(runDir, NoJournalFile), []byte(reason+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record missing journal: %w", err)
+	}
+	return nil
+}
+
+// LoadJournal reads the journal of a run directory.
+func LoadJournal(runDir string) ([]JournalEntry, error) {
+	// #nosec G304 -- Artifact file path is intentional functionality
+	file, err := os.Open(filepath.Join(runDir, JournalFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			// #nosec G304 -- Artifact file path is intentional functionality
+			if reason, readErr := os.ReadFile(filepath.Join(runDir, NoJournalFile)); readErr == nil {
+				return nil, fmt.Errorf("run %s has no journal: %s", filepath.Base(runDir), strings.TrimSpace(string(reason)))
+			}
+			return nil, fmt.Errorf("no journal in %s (was the run started with --artifacts-dir?)", runDir)
+		}
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var entries []JournalEntry
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 && data[len(data)-1] == '\n' {
+			var entry JournalEntry
+			if jsonErr := json.Unmarshal(data, &entry); jsonErr != nil {
+				return nil, fmt.Errorf("failed to decode journal line %d: %w", line, jsonErr)
+			}
+			entries = append(entries, entry)
+		}
+		// A last line without newline was cut off by a crash and is ignored
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read journal: %w", err)
+		}
+	}
+}
+
+// Snapshot returns the current state of a path. With keepContent, the content of
+// regular files up to MaxJournalContent is kept too.
+func Snapshot(path string, keepContent bool) *FileState {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return &FileState{Type: FileAbsent}
+	}
+	if err != nil {
+		return &FileState{Type: FileOther}
+	}
+
+	mode := info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	switch {
+	case info.Mode().IsRegular():
+		state := &FileState{Type: FileRegular, Mode: mode, Size: info.Size()}
+		hashFile(path, state, keepContent && info.Size() <= MaxJournalContent)
+		return state
+	case info.IsDir():
+		return &FileState{Type: FileDir, Mode: mode}
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return &FileState{Type: FileOther}
+		}
+		return &FileState{Type: FileSymlink, Target: target}
+	}
+	return &FileState{Type: FileOther, Mode: mode}
+}
+
+// hashFile sets the hash, and optionally the content, of a regular file's state.
+// Both are left empty if the file can't be read.
+func hashFile(path string, state *FileState, keepContent bool) {
+	// #nosec G304 -- Paths changed by the run are recorded intentionally
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	if keepContent {
+		content, err := io.ReadAll(file)
+		if err != nil {
+			return
+		}
+		sum := sha256.Sum256(content)
+		state.SHA256 = hex.EncodeToString(sum[:])
+		state.Size = int64(len(content))
+		if len(content) > 0 {
+			state.Content = content
+		}
+		return
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return
+	}
+	state.SHA256 = hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,222 @@
+//go:build unix
+
+package artifacts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("content\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	state := Snapshot(file, true)
+	if state.Type != FileRegular || state.Mode != 0640 || string(state.Content) != "content\n" || state.SHA256 == "" {
+		t.Errorf("Snapshot(file) = %+v", state)
+	}
+	if !state.Restorable() {
+		t.Error("file with content should be restorable")
+	}
+
+	withoutContent := Snapshot(file, false)
+	if withoutContent.Content != nil || withoutContent.SHA256 != state.SHA256 {
+		t.Errorf("Snapshot(file, false) = %+v, want the hash only", withoutContent)
+	}
+	if withoutContent.Restorable() {
+		t.Error("file without content should not be restorable")
+	}
+	if !withoutContent.Matches(state) {
+		t.Error("states of the same file should match")
+	}
+
+	if state := Snapshot(empty, true); !state.Restorable() {
+		t.Errorf("empty file should be restorable: %+v", state)
+	}
+	if state := Snapshot(filepath.Join(dir, "missing"), true); state.Type != FileAbsent {
+		t.Errorf("Snapshot(missing).Type = %q, want %q", state.Type, FileAbsent)
+	}
+	if state := Snapshot(dir, true); state.Type != FileDir {
+		t.Errorf("Snapshot(dir).Type = %q, want %q", state.Type, FileDir)
+	}
+}
+
+func TestFileState_Matches(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b FileState
+		want bool
+	}{
+		{"both absent", FileState{Type: FileAbsent}, FileState{Type: FileAbsent}, true},
+		{"type differs", FileState{Type: FileAbsent}, FileState{Type: FileDir}, false},
+		{"same file", FileState{Type: FileRegular, Mode: 0644, SHA256: "a"}, FileState{Type: FileRegular, Mode: 0644, SHA256: "a"}, true},
+		{"content differs", FileState{Type: FileRegular, Mode: 0644, SHA256: "a"}, FileState{Type: FileRegular, Mode: 0644, SHA256: "b"}, false},
+		{"mode differs", FileState{Type: FileRegular, Mode: 0644, SHA256: "a"}, FileState{Type: FileRegular, Mode: 0600, SHA256: "a"}, false},
+		{"unreadable", FileState{Type: FileRegular, Mode: 0644}, FileState{Type: FileRegular, Mode: 0644}, false},
+		{"dir mode differs", FileState{Type: FileDir, Mode: 0755}, FileState{Type: FileDir, Mode: 0700}, false},
+		{"symlink target differs", FileState{Type: FileSymlink, Target: "a"}, FileState{Type: FileSymlink, Target: "b"}, false},
+		{"other", FileState{Type: FileOther}, FileState{Type: FileOther}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Matches(&tt.b); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJournal_Commit(t *testing.T) {
+	runDir := t.TempDir()
+	dir := t.TempDir()
+	untouched := filepath.Join(dir, "untouched")
+	if err := os.WriteFile(untouched, []byte("same\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := filepath.Join(dir, "a", "b", "created")
+
+	journal, err := OpenJournal(runDir)
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	journal.RecordPath("step-1", untouched, false)
+	journal.RecordPath("step-1", created, true)
+	journal.RecordPath("step-1", created, true)
+	if err := os.MkdirAll(filepath.Dir(created), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(created, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Commit("step-1", "write", "file", true); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	// A changed step that recorded nothing, and one that didn't change anything
+	if err := journal.Commit("step-2", "run script", "shell", true); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if err := journal.Commit("step-3", "check", "shell", false); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if info, err := os.Stat(filepath.Join(runDir, JournalFile)); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("journal file mode = %v (%v), want 0600", info.Mode(), err)
+	}
+
+	entries, err := LoadJournal(runDir)
+	if err != nil {
+		t.Fatalf("LoadJournal() error = %v", err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Kind+" "+entry.Path)
+	}
+	want := []string{
+		"file " + filepath.Join(dir, "a"),
+		"file " + filepath.Join(dir, "a", "b"),
+		"file " + created,
+		"unrecorded ",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("entries =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	entry := entries[2]
+	if entry.StepName != "write" || entry.Action != "file" || !entry.Become {
+		t.Errorf("entry = %+v, want step name, action and become", entry)
+	}
+	if entry.Before.Type != FileAbsent || entry.After.Type != FileRegular || entry.After.Content != nil {
+		t.Errorf("entry states = %+v -> %+v, want absent -> file without content", entry.Before, entry.After)
+	}
+}
+
+func TestJournal_RecordTree(t *testing.T) {
+	dir := t.TempDir()
+	tree := filepath.Join(dir, "tree")
+	if err := os.MkdirAll(filepath.Join(tree, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tree, "sub", "file"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runDir := t.TempDir()
+	journal, err := OpenJournal(runDir)
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	journal.RecordTree("step-1", tree, false)
+	if err := os.RemoveAll(tree); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.Commit("step-1", "remove", "file", true); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	_ = journal.Close()
+
+	entries, err := LoadJournal(runDir)
+	if err != nil {
+		t.Fatalf("LoadJournal() error = %v", err)
+	}
+	var got []string
+	for _, entry := range entries {
+		rel, _ := filepath.Rel(dir, entry.Path)
+		got = append(got, rel)
+	}
+	// Contents come before their directory, so undoing in reverse creates the directory first
+	want := "tree/sub/file tree/sub tree"
+	if strings.Join(got, " ") != want {
+		t.Errorf("entries = %v, want %s", got, want)
+	}
+	if string(entries[0].Before.Content) != "x" {
+		t.Errorf("removed file content = %q, want x", entries[0].Before.Content)
+	}
+}
+
+func TestLoadJournal_IgnoresCutOffLine(t *testing.T) {
+	runDir := t.TempDir()
+	data := `{"kind":"unrecorded","step_id":"step-1","time":"2026-01-01T00:00:00Z"}` + "\n" + `{"kind":"fi`
+	if err := os.WriteFile(filepath.Join(runDir, JournalFile), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := LoadJournal(runDir)
+	if err != nil {
+		t.Fatalf("LoadJournal() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].StepID != "step-1" {
+		t.Errorf("entries = %+v, want the complete line only", entries)
+	}
+}
+
+func TestLoadJournal_Missing(t *testing.T) {
+	_, err := LoadJournal(t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "no journal") {
+		t.Errorf("LoadJournal error = %v, want missing journal error", err)
+	}
+}
+
+func TestJournal_Nil(t *testing.T) {
+	var journal *Journal
+	journal.RecordPath("step-1", "/tmp/x", false)
+	journal.Record(JournalEntry{Kind: EntryPackage, StepID: "step-1"})
+	if err := journal.Commit("step-1", "name", "file", true); err != nil {
+		t.Errorf("Commit() on nil journal = %v", err)
+	}
+	if err := journal.Close(); err != nil {
+		t.Errorf("Close() on nil journal = %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package artifacts
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// SummaryFile is the name of the run summary in a run directory.
+const SummaryFile = "summary.json"
+
+// RunInfo describes a run of an artifacts directory.
+type RunInfo struct {
+	RunID   string      `json:"run_id"`
+	Summary *RunSummary `json:"summary,omitempty"` // Missing while the run is in progress
+}
+
+// ReadSummary reads the summary of a run directory, nil if the run hasn't
+// finished.
+func ReadSummary(runDir string) *RunSummary {
+	data, err := os.ReadFile(filepath.Join(runDir, SummaryFile)) // #nosec G304 -- run directory of the artifacts directory
+	if err != nil {
+		return nil
+	}
+	var summary RunSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil
+	}
+	return &summary
+}
+
+// ListRuns lists the runs of an artifacts directory with their summaries, newest
+// first. A missing directory has no runs.
+func ListRuns(baseDir string) ([]RunInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(baseDir, "runs"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	runs := []RunInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			runs = append(runs, RunInfo{RunID: entry.Name(), Summary: ReadSummary(RunDir(baseDir, entry.Name()))})
+		}
+	}
+	// Run IDs start with their start time
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].RunID > runs[j].RunID
+	})
+	return runs, nil
+}
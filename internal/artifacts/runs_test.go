@@ -0,0 +1,41 @@
+package artifacts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListRuns(t *testing.T) {
+	baseDir := t.TempDir()
+	if runs, err := ListRuns(baseDir); err != nil || len(runs) != 0 {
+		t.Errorf("ListRuns() of an empty directory = %v, %v, want no runs", runs, err)
+	}
+
+	for _, id := range []string{"20260101-100000-a", "20260102-100000-b"} {
+		if err := os.MkdirAll(RunDir(baseDir, id), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary := `{"run_id": "20260101-100000-a", "success": true}`
+	if err := os.WriteFile(filepath.Join(RunDir(baseDir, "20260101-100000-a"), SummaryFile), []byte(summary), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(baseDir, "runs", "stray.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := ListRuns(baseDir)
+	if err != nil {
+		t.Fatalf("ListRuns() error = %v", err)
+	}
+	if len(runs) != 2 || runs[0].RunID != "20260102-100000-b" || runs[1].RunID != "20260101-100000-a" {
+		t.Fatalf("ListRuns() = %+v, want both runs, newest first", runs)
+	}
+	if runs[0].Summary != nil {
+		t.Errorf("Summary of an unfinished run = %+v, want nil", runs[0].Summary)
+	}
+	if runs[1].Summary == nil || !runs[1].Summary.Success {
+		t.Errorf("Summary = %+v, want the successful summary", runs[1].Summary)
+	}
+}
@@ -2,8 +2,6 @@
 package artifacts
 
 import (
-	"bufio"
-	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -15,14 +13,17 @@ import (
 	"sync"
 	"time"
 
+	"github.com/alehatsman/mooncake/internal/diff"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/facts"
 	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/security"
 )
 
 // Config holds configuration for artifact writer.
 type Config struct {
 	BaseDir        string // Base directory for artifacts (e.g., ".mooncake")
+	RunID          string // ID of the run directory (default: generated from the time, config and host)
 	CaptureStdout  bool   // Whether to capture full stdout
 	CaptureStderr  bool   // Whether to capture full stderr
 	MaxOutputBytes int    // Max bytes per step in results.json
@@ -58,7 +59,9 @@ type StepResult struct {
 	Level        int                    `json:"level"`
 	DurationMs   int64                  `json:"duration_ms"`
 	Changed      bool                   `json:"changed"`
-	Status       string                 `json:"status"` // "success", "failed", "skipped"
+	Status       string                 `json:"status"`            // "success", "failed", "skipped"
+	Rescued      bool                   `json:"rescued,omitempty"` // Failure was handled by a block's rescue section
+	Ignored      bool                   `json:"ignored,omitempty"` // Failure was ignored via ignore_errors
 	ErrorMessage string                 `json:"error_message,omitempty"`
 	OutputLines  int                    `json:"output_lines,omitempty"`
 	OutputBytes  int                    `json:"output_bytes,omitempty"`
@@ -91,17 +94,37 @@ type RunSummary struct {
 	FailedSteps  int       `json:"failed_steps"`
 	SkippedSteps int       `json:"skipped_steps"`
 	ChangedSteps int       `json:"changed_steps"`
+	RescuedSteps int       `json:"rescued_steps,omitempty"`
+	IgnoredSteps int       `json:"ignored_steps,omitempty"`
 	Success      bool      `json:"success"`
 	ErrorMessage string    `json:"error_message,omitempty"`
+
+	// Failures lists every failed step, including ignored ones
+	Failures []events.StepFailure `json:"failures,omitempty"`
+
+	// DroppedEvents counts the output events missed by subscribers such as this
+	// writer, so events.jsonl may be incomplete
+	DroppedEvents int `json:"dropped_events,omitempty"`
 }
 
 // NewWriter creates a new artifact writer.
 func NewWriter(cfg Config, planData *plan.Plan, systemFacts *facts.Facts) (*Writer, error) {
-	// Generate run ID
-	runID := generateRunID(planData, systemFacts)
-
-	// Create run directory
-	runDir := filepath.Join(cfg.BaseDir, "runs", runID)
+	runID := cfg.RunID
+	runDir := RunDir(cfg.BaseDir, runID)
+	if runID != "" {
+		if pathExists(runDir) {
+			return nil, fmt.Errorf("run %s already exists", runID)
+		}
+	} else {
+		// Generate run ID. Runs started within the same second (e.g., a quick
+		// resume) get a numbered suffix instead of overwriting each other.
+		runID = generateRunID(planData, systemFacts)
+		runDir = RunDir(cfg.BaseDir, runID)
+		for n := 2; pathExists(runDir); n++ {
+			runDir = RunDir(cfg.BaseDir, fmt.Sprintf("%s-%d", runID, n))
+		}
+		runID = filepath.Base(runDir)
+	}
 	// #nosec G301 -- Artifact directory permissions are intentionally readable
 	if err := os.MkdirAll(runDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create run directory: %w", err)
@@ -201,10 +224,20 @@ func (w *Writer) OnEvent(event events.Event) {
 				Level:        data.Level,
 				DurationMs:   data.DurationMs,
 				Status:       "failed",
+				Ignored:      data.Ignored,
 				ErrorMessage: data.ErrorMessage,
 			})
 		}
 
+	case events.EventBlockRescued:
+		if data, ok := event.Data.(events.BlockRescuedData); ok {
+			for i := range w.steps {
+				if w.steps[i].StepID == data.FailedStepID && w.steps[i].Status == "failed" {
+					w.steps[i].Rescued = true
+				}
+			}
+		}
+
 	case events.EventStepSkipped:
 		if data, ok := event.Data.(events.StepSkippedData); ok {
 			w.steps = append(w.steps, StepResult{
@@ -299,6 +332,16 @@ func (w *Writer) OnEvent(event events.Event) {
 	}
 }
 
+// RunID returns the ID of the run the writer records.
+func (w *Writer) RunID() string {
+	return w.runID
+}
+
+// RunDir returns the directory the run's artifacts are written to.
+func (w *Writer) RunDir() string {
+	return w.runDir
+}
+
 // Close closes all open files.
 func (w *Writer) Close() {
 	w.mu.Lock()
@@ -327,9 +370,9 @@ func (w *Writer) Close() {
 	w.closed = true
 }
 
-// writePlan writes the plan to plan.json.
+// writePlan writes the plan to plan.json, with the registered secrets redacted.
 func (w *Writer) writePlan(planData *plan.Plan) error {
-	planPath := filepath.Join(w.runDir, "plan.json")
+	planPath := filepath.Join(w.runDir, PlanFile)
 	return plan.SavePlanToFile(planData, planPath)
 }
 
@@ -372,6 +415,9 @@ func (w *Writer) writeResults(runData events.RunCompletedData) error {
 		"success_steps": runData.SuccessSteps,
 		"failed_steps":  runData.FailedSteps,
 		"skipped_steps": runData.SkippedSteps,
+		"rescued_steps": runData.RescuedSteps,
+		"ignored_steps": runData.IgnoredSteps,
+		"failures":      runData.Failures,
 		"steps":         w.steps,
 	}
 
@@ -406,7 +452,7 @@ func (w *Writer) writeChangedFiles() error {
 
 // writeSummary writes run summary to summary.json.
 func (w *Writer) writeSummary(runData events.RunCompletedData) error {
-	summaryPath := filepath.Join(w.runDir, "summary.json")
+	summaryPath := filepath.Join(w.runDir, SummaryFile)
 	// #nosec G304 -- Artifact file path is intentional functionality
 	summaryFile, err := os.Create(summaryPath)
 	if err != nil {
@@ -428,8 +474,13 @@ func (w *Writer) writeSummary(runData events.RunCompletedData) error {
 		FailedSteps:  runData.FailedSteps,
 		SkippedSteps: runData.SkippedSteps,
 		ChangedSteps: runData.ChangedSteps,
+		RescuedSteps: runData.RescuedSteps,
+		IgnoredSteps: runData.IgnoredSteps,
 		Success:      runData.Success,
 		ErrorMessage: runData.ErrorMessage,
+		Failures:     runData.Failures,
+
+		DroppedEvents: runData.DroppedEvents,
 	}
 
 	encoder := json.NewEncoder(summaryFile)
@@ -447,6 +498,12 @@ func generateRunID(planData *plan.Plan, systemFacts *facts.Facts) string {
 	return fmt.Sprintf("%s-%s", timestamp, shortHash)
 }
 
+// pathExists reports whether a file or directory exists at path.
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
 // calculateFileChecksum computes SHA256 checksum of a file.
 // Returns empty string if file doesn't exist or on error.
 func calculateFileChecksum(path string) string {
@@ -471,80 +528,9 @@ func calculateFileChecksum(path string) string {
 }
 
 // generateUnifiedDiff creates a unified diff between two file versions.
-// Returns the diff content as a string.
+// Returns the diff content as a string, empty if the contents are equal.
 func generateUnifiedDiff(path, beforeContent, afterContent string) string {
-	var buf bytes.Buffer
-
-	// Write unified diff header
-	fmt.Fprintf(&buf, "--- %s\n", path)
-	fmt.Fprintf(&buf, "+++ %s\n", path)
-
-	// Split content into lines
-	beforeLines := splitLines(beforeContent)
-	afterLines := splitLines(afterContent)
-
-	// Simple unified diff generation (context: 3 lines)
-	// This is a basic implementation - could be enhanced with proper diff algorithm
-	if beforeContent == afterContent {
-		return "" // No diff
-	}
-
-	// For simplicity, show full file diff with line numbers
-	maxLines := len(beforeLines)
-	if len(afterLines) > maxLines {
-		maxLines = len(afterLines)
-	}
-
-	if maxLines == 0 {
-		return buf.String()
-	}
-
-	// Write hunk header
-	fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", 1, len(beforeLines), 1, len(afterLines))
-
-	// Write diff lines
-	beforeIdx, afterIdx := 0, 0
-	for beforeIdx < len(beforeLines) || afterIdx < len(afterLines) {
-		if beforeIdx < len(beforeLines) && afterIdx < len(afterLines) {
-			if beforeLines[beforeIdx] == afterLines[afterIdx] {
-				// Context line (unchanged)
-				fmt.Fprintf(&buf, " %s\n", beforeLines[beforeIdx])
-				beforeIdx++
-				afterIdx++
-			} else {
-				// Changed line
-				fmt.Fprintf(&buf, "-%s\n", beforeLines[beforeIdx])
-				fmt.Fprintf(&buf, "+%s\n", afterLines[afterIdx])
-				beforeIdx++
-				afterIdx++
-			}
-		} else if beforeIdx < len(beforeLines) {
-			// Deleted line
-			fmt.Fprintf(&buf, "-%s\n", beforeLines[beforeIdx])
-			beforeIdx++
-		} else {
-			// Added line
-			fmt.Fprintf(&buf, "+%s\n", afterLines[afterIdx])
-			afterIdx++
-		}
-	}
-
-	return buf.String()
-}
-
-// splitLines splits content into lines, preserving line endings.
-func splitLines(content string) []string {
-	if content == "" {
-		return []string{}
-	}
-
-	var lines []string
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-
-	return lines
+	return diff.Unified(path, path, beforeContent, afterContent)
 }
 
 // CaptureFileStateBefore captures file state before a modification.
@@ -667,6 +653,7 @@ func (w *Writer) RecordFileDiff(stepID, filePath, beforeContent, afterContent st
 	if diff == "" {
 		return "" // No diff (files are identical)
 	}
+	diff = security.RedactSecrets(diff)
 
 	// Create diffs directory
 	diffsDir := filepath.Join(w.runDir, "diffs")
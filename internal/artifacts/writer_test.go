@@ -113,6 +113,25 @@ func TestNewWriter_WithoutOutputCapture(t *testing.T) {
 	}
 }
 
+func TestNewWriter_RunID(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := Config{BaseDir: tmpDir, RunID: "20260115-143022-api001"}
+
+	writer, err := NewWriter(cfg, createTestPlan(), createTestFacts())
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	defer writer.Close()
+	if writer.RunID() != cfg.RunID || writer.RunDir() != RunDir(tmpDir, cfg.RunID) {
+		t.Errorf("RunID() = %q, RunDir() = %q, want the given run ID", writer.RunID(), writer.RunDir())
+	}
+
+	// A given run ID isn't renamed: it must be new
+	if _, err := NewWriter(cfg, createTestPlan(), createTestFacts()); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("NewWriter with an existing run ID error = %v", err)
+	}
+}
+
 func TestWriter_OnEvent_StepCompleted(t *testing.T) {
 	tmpDir := t.TempDir()
 	cfg := Config{
@@ -450,6 +469,61 @@ func TestWriter_OnEvent_RunCompleted(t *testing.T) {
 	}
 }
 
+func TestWriter_OnEvent_RunCompleted_Failures(t *testing.T) {
+	writer, err := NewWriter(Config{BaseDir: t.TempDir()}, createTestPlan(), createTestFacts())
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	defer writer.Close()
+
+	writer.OnEvent(events.Event{
+		Type:      events.EventStepFailed,
+		Timestamp: time.Now(),
+		Data: events.StepFailedData{
+			StepID:       "step-1",
+			Name:         "Probe",
+			ErrorMessage: "exit 3",
+			Ignored:      true,
+		},
+	})
+
+	failures := []events.StepFailure{
+		{StepID: "step-1", Name: "Probe", ErrorMessage: "exit 3", Ignored: true},
+		{StepID: "step-2", Name: "Build", ErrorMessage: "exit 1"},
+	}
+	writer.OnEvent(events.Event{
+		Type:      events.EventRunCompleted,
+		Timestamp: time.Now(),
+		Data: events.RunCompletedData{
+			TotalSteps:   2,
+			FailedSteps:  1,
+			IgnoredSteps: 1,
+			Success:      false,
+			Failures:     failures,
+		},
+	})
+
+	summaryData, err := os.ReadFile(filepath.Join(writer.runDir, "summary.json"))
+	if err != nil {
+		t.Fatalf("failed to read summary.json: %v", err)
+	}
+	var summary RunSummary
+	if err := json.Unmarshal(summaryData, &summary); err != nil {
+		t.Fatalf("failed to parse summary.json: %v", err)
+	}
+
+	if summary.IgnoredSteps != 1 {
+		t.Errorf("summary ignored steps = %d, want 1", summary.IgnoredSteps)
+	}
+	if len(summary.Failures) != 2 || summary.Failures[1].StepID != "step-2" || !summary.Failures[0].Ignored {
+		t.Errorf("summary failures = %+v, want %+v", summary.Failures, failures)
+	}
+
+	if len(writer.steps) != 1 || !writer.steps[0].Ignored {
+		t.Errorf("step results = %+v, want one ignored failure", writer.steps)
+	}
+}
+
 func TestWriter_Close(t *testing.T) {
 	tmpDir := t.TempDir()
 	cfg := Config{
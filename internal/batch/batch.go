@@ -0,0 +1,234 @@
+// Package batch posts items to an HTTP endpoint in batches, from a background
+// goroutine, retrying failed requests. It delivers the records of webhook sinks
+// and the spans of the OTLP exporter.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/version"
+)
+
+// Options configures a Sender. Every field is required.
+type Options[T any] struct {
+	// URL receives the batches as POST requests.
+	URL string
+
+	// Name describes the endpoint in errors, e.g. "webhook".
+	Name string
+
+	// BatchSize is the maximum number of items per request.
+	BatchSize int
+
+	// FlushInterval is the maximum time an item waits for its batch to fill up.
+	FlushInterval time.Duration
+
+	// MaxQueued bounds the items kept while the endpoint is down; newer items
+	// are dropped.
+	MaxQueued int
+
+	// MaxAttempts is the number of attempts to deliver a batch.
+	MaxAttempts int
+
+	// RetryDelay is the delay before the first retry, doubled for each later
+	// retry.
+	RetryDelay time.Duration
+
+	// CloseTimeout bounds the time Close spends delivering the queued items;
+	// items still queued then are dropped.
+	CloseTimeout time.Duration
+
+	// Client sends the requests.
+	Client *http.Client
+
+	// Encode returns the body of a batch and the headers of its requests. It is
+	// called once per batch, so retries send the same request.
+	Encode func(batch []T) ([]byte, http.Header, error)
+
+	// Retry reports whether a request that got a non-2xx status may be retried.
+	// Network errors are always retried.
+	Retry func(status int) bool
+}
+
+// Sender queues items and posts them in batches when a batch is full, every
+// flush interval, and when it is closed. It is safe for concurrent use.
+type Sender[T any] struct {
+	opts Options[T]
+
+	mu      sync.Mutex
+	queue   []T
+	dropped int   // Items dropped, as the endpoint was down or rejected them
+	lastErr error // Error of the last dropped batch
+
+	flush     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	// ctx is canceled when Close gives up on the queued items
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New returns a sender posting to opts.URL, and starts it.
+func New[T any](opts Options[T]) *Sender[T] {
+	s := &Sender[T]{opts: opts, flush: make(chan struct{}, 1), done: make(chan struct{})}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Add queues an item for the next batch. It fails, dropping the item, when the
+// queue is full.
+func (s *Sender[T]) Add(item T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) >= s.opts.MaxQueued {
+		s.dropped++
+		s.lastErr = fmt.Errorf("%s %s is not keeping up", s.opts.Name, s.opts.URL)
+		return s.lastErr
+	}
+	s.queue = append(s.queue, item)
+	if len(s.queue) >= s.opts.BatchSize {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close delivers the queued items within the close timeout, then returns the
+// number of items that couldn't be delivered and the last error.
+func (s *Sender[T]) Close() (dropped int, err error) {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		timer := time.AfterFunc(s.opts.CloseTimeout, s.cancel)
+		s.wg.Wait()
+		timer.Stop()
+		s.cancel()
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped, s.lastErr
+}
+
+// run sends batches when they are full, every flush interval, and when the
+// sender is closed.
+func (s *Sender[T]) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.flush:
+		case <-ticker.C:
+		case <-s.done:
+			s.drain()
+			return
+		}
+		for s.sendBatch() {
+		}
+	}
+}
+
+// drain delivers the queued items when the sender is closed. Once a batch
+// fails the endpoint is taken to be down, and the other batches are dropped
+// instead of being retried in turn.
+func (s *Sender[T]) drain() {
+	for batch := s.nextBatch(); len(batch) > 0; batch = s.nextBatch() {
+		if err := s.deliver(batch); err != nil {
+			s.mu.Lock()
+			s.dropped += len(batch) + len(s.queue)
+			s.queue = nil
+			s.lastErr = err
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// sendBatch delivers the next batch of queued items, and reports whether there
+// was one.
+func (s *Sender[T]) sendBatch() bool {
+	batch := s.nextBatch()
+	if len(batch) == 0 {
+		return false
+	}
+
+	if err := s.deliver(batch); err != nil {
+		s.mu.Lock()
+		s.dropped += len(batch)
+		s.lastErr = err
+		s.mu.Unlock()
+	}
+	return true
+}
+
+// nextBatch takes the next batch of queued items.
+func (s *Sender[T]) nextBatch() []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := min(len(s.queue), s.opts.BatchSize)
+	batch := s.queue[:n:n]
+	s.queue = s.queue[n:]
+	return batch
+}
+
+// deliver posts a batch, retrying failed attempts.
+func (s *Sender[T]) deliver(batch []T) error {
+	body, header, err := s.opts.Encode(batch)
+	if err != nil {
+		return err
+	}
+
+	delay := s.opts.RetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(body, header)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.opts.MaxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// post sends one request, and reports whether a failure may be retried.
+func (s *Sender[T]) post(body []byte, header http.Header) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, s.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mooncake/"+version.Version)
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	_ = resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return s.opts.Retry(resp.StatusCode), fmt.Errorf("%s responded %s", s.opts.Name, resp.Status)
+}
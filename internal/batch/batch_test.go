@@ -0,0 +1,99 @@
+package batch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// endpoint counts the requests it gets and answers them with status.
+type endpoint struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	status   int
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	e.requests = append(e.requests, r)
+	e.mu.Unlock()
+	w.WriteHeader(e.status)
+}
+
+func newTestSender(url string) *Sender[int] {
+	return New(Options[int]{
+		URL:           url,
+		Name:          "test endpoint",
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		MaxQueued:     10,
+		MaxAttempts:   2,
+		RetryDelay:    time.Millisecond,
+		CloseTimeout:  time.Minute,
+		Client:        http.DefaultClient,
+		Encode: func(batch []int) ([]byte, http.Header, error) {
+			body, err := json.Marshal(batch)
+			return body, http.Header{"X-Test": {"1"}}, err
+		},
+		Retry: func(status int) bool { return status >= 500 },
+	})
+}
+
+func TestSender_Close(t *testing.T) {
+	e := &endpoint{status: http.StatusOK}
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	s := newTestSender(server.URL)
+	for i := 0; i < 3; i++ {
+		if err := s.Add(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dropped, err := s.Close(); dropped != 0 || err != nil {
+		t.Errorf("Close() = %d, %v, want everything delivered", dropped, err)
+	}
+	if len(e.requests) != 2 || e.requests[0].Header.Get("X-Test") != "1" || e.requests[0].Header.Get("Content-Type") != "application/json" {
+		t.Errorf("requests = %d, want 2 batches with the encoded headers", len(e.requests))
+	}
+}
+
+func TestSender_CloseGivesUp(t *testing.T) {
+	// The endpoint is down: only the first batch is tried when closing
+	e := &endpoint{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	s := newTestSender(server.URL)
+	s.mu.Lock()
+	s.queue = []int{1, 2, 3, 4, 5, 6}
+	s.mu.Unlock()
+	dropped, err := s.Close()
+	if dropped != 6 || err == nil || !strings.Contains(err.Error(), "test endpoint responded 503") {
+		t.Errorf("Close() = %d, %v, want 6 dropped after a 503", dropped, err)
+	}
+	if len(e.requests) != 2 {
+		t.Errorf("%d requests, want the attempts of the first batch only", len(e.requests))
+	}
+}
+
+func TestSender_QueueFull(t *testing.T) {
+	e := &endpoint{status: http.StatusOK}
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	s := newTestSender(server.URL)
+	s.mu.Lock()
+	s.queue = make([]int, 10)
+	s.mu.Unlock()
+	if err := s.Add(1); err == nil || !strings.Contains(err.Error(), "not keeping up") {
+		t.Errorf("Add() to a full queue = %v, want an error", err)
+	}
+	if dropped, _ := s.Close(); dropped != 1 {
+		t.Errorf("Close() dropped = %d, want 1", dropped)
+	}
+}
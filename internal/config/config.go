@@ -29,6 +29,32 @@
 //   - Exactly one action: shell, file, template, package, service, assert, etc.
 //   - Optional control flow: with_items, with_filetree
 //
+// Steps can also be grouped with block/rescue/always. The block replaces the
+// action; rescue runs only when a block step fails and always runs regardless:
+//
+//	- name: Deploy app
+//	  block:
+//	    - shell: ./deploy.sh
+//	  rescue:
+//	    - shell: ./rollback.sh
+//	  always:
+//	    - shell: ./cleanup.sh
+//
+// Structured configs can declare handlers. A step lists handler names in notify;
+// notified handlers run once after the main steps, and only if the step changed
+// something. A step with flush_handlers: true runs pending handlers early:
+//
+//	steps:
+//	  - template:
+//	      src: nginx.conf.j2
+//	      dest: /etc/nginx/nginx.conf
+//	    notify: [Restart nginx]
+//	handlers:
+//	  - name: Restart nginx
+//	    service:
+//	      name: nginx
+//	      state: restarted
+//
 // # Step Structure
 //
 // The Step struct represents a single configuration step. Key fields:
@@ -145,8 +171,26 @@ type RunConfig struct {
 
 	// Steps contains the configuration steps to execute
 	Steps []Step `yaml:"steps" json:"steps"`
+
+	// Handlers are steps that run only when notified by a changed step
+	Handlers []Step `yaml:"handlers" json:"handlers,omitempty"`
+
+	// Strategy controls how the steps of this file are scheduled (sequential or parallel)
+	Strategy string `yaml:"strategy" json:"strategy,omitempty"`
+
+	// Secrets names variables whose values are redacted from events, logs and artifacts
+	Secrets []string `yaml:"secrets" json:"secrets,omitempty"`
 }
 
+// Step scheduling strategies for RunConfig.Strategy.
+const (
+	// StrategySequential runs the steps of a file one after another, in order.
+	StrategySequential = "sequential"
+
+	// StrategyParallel runs the steps of a file concurrently, ordered only by depends_on.
+	StrategyParallel = "parallel"
+)
+
 // ParsedConfig holds the result of parsing a configuration file.
 // It includes both the steps to execute and any global variables defined.
 type ParsedConfig struct {
@@ -158,6 +202,15 @@ type ParsedConfig struct {
 
 	// Version is the config schema version (e.g., "1.0")
 	Version string
+
+	// Handlers are steps triggered via notify, run after the main steps
+	Handlers []Step
+
+	// Strategy is the scheduling strategy of the file (empty if not set)
+	Strategy string
+
+	// Secrets are the names of variables holding secrets
+	Secrets []string
 }
 
 // File represents a file or directory operation in a configuration step.
@@ -573,6 +626,17 @@ type ArtifactValidate struct {
 	ForbiddenPaths  []string `yaml:"forbidden_paths" json:"forbidden_paths,omitempty"`       // Glob patterns for forbidden paths
 }
 
+// Sandbox runs the command of a shell or command step in a sandbox (Linux only).
+// The writable paths are writable, /tmp is private and the rest of the
+// filesystem is read-only. sandbox: {} uses the defaults.
+type Sandbox struct {
+	Writable []string `yaml:"writable" json:"writable,omitempty"` // Paths the command may write (default: the working directory of the step)
+	Network  *bool    `yaml:"network" json:"network,omitempty"`   // Allow network access (default: false)
+	CPU      string   `yaml:"cpu" json:"cpu,omitempty"`           // CPU time limit of each process (e.g., "30s")
+	Memory   string   `yaml:"memory" json:"memory,omitempty"`     // Memory limit of each process (e.g., "512MB")
+	Timeout  string   `yaml:"timeout" json:"timeout,omitempty"`   // Wall-clock limit of the command (e.g., "5m")
+}
+
 // UnmarshalYAML implements custom YAML unmarshaling to support both string and object forms.
 // Supports: print: "message" AND print: { msg: "message" }
 func (p *PrintAction) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -632,6 +696,14 @@ type Step struct {
 	ArtifactCapture *ArtifactCapture `yaml:"artifact_capture" json:"artifact_capture,omitempty"`
 	ArtifactValidate *ArtifactValidate `yaml:"artifact_validate" json:"artifact_validate,omitempty"`
 
+	// Runs handlers notified so far (instead of waiting for the end of the run)
+	FlushHandlers bool `yaml:"flush_handlers" json:"flush_handlers,omitempty"`
+
+	// Step groups (block counts as the action, rescue/always require block)
+	Block  []Step `yaml:"block" json:"block,omitempty"`
+	Rescue []Step `yaml:"rescue" json:"rescue,omitempty"`
+	Always []Step `yaml:"always" json:"always,omitempty"`
+
 	// Privilege escalation
 	Become     bool   `yaml:"become" json:"become,omitempty"`
 	BecomeUser string `yaml:"become_user" json:"become_user,omitempty"`
@@ -644,11 +716,21 @@ type Step struct {
 	Timeout    string `yaml:"timeout" json:"timeout,omitempty"`
 	Retries    int    `yaml:"retries" json:"retries,omitempty"`
 	RetryDelay string `yaml:"retry_delay" json:"retry_delay,omitempty"`
+	Until      string `yaml:"until" json:"until,omitempty"` // Retry until this expression is true
 
 	// Result overrides
 	ChangedWhen string `yaml:"changed_when" json:"changed_when,omitempty"`
 	FailedWhen  string `yaml:"failed_when" json:"failed_when,omitempty"`
 
+	// Record a failure and continue instead of stopping the run
+	IgnoreErrors bool `yaml:"ignore_errors" json:"ignore_errors,omitempty"`
+
+	// Hide the output, result and error of the step from events, logs and artifacts
+	NoLog bool `yaml:"no_log" json:"no_log,omitempty"`
+
+	// Run the command of a shell or command step in a sandbox
+	Sandbox *Sandbox `yaml:"sandbox" json:"sandbox,omitempty"`
+
 	// Loops
 	WithFileTree *string `yaml:"with_filetree" json:"with_filetree,omitempty"`
 	WithItems    *string `yaml:"with_items" json:"with_items,omitempty"`
@@ -657,7 +739,15 @@ type Step struct {
 	Tags     []string `yaml:"tags" json:"tags,omitempty"`
 	Register string   `yaml:"register" json:"register,omitempty"`
 
-	// Plan metadata (populated during plan expansion, omitted in config files)
+	// Handlers to queue when this step reports a change
+	Notify []string `yaml:"notify" json:"notify,omitempty"`
+
+	// Scheduling: IDs of steps that must finish before this one starts.
+	// Config files reference user-defined ids; plans reference plan step IDs.
+	DependsOn []string `yaml:"depends_on" json:"depends_on,omitempty"`
+
+	// Plan metadata (populated during plan expansion). In config files, id is an
+	// optional user-defined identifier for depends_on; the planner replaces it.
 	ID             string        `yaml:"id,omitempty" json:"id,omitempty"`
 	ActionType     string        `yaml:"action_type,omitempty" json:"action_type,omitempty"`
 	Origin         *Origin       `yaml:"origin,omitempty" json:"origin,omitempty"`
@@ -763,6 +853,12 @@ func (s *Step) countActions() int {
 	if s.ArtifactValidate != nil {
 		count++
 	}
+	if s.FlushHandlers {
+		count++
+	}
+	if s.Block != nil {
+		count++
+	}
 	return count
 }
 
@@ -843,6 +939,12 @@ func (s *Step) DetermineActionType() string {
 	if s.ArtifactValidate != nil {
 		return "artifact_validate"
 	}
+	if s.FlushHandlers {
+		return "flush_handlers"
+	}
+	if s.Block != nil {
+		return "block"
+	}
 	if s.WithItems != nil || s.WithFileTree != nil {
 		return "loop"
 	}
@@ -877,6 +979,10 @@ func (s *Step) Validate() error {
 		return err
 	}
 
+	if s.Block == nil && (s.Rescue != nil || s.Always != nil) {
+		return fmt.Errorf("Step %s uses rescue/always without block", s.Name)
+	}
+
 	return nil
 }
 
@@ -912,6 +1018,10 @@ func (s *Step) Clone() *Step {
 		Wait:            s.Wait,
 		ArtifactCapture: s.ArtifactCapture,
 		ArtifactValidate: s.ArtifactValidate,
+		FlushHandlers: s.FlushHandlers,
+		Block:        s.Block,
+		Rescue:       s.Rescue,
+		Always:       s.Always,
 		Become:       s.Become,
 		BecomeUser:   s.BecomeUser,
 		Env:          s.Env,
@@ -919,12 +1029,18 @@ func (s *Step) Clone() *Step {
 		Timeout:      s.Timeout,
 		Retries:      s.Retries,
 		RetryDelay:   s.RetryDelay,
+		Until:        s.Until,
 		ChangedWhen:  s.ChangedWhen,
 		FailedWhen:   s.FailedWhen,
+		IgnoreErrors: s.IgnoreErrors,
+		NoLog:        s.NoLog,
+		Sandbox:      s.Sandbox,
 		WithFileTree: s.WithFileTree,
 		WithItems:    s.WithItems,
 		Tags:         append([]string(nil), s.Tags...),
 		Register:     s.Register,
+		Notify:       append([]string(nil), s.Notify...),
+		DependsOn:    append([]string(nil), s.DependsOn...),
 		ID:           s.ID,
 		ActionType:   s.ActionType,
 		Origin:       s.Origin,
@@ -203,6 +203,34 @@ func TestStep_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid block with rescue and always",
+			step: Step{
+				Name:   "test",
+				Block:  []Step{{Shell: shellActionPtr("echo hello")}},
+				Rescue: []Step{{Shell: shellActionPtr("echo rescue")}},
+				Always: []Step{{Shell: shellActionPtr("echo always")}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid - rescue without block",
+			step: Step{
+				Name:   "test",
+				Shell:  shellActionPtr("echo hello"),
+				Rescue: []Step{{Shell: shellActionPtr("echo rescue")}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid - block with another action",
+			step: Step{
+				Name:  "test",
+				Shell: shellActionPtr("echo hello"),
+				Block: []Step{{Shell: shellActionPtr("echo nested")}},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
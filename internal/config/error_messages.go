@@ -239,6 +239,12 @@ func formatAdditionalPropertiesError(message string, _ string) string {
 func formatOneOfError(err *jsonschema.ValidationError) string {
 	// For oneOf errors related to steps, provide a clear actionable message
 
+	// Field dependencies (e.g., rescue without block) are more specific than
+	// the action count, so report them first
+	if depErr := findDependencyError(err); depErr != nil {
+		return formatDependencyError(depErr.Message)
+	}
+
 	// Check if this is a "no action" vs "multiple actions" case
 	// by looking at the causes
 	hasRequiredFailure := false
@@ -255,16 +261,43 @@ func formatOneOfError(err *jsonschema.ValidationError) string {
 
 	// If all causes are "required" failures, it means no action is present
 	if hasRequiredFailure && !hasNotFailure {
-		return "Step has no action. Each step must have exactly ONE of: shell, command, template, file, file_replace, file_insert, file_delete_range, file_patch_apply, copy, download, unarchive, service, assert, artifact_capture, artifact_validate, preset, print, include, include_vars, vars, package, repo_search, repo_tree, repo_apply_patchset, or wait"
+		return "Step has no action. Each step must have exactly ONE of: shell, command, template, file, file_replace, file_insert, file_delete_range, file_patch_apply, copy, download, unarchive, service, assert, artifact_capture, artifact_validate, preset, print, include, include_vars, vars, package, repo_search, repo_tree, repo_apply_patchset, wait, or block"
 	}
 
 	// If we have "not" failures, it means multiple actions are present
 	if hasNotFailure {
-		return "Step has multiple actions. Only ONE action is allowed per step. Choose either: shell, command, template, file, file_replace, file_insert, file_delete_range, file_patch_apply, copy, download, unarchive, service, assert, artifact_capture, artifact_validate, preset, print, include, include_vars, vars, package, repo_search, repo_tree, repo_apply_patchset, or wait"
+		return "Step has multiple actions. Only ONE action is allowed per step. Choose either: shell, command, template, file, file_replace, file_insert, file_delete_range, file_patch_apply, copy, download, unarchive, service, assert, artifact_capture, artifact_validate, preset, print, include, include_vars, vars, package, repo_search, repo_tree, repo_apply_patchset, wait, or block"
 	}
 
 	// Generic fallback
-	return "Step must have exactly one action (shell, command, template, file, file_replace, file_insert, file_delete_range, file_patch_apply, copy, download, unarchive, service, assert, artifact_capture, artifact_validate, preset, print, include, include_vars, vars, package, repo_search, repo_tree, repo_apply_patchset, or wait)"
+	return "Step must have exactly one action (shell, command, template, file, file_replace, file_insert, file_delete_range, file_patch_apply, copy, download, unarchive, service, assert, artifact_capture, artifact_validate, preset, print, include, include_vars, vars, package, repo_search, repo_tree, repo_apply_patchset, wait, or block)"
+}
+
+// findDependencyError returns the first "dependencies" failure among the error causes.
+func findDependencyError(err *jsonschema.ValidationError) *jsonschema.ValidationError {
+	if strings.Contains(err.KeywordLocation, "/dependencies/") {
+		return err
+	}
+	for _, cause := range err.Causes {
+		if found := findDependencyError(cause); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// formatDependencyError creates a friendly message for fields used without a field they require
+func formatDependencyError(message string) string {
+	// Example: "property 'block' is required, if 'rescue' property exists"
+	parts := strings.SplitN(message, ", if ", 2)
+	if len(parts) == 2 {
+		required := extractMissingProperty(parts[0])
+		field := extractMissingProperty(parts[1])
+		if required != "" && field != "" {
+			return fmt.Sprintf("Field '%s' requires '%s'. Add '%s' or remove '%s'", field, required, required, field)
+		}
+	}
+	return strings.ToUpper(message[:1]) + message[1:]
 }
 
 // formatMinLengthError creates a friendly message for string too short errors
@@ -1,10 +1,12 @@
 package config
 
 import (
-	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/vault"
 	"gopkg.in/yaml.v3"
 )
 
@@ -100,11 +102,15 @@ func (r *YAMLConfigReader) ReadConfigWithValidation(path string) (*ParsedConfig,
 
 		// Attach source locations from locationMap
 		attachSourceLocations(runConfig.Steps, locationMap, "/steps")
+		attachSourceLocations(runConfig.Handlers, locationMap, "/handlers")
 
 		parsedConfig = &ParsedConfig{
 			Steps:      runConfig.Steps,
 			GlobalVars: globalVars,
 			Version:    runConfig.Version,
+			Handlers:   runConfig.Handlers,
+			Strategy:   runConfig.Strategy,
+			Secrets:    runConfig.Secrets,
 		}
 	}
 
@@ -150,6 +156,8 @@ func isArrayFormat(node *yaml.Node) bool {
 // The basePath parameter is the JSON pointer prefix:
 //   - "" for old format (plain array)
 //   - "/steps" for new format (RunConfig with steps field)
+//
+// Nested block/rescue/always steps are handled recursively.
 func attachSourceLocations(steps []Step, locationMap *LocationMap, basePath string) {
 	for i := range steps {
 		// Build JSON pointer path for this step
@@ -164,37 +172,57 @@ func attachSourceLocations(steps []Step, locationMap *LocationMap, basePath stri
 				Column: pos.Column,
 			}
 		}
+
+		// Recurse into block/rescue/always groups
+		attachSourceLocations(steps[i].Block, locationMap, stepPath+"/block")
+		attachSourceLocations(steps[i].Rescue, locationMap, stepPath+"/rescue")
+		attachSourceLocations(steps[i].Always, locationMap, stepPath+"/always")
 	}
 }
 
-// ReadVariables reads variables from a YAML file
+// DecryptError is returned when an encrypted variables file can't be decrypted.
+type DecryptError struct {
+	Path string
+	Err  error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("failed to decrypt variables file %s: %v", e.Path, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return e.Err
+}
+
+// ReadVariables reads variables from a YAML file. Encrypted files are decrypted
+// with the vault password, and their values registered as secrets to redact.
 func (r *YAMLConfigReader) ReadVariables(path string) (map[string]interface{}, error) {
 	if path == "" {
 		return make(map[string]interface{}), nil
 	}
 
 	// #nosec G304 -- User-specified variables file path is intentional and required functionality
-	file, err := os.Open(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		closeErr := file.Close()
-		if closeErr != nil {
-			fmt.Fprintf(os.Stderr, "failed to close variables file %s: %v\n", path, closeErr)
-		}
-	}()
-
-	reader := bufio.NewReader(file)
+	data, encrypted, err := vault.Open(data)
+	if err != nil {
+		return nil, &DecryptError{Path: path, Err: err}
+	}
 
 	variables := make(map[string]interface{})
 
-	decoder := yaml.NewDecoder(reader)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
 	err = decoder.Decode(&variables)
 	if err != nil {
 		return nil, err
 	}
 
+	if encrypted {
+		security.RegisterSecrets(variables)
+	}
+
 	return variables, nil
 }
 
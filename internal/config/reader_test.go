@@ -1,10 +1,13 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/vault"
 	"gopkg.in/yaml.v3"
 )
 
@@ -223,6 +226,37 @@ user:
 	})
 }
 
+func TestYAMLReader_ReadVariables_Encrypted(t *testing.T) {
+	t.Cleanup(func() { vault.SetPasswordProvider(nil) })
+	encrypted, err := vault.Encrypt([]byte("api_token: vault-api-token\nport: 443\n"), "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "secrets.yml")
+	if err := os.WriteFile(path, encrypted, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	vault.SetPassword("wrong")
+	var decryptErr *DecryptError
+	if _, err := ReadVariables(path); !errors.As(err, &decryptErr) || !errors.Is(err, vault.ErrWrongPassword) {
+		t.Errorf("ReadVariables() with a wrong password error = %v", err)
+	}
+
+	vault.SetPassword("pw")
+	vars, err := ReadVariables(path)
+	if err != nil {
+		t.Fatalf("ReadVariables() error = %v", err)
+	}
+	if vars["api_token"] != "vault-api-token" || vars["port"] != 443 {
+		t.Errorf("vars = %v", vars)
+	}
+	// Decrypted values are redacted from output
+	if got := security.NewRedactor().Redact("token vault-api-token"); got != "token [REDACTED]" {
+		t.Errorf("Redact() = %q", got)
+	}
+}
+
 func TestNewYAMLConfigReader(t *testing.T) {
 	reader := NewYAMLConfigReader()
 	if reader == nil {
@@ -8,11 +8,15 @@ import (
 )
 
 // TemplateValidator validates pongo2 template syntax in configuration fields
-type TemplateValidator struct{}
+type TemplateValidator struct {
+	// Own template set: pongo2 template sets aren't safe for concurrent use,
+	// and configs may be read while others are rendered
+	set *pongo2.TemplateSet
+}
 
 // NewTemplateValidator creates a new template validator
 func NewTemplateValidator() *TemplateValidator {
-	return &TemplateValidator{}
+	return &TemplateValidator{set: pongo2.NewSet("validator", pongo2.DefaultLoader)}
 }
 
 // ValidateSyntax checks if a template string has valid pongo2 syntax
@@ -23,7 +27,10 @@ func (v *TemplateValidator) ValidateSyntax(template string) error {
 	}
 
 	// Try to parse the template to check syntax
-	_, err := pongo2.FromString(template)
+	if v.set == nil {
+		v.set = pongo2.NewSet("validator", pongo2.DefaultLoader)
+	}
+	_, err := v.set.FromString(template)
 	return err
 }
 
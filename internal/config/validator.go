@@ -49,12 +49,14 @@ func NewSchemaValidator() (*SchemaValidator, error) {
 func (v *SchemaValidator) Validate(parsedConfig *ParsedConfig, locationMap *LocationMap, filePath string) []Diagnostic {
 	// Determine which format to validate based on whether we have version/vars
 	var dataToValidate interface{}
-	if parsedConfig.Version != "" || len(parsedConfig.GlobalVars) > 0 {
+	if parsedConfig.Version != "" || len(parsedConfig.GlobalVars) > 0 || len(parsedConfig.Handlers) > 0 || parsedConfig.Strategy != "" {
 		// New format: validate as RunConfig
 		dataToValidate = RunConfig{
-			Version: parsedConfig.Version,
-			Vars:    parsedConfig.GlobalVars,
-			Steps:   parsedConfig.Steps,
+			Version:  parsedConfig.Version,
+			Vars:     parsedConfig.GlobalVars,
+			Steps:    parsedConfig.Steps,
+			Handlers: parsedConfig.Handlers,
+			Strategy: parsedConfig.Strategy,
 		}
 	} else {
 		// Old format: validate as array of steps
@@ -0,0 +1,299 @@
+// Package diff produces unified diffs of text content.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DevNull is the file name used for the missing side of a created or removed file.
+	DevNull = "/dev/null"
+
+	// contextLines is the number of unchanged lines shown around each change.
+	contextLines = 3
+
+	// binarySniffLen is how much content is searched for a NUL byte to detect
+	// binary files, as git does.
+	binarySniffLen = 8000
+
+	// maxEditDistance bounds the work spent on very different contents. Beyond it,
+	// the differing part is shown as removed and re-added as a whole.
+	maxEditDistance = 2000
+)
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// op is one line of the edit script. aPos and bPos are the positions in the
+// old and new lines before the op.
+type op struct {
+	kind opKind
+	line string
+	aPos int
+	bPos int
+}
+
+// Unified returns a unified diff turning before into after, with oldName and
+// newName in the file headers. Returns an empty string if the contents are equal.
+func Unified(oldName, newName, before, after string) string {
+	if before == after {
+		return ""
+	}
+
+	ops := editScript(splitLines(before), splitLines(after))
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n", oldName)
+	fmt.Fprintf(&buf, "+++ %s\n", newName)
+	for _, hunk := range hunks(ops) {
+		writeHunk(&buf, hunk)
+	}
+	return buf.String()
+}
+
+// File returns the unified diff of a file at path changing from before to after.
+// A nil before means the file is created and a nil after that it is removed; the
+// missing side is named DevNull. Binary contents are reported in one line.
+func File(path string, before, after []byte) string {
+	if bytes.Equal(before, after) && (before == nil) == (after == nil) {
+		return ""
+	}
+
+	oldName, newName := path, path
+	if before == nil {
+		oldName = DevNull
+	}
+	if after == nil {
+		newName = DevNull
+	}
+
+	if isBinary(before) || isBinary(after) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+	}
+	return Unified(oldName, newName, string(before), string(after))
+}
+
+// isBinary reports whether content looks binary.
+func isBinary(content []byte) bool {
+	if len(content) > binarySniffLen {
+		content = content[:binarySniffLen]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// splitLines splits text into lines, keeping the line endings.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript returns the shortest edit script turning a into b (Myers' algorithm).
+func editScript(a, b []string) []op {
+	// Common prefix and suffix are kept out of the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []op
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, op{kind: opEqual, line: a[i], aPos: i, bPos: i})
+	}
+	for _, o := range middleScript(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		o.aPos += prefix
+		o.bPos += prefix
+		ops = append(ops, o)
+	}
+	for i := suffix; i > 0; i-- {
+		ops = append(ops, op{kind: opEqual, line: a[len(a)-i], aPos: len(a) - i, bPos: len(b) - i})
+	}
+	return ops
+}
+
+// middleScript runs Myers' search on lines that differ at both ends.
+func middleScript(a, b []string) []op {
+	n, m := len(a), len(b)
+	maxD := n + m
+	if maxD > maxEditDistance {
+		maxD = maxEditDistance
+	}
+
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return replaceAll(a, b)
+	}
+
+	// Walk the trace back from the end
+	var reversed []op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, op{kind: opEqual, line: a[x-1], aPos: x - 1, bPos: y - 1})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, op{kind: opInsert, line: b[y-1], aPos: x, bPos: y - 1})
+			} else {
+				reversed = append(reversed, op{kind: opDelete, line: a[x-1], aPos: x - 1, bPos: y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	ops := make([]op, len(reversed))
+	for i, o := range reversed {
+		ops[len(reversed)-1-i] = o
+	}
+	return ops
+}
+
+// replaceAll returns a script removing all of a and adding all of b.
+func replaceAll(a, b []string) []op {
+	ops := make([]op, 0, len(a)+len(b))
+	for i, line := range a {
+		ops = append(ops, op{kind: opDelete, line: line, aPos: i, bPos: 0})
+	}
+	for i, line := range b {
+		ops = append(ops, op{kind: opInsert, line: line, aPos: len(a), bPos: i})
+	}
+	return ops
+}
+
+// hunks groups the changes of an edit script with their surrounding context.
+// Changes separated by at most twice the context share a hunk.
+func hunks(ops []op) [][]op {
+	var result [][]op
+	i := 0
+	for i < len(ops) {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		j := i
+		for j < len(ops) {
+			if ops[j].kind != opEqual {
+				end = j
+				j++
+				continue
+			}
+			run := j
+			for run < len(ops) && ops[run].kind == opEqual {
+				run++
+			}
+			if run == len(ops) || run-j > 2*contextLines {
+				break
+			}
+			j = run
+		}
+
+		stop := end + 1 + contextLines
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		result = append(result, ops[start:stop])
+		i = stop
+	}
+	return result
+}
+
+// writeHunk writes a hunk header and its lines.
+func writeHunk(buf *strings.Builder, hunk []op) {
+	oldCount, newCount := 0, 0
+	for _, o := range hunk {
+		if o.kind != opInsert {
+			oldCount++
+		}
+		if o.kind != opDelete {
+			newCount++
+		}
+	}
+
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n",
+		hunkRange(hunk[0].aPos, oldCount), hunkRange(hunk[0].bPos, newCount))
+
+	for _, o := range hunk {
+		prefix := " "
+		switch o.kind {
+		case opDelete:
+			prefix = "-"
+		case opInsert:
+			prefix = "+"
+		}
+		buf.WriteString(prefix)
+		buf.WriteString(o.line)
+		if !strings.HasSuffix(o.line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the start line and line count of one side of a hunk.
+// An empty range starts at the line before it.
+func hunkRange(pos, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", pos)
+	case 1:
+		return fmt.Sprintf("%d", pos+1)
+	}
+	return fmt.Sprintf("%d,%d", pos+1, count)
+}
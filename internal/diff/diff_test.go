@@ -0,0 +1,168 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{
+			name:   "equal",
+			before: "a\nb\n",
+			after:  "a\nb\n",
+			want:   "",
+		},
+		{
+			name:   "created",
+			before: "",
+			after:  "a\nb\n",
+			want:   "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:   "removed",
+			before: "a\n",
+			after:  "",
+			want:   "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name:   "changed line with context",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			after:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want:   "--- old\n+++ new\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name:   "no newline at end of file",
+			before: "a\nb",
+			after:  "a\nb\n",
+			want:   "--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("old", "new", tt.before, tt.after); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		before []byte
+		after  []byte
+		want   string
+	}{
+		{"unchanged", []byte("a\n"), []byte("a\n"), ""},
+		{"created", nil, []byte("a\n"), "--- /dev/null\n+++ app.conf\n@@ -0,0 +1 @@\n+a\n"},
+		{"removed", []byte("a\n"), nil, "--- app.conf\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n"},
+		{"updated", []byte("a\n"), []byte("b\n"), "--- app.conf\n+++ app.conf\n@@ -1 +1 @@\n-a\n+b\n"},
+		{"binary", []byte("a\x00"), []byte("b\x00"), "Binary files app.conf and app.conf differ\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := File("app.conf", tt.before, tt.after); got != tt.want {
+				t.Errorf("File() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified_SeparateHunks(t *testing.T) {
+	var before, after strings.Builder
+	for i := 1; i <= 20; i++ {
+		before.WriteString(strconv.Itoa(i) + "\n")
+		switch i {
+		case 2, 18:
+			after.WriteString("changed\n")
+		default:
+			after.WriteString(strconv.Itoa(i) + "\n")
+		}
+	}
+
+	got := Unified("old", "new", before.String(), after.String())
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Errorf("hunks = %d, want 2:\n%s", n, got)
+	}
+	if !strings.Contains(got, "@@ -1,5 +1,5 @@") || !strings.Contains(got, "@@ -15,6 +15,6 @@") {
+		t.Errorf("unexpected hunk headers:\n%s", got)
+	}
+}
+
+// TestUnified_Apply checks that applying the diff to before gives after.
+func TestUnified_Apply(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	words := []string{"a\n", "b\n", "c\n", "d\n"}
+	generate := func() string {
+		var s strings.Builder
+		for i := r.Intn(25); i > 0; i-- {
+			s.WriteString(words[r.Intn(len(words))])
+		}
+		if r.Intn(4) == 0 {
+			s.WriteString("last")
+		}
+		return s.String()
+	}
+
+	for i := 0; i < 200; i++ {
+		before, after := generate(), generate()
+		patched, err := apply(before, Unified("old", "new", before, after))
+		if err != nil {
+			t.Fatalf("apply failed: %v", err)
+		}
+		if patched != after {
+			t.Fatalf("patched %q = %q, want %q", before, patched, after)
+		}
+	}
+}
+
+// apply applies a unified diff produced by Unified to text.
+func apply(text, patch string) (string, error) {
+	if patch == "" {
+		return text, nil
+	}
+	lines := splitLines(text)
+	var out []string
+	next := 0         // next line of text to copy
+	appended := false // whether the last patch line was appended to out
+
+	for _, line := range splitLines(patch)[2:] {
+		switch {
+		case strings.HasPrefix(line, "@@ -"):
+			var start int
+			if _, err := fmt.Sscanf(line, "@@ -%d", &start); err != nil {
+				return "", err
+			}
+			if start > 0 && !strings.HasPrefix(line, fmt.Sprintf("@@ -%d,0 ", start)) {
+				start--
+			}
+			out = append(out, lines[next:start]...)
+			next = start
+		case strings.HasPrefix(line, "\\"):
+			if appended {
+				out[len(out)-1] = strings.TrimSuffix(out[len(out)-1], "\n")
+			}
+		case strings.HasPrefix(line, "+"):
+			out = append(out, line[1:])
+		case strings.HasPrefix(line, " "):
+			out = append(out, line[1:])
+			next++
+		case strings.HasPrefix(line, "-"):
+			next++
+		}
+		appended = strings.HasPrefix(line, "+") || strings.HasPrefix(line, " ")
+	}
+	out = append(out, lines[next:]...)
+	return strings.Join(out, ""), nil
+}
@@ -14,6 +14,17 @@ type Event struct {
 	Data      interface{} `json:"data"`
 }
 
+// Record is an event as written by event sinks, with the version of the record
+// schema and where the event happened. See Schema.
+type Record struct {
+	SchemaVersion int         `json:"schema_version"`   // Version of the record schema (SchemaVersion)
+	Type          EventType   `json:"type"`             // Type of the event, which defines the schema of data
+	Timestamp     time.Time   `json:"timestamp"`        // Time the event was emitted
+	Host          string      `json:"host"`             // Host the run applied the config to
+	RunID         string      `json:"run_id,omitempty"` // Artifacts run directory of the run, if any
+	Data          interface{} `json:"data"`             // Payload of the event
+}
+
 // EventType identifies the type of event
 type EventType string
 
@@ -30,6 +41,18 @@ const (
 	EventStepCompleted EventType = "step.completed"
 	EventStepSkipped   EventType = "step.skipped"
 	EventStepFailed    EventType = "step.failed"
+	EventStepRetry     EventType = "step.retry"
+	EventStepDiff      EventType = "step.diff"
+)
+
+// Event types for handlers
+const (
+	EventHandlerNotified EventType = "handler.notified"
+)
+
+// Event types for step groups (block/rescue/always)
+const (
+	EventBlockRescued EventType = "block.rescued"
 )
 
 // Event types for output streaming
@@ -107,6 +130,7 @@ const (
 
 // RunStartedData contains data for run.started events
 type RunStartedData struct {
+	RunID      string   `json:"run_id,omitempty"` // Artifacts run directory, if any
 	RootFile   string   `json:"root_file"`
 	Tags       []string `json:"tags,omitempty"`
 	DryRun     bool     `json:"dry_run"`
@@ -127,9 +151,33 @@ type RunCompletedData struct {
 	FailedSteps   int    `json:"failed_steps"`
 	SkippedSteps  int    `json:"skipped_steps"`
 	ChangedSteps  int    `json:"changed_steps"`
+	RescuedSteps  int    `json:"rescued_steps,omitempty"`
+	IgnoredSteps  int    `json:"ignored_steps,omitempty"`
 	DurationMs    int64  `json:"duration_ms"`
 	Success       bool   `json:"success"`
 	ErrorMessage  string `json:"error_message,omitempty"`
+
+	// UnchangedSteps counts action steps that found the system in the desired state.
+	// In dry runs, ChangedSteps and UnchangedSteps are predictions, and UncheckedSteps
+	// counts steps whose action can't predict changes.
+	UnchangedSteps int  `json:"unchanged_steps"`
+	UncheckedSteps int  `json:"unchecked_steps,omitempty"`
+	DryRun         bool `json:"dry_run,omitempty"`
+
+	// Failures lists every step that failed, including ignored ones
+	Failures []StepFailure `json:"failures,omitempty"`
+
+	// DroppedEvents counts the output events subscribers missed, as they fell
+	// too far behind (see DropCounter)
+	DroppedEvents int `json:"dropped_events,omitempty"`
+}
+
+// StepFailure describes a failed step in the run summary.
+type StepFailure struct {
+	StepID       string `json:"step_id"`
+	Name         string `json:"name"`
+	ErrorMessage string `json:"error_message"`
+	Ignored      bool   `json:"ignored,omitempty"` // Step had ignore_errors: true
 }
 
 // StepStartedData contains data for step.started events
@@ -142,7 +190,8 @@ type StepStartedData struct {
 	Tags       []string          `json:"tags,omitempty"`
 	When       string            `json:"when,omitempty"`
 	Vars       map[string]string `json:"vars,omitempty"`
-	Depth      int               `json:"depth,omitempty"` // Directory depth for filetree items
+	Depth      int               `json:"depth,omitempty"`  // Directory depth for filetree items
+	Origin     string            `json:"origin,omitempty"` // file:line of the step in its config file
 	DryRun     bool              `json:"dry_run"`
 }
 
@@ -175,9 +224,54 @@ type StepFailedData struct {
 	ErrorMessage string `json:"error_message"`
 	DurationMs   int64  `json:"duration_ms"`
 	Depth        int    `json:"depth,omitempty"` // Directory depth for filetree items
+	Ignored      bool   `json:"ignored,omitempty"` // Failure ignored via ignore_errors, run continues
+	Reason       string `json:"reason,omitempty"`  // "timeout", "cancelled", "policy" or "sandbox" when the step was stopped rather than failing
 	DryRun       bool   `json:"dry_run"`
 }
 
+// StepRetryData contains data for step.retry events.
+// Emitted when a failed attempt will be retried (after retry_delay).
+type StepRetryData struct {
+	StepID       string `json:"step_id"`
+	Name         string `json:"name"`
+	Level        int    `json:"level"`        // Nesting level of the step
+	Attempt      int    `json:"attempt"`      // Number of the upcoming attempt (2 for the first retry)
+	MaxAttempts  int    `json:"max_attempts"` // Total attempts allowed (retries + 1)
+	DelayMs      int64  `json:"delay_ms"`     // Delay before the upcoming attempt
+	ErrorMessage string `json:"error_message"`
+	DryRun       bool   `json:"dry_run"`
+}
+
+// StepDiffData contains data for step.diff events.
+// Emitted in dry runs with --diff for steps that would change file contents.
+type StepDiffData struct {
+	StepID string `json:"step_id"`
+	Name   string `json:"name"`
+	Level  int    `json:"level"`
+	Diff   string `json:"diff"` // Unified diff of the predicted changes
+	DryRun bool   `json:"dry_run"`
+}
+
+// BlockRescuedData contains data for block.rescued events.
+// Emitted after the rescue section of a block recovered from a failed step.
+type BlockRescuedData struct {
+	StepID         string `json:"step_id"`          // ID of the block step
+	Name           string `json:"name"`             // Name of the block step
+	Level          int    `json:"level"`            // Nesting level of the block step
+	FailedStepID   string `json:"failed_step_id"`   // ID of the step that failed inside the block
+	FailedStepName string `json:"failed_step_name"` // Name of the step that failed inside the block
+	ErrorMessage   string `json:"error_message"`    // Error returned by the failed step
+	DryRun         bool   `json:"dry_run"`
+}
+
+// HandlerNotifiedData contains data for handler.notified events.
+// Emitted when a changed step queues a handler.
+type HandlerNotifiedData struct {
+	StepID  string `json:"step_id"` // ID of the step that sent the notification
+	Handler string `json:"handler"` // Name of the queued handler
+	DryRun  bool   `json:"dry_run"`
+}
+
 // StepOutputData contains data for step.stdout/stderr events
 type StepOutputData struct {
 	StepID     string `json:"step_id"`
@@ -296,7 +390,7 @@ type AssertionData struct {
 	Expected string `json:"expected"`           // What was expected
 	Actual   string `json:"actual"`             // What was found
 	Failed   bool   `json:"failed"`             // Whether the assertion failed
-	StepID   string `json:"step_id,omitempty"`  // Step ID (added by event bus)
+	StepID   string `json:"step_id,omitempty"`  // ID of the assert step
 }
 
 // PresetData contains data for preset events
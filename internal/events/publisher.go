@@ -3,6 +3,9 @@ package events
 import (
 	"log"
 	"sync"
+	"sync/atomic"
+
+	"github.com/alehatsman/mooncake/internal/security"
 )
 
 // Publisher publishes events to subscribers
@@ -20,9 +23,23 @@ type Subscriber interface {
 	Close()
 }
 
-// ChannelPublisher implements Publisher using buffered channels
+// DropCounter is implemented by publishers that can drop events under
+// backpressure. The count is reported in the run summary.
+type DropCounter interface {
+	// Dropped returns the number of events dropped so far, for all subscribers.
+	Dropped() int
+}
+
+// ChannelPublisher implements Publisher with a queue and a goroutine per
+// subscriber, so slow subscribers don't slow down the run or each other.
+//
+// Lifecycle, step and file events are never dropped: they are queued in memory
+// until the subscriber takes them. Output events (step.stdout and step.stderr)
+// are also kept in memory up to outputBufferSize per subscriber; beyond that
+// they spill to a temporary file and are delivered from it, in order. Only
+// output events that can't be spilled are dropped, and counted (Dropped).
 type ChannelPublisher struct {
-	subscribers map[int]chan Event
+	subscribers map[int]*subscription
 	nextID      int
 	mu          sync.RWMutex
 	closed      bool
@@ -30,20 +47,20 @@ type ChannelPublisher struct {
 	pendingMu   sync.Mutex
 	pending     int
 	flushCond   *sync.Cond
+	dropped     atomic.Int64
 }
 
 // NewPublisher creates a new channel-based event publisher
 func NewPublisher() Publisher {
 	cp := &ChannelPublisher{
-		subscribers: make(map[int]chan Event),
+		subscribers: make(map[int]*subscription),
 		nextID:      1,
 	}
 	cp.flushCond = sync.NewCond(&cp.pendingMu)
 	return cp
 }
 
-// Publish sends an event to all subscribers
-// This is non-blocking - if a subscriber's channel is full, the event is dropped
+// Publish queues an event for all subscribers. It doesn't wait for them.
 func (p *ChannelPublisher) Publish(event Event) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -51,21 +68,26 @@ func (p *ChannelPublisher) Publish(event Event) {
 	if p.closed {
 		return
 	}
+	event = redact(event)
 
 	p.pendingMu.Lock()
-	for _, ch := range p.subscribers {
-		// Non-blocking send - drop if channel is full
-		select {
-		case ch <- event:
-			p.pending++
-		default:
-			// Channel full, drop event - log warning for visibility
-			log.Printf("Warning: event dropped for subscriber (channel full): type=%s", event.Type)
+	for _, sub := range p.subscribers {
+		if err := sub.push(event); err != nil {
+			if p.dropped.Add(1) == 1 {
+				log.Printf("Warning: dropping output events for subscriber: %v", err)
+			}
+			continue
 		}
+		p.pending++
 	}
 	p.pendingMu.Unlock()
 }
 
+// Dropped implements DropCounter.
+func (p *ChannelPublisher) Dropped() int {
+	return int(p.dropped.Load())
+}
+
 // Subscribe adds a new subscriber and returns its ID
 func (p *ChannelPublisher) Subscribe(subscriber Subscriber) int {
 	p.mu.Lock()
@@ -78,37 +100,40 @@ func (p *ChannelPublisher) Subscribe(subscriber Subscriber) int {
 	id := p.nextID
 	p.nextID++
 
-	// Create buffered channel for this subscriber
-	ch := make(chan Event, 100)
-	p.subscribers[id] = ch
+	sub := newSubscription()
+	p.subscribers[id] = sub
 
-	// Start goroutine to forward events to subscriber
+	// Start goroutine to deliver events to subscriber
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
-		for event := range ch {
-			subscriber.OnEvent(event)
-
-			// Decrement pending count after processing
-			p.pendingMu.Lock()
-			p.pending--
-			if p.pending == 0 {
-				p.flushCond.Broadcast()
-			}
-			p.pendingMu.Unlock()
-		}
+		sub.deliver(subscriber, p.done)
 	}()
 
 	return id
 }
 
-// Unsubscribe removes a subscriber
+// done records that n events were delivered, or dropped on the way.
+func (p *ChannelPublisher) done(n int, dropped int) {
+	if dropped > 0 {
+		p.dropped.Add(int64(dropped))
+	}
+	p.pendingMu.Lock()
+	p.pending -= n
+	if p.pending == 0 {
+		p.flushCond.Broadcast()
+	}
+	p.pendingMu.Unlock()
+}
+
+// Unsubscribe removes a subscriber. Events already published are still
+// delivered to it.
 func (p *ChannelPublisher) Unsubscribe(id int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if ch, ok := p.subscribers[id]; ok {
-		close(ch)
+	if sub, ok := p.subscribers[id]; ok {
+		sub.close()
 		delete(p.subscribers, id)
 	}
 }
@@ -122,8 +147,7 @@ func (p *ChannelPublisher) Flush() {
 	p.pendingMu.Unlock()
 }
 
-
-// Close closes the publisher and all subscriber channels
+// Close closes the publisher, after delivering the pending events
 func (p *ChannelPublisher) Close() {
 	p.mu.Lock()
 	if p.closed {
@@ -132,14 +156,13 @@ func (p *ChannelPublisher) Close() {
 	}
 	p.closed = true
 
-	// Close all subscriber channels
-	for _, ch := range p.subscribers {
-		close(ch)
+	for _, sub := range p.subscribers {
+		sub.close()
 	}
-	p.subscribers = make(map[int]chan Event)
+	p.subscribers = make(map[int]*subscription)
 	p.mu.Unlock()
 
-	// Wait for all forwarding goroutines to finish
+	// Wait for all delivery goroutines to finish
 	p.wg.Wait()
 }
 
@@ -169,6 +192,7 @@ func (p *SyncPublisher) Publish(event Event) {
 	if p.closed {
 		return
 	}
+	event = redact(event)
 
 	for _, sub := range p.subscribers {
 		sub.OnEvent(event)
@@ -214,3 +238,12 @@ func (p *SyncPublisher) Close() {
 	p.closed = true
 	p.subscribers = make(map[int]Subscriber)
 }
+
+// redact replaces registered secrets in the data of an event, so that they
+// reach no subscriber.
+func redact(event Event) Event {
+	if data, ok := security.RedactValue(event.Data); ok {
+		event.Data = data
+	}
+	return event
+}
@@ -1,9 +1,13 @@
 package events
 
 import (
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/alehatsman/mooncake/internal/security"
 )
 
 // TestPublisherBasic tests basic publisher functionality
@@ -441,3 +445,202 @@ func TestSyncPublisher_ConcurrentAccess(t *testing.T) {
 
 	wg.Wait()
 }
+
+// TestPublisher_SlowSubscriber tests that a subscriber far behind the run gets
+// every event in order: output events spill to disk, others stay in memory.
+func TestPublisher_SlowSubscriber(t *testing.T) {
+	spillDir := t.TempDir()
+	t.Setenv("TMPDIR", spillDir)
+
+	publisher := NewPublisher()
+	release := make(chan struct{})
+	var received []Event
+	var mu sync.Mutex
+	publisher.Subscribe(&testSubscriber{onEvent: func(e Event) {
+		<-release
+		mu.Lock()
+		received = append(received, e)
+		mu.Unlock()
+	}})
+
+	const total = 5100 // Five times outputBufferSize, with a step.completed every 100 lines
+	for i := 0; i < total; i++ {
+		if i%100 == 0 {
+			publisher.Publish(Event{Type: EventStepCompleted, Data: StepCompletedData{StepID: "step", Level: i}})
+		}
+		publisher.Publish(Event{Type: EventStepStdout, Timestamp: time.Now(), Data: StepOutputData{StepID: "step", Stream: "stdout", LineNumber: i}})
+	}
+	if entries, _ := os.ReadDir(spillDir); len(entries) != 1 {
+		t.Errorf("spill files = %d, want 1", len(entries))
+	}
+
+	close(release)
+	publisher.Flush()
+	// The spill file is removed once drained, before the subscriber is closed
+	if entries, _ := os.ReadDir(spillDir); len(entries) != 0 {
+		t.Errorf("spill files left after they were drained: %d", len(entries))
+	}
+	publisher.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != total+total/100 {
+		t.Fatalf("received %d events, want %d", len(received), total+total/100)
+	}
+	line := 0
+	for i, e := range received {
+		if i%101 == 0 {
+			if data, ok := e.Data.(StepCompletedData); !ok || data.Level != line {
+				t.Fatalf("event %d = %+v, want step.completed before line %d", i, e, line)
+			}
+			continue
+		}
+		if data, ok := e.Data.(StepOutputData); !ok || data.LineNumber != line || e.Type != EventStepStdout {
+			t.Fatalf("event %d = %+v, want line %d", i, e, line)
+		}
+		line++
+	}
+	if dropped := publisher.(DropCounter).Dropped(); dropped != 0 {
+		t.Errorf("Dropped() = %d, want 0", dropped)
+	}
+	if entries, _ := os.ReadDir(spillDir); len(entries) != 0 {
+		t.Errorf("spill files left after Close: %d", len(entries))
+	}
+}
+
+// TestSpillFile_Backlog tests that the spill file limit bounds the events not
+// read yet, not every event ever written.
+func TestSpillFile_Backlog(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	spill, err := newSpillFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.remove()
+
+	event := Event{Type: EventStepStdout, Data: StepOutputData{Line: "x"}}
+	if err := spill.write(event); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spill.read(); err != nil {
+		t.Fatal(err)
+	}
+	spill.written += maxSpillBytes
+	spill.consumed.Add(maxSpillBytes)
+	if err := spill.write(event); err != nil {
+		t.Errorf("write() after the backlog was read = %v, want nil", err)
+	}
+	spill.written += maxSpillBytes
+	if err := spill.write(event); err == nil {
+		t.Error("write() with a full backlog should fail")
+	}
+}
+
+// TestPublisher_SpillFailure tests that only output events are dropped, and
+// counted, when they can't spill to disk.
+func TestPublisher_SpillFailure(t *testing.T) {
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+
+	publisher := NewPublisher()
+	release := make(chan struct{})
+	var completed, output int
+	var mu sync.Mutex
+	publisher.Subscribe(&testSubscriber{onEvent: func(e Event) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type == EventStepCompleted {
+			completed++
+		} else {
+			output++
+		}
+	}})
+
+	for i := 0; i < 2*outputBufferSize; i++ {
+		publisher.Publish(Event{Type: EventStepStdout, Data: StepOutputData{LineNumber: i}})
+		publisher.Publish(Event{Type: EventStepCompleted, Data: StepCompletedData{}})
+	}
+	close(release)
+	publisher.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The subscriber may have taken the first event before blocking
+	if completed != 2*outputBufferSize || output < outputBufferSize || output > outputBufferSize+1 {
+		t.Errorf("received %d step.completed and %d output events", completed, output)
+	}
+	if dropped := publisher.(DropCounter).Dropped(); dropped != 2*outputBufferSize-output {
+		t.Errorf("Dropped() = %d, want %d", dropped, 2*outputBufferSize-output)
+	}
+}
+
+// TestPublisher_UnsubscribeDelivers tests that events published before
+// Unsubscribe are still delivered.
+func TestPublisher_UnsubscribeDelivers(t *testing.T) {
+	publisher := NewPublisher()
+	defer publisher.Close()
+
+	release := make(chan struct{})
+	var received int
+	var mu sync.Mutex
+	id := publisher.Subscribe(&testSubscriber{onEvent: func(e Event) {
+		<-release
+		mu.Lock()
+		received++
+		mu.Unlock()
+	}})
+	for i := 0; i < 3; i++ {
+		publisher.Publish(Event{Type: EventStepStarted, Data: StepStartedData{}})
+	}
+	publisher.Unsubscribe(id)
+	publisher.Publish(Event{Type: EventStepStarted, Data: StepStartedData{}})
+	close(release)
+	publisher.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if received != 3 {
+		t.Errorf("received %d events, want 3", received)
+	}
+}
+
+func TestPublisher_RedactsSecrets(t *testing.T) {
+	t.Cleanup(security.ResetSecrets)
+	security.RegisterSecret("publisher-test-secret")
+
+	for name, publisher := range map[string]Publisher{
+		"channel": NewPublisher(),
+		"sync":    NewSyncPublisher(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var received []Event
+			publisher.Subscribe(&testSubscriber{onEvent: func(e Event) {
+				mu.Lock()
+				defer mu.Unlock()
+				received = append(received, e)
+			}})
+
+			output := StepOutputData{StepID: "step-0001", Stream: "stdout", Line: "token=publisher-test-secret", LineNumber: 1}
+			publisher.Publish(Event{Type: EventStepStdout, Timestamp: time.Now(), Data: output})
+			publisher.Flush()
+			publisher.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(received) != 1 {
+				t.Fatalf("received %d events, want 1", len(received))
+			}
+			data, ok := received[0].Data.(StepOutputData)
+			if !ok {
+				t.Fatalf("event data is %T, want StepOutputData", received[0].Data)
+			}
+			if data.Line != "token=[REDACTED]" || data.StepID != "step-0001" {
+				t.Errorf("event data = %+v, want the secret redacted", data)
+			}
+			if output.Line != "token=publisher-test-secret" {
+				t.Errorf("Publish() modified the published data")
+			}
+		})
+	}
+}
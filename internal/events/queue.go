@@ -0,0 +1,233 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// outputBufferSize is the number of output events a subscriber can fall
+	// behind before they spill to disk.
+	outputBufferSize = 1024
+
+	// maxSpillBytes bounds the unread events in the spill file of a subscriber;
+	// output events beyond it are dropped.
+	maxSpillBytes = 512 << 20
+)
+
+// subscription is the queue of events of a subscriber.
+type subscription struct {
+	mu      sync.Mutex
+	ready   *sync.Cond // Signals queued events and close
+	queue   []queued
+	outputs int // Output events queued in memory
+	spilled int // Output events in the spill file not taken by deliver yet
+	closed  bool
+	spill   *spillFile
+}
+
+// queued is an event in memory, or a run of consecutive output events in the
+// spill file.
+type queued struct {
+	event   Event
+	spilled int
+}
+
+func newSubscription() *subscription {
+	s := &subscription{}
+	s.ready = sync.NewCond(&s.mu)
+	return s
+}
+
+// isOutput reports whether an event is command output, which may spill to disk
+// under backpressure.
+func isOutput(event Event) bool {
+	_, ok := event.Data.(StepOutputData)
+	return ok && (event.Type == EventStepStdout || event.Type == EventStepStderr)
+}
+
+// push queues an event. It fails only for output events that can't be spilled.
+func (s *subscription) push(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !isOutput(event) || s.outputs < outputBufferSize {
+		if isOutput(event) {
+			s.outputs++
+		}
+		s.queue = append(s.queue, queued{event: event})
+		s.ready.Signal()
+		return nil
+	}
+
+	if s.spill == nil {
+		spill, err := newSpillFile()
+		if err != nil {
+			return err
+		}
+		s.spill = spill
+	}
+	if err := s.spill.write(event); err != nil {
+		return err
+	}
+	s.spilled++
+	if last := len(s.queue) - 1; last >= 0 && s.queue[last].spilled > 0 {
+		s.queue[last].spilled++
+	} else {
+		s.queue = append(s.queue, queued{spilled: 1})
+	}
+	s.ready.Signal()
+	return nil
+}
+
+// close stops the subscription once the queued events are delivered.
+func (s *subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.ready.Signal()
+}
+
+// deliver delivers the queued events to subscriber in order, until the
+// subscription is closed. done is called after each event.
+func (s *subscription) deliver(subscriber Subscriber, done func(n, dropped int)) {
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.ready.Wait()
+		}
+		if len(s.queue) == 0 {
+			spill := s.spill
+			s.spill = nil
+			s.mu.Unlock()
+			if spill != nil {
+				spill.remove()
+			}
+			return
+		}
+
+		next := &s.queue[0]
+		event, fromSpill := next.event, next.spilled > 0
+		spill := s.spill
+		if fromSpill {
+			s.spilled--
+			next.spilled--
+			if next.spilled == 0 {
+				s.queue = s.queue[1:]
+			}
+		} else {
+			s.queue = s.queue[1:]
+			if isOutput(event) {
+				s.outputs--
+			}
+		}
+		s.mu.Unlock()
+
+		if fromSpill {
+			// Only this goroutine reads the spill file, after push wrote the event
+			var err error
+			event, err = spill.read()
+			s.releaseSpill(spill)
+			if err != nil {
+				done(1, 1)
+				continue
+			}
+		}
+		subscriber.OnEvent(event)
+		done(1, 0)
+	}
+}
+
+// releaseSpill removes the spill file once every event in it has been read, so
+// it doesn't keep growing over a long run. The next spilled event starts a new
+// one.
+func (s *subscription) releaseSpill(spill *spillFile) {
+	s.mu.Lock()
+	drained := s.spill == spill && s.spilled == 0
+	if drained {
+		s.spill = nil
+	}
+	s.mu.Unlock()
+	if drained {
+		spill.remove()
+	}
+}
+
+// spillFile holds the output events a subscriber is behind on, as JSON lines.
+type spillFile struct {
+	path     string
+	writer   *os.File
+	reader   *bufio.Reader
+	file     *os.File // Read side
+	written  int64
+	consumed atomic.Int64 // Bytes read, by the delivering goroutine
+	broken   error        // A failed write left a partial line: the file takes no more events
+}
+
+// spilledEvent is the encoding of an output event in a spill file.
+type spilledEvent struct {
+	Type      EventType      `json:"type"`
+	Timestamp time.Time      `json:"timestamp"`
+	Data      StepOutputData `json:"data"`
+}
+
+func newSpillFile() (*spillFile, error) {
+	writer, err := os.CreateTemp("", "mooncake-events-*.jsonl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	reader, err := os.Open(writer.Name())
+	if err != nil {
+		_ = writer.Close()
+		_ = os.Remove(writer.Name())
+		return nil, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	return &spillFile{path: writer.Name(), writer: writer, file: reader, reader: bufio.NewReader(reader)}, nil
+}
+
+// write appends an output event.
+func (f *spillFile) write(event Event) error {
+	if f.broken != nil {
+		return f.broken
+	}
+	if f.written-f.consumed.Load() >= maxSpillBytes {
+		return fmt.Errorf("spill file %s is full", f.path)
+	}
+	data, err := json.Marshal(spilledEvent{Type: event.Type, Timestamp: event.Timestamp, Data: event.Data.(StepOutputData)})
+	if err != nil {
+		return err
+	}
+	n, err := f.writer.Write(append(data, '\n'))
+	f.written += int64(n)
+	if err != nil {
+		f.broken = fmt.Errorf("failed to write spill file: %w", err)
+		return f.broken
+	}
+	return nil
+}
+
+// read returns the next output event.
+func (f *spillFile) read() (Event, error) {
+	line, err := f.reader.ReadBytes('\n')
+	f.consumed.Add(int64(len(line)))
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	var spilled spilledEvent
+	if err := json.Unmarshal(line, &spilled); err != nil {
+		return Event{}, fmt.Errorf("failed to decode spilled event: %w", err)
+	}
+	return Event{Type: spilled.Type, Timestamp: spilled.Timestamp, Data: spilled.Data}, nil
+}
+
+// remove deletes the spill file.
+func (f *spillFile) remove() {
+	_ = f.writer.Close()
+	_ = f.file.Close()
+	_ = os.Remove(f.path)
+}
@@ -0,0 +1,24 @@
+package events
+
+// Recorder is a subscriber that keeps the run ID, predicted changes and summary
+// of a run. It isn't safe for concurrent use: subscribe it to a SyncPublisher.
+type Recorder struct {
+	RunID   string
+	Diffs   []StepDiffData
+	Summary *RunCompletedData
+}
+
+// OnEvent implements Subscriber.
+func (r *Recorder) OnEvent(event Event) {
+	switch data := event.Data.(type) {
+	case RunStartedData:
+		r.RunID = data.RunID
+	case StepDiffData:
+		r.Diffs = append(r.Diffs, data)
+	case RunCompletedData:
+		r.Summary = &data
+	}
+}
+
+// Close implements Subscriber.
+func (r *Recorder) Close() {}
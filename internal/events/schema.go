@@ -0,0 +1,271 @@
+package events
+
+import (
+	_ "embed"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the Record schema. It is incremented when a
+// change can break consumers: a field is removed, renamed or changes type.
+// Adding fields and event types doesn't change it.
+const SchemaVersion = 1
+
+// SchemaID is the $id of the Record JSON Schema.
+const SchemaID = "https://mooncake.dev/schemas/events.json"
+
+// payloadTypes are the payloads of the event types. Event types missing here
+// have no fixed payload.
+var payloadTypes = map[EventType]interface{}{
+	EventRunStarted:              RunStartedData{},
+	EventPlanLoaded:              PlanLoadedData{},
+	EventRunCompleted:            RunCompletedData{},
+	EventStepStarted:             StepStartedData{},
+	EventStepCompleted:           StepCompletedData{},
+	EventStepSkipped:             StepSkippedData{},
+	EventStepFailed:              StepFailedData{},
+	EventStepRetry:               StepRetryData{},
+	EventStepDiff:                StepDiffData{},
+	EventHandlerNotified:         HandlerNotifiedData{},
+	EventBlockRescued:            BlockRescuedData{},
+	EventStepStdout:              StepOutputData{},
+	EventStepStderr:              StepOutputData{},
+	EventFileCreated:             FileOperationData{},
+	EventFileUpdated:             FileOperationData{},
+	EventFileRemoved:             FileOperationData{},
+	EventDirCreated:              FileOperationData{},
+	EventDirRemoved:              FileOperationData{},
+	EventFileCopied:              FileCopiedData{},
+	EventFileDownloaded:          FileDownloadedData{},
+	EventLinkCreated:             LinkCreatedData{},
+	EventPermissionsChanged:      PermissionsChangedData{},
+	EventTemplateRender:          TemplateRenderData{},
+	EventArchiveExtracted:        ArchiveExtractedData{},
+	EventVarsSet:                 VarsSetData{},
+	EventVarsLoaded:              VarsLoadedData{},
+	EventServiceManaged:          ServiceManagementData{},
+	EventAssertPassed:            AssertionData{},
+	EventAssertFailed:            AssertionData{},
+	EventPresetExpanded:          PresetData{},
+	EventPresetCompleted:         PresetData{},
+	EventArtifactCaptureStart:    ArtifactCaptureData{},
+	EventArtifactCaptureComplete: ArtifactCaptureData{},
+	EventPrintMessage:            PrintData{},
+}
+
+// eventSource is the source of the event types and payloads, whose comments
+// document the schema.
+//
+//go:embed event.go
+var eventSource []byte
+
+// Schema returns the JSON Schema (draft 2020-12) of Record: the envelope, and
+// the payload of every event type, selected by type. Descriptions are the doc
+// comments of the Go types and fields.
+func Schema() map[string]interface{} {
+	docs := parseDocs()
+	builder := &schemaBuilder{docs: docs, defs: make(map[string]interface{})}
+
+	record := builder.object(reflect.TypeOf(Record{}))
+	properties := record["properties"].(map[string]interface{})
+	properties["schema_version"] = withDescription(map[string]interface{}{"const": SchemaVersion}, properties["schema_version"])
+	types := make([]interface{}, 0, len(docs.eventTypes))
+	for _, eventType := range docs.eventTypes {
+		types = append(types, string(eventType.name))
+	}
+	properties["type"] = withDescription(map[string]interface{}{"type": "string", "enum": types}, properties["type"])
+
+	var payloads []interface{}
+	for _, eventType := range docs.eventTypes {
+		payload, ok := payloadTypes[eventType.name]
+		if !ok {
+			continue
+		}
+		payloads = append(payloads, map[string]interface{}{
+			"if": map[string]interface{}{
+				"properties": map[string]interface{}{"type": map[string]interface{}{"const": string(eventType.name)}},
+			},
+			"then": map[string]interface{}{
+				"description": eventType.doc,
+				"properties":  map[string]interface{}{"data": builder.schema(reflect.TypeOf(payload))},
+			},
+		})
+	}
+
+	schema := map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"$id":         SchemaID,
+		"title":       "Mooncake event record",
+		"description": docs.types["Record"].doc,
+		"allOf":       payloads,
+		"$defs":       builder.defs,
+	}
+	for key, value := range record {
+		schema[key] = value
+	}
+	return schema
+}
+
+// withDescription copies the description of a property schema to schema.
+func withDescription(schema map[string]interface{}, property interface{}) map[string]interface{} {
+	if description, ok := property.(map[string]interface{})["description"]; ok {
+		schema["description"] = description
+	}
+	return schema
+}
+
+// schemaBuilder builds the schemas of Go types, with their structs in defs.
+type schemaBuilder struct {
+	docs *sourceDocs
+	defs map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of values of type t.
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullable(b.schema(t.Elem()))
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return nullable(map[string]interface{}{"type": "array", "items": b.schema(t.Elem())})
+	case reflect.Map:
+		return nullable(map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())})
+	case reflect.Struct:
+		if t == timeType {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		if _, ok := b.defs[t.Name()]; !ok {
+			b.defs[t.Name()] = nil // Recursive types refer to the definition being built
+			b.defs[t.Name()] = b.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	default:
+		// interface{}: any value
+		return map[string]interface{}{}
+	}
+}
+
+// nullable returns schema, also accepting null: the encoding of nil pointers,
+// slices and maps.
+func nullable(schema map[string]interface{}) map[string]interface{} {
+	if typeName, ok := schema["type"].(string); ok {
+		schema["type"] = []string{typeName, "null"}
+		return schema
+	}
+	return map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+}
+
+// object returns the schema of the struct type t, with its JSON fields.
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	doc := b.docs.types[t.Name()]
+	properties := make(map[string]interface{})
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		property := b.schema(field.Type)
+		if description := doc.fields[field.Name]; description != "" {
+			property["description"] = description
+		}
+		properties[name] = property
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	object := map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	if doc.doc != "" {
+		object["description"] = doc.doc
+	}
+	return object
+}
+
+// sourceDocs are the doc comments of event.go.
+type sourceDocs struct {
+	eventTypes []eventTypeDoc     // In the order of their declaration
+	types      map[string]typeDoc // By type name
+}
+
+type eventTypeDoc struct {
+	name EventType
+	doc  string // Comment of the const group, e.g. "Event types for step lifecycle"
+}
+
+type typeDoc struct {
+	doc    string
+	fields map[string]string // Field comments by Go field name
+}
+
+// parseDocs reads the doc comments of the embedded event.go.
+func parseDocs() *sourceDocs {
+	docs := &sourceDocs{types: make(map[string]typeDoc)}
+	file, err := parser.ParseFile(token.NewFileSet(), "event.go", eventSource, parser.ParseComments)
+	if err != nil {
+		// The source compiled, so it parses
+		panic(err)
+	}
+
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			switch spec := spec.(type) {
+			case *ast.ValueSpec:
+				if ident, ok := spec.Type.(*ast.Ident); !ok || ident.Name != "EventType" {
+					continue
+				}
+				for _, value := range spec.Values {
+					if literal, ok := value.(*ast.BasicLit); ok && literal.Kind == token.STRING {
+						docs.eventTypes = append(docs.eventTypes, eventTypeDoc{
+							name: EventType(strings.Trim(literal.Value, `"`)),
+							doc:  commentText(genDecl.Doc),
+						})
+					}
+				}
+			case *ast.TypeSpec:
+				structType, ok := spec.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				doc := typeDoc{doc: commentText(genDecl.Doc), fields: make(map[string]string)}
+				for _, field := range structType.Fields.List {
+					text := commentText(field.Doc)
+					if text == "" {
+						text = commentText(field.Comment)
+					}
+					for _, name := range field.Names {
+						doc.fields[name.Name] = text
+					}
+				}
+				docs.types[spec.Name.Name] = doc
+			}
+		}
+	}
+	return docs
+}
+
+// commentText returns a comment as one line.
+func commentText(group *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
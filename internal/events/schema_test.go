@@ -0,0 +1,130 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+	data, err := json.Marshal(Schema())
+	if err != nil {
+		t.Fatalf("failed to encode schema: %v", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(SchemaID, strings.NewReader(string(data))); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := compiler.Compile(SchemaID)
+	if err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	return schema
+}
+
+// validateRecord validates a record, encoded as JSON, against the schema.
+func validateRecord(t *testing.T, schema *jsonschema.Schema, record interface{}) error {
+	t.Helper()
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatal(err)
+	}
+	return schema.Validate(value)
+}
+
+func TestSchema_Docs(t *testing.T) {
+	docs := parseDocs()
+	declared := make(map[EventType]bool)
+	for _, eventType := range docs.eventTypes {
+		declared[eventType.name] = true
+		if eventType.doc == "" {
+			t.Errorf("event type %s has no doc comment", eventType.name)
+		}
+	}
+	for _, eventType := range []EventType{EventRunStarted, EventStepDiff, EventPrintMessage, EventAgentLoopComplete} {
+		if !declared[eventType] {
+			t.Errorf("event type %s not found in event.go", eventType)
+		}
+	}
+	for eventType := range payloadTypes {
+		if !declared[eventType] {
+			t.Errorf("payload of undeclared event type %s", eventType)
+		}
+	}
+
+	schema := Schema()
+	if schema["description"] == "" || schema["$id"] != SchemaID {
+		t.Errorf("schema header = %v, %v", schema["description"], schema["$id"])
+	}
+	defs := schema["$defs"].(map[string]interface{})
+	for _, payload := range payloadTypes {
+		name := reflect.TypeOf(payload).Name()
+		def, ok := defs[name].(map[string]interface{})
+		if !ok {
+			t.Errorf("no definition of %s", name)
+			continue
+		}
+		if def["description"] == nil {
+			t.Errorf("definition of %s has no description", name)
+		}
+	}
+	if _, ok := defs["StepFailure"]; !ok {
+		t.Error("no definition of the nested StepFailure")
+	}
+
+	retry := defs["StepRetryData"].(map[string]interface{})["properties"].(map[string]interface{})
+	if got := retry["attempt"].(map[string]interface{})["description"]; got != "Number of the upcoming attempt (2 for the first retry)" {
+		t.Errorf("attempt description = %v", got)
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema := compileSchema(t)
+	now := time.Now()
+
+	for eventType, payload := range payloadTypes {
+		record := Record{SchemaVersion: SchemaVersion, Type: eventType, Timestamp: now, Host: "laptop", Data: payload}
+		if err := validateRecord(t, schema, record); err != nil {
+			t.Errorf("record of %s is invalid: %v", eventType, err)
+		}
+	}
+
+	valid := Record{SchemaVersion: SchemaVersion, Type: EventStepFailed, Timestamp: now, Host: "laptop", RunID: "20260101-120000-abcdef",
+		Data: StepFailedData{StepID: "1", Name: "install", ErrorMessage: "exit status 1", Ignored: true}}
+	if err := validateRecord(t, schema, valid); err != nil {
+		t.Errorf("valid record: %v", err)
+	}
+	enabled := true
+	service := Record{SchemaVersion: SchemaVersion, Type: EventServiceManaged, Timestamp: now, Host: "laptop",
+		Data: ServiceManagementData{Service: "nginx", Enabled: &enabled, Operations: []string{"start"}}}
+	if err := validateRecord(t, schema, service); err != nil {
+		t.Errorf("service record: %v", err)
+	}
+	// Event types without fixed payload accept any data
+	agent := Record{SchemaVersion: SchemaVersion, Type: EventAgentLoopComplete, Timestamp: now, Host: "laptop", Data: map[string]int{"iterations": 2}}
+	if err := validateRecord(t, schema, agent); err != nil {
+		t.Errorf("agent record: %v", err)
+	}
+
+	invalid := map[string]interface{}{
+		"wrong version": map[string]interface{}{"schema_version": 2, "type": "print.message", "timestamp": now, "host": "h", "data": PrintData{}},
+		"unknown type":  map[string]interface{}{"schema_version": 1, "type": "nope", "timestamp": now, "host": "h", "data": nil},
+		"missing host":  map[string]interface{}{"schema_version": 1, "type": "print.message", "timestamp": now, "data": PrintData{}},
+		"wrong payload": map[string]interface{}{"schema_version": 1, "type": "run.started", "timestamp": now, "host": "h", "data": PrintData{}},
+		"wrong field":   map[string]interface{}{"schema_version": 1, "type": "step.retry", "timestamp": now, "host": "h", "data": map[string]interface{}{"attempt": "two"}},
+	}
+	for name, record := range invalid {
+		if err := validateRecord(t, schema, record); err == nil {
+			t.Errorf("%s: record is valid", name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package executor
+
+import (
+	"errors"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// FailedStepVariable is the variable exposed to rescue steps describing the block failure.
+// It is a map with "id", "name" and "error" keys.
+const FailedStepVariable = "failed_step"
+
+// executionScope captures the display and location state changed while running nested steps
+// (block sections, handlers).
+type executionScope struct {
+	level         int
+	currentIndex  int
+	totalSteps    int
+	currentDir    string
+	currentFile   string
+	currentStepID string
+}
+
+func saveExecutionScope(ec *ExecutionContext) executionScope {
+	return executionScope{
+		level:         ec.Level,
+		currentIndex:  ec.CurrentIndex,
+		totalSteps:    ec.TotalSteps,
+		currentDir:    ec.CurrentDir,
+		currentFile:   ec.CurrentFile,
+		currentStepID: ec.CurrentStepID,
+	}
+}
+
+func (s executionScope) restore(ec *ExecutionContext) {
+	ec.Level = s.level
+	ec.CurrentIndex = s.currentIndex
+	ec.TotalSteps = s.totalSteps
+	ec.CurrentDir = s.currentDir
+	ec.CurrentFile = s.currentFile
+	ec.CurrentStepID = s.currentStepID
+}
+
+// ExecuteBlock runs a block/rescue/always step group.
+//
+// Block steps run in order and stop at the first failure. If the group has
+// rescue steps, they run next with the failure exposed as the failed_step
+// variable, which is only visible to rescue; when rescue succeeds the block counts as rescued instead of failed.
+// Always steps run last, regardless of the outcome of block and rescue.
+// The first unrecovered error is returned once always has finished.
+//
+// Nested steps share the variables of the enclosing scope, so values registered
+// inside the group remain available to later steps.
+//
+// INTERNAL: This function is exported for testing purposes only and is not part of
+// the public API. It may change or be removed in future versions without notice.
+func ExecuteBlock(step config.Step, ec *ExecutionContext) error {
+	scope := saveExecutionScope(ec)
+	blockID := ec.CurrentStepID
+
+	failuresBefore := 0
+	if ec.Failures != nil {
+		failuresBefore = ec.Failures.Len()
+	}
+
+	ec.Level = scope.level + 1
+	changed, blockErr := executeBlockSection(step.Block, ec)
+
+	rescued := false
+	if blockErr != nil && len(step.Rescue) > 0 {
+		failedID, failedName := blockID, step.Name
+		var stepErr *StepError
+		if errors.As(blockErr, &stepErr) {
+			failedID, failedName = stepErr.StepID, stepErr.Name
+		}
+		errorMessage := blockErr.Error()
+
+		// failed_step is scoped to rescue; keep the value of an enclosing rescue
+		previous, hadPrevious := ec.Variables[FailedStepVariable]
+		ec.Variables[FailedStepVariable] = map[string]interface{}{
+			"id":    failedID,
+			"name":  failedName,
+			"error": errorMessage,
+		}
+
+		rescueChanged, rescueErr := executeBlockSection(step.Rescue, ec)
+		if hadPrevious {
+			ec.Variables[FailedStepVariable] = previous
+		} else {
+			delete(ec.Variables, FailedStepVariable)
+		}
+		changed = changed || rescueChanged
+		blockErr = rescueErr
+
+		if rescueErr == nil {
+			rescued = true
+
+			// The failure was handled, so it no longer counts against the run
+			if ec.Failures != nil {
+				ec.Stats.add(ec.Stats.Failed, -ec.Failures.discard(ec.failureScope, failuresBefore))
+			}
+			ec.Stats.add(ec.Stats.Rescued, 1)
+
+			ec.EmitEvent(events.EventBlockRescued, events.BlockRescuedData{
+				StepID:         blockID,
+				Name:           step.Name,
+				Level:          scope.level,
+				FailedStepID:   failedID,
+				FailedStepName: failedName,
+				ErrorMessage:   errorMessage,
+				DryRun:         ec.DryRun,
+			})
+		}
+	}
+
+	if len(step.Always) > 0 {
+		alwaysChanged, alwaysErr := executeBlockSection(step.Always, ec)
+		changed = changed || alwaysChanged
+		if blockErr == nil {
+			blockErr = alwaysErr
+		}
+	}
+
+	scope.restore(ec)
+
+	if blockErr != nil {
+		return blockErr
+	}
+
+	result := NewResult()
+	result.Changed = changed
+	result.Data = map[string]interface{}{
+		"rescued": rescued,
+	}
+	ec.CurrentResult = result
+
+	if step.Register != "" {
+		result.RegisterTo(ec.Variables, step.Register)
+	}
+
+	return nil
+}
+
+// executeBlockSection runs one section of a step group and reports whether any step changed.
+func executeBlockSection(steps []config.Step, ec *ExecutionContext) (bool, error) {
+	ec.TotalSteps = len(steps)
+
+	changed := false
+	for i, step := range steps {
+		ec.CurrentIndex = i
+		prepareStepScope(step, ec)
+
+		stepChanged, err := executeStep(step, ec)
+		if err != nil {
+			return changed, err
+		}
+		changed = changed || stepChanged
+	}
+	return changed, nil
+}
@@ -0,0 +1,264 @@
+package executor_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/expression"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/pathutil"
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/template"
+)
+
+// eventRecorder collects events published during a test.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (r *eventRecorder) OnEvent(event events.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) Close() {}
+
+func (r *eventRecorder) ofType(eventType events.EventType) []events.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var matched []events.Event
+	for _, event := range r.events {
+		if event.Type == eventType {
+			matched = append(matched, event)
+		}
+	}
+	return matched
+}
+
+func newBlockTestContext(t *testing.T) (*executor.ExecutionContext, *eventRecorder) {
+	t.Helper()
+
+	renderer, err := template.NewPongo2Renderer()
+	if err != nil {
+		t.Fatalf("Failed to create renderer: %v", err)
+	}
+
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+
+	ec := &executor.ExecutionContext{
+		Variables:      make(map[string]interface{}),
+		Logger:         logger.NewTestLogger(),
+		Template:       renderer,
+		Evaluator:      expression.NewGovaluateEvaluator(),
+		PathUtil:       pathutil.NewPathExpander(renderer),
+		CurrentDir:     t.TempDir(),
+		Stats:          executor.NewExecutionStats(),
+		Redactor:       security.NewRedactor(),
+		EventPublisher: publisher,
+		Failures:       executor.NewFailureTracker(),
+	}
+	return ec, recorder
+}
+
+func shellStep(id, name, cmd string) config.Step {
+	return config.Step{ID: id, Name: name, Shell: &config.ShellAction{Cmd: cmd}}
+}
+
+func TestExecuteBlock_Success(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	marker := filepath.Join(ec.CurrentDir, "always")
+
+	step := config.Step{
+		ID:   "step-0001",
+		Name: "group",
+		Block: []config.Step{
+			shellStep("step-0002", "first", "echo first"),
+			shellStep("step-0003", "second", "echo second"),
+		},
+		Rescue: []config.Step{
+			shellStep("step-0004", "rescue", "echo rescue"),
+		},
+		Always: []config.Step{
+			shellStep("step-0005", "always", "touch "+marker),
+		},
+		Register: "group_result",
+	}
+
+	if err := executor.ExecuteStep(step, ec); err != nil {
+		t.Fatalf("ExecuteStep() error = %v", err)
+	}
+
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("always section did not run: %v", err)
+	}
+	for _, event := range recorder.ofType(events.EventStepStarted) {
+		if event.Data.(events.StepStartedData).StepID == "step-0004" {
+			t.Error("rescue section should not run when block succeeds")
+		}
+	}
+	if *ec.Stats.Failed != 0 || *ec.Stats.Rescued != 0 {
+		t.Errorf("Failed/Rescued = %d/%d, want 0/0", *ec.Stats.Failed, *ec.Stats.Rescued)
+	}
+
+	// Nested steps are reported one level below the block
+	for _, event := range recorder.ofType(events.EventStepCompleted) {
+		data := event.Data.(events.StepCompletedData)
+		wantLevel := 1
+		if data.StepID == "step-0001" {
+			wantLevel = 0
+		}
+		if data.Level != wantLevel {
+			t.Errorf("step %s level = %d, want %d", data.StepID, data.Level, wantLevel)
+		}
+	}
+
+	registered, ok := ec.Variables["group_result"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("block result not registered, got %T", ec.Variables["group_result"])
+	}
+	if registered["changed"] != true {
+		t.Errorf("registered changed = %v, want true", registered["changed"])
+	}
+}
+
+func TestExecuteBlock_Rescue(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	marker := filepath.Join(ec.CurrentDir, "always")
+
+	step := config.Step{
+		ID:   "step-0001",
+		Name: "group",
+		Block: []config.Step{
+			shellStep("step-0002", "broken", "exit 3"),
+			shellStep("step-0003", "never", "echo never"),
+		},
+		Rescue: []config.Step{
+			{
+				ID:   "step-0004",
+				Name: "report",
+				When: `failed_step.id == "step-0002"`,
+				Shell: &config.ShellAction{
+					Cmd: "echo {{ failed_step.name }}",
+				},
+				Register: "report",
+			},
+		},
+		Always: []config.Step{
+			shellStep("step-0005", "always", "touch "+marker),
+		},
+	}
+
+	if err := executor.ExecuteStep(step, ec); err != nil {
+		t.Fatalf("ExecuteStep() error = %v, want rescued block", err)
+	}
+
+	if _, ok := ec.Variables[executor.FailedStepVariable]; ok {
+		t.Error("failed_step should not be visible after rescue")
+	}
+
+	report, ok := ec.Variables["report"].(map[string]interface{})
+	if !ok {
+		t.Fatal("rescue step did not run")
+	}
+	if stdout := strings.TrimSpace(report["stdout"].(string)); stdout != "broken" {
+		t.Errorf("rescue stdout = %q, want %q", stdout, "broken")
+	}
+
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("always section did not run: %v", err)
+	}
+
+	if *ec.Stats.Failed != 0 {
+		t.Errorf("Failed = %d, want 0 after rescue", *ec.Stats.Failed)
+	}
+	if *ec.Stats.Rescued != 1 {
+		t.Errorf("Rescued = %d, want 1", *ec.Stats.Rescued)
+	}
+
+	rescued := recorder.ofType(events.EventBlockRescued)
+	if len(rescued) != 1 {
+		t.Fatalf("block.rescued events = %d, want 1", len(rescued))
+	}
+	data := rescued[0].Data.(events.BlockRescuedData)
+	if data.StepID != "step-0001" || data.FailedStepID != "step-0002" {
+		t.Errorf("block.rescued data = %+v", data)
+	}
+}
+
+func TestExecuteBlock_FailureWithoutRescue(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	marker := filepath.Join(ec.CurrentDir, "always")
+
+	step := config.Step{
+		ID:   "step-0001",
+		Name: "group",
+		Block: []config.Step{
+			shellStep("step-0002", "broken", "exit 1"),
+		},
+		Always: []config.Step{
+			shellStep("step-0003", "always", "touch "+marker),
+		},
+	}
+
+	err := executor.ExecuteStep(step, ec)
+	if err == nil {
+		t.Fatal("ExecuteStep() expected error for unrescued block")
+	}
+
+	var stepErr *executor.StepError
+	if !errors.As(err, &stepErr) || stepErr.StepID != "step-0002" {
+		t.Errorf("error should identify failed nested step, got %v", err)
+	}
+
+	if _, statErr := os.Stat(marker); statErr != nil {
+		t.Errorf("always section should run after failure: %v", statErr)
+	}
+
+	// The nested failure is counted once, not again for the block
+	if *ec.Stats.Failed != 1 {
+		t.Errorf("Failed = %d, want 1", *ec.Stats.Failed)
+	}
+	if len(recorder.ofType(events.EventBlockRescued)) != 0 {
+		t.Error("block.rescued should not be emitted without rescue")
+	}
+}
+
+func TestExecuteBlock_RescueFails(t *testing.T) {
+	ec, _ := newBlockTestContext(t)
+
+	step := config.Step{
+		ID:   "step-0001",
+		Name: "group",
+		Block: []config.Step{
+			shellStep("step-0002", "broken", "exit 1"),
+		},
+		Rescue: []config.Step{
+			shellStep("step-0003", "broken rescue", "exit 2"),
+		},
+	}
+
+	err := executor.ExecuteStep(step, ec)
+	if err == nil {
+		t.Fatal("ExecuteStep() expected error when rescue fails")
+	}
+
+	var stepErr *executor.StepError
+	if !errors.As(err, &stepErr) || stepErr.StepID != "step-0003" {
+		t.Errorf("error should identify failed rescue step, got %v", err)
+	}
+	if *ec.Stats.Rescued != 0 {
+		t.Errorf("Rescued = %d, want 0", *ec.Stats.Rescued)
+	}
+}
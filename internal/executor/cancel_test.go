@@ -0,0 +1,185 @@
+//go:build unix
+
+package executor_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/plan"
+)
+
+func TestExecutePlan_RunTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	marker := filepath.Join(tmpDir, "after")
+
+	planData := &plan.Plan{
+		RootFile: filepath.Join(tmpDir, "test.yml"),
+		Steps: []config.Step{
+			shellStep("step-0001", "slow", "sleep 5"),
+			shellStep("step-0002", "after", "touch "+marker),
+		},
+		InitialVars: make(map[string]interface{}),
+	}
+
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+
+	start := time.Now()
+	err := executor.ExecutePlanWithOptions(planData, executor.PlanOptions{
+		Timeout: 200 * time.Millisecond,
+	}, logger.NewTestLogger(), publisher)
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("run took %v, want it cancelled after the timeout", time.Since(start))
+	}
+
+	var cancelErr *executor.CancelledError
+	if !errors.As(err, &cancelErr) {
+		t.Fatalf("error = %v, want CancelledError", err)
+	}
+	if !strings.Contains(cancelErr.Reason, "run timed out after 200ms") {
+		t.Errorf("Reason = %q, want run timeout", cancelErr.Reason)
+	}
+
+	if _, statErr := os.Stat(marker); !os.IsNotExist(statErr) {
+		t.Error("step after the cancellation should not run")
+	}
+
+	failed := recorder.ofType(events.EventStepFailed)
+	if len(failed) != 1 {
+		t.Fatalf("step.failed events = %d, want 1", len(failed))
+	}
+	if data := failed[0].Data.(events.StepFailedData); data.Reason != executor.FailureReasonCancelled {
+		t.Errorf("step.failed reason = %q, want %q", data.Reason, executor.FailureReasonCancelled)
+	}
+
+	completed := recorder.ofType(events.EventRunCompleted)
+	if len(completed) != 1 || completed[0].Data.(events.RunCompletedData).Success {
+		t.Error("run.completed should report the cancelled run as failed")
+	}
+}
+
+func TestExecuteSteps_CancelledBeforeStart(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(errors.New("received interrupt"))
+	ec.Context = ctx
+
+	err := executor.ExecuteSteps([]config.Step{shellStep("step-0001", "never", "true")}, ec)
+
+	var cancelErr *executor.CancelledError
+	if !errors.As(err, &cancelErr) {
+		t.Fatalf("error = %v, want CancelledError", err)
+	}
+	if cancelErr.Reason != "received interrupt" {
+		t.Errorf("Reason = %q, want the cancellation cause", cancelErr.Reason)
+	}
+	if got := len(recorder.ofType(events.EventStepStarted)); got != 0 {
+		t.Errorf("step.started events = %d, want 0", got)
+	}
+}
+
+func TestExecuteSteps_CancellationNotIgnored(t *testing.T) {
+	ec, _ := newBlockTestContext(t)
+	ec.KeepGoing = true
+	ec.Failures = executor.NewFailureTracker()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ec.Context = ctx
+
+	interrupted := shellStep("step-0001", "interrupted", "sleep 5")
+	interrupted.IgnoreErrors = true
+	marker := filepath.Join(ec.CurrentDir, "after")
+
+	time.AfterFunc(200*time.Millisecond, cancel)
+	err := executor.ExecuteSteps([]config.Step{
+		interrupted,
+		shellStep("step-0002", "after", "touch "+marker),
+	}, ec)
+
+	var cancelErr *executor.CancelledError
+	if !errors.As(err, &cancelErr) {
+		t.Fatalf("error = %v, want CancelledError despite ignore_errors and keep-going", err)
+	}
+	if _, statErr := os.Stat(marker); !os.IsNotExist(statErr) {
+		t.Error("step after the cancellation should not run")
+	}
+}
+
+func TestExecuteStep_CancelStopsRetries(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ec.Context = ctx
+
+	step := shellStep("step-0001", "flaky", "exit 1")
+	step.Retries = 5
+	step.RetryDelay = "10s"
+
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	err := executor.ExecuteStep(step, ec)
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("step took %v, want the retry delay interrupted", time.Since(start))
+	}
+
+	var cancelErr *executor.CancelledError
+	if !errors.As(err, &cancelErr) {
+		t.Fatalf("error = %v, want CancelledError", err)
+	}
+	if got := len(recorder.ofType(events.EventStepRetry)); got != 1 {
+		t.Errorf("step.retry events = %d, want 1", got)
+	}
+}
+
+func TestExecuteStep_TimeoutKillsProcessGroup(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	pidFile := filepath.Join(ec.CurrentDir, "child.pid")
+
+	step := shellStep("step-0001", "spawns child", "sleep 30 & echo $! > "+pidFile+"; wait")
+	step.Timeout = "300ms"
+
+	err := executor.ExecuteStep(step, ec)
+
+	var timeoutErr *executor.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("error = %v, want TimeoutError", err)
+	}
+	failed := recorder.ofType(events.EventStepFailed)
+	if len(failed) != 1 || failed[0].Data.(events.StepFailedData).Reason != executor.FailureReasonTimeout {
+		t.Errorf("step.failed events = %v, want one with reason %q", failed, executor.FailureReasonTimeout)
+	}
+
+	data, readErr := os.ReadFile(pidFile)
+	if readErr != nil {
+		t.Fatalf("Failed to read child pid: %v", readErr)
+	}
+	pid, convErr := strconv.Atoi(strings.TrimSpace(string(data)))
+	if convErr != nil {
+		t.Fatalf("Invalid child pid %q: %v", data, convErr)
+	}
+
+	// The child is killed with its process group; give the kernel a moment to reap it
+	deadline := time.Now().Add(2 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("child process %d still running after the step timed out", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,67 @@
+package executor
+
+import (
+	"github.com/alehatsman/mooncake/internal/actions"
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// checkStep predicts in a dry run whether a step would change anything, using the
+// handler's Check method, and counts the step as changed, unchanged or unchecked.
+// With --diff, the predicted file changes are emitted as a step.diff event. In
+// `mooncake drift`, the check is added to the drift report.
+//
+// A failing check doesn't fail the dry run: it often means an earlier step would
+// have created what the check needs (a file, a package manager). The step is then
+// counted as unchecked, like steps whose handler can't check.
+func checkStep(handler actions.Handler, step config.Step, ec *ExecutionContext, result *Result) {
+	checker, ok := handler.(actions.Checker)
+	if !ok {
+		countUnchecked(ec)
+		ec.drift.addUnchecked(handler, step, ec, "action can't be checked")
+		return
+	}
+
+	check, err := checker.Check(ec, &step)
+	if err != nil {
+		ec.Logger.Debugf("  Check failed, change unknown: %v", err)
+		countUnchecked(ec)
+		ec.drift.addUnchecked(handler, step, ec, "check failed: "+err.Error())
+		return
+	}
+
+	result.Changed = check.Changed
+	result.predicted = true
+	countChange(ec, check.Changed)
+	ec.drift.add(step, ec, check)
+
+	if ec.Diff && check.Diff != "" {
+		stepName, _ := GetStepDisplayName(step, ec)
+		ec.EmitEvent(events.EventStepDiff, events.StepDiffData{
+			StepID: ec.CurrentStepID,
+			Name:   stepName,
+			Level:  ec.Level,
+			Diff:   check.Diff,
+			DryRun: ec.DryRun,
+		})
+	}
+}
+
+// countChange counts an action step as changed or unchanged.
+func countChange(ec *ExecutionContext, changed bool) {
+	if ec.Stats == nil {
+		return
+	}
+	if changed {
+		ec.Stats.add(ec.Stats.Changed, 1)
+	} else {
+		ec.Stats.add(ec.Stats.Unchanged, 1)
+	}
+}
+
+// countUnchecked counts a dry-run step whose change couldn't be predicted.
+func countUnchecked(ec *ExecutionContext) {
+	if ec.Stats != nil {
+		ec.Stats.add(ec.Stats.Unchecked, 1)
+	}
+}
@@ -0,0 +1,146 @@
+package executor_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/plan"
+)
+
+func fileStep(id, name, path, content string) config.Step {
+	return config.Step{ID: id, Name: name, File: &config.File{Path: path, Content: content}}
+}
+
+func TestExecutePlan_DryRunPredictsChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	current := filepath.Join(tmpDir, "current.conf")
+	if err := os.WriteFile(current, []byte("port=80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	unchanged := fileStep("step-0001", "unchanged", current, "port=80\n")
+	unchanged.Notify = []string{"reload unchanged"}
+	changed := fileStep("step-0002", "changed", current, "port=8080\n")
+	changed.Notify = []string{"reload changed"}
+
+	planData := &plan.Plan{
+		RootFile: filepath.Join(tmpDir, "test.yml"),
+		Steps: []config.Step{
+			unchanged,
+			changed,
+			fileStep("step-0003", "created", filepath.Join(tmpDir, "new.conf"), "x\n"),
+			shellStep("step-0004", "shell", "echo hi"),
+		},
+		Handlers: []config.Step{
+			shellStep("", "reload unchanged", "true"),
+			shellStep("", "reload changed", "true"),
+		},
+		InitialVars: map[string]interface{}{},
+	}
+
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	opts := executor.PlanOptions{DryRun: true, Diff: true}
+	if err := executor.ExecutePlanWithOptions(planData, opts, logger.NewTestLogger(), publisher); err != nil {
+		t.Fatalf("ExecutePlanWithOptions() error = %v", err)
+	}
+
+	if content, _ := os.ReadFile(current); string(content) != "port=80\n" {
+		t.Errorf("dry run modified the file: %q", content)
+	}
+
+	completed := recorder.ofType(events.EventRunCompleted)
+	if len(completed) != 1 {
+		t.Fatalf("run.completed events = %d, want 1", len(completed))
+	}
+	// The shell step and the notified shell handler can't be checked
+	summary := completed[0].Data.(events.RunCompletedData)
+	if !summary.DryRun || summary.ChangedSteps != 2 || summary.UnchangedSteps != 1 || summary.UncheckedSteps != 2 {
+		t.Errorf("summary = changed %d, unchanged %d, unchecked %d (dry run %v), want 2, 1, 2 (dry run)",
+			summary.ChangedSteps, summary.UnchangedSteps, summary.UncheckedSteps, summary.DryRun)
+	}
+
+	diffs := recorder.ofType(events.EventStepDiff)
+	if len(diffs) != 2 {
+		t.Fatalf("step.diff events = %d, want 2", len(diffs))
+	}
+	if data := diffs[0].Data.(events.StepDiffData); data.StepID != "step-0002" || !strings.Contains(data.Diff, "-port=80\n+port=8080\n") {
+		t.Errorf("first diff = %+v, want the port change of step-0002", data)
+	}
+	if data := diffs[1].Data.(events.StepDiffData); !strings.Contains(data.Diff, "--- /dev/null\n") {
+		t.Errorf("second diff = %+v, want a created file", data)
+	}
+
+	// Only the handler notified by the predicted change runs
+	var started []string
+	for _, event := range recorder.ofType(events.EventStepStarted) {
+		started = append(started, event.Data.(events.StepStartedData).Name)
+	}
+	if got := strings.Join(started, ","); strings.Contains(got, "reload unchanged") || !strings.Contains(got, "reload changed") {
+		t.Errorf("started steps = %v, want reload changed but not reload unchanged", started)
+	}
+}
+
+func TestExecutePlan_CountsActualChanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "app.conf")
+
+	planData := &plan.Plan{
+		RootFile: filepath.Join(tmpDir, "test.yml"),
+		Steps: []config.Step{
+			fileStep("step-0001", "write", path, "a\n"),
+			fileStep("step-0002", "write again", path, "a\n"),
+		},
+		InitialVars: map[string]interface{}{},
+	}
+
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	if err := executor.ExecutePlanWithOptions(planData, executor.PlanOptions{}, logger.NewTestLogger(), publisher); err != nil {
+		t.Fatalf("ExecutePlanWithOptions() error = %v", err)
+	}
+	summary := recorder.ofType(events.EventRunCompleted)[0].Data.(events.RunCompletedData)
+	if summary.DryRun || summary.ChangedSteps != 1 || summary.UnchangedSteps != 1 {
+		t.Errorf("summary = changed %d, unchanged %d, want 1, 1", summary.ChangedSteps, summary.UnchangedSteps)
+	}
+	if len(recorder.ofType(events.EventStepDiff)) != 0 {
+		t.Error("step.diff events should only be emitted in dry runs")
+	}
+}
+
+// droppingPublisher reports a number of dropped events, like a ChannelPublisher
+// whose subscriber fell too far behind.
+type droppingPublisher struct {
+	events.Publisher
+	dropped int
+}
+
+func (p *droppingPublisher) Dropped() int { return p.dropped }
+
+func TestExecutePlan_ReportsDroppedEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       []config.Step{fileStep("step-0001", "write", filepath.Join(tmpDir, "a.conf"), "a\n")},
+		InitialVars: map[string]interface{}{},
+	}
+
+	recorder := &eventRecorder{}
+	publisher := &droppingPublisher{Publisher: events.NewSyncPublisher(), dropped: 3}
+	publisher.Subscribe(recorder)
+	if err := executor.ExecutePlanWithOptions(planData, executor.PlanOptions{}, logger.NewTestLogger(), publisher); err != nil {
+		t.Fatalf("ExecutePlanWithOptions() error = %v", err)
+	}
+	summary := recorder.ofType(events.EventRunCompleted)[0].Data.(events.RunCompletedData)
+	if summary.DroppedEvents != 3 {
+		t.Errorf("DroppedEvents = %d, want 3", summary.DroppedEvents)
+	}
+}
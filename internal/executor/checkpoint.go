@@ -0,0 +1,216 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/plan"
+)
+
+// checkpointer keeps the checkpoint of a run up to date as top-level steps finish.
+// A nil checkpointer does nothing.
+type checkpointer struct {
+	mu       sync.Mutex
+	runDir   string
+	state    artifacts.Checkpoint
+	handlers *HandlerQueue
+	log      logger.Logger
+}
+
+// newCheckpointer creates a checkpointer for the run directory. Progress restored
+// from a resumed run is carried over, so the new run can be resumed in turn.
+func newCheckpointer(runDir, planHash string, resumed *artifacts.Checkpoint, handlers *HandlerQueue, log logger.Logger) *checkpointer {
+	c := &checkpointer{
+		runDir: runDir,
+		state: artifacts.Checkpoint{
+			RunID:     filepath.Base(runDir),
+			PlanHash:  planHash,
+			Variables: make(map[string]interface{}),
+		},
+		handlers: handlers,
+		log:      log,
+	}
+	if resumed != nil {
+		c.state.Completed = append(c.state.Completed, resumed.Completed...)
+		for name, value := range resumed.Variables {
+			c.state.Variables[name] = value
+		}
+	}
+	return c
+}
+
+// stepDone records a finished top-level step and the results it registered.
+func (c *checkpointer) stepDone(step config.Step, variables map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Completed = append(c.state.Completed, step.ID)
+	for _, name := range registeredNames(step) {
+		if value, ok := variables[name]; ok {
+			c.state.Variables[name] = value
+		}
+	}
+	c.save()
+}
+
+// stepFailed records the first failed step of the run.
+func (c *checkpointer) stepFailed(step config.Step, err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state.FailedStepID == "" {
+		c.state.FailedStepID = step.ID
+		var stepErr *StepError
+		if errors.As(err, &stepErr) {
+			c.state.FailedStepID = stepErr.StepID
+		}
+	}
+	c.save()
+}
+
+// flush saves the checkpoint with the current handler queue.
+func (c *checkpointer) flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.save()
+}
+
+// save writes the checkpoint. Errors are logged: a failed checkpoint doesn't fail the run.
+func (c *checkpointer) save() {
+	c.state.Handlers = c.handlers.pendingNames()
+	c.state.UpdatedAt = time.Now()
+	if err := artifacts.SaveCheckpoint(c.runDir, &c.state); err != nil {
+		c.log.Errorf("checkpoint not saved: %v", err)
+	}
+}
+
+// loadResumedRun loads the checkpoint of the run to resume. Without a config file,
+// the plan saved in the run directory is resumed.
+func loadResumedRun(artifactsDir, runID string, loadPlan bool) (*artifacts.Checkpoint, *plan.Plan, error) {
+	runDir := artifacts.RunDir(artifactsDir, runID)
+	checkpoint, err := artifacts.LoadCheckpoint(runDir)
+	if err != nil {
+		return nil, nil, &SetupError{Component: "resume", Issue: "failed to load checkpoint", Cause: err}
+	}
+	if checkpoint.Redacted {
+		return nil, nil, &SetupError{Component: "resume", Issue: "the checkpoint of run " + runID + " has redacted secrets in its registered results (rerun without --resume)"}
+	}
+	if !loadPlan {
+		return checkpoint, nil, nil
+	}
+
+	planData, err := plan.LoadPlanFromFile(filepath.Join(runDir, artifacts.PlanFile))
+	if err != nil {
+		return nil, nil, &SetupError{Component: "resume", Issue: "failed to load plan of run " + runID, Cause: err}
+	}
+	if planData.Redacted {
+		return nil, nil, &SetupError{Component: "resume", Issue: "the plan of run " + runID + " has redacted secrets (resume with --config)"}
+	}
+	return checkpoint, planData, nil
+}
+
+// checkPlanUnchanged refuses to resume a run whose plan has changed since, as the
+// completed step IDs may no longer refer to the same steps.
+func checkPlanUnchanged(p *plan.Plan, checkpoint *artifacts.Checkpoint, force bool, log logger.Logger) error {
+	planHash, err := p.Hash()
+	if err != nil {
+		return &SetupError{Component: "resume", Issue: "failed to hash plan", Cause: err}
+	}
+	if planHash == checkpoint.PlanHash {
+		return nil
+	}
+	if !force {
+		return &SetupError{
+			Component: "resume",
+			Issue:     fmt.Sprintf("plan changed since run %s (use --force to resume anyway)", checkpoint.RunID),
+		}
+	}
+	log.Infof("Plan changed since run %s, resuming anyway", checkpoint.RunID)
+	return nil
+}
+
+// skipBeforeStart returns the steps to run, skipping the top-level steps completed by
+// a resumed run and those before the start step. Skipped steps are reported as
+// skipped; dependencies on them count as satisfied. Results and notified handlers
+// of the resumed run are restored.
+func skipBeforeStart(steps []config.Step, resumed *artifacts.Checkpoint, startAt string, ec *ExecutionContext) ([]config.Step, error) {
+	skip := make(map[string]string)
+
+	if startAt != "" {
+		start := -1
+		for i, step := range steps {
+			if step.ID == startAt || step.Name == startAt {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("start step %q not found (use a step ID or name from 'mooncake plan')", startAt)
+		}
+		for _, step := range steps[:start] {
+			skip[step.ID] = "before start step " + startAt
+		}
+	}
+
+	if resumed != nil {
+		for _, id := range resumed.Completed {
+			if _, ok := skip[id]; !ok {
+				skip[id] = "completed in run " + resumed.RunID
+			}
+		}
+		for name, value := range resumed.Variables {
+			ec.Variables[name] = value
+		}
+		for _, name := range resumed.Handlers {
+			if err := ec.Handlers.Notify(name); err != nil {
+				ec.Logger.Debugf("not restoring handler: %v", err)
+			}
+		}
+	}
+
+	if len(skip) == 0 {
+		return steps, nil
+	}
+
+	remaining := make([]config.Step, 0, len(steps))
+	for _, step := range steps {
+		reason, skipped := skip[step.ID]
+		if !skipped {
+			var dependsOn []string
+			for _, id := range step.DependsOn {
+				if _, done := skip[id]; !done {
+					dependsOn = append(dependsOn, id)
+				}
+			}
+			step.DependsOn = dependsOn
+			remaining = append(remaining, step)
+			continue
+		}
+
+		ec.Stats.add(ec.Stats.Skipped, 1)
+		stepName, _ := GetStepDisplayName(step, ec)
+		ec.EmitEvent(events.EventStepSkipped, events.StepSkippedData{
+			StepID: step.ID,
+			Name:   stepName,
+			Level:  ec.Level,
+			Reason: reason,
+		})
+	}
+	return remaining, nil
+}
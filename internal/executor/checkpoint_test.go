@@ -0,0 +1,250 @@
+//go:build unix
+
+package executor_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+// newCheckpointTestPlan returns a plan whose second step fails until the flag file exists.
+func newCheckpointTestPlan(tmpDir string) *plan.Plan {
+	out := filepath.Join(tmpDir, "out.log")
+
+	probe := shellStep("step-0001", "probe", "echo probed >> "+out+"; echo v1")
+	probe.Register = "probe"
+	probe.Notify = []string{"restart"}
+
+	flaky := shellStep("step-0002", "flaky", "test -e "+filepath.Join(tmpDir, "flag"))
+
+	last := appendStep("step-0003", "last", "last", out)
+	last.When = "trim(probe.stdout) == 'v1'"
+
+	return &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       []config.Step{probe, flaky, last},
+		Handlers:    []config.Step{appendStep("", "restart", "restarted", out)},
+		InitialVars: map[string]interface{}{},
+	}
+}
+
+func runCheckpointTestPlan(t *testing.T, planData *plan.Plan, opts executor.PlanOptions) (*eventRecorder, error) {
+	t.Helper()
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	err := executor.ExecutePlanWithOptions(planData, opts, logger.NewTestLogger(), publisher)
+	return recorder, err
+}
+
+func TestExecutePlan_CheckpointAndResume(t *testing.T) {
+	tmpDir := t.TempDir()
+	out := filepath.Join(tmpDir, "out.log")
+	runDir := filepath.Join(tmpDir, "runs", "run-1")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	planData := newCheckpointTestPlan(tmpDir)
+	if _, err := runCheckpointTestPlan(t, planData, executor.PlanOptions{CheckpointDir: runDir}); err == nil {
+		t.Fatal("first run should fail")
+	}
+
+	checkpoint, err := artifacts.LoadCheckpoint(runDir)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint failed: %v", err)
+	}
+	if !reflect.DeepEqual(checkpoint.Completed, []string{"step-0001"}) {
+		t.Errorf("Completed = %v, want [step-0001]", checkpoint.Completed)
+	}
+	if checkpoint.FailedStepID != "step-0002" {
+		t.Errorf("FailedStepID = %q, want step-0002", checkpoint.FailedStepID)
+	}
+	if _, ok := checkpoint.Variables["probe"]; !ok {
+		t.Error("checkpoint should contain the registered probe result")
+	}
+	if !reflect.DeepEqual(checkpoint.Handlers, []string{"restart"}) {
+		t.Errorf("Handlers = %v, want [restart]", checkpoint.Handlers)
+	}
+	wantHash, _ := planData.Hash()
+	if checkpoint.PlanHash != wantHash {
+		t.Errorf("PlanHash = %q, want %q", checkpoint.PlanHash, wantHash)
+	}
+
+	// Fix the failure and resume: the probe doesn't run again, but its result
+	// and the handler it notified are restored
+	if err := os.WriteFile(filepath.Join(tmpDir, "flag"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	resumeDir := filepath.Join(tmpDir, "runs", "run-2")
+	if err := os.MkdirAll(resumeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder, err := runCheckpointTestPlan(t, planData, executor.PlanOptions{
+		CheckpointDir: resumeDir,
+		Resume:        checkpoint,
+	})
+	if err != nil {
+		t.Fatalf("resumed run error = %v, want nil", err)
+	}
+
+	if lines := readLines(t, out); strings.Join(lines, ",") != "probed,last,restarted" {
+		t.Errorf("output = %v, want [probed last restarted]", lines)
+	}
+
+	skipped := recorder.ofType(events.EventStepSkipped)
+	if len(skipped) != 1 || skipped[0].Data.(events.StepSkippedData).Reason != "completed in run run-1" {
+		t.Errorf("skipped events = %v, want step-0001 completed in run-1", skipped)
+	}
+
+	resumed, err := artifacts.LoadCheckpoint(resumeDir)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint failed: %v", err)
+	}
+	if want := []string{"step-0001", "step-0002", "step-0003"}; !reflect.DeepEqual(resumed.Completed, want) {
+		t.Errorf("resumed Completed = %v, want %v", resumed.Completed, want)
+	}
+	if resumed.FailedStepID != "" || len(resumed.Handlers) != 0 {
+		t.Errorf("resumed checkpoint = %+v, want no failure and no pending handlers", resumed)
+	}
+}
+
+func TestExecutePlan_StartAt(t *testing.T) {
+	tmpDir := t.TempDir()
+	out := filepath.Join(tmpDir, "out.log")
+
+	second := appendStep("step-0002", "second", "second", out)
+	second.DependsOn = []string{"step-0001"}
+
+	planData := &plan.Plan{
+		RootFile: filepath.Join(tmpDir, "test.yml"),
+		Steps: []config.Step{
+			appendStep("step-0001", "first", "first", out),
+			second,
+			appendStep("step-0003", "third", "third", out),
+		},
+		InitialVars: map[string]interface{}{},
+	}
+
+	for _, startAt := range []string{"second", "step-0002"} {
+		t.Run(startAt, func(t *testing.T) {
+			if err := os.Remove(out); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			_, err := runCheckpointTestPlan(t, planData, executor.PlanOptions{StartAt: startAt, Parallel: 2})
+			if err != nil {
+				t.Fatalf("ExecutePlanWithOptions() error = %v, want nil", err)
+			}
+			lines := readLines(t, out)
+			if len(lines) != 2 || lines[0] == "first" || lines[1] == "first" {
+				t.Errorf("output = %v, want second and third only", lines)
+			}
+		})
+	}
+
+	_, err := runCheckpointTestPlan(t, planData, executor.PlanOptions{StartAt: "missing"})
+	if err == nil || !strings.Contains(err.Error(), `start step "missing" not found`) {
+		t.Errorf("error = %v, want start step not found", err)
+	}
+}
+
+func TestStart_ResumeRefusesChangedPlan(t *testing.T) {
+	tmpDir := t.TempDir()
+	artifactsDir := filepath.Join(tmpDir, "artifacts")
+	configPath := filepath.Join(tmpDir, "config.yml")
+	flag := filepath.Join(tmpDir, "flag")
+
+	writeConfig := func(message string) {
+		t.Helper()
+		content := "steps:\n" +
+			"  - name: greet\n    shell: echo " + message + "\n" +
+			"  - name: flaky\n    shell: test -e " + flag + "\n"
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := func(cfg executor.StartConfig) error {
+		cfg.ArtifactsDir = artifactsDir
+		return executor.Start(cfg, logger.NewTestLogger(), events.NewSyncPublisher())
+	}
+
+	writeConfig("hello")
+	err := start(executor.StartConfig{ConfigFilePath: configPath})
+	var resumableErr *executor.ResumableError
+	if !errors.As(err, &resumableErr) {
+		t.Fatalf("Start() error = %v, want ResumableError", err)
+	}
+	var stepErr *executor.StepError
+	if !errors.As(err, &stepErr) {
+		t.Errorf("ResumableError should wrap the StepError, got %v", err)
+	}
+	if !strings.Contains(resumableErr.ResumeCommand(), "--resume "+resumableErr.RunID) {
+		t.Errorf("ResumeCommand() = %q, want it to contain the run ID", resumableErr.ResumeCommand())
+	}
+	runID := resumableErr.RunID
+
+	writeConfig("changed")
+	err = start(executor.StartConfig{ConfigFilePath: configPath, ResumeRunID: runID})
+	if err == nil || !strings.Contains(err.Error(), "plan changed since run "+runID) {
+		t.Fatalf("Start() error = %v, want plan changed error", err)
+	}
+
+	if err := os.WriteFile(flag, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := start(executor.StartConfig{ConfigFilePath: configPath, ResumeRunID: runID, Force: true}); err != nil {
+		t.Errorf("forced Start() error = %v, want nil", err)
+	}
+
+	// Without a config file the saved plan is resumed, which is unchanged
+	if err := start(executor.StartConfig{ResumeRunID: runID}); err != nil {
+		t.Errorf("Start() with the saved plan error = %v, want nil", err)
+	}
+}
+
+func TestStart_ResumeRefusesRedactedCheckpoint(t *testing.T) {
+	t.Cleanup(security.ResetSecrets)
+	security.RegisterSecret("resume-secret-value")
+	tmpDir := t.TempDir()
+	artifactsDir := filepath.Join(tmpDir, "artifacts")
+	configPath := filepath.Join(tmpDir, "config.yml")
+	content := "steps:\n" +
+		"  - name: token\n    shell: echo resume-secret-value\n    register: token\n" +
+		"  - name: flaky\n    shell: test -e " + filepath.Join(tmpDir, "flag") + "\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := executor.Start(executor.StartConfig{ConfigFilePath: configPath, ArtifactsDir: artifactsDir}, logger.NewTestLogger(), events.NewSyncPublisher())
+	var resumableErr *executor.ResumableError
+	if err == nil || errors.As(err, &resumableErr) {
+		t.Fatalf("Start() error = %v, want a failure that can't be resumed", err)
+	}
+	if security.HasSecrets() {
+		t.Error("secrets of the run are still registered after it ended")
+	}
+
+	runs, err := os.ReadDir(filepath.Join(artifactsDir, "runs"))
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("runs = %v, %v, want one run", runs, err)
+	}
+	runID := runs[0].Name()
+
+	err = executor.Start(executor.StartConfig{ResumeRunID: runID, ArtifactsDir: artifactsDir}, logger.NewTestLogger(), events.NewSyncPublisher())
+	if err == nil || !strings.Contains(err.Error(), "checkpoint of run "+runID+" has redacted secrets") {
+		t.Errorf("Start() error = %v, want redacted checkpoint error", err)
+	}
+}
@@ -2,20 +2,31 @@
 package executor
 
 import (
+	"context"
+	"os/exec"
+	"runtime"
+	"sync"
 	"time"
 
+	"github.com/alehatsman/mooncake/internal/artifacts"
 	"github.com/alehatsman/mooncake/internal/events"
 	"github.com/alehatsman/mooncake/internal/expression"
 	"github.com/alehatsman/mooncake/internal/filetree"
 	"github.com/alehatsman/mooncake/internal/logger"
 	"github.com/alehatsman/mooncake/internal/pathutil"
+	"github.com/alehatsman/mooncake/internal/policy"
+	"github.com/alehatsman/mooncake/internal/sandbox"
 	"github.com/alehatsman/mooncake/internal/security"
 	"github.com/alehatsman/mooncake/internal/template"
+	"github.com/alehatsman/mooncake/internal/transport"
 )
 
 // ExecutionStats holds shared statistics counters for execution tracking.
 // All fields are pointers to enable shared state across nested execution contexts.
+// The executor updates them through add, so steps running in parallel can share them.
 type ExecutionStats struct {
+	mu sync.Mutex
+
 	// Global tracks total non-skipped steps across the entire execution tree
 	Global *int
 	// Executed counts successfully completed steps
@@ -24,18 +35,46 @@ type ExecutionStats struct {
 	Skipped *int
 	// Failed counts steps that failed with errors
 	Failed *int
+	// Rescued counts blocks whose failure was handled by a rescue section
+	Rescued *int
+	// Changed counts action steps that changed something (in dry runs: would change)
+	Changed *int
+	// Unchanged counts action steps that found the system in the desired state
+	Unchanged *int
+	// Unchecked counts dry-run steps whose action can't predict changes
+	Unchecked *int
 }
 
 // NewExecutionStats creates a new ExecutionStats with all counters initialized to zero
 func NewExecutionStats() *ExecutionStats {
 	return &ExecutionStats{
-		Global:   new(int),
-		Executed: new(int),
-		Skipped:  new(int),
-		Failed:   new(int),
+		Global:    new(int),
+		Executed:  new(int),
+		Skipped:   new(int),
+		Failed:    new(int),
+		Rescued:   new(int),
+		Changed:   new(int),
+		Unchanged: new(int),
+		Unchecked: new(int),
 	}
 }
 
+// add adds n to a counter and returns its new value. Nil counters are ignored.
+func (s *ExecutionStats) add(counter *int, n int) int {
+	if s == nil || counter == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*counter += n
+	return *counter
+}
+
+// get returns the current value of a counter (0 for nil counters).
+func (s *ExecutionStats) get(counter *int) int {
+	return s.add(counter, 0)
+}
+
 // ExecutionContext holds all state needed to execute a step or sequence of steps.
 //
 // The context is designed to be copied when entering nested execution scopes (includes, loops).
@@ -93,6 +132,9 @@ type ExecutionContext struct {
 	// Commands are not executed, files are not created, templates are not rendered.
 	DryRun bool
 
+	// Diff emits step.diff events with the file changes predicted in dry runs.
+	Diff bool
+
 	// Stats holds shared execution statistics counters.
 	// SHARED via pointer - all contexts update the same counters.
 	Stats *ExecutionStats
@@ -121,6 +163,10 @@ type ExecutionContext struct {
 	// SHARED across all contexts - same instance used everywhere.
 	EventPublisher events.Publisher
 
+	// Transport runs the commands and accesses the files of steps on the target host.
+	// SHARED across all contexts - same instance used everywhere. Nil means this host.
+	Transport transport.Transport
+
 	// CurrentStepID is the unique identifier for the currently executing step.
 	// Used for correlating events from the same step execution.
 	CurrentStepID string
@@ -128,6 +174,53 @@ type ExecutionContext struct {
 	// CurrentResult holds the result of the currently executing step.
 	// Handlers should set this to provide result data to event emission.
 	CurrentResult *Result
+
+	// Handlers holds the config handlers and the ones notified so far.
+	// Shared across all contexts so notifications from nested steps are kept.
+	Handlers *HandlerQueue
+
+	// KeepGoing continues the run after a failed step, skipping only the
+	// steps that use variables the failed step left unset.
+	KeepGoing bool
+
+	// Failures records failed steps for the run summary (shared across contexts).
+	Failures *FailureTracker
+
+	// Context is cancelled when the run is interrupted or exceeds its timeout, and
+	// carries the deadline of the current step attempt (from the step's timeout).
+	// Handlers pass it to the commands and requests they start. Nil means never cancelled.
+	Context context.Context
+
+	// NoLog is set while a step with no_log: true runs, including its nested
+	// steps: their output, results and errors are hidden.
+	NoLog bool
+
+	// secrets are the names of the variables holding secrets (see plan.Plan.Secrets).
+	secrets []string
+
+	// policy checks every step before it runs (shared across contexts). Nil
+	// when the run has no policy (see PlanOptions.Policy).
+	policy *policy.Enforcer
+
+	// sandbox is the sandbox of the commands of shell and command steps. Nil
+	// when the run has none (see PlanOptions.Sandbox).
+	sandbox *sandbox.Config
+
+	// failureScope is the ID of the top-level step a parallel worker runs. Blocks
+	// only discard or ignore failures recorded in their own scope.
+	failureScope string
+
+	// checkpoint records finished top-level steps. Only set on the root context,
+	// so it is not copied by Clone.
+	checkpoint *checkpointer
+
+	// journal records the changes of the run for undo (shared across contexts).
+	// Nil in dry runs and runs without artifacts.
+	journal *artifacts.Journal
+
+	// drift collects the drift found by step checks in a dry run (shared across
+	// contexts). Nil unless running `mooncake drift`.
+	drift *DriftReport
 }
 
 // Clone creates a new ExecutionContext for a nested execution scope (include or loop).
@@ -150,6 +243,7 @@ func (ec *ExecutionContext) Clone() ExecutionContext {
 		SudoPass:      ec.SudoPass,
 		Tags:          ec.Tags,
 		DryRun:        ec.DryRun,
+		Diff:          ec.Diff,
 
 		// Share the same statistics pointer
 		Stats: ec.Stats,
@@ -164,6 +258,25 @@ func (ec *ExecutionContext) Clone() ExecutionContext {
 		// Share the same event publisher
 		EventPublisher: ec.EventPublisher,
 		CurrentStepID:  ec.CurrentStepID,
+
+		// Share the same target host
+		Transport: ec.Transport,
+
+		// Share the same handler queue
+		Handlers: ec.Handlers,
+
+		// Share failure tracking
+		KeepGoing: ec.KeepGoing,
+		Failures:  ec.Failures,
+
+		Context:      ec.Context,
+		NoLog:        ec.NoLog,
+		secrets:      ec.secrets,
+		policy:       ec.policy,
+		sandbox:      ec.sandbox,
+		failureScope: ec.failureScope,
+		journal:      ec.journal,
+		drift:        ec.drift,
 	}
 }
 
@@ -228,3 +341,54 @@ func (ec *ExecutionContext) IsDryRun() bool {
 func (ec *ExecutionContext) GetCurrentStepID() string {
 	return ec.CurrentStepID
 }
+
+// GetContext returns the context for the current step attempt.
+// Returns context.Background() if no context is set.
+func (ec *ExecutionContext) GetContext() context.Context {
+	if ec.Context == nil {
+		return context.Background()
+	}
+	return ec.Context
+}
+
+// GetTransport returns the transport to the target host.
+// Returns the local transport if none is set.
+func (ec *ExecutionContext) GetTransport() transport.Transport {
+	if ec.Transport == nil {
+		return transport.NewLocal()
+	}
+	return ec.Transport
+}
+
+// Command returns a command running name with args on the target host, under
+// the context of the current step attempt.
+func (ec *ExecutionContext) Command(name string, args ...string) *exec.Cmd {
+	return ec.GetTransport().Command(ec.GetContext(), transport.Cmd{Name: name, Args: args})
+}
+
+// LocalCommand returns a command running name with args on this host, under the
+// context of the current step attempt, for actions that only run on this host.
+func (ec *ExecutionContext) LocalCommand(name string, args ...string) *exec.Cmd {
+	return transport.NewLocal().Command(ec.GetContext(), transport.Cmd{Name: name, Args: args})
+}
+
+// TargetOS returns the operating system of the target host: runtime.GOOS for
+// this host, the os fact for remote hosts.
+func (ec *ExecutionContext) TargetOS() string {
+	if !transport.IsLocal(ec.GetTransport()) {
+		if targetOS, ok := ec.Variables["os"].(string); ok && targetOS != "" {
+			return targetOS
+		}
+	}
+	return runtime.GOOS
+}
+
+// cancellation returns a CancelledError wrapping cause if the run context is done, nil otherwise.
+// The reason comes from the context cause (e.g., the signal received or the run timeout).
+func (ec *ExecutionContext) cancellation(cause error) error {
+	ctx := ec.GetContext()
+	if ctx.Err() == nil {
+		return nil
+	}
+	return &CancelledError{Reason: context.Cause(ctx).Error(), Cause: cause}
+}
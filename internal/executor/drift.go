@@ -0,0 +1,180 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/alehatsman/mooncake/internal/actions"
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/pathutil"
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/template"
+)
+
+// DriftConfig configures a drift check of a config.
+type DriftConfig struct {
+	ConfigFilePath string
+	VarsFilePath   string
+	Tags           []string
+
+	SudoPass         string
+	SudoPassFile     string
+	AskBecomePass    bool
+	InsecureSudoPass bool
+
+	// Context cancels the check when done. Nil means context.Background().
+	Context context.Context
+}
+
+// DriftReport lists the resources whose actual state differs from a plan. It is
+// filled by the step checks of a dry run (see PlanOptions.Drift), possibly from
+// parallel steps.
+type DriftReport struct {
+	// RootFile is the config file the plan was built from.
+	RootFile string `json:"root_file"`
+
+	// CheckedSteps is the number of steps whose handler checked the system state.
+	CheckedSteps int `json:"checked_steps"`
+
+	// Drifted lists the checked steps that found drift, in the order they ran.
+	Drifted []DriftedStep `json:"drifted"`
+
+	// Unchecked lists the steps that may change the system but couldn't be
+	// checked: their action has no check (shell, command) or the check failed.
+	Unchecked []UncheckedStep `json:"unchecked,omitempty"`
+
+	mu sync.Mutex
+}
+
+// DriftedStep is a step whose resources differ from the state it asks for.
+type DriftedStep struct {
+	StepID    string          `json:"step_id"`
+	Name      string          `json:"name"`
+	Action    string          `json:"action"`
+	Resources []actions.Drift `json:"resources"`
+
+	// Diff is a unified diff from the actual file contents to the ones the step
+	// would write. Empty if no file content drifted.
+	Diff string `json:"diff,omitempty"`
+}
+
+// UncheckedStep is a step whose drift couldn't be checked.
+type UncheckedStep struct {
+	StepID string `json:"step_id"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// HasDrift reports whether any resource drifted.
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Drifted) > 0
+}
+
+// DriftedResources returns the number of drifted resources.
+func (r *DriftReport) DriftedResources() int {
+	count := 0
+	for _, step := range r.Drifted {
+		count += len(step.Resources)
+	}
+	return count
+}
+
+// add records the check of a step. Nil-safe.
+func (r *DriftReport) add(step config.Step, ec *ExecutionContext, check actions.CheckResult) {
+	if r == nil {
+		return
+	}
+	stepName, _ := GetStepDisplayName(step, ec)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.CheckedSteps++
+	if len(check.Drift) == 0 {
+		return
+	}
+	r.Drifted = append(r.Drifted, DriftedStep{
+		StepID:    ec.CurrentStepID,
+		Name:      stepName,
+		Action:    step.DetermineActionType(),
+		Resources: check.Drift,
+		Diff:      check.Diff,
+	})
+}
+
+// addUnchecked records a step that couldn't be checked. Steps that only set
+// variables or print can't drift and are left out. Nil-safe.
+func (r *DriftReport) addUnchecked(handler actions.Handler, step config.Step, ec *ExecutionContext, reason string) {
+	if r == nil {
+		return
+	}
+	switch handler.Metadata().Category {
+	case actions.CategoryData, actions.CategoryOutput:
+		return
+	}
+	stepName, _ := GetStepDisplayName(step, ec)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Unchecked = append(r.Unchecked, UncheckedStep{
+		StepID: ec.CurrentStepID,
+		Name:   stepName,
+		Action: step.DetermineActionType(),
+		Reason: reason,
+	})
+}
+
+// Drift builds the plan of a config and checks every step against the system in
+// a dry run, without changing anything. The returned report lists the resources
+// whose actual state differs from the state the steps ask for.
+func Drift(cfg DriftConfig, log logger.Logger) (*DriftReport, error) {
+	if cfg.ConfigFilePath == "" {
+		return nil, &SetupError{Component: "config", Issue: "config file path is empty"}
+	}
+
+	sudoPassword, err := security.ResolvePassword(security.PasswordConfig{
+		CLIPassword:    cfg.SudoPass,
+		AskInteractive: cfg.AskBecomePass,
+		PasswordFile:   cfg.SudoPassFile,
+		InsecureCLI:    cfg.InsecureSudoPass,
+	})
+	if err != nil {
+		return nil, &SetupError{Component: "sudo password", Issue: "failed to resolve password", Cause: err}
+	}
+
+	renderer, err := template.NewPongo2Renderer()
+	if err != nil {
+		return nil, &SetupError{Component: "template renderer", Issue: "failed to create renderer", Cause: err}
+	}
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	planData, err := buildStartPlan(StartConfig{
+		ConfigFilePath: cfg.ConfigFilePath,
+		VarsFilePath:   cfg.VarsFilePath,
+		Tags:           cfg.Tags,
+	}, nil, pathutil.NewPathExpander(renderer), currentDir, log)
+	if err != nil {
+		return nil, err
+	}
+
+	publisher := events.NewSyncPublisher()
+	defer publisher.Close()
+
+	report := &DriftReport{RootFile: planData.RootFile, Drifted: []DriftedStep{}}
+	err = ExecutePlanWithOptions(planData, PlanOptions{
+		SudoPass: sudoPassword,
+		DryRun:   true,
+		Drift:    report,
+		Context:  cfg.Context,
+	}, log, publisher)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
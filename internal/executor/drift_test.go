@@ -0,0 +1,154 @@
+//go:build unix
+
+package executor_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/alehatsman/mooncake/internal/actions/file_replace"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+)
+
+// writeDriftConfig writes a config with the given steps to dir.
+func writeDriftConfig(t *testing.T, dir, steps string) string {
+	t.Helper()
+	configPath := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(configPath, []byte(steps), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func TestDrift(t *testing.T) {
+	tmpDir := t.TempDir()
+	same := filepath.Join(tmpDir, "same.conf")
+	if err := os.WriteFile(same, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(tmpDir, "app.conf")
+	if err := os.WriteFile(app, []byte("port=80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(tmpDir, "missing.conf")
+
+	configPath := writeDriftConfig(t, tmpDir, `
+- vars:
+    port: 8080
+- name: same
+  file:
+    path: `+same+`
+    content: "a\n"
+- name: app config
+  file:
+    path: `+app+`
+    content: "port={{ port }}\n"
+- name: missing config
+  file:
+    path: `+missing+`
+    content: "x\n"
+- name: data dir
+  file:
+    path: `+filepath.Join(tmpDir, "data")+`
+    state: directory
+- name: run script
+  shell: echo hi
+- print: done
+`)
+
+	report, err := executor.Drift(executor.DriftConfig{ConfigFilePath: configPath}, logger.NewTestLogger())
+	if err != nil {
+		t.Fatalf("Drift() error = %v", err)
+	}
+
+	if content, _ := os.ReadFile(app); string(content) != "port=80\n" {
+		t.Errorf("drift check modified the file: %q", content)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("drift check created %s", missing)
+	}
+
+	if !report.HasDrift() || report.DriftedResources() != 3 || report.CheckedSteps != 4 {
+		t.Fatalf("report = %d resources drifted, %d steps checked, want 3 and 4: %+v",
+			report.DriftedResources(), report.CheckedSteps, report)
+	}
+	var got []string
+	for _, step := range report.Drifted {
+		for _, resource := range step.Resources {
+			got = append(got, step.Name+": "+resource.Kind+" "+filepath.Base(resource.Resource)+" "+resource.Detail)
+		}
+	}
+	want := []string{
+		"app config: file app.conf content differs",
+		"missing config: file missing.conf missing",
+		"data dir: file data missing",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("drifted resources =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if diff := report.Drifted[0].Diff; !strings.Contains(diff, "-port=80\n+port=8080\n") {
+		t.Errorf("app config diff = %q, want the port change", diff)
+	}
+	if report.Drifted[0].StepID == "" || report.Drifted[0].Action != "file" {
+		t.Errorf("drifted step = %+v, want step ID and action", report.Drifted[0])
+	}
+
+	// The shell step may change the system but can't be checked; vars and print can't drift
+	if len(report.Unchecked) != 1 || report.Unchecked[0].Name != "run script" || report.Unchecked[0].Action != "shell" {
+		t.Errorf("unchecked = %+v, want the shell step only", report.Unchecked)
+	}
+}
+
+func TestDrift_NoDrift(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "app.conf")
+	if err := os.WriteFile(path, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configPath := writeDriftConfig(t, tmpDir, `
+- name: app config
+  file:
+    path: `+path+`
+    content: "a\n"
+`)
+
+	report, err := executor.Drift(executor.DriftConfig{ConfigFilePath: configPath}, logger.NewTestLogger())
+	if err != nil {
+		t.Fatalf("Drift() error = %v", err)
+	}
+	if report.HasDrift() || report.CheckedSteps != 1 || len(report.Unchecked) != 0 {
+		t.Errorf("report = %+v, want one checked step without drift", report)
+	}
+}
+
+func TestDrift_FailedCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := writeDriftConfig(t, tmpDir, `
+- name: fix typo
+  file_replace:
+    path: `+filepath.Join(tmpDir, "missing.conf")+`
+    pattern: teh
+    replace: the
+`)
+
+	report, err := executor.Drift(executor.DriftConfig{ConfigFilePath: configPath}, logger.NewTestLogger())
+	if err != nil {
+		t.Fatalf("Drift() error = %v", err)
+	}
+	if report.HasDrift() || len(report.Unchecked) != 1 || !strings.HasPrefix(report.Unchecked[0].Reason, "check failed: ") {
+		t.Errorf("report = %+v, want the step unchecked with the check error", report)
+	}
+}
+
+func TestDrift_MissingConfig(t *testing.T) {
+	if _, err := executor.Drift(executor.DriftConfig{}, logger.NewTestLogger()); err == nil {
+		t.Error("Drift() without config should fail")
+	}
+	_, err := executor.Drift(executor.DriftConfig{ConfigFilePath: filepath.Join(t.TempDir(), "missing.yml")}, logger.NewTestLogger())
+	if err == nil {
+		t.Error("Drift() with a missing config file should fail")
+	}
+}
@@ -1,6 +1,9 @@
 package executor
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Package executor provides custom error types for better error handling and categorization.
 //
@@ -8,10 +11,15 @@ import "fmt"
 // - Template rendering failed? → RenderError
 // - Expression evaluation failed? → EvaluationError
 // - Command execution failed? → CommandError
+// - Step attempt exceeded its timeout? → TimeoutError
+// - Run interrupted or past its --timeout? → CancelledError
 // - File system operation failed? → FileOperationError
 // - Infrastructure/environment setup failed? → SetupError
 // - Step parameter validation failed? → StepValidationError
 // - Assertion verification failed? → AssertionError
+// - Need to know which step failed? → StepError (added by ExecuteStep)
+// - Several steps failed in a keep-going run? → FailedStepsError
+// - Failed run saved a checkpoint? → ResumableError (wraps the run error)
 //
 // All error types support error unwrapping via errors.Is() and errors.As().
 
@@ -75,6 +83,34 @@ func (e *CommandError) Unwrap() error {
 	return e.Cause
 }
 
+// TimeoutError represents a step attempt that exceeded the step's timeout
+type TimeoutError struct {
+	Duration string // Configured timeout (e.g., "30s")
+	Cause    error  // Error returned by the handler after cancellation, if any
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("step timed out after %s", e.Duration)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Cause
+}
+
+// CancelledError represents a run that was interrupted (SIGINT/SIGTERM) or exceeded the run timeout
+type CancelledError struct {
+	Reason string // Why the run was cancelled (e.g., "received interrupt")
+	Cause  error  // Error returned by the step that was running, if any
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("run cancelled: %s", e.Reason)
+}
+
+func (e *CancelledError) Unwrap() error {
+	return e.Cause
+}
+
 // FileOperationError represents a file operation failure
 type FileOperationError struct {
 	Operation string // "create", "read", "write", "delete", "chmod", "chown", "link"
@@ -145,3 +181,83 @@ func (e *AssertionError) Error() string {
 func (e *AssertionError) Unwrap() error {
 	return e.Cause
 }
+
+// StepError records which step produced a failure.
+// ExecuteStep wraps the first error it sees so that callers further up the
+// execution tree (e.g., block rescue) can identify the innermost failed step.
+// The message is the cause's message, so wrapping is transparent to users.
+type StepError struct {
+	StepID string // ID of the failed step
+	Name   string // Display name of the failed step
+	Cause  error  // Error returned by the step
+}
+
+func (e *StepError) Error() string {
+	if e.Cause != nil {
+		return e.Cause.Error()
+	}
+	return fmt.Sprintf("step %s failed", e.StepID)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Cause
+}
+
+// FailedStepsError is returned by keep-going runs that finished with failed steps.
+// Each error is the (usually *StepError) error of one failed top-level step.
+type FailedStepsError struct {
+	Errors []error
+}
+
+func (e *FailedStepsError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d steps failed, first error: %v", len(e.Errors), e.Errors[0])
+}
+
+func (e *FailedStepsError) Unwrap() []error {
+	return e.Errors
+}
+
+// UndoConflictError is returned when paths changed by a run were modified since,
+// so undoing the run would lose those modifications.
+type UndoConflictError struct {
+	RunID string
+	Paths []string
+}
+
+func (e *UndoConflictError) Error() string {
+	return fmt.Sprintf("can't undo run %s, modified since the run: %s (use --force to undo anyway)",
+		e.RunID, strings.Join(e.Paths, ", "))
+}
+
+// ResumableError wraps the error of a failed or cancelled run that saved a checkpoint,
+// so the caller can tell the user how to resume it.
+type ResumableError struct {
+	RunID        string
+	ArtifactsDir string
+	Host         string // Remote host of the run, empty for this host
+	Root         string // Alternate root of the run, empty for "/"
+	Err          error
+}
+
+func (e *ResumableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ResumableError) Unwrap() error {
+	return e.Err
+}
+
+// ResumeCommand returns the command line that resumes the run.
+func (e *ResumableError) ResumeCommand() string {
+	command := fmt.Sprintf("mooncake run --resume %s --artifacts-dir %s", e.RunID, e.ArtifactsDir)
+	if e.Host != "" {
+		command += " --host " + e.Host
+	}
+	if e.Root != "" {
+		command += " --root " + e.Root
+	}
+	return command
+}
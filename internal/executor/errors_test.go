@@ -439,3 +439,22 @@ func TestAssertionError_TypeAssertion(t *testing.T) {
 		t.Errorf("Actual = %q, want %q", assertErr.Actual, "HTTP 404")
 	}
 }
+
+func TestResumableError_ResumeCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *ResumableError
+		want string
+	}{
+		{"local", &ResumableError{RunID: "r1", ArtifactsDir: ".mooncake"}, "mooncake run --resume r1 --artifacts-dir .mooncake"},
+		{"host", &ResumableError{RunID: "r1", ArtifactsDir: ".mooncake", Host: "web1"}, "mooncake run --resume r1 --artifacts-dir .mooncake --host web1"},
+		{"root", &ResumableError{RunID: "r1", ArtifactsDir: ".mooncake", Root: "/mnt/image"}, "mooncake run --resume r1 --artifacts-dir .mooncake --root /mnt/image"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.ResumeCommand(); got != tt.want {
+				t.Errorf("ResumeCommand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -104,9 +104,10 @@
 package executor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -122,8 +123,11 @@ import (
 	"github.com/alehatsman/mooncake/internal/logger"
 	"github.com/alehatsman/mooncake/internal/pathutil"
 	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/policy"
+	"github.com/alehatsman/mooncake/internal/sandbox"
 	"github.com/alehatsman/mooncake/internal/security"
 	"github.com/alehatsman/mooncake/internal/template"
+	"github.com/alehatsman/mooncake/internal/transport"
 	"github.com/alehatsman/mooncake/internal/utils"
 )
 
@@ -132,7 +136,7 @@ func generateStepID(step config.Step, ec *ExecutionContext) string {
 	if step.ID != "" {
 		return step.ID
 	}
-	return fmt.Sprintf("step-%d", *ec.Stats.Global)
+	return fmt.Sprintf("step-%d", ec.Stats.get(ec.Stats.Global))
 }
 
 // MarkStepFailed marks a result as failed and registers it if needed.
@@ -285,7 +289,7 @@ func CheckIdempotencyConditions(step config.Step, ec *ExecutionContext) (bool, s
 			return false, "", &RenderError{Field: "creates path", Cause: err}
 		}
 
-		if _, err := os.Stat(expandedPath); err == nil {
+		if _, err := ec.GetTransport().Stat(expandedPath); err == nil {
 			// Path exists - skip step
 			return true, fmt.Sprintf("creates: %s", expandedPath), nil
 		}
@@ -297,12 +301,21 @@ func CheckIdempotencyConditions(step config.Step, ec *ExecutionContext) (bool, s
 		if err != nil {
 			return false, "", &RenderError{Field: "unless command", Cause: err}
 		}
+		if err := checkSubjectPolicy(policy.Subject{Action: step.DetermineActionType(), Commands: policy.ShellCommands(command)}, ec); err != nil {
+			return false, "", err
+		}
 
 		// Execute unless command (silently, no logging)
 		// #nosec G204 -- This is a provisioning tool designed to execute commands from user configs.
 		// The command comes from user-provided YAML configuration files for idempotency checks.
-		cmd := exec.Command("sh", "-c", command)
-		if err := cmd.Run(); err == nil {
+		cmd := ec.Command("sh", "-c", command)
+		reports, err := ec.SandboxCommand(&step, cmd)
+		if err != nil {
+			return false, "", err
+		}
+		err = cmd.Run()
+		reports.Close()
+		if err == nil {
 			// Command succeeded - skip step
 			return true, fmt.Sprintf("unless: %s", command), nil
 		}
@@ -408,6 +421,21 @@ func GetStepDisplayName(step config.Step, ec *ExecutionContext) (string, bool) {
 
 
 
+// checkTransportSupport checks that an action can run on the target of a transport:
+// actions that don't go through the transport would act on this host.
+func checkTransportSupport(actionType string, metadata actions.ActionMetadata, target transport.Transport) error {
+	if transport.IsLocal(target) || metadata.SupportsRemote {
+		return nil
+	}
+	if _, ok := target.(*transport.Chroot); ok {
+		if metadata.SupportsRoot {
+			return nil
+		}
+		return fmt.Errorf("%s action is not supported in alternate roots (%s)", actionType, target)
+	}
+	return fmt.Errorf("%s action is not supported on remote hosts (%s)", actionType, target)
+}
+
 // DispatchStepAction executes the appropriate handler based on step type.
 // All actions are now handled through the actions registry.
 //
@@ -417,6 +445,16 @@ func DispatchStepAction(step config.Step, ec *ExecutionContext) error {
 	// Determine action type from step
 	actionType := step.DetermineActionType()
 
+	// Step groups run their nested steps directly
+	if actionType == "block" {
+		return ExecuteBlock(step, ec)
+	}
+
+	// Run handlers notified so far
+	if actionType == "flush_handlers" {
+		return FlushHandlers(ec)
+	}
+
 	// Try to get handler from registry (new system)
 	if handler, ok := actions.Get(actionType); ok {
 		// Validate step configuration
@@ -437,6 +475,20 @@ func DispatchStepAction(step config.Step, ec *ExecutionContext) error {
 			return fmt.Errorf("%s", errMsg)
 		}
 
+		// Actions that don't go through the transport would act on this host
+		if err := checkTransportSupport(actionType, handler.Metadata(), ec.GetTransport()); err != nil {
+			return err
+		}
+
+		if err := checkSandboxSupport(actionType, step); err != nil {
+			return err
+		}
+
+		// Check the step against the policy with its runtime values
+		if err := checkStepPolicy(step, ec); err != nil {
+			return err
+		}
+
 		// Handle dry-run mode
 		if ec.DryRun {
 			// Create a result for dry-run
@@ -447,6 +499,9 @@ func DispatchStepAction(step config.Step, ec *ExecutionContext) error {
 				return err
 			}
 
+			// Predict whether the step would change anything
+			checkStep(handler, step, ec, result)
+
 			// Register result if requested
 			if step.Register != "" {
 				result.RegisterTo(ec.Variables, step.Register)
@@ -454,9 +509,17 @@ func DispatchStepAction(step config.Step, ec *ExecutionContext) error {
 			return nil
 		}
 
-		// Execute the action
-		actionResult, err := handler.Execute(ec, &step)
+		// Execute the action (with retries, until and timeout)
+		stepID := ec.CurrentStepID
+		actionResult, err := executeWithRetry(handler, step, ec)
 		if err != nil {
+			// A failed step may have changed some paths before failing
+			commitJournal(step, ec, stepID, actionType, false)
+
+			// Keep the failed result so ignore_errors can register it
+			if failedResult, ok := actionResult.(*Result); ok && failedResult != nil {
+				ec.CurrentResult = failedResult
+			}
 			return err
 		}
 
@@ -474,6 +537,8 @@ func DispatchStepAction(step config.Step, ec *ExecutionContext) error {
 
 		// Store result in context
 		ec.CurrentResult = result
+		countChange(ec, result.Changed)
+		commitJournal(step, ec, stepID, actionType, result.Changed)
 
 		// Register result if requested
 		if step.Register != "" && actionResult != nil {
@@ -488,23 +553,52 @@ func DispatchStepAction(step config.Step, ec *ExecutionContext) error {
 }
 
 // ExecuteStep executes a single configuration step within the given execution context.
+//
+// Errors are returned as *StepError identifying the failed step. Errors that already
+// carry a StepError (from nested steps) are returned unchanged.
 func ExecuteStep(step config.Step, ec *ExecutionContext) error {
+	_, err := executeStep(step, ec)
+	return err
+}
+
+// executeStep runs a step and reports whether it changed anything.
+func executeStep(step config.Step, ec *ExecutionContext) (bool, error) {
+	// Don't start new steps once the run is cancelled
+	if err := ec.cancellation(nil); err != nil {
+		return false, err
+	}
+
 	// Validate step configuration
 	if err := step.Validate(); err != nil {
-		return err
+		return false, err
+	}
+
+	// In keep-going runs, skip steps that depend on a failed step or read
+	// variables a failed step left unset
+	if ec.Failures != nil {
+		if failedStepID, found := ec.Failures.failedDependency(step); found {
+			ec.Failures.markMissing(step, failedStepID)
+			skipDependentStep(step, ec, fmt.Sprintf("depends on failed step %s", failedStepID))
+			return false, nil
+		}
+		if variable, failedStepID, found := ec.Failures.missingInput(step); found {
+			ec.Failures.markMissing(step, failedStepID)
+			skipDependentStep(step, ec, fmt.Sprintf("depends on failed step %s (%s)", failedStepID, variable))
+			return false, nil
+		}
 	}
 
 	// Check if step should be skipped (when conditions, tags)
 	shouldSkip, skipReason, err := CheckSkipConditions(step, ec)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// Check idempotency conditions (creates, unless) - ONLY for shell/command steps
 	if !shouldSkip && (step.Shell != nil || step.Command != nil) {
 		idempotencySkip, idempotencyReason, err := CheckIdempotencyConditions(step, ec)
 		if err != nil {
-			return err
+			return false, err
 		}
 		if idempotencySkip {
 			shouldSkip = true
@@ -520,9 +614,7 @@ func ExecuteStep(step config.Step, ec *ExecutionContext) error {
 		// Log skipped steps (only for named, non-include steps)
 		if hasStepName && step.Include == nil {
 			// Update skipped statistics
-			if ec.Stats.Skipped != nil {
-				*ec.Stats.Skipped++
-			}
+			ec.Stats.add(ec.Stats.Skipped, 1)
 
 			// Emit step.skipped event
 			stepID := generateStepID(step, ec)
@@ -539,7 +631,12 @@ func ExecuteStep(step config.Step, ec *ExecutionContext) error {
 			})
 		}
 
-		return nil
+		return false, nil
+	}
+
+	// Hide what the step prints, returns and fails with
+	if step.NoLog && !ec.NoLog {
+		defer hideStepOutput(ec)()
 	}
 
 	// Debug: show tags for non-skipped steps
@@ -557,9 +654,7 @@ func ExecuteStep(step config.Step, ec *ExecutionContext) error {
 	}
 
 	// Increment global step counter for non-skipped steps
-	if ec.Stats.Global != nil {
-		*ec.Stats.Global++
-	}
+	globalStep := ec.Stats.add(ec.Stats.Global, 1)
 
 	// Generate step ID and store in context for event correlation
 	stepID := generateStepID(step, ec)
@@ -571,34 +666,73 @@ func ExecuteStep(step config.Step, ec *ExecutionContext) error {
 		depth = step.LoopContext.Depth
 	}
 
+	origin := ""
+	if step.Origin != nil && step.Origin.FilePath != "" {
+		origin = fmt.Sprintf("%s:%d", step.Origin.FilePath, step.Origin.Line)
+	}
+
 	// Emit step.started event
 	ec.EmitEvent(events.EventStepStarted, events.StepStartedData{
 		StepID:     stepID,
 		Name:       stepName,
 		Level:      ec.Level,
-		GlobalStep: *ec.Stats.Global,
+		GlobalStep: globalStep,
 		Action:     step.ActionType,
 		Tags:       step.Tags,
 		When:       step.When,
 		Depth:      depth,
+		Origin:     origin,
 		DryRun:     ec.DryRun,
 	})
 
+	// Remember the failure count so an ignored block can discount its nested failures
+	failuresBefore := 0
+	if ec.Failures != nil {
+		failuresBefore = ec.Failures.Len()
+	}
+
 	// Track start time for duration
 	stepStartTime := time.Now()
 
 	// Execute the appropriate handler
+	ec.CurrentResult = nil
 	stepErr := DispatchStepAction(step, ec)
+	registerSecretVariables(ec)
 
 	// Calculate duration
 	stepDuration := time.Since(stepStartTime)
 
 	// Handle errors
 	if stepErr != nil {
-		ec.Logger.Errorf("%v", stepErr)
-		// Update failed statistics
-		if ec.Stats.Failed != nil {
-			*ec.Stats.Failed++
+		cause := stepErr
+		if ec.NoLog {
+			stepErr = &hiddenError{err: stepErr}
+		}
+
+		// Cancellation stops the run, so it can't be ignored
+		reason := failureReason(stepErr)
+		ignored := step.IgnoreErrors && reason != FailureReasonCancelled
+		if ignored {
+			ec.Logger.Debugf("ignoring error: %v", stepErr)
+		} else {
+			ec.Logger.Errorf("%v", stepErr)
+		}
+
+		// Update failure records (a failed block is already counted by its nested step)
+		if step.Block == nil {
+			if !ignored {
+				ec.Stats.add(ec.Stats.Failed, 1)
+			}
+			if ec.Failures != nil {
+				ec.Failures.record(ec.failureScope, events.StepFailure{
+					StepID:       stepID,
+					Name:         stepName,
+					ErrorMessage: stepErr.Error(),
+					Ignored:      ignored,
+				})
+			}
+		} else if ignored && ec.Failures != nil {
+			ec.Stats.add(ec.Stats.Failed, -ec.Failures.ignore(ec.failureScope, failuresBefore))
 		}
 
 		// Emit step.failed event
@@ -609,25 +743,46 @@ func ExecuteStep(step config.Step, ec *ExecutionContext) error {
 			ErrorMessage: stepErr.Error(),
 			DurationMs:   stepDuration.Milliseconds(),
 			Depth:        depth,
+			Ignored:      ignored,
+			Reason:       reason,
 			DryRun:       ec.DryRun,
 		})
 
-		return stepErr
+		if ignored {
+			registerFailedResult(step, cause, ec)
+			return false, nil
+		}
+		ec.CurrentResult = nil
+
+		// Record the failed step unless a nested step already did
+		var nestedErr *StepError
+		if !errors.As(stepErr, &nestedErr) {
+			stepErr = &StepError{StepID: stepID, Name: stepName, Cause: stepErr}
+		}
+
+		return false, stepErr
 	}
 
 	// Update executed statistics
-	if ec.Stats.Executed != nil {
-		*ec.Stats.Executed++
-	}
+	ec.Stats.add(ec.Stats.Executed, 1)
 
 	// Get result data if handler provided it
-	changed := false
+	changed, predicted := false, false
 	var resultData map[string]interface{}
 	if ec.CurrentResult != nil {
 		changed = ec.CurrentResult.Changed
+		predicted = ec.CurrentResult.predicted
 		resultData = ec.CurrentResult.ToMap()
 	}
 
+	// Queue notified handlers. In dry-run, handlers of steps whose change can't
+	// be predicted are queued too and shown as what would run.
+	if len(step.Notify) > 0 && (changed || (ec.DryRun && !predicted)) {
+		if err := notifyHandlers(step, stepID, ec); err != nil {
+			return changed, err
+		}
+	}
+
 	// Emit step.completed event
 	ec.EmitEvent(events.EventStepCompleted, events.StepCompletedData{
 		StepID:     stepID,
@@ -643,7 +798,7 @@ func ExecuteStep(step config.Step, ec *ExecutionContext) error {
 	// Clear current result for next step
 	ec.CurrentResult = nil
 
-	return nil
+	return changed, nil
 }
 
 // ExecuteSteps executes a sequence of configuration steps within the given execution context.
@@ -653,39 +808,116 @@ func ExecuteSteps(steps []config.Step, ec *ExecutionContext) error {
 	// Set total steps for this execution context
 	ec.TotalSteps = len(steps)
 
+	var failed []error
 	for i, step := range steps {
 		ec.CurrentIndex = i
+		prepareStepScope(step, ec)
 
-		// If step has origin metadata (from planner), use its directory
-		// This ensures relative paths work correctly for included files
-		if step.Origin != nil && step.Origin.FilePath != "" {
-			ec.CurrentDir = filepath.Dir(step.Origin.FilePath)
-			ec.CurrentFile = step.Origin.FilePath
-		}
+		if err := ExecuteStep(step, ec); err != nil {
+			ec.checkpoint.stepFailed(step, err)
 
-		// If step has loop context (from planner), restore loop variables
-		// This ensures when conditions can reference item, index, first, last
-		if step.LoopContext != nil {
-			ec.Variables["item"] = step.LoopContext.Item
-			ec.Variables["index"] = step.LoopContext.Index
-			ec.Variables["first"] = step.LoopContext.First
-			ec.Variables["last"] = step.LoopContext.Last
-		} else {
-			// Clear loop variables for steps without loop context
-			// to prevent stale values from previous loop iterations
-			delete(ec.Variables, "item")
-			delete(ec.Variables, "index")
-			delete(ec.Variables, "first")
-			delete(ec.Variables, "last")
-		}
+			var cancelErr *CancelledError
+			if !ec.KeepGoing || errors.As(err, &cancelErr) {
+				return err
+			}
 
-		if err := ExecuteStep(step, ec); err != nil {
-			return err
+			// Keep going, but steps reading this step's outputs will be skipped
+			markFailed(step, err, ec)
+			failed = append(failed, err)
+			continue
 		}
+		ec.checkpoint.stepDone(step, ec.Variables)
+	}
+
+	if len(failed) > 0 {
+		return &FailedStepsError{Errors: failed}
 	}
 	return nil
 }
 
+// markFailed records a failed top-level step in keep-going mode, so the steps
+// depending on it or reading its outputs are skipped.
+func markFailed(step config.Step, err error, ec *ExecutionContext) {
+	if ec.Failures == nil {
+		return
+	}
+	failedStepID := ec.CurrentStepID
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		failedStepID = stepErr.StepID
+	}
+	ec.Failures.markMissing(step, failedStepID)
+}
+
+// skipDependentStep reports a step skipped because its input comes from a failed step.
+func skipDependentStep(step config.Step, ec *ExecutionContext, reason string) {
+	stepName, hasStepName := GetStepDisplayName(step, ec)
+	if !hasStepName || step.Include != nil {
+		return
+	}
+
+	ec.Stats.add(ec.Stats.Skipped, 1)
+
+	depth := 0
+	if step.LoopContext != nil {
+		depth = step.LoopContext.Depth
+	}
+	ec.EmitEvent(events.EventStepSkipped, events.StepSkippedData{
+		StepID: generateStepID(step, ec),
+		Name:   stepName,
+		Level:  ec.Level,
+		Reason: reason,
+		Depth:  depth,
+	})
+}
+
+// registerFailedResult registers the result of a step whose error is ignored.
+// The error message is available as the "error" field of the registered result.
+func registerFailedResult(step config.Step, stepErr error, ec *ExecutionContext) {
+	result := ec.CurrentResult
+	if result == nil {
+		result = NewResult()
+	}
+	result.Failed = true
+	if result.Rc == 0 {
+		result.Rc = 1
+	}
+	result.SetData(map[string]interface{}{
+		"error": stepErr.Error(),
+	})
+
+	if step.Register != "" {
+		result.RegisterTo(ec.Variables, step.Register)
+	}
+	ec.CurrentResult = nil
+}
+
+// prepareStepScope points the context at the step's source file and loop iteration.
+func prepareStepScope(step config.Step, ec *ExecutionContext) {
+	// If step has origin metadata (from planner), use its directory
+	// This ensures relative paths work correctly for included files
+	if step.Origin != nil && step.Origin.FilePath != "" {
+		ec.CurrentDir = filepath.Dir(step.Origin.FilePath)
+		ec.CurrentFile = step.Origin.FilePath
+	}
+
+	// If step has loop context (from planner), restore loop variables
+	// This ensures when conditions can reference item, index, first, last
+	if step.LoopContext != nil {
+		ec.Variables["item"] = step.LoopContext.Item
+		ec.Variables["index"] = step.LoopContext.Index
+		ec.Variables["first"] = step.LoopContext.First
+		ec.Variables["last"] = step.LoopContext.Last
+	} else {
+		// Clear loop variables for steps without loop context
+		// to prevent stale values from previous loop iterations
+		delete(ec.Variables, "item")
+		delete(ec.Variables, "index")
+		delete(ec.Variables, "first")
+		delete(ec.Variables, "last")
+	}
+}
+
 // StartConfig contains configuration for starting a mooncake execution.
 type StartConfig struct {
 	ConfigFilePath   string
@@ -696,24 +928,80 @@ type StartConfig struct {
 	InsecureSudoPass bool
 	Tags             []string
 	DryRun           bool
-
-	// Artifact configuration
+	Diff             bool // Show predicted file changes in a dry run (see PlanOptions.Diff)
+	KeepGoing        bool // Continue after failed steps (see PlanOptions.KeepGoing)
+	Parallel         int  // Number of steps run concurrently (see PlanOptions.Parallel)
+
+	// Cancellation (see PlanOptions.Context and PlanOptions.Timeout)
+	Context context.Context
+	Timeout time.Duration
+
+	// Host applies the config to a remote [user@]host[:port] over SSH: the plan is
+	// built with the facts of the host and its steps run over one SSH connection.
+	// Empty applies it to this host.
+	Host string
+
+	// Root applies the config to an alternate root directory on this host, such as
+	// the root file system of an image: the plan is built with the facts of the
+	// root, paths are resolved under it and commands run in it with chroot.
+	// Empty applies it to "/". Can't be combined with Host.
+	Root string
+
+	// Vars are variables of the run, overriding those of the variables file
+	// (e.g. the inventory variables of a host).
+	Vars map[string]interface{}
+
+	// Resuming (see PlanOptions.Resume and PlanOptions.StartAt). ResumeRunID is a run
+	// in ArtifactsDir (default: artifacts.DefaultBaseDir); without ConfigFilePath, the
+	// plan saved by that run is used. Force resumes even if the plan has changed.
+	ResumeRunID string
+	StartAt     string
+	Force       bool
+
+	// Policy constrains what the steps may do (see PlanOptions.Policy).
+	Policy *policy.Policy
+
+	// Sandbox runs the commands of shell and command steps in a sandbox (see
+	// PlanOptions.Sandbox).
+	Sandbox *sandbox.Config
+
+	// Artifact configuration. RunID names the run directory in ArtifactsDir
+	// (default: generated from the start time, config and host).
 	ArtifactsDir      string
+	RunID             string
 	CaptureFullOutput bool
 	MaxOutputBytes    int
 	MaxOutputLines    int
 }
 
 // Start begins execution of a mooncake configuration with the given settings.
-// Always goes through the planner to expand loops, includes, and variables.
+// Goes through the planner to expand loops, includes, and variables, unless it
+// resumes the saved plan of a previous run.
 // Emits events through the provided publisher for all execution progress.
 func Start(startConfig StartConfig, log logger.Logger, publisher events.Publisher) error {
 	log.Debugf("config: %v", startConfig)
 
-	if startConfig.ConfigFilePath == "" {
+	// Forget the secrets of the run once it and the other runs in progress end
+	defer security.BeginRun()()
+
+	if startConfig.ConfigFilePath == "" && startConfig.ResumeRunID == "" {
 		return &SetupError{Component: "config", Issue: "config file path is empty"}
 	}
 
+	// Load the checkpoint of the run to resume
+	var resumed *artifacts.Checkpoint
+	var resumedPlan *plan.Plan
+	if startConfig.ResumeRunID != "" {
+		if startConfig.ArtifactsDir == "" {
+			startConfig.ArtifactsDir = artifacts.DefaultBaseDir
+		}
+		var err error
+		resumed, resumedPlan, err = loadResumedRun(startConfig.ArtifactsDir, startConfig.ResumeRunID, startConfig.ConfigFilePath == "")
+		if err != nil {
+			return err
+		}
+	}
+
 	// Resolve sudo password early (before plan building)
 	passwordCfg := security.PasswordConfig{
 		CLIPassword:    startConfig.SudoPass,
@@ -739,29 +1027,166 @@ func Start(startConfig StartConfig, log logger.Logger, publisher events.Publishe
 		return err
 	}
 
+	// Connect to the target host, or open the alternate root
+	var target transport.Transport
+	var targetFacts *facts.Facts
+	if startConfig.Host != "" && startConfig.Root != "" {
+		return &SetupError{Component: "root", Issue: "an alternate root can't be used on remote hosts"}
+	}
+	if startConfig.Host != "" {
+		ctx := startConfig.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		sshTarget, hostFacts, err := ConnectHost(ctx, startConfig.Host)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = sshTarget.Close() }()
+		target, targetFacts = sshTarget, hostFacts
+		log.Debugf("Connected to %s", sshTarget)
+	}
+	if startConfig.Root != "" {
+		chroot, rootFacts, err := OpenRoot(startConfig.Root)
+		if err != nil {
+			return err
+		}
+		target, targetFacts = chroot, rootFacts
+		log.Debugf("Using root %s", chroot.Root)
+	}
+
+	planData := resumedPlan
+	if planData == nil {
+		planData, err = buildStartPlan(startConfig, targetFacts, pathExpander, currentDir, log)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("Plan built with %d steps", len(planData.Steps))
+
+	if resumed != nil {
+		if err := checkPlanUnchanged(planData, resumed, startConfig.Force, log); err != nil {
+			return err
+		}
+	}
+
+	opts := PlanOptions{
+		SudoPass:  sudoPassword,
+		DryRun:    startConfig.DryRun,
+		Diff:      startConfig.Diff,
+		KeepGoing: startConfig.KeepGoing,
+		Parallel:  startConfig.Parallel,
+		Context:   startConfig.Context,
+		Timeout:   startConfig.Timeout,
+		Resume:    resumed,
+		StartAt:   startConfig.StartAt,
+		Transport: target,
+		Policy:    startConfig.Policy,
+		Sandbox:   startConfig.Sandbox,
+	}
+
+	// Setup artifact writer if artifacts-dir is specified
+	var artifactWriter *artifacts.Writer
+	if startConfig.ArtifactsDir != "" {
+		// Gather system facts for artifact generation
+		systemFacts := targetFacts
+		if systemFacts == nil {
+			systemFacts = facts.Collect()
+		}
+
+		// Create artifact writer
+		artifactWriter, err = artifacts.NewWriter(
+			artifacts.Config{
+				BaseDir:        startConfig.ArtifactsDir,
+				RunID:          startConfig.RunID,
+				CaptureStdout:  startConfig.CaptureFullOutput,
+				CaptureStderr:  startConfig.CaptureFullOutput,
+				MaxOutputBytes: startConfig.MaxOutputBytes,
+				MaxOutputLines: startConfig.MaxOutputLines,
+			},
+			planData,
+			systemFacts,
+		)
+		if err != nil {
+			return &SetupError{Component: "artifacts", Issue: "failed to create artifact writer", Cause: err}
+		}
+		defer func() {
+			// Deliver pending events first: run.completed writes the summary
+			publisher.Flush()
+			artifactWriter.Close()
+		}()
+
+		// Subscribe artifact writer to events
+		publisher.Subscribe(artifactWriter)
+		opts.RunID = artifactWriter.RunID()
+
+		// Save a checkpoint after every step so the run can be resumed, and
+		// journal the changes so it can be undone (only on this host: the journal
+		// keeps local copies of the files a step changes)
+		if !startConfig.DryRun {
+			opts.CheckpointDir = artifactWriter.RunDir()
+			if target == nil {
+				opts.JournalDir = artifactWriter.RunDir()
+			} else {
+				reason := fmt.Sprintf("changes on %s aren't journaled, so it can be resumed but not undone", target)
+				log.Infof("Warning: run %s %s", artifactWriter.RunID(), reason)
+				if err := artifacts.SkipJournal(artifactWriter.RunDir(), reason); err != nil {
+					return &SetupError{Component: "artifacts", Issue: "failed to write run artifacts", Cause: err}
+				}
+			}
+		}
+
+		log.Debugf("Artifacts will be written to: %s", artifactWriter.RunDir())
+	}
+
+	// Execute the plan with event publisher
+	err = ExecutePlanWithOptions(planData, opts, log, publisher)
+	if err != nil && opts.CheckpointDir != "" {
+		var setupErr *SetupError
+		// A checkpoint with redacted results can't be resumed
+		checkpoint, loadErr := artifacts.LoadCheckpoint(opts.CheckpointDir)
+		if !errors.As(err, &setupErr) && (loadErr != nil || !checkpoint.Redacted) {
+			return &ResumableError{RunID: artifactWriter.RunID(), ArtifactsDir: startConfig.ArtifactsDir, Host: startConfig.Host, Root: startConfig.Root, Err: err}
+		}
+	}
+	return err
+}
+
+// buildStartPlan builds the plan of the config file, with the variables file if given,
+// for the host with the given facts (nil: this host).
+func buildStartPlan(startConfig StartConfig, hostFacts *facts.Facts, pathExpander *pathutil.PathExpander, currentDir string, log logger.Logger) (*plan.Plan, error) {
+	var err error
+
 	// Load variables if specified
 	var variables map[string]interface{}
 	if startConfig.VarsFilePath != "" {
 		expandedPath, expandErr := pathExpander.ExpandPath(startConfig.VarsFilePath, currentDir, nil)
 		if expandErr != nil {
-			return &RenderError{Field: "vars file path", Cause: expandErr}
+			return nil, &RenderError{Field: "vars file path", Cause: expandErr}
 		}
 
 		log.Debugf("Reading variables from file: %v", expandedPath)
 		variables, err = config.ReadVariables(expandedPath)
+		var decryptErr *config.DecryptError
+		if errors.As(err, &decryptErr) {
+			return nil, &SetupError{Component: "variables", Issue: "failed to read variables file", Cause: err}
+		}
 		if err != nil {
 			log.Debugf("Failed to read variables: %v", err)
 			variables = make(map[string]interface{})
 		}
-		log.Debugf("Read variables: %v", variables)
+		// Values are not logged: they may be secrets of an encrypted file
+		log.Debugf("Read %d variables", len(variables))
 	} else {
 		variables = make(map[string]interface{})
 	}
+	variables = utils.MergeVariables(variables, startConfig.Vars)
 
 	// Expand config file path
 	configFilePath, err := pathExpander.ExpandPath(startConfig.ConfigFilePath, currentDir, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	log.Debugf("Building plan from configuration: %v", configFilePath)
@@ -769,65 +1194,133 @@ func Start(startConfig StartConfig, log logger.Logger, publisher events.Publishe
 	// ALWAYS build plan first (expands loops, includes, vars)
 	planner, err := plan.NewPlanner()
 	if err != nil {
-		return &SetupError{Component: "planner", Issue: "failed to create planner", Cause: err}
+		return nil, &SetupError{Component: "planner", Issue: "failed to create planner", Cause: err}
 	}
 	planData, err := planner.BuildPlan(plan.PlannerConfig{
 		ConfigPath: configFilePath,
 		Variables:  variables,
 		Tags:       startConfig.Tags,
+		Facts:      hostFacts,
 	})
 	if err != nil {
-		return &SetupError{Component: "planner", Issue: "failed to build plan", Cause: err}
+		return nil, &SetupError{Component: "planner", Issue: "failed to build plan", Cause: err}
 	}
 
-	log.Debugf("Plan built with %d steps", len(planData.Steps))
+	return planData, nil
+}
 
-	// Setup artifact writer if artifacts-dir is specified
-	if startConfig.ArtifactsDir != "" {
-		// Gather system facts for artifact generation
-		systemFacts := facts.Collect()
+// PlanOptions controls how a plan is executed.
+type PlanOptions struct {
+	SudoPass  string
+	DryRun    bool
+	KeepGoing bool // Continue after failed steps, skipping only steps that depend on them
 
-		// Create artifact writer
-		artifactWriter, err := artifacts.NewWriter(
-			artifacts.Config{
-				BaseDir:        startConfig.ArtifactsDir,
-				CaptureStdout:  startConfig.CaptureFullOutput,
-				CaptureStderr:  startConfig.CaptureFullOutput,
-				MaxOutputBytes: startConfig.MaxOutputBytes,
-				MaxOutputLines: startConfig.MaxOutputLines,
-			},
-			planData,
-			systemFacts,
-		)
-		if err != nil {
-			return &SetupError{Component: "artifacts", Issue: "failed to create artifact writer", Cause: err}
-		}
-		defer artifactWriter.Close()
+	// Diff emits a step.diff event with the predicted file changes of each step
+	// in a dry run (see actions.Checker).
+	Diff bool
 
-		// Subscribe artifact writer to events
-		publisher.Subscribe(artifactWriter)
+	// Parallel is the number of steps run concurrently, following the plan's depends_on
+	// graph. Zero uses DefaultParallelWorkers if the plan's strategy is parallel and runs
+	// sequentially otherwise; 1 always runs sequentially.
+	Parallel int
 
-		log.Debugf("Artifacts will be written to: %s/runs/%s", startConfig.ArtifactsDir, "...")
-	}
+	// Context cancels the run when done (e.g., on SIGINT). Nil means context.Background().
+	// The running step fails with a CancelledError and no further steps start.
+	Context context.Context
 
-	// Execute the plan with event publisher
-	return ExecutePlan(planData, sudoPassword, startConfig.DryRun, log, publisher)
+	// Timeout limits the duration of the whole run. Zero means no limit.
+	Timeout time.Duration
+
+	// CheckpointDir is the run directory the checkpoint is saved to after every
+	// top-level step. Empty disables checkpointing.
+	CheckpointDir string
+
+	// JournalDir is the run directory the change journal is written to, for
+	// `mooncake undo`. Empty disables the journal.
+	JournalDir string
+
+	// Drift collects the resources whose actual state differs from the plan, as
+	// found by the step checks of a dry run (see Drift).
+	Drift *DriftReport
+
+	// Resume continues a previous run: the steps it completed are skipped and the
+	// results they registered are restored. The caller checks the plan hash.
+	Resume *artifacts.Checkpoint
+
+	// StartAt skips the top-level steps before the step with this ID or name.
+	StartAt string
+
+	// RunID is reported in the run.started event: the ID of the run's artifacts
+	// directory, empty if the run has none.
+	RunID string
+
+	// Transport runs the steps on the target host. Nil means this host.
+	Transport transport.Transport
+
+	// Policy constrains what the steps may do: the plan is checked against it
+	// before the run, and every step again before it runs. Nil allows everything.
+	Policy *policy.Policy
+
+	// Sandbox runs the commands of every shell and command step in a sandbox
+	// (Linux only), narrowed by the sandbox field of the steps. Its writable
+	// paths must be absolute. Nil only sandboxes steps with a sandbox field.
+	Sandbox *sandbox.Config
+}
+
+// parallelWorkers returns the number of workers for a plan run (1 for a sequential run).
+func parallelWorkers(p *plan.Plan, parallel int) int {
+	if parallel == 0 && p.Strategy == config.StrategyParallel {
+		return DefaultParallelWorkers
+	}
+	return parallel
 }
 
 // ExecutePlan executes a pre-compiled plan.
 // Emits events through the provided publisher for all execution progress.
 func ExecutePlan(p *plan.Plan, sudoPass string, dryRun bool, log logger.Logger, publisher events.Publisher) error {
+	return ExecutePlanWithOptions(p, PlanOptions{SudoPass: sudoPass, DryRun: dryRun}, log, publisher)
+}
+
+// ExecutePlanWithOptions executes a pre-compiled plan with the given options.
+// Emits events through the provided publisher for all execution progress.
+func ExecutePlanWithOptions(p *plan.Plan, opts PlanOptions, log logger.Logger, publisher events.Publisher) error {
+	// The secrets of a redacted plan are gone
+	if p.Redacted {
+		return &SetupError{Component: "plan", Issue: "the plan has redacted secrets and can't be run (run the config instead)"}
+	}
+
+	// Check the plan against the policy before anything runs
+	if opts.Policy != nil {
+		if err := checkPlanPolicy(p, opts.Policy); err != nil {
+			return err
+		}
+	}
+
+	sudoPass, dryRun := opts.SudoPass, opts.DryRun
 	steps := p.Steps
 	variables := p.InitialVars
 
 	// Start timing
 	startTime := time.Now()
 
+	// Apply the run timeout to the run context
+	runCtx := opts.Context
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeoutCause(runCtx, opts.Timeout,
+			fmt.Errorf("run timed out after %s", opts.Timeout))
+		defer cancel()
+	}
+
 	// Emit run.started event
 	publisher.Publish(events.Event{
 		Type:      events.EventRunStarted,
 		Timestamp: time.Now(),
 		Data: events.RunStartedData{
+			RunID:      opts.RunID,
 			RootFile:   p.RootFile,
 			Tags:       p.Tags,
 			DryRun:     dryRun,
@@ -859,6 +1352,8 @@ func ExecutePlan(p *plan.Plan, sudoPass string, dryRun bool, log logger.Logger,
 	redactor := security.NewRedactor()
 	if sudoPass != "" {
 		redactor.AddSensitive(sudoPass)
+		// Keep it out of events too
+		security.RegisterSecret(sudoPass)
 	}
 
 	// Set redactor on logger for automatic redaction
@@ -878,6 +1373,10 @@ func ExecutePlan(p *plan.Plan, sudoPass string, dryRun bool, log logger.Logger,
 	statsExecuted := 0
 	statsSkipped := 0
 	statsFailed := 0
+	statsRescued := 0
+	statsChanged := 0
+	statsUnchanged := 0
+	statsUnchecked := 0
 
 	executionContext := ExecutionContext{
 		Variables:    variables,
@@ -890,13 +1389,18 @@ func ExecutePlan(p *plan.Plan, sudoPass string, dryRun bool, log logger.Logger,
 		SudoPass:     sudoPass,
 		Tags:         []string{}, // Not used - tag filtering done by planner (step.Skipped)
 		DryRun:       dryRun,
+		Diff:         opts.Diff,
 
 		// Statistics tracking
 		Stats: &ExecutionStats{
-			Global:   &globalExecuted,
-			Executed: &statsExecuted,
-			Skipped:  &statsSkipped,
-			Failed:   &statsFailed,
+			Global:    &globalExecuted,
+			Executed:  &statsExecuted,
+			Skipped:   &statsSkipped,
+			Failed:    &statsFailed,
+			Rescued:   &statsRescued,
+			Changed:   &statsChanged,
+			Unchanged: &statsUnchanged,
+			Unchecked: &statsUnchecked,
 		},
 
 		// Inject dependencies
@@ -908,31 +1412,83 @@ func ExecutePlan(p *plan.Plan, sudoPass string, dryRun bool, log logger.Logger,
 
 		// Event publisher
 		EventPublisher: publisher,
+
+		// Handlers notified by changed steps
+		Handlers: NewHandlerQueue(p.Handlers),
+
+		// Failure handling
+		KeepGoing: opts.KeepGoing,
+		Failures:  NewFailureTracker(),
+
+		// Cancellation and run timeout
+		Context: runCtx,
+
+		Transport: opts.Transport,
+
+		secrets: p.Secrets,
+		drift:   opts.Drift,
+	}
+	registerSecretVariables(&executionContext)
+	if opts.Policy != nil {
+		executionContext.policy = opts.Policy.NewEnforcer()
+	}
+	executionContext.sandbox = opts.Sandbox
+
+	if opts.CheckpointDir != "" {
+		planHash, err := p.Hash()
+		if err != nil {
+			return &SetupError{Component: "checkpoint", Issue: "failed to hash plan", Cause: err}
+		}
+		executionContext.checkpoint = newCheckpointer(opts.CheckpointDir, planHash, opts.Resume, executionContext.Handlers, log)
 	}
 
+	if opts.JournalDir != "" && !dryRun {
+		journal, err := artifacts.OpenJournal(opts.JournalDir)
+		if err != nil {
+			return &SetupError{Component: "journal", Issue: "failed to open journal", Cause: err}
+		}
+		defer func() { _ = journal.Close() }()
+		executionContext.journal = journal
+	}
+
+	// Skip the steps completed by a resumed run or before the start step
+	steps, execErr := skipBeforeStart(steps, opts.Resume, opts.StartAt, &executionContext)
+
 	// Execute pre-expanded steps
-	execErr := ExecuteSteps(steps, &executionContext)
+	if execErr == nil {
+		if workers := parallelWorkers(p, opts.Parallel); workers > 1 {
+			execErr = ExecuteStepsParallel(steps, &executionContext, workers)
+		} else {
+			execErr = ExecuteSteps(steps, &executionContext)
+		}
+	}
+
+	// Run notified handlers once the main steps succeeded
+	if execErr == nil {
+		execErr = FlushHandlers(&executionContext)
+	}
+	executionContext.checkpoint.flush()
 
 	// Calculate duration
 	duration := time.Since(startTime)
 
-	// Emit run.completed event (console subscriber handles display)
-	changedSteps := 0
-	// Count changed steps (steps that were executed and not failed)
-	// Changed status is tracked elsewhere, for now use simplified logic
-	if execErr == nil {
-		changedSteps = statsExecuted
+	droppedEvents := 0
+	if counter, ok := publisher.(events.DropCounter); ok {
+		droppedEvents = counter.Dropped()
 	}
 
+	// Emit run.completed event (console subscriber handles display)
 	publisher.Publish(events.Event{
 		Type:      events.EventRunCompleted,
 		Timestamp: time.Now(),
 		Data: events.RunCompletedData{
-			TotalSteps:   len(steps),
+			TotalSteps:   len(p.Steps),
 			SuccessSteps: statsExecuted,
 			FailedSteps:  statsFailed,
 			SkippedSteps: statsSkipped,
-			ChangedSteps: changedSteps,
+			ChangedSteps: statsChanged,
+			RescuedSteps: statsRescued,
+			IgnoredSteps: executionContext.Failures.Ignored(),
 			DurationMs:   duration.Milliseconds(),
 			Success:      execErr == nil,
 			ErrorMessage: func() string {
@@ -941,6 +1497,11 @@ func ExecutePlan(p *plan.Plan, sudoPass string, dryRun bool, log logger.Logger,
 				}
 				return ""
 			}(),
+			UnchangedSteps: statsUnchanged,
+			UncheckedSteps: statsUnchecked,
+			DryRun:         dryRun,
+			Failures:       executionContext.Failures.List(),
+			DroppedEvents:  droppedEvents,
 		},
 	})
 
@@ -0,0 +1,184 @@
+package executor
+
+import (
+	"sync"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/plan"
+)
+
+// FailureTracker records failed steps during a run.
+//
+// In keep-going mode it also tracks the variables that failed steps left unset,
+// and the steps that failed or were skipped because of a failure, so later steps
+// reading those variables or depending on those steps can be skipped instead of
+// running on missing input.
+type FailureTracker struct {
+	mu       sync.Mutex
+	failures []failureRecord
+	missing  map[string]string // variable name -> ID of the failed step
+	blocked  map[string]string // failed or skipped step ID -> ID of the failed step
+}
+
+// failureRecord is a recorded failure along with the scope it was recorded in.
+type failureRecord struct {
+	failure events.StepFailure
+	scope   string
+}
+
+// NewFailureTracker creates an empty failure tracker.
+func NewFailureTracker() *FailureTracker {
+	return &FailureTracker{
+		missing: make(map[string]string),
+		blocked: make(map[string]string),
+	}
+}
+
+// Record adds a failed step.
+func (t *FailureTracker) Record(failure events.StepFailure) {
+	t.record("", failure)
+}
+
+// record adds a failed step recorded in the given scope.
+func (t *FailureTracker) record(scope string, failure events.StepFailure) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures = append(t.failures, failureRecord{failure: failure, scope: scope})
+}
+
+// List returns all recorded failures in the order they happened.
+func (t *FailureTracker) List() []events.StepFailure {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	list := make([]events.StepFailure, 0, len(t.failures))
+	for _, record := range t.failures {
+		list = append(list, record.failure)
+	}
+	return list
+}
+
+// Len returns the number of recorded failures.
+func (t *FailureTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.failures)
+}
+
+// Ignored returns the number of recorded failures that were ignored.
+func (t *FailureTracker) Ignored() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	count := 0
+	for _, record := range t.failures {
+		if record.failure.Ignored {
+			count++
+		}
+	}
+	return count
+}
+
+// discard drops the failures of a scope recorded after the first n (used when a
+// block rescues them). Returns how many of them were not ignored.
+func (t *FailureTracker) discard(scope string, n int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if n >= len(t.failures) {
+		return 0
+	}
+
+	counted := 0
+	kept := t.failures[:n]
+	for _, record := range t.failures[n:] {
+		if record.scope != scope {
+			kept = append(kept, record)
+			continue
+		}
+		if !record.failure.Ignored {
+			counted++
+		}
+	}
+	t.failures = kept
+	return counted
+}
+
+// ignore marks the failures of a scope recorded after the first n as ignored (used
+// when a block ignores errors). Returns how many of them were not ignored before.
+func (t *FailureTracker) ignore(scope string, n int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counted := 0
+	for i := n; i < len(t.failures); i++ {
+		if t.failures[i].scope == scope && !t.failures[i].failure.Ignored {
+			t.failures[i].failure.Ignored = true
+			counted++
+		}
+	}
+	return counted
+}
+
+// markMissing records the variables the step (and its nested steps) would have set.
+// Steps depending on this step (or on the failed step) are blocked as well.
+func (t *FailureTracker) markMissing(step config.Step, failedStepID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.blocked[failedStepID] = failedStepID
+	if step.ID != "" {
+		t.blocked[step.ID] = failedStepID
+	}
+
+	var mark func(step config.Step)
+	mark = func(step config.Step) {
+		if step.Register != "" {
+			t.missing[step.Register] = failedStepID
+		}
+		if step.Vars != nil {
+			for name := range *step.Vars {
+				t.missing[name] = failedStepID
+			}
+		}
+		for _, section := range [][]config.Step{step.Block, step.Rescue, step.Always} {
+			for _, nested := range section {
+				mark(nested)
+			}
+		}
+	}
+	mark(step)
+}
+
+// failedDependency reports the ID of the failed step behind the first entry of
+// the step's depends_on that failed or was skipped because of a failure.
+func (t *FailureTracker) failedDependency(step config.Step) (failedStepID string, found bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, id := range step.DependsOn {
+		if failedStepID, ok := t.blocked[id]; ok {
+			return failedStepID, true
+		}
+	}
+	return "", false
+}
+
+// missingInput reports the first variable used by the step that a failed step left unset,
+// along with the ID of that failed step.
+func (t *FailureTracker) missingInput(step config.Step) (variable, failedStepID string, found bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.missing) == 0 {
+		return "", "", false
+	}
+
+	for _, name := range plan.StepVariables(step) {
+		if id, ok := t.missing[name]; ok {
+			return name, id, true
+		}
+	}
+	return "", "", false
+}
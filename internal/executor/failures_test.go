@@ -0,0 +1,189 @@
+package executor_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+)
+
+func newFailureTestContext(t *testing.T) (*executor.ExecutionContext, *eventRecorder) {
+	t.Helper()
+	ec, recorder := newBlockTestContext(t)
+	ec.Failures = executor.NewFailureTracker()
+	return ec, recorder
+}
+
+func TestIgnoreErrors_RegistersFailedResultAndContinues(t *testing.T) {
+	ec, recorder := newFailureTestContext(t)
+	out := filepath.Join(ec.CurrentDir, "out.log")
+
+	probe := shellStep("step-0001", "probe", "echo partial; exit 3")
+	probe.IgnoreErrors = true
+	probe.Register = "probe"
+
+	steps := []config.Step{
+		probe,
+		appendStep("step-0002", "after", "after", out),
+	}
+
+	if err := executor.ExecuteSteps(steps, ec); err != nil {
+		t.Fatalf("ExecuteSteps() error = %v, want nil", err)
+	}
+
+	if lines := readLines(t, out); strings.Join(lines, ",") != "after" {
+		t.Errorf("output = %v, want [after]", lines)
+	}
+
+	registered, ok := ec.Variables["probe"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("probe result not registered: %v", ec.Variables["probe"])
+	}
+	if registered["failed"] != true {
+		t.Errorf("probe.failed = %v, want true", registered["failed"])
+	}
+	if registered["rc"] != 3 {
+		t.Errorf("probe.rc = %v, want 3", registered["rc"])
+	}
+	if !strings.Contains(registered["stdout"].(string), "partial") {
+		t.Errorf("probe.stdout = %q, want captured output", registered["stdout"])
+	}
+	if registered["error"] == "" || registered["error"] == nil {
+		t.Error("probe.error should contain the error message")
+	}
+
+	failed := recorder.ofType(events.EventStepFailed)
+	if len(failed) != 1 || !failed[0].Data.(events.StepFailedData).Ignored {
+		t.Errorf("expected one ignored step.failed event, got %v", failed)
+	}
+	if *ec.Stats.Failed != 0 {
+		t.Errorf("Stats.Failed = %d, want 0 for ignored failure", *ec.Stats.Failed)
+	}
+
+	failures := ec.Failures.List()
+	if len(failures) != 1 || !failures[0].Ignored || failures[0].StepID != "step-0001" {
+		t.Errorf("failures = %+v, want one ignored failure for step-0001", failures)
+	}
+}
+
+func TestIgnoreErrors_Block(t *testing.T) {
+	ec, _ := newFailureTestContext(t)
+
+	step := config.Step{
+		ID:           "step-0001",
+		Name:         "group",
+		IgnoreErrors: true,
+		Block: []config.Step{
+			shellStep("step-0002", "fails", "exit 1"),
+		},
+	}
+
+	if err := executor.ExecuteSteps([]config.Step{step}, ec); err != nil {
+		t.Fatalf("ExecuteSteps() error = %v, want nil", err)
+	}
+	if *ec.Stats.Failed != 0 {
+		t.Errorf("Stats.Failed = %d, want 0", *ec.Stats.Failed)
+	}
+	if ec.Failures.Ignored() != 1 {
+		t.Errorf("Ignored() = %d, want 1", ec.Failures.Ignored())
+	}
+}
+
+func TestKeepGoing_SkipsDependentSteps(t *testing.T) {
+	ec, recorder := newFailureTestContext(t)
+	ec.KeepGoing = true
+	out := filepath.Join(ec.CurrentDir, "out.log")
+
+	build := shellStep("step-0001", "build", "exit 1")
+	build.Register = "build"
+
+	gated := appendStep("step-0002", "gated", "gated", out)
+	gated.When = "build.rc == 0"
+	gated.Register = "gated"
+
+	transitive := appendStep("step-0003", "transitive", "transitive", out)
+	transitive.When = "gated.rc == 0"
+
+	steps := []config.Step{
+		build,
+		gated,
+		transitive,
+		appendStep("step-0004", "independent", "independent", out),
+		shellStep("step-0005", "second failure", "exit 2"),
+	}
+
+	err := executor.ExecuteSteps(steps, ec)
+	if err == nil {
+		t.Fatal("ExecuteSteps() error = nil, want failure")
+	}
+
+	var failedErr *executor.FailedStepsError
+	if !errors.As(err, &failedErr) || len(failedErr.Errors) != 2 {
+		t.Fatalf("error = %v, want FailedStepsError with 2 errors", err)
+	}
+	var stepErr *executor.StepError
+	if !errors.As(err, &stepErr) || stepErr.StepID != "step-0001" {
+		t.Errorf("errors.As StepError = %+v, want step-0001", stepErr)
+	}
+
+	if lines := readLines(t, out); strings.Join(lines, ",") != "independent" {
+		t.Errorf("output = %v, want only [independent]", lines)
+	}
+
+	skipped := recorder.ofType(events.EventStepSkipped)
+	if len(skipped) != 2 {
+		t.Fatalf("step.skipped events = %d, want 2", len(skipped))
+	}
+	reason := skipped[0].Data.(events.StepSkippedData).Reason
+	if !strings.Contains(reason, "step-0001") || !strings.Contains(reason, "build") {
+		t.Errorf("skip reason = %q, want reference to failed step and variable", reason)
+	}
+
+	if *ec.Stats.Failed != 2 {
+		t.Errorf("Stats.Failed = %d, want 2", *ec.Stats.Failed)
+	}
+	if len(ec.Failures.List()) != 2 {
+		t.Errorf("failures = %d, want 2", len(ec.Failures.List()))
+	}
+}
+
+func TestKeepGoing_Disabled_StopsAtFirstFailure(t *testing.T) {
+	ec, _ := newFailureTestContext(t)
+	out := filepath.Join(ec.CurrentDir, "out.log")
+
+	steps := []config.Step{
+		shellStep("step-0001", "fails", "exit 1"),
+		appendStep("step-0002", "after", "after", out),
+	}
+
+	err := executor.ExecuteSteps(steps, ec)
+	var stepErr *executor.StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("error = %v, want StepError", err)
+	}
+	if lines := readLines(t, out); len(lines) != 0 {
+		t.Errorf("steps ran after failure: %v", lines)
+	}
+}
+
+func TestBlockRescue_DropsRescuedFailures(t *testing.T) {
+	ec, _ := newFailureTestContext(t)
+
+	step := config.Step{
+		ID:     "step-0001",
+		Name:   "group",
+		Block:  []config.Step{shellStep("step-0002", "fails", "exit 1")},
+		Rescue: []config.Step{shellStep("step-0003", "recover", "true")},
+	}
+
+	if err := executor.ExecuteSteps([]config.Step{step}, ec); err != nil {
+		t.Fatalf("ExecuteSteps() error = %v", err)
+	}
+	if ec.Failures.Len() != 0 {
+		t.Errorf("failures = %+v, want none after rescue", ec.Failures.List())
+	}
+}
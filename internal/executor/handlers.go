@@ -0,0 +1,142 @@
+package executor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// HandlerQueue tracks handlers notified by changed steps.
+// Handlers are queued by name and run at most once per flush, in the order
+// they are declared in the config (not the order they were notified).
+type HandlerQueue struct {
+	mu       sync.Mutex
+	handlers []config.Step
+	pending  map[string]bool
+}
+
+// NewHandlerQueue creates a queue for the given handler steps.
+func NewHandlerQueue(handlers []config.Step) *HandlerQueue {
+	return &HandlerQueue{
+		handlers: handlers,
+		pending:  make(map[string]bool),
+	}
+}
+
+// Has reports whether a handler with the given name exists.
+func (q *HandlerQueue) Has(name string) bool {
+	for _, handler := range q.handlers {
+		if handler.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify queues the named handler. Notifying an already queued handler is a no-op.
+// Returns an error if no handler has that name.
+func (q *HandlerQueue) Notify(name string) error {
+	if !q.Has(name) {
+		return fmt.Errorf("notify: unknown handler %q", name)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending[name] = true
+	return nil
+}
+
+// Pending returns the number of handler names currently queued.
+func (q *HandlerQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// pendingNames returns the names of the queued handlers in declaration order.
+func (q *HandlerQueue) pendingNames() []string {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var names []string
+	for _, handler := range q.handlers {
+		if q.pending[handler.Name] {
+			names = append(names, handler.Name)
+		}
+	}
+	return names
+}
+
+// take removes queued handlers and returns their steps in declaration order.
+// Handlers listed in skip are dropped without being returned.
+func (q *HandlerQueue) take(skip map[string]bool) []config.Step {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var steps []config.Step
+	for _, handler := range q.handlers {
+		if q.pending[handler.Name] && !skip[handler.Name] {
+			steps = append(steps, handler)
+		}
+	}
+	q.pending = make(map[string]bool)
+	return steps
+}
+
+// notifyHandlers queues the handlers listed in the step's notify field.
+func notifyHandlers(step config.Step, stepID string, ec *ExecutionContext) error {
+	if ec.Handlers == nil {
+		return fmt.Errorf("step %q notifies handlers but no handlers are defined", step.Name)
+	}
+
+	for _, name := range step.Notify {
+		if err := ec.Handlers.Notify(name); err != nil {
+			return err
+		}
+		ec.EmitEvent(events.EventHandlerNotified, events.HandlerNotifiedData{
+			StepID:  stepID,
+			Handler: name,
+			DryRun:  ec.DryRun,
+		})
+	}
+	return nil
+}
+
+// FlushHandlers runs all queued handlers and clears the queue.
+//
+// Each handler runs at most once per flush. Handlers may notify other handlers;
+// those run in the same flush unless they already ran. Handler steps emit the
+// regular step events. Runs at the end of ExecutePlan and for flush_handlers steps.
+//
+// INTERNAL: This function is exported for testing purposes only and is not part of
+// the public API. It may change or be removed in future versions without notice.
+func FlushHandlers(ec *ExecutionContext) error {
+	if ec.Handlers == nil {
+		return nil
+	}
+
+	scope := saveExecutionScope(ec)
+	defer scope.restore(ec)
+
+	ran := make(map[string]bool)
+	for {
+		steps := ec.Handlers.take(ran)
+		if len(steps) == 0 {
+			return nil
+		}
+
+		for _, step := range steps {
+			ran[step.Name] = true
+		}
+
+		ec.Logger.Debugf("Running %d notified handler step(s)", len(steps))
+		if _, err := executeBlockSection(steps, ec); err != nil {
+			return err
+		}
+	}
+}
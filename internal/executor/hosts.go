@@ -0,0 +1,263 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/inventory"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+// HostsDir is the directory of the per-host artifacts in the artifacts directory
+// of a run on several hosts.
+const HostsDir = "hosts"
+
+// Host run statuses.
+const (
+	HostStatusSuccess   = "success"
+	HostStatusFailed    = "failed"
+	HostStatusCancelled = "cancelled"
+	HostStatusSkipped   = "skipped" // Not started after another host failed (FailFast)
+)
+
+// HostsConfig contains configuration for applying a config to the hosts of an inventory.
+type HostsConfig struct {
+	// StartConfig holds the settings shared by all hosts. Host, Vars and
+	// ArtifactsDir are set per host: the host's address, its inventory variables
+	// and <ArtifactsDir>/hosts/<name>.
+	StartConfig
+
+	Inventory *inventory.Inventory
+	Hosts     []*inventory.Host
+
+	// Concurrency is the number of hosts run at once (default: 1).
+	Concurrency int
+
+	// FailFast stops the run on all hosts after the first host fails: hosts not
+	// started yet are skipped and the running ones are cancelled. Otherwise every
+	// host runs to completion.
+	FailFast bool
+}
+
+// HostResult is the outcome of the run on one host.
+type HostResult struct {
+	Host         string `json:"host"`
+	Status       string `json:"status"`
+	TotalSteps   int    `json:"total_steps"`
+	ChangedSteps int    `json:"changed_steps"`
+	FailedSteps  int    `json:"failed_steps"`
+	SkippedSteps int    `json:"skipped_steps"`
+	DurationMs   int64  `json:"duration_ms"`
+	Error        string `json:"error,omitempty"`
+
+	// ResumeCommand resumes the run on this host, if it saved a checkpoint.
+	ResumeCommand string `json:"resume_command,omitempty"`
+}
+
+// HostsSummary aggregates the outcome of a run on several hosts.
+type HostsSummary struct {
+	Hosts     []HostResult `json:"hosts"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Cancelled int          `json:"cancelled"`
+	Skipped   int          `json:"skipped"`
+	Changed   int          `json:"changed"` // Hosts with at least one changed step
+}
+
+// HostsError is returned by runs on several hosts that didn't succeed on every host.
+type HostsError struct {
+	Hosts  []string // Names of the hosts that failed or were cancelled
+	Errors []error  // Error of each of these hosts
+}
+
+func (e *HostsError) Error() string {
+	return fmt.Sprintf("run failed on %d host(s): %s", len(e.Hosts), strings.Join(e.Hosts, ", "))
+}
+
+func (e *HostsError) Unwrap() []error {
+	return e.Errors
+}
+
+// runCompletedRecorder keeps the run.completed event of a host run.
+type runCompletedRecorder struct {
+	mu   sync.Mutex
+	data *events.RunCompletedData
+}
+
+func (r *runCompletedRecorder) OnEvent(event events.Event) {
+	if data, ok := event.Data.(events.RunCompletedData); ok {
+		r.mu.Lock()
+		r.data = &data
+		r.mu.Unlock()
+	}
+}
+
+func (r *runCompletedRecorder) Close() {}
+
+// StartHosts applies a config to several hosts, each with its own facts, plan,
+// variables and artifacts (see HostsConfig). Up to Concurrency hosts run at once.
+// Each host run publishes its events to the publisher newPublisher returns for the
+// host; StartHosts closes it when the host is done.
+//
+// The summary lists the hosts in the order of cfg.Hosts. If any host failed, the
+// returned error is a *HostsError.
+func StartHosts(cfg HostsConfig, log logger.Logger, newPublisher func(host *inventory.Host) events.Publisher) (*HostsSummary, error) {
+	if len(cfg.Hosts) == 0 {
+		return nil, &SetupError{Component: "inventory", Issue: "no hosts selected"}
+	}
+	if cfg.ResumeRunID != "" {
+		return nil, &SetupError{Component: "inventory", Issue: "runs on several hosts can't be resumed, resume each host on its own"}
+	}
+
+	// Ask for the sudo password once for all hosts
+	sudoPassword, err := security.ResolvePassword(security.PasswordConfig{
+		CLIPassword:    cfg.SudoPass,
+		AskInteractive: cfg.AskBecomePass,
+		PasswordFile:   cfg.SudoPassFile,
+		InsecureCLI:    cfg.InsecureSudoPass,
+	})
+	if err != nil {
+		return nil, &SetupError{Component: "sudo password", Issue: "failed to resolve password", Cause: err}
+	}
+	cfg.SudoPass, cfg.SudoPassFile, cfg.AskBecomePass = sudoPassword, "", false
+	cfg.InsecureSudoPass = true // Already resolved
+
+	parent := cfg.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(context.Canceled)
+
+	concurrency := cfg.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]HostResult, len(cfg.Hosts))
+	errs := make([]error, len(cfg.Hosts))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, host := range cfg.Hosts {
+		slots <- struct{}{}
+		if ctx.Err() != nil {
+			<-slots
+			results[i] = HostResult{Host: host.Name, Status: HostStatusSkipped}
+			continue
+		}
+		// Each host run sets its own redactor, so it gets its own logger
+		hostLog := log.WithPadLevel(0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i], errs[i] = runHost(ctx, cfg, host, hostLog, newPublisher(host))
+			if errs[i] != nil && cfg.FailFast {
+				cancel(fmt.Errorf("host %s failed (--fail-fast)", host.Name))
+			}
+		}()
+	}
+	wg.Wait()
+
+	summary := &HostsSummary{Hosts: results}
+	hostsErr := &HostsError{}
+	for i, result := range results {
+		switch result.Status {
+		case HostStatusSuccess:
+			summary.Succeeded++
+		case HostStatusFailed:
+			summary.Failed++
+		case HostStatusCancelled:
+			summary.Cancelled++
+		case HostStatusSkipped:
+			summary.Skipped++
+		}
+		if result.ChangedSteps > 0 {
+			summary.Changed++
+		}
+		if errs[i] != nil {
+			hostsErr.Hosts = append(hostsErr.Hosts, result.Host)
+			hostsErr.Errors = append(hostsErr.Errors, errs[i])
+		}
+	}
+
+	if cfg.ArtifactsDir != "" {
+		if err := writeHostsSummary(filepath.Join(cfg.ArtifactsDir, HostsDir), summary); err != nil {
+			log.Infof("Warning: failed to write hosts summary: %v", err)
+		}
+	}
+
+	if len(hostsErr.Errors) > 0 {
+		return summary, hostsErr
+	}
+	return summary, nil
+}
+
+// writeHostsSummary writes the summary of a run on several hosts to summary.json
+// in the hosts directory of the artifacts.
+func writeHostsSummary(dir string, summary *HostsSummary) error {
+	if err := os.MkdirAll(dir, 0755); err != nil { // #nosec G301 -- artifacts are readable like the run directories
+		return err
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "summary.json"), append(data, '\n'), 0644) // #nosec G306 -- artifacts are readable like the run directories
+}
+
+// runHost runs the config on one host of a HostsConfig.
+func runHost(ctx context.Context, cfg HostsConfig, host *inventory.Host, log logger.Logger, publisher events.Publisher) (HostResult, error) {
+	defer publisher.Close()
+	recorder := &runCompletedRecorder{}
+	publisher.Subscribe(recorder)
+
+	startConfig := cfg.StartConfig
+	startConfig.Context = ctx
+	startConfig.Host = host.Address
+	startConfig.Vars = cfg.Inventory.Variables(host)
+	if cfg.ArtifactsDir != "" {
+		startConfig.ArtifactsDir = filepath.Join(cfg.ArtifactsDir, HostsDir, host.Name)
+	}
+
+	started := time.Now()
+	err := Start(startConfig, log, publisher)
+	publisher.Flush()
+
+	result := HostResult{Host: host.Name, Status: HostStatusSuccess, DurationMs: time.Since(started).Milliseconds()}
+	recorder.mu.Lock()
+	if data := recorder.data; data != nil {
+		result.TotalSteps = data.TotalSteps
+		result.ChangedSteps = data.ChangedSteps
+		result.FailedSteps = data.FailedSteps
+		result.SkippedSteps = data.SkippedSteps
+	}
+	recorder.mu.Unlock()
+	if err == nil {
+		return result, nil
+	}
+
+	// The resume command is reported per host, with the host's address
+	var resumableErr *ResumableError
+	if errors.As(err, &resumableErr) {
+		resumableErr.Host = host.Address
+		result.ResumeCommand = resumableErr.ResumeCommand()
+		err = resumableErr.Err
+	}
+	result.Status = HostStatusFailed
+	var cancelErr *CancelledError
+	if errors.As(err, &cancelErr) {
+		result.Status = HostStatusCancelled
+	}
+	result.Error = err.Error()
+	return result, fmt.Errorf("%s: %w", host.Name, err)
+}
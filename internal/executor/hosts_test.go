@@ -0,0 +1,216 @@
+//go:build unix
+
+package executor_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/inventory"
+	"github.com/alehatsman/mooncake/internal/logger"
+)
+
+// startHosts runs a config on the selected hosts of an inventory and returns the
+// summary, the error, and the names of the hosts that published events.
+func startHosts(t *testing.T, cfg executor.HostsConfig, inventoryContent, limit string) (*executor.HostsSummary, error, []string) {
+	t.Helper()
+	inv, err := inventory.Parse([]byte(inventoryContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := inv.Select(limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Inventory, cfg.Hosts = inv, hosts
+
+	var mu sync.Mutex
+	var published []string
+	newPublisher := func(host *inventory.Host) events.Publisher {
+		mu.Lock()
+		published = append(published, host.Name)
+		mu.Unlock()
+		return events.NewSyncPublisher()
+	}
+	summary, err := executor.StartHosts(cfg, logger.NewTestLogger(), newPublisher)
+	return summary, err, published
+}
+
+func TestStartHosts(t *testing.T) {
+	installFakeSSH(t)
+	tmpDir := t.TempDir()
+	outDir := filepath.Join(tmpDir, "out")
+	artifactsDir := filepath.Join(tmpDir, "artifacts")
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(tmpDir, "config.yml")
+	config := `- name: write host file
+  file:
+    path: ` + outDir + `/{{ inventory_hostname }}
+    content: "{{ hostname }} {{ role }} {{ group_names|join:',' }}\n"
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inventoryContent := `
+vars:
+  role: default
+hosts:
+  web1:
+    address: deploy@web1.example.com
+    vars:
+      role: frontend
+  here:
+    connection: local
+  db1: {}
+groups:
+  web:
+    hosts: [web1, web2]
+`
+
+	summary, err, _ := startHosts(t, executor.HostsConfig{
+		StartConfig: executor.StartConfig{ConfigFilePath: configPath, ArtifactsDir: artifactsDir},
+		Concurrency: 2,
+	}, inventoryContent, "all,!db1")
+	if err != nil {
+		t.Fatalf("StartHosts() error = %v (%+v)", err, summary)
+	}
+
+	localHostname, _ := os.Hostname()
+	want := map[string]string{
+		"here": localHostname + " default \n",
+		"web1": "web1.example.com frontend web\n",
+		"web2": "web2 default web\n",
+	}
+	for host, content := range want {
+		got, err := os.ReadFile(filepath.Join(outDir, host))
+		if err != nil {
+			t.Errorf("host %s: %v", host, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("host %s content = %q, want %q", host, got, content)
+		}
+
+		// Each host has its own artifacts, with its facts and plan
+		runDirs, _ := filepath.Glob(filepath.Join(artifactsDir, executor.HostsDir, host, "runs", "*"))
+		if len(runDirs) != 1 {
+			t.Errorf("host %s run directories = %v, want one", host, runDirs)
+			continue
+		}
+		for _, name := range []string{"facts.json", "plan.json", "summary.json"} {
+			if _, err := os.Stat(filepath.Join(runDirs[0], name)); err != nil {
+				t.Errorf("host %s: %v", host, err)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "db1")); !os.IsNotExist(err) {
+		t.Errorf("excluded host db1 was run")
+	}
+
+	var hosts []string
+	for _, result := range summary.Hosts {
+		hosts = append(hosts, result.Host)
+		if result.Status != executor.HostStatusSuccess || result.ChangedSteps != 1 || result.TotalSteps != 1 {
+			t.Errorf("result = %+v, want one changed step", result)
+		}
+	}
+	if !reflect.DeepEqual(hosts, []string{"here", "web1", "web2"}) {
+		t.Errorf("summary hosts = %v", hosts)
+	}
+	if summary.Succeeded != 3 || summary.Changed != 3 || summary.Failed != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if _, err := os.Stat(filepath.Join(artifactsDir, executor.HostsDir, "summary.json")); err != nil {
+		t.Errorf("hosts summary not written: %v", err)
+	}
+}
+
+func TestStartHosts_FailurePolicy(t *testing.T) {
+	installFakeSSH(t)
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	config := `- name: check host
+  shell: test "{{ inventory_hostname }}" != bad
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inventoryContent := "hosts:\n  a: {}\n  bad: {}\n  c: {}\n"
+
+	statuses := func(summary *executor.HostsSummary) []string {
+		var got []string
+		for _, result := range summary.Hosts {
+			got = append(got, result.Host+"="+result.Status)
+		}
+		return got
+	}
+
+	// Continue: every host runs
+	summary, err, published := startHosts(t, executor.HostsConfig{
+		StartConfig: executor.StartConfig{ConfigFilePath: configPath},
+		Concurrency: 1,
+	}, inventoryContent, "")
+	var hostsErr *executor.HostsError
+	if !errors.As(err, &hostsErr) || !reflect.DeepEqual(hostsErr.Hosts, []string{"bad"}) {
+		t.Fatalf("StartHosts() error = %v, want a HostsError for bad", err)
+	}
+	var stepErr *executor.StepError
+	if !errors.As(err, &stepErr) {
+		t.Errorf("HostsError should wrap the StepError of the host, got %v", err)
+	}
+	if got, want := statuses(summary), []string{"a=success", "bad=failed", "c=success"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if len(published) != 3 {
+		t.Errorf("published hosts = %v, want all", published)
+	}
+	if summary.Hosts[1].Error == "" || summary.Hosts[1].FailedSteps != 1 {
+		t.Errorf("failed host result = %+v", summary.Hosts[1])
+	}
+
+	// Fail fast: hosts after the failure are skipped
+	summary, err, published = startHosts(t, executor.HostsConfig{
+		StartConfig: executor.StartConfig{ConfigFilePath: configPath},
+		Concurrency: 1,
+		FailFast:    true,
+	}, inventoryContent, "")
+	if !errors.As(err, &hostsErr) {
+		t.Fatalf("StartHosts() error = %v, want a HostsError", err)
+	}
+	if got, want := statuses(summary), []string{"a=success", "bad=failed", "c=skipped"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if summary.Skipped != 1 || summary.Failed != 1 || summary.Succeeded != 1 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if strings.Join(published, ",") != "a,bad" {
+		t.Errorf("published hosts = %v, want a and bad", published)
+	}
+}
+
+func TestStartHosts_Errors(t *testing.T) {
+	if _, err := executor.StartHosts(executor.HostsConfig{}, logger.NewTestLogger(), nil); err == nil {
+		t.Error("StartHosts() without hosts should fail")
+	}
+
+	inv, err := inventory.Parse([]byte("hosts:\n  a: {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = executor.StartHosts(executor.HostsConfig{
+		StartConfig: executor.StartConfig{ConfigFilePath: "config.yml", ResumeRunID: "run"},
+		Inventory:   inv,
+		Hosts:       inv.Hosts,
+	}, logger.NewTestLogger(), nil)
+	if err == nil || !strings.Contains(err.Error(), "resume") {
+		t.Errorf("StartHosts() with a resumed run error = %v", err)
+	}
+}
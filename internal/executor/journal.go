@@ -0,0 +1,63 @@
+package executor
+
+import (
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/config"
+)
+
+// JournalPath records the state of a path before the current step changes it, so
+// `mooncake undo` can restore it. Handlers call it before writing, linking or
+// changing the mode of a path. Does nothing when the run keeps no journal.
+func (ec *ExecutionContext) JournalPath(path string, become bool) {
+	ec.journal.RecordPath(ec.CurrentStepID, path, become)
+}
+
+// JournalTree records a path and everything below it before the current step removes them.
+func (ec *ExecutionContext) JournalTree(path string, become bool) {
+	ec.journal.RecordTree(ec.CurrentStepID, path, become)
+}
+
+// JournalPackage records that the current step installed or removed a package.
+func (ec *ExecutionContext) JournalPackage(manager, name string, installed bool) {
+	ec.journal.Record(artifacts.JournalEntry{
+		Kind:    artifacts.EntryPackage,
+		StepID:  ec.CurrentStepID,
+		Package: &artifacts.PackageChange{Manager: manager, Name: name, Installed: installed},
+	})
+}
+
+// JournalServiceActive records that the current step started or stopped a service.
+func (ec *ExecutionContext) JournalServiceActive(name string, wasActive, become bool) {
+	ec.journal.Record(artifacts.JournalEntry{
+		Kind:    artifacts.EntryService,
+		StepID:  ec.CurrentStepID,
+		Become:  become,
+		Service: &artifacts.ServiceChange{Name: name, WasActive: &wasActive},
+	})
+}
+
+// JournalServiceEnabled records that the current step enabled or disabled a service.
+func (ec *ExecutionContext) JournalServiceEnabled(name string, wasEnabled, become bool) {
+	ec.journal.Record(artifacts.JournalEntry{
+		Kind:    artifacts.EntryService,
+		StepID:  ec.CurrentStepID,
+		Become:  become,
+		Service: &artifacts.ServiceChange{Name: name, WasEnabled: &wasEnabled},
+	})
+}
+
+// commitJournal writes the changes recorded by a finished action step. A failed
+// write is reported but doesn't fail the step: the change itself succeeded.
+func commitJournal(step config.Step, ec *ExecutionContext, stepID, actionType string, changed bool) {
+	if ec.journal == nil {
+		return
+	}
+	// Presets run their steps through the executor, which journals each of them
+	if actionType == "preset" {
+		changed = false
+	}
+	stepName, _ := GetStepDisplayName(step, ec)
+	if err := ec.journal.Commit(stepID, stepName, actionType, changed); err != nil {
+		ec.Logger.Errorf("  Warning: %v; this step can't be undone", err)
+	}
+}
@@ -0,0 +1,106 @@
+package executor
+
+import (
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+// Replacements for the output and error messages of steps with no_log: true.
+const (
+	noLogOutput = "output hidden by no_log"
+	noLogError  = "error hidden by no_log"
+)
+
+// hideStepOutput hides what a no_log step and its nested steps print, return
+// and fail with, until the returned function restores the context.
+func hideStepOutput(ec *ExecutionContext) func() {
+	publisher, log := ec.EventPublisher, ec.Logger
+	ec.NoLog = true
+	if publisher != nil {
+		ec.EventPublisher = noLogPublisher{publisher}
+	}
+	if log != nil {
+		ec.Logger = noLogLogger{log}
+	}
+	return func() {
+		ec.NoLog = false
+		ec.EventPublisher, ec.Logger = publisher, log
+	}
+}
+
+// registerSecretVariables registers the values of the variables named in the
+// secrets of the config, including results a step just registered under them.
+func registerSecretVariables(ec *ExecutionContext) {
+	for _, name := range ec.secrets {
+		security.RegisterSecrets(ec.Variables[name])
+	}
+}
+
+// hiddenError hides the message of the error of a no_log step. Unwrap keeps
+// the error available to errors.As, e.g. for the failure reason.
+type hiddenError struct {
+	err error
+}
+
+func (e *hiddenError) Error() string {
+	return noLogError
+}
+
+func (e *hiddenError) Unwrap() error {
+	return e.err
+}
+
+// noLogPublisher drops the output and diffs of no_log steps, and hides their
+// results and error messages. Lifecycle and action events pass through.
+type noLogPublisher struct {
+	events.Publisher
+}
+
+// Publish implements events.Publisher.
+func (p noLogPublisher) Publish(event events.Event) {
+	switch data := event.Data.(type) {
+	case events.StepOutputData, events.StepDiffData:
+		return
+	case events.PrintData:
+		data.Message = noLogOutput
+		event.Data = data
+	case events.AssertionData:
+		data.Expected, data.Actual = noLogOutput, noLogOutput
+		event.Data = data
+	case events.StepCompletedData:
+		if data.Result != nil {
+			data.Result = map[string]interface{}{"changed": data.Changed, "censored": noLogOutput}
+		}
+		event.Data = data
+	case events.StepRetryData:
+		data.ErrorMessage = noLogError
+		event.Data = data
+	case events.StepFailedData:
+		data.ErrorMessage = noLogError
+		event.Data = data
+	case events.BlockRescuedData:
+		data.ErrorMessage = noLogError
+		event.Data = data
+	}
+	p.Publisher.Publish(event)
+}
+
+// noLogLogger drops the messages no_log steps log, keeping errors, whose
+// messages are hidden by hiddenError.
+type noLogLogger struct {
+	logger.Logger
+}
+
+func (l noLogLogger) Infof(string, ...interface{}) {}
+
+func (l noLogLogger) Debugf(string, ...interface{}) {}
+
+func (l noLogLogger) Codef(string, ...interface{}) {}
+
+func (l noLogLogger) Textf(string, ...interface{}) {}
+
+// WithPadLevel implements logger.Logger.
+func (l noLogLogger) WithPadLevel(padLevel int) logger.Logger {
+	return noLogLogger{l.Logger.WithPadLevel(padLevel)}
+}
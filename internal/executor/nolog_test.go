@@ -0,0 +1,145 @@
+package executor_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/plan"
+)
+
+// outputLines returns the stdout lines of a step.
+func outputLines(recorder *eventRecorder, stepID string) []string {
+	var lines []string
+	for _, event := range recorder.ofType(events.EventStepStdout) {
+		if data := event.Data.(events.StepOutputData); data.StepID == stepID {
+			lines = append(lines, data.Line)
+		}
+	}
+	return lines
+}
+
+func TestExecutePlan_NoLog(t *testing.T) {
+	tmpDir := t.TempDir()
+	hidden := shellStep("step-0001", "hidden", "echo no-log-output")
+	hidden.NoLog = true
+	failing := shellStep("step-0002", "failing", "echo no-log-failure; exit 3")
+	failing.NoLog = true
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       []config.Step{hidden, failing},
+		InitialVars: map[string]interface{}{},
+	}
+
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	err := executor.ExecutePlanWithOptions(planData, executor.PlanOptions{}, logger.NewTestLogger(), publisher)
+	if err == nil {
+		t.Fatal("ExecutePlanWithOptions() error = nil, want the failure of step-0002")
+	}
+	if strings.Contains(err.Error(), "exit") {
+		t.Errorf("error = %q, want the message hidden", err)
+	}
+
+	for _, stepID := range []string{"step-0001", "step-0002"} {
+		if lines := outputLines(recorder, stepID); len(lines) != 0 {
+			t.Errorf("%s output events = %q, want none", stepID, lines)
+		}
+	}
+
+	completed := recorder.ofType(events.EventStepCompleted)
+	if len(completed) != 1 {
+		t.Fatalf("step.completed events = %d, want 1", len(completed))
+	}
+	result := completed[0].Data.(events.StepCompletedData).Result
+	if _, ok := result["stdout"]; ok || result["changed"] != true {
+		t.Errorf("step.completed result = %v, want only changed and censored", result)
+	}
+
+	failed := recorder.ofType(events.EventStepFailed)
+	if len(failed) != 1 {
+		t.Fatalf("step.failed events = %d, want 1", len(failed))
+	}
+	if msg := failed[0].Data.(events.StepFailedData).ErrorMessage; msg != "error hidden by no_log" {
+		t.Errorf("step.failed error message = %q", msg)
+	}
+}
+
+func TestExecutePlan_NoLogKeepsRegisteredResult(t *testing.T) {
+	tmpDir := t.TempDir()
+	hidden := shellStep("step-0001", "hidden", "echo registered-value")
+	hidden.NoLog = true
+	hidden.Register = "hidden_result"
+	planData := &plan.Plan{
+		RootFile: filepath.Join(tmpDir, "test.yml"),
+		Steps: []config.Step{
+			hidden,
+			shellStep("step-0002", "shown", "echo got {{ hidden_result.stdout }}"),
+		},
+		InitialVars: map[string]interface{}{},
+	}
+
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	if err := executor.ExecutePlanWithOptions(planData, executor.PlanOptions{}, logger.NewTestLogger(), publisher); err != nil {
+		t.Fatalf("ExecutePlanWithOptions() error = %v", err)
+	}
+
+	// no_log hides the output of the step, not the result later steps use
+	if lines := outputLines(recorder, "step-0002"); len(lines) != 1 || lines[0] != "got registered-value" {
+		t.Errorf("step-0002 output = %q, want the registered stdout", lines)
+	}
+}
+
+func TestExecutePlan_RedactsSecretVariables(t *testing.T) {
+	tmpDir := t.TempDir()
+	generate := shellStep("step-0002", "generate", "echo generated-secret-value")
+	generate.NoLog = true
+	generate.Register = "generated"
+	planData := &plan.Plan{
+		RootFile: filepath.Join(tmpDir, "test.yml"),
+		Steps: []config.Step{
+			shellStep("step-0001", "use token", "echo token={{ api_token }}"),
+			generate,
+			shellStep("step-0003", "use generated", "echo generated={{ generated.stdout }}"),
+		},
+		InitialVars: map[string]interface{}{"api_token": "secret-variable-token"},
+		Secrets:     []string{"api_token", "generated"},
+	}
+
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	if err := executor.ExecutePlanWithOptions(planData, executor.PlanOptions{}, logger.NewTestLogger(), publisher); err != nil {
+		t.Fatalf("ExecutePlanWithOptions() error = %v", err)
+	}
+
+	for stepID, want := range map[string]string{
+		"step-0001": "token=[REDACTED]",
+		"step-0003": "generated=[REDACTED]",
+	} {
+		if lines := outputLines(recorder, stepID); len(lines) != 1 || lines[0] != want {
+			t.Errorf("%s output = %q, want %q", stepID, lines, want)
+		}
+	}
+}
+
+func TestExecutePlan_RefusesRedactedPlan(t *testing.T) {
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(t.TempDir(), "test.yml"),
+		Steps:       []config.Step{shellStep("step-0001", "echo", "echo hi")},
+		InitialVars: map[string]interface{}{"token": "[REDACTED]"},
+		Redacted:    true,
+	}
+
+	err := executor.ExecutePlanWithOptions(planData, executor.PlanOptions{}, logger.NewTestLogger(), events.NewSyncPublisher())
+	if err == nil || !strings.Contains(err.Error(), "redacted secrets") {
+		t.Errorf("ExecutePlanWithOptions() error = %v, want a redacted plan error", err)
+	}
+}
@@ -0,0 +1,159 @@
+package executor_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+)
+
+// appendStep returns a shell step that appends a line to the given file.
+func appendStep(id, name, line, path string) config.Step {
+	return shellStep(id, name, "echo "+line+" >> "+path)
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return strings.Fields(string(data))
+}
+
+func TestHandlerQueue_NotifyUnknown(t *testing.T) {
+	queue := executor.NewHandlerQueue([]config.Step{{Name: "restart"}})
+
+	if err := queue.Notify("missing"); err == nil {
+		t.Error("Expected error notifying unknown handler")
+	}
+	if err := queue.Notify("restart"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if err := queue.Notify("restart"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if queue.Pending() != 1 {
+		t.Errorf("Pending() = %d, want 1", queue.Pending())
+	}
+}
+
+func TestHandlers_RunOnceInDeclarationOrder(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	out := filepath.Join(ec.CurrentDir, "handlers.log")
+
+	ec.Handlers = executor.NewHandlerQueue([]config.Step{
+		appendStep("step-0010", "first", "first", out),
+		appendStep("step-0011", "second", "second", out),
+		appendStep("step-0012", "unused", "unused", out),
+	})
+
+	steps := []config.Step{
+		shellStep("step-0001", "a", "true"),
+		shellStep("step-0002", "b", "true"),
+	}
+	steps[0].Notify = []string{"second"}
+	steps[1].Notify = []string{"first", "second"}
+
+	if err := executor.ExecuteSteps(steps, ec); err != nil {
+		t.Fatalf("ExecuteSteps() error = %v", err)
+	}
+	if lines := readLines(t, out); len(lines) != 0 {
+		t.Fatalf("handlers ran before flush: %v", lines)
+	}
+
+	if err := executor.FlushHandlers(ec); err != nil {
+		t.Fatalf("FlushHandlers() error = %v", err)
+	}
+
+	lines := readLines(t, out)
+	if strings.Join(lines, ",") != "first,second" {
+		t.Errorf("handlers ran as %v, want [first second]", lines)
+	}
+	if got := len(recorder.ofType(events.EventHandlerNotified)); got != 3 {
+		t.Errorf("handler.notified events = %d, want 3", got)
+	}
+	if ec.Handlers.Pending() != 0 {
+		t.Errorf("Pending() = %d after flush, want 0", ec.Handlers.Pending())
+	}
+
+	// A second flush has nothing left to run
+	if err := executor.FlushHandlers(ec); err != nil {
+		t.Fatalf("FlushHandlers() error = %v", err)
+	}
+	if lines := readLines(t, out); len(lines) != 2 {
+		t.Errorf("handlers ran again on empty flush: %v", lines)
+	}
+}
+
+func TestHandlers_NotNotifiedWithoutChange(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	out := filepath.Join(ec.CurrentDir, "handlers.log")
+
+	ec.Handlers = executor.NewHandlerQueue([]config.Step{
+		appendStep("step-0010", "restart", "restart", out),
+	})
+
+	step := shellStep("step-0001", "unchanged", "true")
+	step.ChangedWhen = "false"
+	step.Notify = []string{"restart"}
+
+	if err := executor.ExecuteSteps([]config.Step{step}, ec); err != nil {
+		t.Fatalf("ExecuteSteps() error = %v", err)
+	}
+	if err := executor.FlushHandlers(ec); err != nil {
+		t.Fatalf("FlushHandlers() error = %v", err)
+	}
+
+	if lines := readLines(t, out); len(lines) != 0 {
+		t.Errorf("handler ran for unchanged step: %v", lines)
+	}
+	if got := len(recorder.ofType(events.EventHandlerNotified)); got != 0 {
+		t.Errorf("handler.notified events = %d, want 0", got)
+	}
+}
+
+func TestHandlers_FlushHandlersStep(t *testing.T) {
+	ec, _ := newBlockTestContext(t)
+	out := filepath.Join(ec.CurrentDir, "handlers.log")
+
+	ec.Handlers = executor.NewHandlerQueue([]config.Step{
+		appendStep("step-0010", "restart", "restart", out),
+	})
+
+	notifier := shellStep("step-0001", "change", "true")
+	notifier.Notify = []string{"restart"}
+
+	steps := []config.Step{
+		notifier,
+		{ID: "step-0002", Name: "flush", FlushHandlers: true},
+		appendStep("step-0003", "after", "after", out),
+	}
+
+	if err := executor.ExecuteSteps(steps, ec); err != nil {
+		t.Fatalf("ExecuteSteps() error = %v", err)
+	}
+
+	lines := readLines(t, out)
+	if strings.Join(lines, ",") != "restart,after" {
+		t.Errorf("output = %v, want [restart after]", lines)
+	}
+}
+
+func TestHandlers_NotifyWithoutHandlers(t *testing.T) {
+	ec, _ := newBlockTestContext(t)
+
+	step := shellStep("step-0001", "change", "true")
+	step.Notify = []string{"restart"}
+
+	if err := executor.ExecuteSteps([]config.Step{step}, ec); err == nil {
+		t.Error("Expected error notifying handler with no handlers defined")
+	}
+}
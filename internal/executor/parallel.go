@@ -0,0 +1,171 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/alehatsman/mooncake/internal/config"
+)
+
+// DefaultParallelWorkers is the number of steps run at once for plans with the
+// parallel strategy when no worker count is given. Steps mostly wait on downloads
+// and package managers, so this doesn't depend on the number of CPUs.
+const DefaultParallelWorkers = 4
+
+// stepOutcome is the result of a step run by a parallel worker.
+type stepOutcome struct {
+	index     int
+	err       error
+	variables map[string]interface{}
+	stepID    string
+}
+
+// ExecuteStepsParallel executes plan steps concurrently on up to workers goroutines.
+//
+// A step starts once every step in its DependsOn has finished; ready steps start in
+// plan order. Each step runs on its own copy of the execution context with a snapshot
+// of the variables. When it finishes, the variables it registered are written back
+// by the scheduler, one step at a time, so they are visible to the steps started
+// afterwards (including its dependents).
+//
+// Without keep-going, no new steps start after a failure and the steps already
+// running are allowed to finish. With keep-going, steps depending on a failed step
+// are skipped. Cancellation stops scheduling in both modes.
+func ExecuteStepsParallel(steps []config.Step, ec *ExecutionContext, workers int) error {
+	ec.Logger.Debugf("Executing in parallel (%d workers): %v", workers, ec.CurrentFile)
+
+	if workers < 1 {
+		workers = 1
+	}
+	ec.TotalSteps = len(steps)
+
+	waiting, dependents, err := buildStepGraph(steps)
+	if err != nil {
+		return err
+	}
+
+	outcomes := make(chan stepOutcome)
+	started := make([]bool, len(steps))
+	running := 0
+	stopped := false
+
+	launch := func(i int) {
+		started[i] = true
+		running++
+
+		stepEC := ec.Clone()
+		stepEC.CurrentIndex = i
+		stepEC.failureScope = steps[i].ID
+
+		go func(step config.Step) {
+			prepareStepScope(step, &stepEC)
+			err := ExecuteStep(step, &stepEC)
+			outcomes <- stepOutcome{index: i, err: err, variables: stepEC.Variables, stepID: stepEC.CurrentStepID}
+		}(steps[i])
+	}
+
+	var failed []error
+	var cancelErr error
+	for {
+		for i := 0; i < len(steps) && !stopped && running < workers; i++ {
+			if !started[i] && waiting[i] == 0 {
+				launch(i)
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		outcome := <-outcomes
+		running--
+		step := steps[outcome.index]
+
+		// Publish registered values to the shared variables
+		for _, name := range registeredNames(step) {
+			if value, ok := outcome.variables[name]; ok {
+				ec.Variables[name] = value
+			}
+		}
+		for _, dependent := range dependents[outcome.index] {
+			waiting[dependent]--
+		}
+
+		if outcome.err == nil {
+			ec.checkpoint.stepDone(step, ec.Variables)
+			continue
+		}
+		ec.checkpoint.stepFailed(step, outcome.err)
+
+		var cancelled *CancelledError
+		if errors.As(outcome.err, &cancelled) {
+			if cancelErr == nil {
+				cancelErr = outcome.err
+			}
+			stopped = true
+			continue
+		}
+
+		failed = append(failed, outcome.err)
+		if !ec.KeepGoing {
+			stopped = true
+			continue
+		}
+
+		// Keep going, but steps depending on this step will be skipped
+		ec.CurrentStepID = outcome.stepID
+		markFailed(step, outcome.err, ec)
+	}
+
+	switch {
+	case cancelErr != nil:
+		return cancelErr
+	case len(failed) == 1 && !ec.KeepGoing:
+		return failed[0]
+	case len(failed) > 0:
+		return &FailedStepsError{Errors: failed}
+	}
+	return nil
+}
+
+// buildStepGraph returns, for each step, the number of dependencies it waits for
+// and the indexes of the steps depending on it.
+// Dependencies must refer to earlier steps, which keeps the graph acyclic.
+func buildStepGraph(steps []config.Step) (waiting []int, dependents [][]int, err error) {
+	index := make(map[string]int, len(steps))
+	for i, step := range steps {
+		if step.ID != "" {
+			index[step.ID] = i
+		}
+	}
+
+	waiting = make([]int, len(steps))
+	dependents = make([][]int, len(steps))
+	for i, step := range steps {
+		for _, id := range step.DependsOn {
+			j, ok := index[id]
+			if !ok {
+				return nil, nil, fmt.Errorf("step %q (%s) depends on unknown step %s", step.Name, step.ID, id)
+			}
+			if j >= i {
+				return nil, nil, fmt.Errorf("step %q (%s) depends on %s, which does not come before it in the plan", step.Name, step.ID, id)
+			}
+			waiting[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+	return waiting, dependents, nil
+}
+
+// registeredNames returns the variable names a step and its nested steps register.
+func registeredNames(step config.Step) []string {
+	var names []string
+	if step.Register != "" {
+		names = append(names, step.Register)
+	}
+	for _, section := range [][]config.Step{step.Block, step.Rescue, step.Always} {
+		for _, nested := range section {
+			names = append(names, registeredNames(nested)...)
+		}
+	}
+	return names
+}
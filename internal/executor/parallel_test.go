@@ -0,0 +1,170 @@
+package executor_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+)
+
+// rendezvousStep creates its marker and waits until all markers exist, so it
+// only succeeds if the steps owning the other markers run at the same time.
+func rendezvousStep(id, dir, marker string, markers []string) config.Step {
+	var checks []string
+	for _, m := range markers {
+		checks = append(checks, fmt.Sprintf("[ -e %s ]", filepath.Join(dir, m)))
+	}
+	cmd := fmt.Sprintf(`touch %s; i=0; while [ $i -lt 50 ]; do %s && exit 0; i=$((i+1)); sleep 0.1; done; exit 1`,
+		filepath.Join(dir, marker), strings.Join(checks, " && "))
+	return shellStep(id, "wait for "+marker, cmd)
+}
+
+func TestExecuteStepsParallel_RunsIndependentStepsConcurrently(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	markers := []string{"a", "b", "c"}
+
+	steps := []config.Step{
+		rendezvousStep("step-0001", ec.CurrentDir, "a", markers),
+		rendezvousStep("step-0002", ec.CurrentDir, "b", markers),
+		rendezvousStep("step-0003", ec.CurrentDir, "c", markers),
+	}
+
+	if err := executor.ExecuteStepsParallel(steps, ec, 3); err != nil {
+		t.Fatalf("ExecuteStepsParallel() error = %v, want nil", err)
+	}
+
+	if got := len(recorder.ofType(events.EventStepCompleted)); got != 3 {
+		t.Errorf("completed events = %d, want 3", got)
+	}
+	if *ec.Stats.Global != 3 || *ec.Stats.Executed != 3 {
+		t.Errorf("Global/Executed = %d/%d, want 3/3", *ec.Stats.Global, *ec.Stats.Executed)
+	}
+}
+
+func TestExecuteStepsParallel_DependenciesAndRegister(t *testing.T) {
+	ec, _ := newBlockTestContext(t)
+	out := filepath.Join(ec.CurrentDir, "out.log")
+
+	first := shellStep("step-0001", "first", "sleep 0.2; echo hello")
+	first.Register = "greeting"
+
+	second := appendStep("step-0002", "second", "second", out)
+	second.DependsOn = []string{"step-0001"}
+	second.When = "trim(greeting.stdout) == 'hello'"
+
+	third := appendStep("step-0003", "third", "third", out)
+	third.DependsOn = []string{"step-0002"}
+
+	independent := appendStep("step-0004", "independent", "independent", out)
+
+	steps := []config.Step{first, second, third, independent}
+	if err := executor.ExecuteStepsParallel(steps, ec, 4); err != nil {
+		t.Fatalf("ExecuteStepsParallel() error = %v, want nil", err)
+	}
+
+	// The independent step doesn't wait for the slow first step
+	if lines := readLines(t, out); strings.Join(lines, ",") != "independent,second,third" {
+		t.Errorf("output = %v, want [independent second third]", lines)
+	}
+	if _, ok := ec.Variables["greeting"]; !ok {
+		t.Error("registered variable should be published to the shared variables")
+	}
+}
+
+func TestExecuteStepsParallel_StopsAfterFailure(t *testing.T) {
+	ec, _ := newBlockTestContext(t)
+	out := filepath.Join(ec.CurrentDir, "out.log")
+
+	steps := []config.Step{
+		shellStep("step-0001", "broken", "exit 1"),
+		appendStep("step-0002", "later", "later", out),
+	}
+
+	err := executor.ExecuteStepsParallel(steps, ec, 1)
+	var stepErr *executor.StepError
+	if !errors.As(err, &stepErr) || stepErr.StepID != "step-0001" {
+		t.Fatalf("ExecuteStepsParallel() error = %v, want StepError for step-0001", err)
+	}
+	if lines := readLines(t, out); len(lines) != 0 {
+		t.Errorf("output = %v, want no steps started after the failure", lines)
+	}
+}
+
+func TestExecuteStepsParallel_KeepGoingSkipsDependents(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	ec.KeepGoing = true
+	out := filepath.Join(ec.CurrentDir, "out.log")
+
+	dependent := appendStep("step-0002", "dependent", "dependent", out)
+	dependent.DependsOn = []string{"step-0001"}
+
+	transitive := appendStep("step-0003", "transitive", "transitive", out)
+	transitive.DependsOn = []string{"step-0002"}
+
+	steps := []config.Step{
+		shellStep("step-0001", "broken", "exit 1"),
+		dependent,
+		transitive,
+		appendStep("step-0004", "independent", "independent", out),
+	}
+
+	err := executor.ExecuteStepsParallel(steps, ec, 2)
+	var failedErr *executor.FailedStepsError
+	if !errors.As(err, &failedErr) || len(failedErr.Errors) != 1 {
+		t.Fatalf("ExecuteStepsParallel() error = %v, want FailedStepsError with 1 error", err)
+	}
+
+	if lines := readLines(t, out); strings.Join(lines, ",") != "independent" {
+		t.Errorf("output = %v, want [independent]", lines)
+	}
+
+	skipped := recorder.ofType(events.EventStepSkipped)
+	if len(skipped) != 2 {
+		t.Fatalf("skipped events = %d, want 2", len(skipped))
+	}
+	for _, event := range skipped {
+		data := event.Data.(events.StepSkippedData)
+		if data.Reason != "depends on failed step step-0001" {
+			t.Errorf("skip reason for %s = %q, want dependency on step-0001", data.StepID, data.Reason)
+		}
+	}
+	if *ec.Stats.Failed != 1 {
+		t.Errorf("Failed = %d, want 1", *ec.Stats.Failed)
+	}
+}
+
+func TestExecuteStepsParallel_InvalidDependency(t *testing.T) {
+	ec, _ := newBlockTestContext(t)
+
+	first := shellStep("step-0001", "first", "true")
+	first.DependsOn = []string{"step-0002"}
+
+	steps := []config.Step{first, shellStep("step-0002", "second", "true")}
+	err := executor.ExecuteStepsParallel(steps, ec, 2)
+	if err == nil || !strings.Contains(err.Error(), "does not come before it") {
+		t.Errorf("ExecuteStepsParallel() error = %v, want forward dependency error", err)
+	}
+}
+
+func TestExecuteSteps_KeepGoingSkipsDependents(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	ec.KeepGoing = true
+
+	dependent := shellStep("step-0002", "dependent", "true")
+	dependent.DependsOn = []string{"step-0001"}
+
+	steps := []config.Step{shellStep("step-0001", "broken", "exit 1"), dependent}
+	if err := executor.ExecuteSteps(steps, ec); err == nil {
+		t.Fatal("ExecuteSteps() error = nil, want failure")
+	}
+
+	skipped := recorder.ofType(events.EventStepSkipped)
+	if len(skipped) != 1 || skipped[0].Data.(events.StepSkippedData).StepID != "step-0002" {
+		t.Errorf("skipped events = %v, want step-0002 skipped", skipped)
+	}
+}
@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/policy"
+)
+
+// checkPlanPolicy checks a plan against the policy of the run before any step runs.
+func checkPlanPolicy(p *plan.Plan, runPolicy *policy.Policy) error {
+	diagnostics, err := runPolicy.CheckPlan(p)
+	if err != nil {
+		return &SetupError{Component: "policy", Issue: "failed to check the plan", Cause: err}
+	}
+	if config.HasErrors(diagnostics) {
+		return &SetupError{Component: "policy", Issue: "the plan violates the policy", Cause: &config.ValidationError{Diagnostics: diagnostics}}
+	}
+	return nil
+}
+
+// checkStepPolicy checks a step against the policy of the run, with the values
+// its fields have now. Fields that can't be rendered fail the step: the policy
+// can't tell what they would do.
+func checkStepPolicy(step config.Step, ec *ExecutionContext) error {
+	if ec.policy == nil {
+		return nil
+	}
+	subject, err := policy.Describe(&step, policy.Resolver{
+		Render: func(text string) (string, error) {
+			return ec.Template.Render(text, ec.Variables)
+		},
+		ExpandPath: func(path string) (string, error) {
+			return ec.PathUtil.ExpandPath(path, ec.CurrentDir, ec.Variables)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check the step against the policy: %w", err)
+	}
+	return checkSubjectPolicy(subject, ec)
+}
+
+// checkSubjectPolicy checks what a step does against the policy of the run.
+func checkSubjectPolicy(subject policy.Subject, ec *ExecutionContext) error {
+	if ec.policy == nil {
+		return nil
+	}
+	if violations := ec.policy.Check(subject); len(violations) > 0 {
+		return &policy.ViolationError{Violations: violations}
+	}
+	return nil
+}
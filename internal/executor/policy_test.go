@@ -0,0 +1,145 @@
+package executor_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/policy"
+)
+
+func TestExecutePlan_PolicyRejectsPlan(t *testing.T) {
+	tmpDir := t.TempDir()
+	step := shellStep("step-0001", "fetch", "curl -o out https://example.com")
+	step.Origin = &config.Origin{FilePath: filepath.Join(tmpDir, "test.yml"), Line: 3, Column: 3}
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       []config.Step{step},
+		InitialVars: map[string]interface{}{},
+	}
+	runPolicy, err := policy.Parse([]byte("commands: {allow: [git]}"), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	err = executor.ExecutePlanWithOptions(planData, executor.PlanOptions{Policy: runPolicy}, logger.NewTestLogger(), publisher)
+
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Diagnostics) != 1 {
+		t.Fatalf("ExecutePlanWithOptions() error = %v, want the diagnostics of the plan", err)
+	}
+	if diagnostic := validationErr.Diagnostics[0]; diagnostic.Line != 3 || !strings.Contains(diagnostic.Message, "command curl is not allowed") {
+		t.Errorf("diagnostic = %+v", diagnostic)
+	}
+	if started := recorder.ofType(events.EventRunStarted); len(started) != 0 {
+		t.Error("the run started, want it rejected before")
+	}
+}
+
+func TestExecutePlan_PolicyEnforcedAtRuntime(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+	locate := shellStep("step-0001", "locate", "echo "+outside)
+	locate.Register = "target"
+	write := config.Step{
+		ID:   "step-0002",
+		Name: "write",
+		File: &config.File{Path: "{{ target.stdout }}/escaped.txt", State: "file", Content: "x"},
+	}
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       []config.Step{locate, write},
+		InitialVars: map[string]interface{}{},
+	}
+	runPolicy, err := policy.Parse([]byte("paths: {allow: ['**']}"), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	err = executor.ExecutePlanWithOptions(planData, executor.PlanOptions{Policy: runPolicy}, logger.NewTestLogger(), publisher)
+
+	var violationErr *policy.ViolationError
+	if !errors.As(err, &violationErr) {
+		t.Fatalf("ExecutePlanWithOptions() error = %v, want a policy violation", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(outside, "escaped.txt")); !os.IsNotExist(statErr) {
+		t.Error("the file outside the allowed paths was written")
+	}
+	failed := recorder.ofType(events.EventStepFailed)
+	if len(failed) != 1 || failed[0].Data.(events.StepFailedData).Reason != executor.FailureReasonPolicy {
+		t.Errorf("step.failed events = %v, want one with reason policy", failed)
+	}
+}
+
+func TestExecutePlan_PolicyResolvesSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+	// The shell step links a directory the policy allows to one it doesn't
+	link := shellStep("step-0001", "link", "ln -s "+outside+" "+filepath.Join(tmpDir, "out"))
+	write := config.Step{
+		ID:   "step-0002",
+		Name: "write",
+		File: &config.File{Path: filepath.Join(tmpDir, "out", "escaped.txt"), State: "file", Content: "x"},
+	}
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       []config.Step{link, write},
+		InitialVars: map[string]interface{}{},
+	}
+	runPolicy, err := policy.Parse([]byte("paths: {allow: ['**']}"), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = executor.ExecutePlanWithOptions(planData, executor.PlanOptions{Policy: runPolicy}, logger.NewTestLogger(), events.NewSyncPublisher())
+
+	var violationErr *policy.ViolationError
+	if !errors.As(err, &violationErr) {
+		t.Fatalf("ExecutePlanWithOptions() error = %v, want a policy violation", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(outside, "escaped.txt")); !os.IsNotExist(statErr) {
+		t.Error("the file was written through the symlink")
+	}
+}
+
+func TestExecutePlan_PolicyChecksLinkSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+	step := config.Step{
+		ID:   "step-0001",
+		Name: "link",
+		File: &config.File{Path: filepath.Join(tmpDir, "out"), State: "link", Src: outside},
+	}
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       []config.Step{step},
+		InitialVars: map[string]interface{}{},
+	}
+	runPolicy, err := policy.Parse([]byte("paths: {allow: ['**']}"), tmpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = executor.ExecutePlanWithOptions(planData, executor.PlanOptions{Policy: runPolicy}, logger.NewTestLogger(), events.NewSyncPublisher())
+
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) || !strings.Contains(err.Error(), outside) {
+		t.Fatalf("ExecutePlanWithOptions() error = %v, want the link source rejected", err)
+	}
+	if _, statErr := os.Lstat(filepath.Join(tmpDir, "out")); !os.IsNotExist(statErr) {
+		t.Error("the link was created")
+	}
+}
@@ -0,0 +1,38 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/alehatsman/mooncake/internal/facts"
+	"github.com/alehatsman/mooncake/internal/transport"
+)
+
+// ConnectHost opens an SSH connection to a [user@]host[:port] target and collects
+// the facts of the host, for building a plan for it and running the plan over the
+// connection. The caller closes the returned transport.
+func ConnectHost(ctx context.Context, host string) (*transport.SSH, *facts.Facts, error) {
+	target, err := transport.ParseSSHTarget(host)
+	if err != nil {
+		return nil, nil, &SetupError{Component: "ssh", Issue: "invalid target", Cause: err}
+	}
+	if err := target.Connect(ctx); err != nil {
+		_ = target.Close()
+		return nil, nil, &SetupError{Component: "ssh", Issue: "failed to connect", Cause: err}
+	}
+	hostFacts, err := facts.CollectRemote(ctx, target)
+	if err != nil {
+		_ = target.Close()
+		return nil, nil, &SetupError{Component: "ssh", Issue: "failed to collect facts", Cause: err}
+	}
+	return target, hostFacts, nil
+}
+
+// OpenRoot opens an alternate root directory and collects its facts, for building a
+// plan for it and running the plan with the directory as the root of the file system.
+func OpenRoot(root string) (*transport.Chroot, *facts.Facts, error) {
+	target, err := transport.NewChroot(root)
+	if err != nil {
+		return nil, nil, &SetupError{Component: "root", Issue: "invalid root directory", Cause: err}
+	}
+	return target, facts.CollectRoot(target), nil
+}
@@ -0,0 +1,168 @@
+//go:build unix
+
+package executor_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+)
+
+// fakeSSH is an ssh client that logs its destination and runs the remote command
+// on this host, where the hostname command reports the destination.
+const fakeSSH = `#!/bin/sh
+control=
+while [ "$1" != "--" ]; do
+  [ "$1" = "-O" ] && control=1
+  shift
+done
+if [ -n "$FAKE_SSH_REFUSE" ]; then
+  echo "ssh: connect to host $2 port 22: Connection refused" >&2
+  exit 255
+fi
+echo "$2" >> "$FAKE_SSH_LOG"
+[ -n "$control" ] && exit 0
+export FAKE_SSH_DESTINATION="$2"
+PATH="$FAKE_SSH_REMOTE_BIN:$PATH" exec sh -c "$3"
+`
+
+// installFakeSSH puts fakeSSH first in PATH and returns its log file.
+func installFakeSSH(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	remoteBin := filepath.Join(dir, "remote-bin")
+	for _, d := range []string{bin, remoteBin} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// #nosec G306 -- test helpers must be executable
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte(fakeSSH), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// #nosec G306 -- test helpers must be executable
+	if err := os.WriteFile(filepath.Join(remoteBin, "hostname"), []byte("#!/bin/sh\necho \"$FAKE_SSH_DESTINATION\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "ssh.log")
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_SSH_REMOTE_BIN", remoteBin)
+	t.Setenv("FAKE_SSH_LOG", logPath)
+	return logPath
+}
+
+func TestStart_Host(t *testing.T) {
+	logPath := installFakeSSH(t)
+	tmpDir := t.TempDir()
+	artifactsDir := filepath.Join(tmpDir, "artifacts")
+	target := filepath.Join(tmpDir, "remote", "motd")
+	configPath := filepath.Join(tmpDir, "config.yml")
+	config := `- name: motd
+  file:
+    path: ` + target + `
+    content: "welcome to {{ hostname }}\n"
+- name: check
+  shell: grep -q box ` + target + `
+`
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := executor.Start(executor.StartConfig{
+		ConfigFilePath: configPath,
+		ArtifactsDir:   artifactsDir,
+		Host:           "deploy@box",
+	}, logger.NewTestLogger(), events.NewSyncPublisher())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// The plan was built with the facts of the host
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(content) != "welcome to box\n" {
+		t.Errorf("content = %q, want the remote hostname", content)
+	}
+
+	log, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ssh was not run: %v", err)
+	}
+	hosts := strings.Fields(string(log))
+	if len(hosts) == 0 {
+		t.Error("ssh was not run")
+	}
+	for _, host := range hosts {
+		if host != "box" {
+			t.Errorf("ssh destination = %q, want box", host)
+		}
+	}
+
+	// The journal only covers changes to this host
+	runDirs, _ := filepath.Glob(filepath.Join(artifactsDir, "runs", "*"))
+	for _, runDir := range runDirs {
+		if _, err := os.Stat(filepath.Join(runDir, artifacts.JournalFile)); err == nil {
+			t.Errorf("remote run wrote a journal in %s", runDir)
+		}
+		err := executor.Undo(executor.UndoConfig{ArtifactsDir: artifactsDir, RunID: filepath.Base(runDir)}, logger.NewTestLogger())
+		if err == nil || !strings.Contains(err.Error(), "has no journal: changes on") {
+			t.Errorf("Undo() = %v, want an error saying the run has no journal", err)
+		}
+	}
+}
+
+func TestStart_HostConnectionError(t *testing.T) {
+	installFakeSSH(t)
+	t.Setenv("FAKE_SSH_REFUSE", "1")
+
+	configPath := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(configPath, []byte("- shell: echo hi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := executor.Start(executor.StartConfig{ConfigFilePath: configPath, Host: "box"},
+		logger.NewTestLogger(), events.NewSyncPublisher())
+	var setupErr *executor.SetupError
+	if !errors.As(err, &setupErr) || setupErr.Component != "ssh" || !strings.Contains(err.Error(), "Connection refused") {
+		t.Errorf("Start() error = %v, want an ssh SetupError", err)
+	}
+
+	err = executor.Start(executor.StartConfig{ConfigFilePath: configPath, Host: "box:notaport"},
+		logger.NewTestLogger(), events.NewSyncPublisher())
+	if !errors.As(err, &setupErr) || !strings.Contains(err.Error(), "invalid host") {
+		t.Errorf("Start() with a bad host error = %v, want an invalid host error", err)
+	}
+}
+
+func TestStart_HostUnsupportedAction(t *testing.T) {
+	installFakeSSH(t)
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yml")
+	config := `- name: fetch
+  download:
+    url: https://example.com/file
+    dest: ` + filepath.Join(tmpDir, "file") + `
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := executor.Start(executor.StartConfig{ConfigFilePath: configPath, Host: "box"},
+		logger.NewTestLogger(), events.NewSyncPublisher())
+	if err == nil || !strings.Contains(err.Error(), "download action is not supported on remote hosts") {
+		t.Errorf("Start() error = %v, want an unsupported action error", err)
+	}
+}
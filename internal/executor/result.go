@@ -58,6 +58,9 @@ type Result struct {
 	// Currently not set by any step type.
 	Skipped bool `json:"skipped"`
 
+	// predicted is set when Changed was predicted by the action's Check in a dry run.
+	predicted bool
+
 	// Data holds custom result data set by actions via SetData.
 	// This allows actions to provide additional structured information
 	// that can be accessed in templates and registered results.
@@ -0,0 +1,226 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/actions"
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/policy"
+	"github.com/alehatsman/mooncake/internal/sandbox"
+)
+
+// DefaultUntilRetries is the number of retries used when a step sets until without retries.
+const DefaultUntilRetries = 3
+
+// retryPolicy holds the parsed retries, retry_delay, until and timeout settings of a step.
+type retryPolicy struct {
+	attempts int
+	delay    time.Duration
+	timeout  time.Duration
+	until    string
+}
+
+// newRetryPolicy parses the execution control fields of a step.
+func newRetryPolicy(step config.Step) (retryPolicy, error) {
+	policy := retryPolicy{
+		attempts: step.Retries + 1,
+		until:    strings.TrimSpace(step.Until),
+	}
+	if policy.attempts < 1 {
+		policy.attempts = 1
+	}
+	if policy.until != "" && step.Retries == 0 {
+		policy.attempts = DefaultUntilRetries + 1
+	}
+
+	if step.RetryDelay != "" {
+		delay, err := time.ParseDuration(step.RetryDelay)
+		if err != nil {
+			return policy, fmt.Errorf("invalid retry_delay duration %q: %w", step.RetryDelay, err)
+		}
+		policy.delay = delay
+	}
+
+	if step.Timeout != "" {
+		timeout, err := time.ParseDuration(step.Timeout)
+		if err != nil {
+			return policy, fmt.Errorf("invalid timeout duration %q: %w", step.Timeout, err)
+		}
+		policy.timeout = timeout
+	}
+
+	return policy, nil
+}
+
+// executeWithRetry runs a handler with the step's retries, retry_delay, until and timeout.
+//
+// Each attempt runs with its own deadline when timeout is set. An attempt fails if the
+// handler returns an error, the deadline expires, or the until expression is false.
+// Failed attempts are retried after retry_delay, emitting a step.retry event each time.
+// The result and error of the last attempt are returned.
+func executeWithRetry(handler actions.Handler, step config.Step, ec *ExecutionContext) (actions.Result, error) {
+	policy, err := newRetryPolicy(step)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		result, err := executeAttempt(handler, step, ec, policy.timeout)
+
+		if err == nil && policy.until != "" {
+			met, evalErr := evaluateUntil(step, result, ec)
+			if evalErr != nil {
+				return result, evalErr
+			}
+			if !met {
+				err = fmt.Errorf("until condition not met: %s", policy.until)
+				if r, ok := result.(*Result); ok && r != nil {
+					r.Failed = true
+				}
+			}
+		}
+
+		if err == nil {
+			return result, nil
+		}
+
+		// A cancelled run is not retried
+		if cancelErr := ec.cancellation(err); cancelErr != nil {
+			return result, cancelErr
+		}
+
+		if attempt >= policy.attempts {
+			if policy.attempts > 1 {
+				err = fmt.Errorf("failed after %d attempts: %w", attempt, err)
+			}
+			return result, err
+		}
+
+		ec.Logger.Debugf("  Attempt %d/%d failed: %v", attempt, policy.attempts, err)
+		ec.EmitEvent(events.EventStepRetry, events.StepRetryData{
+			StepID:       ec.CurrentStepID,
+			Name:         step.Name,
+			Attempt:      attempt + 1,
+			MaxAttempts:  policy.attempts,
+			DelayMs:      policy.delay.Milliseconds(),
+			ErrorMessage: err.Error(),
+			DryRun:       ec.DryRun,
+		})
+
+		if policy.delay > 0 {
+			timer := time.NewTimer(policy.delay)
+			select {
+			case <-timer.C:
+			case <-ec.GetContext().Done():
+				timer.Stop()
+				return result, ec.cancellation(err)
+			}
+		}
+	}
+}
+
+// Failure reasons reported in step.failed events for failures that don't come from the action itself.
+const (
+	FailureReasonTimeout   = "timeout"
+	FailureReasonCancelled = "cancelled"
+	FailureReasonPolicy    = "policy"
+	FailureReasonSandbox   = "sandbox"
+)
+
+// failureReason classifies a step error as a timeout, cancellation or policy
+// violation; empty otherwise.
+func failureReason(err error) string {
+	var cancelErr *CancelledError
+	if errors.As(err, &cancelErr) {
+		return FailureReasonCancelled
+	}
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return FailureReasonTimeout
+	}
+	var violationErr *policy.ViolationError
+	if errors.As(err, &violationErr) {
+		return FailureReasonPolicy
+	}
+	var sandboxErr *sandbox.ViolationError
+	if errors.As(err, &sandboxErr) {
+		return FailureReasonSandbox
+	}
+	return ""
+}
+
+// executeAttempt runs the handler once, with a deadline when timeout is positive.
+func executeAttempt(handler actions.Handler, step config.Step, ec *ExecutionContext, timeout time.Duration) (actions.Result, error) {
+	if timeout <= 0 {
+		result, err := handler.Execute(ec, &step)
+		if err != nil {
+			if cancelErr := ec.cancellation(err); cancelErr != nil {
+				return result, cancelErr
+			}
+		}
+		return result, err
+	}
+
+	parent := ec.Context
+	attemptCtx, cancel := context.WithTimeout(ec.GetContext(), timeout)
+	defer cancel()
+
+	ec.Context = attemptCtx
+	result, err := handler.Execute(ec, &step)
+	ec.Context = parent
+
+	if err == nil {
+		return result, nil
+	}
+
+	// The run deadline or an interrupt takes precedence over the step timeout
+	if cancelErr := ec.cancellation(err); cancelErr != nil {
+		return result, cancelErr
+	}
+	if errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return result, &TimeoutError{Duration: step.Timeout, Cause: err}
+	}
+	return result, err
+}
+
+// evaluateUntil evaluates the step's until expression against the attempt result.
+// The result is available as "result" and under the step's register name.
+func evaluateUntil(step config.Step, result actions.Result, ec *ExecutionContext) (bool, error) {
+	resultMap := map[string]interface{}{}
+	if r, ok := result.(*Result); ok && r != nil {
+		resultMap = r.ToMap()
+	}
+
+	evalContext := make(map[string]interface{}, len(ec.Variables)+2)
+	for k, v := range ec.Variables {
+		evalContext[k] = v
+	}
+	evalContext["result"] = resultMap
+	if step.Register != "" {
+		evalContext[step.Register] = resultMap
+	}
+
+	expression, err := ec.Template.Render(strings.TrimSpace(step.Until), evalContext)
+	if err != nil {
+		return false, &RenderError{Field: "until", Cause: err}
+	}
+
+	value, err := ec.Evaluator.Evaluate(expression, evalContext)
+	if err != nil {
+		return false, &EvaluationError{Expression: expression, Cause: err}
+	}
+
+	met, ok := value.(bool)
+	if !ok {
+		return false, &EvaluationError{
+			Expression: expression,
+			Cause:      fmt.Errorf("expression evaluated to %T, expected bool", value),
+		}
+	}
+	return met, nil
+}
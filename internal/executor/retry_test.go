@@ -0,0 +1,192 @@
+package executor_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+)
+
+func TestRetry_SucceedsOnLaterAttempt(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	counter := filepath.Join(ec.CurrentDir, "attempts")
+
+	// Fails until the third attempt
+	step := shellStep("step-0001", "flaky", "echo x >> "+counter+"; [ $(wc -l < "+counter+") -ge 3 ]")
+	step.Retries = 5
+	step.RetryDelay = "10ms"
+
+	if err := executor.ExecuteStep(step, ec); err != nil {
+		t.Fatalf("ExecuteStep() error = %v", err)
+	}
+
+	if lines := readLines(t, counter); len(lines) != 3 {
+		t.Errorf("attempts = %d, want 3", len(lines))
+	}
+
+	retries := recorder.ofType(events.EventStepRetry)
+	if len(retries) != 2 {
+		t.Fatalf("step.retry events = %d, want 2", len(retries))
+	}
+	for i, event := range retries {
+		data := event.Data.(events.StepRetryData)
+		if data.Attempt != i+2 {
+			t.Errorf("retry %d attempt = %d, want %d", i, data.Attempt, i+2)
+		}
+		if data.MaxAttempts != 6 {
+			t.Errorf("retry %d max attempts = %d, want 6", i, data.MaxAttempts)
+		}
+		if data.DelayMs != 10 {
+			t.Errorf("retry %d delay = %dms, want 10ms", i, data.DelayMs)
+		}
+		if data.StepID != "step-0001" {
+			t.Errorf("retry %d step ID = %q, want step-0001", i, data.StepID)
+		}
+	}
+}
+
+func TestRetry_ExhaustsAttempts(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+
+	step := shellStep("step-0001", "always fails", "exit 1")
+	step.Retries = 2
+
+	err := executor.ExecuteStep(step, ec)
+	if err == nil {
+		t.Fatal("ExecuteStep() error = nil, want failure")
+	}
+	if !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("error = %v, want attempts count", err)
+	}
+	if got := len(recorder.ofType(events.EventStepRetry)); got != 2 {
+		t.Errorf("step.retry events = %d, want 2", got)
+	}
+}
+
+func TestRetry_Until(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+	counter := filepath.Join(ec.CurrentDir, "attempts")
+
+	step := shellStep("step-0001", "poll", "echo x >> "+counter+"; wc -l < "+counter)
+	step.Register = "poll"
+	step.Until = "trim(poll.stdout) == '2'"
+	step.Retries = 4
+
+	if err := executor.ExecuteStep(step, ec); err != nil {
+		t.Fatalf("ExecuteStep() error = %v", err)
+	}
+	if lines := readLines(t, counter); len(lines) != 2 {
+		t.Errorf("attempts = %d, want 2", len(lines))
+	}
+	if got := len(recorder.ofType(events.EventStepRetry)); got != 1 {
+		t.Errorf("step.retry events = %d, want 1", got)
+	}
+
+	registered := ec.Variables["poll"].(map[string]interface{})
+	if strings.TrimSpace(registered["stdout"].(string)) != "2" {
+		t.Errorf("registered stdout = %v, want result of the last attempt", registered["stdout"])
+	}
+}
+
+func TestRetry_UntilNeverMet(t *testing.T) {
+	ec, recorder := newBlockTestContext(t)
+
+	step := shellStep("step-0001", "poll", "echo no")
+	step.Until = "result.stdout == 'yes'"
+
+	err := executor.ExecuteStep(step, ec)
+	if err == nil {
+		t.Fatal("ExecuteStep() error = nil, want until failure")
+	}
+	if !strings.Contains(err.Error(), "until condition not met") {
+		t.Errorf("error = %v, want until failure", err)
+	}
+
+	// until without retries uses the default retry count
+	if got := len(recorder.ofType(events.EventStepRetry)); got != executor.DefaultUntilRetries {
+		t.Errorf("step.retry events = %d, want %d", got, executor.DefaultUntilRetries)
+	}
+}
+
+func TestRetry_InvalidDurations(t *testing.T) {
+	tests := []struct {
+		name string
+		step func(step *config.Step)
+		want string
+	}{
+		{"retry_delay", func(step *config.Step) { step.RetryDelay = "soon" }, "retry_delay"},
+		{"timeout", func(step *config.Step) { step.Timeout = "forever" }, "timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ec, _ := newBlockTestContext(t)
+			step := shellStep("step-0001", "step", "true")
+			tt.step(&step)
+
+			err := executor.ExecuteStep(step, ec)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want mention of %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeout_Shell(t *testing.T) {
+	ec, _ := newBlockTestContext(t)
+
+	step := shellStep("step-0001", "slow", "sleep 5")
+	step.Timeout = "200ms"
+
+	start := time.Now()
+	err := executor.ExecuteStep(step, ec)
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("step took %v, want it cancelled after the timeout", time.Since(start))
+	}
+
+	var timeoutErr *executor.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("error = %v, want TimeoutError", err)
+	}
+	if timeoutErr.Duration != "200ms" {
+		t.Errorf("Duration = %q, want 200ms", timeoutErr.Duration)
+	}
+}
+
+func TestTimeout_AssertHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	ec, _ := newBlockTestContext(t)
+	step := config.Step{
+		ID:   "step-0001",
+		Name: "slow endpoint",
+		Assert: &config.Assert{
+			HTTP: &config.AssertHTTP{URL: server.URL, Status: 200},
+		},
+		Timeout: "200ms",
+	}
+
+	start := time.Now()
+	err := executor.ExecuteStep(step, ec)
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("step took %v, want it cancelled after the timeout", time.Since(start))
+	}
+
+	var timeoutErr *executor.TimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("error = %v, want TimeoutError", err)
+	}
+}
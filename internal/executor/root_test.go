@@ -0,0 +1,182 @@
+//go:build unix
+
+package executor_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+)
+
+// writeTarGz writes a tar.gz archive of files to path.
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStart_Root(t *testing.T) {
+	tmpDir := t.TempDir()
+	root := filepath.Join(tmpDir, "image")
+	artifactsDir := filepath.Join(tmpDir, "artifacts")
+	for name, content := range map[string]string{
+		"etc/os-release": "ID=alpine\nVERSION_ID=3.20.1\n",
+		"etc/hostname":   "builder\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An absolute link of the image, pointing out of the root on this host
+	if err := os.Symlink("/", filepath.Join(root, "host")); err != nil {
+		t.Fatal(err)
+	}
+	writeTarGz(t, filepath.Join(root, "tmp", "app.tar.gz"), map[string]string{"app/VERSION": "1.0\n"})
+
+	configPath := filepath.Join(tmpDir, "config.yml")
+	config := `- name: motd
+  file:
+    path: /etc/motd
+    content: "{{ distribution }} {{ distribution_major }} on {{ hostname }}\n"
+- name: escape
+  file:
+    path: /../../escaped
+    content: "stays in the root\n"
+- name: through link
+  file:
+    path: /host/linked
+    content: "stays in the root\n"
+- name: timezone
+  file:
+    path: /etc/localtime
+    src: /usr/share/zoneinfo/UTC
+    state: link
+- name: app
+  unarchive:
+    src: /tmp/app.tar.gz
+    dest: /opt
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := executor.Start(executor.StartConfig{
+		ConfigFilePath: configPath,
+		ArtifactsDir:   artifactsDir,
+		Root:           root,
+	}, logger.NewTestLogger(), events.NewSyncPublisher())
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// The plan was built with the facts of the root
+	content, err := os.ReadFile(filepath.Join(root, "etc", "motd"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(content) != "alpine 3 on builder\n" {
+		t.Errorf("content = %q, want the facts of the root", content)
+	}
+
+	// Paths don't escape the root
+	for _, name := range []string{"escaped", "linked"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Errorf("%s not written in the root: %v", name, err)
+		}
+	}
+	if _, err := os.Stat("/linked"); err == nil {
+		t.Error("file written through a link out of the root")
+	}
+	if target, err := os.Readlink(filepath.Join(root, "etc", "localtime")); err != nil || target != "/usr/share/zoneinfo/UTC" {
+		t.Errorf("link target = %q, %v, want the path in the root", target, err)
+	}
+	if content, err := os.ReadFile(filepath.Join(root, "opt", "app", "VERSION")); err != nil || string(content) != "1.0\n" {
+		t.Errorf("extracted file = %q, %v", content, err)
+	}
+
+	// The journal only covers changes to "/" of this host
+	runDirs, _ := filepath.Glob(filepath.Join(artifactsDir, "runs", "*"))
+	if len(runDirs) == 0 {
+		t.Fatal("no run artifacts")
+	}
+	for _, runDir := range runDirs {
+		if _, err := os.Stat(filepath.Join(runDir, artifacts.JournalFile)); err == nil {
+			t.Errorf("run in an alternate root wrote a journal in %s", runDir)
+		}
+		err := executor.Undo(executor.UndoConfig{ArtifactsDir: artifactsDir, RunID: filepath.Base(runDir)}, logger.NewTestLogger())
+		if err == nil || !strings.Contains(err.Error(), "has no journal: changes on") {
+			t.Errorf("Undo() = %v, want an error saying the run has no journal", err)
+		}
+	}
+}
+
+func TestStart_RootErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yml")
+	config := `- name: edit
+  file_replace:
+    path: /etc/hosts
+    pattern: localhost
+    replace: builder
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  executor.StartConfig
+		want string
+	}{
+		{"missing root", executor.StartConfig{Root: filepath.Join(tmpDir, "missing")}, "invalid root directory"},
+		{"root and host", executor.StartConfig{Root: tmpDir, Host: "box"}, "can't be used on remote hosts"},
+		{"unsupported action", executor.StartConfig{Root: tmpDir}, "file_replace action is not supported in alternate roots"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.ConfigFilePath = configPath
+			err := executor.Start(tt.cfg, logger.NewTestLogger(), events.NewSyncPublisher())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Start() error = %v, want %q", err, tt.want)
+			}
+			var setupErr *executor.SetupError
+			if tt.name != "unsupported action" && !errors.As(err, &setupErr) {
+				t.Errorf("Start() error = %T, want a SetupError", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/pathutil"
+	"github.com/alehatsman/mooncake/internal/sandbox"
+	"github.com/alehatsman/mooncake/internal/transport"
+)
+
+// checkSandboxSupport checks that a step with a sandbox runs a command.
+func checkSandboxSupport(actionType string, step config.Step) error {
+	if step.Sandbox != nil && actionType != "shell" && actionType != "command" {
+		return fmt.Errorf("sandbox is only supported by shell and command steps, not by %s", actionType)
+	}
+	return nil
+}
+
+// SandboxCommand makes a command of a step run in the sandbox of the step and
+// returns the reports of the sandbox, or nil when the step has none. Pass
+// them to SandboxError when the command fails, and close them once it has
+// exited.
+func (ec *ExecutionContext) SandboxCommand(step *config.Step, cmd *exec.Cmd) (*sandbox.Reports, error) {
+	box, err := ec.stepSandbox(step)
+	if err != nil || box == nil {
+		return nil, err
+	}
+	return sandbox.Wrap(cmd, *box)
+}
+
+// SandboxError returns the error of a failed command, wrapping the violation
+// of its sandbox when the sandbox made it fail. reports is nil for commands
+// that don't run in a sandbox.
+func SandboxError(reports *sandbox.Reports, stderr string, err error) error {
+	if sandboxErr := reports.Check(stderr); sandboxErr != nil {
+		return fmt.Errorf("%w: %w", err, sandboxErr)
+	}
+	return err
+}
+
+// stepSandbox returns the sandbox of the commands of a step: the sandbox of
+// the run (see PlanOptions.Sandbox) narrowed by the sandbox field of the
+// step, or nil when there is neither. A step can't loosen the sandbox of the
+// run: it only gets network access both allow, the lower of the limits and
+// writable paths inside those of the run.
+func (ec *ExecutionContext) stepSandbox(step *config.Step) (*sandbox.Config, error) {
+	if step.Sandbox == nil && ec.sandbox == nil {
+		return nil, nil
+	}
+	if !transport.IsLocal(ec.GetTransport()) {
+		return nil, fmt.Errorf("the sandbox is only supported on this host, not on %s", ec.GetTransport())
+	}
+	if step.Become {
+		return nil, errors.New("become can't be used in a sandbox")
+	}
+	if err := sandbox.Supported(); err != nil {
+		return nil, err
+	}
+
+	var box sandbox.Config
+	if ec.sandbox != nil {
+		box = *ec.sandbox
+	}
+	if s := step.Sandbox; s != nil {
+		if s.Network != nil {
+			box.Network = *s.Network && (ec.sandbox == nil || ec.sandbox.Network)
+		}
+		for _, limit := range []struct {
+			field string
+			value string
+			dest  *time.Duration
+		}{
+			{"sandbox.cpu", s.CPU, &box.CPU},
+			{"sandbox.timeout", s.Timeout, &box.Timeout},
+		} {
+			if limit.value == "" {
+				continue
+			}
+			duration, err := time.ParseDuration(limit.value)
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("invalid %s %q: must be a positive duration", limit.field, limit.value)
+			}
+			*limit.dest = lowerLimit(*limit.dest, duration)
+		}
+		if s.Memory != "" {
+			memory, err := sandbox.ParseSize(s.Memory)
+			if err != nil || memory <= 0 {
+				return nil, fmt.Errorf("invalid sandbox.memory %q: must be a positive size", s.Memory)
+			}
+			box.Memory = lowerLimit(box.Memory, memory)
+		}
+
+		if len(s.Writable) > 0 {
+			box.Writable = nil
+			for _, path := range s.Writable {
+				expanded, err := ec.sandboxPath(path)
+				if err != nil {
+					return nil, &RenderError{Field: "sandbox.writable", Cause: err}
+				}
+				if ec.sandbox != nil && !withinAny(expanded, ec.sandbox.Writable) {
+					return nil, fmt.Errorf("sandbox.writable: %s is outside the writable paths of the run", expanded)
+				}
+				box.Writable = append(box.Writable, expanded)
+			}
+		}
+	}
+
+	// Default: the working directory of the command
+	if len(box.Writable) == 0 {
+		dir := "."
+		if step.Cwd != "" {
+			rendered, err := ec.Template.Render(step.Cwd, ec.Variables)
+			if err != nil {
+				return nil, &RenderError{Field: "cwd", Cause: err}
+			}
+			dir = rendered
+		}
+		resolved, err := resolvePath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the working directory of the sandbox: %w", err)
+		}
+		box.Writable = []string{resolved}
+	}
+	return &box, nil
+}
+
+// sandboxPath renders a path and resolves it (see resolvePath).
+func (ec *ExecutionContext) sandboxPath(path string) (string, error) {
+	expanded, err := ec.PathUtil.ExpandPath(path, ec.CurrentDir, ec.Variables)
+	if err != nil {
+		return "", err
+	}
+	return resolvePath(expanded)
+}
+
+// resolvePath makes a path absolute with its symlinks resolved, as the
+// sandbox mounts the directory they point to.
+func resolvePath(path string) (string, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(absolute)
+}
+
+// withinAny reports whether a path is one of the directories or inside one.
+func withinAny(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		if pathutil.ValidatePathWithinBase(path, dir) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerLimit returns the lower of two limits, where 0 is no limit.
+func lowerLimit[T time.Duration | int64](current, limit T) T {
+	if current == 0 || limit < current {
+		return limit
+	}
+	return current
+}
@@ -0,0 +1,185 @@
+package executor_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/sandbox"
+)
+
+// runSandboxPlan runs steps in tmpDir and returns the events and error of the
+// run. The test is skipped when this host can't set up the sandbox.
+func runSandboxPlan(t *testing.T, tmpDir string, opts executor.PlanOptions, steps ...config.Step) (*eventRecorder, error) {
+	t.Helper()
+	if err := sandbox.Supported(); err != nil {
+		t.Skip(err)
+	}
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       steps,
+		InitialVars: map[string]interface{}{},
+	}
+	recorder := &eventRecorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	err := executor.ExecutePlanWithOptions(planData, opts, logger.NewTestLogger(), publisher)
+	if err != nil && strings.Contains(err.Error(), "failed to set up the sandbox") {
+		t.Skipf("sandbox not available: %v", err)
+	}
+	return recorder, err
+}
+
+func TestExecutePlan_SandboxAllowsWritablePaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := config.Step{
+		ID:      "step-0001",
+		Name:    "write",
+		Command: &config.CommandAction{Argv: []string{"sh", "-c", "echo ok > out.txt"}},
+		Cwd:     tmpDir,
+		Sandbox: &config.Sandbox{},
+	}
+
+	if _, err := runSandboxPlan(t, tmpDir, executor.PlanOptions{}, write); err != nil {
+		t.Fatalf("ExecutePlanWithOptions() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(tmpDir, "out.txt")); err != nil || string(data) != "ok\n" {
+		t.Errorf("out.txt = %q, %v, want the output of the sandboxed command", data, err)
+	}
+}
+
+func TestExecutePlan_SandboxViolation(t *testing.T) {
+	tmpDir := t.TempDir()
+	// The package directory is outside /tmp, which is private in the sandbox
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(wd, "sandbox-escape.txt")
+	t.Cleanup(func() { _ = os.Remove(outside) })
+
+	step := shellStep("step-0001", "escape", "echo x > "+outside)
+	step.Sandbox = &config.Sandbox{Writable: []string{tmpDir}}
+	recorder, err := runSandboxPlan(t, tmpDir, executor.PlanOptions{}, step)
+
+	var violation *sandbox.ViolationError
+	if !errors.As(err, &violation) || violation.Kind != sandbox.KindWrite {
+		t.Fatalf("ExecutePlanWithOptions() error = %v, want a write violation", err)
+	}
+	if _, statErr := os.Stat(outside); !os.IsNotExist(statErr) {
+		t.Error("the file outside the sandbox was written")
+	}
+	failed := recorder.ofType(events.EventStepFailed)
+	if len(failed) != 1 || failed[0].Data.(events.StepFailedData).Reason != executor.FailureReasonSandbox {
+		t.Errorf("step.failed events = %v, want one with reason sandbox", failed)
+	}
+}
+
+func TestExecutePlan_RunSandboxAssertCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(wd, "sandbox-assert-escape.txt")
+	t.Cleanup(func() { _ = os.Remove(outside) })
+
+	step := config.Step{
+		ID:     "step-0001",
+		Name:   "escape",
+		Assert: &config.Assert{Command: &config.AssertCommand{Cmd: "echo x > " + outside}},
+	}
+	_, err = runSandboxPlan(t, tmpDir, executor.PlanOptions{Sandbox: &sandbox.Config{Writable: []string{tmpDir}}}, step)
+
+	var violation *sandbox.ViolationError
+	if !errors.As(err, &violation) || violation.Kind != sandbox.KindWrite {
+		t.Fatalf("ExecutePlanWithOptions() error = %v, want a write violation", err)
+	}
+	if _, statErr := os.Stat(outside); !os.IsNotExist(statErr) {
+		t.Error("the assert command wrote outside the sandbox")
+	}
+}
+
+func TestExecutePlan_RunSandbox(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+	network := true
+	tests := []struct {
+		name    string
+		step    config.Step
+		wantErr string
+	}{
+		{
+			name:    "time limit of the run",
+			step:    shellStep("step-0001", "slow", "sleep 10"),
+			wantErr: "sandbox violation: the command ran longer than the time limit of 200ms",
+		},
+		{
+			name: "writable path outside those of the run",
+			step: config.Step{
+				ID: "step-0001", Name: "outside",
+				Shell:   &config.ShellAction{Cmd: "true"},
+				Sandbox: &config.Sandbox{Writable: []string{outside}},
+			},
+			wantErr: "is outside the writable paths of the run",
+		},
+		{
+			name: "network the run doesn't allow",
+			step: config.Step{
+				ID: "step-0001", Name: "network",
+				Shell:   &config.ShellAction{Cmd: "grep -v lo: /proc/net/dev | grep : && exit 1 || true"},
+				Sandbox: &config.Sandbox{Network: &network},
+			},
+		},
+		{
+			name: "become",
+			step: config.Step{
+				ID: "step-0001", Name: "become",
+				Shell:  &config.ShellAction{Cmd: "true"},
+				Become: true,
+			},
+			wantErr: "become can't be used in a sandbox",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := executor.PlanOptions{
+				SudoPass: "unused",
+				Sandbox:  &sandbox.Config{Writable: []string{tmpDir}, Timeout: 200 * time.Millisecond},
+			}
+			_, err := runSandboxPlan(t, tmpDir, opts, tt.step)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ExecutePlanWithOptions() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ExecutePlanWithOptions() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecutePlan_SandboxOnlyForCommands(t *testing.T) {
+	tmpDir := t.TempDir()
+	step := config.Step{
+		ID:      "step-0001",
+		Name:    "write",
+		File:    &config.File{Path: filepath.Join(tmpDir, "out.txt"), State: "file", Content: "x"},
+		Sandbox: &config.Sandbox{},
+	}
+
+	_, err := runSandboxPlan(t, tmpDir, executor.PlanOptions{}, step)
+	if err == nil || !strings.Contains(err.Error(), "sandbox is only supported by shell and command steps") {
+		t.Errorf("ExecutePlanWithOptions() error = %v, want the sandbox rejected", err)
+	}
+}
@@ -0,0 +1,399 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/expression"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/pathutil"
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/template"
+	"github.com/alehatsman/mooncake/internal/transport"
+)
+
+// UndoConfig configures the undo of a run.
+type UndoConfig struct {
+	RunID        string
+	ArtifactsDir string // Default: artifacts.DefaultBaseDir
+	DryRun       bool   // Only show what would be undone
+	Force        bool   // Undo even if paths were modified since the run
+
+	SudoPass         string
+	SudoPassFile     string
+	AskBecomePass    bool
+	InsecureSudoPass bool
+
+	// Context cancels the undo when done. Nil means context.Background().
+	Context context.Context
+}
+
+// undoOp is one change of a run to revert. File entries of the same path are
+// merged: the state before the first change is restored, and the state after the
+// last change is what the path must still be in.
+type undoOp struct {
+	artifacts.JournalEntry
+}
+
+// describe returns what undoing the change does, e.g. "remove /etc/app.conf".
+func (op *undoOp) describe() string {
+	switch op.Kind {
+	case artifacts.EntryFile:
+		switch {
+		case op.Before.Type == artifacts.FileAbsent:
+			return "remove " + op.Path
+		case op.After.Type == artifacts.FileAbsent:
+			return "recreate " + op.Path
+		}
+		return "restore " + op.Path
+	case artifacts.EntryPackage:
+		if op.Package.Installed {
+			return "remove package " + op.Package.Name
+		}
+		return "install package " + op.Package.Name
+	case artifacts.EntryService:
+		service := op.Service
+		switch {
+		case service.WasActive != nil && *service.WasActive:
+			return "start service " + service.Name
+		case service.WasActive != nil:
+			return "stop service " + service.Name
+		case *service.WasEnabled:
+			return "enable service " + service.Name
+		}
+		return "disable service " + service.Name
+	}
+	return ""
+}
+
+// undoOperations returns the changes of a journal in the order they are undone:
+// the reverse of the order they were made in.
+func undoOperations(entries []artifacts.JournalEntry) []*undoOp {
+	var ops []*undoOp
+	byPath := make(map[string]*undoOp)
+	for _, entry := range entries {
+		if entry.Kind == artifacts.EntryFile {
+			if op, ok := byPath[entry.Path]; ok {
+				op.After = entry.After
+				op.Become = op.Become || entry.Become
+				continue
+			}
+		}
+		op := &undoOp{entry}
+		if entry.Kind == artifacts.EntryFile {
+			byPath[entry.Path] = op
+		}
+		ops = append(ops, op)
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// Undo reverts the changes recorded in the journal of a run, newest first.
+//
+// Files are restored to their content and mode from before the run; paths the run
+// created are removed, directories only if empty. Packages the run installed are
+// removed (and the other way round), and services are started, stopped, enabled or
+// disabled back. Changes the journal couldn't record (commands, archives) are listed
+// and left alone.
+//
+// Undo refuses to run if a path was modified since the run, unless Force is set.
+// Paths already in their previous state are skipped, so an undo that failed halfway
+// can be run again.
+func Undo(cfg UndoConfig, log logger.Logger) error {
+	if cfg.ArtifactsDir == "" {
+		cfg.ArtifactsDir = artifacts.DefaultBaseDir
+	}
+	if cfg.Context == nil {
+		cfg.Context = context.Background()
+	}
+
+	runDir := artifacts.RunDir(cfg.ArtifactsDir, cfg.RunID)
+	if _, err := os.Stat(runDir); err != nil {
+		return &SetupError{Component: "undo", Issue: fmt.Sprintf("run %s not found in %s", cfg.RunID, cfg.ArtifactsDir), Cause: err}
+	}
+	entries, err := artifacts.LoadJournal(runDir)
+	if err != nil {
+		return &SetupError{Component: "undo", Issue: "failed to load journal", Cause: err}
+	}
+
+	// Sort out what's left to undo
+	var pending, irreversible []*undoOp
+	var conflicts []string
+	for _, op := range undoOperations(entries) {
+		switch op.Kind {
+		case artifacts.EntryUnrecorded:
+			irreversible = append(irreversible, op)
+			continue
+		case artifacts.EntryFile:
+			current := artifacts.Snapshot(op.Path, false)
+			if current.Matches(op.Before) {
+				continue
+			}
+			if !op.Before.Restorable() {
+				irreversible = append(irreversible, op)
+				continue
+			}
+			if !current.Matches(op.After) && !cfg.Force {
+				conflicts = append(conflicts, op.Path)
+				continue
+			}
+		}
+		pending = append(pending, op)
+	}
+
+	if len(conflicts) > 0 {
+		return &UndoConflictError{RunID: cfg.RunID, Paths: conflicts}
+	}
+
+	for _, op := range irreversible {
+		if op.Kind == artifacts.EntryFile {
+			log.Infof("Can't restore %s: its previous content wasn't recorded (unreadable or larger than %d MiB)",
+				op.Path, artifacts.MaxJournalContent>>20)
+		} else {
+			log.Infof("Can't undo step '%s' (%s): its changes weren't recorded", op.StepName, op.Action)
+		}
+	}
+
+	if len(pending) == 0 {
+		log.Infof("Nothing to undo for run %s", cfg.RunID)
+		return nil
+	}
+
+	verb := "Undoing"
+	if cfg.DryRun {
+		verb = "Would undo"
+	}
+	log.Infof("%s %d changes of run %s:", verb, len(pending), cfg.RunID)
+	for _, op := range pending {
+		log.Infof("  %s (step '%s')", op.describe(), op.StepName)
+	}
+	if cfg.DryRun {
+		return nil
+	}
+
+	u, err := newUndoer(cfg, pending, log)
+	if err != nil {
+		return err
+	}
+	for _, op := range pending {
+		if err := u.ec.cancellation(nil); err != nil {
+			return err
+		}
+		if err := u.undo(op); err != nil {
+			return fmt.Errorf("failed to %s: %w", op.describe(), err)
+		}
+	}
+
+	log.Infof("Undid run %s", cfg.RunID)
+	return nil
+}
+
+// undoer reverts changes, with sudo for the changes made with become.
+type undoer struct {
+	ctx      context.Context
+	sudoPass string
+	log      logger.Logger
+
+	// ec runs the package and service steps reverting those changes
+	ec *ExecutionContext
+}
+
+// newUndoer resolves the sudo password if a change needs it and prepares the
+// context for the action steps.
+func newUndoer(cfg UndoConfig, ops []*undoOp, log logger.Logger) (*undoer, error) {
+	u := &undoer{ctx: cfg.Context, log: log}
+
+	needsSudo := false
+	for _, op := range ops {
+		needsSudo = needsSudo || op.Become
+	}
+	if needsSudo {
+		sudoPass, err := security.ResolvePassword(security.PasswordConfig{
+			CLIPassword:    cfg.SudoPass,
+			AskInteractive: cfg.AskBecomePass,
+			PasswordFile:   cfg.SudoPassFile,
+			InsecureCLI:    cfg.InsecureSudoPass,
+		})
+		if err != nil {
+			return nil, &SetupError{Component: "sudo password", Issue: "failed to resolve password", Cause: err}
+		}
+		u.sudoPass = sudoPass
+	}
+
+	renderer, err := template.NewPongo2Renderer()
+	if err != nil {
+		return nil, &SetupError{Component: "template renderer", Issue: "failed to create renderer", Cause: err}
+	}
+	u.ec = &ExecutionContext{
+		Variables: make(map[string]interface{}),
+		Logger:    log,
+		SudoPass:  u.sudoPass,
+		Template:  renderer,
+		Evaluator: expression.NewGovaluateEvaluator(),
+		PathUtil:  pathutil.NewPathExpander(renderer),
+		Context:   cfg.Context,
+	}
+	return u, nil
+}
+
+// undo reverts one change.
+func (u *undoer) undo(op *undoOp) error {
+	switch op.Kind {
+	case artifacts.EntryFile:
+		return u.restoreFile(op)
+	case artifacts.EntryPackage:
+		state := "absent"
+		if !op.Package.Installed {
+			state = "present"
+		}
+		return u.runStep(config.Step{
+			Name:    op.describe(),
+			Become:  op.Become,
+			Package: &config.Package{Name: op.Package.Name, Manager: op.Package.Manager, State: state},
+		})
+	case artifacts.EntryService:
+		service := &config.ServiceAction{Name: op.Service.Name}
+		if op.Service.WasActive != nil {
+			service.State = "stopped"
+			if *op.Service.WasActive {
+				service.State = "started"
+			}
+		}
+		if op.Service.WasEnabled != nil {
+			enabled := *op.Service.WasEnabled
+			service.Enabled = &enabled
+		}
+		return u.runStep(config.Step{Name: op.describe(), Become: op.Become, Service: service})
+	}
+	return nil
+}
+
+// runStep runs a package or service step through its action handler.
+func (u *undoer) runStep(step config.Step) error {
+	return DispatchStepAction(step, u.ec)
+}
+
+// restoreFile puts a path back in its state from before the run.
+func (u *undoer) restoreFile(op *undoOp) error {
+	before := op.Before
+	current := artifacts.Snapshot(op.Path, false)
+
+	// Clear the path unless it only needs its content or mode changed
+	if current.Type != artifacts.FileAbsent && (current.Type != before.Type || before.Type == artifacts.FileSymlink) {
+		if current.Type == artifacts.FileDir && before.Type == artifacts.FileAbsent {
+			if entries, err := os.ReadDir(op.Path); err == nil && len(entries) > 0 {
+				u.log.Infof("  Leaving %s in place: the directory isn't empty", op.Path)
+				return nil
+			}
+		}
+		if err := u.remove(op, current.Type == artifacts.FileDir); err != nil {
+			return err
+		}
+	}
+
+	switch before.Type {
+	case artifacts.FileDir:
+		if current.Type != artifacts.FileDir {
+			if op.Become {
+				return u.sudo("mkdir", "-m", chmodMode(before.Mode), "--", op.Path)
+			}
+			return os.Mkdir(op.Path, before.Mode.Perm())
+		}
+		if op.Become {
+			return u.sudo("chmod", chmodMode(before.Mode), "--", op.Path)
+		}
+		return os.Chmod(op.Path, before.Mode)
+	case artifacts.FileSymlink:
+		if op.Become {
+			return u.sudo("ln", "-s", "--", before.Target, op.Path)
+		}
+		return os.Symlink(before.Target, op.Path)
+	case artifacts.FileRegular:
+		return u.writeFile(op.Path, before.Content, before.Mode, op.Become)
+	}
+	return nil
+}
+
+// remove removes a path; directories must be empty.
+func (u *undoer) remove(op *undoOp, isDir bool) error {
+	if op.Become {
+		if isDir {
+			return u.sudo("rmdir", "--", op.Path)
+		}
+		return u.sudo("rm", "-f", "--", op.Path)
+	}
+	return os.Remove(op.Path)
+}
+
+// writeFile replaces a file with the given content and mode. The content is
+// written to a temporary file first, so the file is never left half written.
+func (u *undoer) writeFile(path string, content []byte, mode os.FileMode, become bool) error {
+	dir := os.TempDir()
+	if !become {
+		dir = filepath.Dir(path)
+	}
+	tmp, err := os.CreateTemp(dir, ".mooncake-undo-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	if become {
+		// $1 and $2 keep the paths out of the shell command line
+		return u.sudo("sh", "-c", `cp "$1" "$2" && chmod "$3" "$2"`, "sh", tmpPath, path, chmodMode(mode))
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// chmodMode formats a file mode as the octal mode of chmod, with the setuid,
+// setgid and sticky bits.
+func chmodMode(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+// sudo runs a command with sudo, passing the password on stdin.
+func (u *undoer) sudo(args ...string) error {
+	if !security.IsBecomeSupported() {
+		return fmt.Errorf("become not supported on this platform")
+	}
+	// #nosec G204 -- Undo runs fixed commands on paths recorded by the run
+	cmd := transport.NewLocal().Command(u.ctx, transport.Cmd{Name: "sudo", Args: append([]string{"-S"}, args...)})
+	cmd.Stdin = bytes.NewBufferString(u.sudoPass + "\n")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sudo %s failed: %w (output: %s)", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+//go:build unix
+
+package executor_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	_ "github.com/alehatsman/mooncake/internal/actions/package"
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/plan"
+)
+
+// runJournaledPlan runs steps in tmpDir with a journal in the run "run-1" of
+// the artifacts directory tmpDir/artifacts.
+func runJournaledPlan(t *testing.T, tmpDir string, steps ...config.Step) string {
+	t.Helper()
+	baseDir := filepath.Join(tmpDir, "artifacts")
+	runDir := artifacts.RunDir(baseDir, "run-1")
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       steps,
+		InitialVars: map[string]interface{}{},
+	}
+	opts := executor.PlanOptions{JournalDir: runDir}
+	if err := executor.ExecutePlanWithOptions(planData, opts, logger.NewTestLogger(), events.NewSyncPublisher()); err != nil {
+		t.Fatalf("ExecutePlanWithOptions() error = %v", err)
+	}
+	return baseDir
+}
+
+// setupUndoTest creates a file, a directory with a file and a symlink, and runs
+// steps that change each of them and create a directory and a file.
+func setupUndoTest(t *testing.T) (tmpDir, baseDir string) {
+	tmpDir = t.TempDir()
+	mustWrite := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite(filepath.Join(tmpDir, "app.conf"), "port=80\n")
+	if err := os.Mkdir(filepath.Join(tmpDir, "cache"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(filepath.Join(tmpDir, "cache", "entry"), "cached\n")
+	if err := os.Symlink("app.conf", filepath.Join(tmpDir, "current")); err != nil {
+		t.Fatal(err)
+	}
+
+	baseDir = runJournaledPlan(t, tmpDir,
+		config.Step{ID: "step-0001", Name: "make dir", File: &config.File{Path: filepath.Join(tmpDir, "new", "sub"), State: "directory"}},
+		fileStep("step-0002", "write new", filepath.Join(tmpDir, "new", "sub", "new.conf"), "x\n"),
+		fileStep("step-0003", "update", filepath.Join(tmpDir, "app.conf"), "port=8080\n"),
+		fileStep("step-0004", "update again", filepath.Join(tmpDir, "app.conf"), "port=9090\n"),
+		config.Step{ID: "step-0005", Name: "remove cache", File: &config.File{Path: filepath.Join(tmpDir, "cache"), State: "absent"}},
+		config.Step{ID: "step-0006", Name: "relink", File: &config.File{
+			Path: filepath.Join(tmpDir, "current"), State: "link", Src: filepath.Join(tmpDir, "new", "sub", "new.conf"), Force: true,
+		}},
+		shellStep("step-0007", "shell", "true"),
+	)
+	return tmpDir, baseDir
+}
+
+func TestJournal_RecordsRunChanges(t *testing.T) {
+	tmpDir, baseDir := setupUndoTest(t)
+
+	entries, err := artifacts.LoadJournal(artifacts.RunDir(baseDir, "run-1"))
+	if err != nil {
+		t.Fatalf("LoadJournal() error = %v", err)
+	}
+
+	var got []string
+	for _, entry := range entries {
+		rel, _ := filepath.Rel(tmpDir, entry.Path)
+		got = append(got, entry.StepID+" "+entry.Kind+" "+rel)
+	}
+	want := []string{
+		"step-0001 file new",
+		"step-0001 file new/sub",
+		"step-0002 file new/sub/new.conf",
+		"step-0003 file app.conf",
+		"step-0004 file app.conf",
+		"step-0005 file cache/entry",
+		"step-0005 file cache",
+		"step-0006 file current",
+		"step-0007 unrecorded ",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("journal entries = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	update := entries[3]
+	if string(update.Before.Content) != "port=80\n" || update.Before.Mode != 0640 {
+		t.Errorf("before = %q (mode %o), want the previous content and mode", update.Before.Content, update.Before.Mode)
+	}
+	if update.StepName != "update" || update.Action != "file" {
+		t.Errorf("entry step = %q (%s), want update (file)", update.StepName, update.Action)
+	}
+}
+
+func TestJournal_NotKeptInDryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	runDir := filepath.Join(tmpDir, "run")
+	if err := os.Mkdir(runDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	planData := &plan.Plan{
+		RootFile:    filepath.Join(tmpDir, "test.yml"),
+		Steps:       []config.Step{fileStep("step-0001", "write", filepath.Join(tmpDir, "a"), "x\n")},
+		InitialVars: map[string]interface{}{},
+	}
+	opts := executor.PlanOptions{JournalDir: runDir, DryRun: true}
+	if err := executor.ExecutePlanWithOptions(planData, opts, logger.NewTestLogger(), events.NewSyncPublisher()); err != nil {
+		t.Fatalf("ExecutePlanWithOptions() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(runDir, artifacts.JournalFile)); !os.IsNotExist(err) {
+		t.Error("dry run should not write a journal")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	tmpDir, baseDir := setupUndoTest(t)
+	log := logger.NewTestLogger()
+
+	if err := executor.Undo(executor.UndoConfig{RunID: "run-1", ArtifactsDir: baseDir}, log); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "app.conf"))
+	if err != nil || string(content) != "port=80\n" {
+		t.Errorf("app.conf = %q (%v), want the content before the run", content, err)
+	}
+	if info, err := os.Stat(filepath.Join(tmpDir, "app.conf")); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("app.conf mode = %v (%v), want 0640", info.Mode(), err)
+	}
+	if content, err := os.ReadFile(filepath.Join(tmpDir, "cache", "entry")); err != nil || string(content) != "cached\n" {
+		t.Errorf("cache/entry = %q (%v), want it recreated", content, err)
+	}
+	if info, err := os.Stat(filepath.Join(tmpDir, "cache")); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("cache mode = %v (%v), want 0750", info.Mode(), err)
+	}
+	if target, err := os.Readlink(filepath.Join(tmpDir, "current")); err != nil || target != "app.conf" {
+		t.Errorf("current -> %q (%v), want app.conf", target, err)
+	}
+	if _, err := os.Lstat(filepath.Join(tmpDir, "new")); !os.IsNotExist(err) {
+		t.Errorf("created directory should be removed, stat error = %v", err)
+	}
+	if !log.Contains("Can't undo step 'shell' (shell)") {
+		t.Errorf("undo should list the unrecorded shell step, logs: %v", log.Logs)
+	}
+
+	// Everything is already undone
+	log = logger.NewTestLogger()
+	if err := executor.Undo(executor.UndoConfig{RunID: "run-1", ArtifactsDir: baseDir}, log); err != nil {
+		t.Fatalf("second Undo() error = %v", err)
+	}
+	if !log.Contains("Nothing to undo") {
+		t.Errorf("second undo should have nothing to do, logs: %v", log.Logs)
+	}
+}
+
+func TestUndo_DryRun(t *testing.T) {
+	tmpDir, baseDir := setupUndoTest(t)
+	log := logger.NewTestLogger()
+
+	if err := executor.Undo(executor.UndoConfig{RunID: "run-1", ArtifactsDir: baseDir, DryRun: true}, log); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(tmpDir, "app.conf")); string(content) != "port=9090\n" {
+		t.Errorf("dry run changed app.conf to %q", content)
+	}
+	for _, want := range []string{
+		"Would undo 7 changes of run run-1",
+		"restore " + filepath.Join(tmpDir, "app.conf") + " (step 'update')",
+		"recreate " + filepath.Join(tmpDir, "cache", "entry"),
+		"remove " + filepath.Join(tmpDir, "new", "sub"),
+	} {
+		if !log.Contains(want) {
+			t.Errorf("preview missing %q, logs: %v", want, log.Logs)
+		}
+	}
+}
+
+func TestUndo_RefusesModifiedFiles(t *testing.T) {
+	tmpDir, baseDir := setupUndoTest(t)
+	appConf := filepath.Join(tmpDir, "app.conf")
+	if err := os.WriteFile(appConf, []byte("edited\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	err := executor.Undo(executor.UndoConfig{RunID: "run-1", ArtifactsDir: baseDir}, logger.NewTestLogger())
+	var conflictErr *executor.UndoConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("Undo() error = %v, want UndoConflictError", err)
+	}
+	if len(conflictErr.Paths) != 1 || conflictErr.Paths[0] != appConf {
+		t.Errorf("conflicting paths = %v, want [%s]", conflictErr.Paths, appConf)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "new")); err != nil {
+		t.Errorf("refused undo should change nothing, stat error = %v", err)
+	}
+
+	// --force discards the modification
+	if err := executor.Undo(executor.UndoConfig{RunID: "run-1", ArtifactsDir: baseDir, Force: true}, logger.NewTestLogger()); err != nil {
+		t.Fatalf("forced Undo() error = %v", err)
+	}
+	if content, _ := os.ReadFile(appConf); string(content) != "port=80\n" {
+		t.Errorf("app.conf = %q, want the content before the run", content)
+	}
+}
+
+func TestUndo_KeepsNonEmptyCreatedDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	dir := filepath.Join(tmpDir, "data")
+	baseDir := runJournaledPlan(t, tmpDir,
+		config.Step{ID: "step-0001", Name: "make dir", File: &config.File{Path: dir, State: "directory"}},
+	)
+	if err := os.WriteFile(filepath.Join(dir, "user-file"), []byte("keep\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewTestLogger()
+	if err := executor.Undo(executor.UndoConfig{RunID: "run-1", ArtifactsDir: baseDir}, log); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "user-file")); err != nil {
+		t.Errorf("file added after the run should be kept, stat error = %v", err)
+	}
+	if !log.Contains("isn't empty") {
+		t.Errorf("undo should report the kept directory, logs: %v", log.Logs)
+	}
+}
+
+func TestUndo_MissingJournal(t *testing.T) {
+	baseDir := t.TempDir()
+	if err := os.MkdirAll(artifacts.RunDir(baseDir, "run-1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := executor.Undo(executor.UndoConfig{RunID: "run-1", ArtifactsDir: baseDir}, logger.NewTestLogger())
+	if err == nil {
+		t.Fatal("Undo() should fail without a journal")
+	}
+	if err := executor.Undo(executor.UndoConfig{RunID: "missing", ArtifactsDir: baseDir}, logger.NewTestLogger()); err == nil {
+		t.Fatal("Undo() should fail for an unknown run")
+	}
+}
+
+func TestUndo_Package(t *testing.T) {
+	tmpDir := t.TempDir()
+	installed := filepath.Join(tmpDir, "installed")
+	if err := os.Mkdir(installed, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake apt-get and dpkg keeping installed packages as files
+	binDir := filepath.Join(tmpDir, "bin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	scripts := map[string]string{
+		"apt-get": "#!/bin/sh\nfor pkg; do :; done\ncase \"$1\" in\n  install) touch " + installed + "/$pkg ;;\n  remove) rm " + installed + "/$pkg ;;\nesac\n",
+		"dpkg":    "#!/bin/sh\ntest -e " + installed + "/$2\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(binDir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if err := os.WriteFile(filepath.Join(installed, "git"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	baseDir := runJournaledPlan(t, tmpDir,
+		config.Step{ID: "step-0001", Name: "install", Package: &config.Package{Names: []string{"curl", "git"}, Manager: "apt"}},
+		config.Step{ID: "step-0002", Name: "remove", Package: &config.Package{Name: "git", State: "absent", Manager: "apt"}},
+	)
+
+	log := logger.NewTestLogger()
+	if err := executor.Undo(executor.UndoConfig{RunID: "run-1", ArtifactsDir: baseDir}, log); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if !log.Contains("install package git (step 'remove')") || !log.Contains("remove package curl (step 'install')") {
+		t.Errorf("unexpected undo operations, logs: %v", log.Logs)
+	}
+	if _, err := os.Stat(filepath.Join(installed, "curl")); !os.IsNotExist(err) {
+		t.Error("package installed by the run should be removed")
+	}
+	if _, err := os.Stat(filepath.Join(installed, "git")); err != nil {
+		t.Error("package removed by the run should be installed again")
+	}
+}
+
+func TestUndo_Service(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("systemd services are only managed on Linux")
+	}
+	tmpDir := t.TempDir()
+	state := filepath.Join(tmpDir, "state")
+	if err := os.Mkdir(state, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake systemctl keeping the service state as files
+	binDir := filepath.Join(tmpDir, "bin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+case "$1" in
+  is-active) test -e ` + state + `/active && echo active || echo inactive ;;
+  is-enabled) test -e ` + state + `/enabled && echo enabled || echo disabled ;;
+  start) touch ` + state + `/active ;;
+  stop) rm -f ` + state + `/active ;;
+  enable) touch ` + state + `/enabled ;;
+  disable) rm -f ` + state + `/enabled ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, "systemctl"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	enabled := true
+	unitPath := filepath.Join(tmpDir, "app.service")
+	baseDir := runJournaledPlan(t, tmpDir, config.Step{ID: "step-0001", Name: "app service", Service: &config.ServiceAction{
+		Name:    "app",
+		State:   "started",
+		Enabled: &enabled,
+		Unit:    &config.ServiceUnit{Dest: unitPath, Content: "[Service]\n"},
+	}})
+	if _, err := os.Stat(filepath.Join(state, "active")); err != nil {
+		t.Fatal("service should be started by the run")
+	}
+
+	log := logger.NewTestLogger()
+	if err := executor.Undo(executor.UndoConfig{RunID: "run-1", ArtifactsDir: baseDir}, log); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	for _, path := range []string{filepath.Join(state, "active"), filepath.Join(state, "enabled"), unitPath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed by the undo", path)
+		}
+	}
+	if !log.Contains("stop service app") || !log.Contains("disable service app") {
+		t.Errorf("unexpected undo operations, logs: %v", log.Logs)
+	}
+}
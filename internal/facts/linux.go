@@ -55,8 +55,12 @@ func detectLinuxDistribution() (distro, version string) {
 		}
 	}
 
-	lines := strings.Split(string(data), "\n")
-	var id, versionID string
+	return parseOSRelease(string(data))
+}
+
+// parseOSRelease returns the ID and VERSION_ID of an os-release file
+func parseOSRelease(data string) (id, versionID string) {
+	lines := strings.Split(data, "\n")
 
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -72,12 +76,21 @@ func detectLinuxDistribution() (distro, version string) {
 
 // detectLinuxPackageManager determines the package manager based on distribution
 func detectLinuxPackageManager(distro string) string {
+	return linuxPackageManager(distro, func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	})
+}
+
+// linuxPackageManager determines the package manager based on distribution,
+// checking which commands are available with available
+func linuxPackageManager(distro string, available func(name string) bool) string {
 	switch distro {
 	case "ubuntu", "debian", "linuxmint":
 		return "apt"
 	case "centos", "rhel":
 		// Check if dnf is available (CentOS 8+)
-		if _, err := exec.LookPath(pkgManagerDnf); err == nil {
+		if available(pkgManagerDnf) {
 			return pkgManagerDnf
 		}
 		return "yum"
@@ -92,7 +105,7 @@ func detectLinuxPackageManager(distro string) string {
 	default:
 		// Try to detect by command availability
 		for _, pm := range []string{"apt", "dnf", "yum", "pacman", "zypper", "apk"} {
-			if _, err := exec.LookPath(pm); err == nil {
+			if available(pm) {
 				return pm
 			}
 		}
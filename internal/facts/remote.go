@@ -0,0 +1,147 @@
+package facts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/transport"
+)
+
+// remoteScript prints the facts CollectRemote gathers as key=value lines,
+// followed by the os-release and meminfo files.
+const remoteScript = `echo "os=$(uname -s)"
+echo "arch=$(uname -m)"
+echo "hostname=$(hostname 2>/dev/null || uname -n)"
+echo "username=$(id -un)"
+echo "home=$HOME"
+echo "kernel=$(uname -r)"
+echo "cpus=$(getconf _NPROCESSORS_ONLN 2>/dev/null || sysctl -n hw.ncpu 2>/dev/null)"
+echo "memsize=$(sysctl -n hw.memsize 2>/dev/null)"
+echo "macos_version=$(sw_vers -productVersion 2>/dev/null)"
+echo "python=$(python3 --version 2>/dev/null || python --version 2>/dev/null)"
+for pm in apt dnf yum pacman zypper apk brew port; do
+  command -v "$pm" >/dev/null 2>&1 && echo "command=$pm"
+done
+echo "--- os-release"
+cat /etc/os-release 2>/dev/null || cat /etc/lsb-release 2>/dev/null
+echo "--- meminfo"
+cat /proc/meminfo 2>/dev/null
+true`
+
+// CollectRemote gathers the facts of the host a transport runs commands on with
+// POSIX shell utilities: OS, architecture, hostname, user, distribution, package
+// manager, kernel, CPU cores, memory and Python version. Hardware details,
+// network interfaces and toolchains are only collected for this host.
+func CollectRemote(ctx context.Context, t transport.Transport) (*Facts, error) {
+	cmd := t.Command(ctx, transport.Cmd{Name: "sh", Args: []string{"-c", remoteScript}})
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to collect facts of %s: %w: %s", t, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseRemoteFacts(stdout.String()), nil
+}
+
+// parseRemoteFacts parses the output of remoteScript.
+func parseRemoteFacts(out string) *Facts {
+	values := make(map[string]string)
+	commands := make(map[string]bool)
+	sections := make(map[string]*strings.Builder)
+	var section *strings.Builder
+	for _, line := range strings.Split(out, "\n") {
+		if name, ok := strings.CutPrefix(line, "--- "); ok {
+			section = &strings.Builder{}
+			sections[name] = section
+			continue
+		}
+		if section != nil {
+			section.WriteString(line + "\n")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if key == "command" {
+			commands[value] = true
+			continue
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+	sectionText := func(name string) string {
+		if b := sections[name]; b != nil {
+			return b.String()
+		}
+		return ""
+	}
+
+	f := &Facts{
+		OS:            strings.ToLower(values["os"]),
+		Arch:          goArch(values["arch"]),
+		Hostname:      values["hostname"],
+		Username:      values["username"],
+		UserHome:      values["home"],
+		KernelVersion: values["kernel"],
+		PythonVersion: strings.TrimPrefix(values["python"], "Python "),
+	}
+	f.CPUCores, _ = strconv.Atoi(values["cpus"])
+
+	switch f.OS {
+	case osLinux:
+		f.Distribution, f.DistributionVersion = parseOSRelease(sectionText("os-release"))
+		f.PackageManager = linuxPackageManager(f.Distribution, func(name string) bool { return commands[name] })
+		meminfo := sectionText("meminfo")
+		f.MemoryTotalMB = meminfoMB(meminfo, "MemTotal")
+		f.MemoryFreeMB = meminfoMB(meminfo, "MemAvailable")
+		f.SwapTotalMB = meminfoMB(meminfo, "SwapTotal")
+		f.SwapFreeMB = meminfoMB(meminfo, "SwapFree")
+	case osDarwin:
+		f.Distribution = "macos"
+		f.DistributionVersion = values["macos_version"]
+		for _, pm := range []string{"brew", "port"} {
+			if commands[pm] {
+				f.PackageManager = pm
+				break
+			}
+		}
+		if memsize, err := strconv.ParseInt(values["memsize"], 10, 64); err == nil {
+			f.MemoryTotalMB = memsize / 1024 / 1024
+		}
+	}
+	f.DistributionMajor = extractMajorVersion(f.DistributionVersion)
+	return f
+}
+
+// goArch converts a uname -m machine name to a GOARCH name.
+func goArch(machine string) string {
+	switch machine {
+	case "x86_64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "i386", "i686":
+		return "386"
+	case "armv7l", "armv6l":
+		return "arm"
+	}
+	return machine
+}
+
+// meminfoMB returns a /proc/meminfo value in MB.
+func meminfoMB(meminfo, key string) int64 {
+	for _, line := range strings.Split(meminfo, "\n") {
+		// Format: "MemTotal:       16384000 kB"
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == key+":" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err == nil {
+				return kb / 1024
+			}
+		}
+	}
+	return 0
+}
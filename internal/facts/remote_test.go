@@ -0,0 +1,122 @@
+package facts
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/transport"
+)
+
+func TestParseRemoteFacts_Linux(t *testing.T) {
+	out := `os=Linux
+arch=x86_64
+hostname=web1
+username=deploy
+home=/home/deploy
+kernel=6.1.0-18-amd64
+cpus=4
+memsize=
+macos_version=
+python=Python 3.11.2
+command=apt
+command=yum
+--- os-release
+PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+ID=debian
+VERSION_ID="12"
+--- meminfo
+MemTotal:        8388608 kB
+MemFree:         1048576 kB
+MemAvailable:    4194304 kB
+SwapTotal:       2097152 kB
+SwapFree:        1048576 kB
+`
+	f := parseRemoteFacts(out)
+	if f.OS != "linux" || f.Arch != "amd64" || f.Hostname != "web1" || f.Username != "deploy" ||
+		f.UserHome != "/home/deploy" || f.KernelVersion != "6.1.0-18-amd64" || f.CPUCores != 4 {
+		t.Errorf("parseRemoteFacts() system facts = %+v", f)
+	}
+	if f.Distribution != "debian" || f.DistributionVersion != "12" || f.DistributionMajor != "12" {
+		t.Errorf("parseRemoteFacts() distribution = %q %q %q", f.Distribution, f.DistributionVersion, f.DistributionMajor)
+	}
+	if f.PackageManager != "apt" {
+		t.Errorf("parseRemoteFacts() package manager = %q, want apt", f.PackageManager)
+	}
+	if f.PythonVersion != "3.11.2" {
+		t.Errorf("parseRemoteFacts() python = %q", f.PythonVersion)
+	}
+	if f.MemoryTotalMB != 8192 || f.MemoryFreeMB != 4096 || f.SwapTotalMB != 2048 || f.SwapFreeMB != 1024 {
+		t.Errorf("parseRemoteFacts() memory = %d/%d swap %d/%d", f.MemoryTotalMB, f.MemoryFreeMB, f.SwapTotalMB, f.SwapFreeMB)
+	}
+}
+
+func TestParseRemoteFacts_Darwin(t *testing.T) {
+	out := `os=Darwin
+arch=arm64
+hostname=mac
+cpus=8
+memsize=17179869184
+macos_version=14.2.1
+command=port
+command=brew
+--- os-release
+--- meminfo
+`
+	f := parseRemoteFacts(out)
+	if f.OS != "darwin" || f.Arch != "arm64" || f.Distribution != "macos" ||
+		f.DistributionVersion != "14.2.1" || f.DistributionMajor != "14" {
+		t.Errorf("parseRemoteFacts() = %+v", f)
+	}
+	if f.PackageManager != "brew" {
+		t.Errorf("parseRemoteFacts() package manager = %q, want brew", f.PackageManager)
+	}
+	if f.MemoryTotalMB != 16384 {
+		t.Errorf("parseRemoteFacts() memory = %d, want 16384", f.MemoryTotalMB)
+	}
+}
+
+func TestGoArch(t *testing.T) {
+	tests := map[string]string{
+		"x86_64":  "amd64",
+		"aarch64": "arm64",
+		"arm64":   "arm64",
+		"i686":    "386",
+		"armv7l":  "arm",
+		"riscv64": "riscv64",
+	}
+	for machine, want := range tests {
+		if got := goArch(machine); got != want {
+			t.Errorf("goArch(%q) = %q, want %q", machine, got, want)
+		}
+	}
+}
+
+func TestCollectRemote_Local(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("remote facts are collected from POSIX hosts")
+	}
+
+	f, err := CollectRemote(context.Background(), transport.NewLocal())
+	if err != nil {
+		t.Fatalf("CollectRemote() error = %v", err)
+	}
+	local := Collect()
+	if f.OS != runtime.GOOS || f.Arch != runtime.GOARCH {
+		t.Errorf("CollectRemote() = %s/%s, want %s/%s", f.OS, f.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+	if hostname, err := os.Hostname(); err == nil && f.Hostname != hostname {
+		t.Errorf("CollectRemote() hostname = %q, want %q", f.Hostname, hostname)
+	}
+	if f.Distribution != local.Distribution || f.DistributionVersion != local.DistributionVersion {
+		t.Errorf("CollectRemote() distribution = %q %q, want %q %q",
+			f.Distribution, f.DistributionVersion, local.Distribution, local.DistributionVersion)
+	}
+	if f.PackageManager != local.PackageManager {
+		t.Errorf("CollectRemote() package manager = %q, want %q", f.PackageManager, local.PackageManager)
+	}
+	if f.CPUCores <= 0 {
+		t.Errorf("CollectRemote() CPU cores = %d", f.CPUCores)
+	}
+}
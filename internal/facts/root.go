@@ -0,0 +1,36 @@
+package facts
+
+import (
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/transport"
+)
+
+// CollectRoot gathers the facts of an alternate root directory, such as the root
+// file system of an image: the distribution comes from the os-release file of the
+// root, and the package manager from the distribution and the commands installed
+// in the root. Other facts (architecture, kernel, hardware, network) are those of
+// this host, which runs the commands of the root.
+func CollectRoot(root *transport.Chroot) *Facts {
+	f := *Collect()
+	f.OS = osLinux
+
+	var data []byte
+	for _, name := range []string{"/etc/os-release", "/usr/lib/os-release", "/etc/lsb-release"} {
+		var err error
+		if data, err = root.ReadFile(name); err == nil {
+			break
+		}
+	}
+	f.Distribution, f.DistributionVersion = parseOSRelease(string(data))
+	f.DistributionMajor = extractMajorVersion(f.DistributionVersion)
+	f.PackageManager = linuxPackageManager(f.Distribution, func(name string) bool {
+		_, err := root.LookPath(name)
+		return err == nil
+	})
+
+	if hostname, err := root.ReadFile("/etc/hostname"); err == nil && strings.TrimSpace(string(hostname)) != "" {
+		f.Hostname = strings.TrimSpace(string(hostname))
+	}
+	return &f
+}
@@ -0,0 +1,90 @@
+package facts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/transport"
+)
+
+func TestCollectRoot(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		wantDistro string
+		wantVer    string
+		wantMajor  string
+		wantPM     string
+	}{
+		{
+			name: "debian",
+			files: map[string]string{
+				"etc/os-release": "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\nVERSION_ID=\"12\"\n",
+				"etc/hostname":   "image-builder\n",
+			},
+			wantDistro: "debian", wantVer: "12", wantMajor: "12", wantPM: "apt",
+		},
+		{
+			name: "os-release in /usr/lib",
+			files: map[string]string{
+				"usr/lib/os-release": "ID=fedora\nVERSION_ID=40\n",
+			},
+			wantDistro: "fedora", wantVer: "40", wantMajor: "40", wantPM: "dnf",
+		},
+		{
+			name: "unknown distribution with a package manager",
+			files: map[string]string{
+				"etc/os-release": "ID=custom\nVERSION_ID=1.2\n",
+				"usr/bin/apk":    "",
+			},
+			wantDistro: "custom", wantVer: "1.2", wantMajor: "1", wantPM: "apk",
+		},
+		{
+			name:  "empty root",
+			files: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("PATH", "/usr/bin:/bin")
+			root, err := transport.NewChroot(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f := CollectRoot(root)
+			if f.OS != "linux" {
+				t.Errorf("OS = %q, want linux", f.OS)
+			}
+			if f.Distribution != tt.wantDistro || f.DistributionVersion != tt.wantVer || f.DistributionMajor != tt.wantMajor {
+				t.Errorf("distribution = %q %q (major %q), want %q %q (major %q)",
+					f.Distribution, f.DistributionVersion, f.DistributionMajor, tt.wantDistro, tt.wantVer, tt.wantMajor)
+			}
+			if f.PackageManager != tt.wantPM {
+				t.Errorf("PackageManager = %q, want %q", f.PackageManager, tt.wantPM)
+			}
+			if _, ok := tt.files["etc/hostname"]; ok && f.Hostname != "image-builder" {
+				t.Errorf("Hostname = %q, want the hostname of the root", f.Hostname)
+			}
+			if f.Arch != Collect().Arch {
+				t.Errorf("Arch = %q, want the architecture of this host", f.Arch)
+			}
+		})
+	}
+
+	// The facts of this host are left as they are
+	if Collect().Hostname == "image-builder" {
+		t.Error("CollectRoot() changed the cached facts of this host")
+	}
+}
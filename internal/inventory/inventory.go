@@ -0,0 +1,299 @@
+// Package inventory loads inventory files: the hosts a config is applied to, their
+// groups, and the variables of each host.
+//
+// An inventory is a YAML file:
+//
+//	vars:              # variables of every host
+//	  ntp_server: time.example.com
+//	hosts:
+//	  web1:
+//	    address: deploy@10.0.0.11   # [user@]host[:port], default: the host name
+//	    vars:
+//	      workers: 4
+//	  workstation:
+//	    connection: local           # this host instead of SSH
+//	groups:
+//	  web:
+//	    hosts: [web1, web2]         # web2 is a host with default settings
+//	    vars:
+//	      role: web
+//
+// Variables of a host are the inventory vars, overridden by the vars of its groups
+// (in group name order), overridden by its own vars.
+package inventory
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Connection types of a host.
+const (
+	ConnectionSSH   = "ssh"
+	ConnectionLocal = "local"
+)
+
+// allGroup is the implicit group of every host.
+const allGroup = "all"
+
+// Inventory is a parsed inventory file.
+type Inventory struct {
+	// Hosts sorted by name.
+	Hosts []*Host
+
+	// Groups by name.
+	Groups map[string]*Group
+
+	// Vars are the variables of every host.
+	Vars map[string]interface{}
+}
+
+// Host is a host of an inventory.
+type Host struct {
+	Name string
+
+	// Address is the SSH target, [user@]host[:port]. Empty for local hosts.
+	Address string
+
+	// Connection is ConnectionSSH or ConnectionLocal.
+	Connection string
+
+	// Groups are the names of the groups of the host, sorted.
+	Groups []string
+
+	// Vars are the variables of the host itself, without inventory and group vars.
+	Vars map[string]interface{}
+}
+
+// Group is a named set of hosts.
+type Group struct {
+	Name  string
+	Hosts []string
+	Vars  map[string]interface{}
+}
+
+// file is the YAML layout of an inventory file.
+type file struct {
+	Vars   map[string]interface{} `yaml:"vars"`
+	Hosts  map[string]*hostEntry  `yaml:"hosts"`
+	Groups map[string]*groupEntry `yaml:"groups"`
+}
+
+type hostEntry struct {
+	Address    string                 `yaml:"address"`
+	Connection string                 `yaml:"connection"`
+	Vars       map[string]interface{} `yaml:"vars"`
+}
+
+type groupEntry struct {
+	Hosts []string               `yaml:"hosts"`
+	Vars  map[string]interface{} `yaml:"vars"`
+}
+
+// Load reads an inventory file.
+func Load(filePath string) (*Inventory, error) {
+	data, err := os.ReadFile(filePath) // #nosec G304 -- filePath is user-provided CLI argument
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory: %w", err)
+	}
+	inv, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid inventory %s: %w", filePath, err)
+	}
+	return inv, nil
+}
+
+// Parse parses the content of an inventory file.
+func Parse(data []byte) (*Inventory, error) {
+	var f file
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	inv := &Inventory{
+		Groups: make(map[string]*Group),
+		Vars:   f.Vars,
+	}
+	hosts := make(map[string]*Host)
+	for name, entry := range f.Hosts {
+		if err := validateName("host", name); err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			entry = &hostEntry{}
+		}
+		host := &Host{Name: name, Address: entry.Address, Connection: entry.Connection, Vars: entry.Vars}
+		switch host.Connection {
+		case "", ConnectionSSH:
+			host.Connection = ConnectionSSH
+			if host.Address == "" {
+				host.Address = name
+			}
+		case ConnectionLocal:
+			if host.Address != "" {
+				return nil, fmt.Errorf("host %q: local hosts have no address", name)
+			}
+		default:
+			return nil, fmt.Errorf("host %q: unknown connection %q (use %s or %s)", name, host.Connection, ConnectionSSH, ConnectionLocal)
+		}
+		hosts[name] = host
+	}
+
+	for name, entry := range f.Groups {
+		if err := validateName("group", name); err != nil {
+			return nil, err
+		}
+		if name == allGroup {
+			return nil, fmt.Errorf("group %q is reserved for all hosts", allGroup)
+		}
+		if _, ok := f.Hosts[name]; ok {
+			return nil, fmt.Errorf("%q is both a host and a group", name)
+		}
+		if entry == nil {
+			entry = &groupEntry{}
+		}
+		group := &Group{Name: name, Vars: entry.Vars}
+		for _, hostName := range entry.Hosts {
+			if err := validateName("host", hostName); err != nil {
+				return nil, fmt.Errorf("group %q: %w", name, err)
+			}
+			if _, ok := f.Groups[hostName]; ok {
+				return nil, fmt.Errorf("group %q: %q is a group, not a host", name, hostName)
+			}
+			host, ok := hosts[hostName]
+			if !ok {
+				// Hosts only listed in groups use the default settings
+				host = &Host{Name: hostName, Address: hostName, Connection: ConnectionSSH}
+				hosts[hostName] = host
+			}
+			host.Groups = append(host.Groups, name)
+			group.Hosts = append(group.Hosts, hostName)
+		}
+		inv.Groups[name] = group
+	}
+
+	for _, host := range hosts {
+		sort.Strings(host.Groups)
+		inv.Hosts = append(inv.Hosts, host)
+	}
+	sort.Slice(inv.Hosts, func(i, j int) bool { return inv.Hosts[i].Name < inv.Hosts[j].Name })
+	return inv, nil
+}
+
+// validateName checks that a host or group name can be used in --limit and as a
+// directory name.
+func validateName(kind, name string) error {
+	if name == "" {
+		return fmt.Errorf("empty %s name", kind)
+	}
+	if strings.ContainsAny(name, `/\,!*?[]`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid %s name %q", kind, name)
+	}
+	return nil
+}
+
+// Select returns the hosts matching a limit, in name order. The limit is a
+// comma-separated list of host names, group names and glob patterns over both;
+// "all" (or an empty limit) selects every host, and a "!" prefix excludes the
+// hosts of a pattern. A pattern matching nothing is an error.
+func (inv *Inventory) Select(limit string) ([]*Host, error) {
+	included := make(map[string]bool)
+	excluded := make(map[string]bool)
+	hasIncludes := false
+	for _, pattern := range strings.Split(limit, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		names := included
+		if rest, ok := strings.CutPrefix(pattern, "!"); ok {
+			pattern, names = rest, excluded
+		} else {
+			hasIncludes = true
+		}
+
+		matched, err := inv.match(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("no hosts match %q", pattern)
+		}
+		for _, name := range matched {
+			names[name] = true
+		}
+	}
+
+	var hosts []*Host
+	for _, host := range inv.Hosts {
+		if (included[host.Name] || !hasIncludes) && !excluded[host.Name] {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+// match returns the names of the hosts matching a pattern.
+func (inv *Inventory) match(pattern string) ([]string, error) {
+	if pattern == allGroup {
+		names := make([]string, 0, len(inv.Hosts))
+		for _, host := range inv.Hosts {
+			names = append(names, host.Name)
+		}
+		return names, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	var names []string
+	for _, host := range inv.Hosts {
+		if ok, _ := path.Match(pattern, host.Name); ok {
+			names = append(names, host.Name)
+			continue
+		}
+		for _, group := range host.Groups {
+			if ok, _ := path.Match(pattern, group); ok {
+				names = append(names, host.Name)
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// Variables returns the variables of a host: the inventory vars, the vars of its
+// groups in name order and its own vars, each overriding the previous ones. It also
+// sets inventory_hostname to the host name and group_names to its groups.
+func (inv *Inventory) Variables(host *Host) map[string]interface{} {
+	vars := make(map[string]interface{})
+	for k, v := range inv.Vars {
+		vars[k] = v
+	}
+	for _, name := range host.Groups {
+		for k, v := range inv.Groups[name].Vars {
+			vars[k] = v
+		}
+	}
+	for k, v := range host.Vars {
+		vars[k] = v
+	}
+
+	groups := make([]interface{}, len(host.Groups))
+	for i, name := range host.Groups {
+		groups[i] = name
+	}
+	vars["inventory_hostname"] = host.Name
+	vars["group_names"] = groups
+	return vars
+}
@@ -0,0 +1,224 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testInventory = `
+vars:
+  ntp_server: time.example.com
+  role: none
+hosts:
+  web1:
+    address: deploy@10.0.0.11
+    vars:
+      workers: 4
+  db1:
+    address: 10.0.0.21:2222
+  workstation:
+    connection: local
+    vars:
+      role: desktop
+groups:
+  web:
+    hosts: [web1, web2]
+    vars:
+      role: web
+      workers: 2
+  db:
+    hosts: [db1]
+    vars:
+      role: db
+  monitored:
+    hosts: [web1, db1]
+    vars:
+      role: monitored
+      monitoring: true
+`
+
+func hostNames(hosts []*Host) []string {
+	names := make([]string, len(hosts))
+	for i, host := range hosts {
+		names[i] = host.Name
+	}
+	return names
+}
+
+func TestParse(t *testing.T) {
+	inv, err := Parse([]byte(testInventory))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if got, want := hostNames(inv.Hosts), []string{"db1", "web1", "web2", "workstation"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+	byName := make(map[string]*Host)
+	for _, host := range inv.Hosts {
+		byName[host.Name] = host
+	}
+
+	tests := []struct {
+		name       string
+		address    string
+		connection string
+		groups     []string
+	}{
+		{"web1", "deploy@10.0.0.11", ConnectionSSH, []string{"monitored", "web"}},
+		{"web2", "web2", ConnectionSSH, []string{"web"}},
+		{"db1", "10.0.0.21:2222", ConnectionSSH, []string{"db", "monitored"}},
+		{"workstation", "", ConnectionLocal, nil},
+	}
+	for _, tt := range tests {
+		host := byName[tt.name]
+		if host.Address != tt.address || host.Connection != tt.connection || !reflect.DeepEqual(host.Groups, tt.groups) {
+			t.Errorf("host %s = %q %q %v, want %q %q %v", tt.name,
+				host.Address, host.Connection, host.Groups, tt.address, tt.connection, tt.groups)
+		}
+	}
+
+	if got := inv.Groups["web"].Hosts; !reflect.DeepEqual(got, []string{"web1", "web2"}) {
+		t.Errorf("group web hosts = %v", got)
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	inv, err := Parse(nil)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(inv.Hosts) != 0 {
+		t.Errorf("hosts = %v, want none", hostNames(inv.Hosts))
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":        "hosts:\n  web1:\n    adress: x\n",
+		"unknown connection":   "hosts:\n  web1:\n    connection: winrm\n",
+		"local with address":   "hosts:\n  web1:\n    connection: local\n    address: x\n",
+		"host and group":       "hosts:\n  web: {}\ngroups:\n  web:\n    hosts: [web1]\n",
+		"group as host":        "groups:\n  web:\n    hosts: [db]\n  db:\n    hosts: [db1]\n",
+		"reserved group":       "groups:\n  all:\n    hosts: [web1]\n",
+		"slash in host name":   "hosts:\n  ../web1: {}\n",
+		"comma in group name":  "groups:\n  web,db:\n    hosts: [web1]\n",
+		"empty host in group":  "groups:\n  web:\n    hosts: ['']\n",
+		"not a mapping":        "- web1\n",
+		"glob in a group host": "groups:\n  web:\n    hosts: ['web*']\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(content)); err == nil {
+				t.Errorf("Parse() should fail for %q", content)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.yml")
+	if err := os.WriteFile(path, []byte("hosts:\n  web1:\n    bad: field\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("Load() error = %v, want it to name the file", err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("Load() of a missing file should fail")
+	}
+
+	if err := os.WriteFile(path, []byte(testInventory), 0644); err != nil {
+		t.Fatal(err)
+	}
+	inv, err := Load(path)
+	if err != nil || len(inv.Hosts) != 4 {
+		t.Errorf("Load() = %v, %v", inv, err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	inv, err := Parse([]byte(testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		limit   string
+		want    []string
+		wantErr string
+	}{
+		{limit: "", want: []string{"db1", "web1", "web2", "workstation"}},
+		{limit: "all", want: []string{"db1", "web1", "web2", "workstation"}},
+		{limit: "web", want: []string{"web1", "web2"}},
+		{limit: "web2", want: []string{"web2"}},
+		{limit: "web, db", want: []string{"db1", "web1", "web2"}},
+		{limit: "web*", want: []string{"web1", "web2"}},
+		{limit: "mon*", want: []string{"db1", "web1"}},
+		{limit: "web,!web1", want: []string{"web2"}},
+		{limit: "!web1,web", want: []string{"web2"}},
+		{limit: "!monitored", want: []string{"web2", "workstation"}},
+		{limit: "web,web1", want: []string{"web1", "web2"}},
+		{limit: "mail", wantErr: `no hosts match "mail"`},
+		{limit: "web,!mail", wantErr: `no hosts match "mail"`},
+		{limit: "web[", wantErr: `invalid pattern`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			hosts, err := inv.Select(tt.limit)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Select(%q) error = %v, want %q", tt.limit, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Select(%q) error = %v", tt.limit, err)
+			}
+			if got := hostNames(hosts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select(%q) = %v, want %v", tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariables(t *testing.T) {
+	inv, err := Parse([]byte(testInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]*Host)
+	for _, host := range inv.Hosts {
+		byName[host.Name] = host
+	}
+
+	tests := []struct {
+		host string
+		want map[string]interface{}
+	}{
+		{"web1", map[string]interface{}{
+			"ntp_server": "time.example.com", "role": "web", "workers": 4, "monitoring": true,
+			"inventory_hostname": "web1", "group_names": []interface{}{"monitored", "web"},
+		}},
+		{"web2", map[string]interface{}{
+			"ntp_server": "time.example.com", "role": "web", "workers": 2,
+			"inventory_hostname": "web2", "group_names": []interface{}{"web"},
+		}},
+		{"db1", map[string]interface{}{
+			"ntp_server": "time.example.com", "role": "monitored", "monitoring": true,
+			"inventory_hostname": "db1", "group_names": []interface{}{"db", "monitored"},
+		}},
+		{"workstation", map[string]interface{}{
+			"ntp_server": "time.example.com", "role": "desktop",
+			"inventory_hostname": "workstation", "group_names": []interface{}{},
+		}},
+	}
+	for _, tt := range tests {
+		if got := inv.Variables(byName[tt.host]); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Variables(%s) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
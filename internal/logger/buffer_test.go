@@ -64,6 +64,28 @@ func TestTUIBuffer_SetCurrentStep_Updates(t *testing.T) {
 	}
 }
 
+// TestTUIBuffer_RunningSteps tests tracking of steps running in parallel
+func TestTUIBuffer_RunningSteps(t *testing.T) {
+	buffer := NewTUIBuffer(3)
+
+	buffer.StartStep("step-0001", "Download go")
+	buffer.StartStep("step-0002", "Download node")
+	buffer.StartStep("step-0003", "Install fzf")
+	buffer.FinishStep("step-0002")
+	buffer.FinishStep("step-9999") // unknown IDs are ignored
+
+	snapshot := buffer.GetSnapshot()
+	want := []RunningStep{{ID: "step-0001", Name: "Download go"}, {ID: "step-0003", Name: "Install fzf"}}
+	if len(snapshot.RunningSteps) != len(want) {
+		t.Fatalf("RunningSteps = %v, want %v", snapshot.RunningSteps, want)
+	}
+	for i := range want {
+		if snapshot.RunningSteps[i] != want[i] {
+			t.Errorf("RunningSteps[%d] = %v, want %v", i, snapshot.RunningSteps[i], want[i])
+		}
+	}
+}
+
 // TestTUIBuffer_Completion tests completion stats
 func TestTUIBuffer_Completion(t *testing.T) {
 	buffer := NewTUIBuffer(2)
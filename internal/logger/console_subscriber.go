@@ -18,7 +18,10 @@ type ConsoleSubscriber struct {
 	redactor  interface {
 		Redact(string) string
 	}
-	mu sync.Mutex
+	running map[string]bool // Top-level steps started and not finished yet
+	host    string          // Host label of the output (see SetHost)
+	midLine bool            // The last output didn't end with a newline
+	mu      sync.Mutex
 }
 
 // NewConsoleSubscriber creates a new console subscriber
@@ -26,6 +29,7 @@ func NewConsoleSubscriber(logLevel int, logFormat string) *ConsoleSubscriber {
 	return &ConsoleSubscriber{
 		logLevel:  logLevel,
 		logFormat: logFormat,
+		running:   make(map[string]bool),
 	}
 }
 
@@ -36,6 +40,14 @@ func (c *ConsoleSubscriber) SetRedactor(r interface{ Redact(string) string }) {
 	c.redactor = r
 }
 
+// SetHost labels the output with a host name, for runs on several hosts: text
+// lines are prefixed with "[host] " and JSON events get a "host" field.
+func (c *ConsoleSubscriber) SetHost(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.host = host
+}
+
 // OnEvent handles incoming events
 func (c *ConsoleSubscriber) OnEvent(event events.Event) {
 	c.mu.Lock()
@@ -56,7 +68,14 @@ func (c *ConsoleSubscriber) Close() {
 
 // renderJSON outputs the event as JSON
 func (c *ConsoleSubscriber) renderJSON(event events.Event) {
-	if err := json.NewEncoder(os.Stdout).Encode(event); err != nil {
+	var value interface{} = event
+	if c.host != "" {
+		value = struct {
+			Host string `json:"host"`
+			events.Event
+		}{c.host, event}
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(value); err != nil {
 		fmt.Fprintf(os.Stderr, "Error encoding event to JSON: %v\n", err)
 	}
 }
@@ -84,6 +103,21 @@ func (c *ConsoleSubscriber) renderText(event events.Event) {
 			c.renderStepSkipped(data)
 		}
 
+	case events.EventStepRetry:
+		if data, ok := event.Data.(events.StepRetryData); ok {
+			c.renderStepRetry(data)
+		}
+
+	case events.EventBlockRescued:
+		if data, ok := event.Data.(events.BlockRescuedData); ok {
+			c.renderBlockRescued(data)
+		}
+
+	case events.EventStepDiff:
+		if data, ok := event.Data.(events.StepDiffData); ok {
+			c.renderStepDiff(data)
+		}
+
 	case events.EventRunCompleted:
 		if data, ok := event.Data.(events.RunCompletedData); ok {
 			c.renderRunCompleted(data)
@@ -111,11 +145,22 @@ func (c *ConsoleSubscriber) renderStepStarted(data events.StepStartedData) {
 	// Calculate indentation: base level + directory depth
 	indent := strings.Repeat("  ", data.Level+data.Depth)
 	icon := color.CyanString("▶")
-	fmt.Printf("%s%s %s\n", indent, icon, data.Name)
+
+	// Top-level steps only overlap in parallel runs; show how many are running
+	hint := ""
+	if data.Level == 0 {
+		c.running[data.StepID] = true
+		if len(c.running) > 1 {
+			hint = color.New(color.Faint).Sprintf(" (%d running)", len(c.running))
+		}
+	}
+	c.printf("%s%s %s%s\n", indent, icon, data.Name, hint)
 }
 
 // renderStepCompleted renders a step.completed event
 func (c *ConsoleSubscriber) renderStepCompleted(data events.StepCompletedData) {
+	delete(c.running, data.StepID)
+
 	// Check if this is a directory (ends with /)
 	if strings.HasSuffix(data.Name, "/") {
 		// Don't show completed event for directories
@@ -124,18 +169,59 @@ func (c *ConsoleSubscriber) renderStepCompleted(data events.StepCompletedData) {
 
 	indent := strings.Repeat("  ", data.Level+data.Depth)
 	icon := color.GreenString("✓")
-	fmt.Printf("%s%s %s\n", indent, icon, data.Name)
+	c.printf("%s%s %s\n", indent, icon, data.Name)
 }
 
 // renderStepFailed renders a step.failed event
 func (c *ConsoleSubscriber) renderStepFailed(data events.StepFailedData) {
+	delete(c.running, data.StepID)
+
 	indent := strings.Repeat("  ", data.Level+data.Depth)
+	errorIndent := indent + "  "
+
+	if data.Ignored {
+		c.printf("%s%s %s (ignored)\n", indent, color.YellowString("✗"), data.Name)
+		c.printf("%s%s\n", errorIndent, color.YellowString(data.ErrorMessage))
+		return
+	}
+
 	icon := color.RedString("✗")
-	fmt.Printf("%s%s %s\n", indent, icon, data.Name)
+	c.printf("%s%s %s\n", indent, icon, data.Name)
 
 	// Show error message indented
-	errorIndent := indent + "  "
-	fmt.Printf("%s%s\n", errorIndent, color.RedString(data.ErrorMessage))
+	c.printf("%s%s\n", errorIndent, color.RedString(data.ErrorMessage))
+}
+
+// renderStepRetry renders a step.retry event
+func (c *ConsoleSubscriber) renderStepRetry(data events.StepRetryData) {
+	indent := strings.Repeat("  ", data.Level+1)
+	icon := color.YellowString("↻")
+	c.printf("%s%s retrying %s (attempt %d/%d): %s\n", indent, icon, data.Name, data.Attempt, data.MaxAttempts, data.ErrorMessage)
+}
+
+// renderBlockRescued renders a block.rescued event
+func (c *ConsoleSubscriber) renderBlockRescued(data events.BlockRescuedData) {
+	indent := strings.Repeat("  ", data.Level+1)
+	icon := color.YellowString("↺")
+	c.printf("%s%s rescued failure in %s\n", indent, icon, data.FailedStepName)
+}
+
+// renderStepDiff renders a step.diff event as a colored unified diff
+func (c *ConsoleSubscriber) renderStepDiff(data events.StepDiffData) {
+	indent := strings.Repeat("  ", data.Level+1)
+	for _, line := range strings.Split(strings.TrimSuffix(data.Diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			line = color.New(color.Bold).Sprint(line)
+		case strings.HasPrefix(line, "@@"):
+			line = color.CyanString(line)
+		case strings.HasPrefix(line, "+"):
+			line = color.GreenString(line)
+		case strings.HasPrefix(line, "-"):
+			line = color.RedString(line)
+		}
+		c.printf("%s%s\n", indent, line)
+	}
 }
 
 // renderStepSkipped renders a step.skipped event
@@ -154,7 +240,7 @@ func (c *ConsoleSubscriber) renderStepSkipped(data events.StepSkippedData) {
 		// For subdirectories (after/, ftplugin/), show as headers
 		// Show directory as a header without icon
 		indent := strings.Repeat("  ", data.Level)
-		fmt.Printf("%s%s\n", indent, color.New(color.Faint).Sprint(data.Name))
+		c.printf("%s%s\n", indent, color.New(color.Faint).Sprint(data.Name))
 		return
 	}
 
@@ -165,39 +251,89 @@ func (c *ConsoleSubscriber) renderStepSkipped(data events.StepSkippedData) {
 	if data.Reason != "" {
 		reasonText = color.New(color.Faint).Sprintf(" (%s)", data.Reason)
 	}
-	fmt.Printf("%s%s %s%s\n", indent, icon, data.Name, reasonText)
+	c.printf("%s%s %s%s\n", indent, icon, data.Name, reasonText)
 }
 
 // renderRunCompleted renders a run.completed event with summary statistics
 func (c *ConsoleSubscriber) renderRunCompleted(data events.RunCompletedData) {
-	fmt.Println()
-	fmt.Println(strings.Repeat("─", 50))
+	c.printf("\n")
+	c.printf("%s\n", strings.Repeat("─", 50))
 
 	if data.Success {
-		fmt.Println(color.GreenString("✓ Execution completed successfully"))
+		c.printf("%s\n", color.GreenString("✓ Execution completed successfully"))
 	} else {
-		fmt.Println(color.RedString("✗ Execution failed"))
+		c.printf("%s\n", color.RedString("✗ Execution failed"))
 		if data.ErrorMessage != "" {
-			fmt.Printf("  Error: %s\n", data.ErrorMessage)
+			c.printf("  Error: %s\n", data.ErrorMessage)
 		}
 	}
 
-	fmt.Println()
-	fmt.Printf("  Duration: %dms\n", data.DurationMs)
-	fmt.Printf("  Total steps: %d\n", data.TotalSteps)
+	c.printf("\n")
+	c.printf("  Duration: %dms\n", data.DurationMs)
+	c.printf("  Total steps: %d\n", data.TotalSteps)
 
 	if data.SuccessSteps > 0 {
-		fmt.Printf("  %s Successful: %d\n", color.GreenString("✓"), data.SuccessSteps)
+		c.printf("  %s Successful: %d\n", color.GreenString("✓"), data.SuccessSteps)
 	}
 	if data.FailedSteps > 0 {
-		fmt.Printf("  %s Failed: %d\n", color.RedString("✗"), data.FailedSteps)
+		c.printf("  %s Failed: %d\n", color.RedString("✗"), data.FailedSteps)
 	}
 	if data.SkippedSteps > 0 {
-		fmt.Printf("  %s Skipped: %d\n", color.YellowString("⊘"), data.SkippedSteps)
+		c.printf("  %s Skipped: %d\n", color.YellowString("⊘"), data.SkippedSteps)
+	}
+	if data.RescuedSteps > 0 {
+		c.printf("  %s Rescued: %d\n", color.YellowString("↺"), data.RescuedSteps)
+	}
+	if data.IgnoredSteps > 0 {
+		c.printf("  %s Ignored failures: %d\n", color.YellowString("✗"), data.IgnoredSteps)
+	}
+	if data.DryRun {
+		// Predicted by the handlers' checks (see actions.Checker)
+		c.printf("  Plan: %d to change, %d unchanged", data.ChangedSteps, data.UnchangedSteps)
+		if data.UncheckedSteps > 0 {
+			c.printf(", %d not checked", data.UncheckedSteps)
+		}
+		c.printf("\n")
+	} else if data.ChangedSteps > 0 {
+		c.printf("  Changed: %d\n", data.ChangedSteps)
 	}
-	if data.ChangedSteps > 0 {
-		fmt.Printf("  Changed: %d\n", data.ChangedSteps)
+	if data.DroppedEvents > 0 {
+		c.printf("  %s Dropped output events: %d\n", color.YellowString("!"), data.DroppedEvents)
 	}
 
-	fmt.Println(strings.Repeat("─", 50))
+	if len(data.Failures) > 0 {
+		c.printf("\n")
+		c.printf("%s\n", "  Failures:")
+		for _, failure := range data.Failures {
+			note := ""
+			if failure.Ignored {
+				note = " (ignored)"
+			}
+			c.printf("    - %s [%s]%s: %s\n", failure.Name, failure.StepID, note, failure.ErrorMessage)
+		}
+	}
+
+	c.printf("%s\n", strings.Repeat("─", 50))
+}
+
+// printf prints formatted text, prefixing each line with the host label if set.
+func (c *ConsoleSubscriber) printf(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	if c.host == "" {
+		fmt.Print(text)
+		return
+	}
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		if !c.midLine {
+			b.WriteString(color.New(color.Faint).Sprintf("[%s] ", c.host))
+		}
+		b.WriteString(line)
+		c.midLine = !strings.HasSuffix(line, "\n")
+	}
+	fmt.Print(b.String())
 }
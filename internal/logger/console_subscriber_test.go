@@ -302,6 +302,70 @@ func TestConsoleSubscriber_OnEvent_Text_StepFailed(t *testing.T) {
 	}
 }
 
+func TestConsoleSubscriber_OnEvent_Text_StepRetry(t *testing.T) {
+	sub := NewConsoleSubscriber(1, "text")
+
+	event := events.Event{
+		Type:      events.EventStepRetry,
+		Timestamp: time.Now(),
+		Data: events.StepRetryData{
+			StepID:       "step-1",
+			Name:         "Wait for API",
+			Attempt:      2,
+			MaxAttempts:  4,
+			ErrorMessage: "connection refused",
+		},
+	}
+
+	output := captureStdout(func() {
+		sub.OnEvent(event)
+	})
+
+	for _, want := range []string{"↻", "Wait for API", "attempt 2/4", "connection refused"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output does not contain %q\nGot: %s", want, output)
+		}
+	}
+}
+
+func TestConsoleSubscriber_OnEvent_Text_ParallelSteps(t *testing.T) {
+	sub := NewConsoleSubscriber(1, "text")
+
+	started := func(id, name string, level int) events.Event {
+		return events.Event{
+			Type:      events.EventStepStarted,
+			Timestamp: time.Now(),
+			Data:      events.StepStartedData{StepID: id, Name: name, Level: level},
+		}
+	}
+
+	output := captureStdout(func() {
+		sub.OnEvent(started("step-0001", "Download go", 0))
+		sub.OnEvent(started("step-0002", "Download node", 0))
+		sub.OnEvent(events.Event{
+			Type:      events.EventStepCompleted,
+			Timestamp: time.Now(),
+			Data:      events.StepCompletedData{StepID: "step-0001", Name: "Download go"},
+		})
+		// Nested steps are not counted
+		sub.OnEvent(started("step-0003", "Unpack node", 1))
+	})
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %d\nGot: %s", len(lines), output)
+	}
+	if strings.Contains(lines[0], "running") {
+		t.Errorf("first step should not show a running count\nGot: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "(2 running)") {
+		t.Errorf("second step should show 2 running steps\nGot: %s", lines[1])
+	}
+	if strings.Contains(lines[3], "running") {
+		t.Errorf("nested step should not show a running count\nGot: %s", lines[3])
+	}
+}
+
 func TestConsoleSubscriber_OnEvent_Text_StepSkipped(t *testing.T) {
 	sub := NewConsoleSubscriber(1, "text")
 
@@ -461,6 +525,34 @@ func TestConsoleSubscriber_OnEvent_Text_RunCompleted(t *testing.T) {
 				"Total steps: 3",
 				"Successful: 3",
 			},
+		},		{
+			name: "dry run",
+			data: events.RunCompletedData{
+				TotalSteps:     6,
+				SuccessSteps:   6,
+				ChangedSteps:   2,
+				UnchangedSteps: 3,
+				UncheckedSteps: 1,
+				DurationMs:     10,
+				Success:        true,
+				DryRun:         true,
+			},
+			wantOutput: []string{
+				"Execution completed successfully",
+				"Plan: 2 to change, 3 unchanged, 1 not checked",
+			},
+		},
+		{
+			name: "dropped events",
+			data: events.RunCompletedData{
+				TotalSteps:    1,
+				SuccessSteps:  1,
+				Success:       true,
+				DroppedEvents: 42,
+			},
+			wantOutput: []string{
+				"Dropped output events: 42",
+			},
 		},
 	}
 
@@ -490,6 +582,31 @@ func TestConsoleSubscriber_OnEvent_Text_RunCompleted(t *testing.T) {
 	}
 }
 
+func TestConsoleSubscriber_OnEvent_Text_StepDiff(t *testing.T) {
+	sub := NewConsoleSubscriber(1, "text")
+
+	event := events.Event{
+		Type:      events.EventStepDiff,
+		Timestamp: time.Now(),
+		Data: events.StepDiffData{
+			StepID: "step-0001",
+			Name:   "write config",
+			Level:  0,
+			Diff:   "--- /etc/app.conf\n+++ /etc/app.conf\n@@ -1 +1 @@\n-port=80\n+port=8080\n",
+			DryRun: true,
+		},
+	}
+
+	output := captureStdout(func() {
+		sub.OnEvent(event)
+	})
+
+	want := "  --- /etc/app.conf\n  +++ /etc/app.conf\n  @@ -1 +1 @@\n  -port=80\n  +port=8080\n"
+	if output != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+}
+
 func TestConsoleSubscriber_OnEvent_Text_OutputEvents(t *testing.T) {
 	sub := NewConsoleSubscriber(1, "text")
 
@@ -659,3 +776,50 @@ func TestConsoleSubscriber_InvalidEventData(t *testing.T) {
 		})
 	}
 }
+
+func TestConsoleSubscriber_SetHost(t *testing.T) {
+	event := events.Event{
+		Type:      events.EventRunCompleted,
+		Timestamp: time.Now(),
+		Data: events.RunCompletedData{
+			TotalSteps:   2,
+			SuccessSteps: 2,
+			Success:      true,
+		},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		sub := NewConsoleSubscriber(1, "text")
+		sub.SetHost("web1")
+
+		output := captureStdout(func() {
+			sub.OnEvent(event)
+		})
+
+		for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+			if !strings.Contains(line, "[web1] ") {
+				t.Errorf("line %q is not labeled with the host", line)
+			}
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		sub := NewConsoleSubscriber(1, "json")
+		sub.SetHost("web1")
+
+		output := captureStdout(func() {
+			sub.OnEvent(event)
+		})
+
+		var decoded struct {
+			Host string           `json:"host"`
+			Type events.EventType `json:"type"`
+		}
+		if err := json.Unmarshal([]byte(output), &decoded); err != nil {
+			t.Fatalf("output is not valid JSON: %v\nOutput: %s", err, output)
+		}
+		if decoded.Host != "web1" || decoded.Type != events.EventRunCompleted {
+			t.Errorf("decoded = %+v, want host web1 and type %s", decoded, events.EventRunCompleted)
+		}
+	})
+}
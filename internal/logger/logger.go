@@ -54,6 +54,7 @@ type ExecutionStats struct {
 	Executed int
 	Skipped  int
 	Failed   int
+	Dropped  int // Output events dropped by subscribers that fell behind
 }
 
 // Redactor interface for redacting sensitive data in logs.
@@ -126,6 +126,8 @@ func (t *TestLogger) redact(text string) string {
 
 // WithPadLevel creates a new logger with the specified padding level.
 func (t *TestLogger) WithPadLevel(padLevel int) Logger {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return &TestLogger{
 		Logs:     t.Logs, // Share the same log slice
 		logLevel: t.logLevel,
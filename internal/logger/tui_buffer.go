@@ -19,10 +19,17 @@ type ProgressInfo struct {
 	Total   int
 }
 
+// RunningStep is a step that has started and not finished yet.
+type RunningStep struct {
+	ID   string
+	Name string
+}
+
 // BufferSnapshot is an atomic snapshot of the buffer state for rendering.
 type BufferSnapshot struct {
 	StepHistory   []StepEntry
 	CurrentStep   string
+	RunningSteps  []RunningStep // In start order; several when steps run in parallel
 	Progress      ProgressInfo
 	DebugMessages []string
 	ErrorMessages []string
@@ -36,8 +43,9 @@ type TUIBuffer struct {
 	historyStart  int // Start index for circular buffer
 	historyCount  int // Number of items in buffer
 
-	currentStep string
-	progress    ProgressInfo
+	currentStep  string
+	runningSteps []RunningStep
+	progress     ProgressInfo
 
 	debugMessages []string
 	errorMessages []string
@@ -86,6 +94,27 @@ func (b *TUIBuffer) SetCurrentStep(name string, progress ProgressInfo) {
 	b.progress = progress
 }
 
+// StartStep adds a step to the running steps.
+func (b *TUIBuffer) StartStep(id, name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.runningSteps = append(b.runningSteps, RunningStep{ID: id, Name: name})
+}
+
+// FinishStep removes a step from the running steps.
+func (b *TUIBuffer) FinishStep(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, step := range b.runningSteps {
+		if step.ID == id {
+			b.runningSteps = append(b.runningSteps[:i], b.runningSteps[i+1:]...)
+			return
+		}
+	}
+}
+
 // SetCompletion sets execution completion statistics.
 func (b *TUIBuffer) SetCompletion(stats ExecutionStats) {
 	b.mu.Lock()
@@ -137,9 +166,13 @@ func (b *TUIBuffer) GetSnapshot() BufferSnapshot {
 	errors := make([]string, len(b.errorMessages))
 	copy(errors, b.errorMessages)
 
+	running := make([]RunningStep, len(b.runningSteps))
+	copy(running, b.runningSteps)
+
 	return BufferSnapshot{
 		StepHistory:   history,
 		CurrentStep:   b.currentStep,
+		RunningSteps:  running,
 		Progress:      b.progress,
 		DebugMessages: debug,
 		ErrorMessages: errors,
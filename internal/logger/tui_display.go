@@ -102,8 +102,15 @@ func (d *TUIDisplay) renderSeparator() string {
 func (d *TUIDisplay) renderCurrentStep(snapshot BufferSnapshot) string {
 	var output strings.Builder
 
-	// Current step
-	if snapshot.CurrentStep != "" {
+	// Steps running in parallel are listed together
+	if len(snapshot.RunningSteps) > 1 {
+		output.WriteString(fmt.Sprintf("Running (%d):\n", len(snapshot.RunningSteps)))
+		for _, step := range snapshot.RunningSteps {
+			line := fmt.Sprintf("  %s %s", d.getStatusIndicator(StatusRunning), step.Name)
+			output.WriteString(d.truncate(line, d.width))
+			output.WriteString("\n")
+		}
+	} else if snapshot.CurrentStep != "" {
 		currentLine := fmt.Sprintf("Current: %s", snapshot.CurrentStep)
 		output.WriteString(d.truncate(currentLine, d.width))
 		output.WriteString("\n")
@@ -240,6 +247,9 @@ func (d *TUIDisplay) renderCompletion(stats *ExecutionStats) string {
 	if stats.Failed > 0 {
 		output.WriteString(fmt.Sprintf("  Failed:   %s\n", color.RedString("%d", stats.Failed)))
 	}
+	if stats.Dropped > 0 {
+		output.WriteString(fmt.Sprintf("  Dropped output events: %s\n", color.YellowString("%d", stats.Dropped)))
+	}
 	output.WriteString("\n")
 	output.WriteString(fmt.Sprintf("  Duration: %s\n", color.CyanString("%v", stats.Duration.Round(10*time.Millisecond))))
 
@@ -149,6 +149,32 @@ func TestTUIDisplay_RenderCurrentStep(t *testing.T) {
 	}
 }
 
+func TestTUIDisplay_RenderCurrentStep_Parallel(t *testing.T) {
+	animator, _ := LoadEmbeddedFrames()
+	buffer := NewTUIBuffer(10)
+	display := NewTUIDisplay(animator, buffer, 80, 24)
+
+	buffer.SetCurrentStep("Download node", ProgressInfo{Current: 2})
+	buffer.StartStep("step-0001", "Download go")
+	buffer.StartStep("step-0002", "Download node")
+
+	output := display.renderCurrentStep(buffer.GetSnapshot())
+	for _, want := range []string{"Running (2):", "Download go", "Download node"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("renderCurrentStep() should contain %q\nGot: %s", want, output)
+		}
+	}
+	if strings.Contains(output, "Current:") {
+		t.Errorf("renderCurrentStep() should list running steps instead of the current one\nGot: %s", output)
+	}
+
+	buffer.FinishStep("step-0001")
+	output = display.renderCurrentStep(buffer.GetSnapshot())
+	if !strings.Contains(output, "Current: Download node") {
+		t.Errorf("renderCurrentStep() should show the current step once one step runs\nGot: %s", output)
+	}
+}
+
 func TestTUIDisplay_RenderProgressBar(t *testing.T) {
 	animator, _ := LoadEmbeddedFrames()
 	buffer := NewTUIBuffer(10)
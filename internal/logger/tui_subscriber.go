@@ -164,6 +164,7 @@ func (t *TUISubscriber) handleStepStarted(data events.StepStartedData) {
 	t.buffer.SetCurrentStep(data.Name, ProgressInfo{
 		Current: data.GlobalStep,
 	})
+	t.buffer.StartStep(data.StepID, data.Name)
 }
 
 // handleStepCompleted processes step.completed events.
@@ -172,6 +173,8 @@ func (t *TUISubscriber) handleStepCompleted(data events.StepCompletedData) {
 		return
 	}
 
+	t.buffer.FinishStep(data.StepID)
+
 	// Add to history as success
 	t.buffer.AddStep(StepEntry{
 		Name:   data.Name,
@@ -189,6 +192,8 @@ func (t *TUISubscriber) handleStepFailed(data events.StepFailedData) {
 		return
 	}
 
+	t.buffer.FinishStep(data.StepID)
+
 	// Add to history as error
 	t.buffer.AddStep(StepEntry{
 		Name:   data.Name,
@@ -224,5 +229,6 @@ func (t *TUISubscriber) handleRunCompleted(data events.RunCompletedData) {
 		Executed: data.SuccessSteps,
 		Skipped:  data.SkippedSteps,
 		Failed:   data.FailedSteps,
+		Dropped:  data.DroppedEvents,
 	})
 }
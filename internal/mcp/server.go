@@ -0,0 +1,300 @@
+// Package mcp serves mooncake to AI agents over the Model Context Protocol: a
+// JSON-RPC 2.0 server on stdio, with newline-delimited messages, exposing facts,
+// actions, schema, validate, plan, run and artifacts as tools.
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/logger"
+	"github.com/alehatsman/mooncake/internal/version"
+)
+
+// ProtocolVersion is the latest MCP version the server speaks. Clients asking
+// for one of the earlier supported versions get that version.
+const ProtocolVersion = "2025-06-18"
+
+var supportedVersions = []string{ProtocolVersion, "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Options configures a Server.
+type Options struct {
+	// AllowRun allows the run tool to apply configs. Without it, only dry runs
+	// are allowed.
+	AllowRun bool
+
+	// ArtifactsDir is where runs save their artifacts, read back by the
+	// artifacts tool (default: artifacts.DefaultBaseDir).
+	ArtifactsDir string
+
+	// SudoPassFile is the sudo password file of runs with become steps.
+	SudoPassFile string
+
+	// Log receives the logs of plans and runs. It must not write to the
+	// protocol's output. Nil discards them.
+	Log logger.Logger
+}
+
+// Server is an MCP server. Requests are handled concurrently, except tool
+// calls, which run one at a time: config loading shares template state, and
+// runs change the system.
+type Server struct {
+	opts Options
+
+	writeMu sync.Mutex
+	out     *bufio.Writer
+
+	mu       sync.Mutex
+	inFlight map[string]context.CancelFunc // Cancels the requests being handled, by ID
+
+	toolMu sync.Mutex
+}
+
+// request is a JSON-RPC request, or a notification if it has no ID.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// NewServer returns a server with the given options.
+func NewServer(opts Options) *Server {
+	if opts.ArtifactsDir == "" {
+		opts.ArtifactsDir = artifacts.DefaultBaseDir
+	}
+	if opts.Log == nil {
+		opts.Log = logger.NewTestLogger()
+	}
+	return &Server{opts: opts, inFlight: make(map[string]context.CancelFunc)}
+}
+
+// Serve reads requests from in and writes responses and notifications to out
+// until in is closed or ctx is done. Requests still being handled when in is
+// closed are completed; those running when ctx is done are cancelled.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = bufio.NewWriter(out)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				select {
+				case lines <- line:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case line := <-lines:
+			var req request
+			if err := json.Unmarshal(line, &req); err != nil {
+				s.reply(json.RawMessage("null"), nil, &rpcError{Code: codeParseError, Message: "parse error: " + err.Error()})
+				continue
+			}
+			if req.JSONRPC != "2.0" || req.Method == "" {
+				s.reply(idOrNull(req.ID), nil, &rpcError{Code: codeInvalidRequest, Message: "invalid request"})
+				continue
+			}
+			if len(req.ID) == 0 {
+				s.handleNotification(req)
+				continue
+			}
+
+			reqCtx, reqCancel := context.WithCancel(ctx)
+			s.mu.Lock()
+			s.inFlight[string(req.ID)] = reqCancel
+			s.mu.Unlock()
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					s.mu.Lock()
+					delete(s.inFlight, string(req.ID))
+					s.mu.Unlock()
+					reqCancel()
+				}()
+				result, err := s.handle(reqCtx, req)
+				var rpcErr *rpcError
+				if err != nil && !errors.As(err, &rpcErr) {
+					rpcErr = &rpcError{Code: codeInvalidParams, Message: err.Error()}
+				}
+				s.reply(req.ID, result, rpcErr)
+			}()
+		}
+	}
+}
+
+// handleNotification handles a message without ID, which gets no response.
+func (s *Server) handleNotification(req request) {
+	if req.Method != "notifications/cancelled" {
+		return
+	}
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return
+	}
+	s.mu.Lock()
+	if cancel, ok := s.inFlight[string(params.RequestID)]; ok {
+		cancel()
+	}
+	s.mu.Unlock()
+}
+
+// handle returns the result of a request.
+func (s *Server) handle(ctx context.Context, req request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		protocolVersion := ProtocolVersion
+		for _, v := range supportedVersions {
+			if v == params.ProtocolVersion {
+				protocolVersion = v
+			}
+		}
+		return map[string]interface{}{
+			"protocolVersion": protocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]string{"name": "mooncake", "version": version.Version},
+			"instructions": "Mooncake applies YAML configs to the system. Validate and plan configs before running them; " +
+				"runs are dry runs unless dry_run is false and the server allows real runs.",
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": tools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+			Meta      struct {
+				ProgressToken json.RawMessage `json:"progressToken"`
+			} `json:"_meta"`
+		}
+		if err := unmarshalParams(req.Params, &params); err != nil {
+			return nil, err
+		}
+		t := findTool(params.Name)
+		if t == nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown tool: %s", params.Name)}
+		}
+		var progress *progressNotifier
+		if len(params.Meta.ProgressToken) > 0 {
+			progress = &progressNotifier{server: s, token: params.Meta.ProgressToken}
+		}
+		s.toolMu.Lock()
+		defer s.toolMu.Unlock()
+		return s.callTool(ctx, t, params.Arguments, progress), nil
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+	}
+}
+
+// unmarshalParams decodes the params of a request, which may be omitted.
+func unmarshalParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: "invalid params: " + err.Error()}
+	}
+	return nil
+}
+
+func idOrNull(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+func (s *Server) reply(id json.RawMessage, result interface{}, rpcErr *rpcError) {
+	resp := response{JSONRPC: "2.0", ID: id, Result: result}
+	if rpcErr != nil {
+		resp.Result, resp.Error = nil, rpcErr
+	}
+	s.write(resp)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// write sends a message on one line.
+func (s *Server) write(message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		s.opts.Log.Errorf("Failed to encode MCP message: %v", err)
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, _ = s.out.Write(append(data, '\n'))
+	_ = s.out.Flush()
+}
@@ -0,0 +1,391 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	_ "github.com/alehatsman/mooncake/internal/register" // Register action handlers
+)
+
+// message is a response or notification written by the server.
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// serve sends requests to a server, one per line, and returns the responses by
+// ID and the notifications in order.
+func serve(t *testing.T, opts Options, requests ...string) (map[string]message, []message) {
+	t.Helper()
+	var out bytes.Buffer
+	in := strings.NewReader(strings.Join(requests, "\n") + "\n")
+	if err := NewServer(opts).Serve(context.Background(), in, &out); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	responses := make(map[string]message)
+	var notifications []message
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("invalid message %q: %v", line, err)
+		}
+		if msg.Method != "" {
+			notifications = append(notifications, msg)
+		} else {
+			responses[string(msg.ID)] = msg
+		}
+	}
+	return responses, notifications
+}
+
+// toolCall returns a tools/call request.
+func toolCall(id int, name string, args interface{}) string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0", "id": id, "method": "tools/call",
+		"params": map[string]interface{}{"name": name, "arguments": args},
+	})
+	return string(data)
+}
+
+// toolResult is the result of a tools/call request.
+type toolResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent"`
+	IsError           bool            `json:"isError"`
+}
+
+func decodeToolResult(t *testing.T, msg message, structured interface{}) toolResult {
+	t.Helper()
+	if msg.Error != nil {
+		t.Fatalf("tools/call error = %v", msg.Error)
+	}
+	var result toolResult
+	if err := json.Unmarshal(msg.Result, &result); err != nil {
+		t.Fatalf("invalid tool result %s: %v", msg.Result, err)
+	}
+	if structured != nil && len(result.StructuredContent) > 0 {
+		if err := json.Unmarshal(result.StructuredContent, structured); err != nil {
+			t.Fatalf("invalid structured content %s: %v", result.StructuredContent, err)
+		}
+	}
+	return result
+}
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServe_Protocol(t *testing.T) {
+	responses, _ := serve(t, Options{},
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"initialize","params":{"protocolVersion":"1999-01-01"}}`,
+		`{"jsonrpc":"2.0","id":"ping","method":"ping"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"resources/list"}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"nope"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"tools/call","params":"nope"}`,
+		`{"id":7,"method":"ping"}`,
+		`not json`,
+	)
+
+	var initResult struct {
+		ProtocolVersion string            `json:"protocolVersion"`
+		ServerInfo      map[string]string `json:"serverInfo"`
+	}
+	for id, want := range map[string]string{"1": "2024-11-05", "2": ProtocolVersion} {
+		if err := json.Unmarshal(responses[id].Result, &initResult); err != nil {
+			t.Fatal(err)
+		}
+		if initResult.ProtocolVersion != want || initResult.ServerInfo["name"] != "mooncake" {
+			t.Errorf("initialize %s = %+v, want version %s", id, initResult, want)
+		}
+	}
+	if string(responses[`"ping"`].Result) != "{}" {
+		t.Errorf("ping result = %s", responses[`"ping"`].Result)
+	}
+
+	var list struct {
+		Tools []struct {
+			Name        string                 `json:"name"`
+			InputSchema map[string]interface{} `json:"inputSchema"`
+		} `json:"tools"`
+	}
+	if err := json.Unmarshal(responses["3"].Result, &list); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range list.Tools {
+		names = append(names, tool.Name)
+		if tool.InputSchema["type"] != "object" {
+			t.Errorf("tool %s input schema = %v", tool.Name, tool.InputSchema)
+		}
+	}
+	if got := strings.Join(names, ","); got != "facts,actions_list,schema,validate,plan,run,artifacts" {
+		t.Errorf("tools = %s", got)
+	}
+
+	for id, code := range map[string]int{"4": codeMethodNotFound, "5": codeInvalidParams, "6": codeInvalidParams, "7": codeInvalidRequest, "null": codeParseError} {
+		if responses[id].Error == nil || responses[id].Error.Code != code {
+			t.Errorf("response %s error = %+v, want code %d", id, responses[id].Error, code)
+		}
+	}
+	if len(responses) != 9 {
+		t.Errorf("got %d responses, want 9 (none for notifications)", len(responses))
+	}
+}
+
+func TestServe_Cancel(t *testing.T) {
+	s := NewServer(Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	s.inFlight[`"slow"`] = cancel
+	s.handleNotification(request{JSONRPC: "2.0", Method: "notifications/cancelled", Params: json.RawMessage(`{"requestId":"slow"}`)})
+	if ctx.Err() == nil {
+		t.Error("notifications/cancelled didn't cancel the request")
+	}
+}
+
+func TestTools_Inspect(t *testing.T) {
+	responses, _ := serve(t, Options{},
+		toolCall(1, "facts", nil),
+		toolCall(2, "actions_list", map[string]interface{}{}),
+		toolCall(3, "schema", nil),
+		toolCall(4, "facts", map[string]interface{}{"unknown": true}),
+	)
+
+	var f struct {
+		OS string `json:"os"`
+	}
+	if result := decodeToolResult(t, responses["1"], &f); result.IsError || f.OS == "" {
+		t.Errorf("facts = %+v, %s", result, result.StructuredContent)
+	}
+
+	var list struct {
+		Actions []struct{ Name string } `json:"actions"`
+	}
+	decodeToolResult(t, responses["2"], &list)
+	if len(list.Actions) == 0 || list.Actions[0].Name > list.Actions[len(list.Actions)-1].Name {
+		t.Errorf("actions_list = %+v, want the actions sorted by name", list.Actions)
+	}
+
+	var schema map[string]interface{}
+	decodeToolResult(t, responses["3"], &schema)
+	if _, ok := schema["$schema"]; !ok {
+		t.Errorf("schema = %v, want a JSON Schema", schema)
+	}
+
+	// Inspecting tools take no arguments, and unknown arguments are errors
+	if result := decodeToolResult(t, responses["4"], nil); !result.IsError || !strings.Contains(result.Content[0].Text, "unknown field") {
+		t.Errorf("facts with unknown arguments = %+v", result)
+	}
+}
+
+func TestTools_ValidateAndPlan(t *testing.T) {
+	tmpDir := t.TempDir()
+	target := filepath.Join(tmpDir, "hello.txt")
+	configPath := writeConfig(t, tmpDir, `- name: hello
+  file:
+    path: `+target+`
+    content: "hello\n"
+`)
+	invalidPath := filepath.Join(tmpDir, "invalid.yml")
+	if err := os.WriteFile(invalidPath, []byte("- name: bad\n  shell: echo\n  print: hi\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	responses, _ := serve(t, Options{},
+		toolCall(1, "validate", map[string]interface{}{"config": configPath}),
+		toolCall(2, "validate", map[string]interface{}{"config": invalidPath}),
+		toolCall(3, "validate", map[string]interface{}{}),
+		toolCall(4, "plan", map[string]interface{}{"config": configPath}),
+		toolCall(5, "plan", map[string]interface{}{"config": configPath, "diff": true}),
+		toolCall(6, "plan", map[string]interface{}{"config": filepath.Join(tmpDir, "missing.yml")}),
+	)
+
+	var valid ValidateResult
+	if result := decodeToolResult(t, responses["1"], &valid); result.IsError || !valid.Valid {
+		t.Errorf("validate = %+v, %+v", result, valid)
+	}
+	var invalid ValidateResult
+	decodeToolResult(t, responses["2"], &invalid)
+	if invalid.Valid || len(invalid.Diagnostics) == 0 {
+		t.Errorf("validate invalid config = %+v, want diagnostics", invalid)
+	}
+	if result := decodeToolResult(t, responses["3"], nil); !result.IsError {
+		t.Errorf("validate without config = %+v, want an error", result)
+	}
+
+	var planned PlanResult
+	decodeToolResult(t, responses["4"], &planned)
+	if planned.Plan == nil || len(planned.Plan.Steps) != 1 || planned.Changes != nil {
+		t.Errorf("plan = %+v", planned)
+	}
+
+	var withDiff PlanResult
+	decodeToolResult(t, responses["5"], &withDiff)
+	if len(withDiff.Changes) != 1 || !strings.Contains(withDiff.Changes[0].Diff, "+hello") {
+		t.Errorf("plan changes = %+v, want the diff of hello.txt", withDiff.Changes)
+	}
+	if withDiff.Summary == nil || withDiff.Summary.ChangedSteps != 1 {
+		t.Errorf("plan summary = %+v", withDiff.Summary)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("plan with diff changed the system")
+	}
+
+	if result := decodeToolResult(t, responses["6"], nil); !result.IsError {
+		t.Errorf("plan of a missing config = %+v, want an error", result)
+	}
+}
+
+func TestTools_Run(t *testing.T) {
+	tmpDir := t.TempDir()
+	artifactsDir := filepath.Join(tmpDir, "artifacts")
+	target := filepath.Join(tmpDir, "hello.txt")
+	configPath := writeConfig(t, tmpDir, `- name: hello
+  file:
+    path: `+target+`
+    content: "hello\n"
+- name: greet
+  shell: echo hi
+`)
+	opts := Options{ArtifactsDir: artifactsDir}
+
+	// Dry run by default, with progress notifications
+	dryRun := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"run","arguments":{"config":"` + configPath + `","diff":true},"_meta":{"progressToken":"p1"}}}`
+	responses, notifications := serve(t, opts, dryRun, toolCall(2, "run", map[string]interface{}{"config": configPath, "dry_run": false}))
+
+	var run RunResult
+	if result := decodeToolResult(t, responses["1"], &run); result.IsError {
+		t.Fatalf("dry run = %+v", result)
+	}
+	if !run.DryRun || run.RunID == "" || run.Summary == nil || len(run.Changes) != 1 {
+		t.Errorf("dry run result = %+v", run)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("dry run changed the system")
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("got %d notifications, want one per step", len(notifications))
+	}
+	var progress struct {
+		ProgressToken string `json:"progressToken"`
+		Progress      int    `json:"progress"`
+		Message       string `json:"message"`
+	}
+	if err := json.Unmarshal(notifications[1].Params, &progress); err != nil {
+		t.Fatal(err)
+	}
+	if notifications[1].Method != "notifications/progress" || progress.ProgressToken != "p1" || progress.Progress != 2 || progress.Message != "greet: ok" {
+		t.Errorf("progress = %s %+v", notifications[1].Method, progress)
+	}
+
+	// Real runs must be allowed by the server
+	if result := decodeToolResult(t, responses["2"], nil); !result.IsError || !strings.Contains(result.Content[0].Text, "--allow-run") {
+		t.Errorf("real run without --allow-run = %+v", result)
+	}
+
+	opts.AllowRun = true
+	responses, _ = serve(t, opts, toolCall(1, "run", map[string]interface{}{"config": configPath, "dry_run": false}))
+	var applied RunResult
+	if result := decodeToolResult(t, responses["1"], &applied); result.IsError {
+		t.Fatalf("run = %+v", result)
+	}
+	if applied.DryRun || applied.Summary == nil || applied.Summary.ChangedSteps != 2 {
+		t.Errorf("run result = %+v", applied)
+	}
+	if content, err := os.ReadFile(target); err != nil || string(content) != "hello\n" {
+		t.Errorf("run didn't write the file: %q, %v", content, err)
+	}
+
+	// The artifacts of both runs can be read back
+	responses, _ = serve(t, opts,
+		toolCall(1, "artifacts", map[string]interface{}{}),
+		toolCall(2, "artifacts", map[string]interface{}{"run_id": applied.RunID}),
+		toolCall(3, "artifacts", map[string]interface{}{"run_id": applied.RunID, "file": "events.jsonl"}),
+		toolCall(4, "artifacts", map[string]interface{}{"run_id": applied.RunID, "file": "summary.json"}),
+		toolCall(5, "artifacts", map[string]interface{}{"run_id": applied.RunID, "file": "../../../config.yml"}),
+		toolCall(6, "artifacts", map[string]interface{}{"run_id": ".."}),
+		toolCall(7, "artifacts", map[string]interface{}{"run_id": "missing"}),
+	)
+
+	var runs struct {
+		Runs []artifacts.RunInfo `json:"runs"`
+	}
+	decodeToolResult(t, responses["1"], &runs)
+	if len(runs.Runs) != 2 || runs.Runs[0].Summary == nil {
+		t.Errorf("runs = %+v, want both runs with their summary", runs.Runs)
+	}
+
+	var files RunFiles
+	decodeToolResult(t, responses["2"], &files)
+	if files.Summary == nil || !files.Summary.Success || !strings.Contains(strings.Join(files.Files, ","), "results.json") {
+		t.Errorf("run files = %+v", files)
+	}
+
+	var eventsFile struct {
+		Content []struct {
+			Type string `json:"type"`
+		} `json:"content"`
+	}
+	decodeToolResult(t, responses["3"], &eventsFile)
+	if len(eventsFile.Content) == 0 || eventsFile.Content[0].Type != "run.started" {
+		t.Errorf("events = %+v", eventsFile.Content)
+	}
+
+	var summaryFile struct {
+		Content struct {
+			RunID string `json:"run_id"`
+		} `json:"content"`
+	}
+	decodeToolResult(t, responses["4"], &summaryFile)
+	if summaryFile.Content.RunID != applied.RunID {
+		t.Errorf("summary.json = %+v", summaryFile)
+	}
+
+	for _, id := range []string{"5", "6", "7"} {
+		if result := decodeToolResult(t, responses[id], nil); !result.IsError {
+			t.Errorf("artifacts request %s = %+v, want an error", id, result)
+		}
+	}
+}
+
+func TestTools_RunFailure(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := writeConfig(t, tmpDir, "- name: fail\n  shell: exit 3\n")
+
+	responses, _ := serve(t, Options{ArtifactsDir: filepath.Join(tmpDir, "artifacts"), AllowRun: true},
+		toolCall(1, "run", map[string]interface{}{"config": configPath, "dry_run": false}),
+		toolCall(2, "run", map[string]interface{}{"config": configPath, "timeout": "soon"}),
+	)
+
+	var run RunResult
+	result := decodeToolResult(t, responses["1"], &run)
+	if !result.IsError || run.Summary == nil || run.Summary.FailedSteps != 1 || run.Error == "" {
+		t.Errorf("failed run = %+v, %+v", result, run)
+	}
+	if !strings.Contains(run.ResumeCommand, "--resume "+run.RunID) {
+		t.Errorf("resume command = %q", run.ResumeCommand)
+	}
+	if result := decodeToolResult(t, responses["2"], nil); !result.IsError || !strings.Contains(result.Content[0].Text, "invalid timeout") {
+		t.Errorf("run with invalid timeout = %+v", result)
+	}
+}
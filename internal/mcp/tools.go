@@ -0,0 +1,536 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/actions"
+	"github.com/alehatsman/mooncake/internal/artifacts"
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/events"
+	"github.com/alehatsman/mooncake/internal/executor"
+	"github.com/alehatsman/mooncake/internal/facts"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/schemagen"
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+// tool is an MCP tool. Its result is returned as structured content, and as
+// JSON text for clients without structured content support.
+type tool struct {
+	Name        string                 `json:"name"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations toolAnnotations        `json:"annotations"`
+
+	call func(ctx context.Context, s *Server, args json.RawMessage, progress *progressNotifier) (interface{}, error)
+}
+
+type toolAnnotations struct {
+	ReadOnlyHint    bool `json:"readOnlyHint"`
+	DestructiveHint bool `json:"destructiveHint"`
+	IdempotentHint  bool `json:"idempotentHint"`
+	OpenWorldHint   bool `json:"openWorldHint"`
+}
+
+// readOnly is the annotations of the tools that don't change the system.
+var readOnly = toolAnnotations{ReadOnlyHint: true, IdempotentHint: true}
+
+// Input schema properties shared by tools.
+var (
+	configProperty = map[string]interface{}{"type": "string", "description": "Path to the configuration file"}
+	varsProperty   = map[string]interface{}{"type": "string", "description": "Path to a variables file"}
+	tagsProperty   = map[string]interface{}{
+		"type": "array", "items": map[string]interface{}{"type": "string"},
+		"description": "Only include steps with any of these tags",
+	}
+	diffProperty = map[string]interface{}{"type": "boolean", "description": "Include a unified diff of the predicted file changes"}
+)
+
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+var tools = []*tool{
+	{
+		Name:        "facts",
+		Title:       "System facts",
+		Description: "Facts of this host: OS, distribution, architecture, package manager, hardware, network and toolchains, as used in config templates and conditions.",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Annotations: readOnly,
+		call: func(_ context.Context, _ *Server, args json.RawMessage, _ *progressNotifier) (interface{}, error) {
+			if err := decodeArgs(args, &struct{}{}); err != nil {
+				return nil, err
+			}
+			return facts.Collect(), nil
+		},
+	},
+	{
+		Name:        "actions_list",
+		Title:       "List actions",
+		Description: "The actions config steps can use, with their category, platforms and capabilities.",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Annotations: readOnly,
+		call:        actionsListTool,
+	},
+	{
+		Name:        "schema",
+		Title:       "Config schema",
+		Description: "The JSON Schema of mooncake configuration files.",
+		InputSchema: objectSchema(map[string]interface{}{}),
+		Annotations: readOnly,
+		call:        schemaTool,
+	},
+	{
+		Name:        "validate",
+		Title:       "Validate a config",
+		Description: "Validate a configuration file without running it. Returns whether it is valid and its diagnostics.",
+		InputSchema: objectSchema(map[string]interface{}{"config": configProperty}, "config"),
+		Annotations: readOnly,
+		call:        validateTool,
+	},
+	{
+		Name:  "plan",
+		Title: "Plan a config",
+		Description: "Build the execution plan of a configuration file: the expanded steps with loops, includes and variables resolved. " +
+			"With diff, the plan is also dry-run to predict the changes a run would make.",
+		InputSchema: objectSchema(map[string]interface{}{
+			"config": configProperty,
+			"vars":   varsProperty,
+			"tags":   tagsProperty,
+			"diff":   diffProperty,
+		}, "config"),
+		Annotations: readOnly,
+		call:        planTool,
+	},
+	{
+		Name:  "run",
+		Title: "Run a config",
+		Description: "Run a configuration file, as a dry run unless dry_run is false. Real runs change the system and must be allowed " +
+			"by the server (mooncake mcp --allow-run). Returns the run summary and its run_id, whose artifacts the artifacts tool reads. " +
+			"Progress is reported as notifications when the call has a progress token.",
+		InputSchema: objectSchema(map[string]interface{}{
+			"config":     configProperty,
+			"vars":       varsProperty,
+			"tags":       tagsProperty,
+			"diff":       diffProperty,
+			"dry_run":    map[string]interface{}{"type": "boolean", "default": true, "description": "Only report what would change"},
+			"keep_going": map[string]interface{}{"type": "boolean", "description": "Continue after failed steps, skipping only the steps that depend on them"},
+			"timeout":    map[string]interface{}{"type": "string", "description": "Maximum duration of the run, e.g. 30m"},
+		}, "config"),
+		Annotations: toolAnnotations{DestructiveHint: true},
+		call:        runTool,
+	},
+	{
+		Name:  "artifacts",
+		Title: "Read run artifacts",
+		Description: "Read the artifacts of runs. Without run_id, lists the runs, newest first. With run_id, lists the files of the run " +
+			"and returns its summary. With file, returns a file of the run: JSON files as JSON, events.jsonl as a list of events, others as text.",
+		InputSchema: objectSchema(map[string]interface{}{
+			"run_id": map[string]interface{}{"type": "string", "description": "ID of the run"},
+			"file":   map[string]interface{}{"type": "string", "description": "File of the run, e.g. results.json, events.jsonl or diff.json"},
+		}),
+		Annotations: readOnly,
+		call:        artifactsTool,
+	},
+}
+
+func findTool(name string) *tool {
+	for _, t := range tools {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// callTool runs a tool and returns its result. Tool errors are results with
+// isError set, so the model sees them; they keep the structured content of the
+// tool, if any (e.g. the summary of a failed run).
+func (s *Server) callTool(ctx context.Context, t *tool, args json.RawMessage, progress *progressNotifier) map[string]interface{} {
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	value, err := t.call(ctx, s, args, progress)
+
+	result := map[string]interface{}{}
+	var content []map[string]string
+	if value != nil {
+		data, marshalErr := json.Marshal(value)
+		if marshalErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to encode result: %w", marshalErr))
+		} else {
+			result["structuredContent"] = json.RawMessage(data)
+			content = append(content, map[string]string{"type": "text", "text": string(data)})
+		}
+	}
+	if err != nil {
+		result["isError"] = true
+		content = append([]map[string]string{{"type": "text", "text": err.Error()}}, content...)
+	}
+	result["content"] = content
+	return result
+}
+
+// decodeArgs decodes the arguments of a tool call, rejecting unknown ones.
+func decodeArgs(args json.RawMessage, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(args))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func actionsListTool(_ context.Context, _ *Server, args json.RawMessage, _ *progressNotifier) (interface{}, error) {
+	if err := decodeArgs(args, &struct{}{}); err != nil {
+		return nil, err
+	}
+	actionsList := actions.List()
+	sort.Slice(actionsList, func(i, j int) bool {
+		return actionsList[i].Name < actionsList[j].Name
+	})
+	return map[string]interface{}{"actions": actionsList}, nil
+}
+
+func schemaTool(_ context.Context, _ *Server, args json.RawMessage, _ *progressNotifier) (interface{}, error) {
+	if err := decodeArgs(args, &struct{}{}); err != nil {
+		return nil, err
+	}
+	generator := schemagen.NewGenerator(schemagen.GeneratorOptions{
+		IncludeExtensions: true,
+		StrictValidation:  true,
+		OutputFormat:      "json",
+	})
+	schema, err := generator.Generate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+	data, err := schema.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	return json.RawMessage(data), nil
+}
+
+// ValidateResult is the result of the validate tool, as printed by
+// mooncake validate --format json.
+type ValidateResult struct {
+	Valid       bool                `json:"valid"`
+	Diagnostics []config.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+func validateTool(_ context.Context, _ *Server, args json.RawMessage, _ *progressNotifier) (interface{}, error) {
+	var params struct {
+		Config string `json:"config"`
+	}
+	if err := decodeArgs(args, &params); err != nil {
+		return nil, err
+	}
+	if params.Config == "" {
+		return nil, fmt.Errorf("config is required")
+	}
+
+	_, diagnostics, err := config.ReadConfigWithValidation(params.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	return ValidateResult{Valid: !config.HasErrors(diagnostics), Diagnostics: diagnostics}, nil
+}
+
+// PlanResult is the result of the plan tool.
+type PlanResult struct {
+	Plan *plan.Plan `json:"plan"`
+
+	// Changes are the file changes a run would make, predicted by a dry run (diff only)
+	Changes []events.StepDiffData `json:"changes,omitempty"`
+
+	// Summary is the summary of the dry run (diff only)
+	Summary *events.RunCompletedData `json:"summary,omitempty"`
+}
+
+func planTool(ctx context.Context, s *Server, args json.RawMessage, _ *progressNotifier) (interface{}, error) {
+	defer security.BeginRun()()
+
+	var params struct {
+		Config string   `json:"config"`
+		Vars   string   `json:"vars"`
+		Tags   []string `json:"tags"`
+		Diff   bool     `json:"diff"`
+	}
+	if err := decodeArgs(args, &params); err != nil {
+		return nil, err
+	}
+	if params.Config == "" {
+		return nil, fmt.Errorf("config is required")
+	}
+
+	variables := make(map[string]interface{})
+	if params.Vars != "" {
+		vars, err := config.ReadVariables(params.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read variables: %w", err)
+		}
+		variables = vars
+	}
+	planner, err := plan.NewPlanner()
+	if err != nil {
+		return nil, err
+	}
+	planData, err := planner.BuildPlan(plan.PlannerConfig{
+		ConfigPath: params.Config,
+		Variables:  variables,
+		Tags:       params.Tags,
+		VarsPath:   params.Vars,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build plan: %w", err)
+	}
+
+	result := &PlanResult{Plan: planData.Redact()}
+	if !params.Diff {
+		return result, nil
+	}
+
+	recorder := &events.Recorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	defer publisher.Close()
+	err = executor.ExecutePlanWithOptions(planData, executor.PlanOptions{DryRun: true, Diff: true, Context: ctx}, s.opts.Log, publisher)
+	result.Changes, result.Summary = recorder.Diffs, recorder.Summary
+	if err != nil {
+		return result, fmt.Errorf("dry run failed: %w", err)
+	}
+	return result, nil
+}
+
+// RunResult is the result of the run tool.
+type RunResult struct {
+	RunID   string                   `json:"run_id,omitempty"`
+	DryRun  bool                     `json:"dry_run"`
+	Summary *events.RunCompletedData `json:"summary,omitempty"`
+
+	// Changes are the predicted file changes of a dry run with diff
+	Changes []events.StepDiffData `json:"changes,omitempty"`
+
+	// Error is the error that stopped the run, if any
+	Error string `json:"error,omitempty"`
+
+	// ResumeCommand resumes the run, if it failed after saving a checkpoint
+	ResumeCommand string `json:"resume_command,omitempty"`
+}
+
+func runTool(ctx context.Context, s *Server, args json.RawMessage, progress *progressNotifier) (interface{}, error) {
+	params := struct {
+		Config    string   `json:"config"`
+		Vars      string   `json:"vars"`
+		Tags      []string `json:"tags"`
+		Diff      bool     `json:"diff"`
+		DryRun    bool     `json:"dry_run"`
+		KeepGoing bool     `json:"keep_going"`
+		Timeout   string   `json:"timeout"`
+	}{DryRun: true}
+	if err := decodeArgs(args, &params); err != nil {
+		return nil, err
+	}
+	if params.Config == "" {
+		return nil, fmt.Errorf("config is required")
+	}
+	if !params.DryRun && !s.opts.AllowRun {
+		return nil, fmt.Errorf("real runs are not allowed by this server (start it with --allow-run), use dry_run")
+	}
+	var timeout time.Duration
+	if params.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(params.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+
+	recorder := &events.Recorder{}
+	publisher := events.NewSyncPublisher()
+	publisher.Subscribe(recorder)
+	if progress != nil {
+		publisher.Subscribe(progress)
+	}
+	defer publisher.Close()
+
+	err := executor.Start(executor.StartConfig{
+		ConfigFilePath: params.Config,
+		VarsFilePath:   params.Vars,
+		Tags:           params.Tags,
+		DryRun:         params.DryRun,
+		Diff:           params.Diff && params.DryRun,
+		KeepGoing:      params.KeepGoing,
+		Context:        ctx,
+		Timeout:        timeout,
+		SudoPassFile:   s.opts.SudoPassFile,
+		ArtifactsDir:   s.opts.ArtifactsDir,
+	}, s.opts.Log, publisher)
+	publisher.Flush()
+
+	result := &RunResult{RunID: recorder.RunID, DryRun: params.DryRun, Summary: recorder.Summary, Changes: recorder.Diffs}
+	if err != nil {
+		var resumableErr *executor.ResumableError
+		if errors.As(err, &resumableErr) {
+			result.ResumeCommand = resumableErr.ResumeCommand()
+			err = resumableErr.Err
+		}
+		result.Error = err.Error()
+		return result, err
+	}
+	return result, nil
+}
+
+// RunFiles lists the artifacts of a run.
+type RunFiles struct {
+	artifacts.RunInfo
+	Files []string `json:"files"`
+}
+
+// RunFile is an artifact file of a run.
+type RunFile struct {
+	RunID   string      `json:"run_id"`
+	File    string      `json:"file"`
+	Content interface{} `json:"content"`
+}
+
+func artifactsTool(_ context.Context, s *Server, args json.RawMessage, _ *progressNotifier) (interface{}, error) {
+	var params struct {
+		RunID string `json:"run_id"`
+		File  string `json:"file"`
+	}
+	if err := decodeArgs(args, &params); err != nil {
+		return nil, err
+	}
+
+	if params.RunID == "" {
+		if params.File != "" {
+			return nil, fmt.Errorf("file requires run_id")
+		}
+		runs, err := artifacts.ListRuns(s.opts.ArtifactsDir)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"runs": runs}, nil
+	}
+
+	if !filepath.IsLocal(params.RunID) || strings.ContainsAny(params.RunID, `/\`) {
+		return nil, fmt.Errorf("invalid run ID: %s", params.RunID)
+	}
+	runDir := artifacts.RunDir(s.opts.ArtifactsDir, params.RunID)
+	if _, err := os.Stat(runDir); err != nil {
+		return nil, fmt.Errorf("run %s not found in %s", params.RunID, s.opts.ArtifactsDir)
+	}
+
+	if params.File == "" {
+		files := []string{}
+		err := filepath.WalkDir(runDir, func(path string, entry os.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(runDir, path)
+			files = append(files, filepath.ToSlash(rel))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return RunFiles{RunInfo: artifacts.RunInfo{RunID: params.RunID, Summary: artifacts.ReadSummary(runDir)}, Files: files}, nil
+	}
+
+	if !filepath.IsLocal(params.File) {
+		return nil, fmt.Errorf("invalid file: %s", params.File)
+	}
+	content, err := readArtifact(filepath.Join(runDir, filepath.FromSlash(params.File)))
+	if err != nil {
+		return nil, err
+	}
+	return RunFile{RunID: params.RunID, File: params.File, Content: content}, nil
+}
+
+// readArtifact reads an artifact file: JSON files as JSON values, JSON lines
+// files as lists of JSON values and other files as text.
+func readArtifact(path string) (interface{}, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path checked to be in the run directory
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(path) {
+	case ".json":
+		return json.RawMessage(data), json.Unmarshal(data, new(json.RawMessage))
+	case ".jsonl":
+		values := []json.RawMessage{}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if !json.Valid(line) {
+				return nil, fmt.Errorf("invalid JSON line in %s", filepath.Base(path))
+			}
+			values = append(values, json.RawMessage(append([]byte(nil), line...)))
+		}
+		return values, scanner.Err()
+	default:
+		return string(data), nil
+	}
+}
+
+// progressNotifier sends the progress of a run as notifications/progress, one
+// per finished step, with the step and its outcome as message.
+type progressNotifier struct {
+	server *Server
+	token  json.RawMessage
+
+	mu       sync.Mutex
+	finished int
+}
+
+// OnEvent implements events.Subscriber.
+func (p *progressNotifier) OnEvent(event events.Event) {
+	var message string
+	switch data := event.Data.(type) {
+	case events.StepCompletedData:
+		message = data.Name + ": ok"
+		if data.Changed {
+			message = data.Name + ": changed"
+		}
+	case events.StepFailedData:
+		message = fmt.Sprintf("%s: failed: %s", data.Name, data.ErrorMessage)
+	case events.StepSkippedData:
+		message = fmt.Sprintf("%s: skipped", data.Name)
+	default:
+		return
+	}
+
+	p.mu.Lock()
+	p.finished++
+	params := map[string]interface{}{
+		"progressToken": p.token,
+		"progress":      p.finished,
+		"message":       message,
+	}
+	p.mu.Unlock()
+	p.server.notify("notifications/progress", params)
+}
+
+// Close implements events.Subscriber.
+func (p *progressNotifier) Close() {}
@@ -0,0 +1,220 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/template"
+)
+
+// expandScheduledStep expands a step that has a user-defined id or depends_on.
+// The plan steps it expands to (several for loops and includes) are recorded
+// under its id and inherit its depends_on, which is resolved after expansion.
+func (p *Planner) expandScheduledStep(step config.Step, ctx *ExpansionContext, plan *Plan, stepIndex int) error {
+	if p.nested > 0 {
+		return fmt.Errorf("step %q: id and depends_on are only supported on top-level steps, not in block, rescue, always or handlers", step.Name)
+	}
+
+	userID := step.ID
+	if userID != "" {
+		if _, exists := p.stepIDs[userID]; exists {
+			return fmt.Errorf("step %q: duplicate step id %q", step.Name, userID)
+		}
+	}
+
+	dependsOn := step.DependsOn
+	step.ID = ""
+	step.DependsOn = nil
+
+	start := len(plan.Steps)
+	if err := p.expandStep(step, ctx, plan, stepIndex); err != nil {
+		return err
+	}
+
+	planIDs := make([]string, 0, len(plan.Steps)-start)
+	for _, planStep := range plan.Steps[start:] {
+		planIDs = append(planIDs, planStep.ID)
+		p.explicitDeps[planStep.ID] = append(p.explicitDeps[planStep.ID], dependsOn...)
+	}
+	if userID != "" {
+		p.stepIDs[userID] = planIDs
+	}
+	return nil
+}
+
+// expandFileSteps expands the steps of one config file. With the sequential
+// strategy, each step is made to depend on the plan steps of the step before it,
+// so the file keeps its order when the run is parallel.
+func (p *Planner) expandFileSteps(steps []config.Step, strategy string, ctx *ExpansionContext, plan *Plan, baseStepIndex int) error {
+	if strategy != config.StrategySequential {
+		return p.expandSteps(steps, ctx, plan, baseStepIndex)
+	}
+
+	var previous []string
+	for i, step := range steps {
+		start := len(plan.Steps)
+		if err := p.expandStep(step, ctx, plan, baseStepIndex+i); err != nil {
+			return err
+		}
+
+		current := make([]string, 0, len(plan.Steps)-start)
+		for j, planStep := range plan.Steps[start:] {
+			p.implicitDeps[planStep.ID] = append(p.implicitDeps[planStep.ID], previous...)
+			// Loop iterations run in order; included files follow their own strategy
+			if step.Include == nil && j > 0 {
+				p.implicitDeps[planStep.ID] = append(p.implicitDeps[planStep.ID], current[j-1])
+			}
+			current = append(current, planStep.ID)
+		}
+		if len(current) > 0 {
+			previous = current
+		}
+	}
+	return nil
+}
+
+// resolveDependencies fills in DependsOn of the plan steps with plan step IDs.
+//
+// Besides the explicit depends_on entries and the order of sequential files, a step
+// depends on the latest earlier step that registers a variable it reads, and
+// flush_handlers steps act as barriers: they wait for every earlier step and every
+// later step waits for them. Dependencies always point to earlier steps, so the
+// resulting graph is acyclic and the plan order is a valid sequential order.
+func (p *Planner) resolveDependencies(plan *Plan) error {
+	defined := make(map[string]bool, len(plan.Steps))
+	registeredBy := make(map[string]string)
+	var barrier string
+	var sinceBarrier []string
+
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+
+		var deps []string
+		seen := make(map[string]bool)
+		add := func(id string) {
+			if id != "" && id != step.ID && !seen[id] {
+				seen[id] = true
+				deps = append(deps, id)
+			}
+		}
+
+		for _, userID := range p.explicitDeps[step.ID] {
+			planIDs, ok := p.stepIDs[userID]
+			if !ok {
+				return fmt.Errorf("step %q (%s) depends on unknown step id %q", step.Name, step.ID, userID)
+			}
+			for _, id := range planIDs {
+				if !defined[id] {
+					return fmt.Errorf("step %q (%s) depends on %q, which must be defined before it", step.Name, step.ID, userID)
+				}
+				add(id)
+			}
+		}
+
+		for _, id := range p.implicitDeps[step.ID] {
+			add(id)
+		}
+
+		for _, name := range StepVariables(*step) {
+			add(registeredBy[name])
+		}
+
+		if step.FlushHandlers {
+			for _, id := range sinceBarrier {
+				add(id)
+			}
+		}
+		add(barrier)
+
+		step.DependsOn = deps
+		defined[step.ID] = true
+		for _, name := range stepRegisters(*step) {
+			registeredBy[name] = step.ID
+		}
+		if step.FlushHandlers {
+			barrier = step.ID
+			sinceBarrier = nil
+		} else {
+			sinceBarrier = append(sinceBarrier, step.ID)
+		}
+	}
+	return nil
+}
+
+// stepRegisters returns the variable names a step and its nested steps register.
+func stepRegisters(step config.Step) []string {
+	var names []string
+	if step.Register != "" {
+		names = append(names, step.Register)
+	}
+	for _, section := range [][]config.Step{step.Block, step.Rescue, step.Always} {
+		for _, nested := range section {
+			names = append(names, stepRegisters(nested)...)
+		}
+	}
+	return names
+}
+
+// StepVariables returns the variable names a step reads at runtime: those in
+// its conditions, its with_items and the template expressions of its fields,
+// including nested block, rescue and always steps.
+func StepVariables(step config.Step) []string {
+	exprs := stepConditions(step)
+
+	// Walk the serialized step so every action field is covered
+	var fields interface{}
+	if data, err := json.Marshal(step); err == nil && json.Unmarshal(data, &fields) == nil {
+		exprs = append(exprs, fieldExpressions(fields)...)
+	}
+
+	var names []string
+	for _, expr := range exprs {
+		names = append(names, template.Variables(expr)...)
+	}
+	return names
+}
+
+// stepConditions returns the raw (non-template) expressions of a step and its nested steps.
+func stepConditions(step config.Step) []string {
+	exprs := []string{step.When, step.ChangedWhen, step.FailedWhen, step.Until}
+	if step.WithItems != nil {
+		exprs = append(exprs, *step.WithItems)
+	}
+
+	for _, section := range [][]config.Step{step.Block, step.Rescue, step.Always} {
+		for _, nested := range section {
+			exprs = append(exprs, stepConditions(nested)...)
+		}
+	}
+	return exprs
+}
+
+// fieldExpressions returns the template expressions in the strings of a decoded JSON value.
+func fieldExpressions(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return template.Expressions(v)
+	case []interface{}:
+		var exprs []string
+		for _, item := range v {
+			exprs = append(exprs, fieldExpressions(item)...)
+		}
+		return exprs
+	case map[string]interface{}:
+		// Sorted so the first variable found is stable between runs
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var exprs []string
+		for _, key := range keys {
+			exprs = append(exprs, fieldExpressions(v[key])...)
+		}
+		return exprs
+	}
+	return nil
+}
@@ -0,0 +1,411 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/config"
+)
+
+// Diff is the difference between two plans.
+type Diff struct {
+	// Added lists the steps only in the new plan, in plan order
+	Added []StepRef `json:"added"`
+
+	// Removed lists the steps only in the old plan, in plan order
+	Removed []StepRef `json:"removed"`
+
+	// Modified lists the steps in both plans whose fields differ, in new plan order
+	Modified []StepChange `json:"modified"`
+
+	// Unchanged is the number of steps that are the same in both plans
+	Unchanged int `json:"unchanged"`
+}
+
+// StepRef identifies a step of a plan.
+type StepRef struct {
+	ID      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Action  string `json:"action"`
+	Origin  string `json:"origin,omitempty"` // file:line, relative to the plan's config directory
+	Handler bool   `json:"handler,omitempty"`
+}
+
+// StepChange is a step whose fields differ between two plans.
+type StepChange struct {
+	Old    StepRef       `json:"old"`
+	New    StepRef       `json:"new"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// FieldChange is a field of a step that differs between two plans. Nested fields
+// are addressed by path, e.g. "file.mode" or "block[1].shell.cmd". Old or New is
+// nil if the field is only set in one of the plans.
+type FieldChange struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old"`
+	New  interface{} `json:"new"`
+}
+
+// Empty reports whether the plans have the same steps.
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// DiffPlans compares two plans step by step, handlers included.
+//
+// Step IDs are positional, so inserting a step renumbers every step after it.
+// Steps are therefore matched by their origin file, action, name and loop item, in
+// plan order (a longest common subsequence). Steps left over on both sides with
+// the same ID and origin (a step renamed in place) are matched too. Matched steps
+// are compared field by field, ignoring plan metadata (IDs, origins, loop
+// positions); dependencies on matched steps are compared by their new IDs.
+func DiffPlans(oldPlan, newPlan *Plan) (*Diff, error) {
+	d := &Diff{Added: []StepRef{}, Removed: []StepRef{}, Modified: []StepChange{}}
+	oldBase, newBase := planBaseDir(oldPlan), planBaseDir(newPlan)
+
+	for _, handlers := range []bool{false, true} {
+		oldSteps, newSteps := oldPlan.Steps, newPlan.Steps
+		if handlers {
+			oldSteps, newSteps = oldPlan.Handlers, newPlan.Handlers
+		}
+		oldEntries := diffEntries(oldSteps, oldBase, handlers)
+		newEntries := diffEntries(newSteps, newBase, handlers)
+		matches := matchEntries(oldEntries, newEntries)
+
+		idMap := make(map[string]string, len(matches))
+		for oldIndex, newIndex := range matches {
+			idMap[oldEntries[oldIndex].ref.ID] = newEntries[newIndex].ref.ID
+		}
+
+		matchedNew := make(map[int]int, len(matches))
+		for oldIndex, newIndex := range matches {
+			matchedNew[newIndex] = oldIndex
+		}
+		for i, entry := range oldEntries {
+			if _, ok := matches[i]; !ok {
+				d.Removed = append(d.Removed, entry.ref)
+			}
+		}
+		for newIndex, entry := range newEntries {
+			oldIndex, ok := matchedNew[newIndex]
+			if !ok {
+				d.Added = append(d.Added, entry.ref)
+				continue
+			}
+			fields, err := diffStepFields(oldEntries[oldIndex].step, entry.step, idMap, oldBase, newBase)
+			if err != nil {
+				return nil, err
+			}
+			if len(fields) == 0 {
+				d.Unchanged++
+				continue
+			}
+			d.Modified = append(d.Modified, StepChange{Old: oldEntries[oldIndex].ref, New: entry.ref, Fields: fields})
+		}
+	}
+	return d, nil
+}
+
+// diffEntry is a step with the keys it's matched by.
+type diffEntry struct {
+	step config.Step
+	ref  StepRef
+	key  string // origin file, action, name and loop item
+	at   string // ID and origin position
+}
+
+func diffEntries(steps []config.Step, baseDir string, handlers bool) []diffEntry {
+	entries := make([]diffEntry, len(steps))
+	for i, step := range steps {
+		file, position := "", ""
+		if step.Origin != nil {
+			file = relativeTo(baseDir, step.Origin.FilePath)
+			position = fmt.Sprintf("%d:%d", step.Origin.Line, step.Origin.Column)
+		}
+		item := ""
+		if step.LoopContext != nil {
+			data, _ := json.Marshal(step.LoopContext.Item)
+			item = string(data)
+		}
+		action := step.ActionType
+		if action == "" {
+			action = step.DetermineActionType()
+		}
+
+		ref := StepRef{ID: step.ID, Name: step.Name, Action: action, Handler: handlers}
+		if file != "" {
+			ref.Origin = fmt.Sprintf("%s:%d", file, step.Origin.Line)
+		}
+		entries[i] = diffEntry{
+			step: step,
+			ref:  ref,
+			key:  strings.Join([]string{file, action, step.Name, item}, "\x00"),
+			at:   strings.Join([]string{step.ID, file, position}, "\x00"),
+		}
+	}
+	return entries
+}
+
+// matchEntries pairs old and new entries, returning a map from old index to new
+// index: first the longest common subsequence of keys, then leftovers at the same
+// ID and origin.
+func matchEntries(oldEntries, newEntries []diffEntry) map[int]int {
+	n, m := len(oldEntries), len(newEntries)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case oldEntries[i].key == newEntries[j].key:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	matches := make(map[int]int)
+	matchedNew := make(map[int]bool)
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case oldEntries[i].key == newEntries[j].key:
+			matches[i] = j
+			matchedNew[j] = true
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	newAt := make(map[string]int)
+	for j, entry := range newEntries {
+		if !matchedNew[j] && entry.ref.ID != "" {
+			newAt[entry.at] = j
+		}
+	}
+	for i, entry := range oldEntries {
+		if _, ok := matches[i]; ok || entry.ref.ID == "" {
+			continue
+		}
+		if j, ok := newAt[entry.at]; ok {
+			matches[i] = j
+			delete(newAt, entry.at)
+		}
+	}
+	return matches
+}
+
+// diffStepFields compares two steps field by field. Dependencies of the old step
+// are translated to new step IDs with idMap first, and source paths are compared
+// relative to each plan's base directory.
+func diffStepFields(oldStep, newStep config.Step, idMap map[string]string, oldBase, newBase string) ([]FieldChange, error) {
+	if len(oldStep.DependsOn) > 0 {
+		deps := make([]string, len(oldStep.DependsOn))
+		for i, id := range oldStep.DependsOn {
+			if newID, ok := idMap[id]; ok {
+				id = newID
+			}
+			deps[i] = id
+		}
+		oldStep.DependsOn = deps
+	}
+
+	oldFields, err := stepFields(oldStep, oldBase)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := stepFields(newStep, newBase)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool, len(oldFields)+len(newFields))
+	for path := range oldFields {
+		paths[path] = true
+	}
+	for path := range newFields {
+		paths[path] = true
+	}
+	var changes []FieldChange
+	for path := range paths {
+		oldValue, inOld := oldFields[path]
+		newValue, inNew := newFields[path]
+		if inOld && inNew && jsonEqual(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, FieldChange{Path: path, Old: oldValue, New: newValue})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// stepFields flattens a step to its leaf fields by path, leaving out plan metadata.
+// Source paths the planner resolved inside baseDir are made relative to it.
+func stepFields(step config.Step, baseDir string) (map[string]interface{}, error) {
+	data, err := json.Marshal(step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode step %s: %w", step.ID, err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("failed to decode step %s: %w", step.ID, err)
+	}
+	fields := make(map[string]interface{})
+	flattenFields("", value, fields)
+	for path := range sourceFields {
+		if src, ok := fields[path].(string); ok && baseDir != "" && strings.HasPrefix(src, baseDir+string(filepath.Separator)) {
+			fields[path] = relativeTo(baseDir, src)
+		}
+	}
+	return fields, nil
+}
+
+// sourceFields are the fields the planner resolves to absolute paths next to the
+// config. Plans built in different checkouts differ in them only by the checkout.
+var sourceFields = map[string]bool{
+	"template.src":                true,
+	"copy.src":                    true,
+	"unarchive.src":               true,
+	"file.src":                    true,
+	"service.unit.src_template":   true,
+	"service.dropin.src_template": true,
+}
+
+// ignoredFields are plan metadata that change when steps move.
+var ignoredFields = map[string]bool{
+	"id":                           true,
+	"origin":                       true,
+	"loop_context.index":           true,
+	"loop_context.first":           true,
+	"loop_context.last":            true,
+	"loop_context.depth":           true,
+	"loop_context.type":            true,
+	"loop_context.loop_expression": true,
+}
+
+func flattenFields(path string, value interface{}, fields map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if ignoredFields[key] || ignoredFields[lastFields(childPath, 2)] {
+				continue
+			}
+			flattenFields(childPath, child, fields)
+		}
+	case []interface{}:
+		if scalars(v) {
+			fields[path] = v
+			return
+		}
+		for i, child := range v {
+			flattenFields(fmt.Sprintf("%s[%d]", path, i), child, fields)
+		}
+	default:
+		fields[path] = v
+	}
+}
+
+// lastFields returns the last n dot-separated fields of a path.
+func lastFields(path string, n int) string {
+	parts := strings.Split(path, ".")
+	if len(parts) <= n {
+		return path
+	}
+	return strings.Join(parts[len(parts)-n:], ".")
+}
+
+// scalars reports whether a list holds no maps or lists. Such lists (tags, notify,
+// depends_on) are compared as a whole.
+func scalars(list []interface{}) bool {
+	for _, item := range list {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func jsonEqual(a, b interface{}) bool {
+	aData, errA := json.Marshal(a)
+	bData, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aData) == string(bData)
+}
+
+// planBaseDir returns the directory origins are shown relative to: the deepest
+// directory containing the root config and every origin file of the plan. Plans
+// of the same config built in different checkouts get the same relative origins.
+func planBaseDir(p *Plan) string {
+	var files []string
+	if root := p.rootPath(); root != "" {
+		files = append(files, root)
+	}
+	var collect func(steps []config.Step)
+	collect = func(steps []config.Step) {
+		for _, step := range steps {
+			if step.Origin != nil && filepath.IsAbs(step.Origin.FilePath) {
+				files = append(files, step.Origin.FilePath)
+			}
+			collect(step.Block)
+			collect(step.Rescue)
+			collect(step.Always)
+		}
+	}
+	collect(p.Steps)
+	collect(p.Handlers)
+	if len(files) == 0 {
+		return ""
+	}
+
+	base := filepath.Dir(files[0])
+	for _, file := range files[1:] {
+		for !strings.HasPrefix(file, base+string(filepath.Separator)) && base != filepath.Dir(base) {
+			base = filepath.Dir(base)
+		}
+	}
+	return base
+}
+
+// rootPath returns the absolute path of the root config, or "" if unknown. A
+// relative RootFile is looked up among the fingerprinted sources (the shortest
+// match, as included files may have the same name).
+func (p *Plan) rootPath() string {
+	if p.RootFile == "" || filepath.IsAbs(p.RootFile) {
+		return p.RootFile
+	}
+	root := ""
+	if p.Fingerprint != nil {
+		suffix := string(filepath.Separator) + filepath.Clean(p.RootFile)
+		for path := range p.Fingerprint.Sources {
+			if strings.HasSuffix(path, suffix) && (root == "" || len(path) < len(root)) {
+				root = path
+			}
+		}
+	}
+	return root
+}
+
+func relativeTo(baseDir, path string) string {
+	if baseDir == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(baseDir, path); err == nil {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,162 @@
+package plan
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+)
+
+// diffStep returns a shell step as the planner would, with ID and origin.
+func diffStep(id int, dir, file string, line int, name, cmd string) config.Step {
+	return config.Step{
+		ID:         fmt.Sprintf("step-%04d", id),
+		Name:       name,
+		ActionType: "shell",
+		Shell:      &config.ShellAction{Cmd: cmd},
+		Origin:     &config.Origin{FilePath: dir + "/" + file, Line: line, Column: 3},
+	}
+}
+
+func TestDiffPlans_Unchanged(t *testing.T) {
+	// The same config built in two checkouts
+	oldPlan := &Plan{Steps: []config.Step{
+		diffStep(1, "/a/repo", "main.yml", 1, "one", "echo 1"),
+		diffStep(2, "/a/repo", "tasks/two.yml", 1, "two", "echo 2"),
+	}}
+	newPlan := &Plan{Steps: []config.Step{
+		diffStep(1, "/tmp/checkout", "main.yml", 1, "one", "echo 1"),
+		diffStep(2, "/tmp/checkout", "tasks/two.yml", 1, "two", "echo 2"),
+	}}
+
+	diff, err := DiffPlans(oldPlan, newPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Empty() || diff.Unchanged != 2 {
+		t.Errorf("DiffPlans() = %+v, want 2 unchanged steps", diff)
+	}
+}
+
+func TestDiffPlans_InsertedStepRenumbers(t *testing.T) {
+	oldPlan := &Plan{Steps: []config.Step{
+		diffStep(1, "/repo", "main.yml", 1, "one", "echo 1"),
+		diffStep(2, "/repo", "main.yml", 3, "two", "echo 2"),
+		diffStep(3, "/repo", "main.yml", 5, "three", "echo 3"),
+	}}
+	newPlan := &Plan{Steps: []config.Step{
+		diffStep(1, "/repo", "main.yml", 1, "zero", "echo 0"),
+		diffStep(2, "/repo", "main.yml", 3, "one", "echo 1"),
+		diffStep(3, "/repo", "main.yml", 5, "two", "echo two"),
+		diffStep(4, "/repo", "main.yml", 7, "three", "echo 3"),
+	}}
+	newPlan.Steps[3].DependsOn = []string{"step-0003"}
+	oldPlan.Steps[2].DependsOn = []string{"step-0002"}
+
+	diff, err := DiffPlans(oldPlan, newPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.Added) != 1 || diff.Added[0].Name != "zero" || diff.Added[0].Origin != "main.yml:1" {
+		t.Errorf("Added = %+v, want the zero step", diff.Added)
+	}
+	if len(diff.Removed) != 0 {
+		t.Errorf("Removed = %+v, want none", diff.Removed)
+	}
+	// "three" moved from step-0003 to step-0004, and its dependency from step-0002
+	// to step-0003: both are the renumbered "two" step, so it's unchanged
+	if diff.Unchanged != 2 {
+		t.Errorf("Unchanged = %d, want 2", diff.Unchanged)
+	}
+	if len(diff.Modified) != 1 {
+		t.Fatalf("Modified = %+v, want the two step", diff.Modified)
+	}
+	change := diff.Modified[0]
+	if change.Old.ID != "step-0002" || change.New.ID != "step-0003" {
+		t.Errorf("Modified step IDs = %s -> %s, want step-0002 -> step-0003", change.Old.ID, change.New.ID)
+	}
+	if len(change.Fields) != 1 || change.Fields[0].Path != "shell.cmd" ||
+		change.Fields[0].Old != "echo 2" || change.Fields[0].New != "echo two" {
+		t.Errorf("Fields = %+v, want shell.cmd echo 2 -> echo two", change.Fields)
+	}
+}
+
+func TestDiffPlans_RemovedAndRenamed(t *testing.T) {
+	oldPlan := &Plan{
+		Steps: []config.Step{
+			diffStep(1, "/repo", "main.yml", 1, "install", "echo install"),
+			diffStep(2, "/repo", "main.yml", 3, "obsolete", "echo old"),
+		},
+		Handlers: []config.Step{diffStep(3, "/repo", "main.yml", 10, "restart", "echo restart")},
+	}
+	newPlan := &Plan{
+		Steps: []config.Step{
+			// Renamed in place: same ID and origin
+			diffStep(1, "/repo", "main.yml", 1, "install tools", "echo install"),
+		},
+		Handlers: []config.Step{diffStep(2, "/repo", "main.yml", 10, "restart", "echo restart")},
+	}
+	newPlan.Steps[0].Tags = []string{"tools"}
+
+	diff, err := DiffPlans(oldPlan, newPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.Removed) != 1 || diff.Removed[0].Name != "obsolete" {
+		t.Errorf("Removed = %+v, want the obsolete step", diff.Removed)
+	}
+	if len(diff.Added) != 0 {
+		t.Errorf("Added = %+v, want none", diff.Added)
+	}
+	if len(diff.Modified) != 1 {
+		t.Fatalf("Modified = %+v, want the renamed step", diff.Modified)
+	}
+	var paths []string
+	for _, field := range diff.Modified[0].Fields {
+		paths = append(paths, field.Path)
+	}
+	if fmt.Sprint(paths) != "[name tags]" {
+		t.Errorf("modified fields = %v, want [name tags]", paths)
+	}
+	if tags := diff.Modified[0].Fields[1]; tags.Old != nil {
+		t.Errorf("tags old value = %v, want nil (not set)", tags.Old)
+	}
+	// The handler is unchanged although its ID changed
+	if diff.Unchanged != 1 {
+		t.Errorf("Unchanged = %d, want the handler", diff.Unchanged)
+	}
+}
+
+func TestDiffPlans_LoopItems(t *testing.T) {
+	loopStep := func(id int, item string) config.Step {
+		step := diffStep(id, "/repo", "main.yml", 1, "install "+item, "install "+item)
+		step.Name = "install"
+		step.LoopContext = &config.LoopContext{Type: "with_items", Item: item, Index: id - 1}
+		return step
+	}
+	oldPlan := &Plan{Steps: []config.Step{loopStep(1, "git"), loopStep(2, "curl")}}
+	newPlan := &Plan{Steps: []config.Step{loopStep(1, "jq"), loopStep(2, "git"), loopStep(3, "curl")}}
+
+	diff, err := DiffPlans(oldPlan, newPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].ID != "step-0001" || len(diff.Modified) != 0 || diff.Unchanged != 2 {
+		t.Errorf("DiffPlans() = %+v, want the jq item added and the others unchanged", diff)
+	}
+}
+
+func TestPlanBaseDir(t *testing.T) {
+	p := &Plan{Steps: []config.Step{
+		diffStep(1, "/repo", "main.yml", 1, "a", "a"),
+		{Block: []config.Step{diffStep(2, "/repo", "roles/web/tasks.yml", 1, "b", "b")}},
+	}}
+	if got := planBaseDir(p); got != "/repo" {
+		t.Errorf("planBaseDir() = %q, want /repo", got)
+	}
+	if got := planBaseDir(&Plan{}); got != "" {
+		t.Errorf("planBaseDir() of an empty plan = %q, want empty", got)
+	}
+}
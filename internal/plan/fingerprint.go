@@ -0,0 +1,233 @@
+package plan
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/facts"
+	"github.com/alehatsman/mooncake/internal/security"
+	"github.com/alehatsman/mooncake/internal/version"
+)
+
+// SignatureAlgorithm is the algorithm of plan signatures.
+const SignatureAlgorithm = "ed25519"
+
+// Fingerprint binds a plan to what it was built from: the mooncake version, the
+// config files it read and the host facts its templates and conditions saw.
+type Fingerprint struct {
+	// MooncakeVersion is the version of mooncake that built the plan
+	MooncakeVersion string `json:"mooncake_version" yaml:"mooncake_version"`
+
+	// Sources maps the absolute path of every config and vars file read while
+	// planning (root config, includes, include_vars, --vars) to its SHA-256
+	Sources map[string]string `json:"sources" yaml:"sources"`
+
+	// Facts holds the host facts the plan depends on (os, arch, distribution, ...)
+	Facts map[string]string `json:"facts" yaml:"facts"`
+}
+
+// Signature is an ed25519 signature over a plan.
+type Signature struct {
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	KeyID     string `json:"key_id" yaml:"key_id"`
+	PublicKey string `json:"public_key" yaml:"public_key"` // base64
+	Value     string `json:"value" yaml:"value"`           // base64
+}
+
+// fingerprintFacts returns the facts a plan is bound to. Facts that change without
+// making a plan stale (IP addresses, memory, disks) are left out, and so are the
+// hostname and username, so a plan built on CI can run on the box it targets.
+func fingerprintFacts(f *facts.Facts) map[string]string {
+	return map[string]string{
+		"os":                   f.OS,
+		"arch":                 f.Arch,
+		"distribution":         f.Distribution,
+		"distribution_version": f.DistributionVersion,
+		"package_manager":      f.PackageManager,
+	}
+}
+
+// hashFile returns the hex SHA-256 of a file.
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is a config file the planner already read
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// FingerprintError lists the differences between a plan's fingerprint and the
+// host and sources it's about to run against.
+type FingerprintError struct {
+	Mismatches []string
+}
+
+func (e *FingerprintError) Error() string {
+	return "plan was built for another host, mooncake version or sources:\n  - " + strings.Join(e.Mismatches, "\n  - ")
+}
+
+// VerifyFingerprint compares the plan's fingerprint with the given host facts and
+// the current contents of its sources. It returns a *FingerprintError listing every
+// difference, or nil if there are none.
+//
+// Sources are only compared when at least one of them exists on this host: a plan
+// built elsewhere and copied here without its config has nothing to compare to.
+func (p *Plan) VerifyFingerprint(current *facts.Facts) error {
+	if p.Fingerprint == nil {
+		return &FingerprintError{Mismatches: []string{"plan has no fingerprint (built by an older mooncake)"}}
+	}
+	fp := p.Fingerprint
+	var mismatches []string
+
+	if fp.MooncakeVersion != version.Version {
+		mismatches = append(mismatches, fmt.Sprintf("mooncake version: built with %s, running %s", fp.MooncakeVersion, version.Version))
+	}
+
+	currentFacts := fingerprintFacts(current)
+	for _, name := range sortedKeys(fp.Facts) {
+		if want, got := fp.Facts[name], currentFacts[name]; want != got {
+			mismatches = append(mismatches, fmt.Sprintf("%s: built on %q, running on %q", name, want, got))
+		}
+	}
+
+	if anySourceExists(fp.Sources) {
+		for _, path := range sortedKeys(fp.Sources) {
+			sum, err := hashFile(path)
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				mismatches = append(mismatches, fmt.Sprintf("%s: missing", path))
+			case err != nil:
+				mismatches = append(mismatches, fmt.Sprintf("%s: %v", path, err))
+			case sum != fp.Sources[path]:
+				mismatches = append(mismatches, fmt.Sprintf("%s: changed since the plan was built", path))
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return &FingerprintError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+// anySourceExists reports whether any of the sources exists on this host.
+func anySourceExists(sources map[string]string) bool {
+	for path := range sources {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign signs the plan with key, replacing any previous signature. The signature
+// covers everything in the plan, including its fingerprint.
+//
+// The initial variables are normalized to their JSON form first, so the signature
+// still verifies after the plan is saved and loaded as JSON or YAML.
+func (p *Plan) Sign(key ed25519.PrivateKey) error {
+	if err := p.normalizeVars(); err != nil {
+		return err
+	}
+	p.Signature = nil
+	payload, err := p.signedPayload()
+	if err != nil {
+		return err
+	}
+	publicKey, ok := key.Public().(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("invalid signing key")
+	}
+	p.Signature = &Signature{
+		Algorithm: SignatureAlgorithm,
+		KeyID:     security.KeyID(publicKey),
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}
+	return nil
+}
+
+// VerifySignature checks the plan's signature. If trusted is non-nil the plan must
+// be signed by that key; otherwise the signature is checked against the key
+// embedded in the plan, which only detects accidental changes, not tampering.
+func (p *Plan) VerifySignature(trusted ed25519.PublicKey) error {
+	sig := p.Signature
+	if sig == nil {
+		return fmt.Errorf("plan is not signed")
+	}
+	if sig.Algorithm != SignatureAlgorithm {
+		return fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	embedded, err := base64.StdEncoding.DecodeString(sig.PublicKey)
+	if err != nil || len(embedded) != ed25519.PublicKeySize {
+		return fmt.Errorf("plan signature has an invalid public key")
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return fmt.Errorf("plan signature is not valid base64: %w", err)
+	}
+
+	key := ed25519.PublicKey(embedded)
+	if trusted != nil {
+		if !trusted.Equal(key) {
+			return fmt.Errorf("plan is signed by key %s, not by the trusted key %s", security.KeyID(key), security.KeyID(trusted))
+		}
+		key = trusted
+	}
+
+	unsigned := *p
+	unsigned.Signature = nil
+	payload, err := unsigned.signedPayload()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, payload, value) {
+		return fmt.Errorf("plan signature is invalid: the plan was modified after signing")
+	}
+	return nil
+}
+
+// signedPayload returns the bytes a signature covers: the JSON encoding of the plan.
+func (p *Plan) signedPayload() ([]byte, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %w", err)
+	}
+	return data, nil
+}
+
+// normalizeVars replaces the initial variables with their JSON round-trip, turning
+// structs (such as network interface facts) into plain maps and lists.
+func (p *Plan) normalizeVars() error {
+	if p.InitialVars == nil {
+		return nil
+	}
+	data, err := json.Marshal(p.InitialVars)
+	if err != nil {
+		return fmt.Errorf("failed to encode initial variables: %w", err)
+	}
+	var vars map[string]interface{}
+	if err := json.Unmarshal(data, &vars); err != nil {
+		return fmt.Errorf("failed to decode initial variables: %w", err)
+	}
+	p.InitialVars = vars
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,223 @@
+package plan
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/facts"
+	"github.com/alehatsman/mooncake/internal/version"
+)
+
+// buildFingerprintPlan builds a plan from a root config that includes another
+// config and a vars file.
+func buildFingerprintPlan(t *testing.T) (*Plan, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.yml":  "- include: tasks.yml\n- include_vars: vars.yml\n- shell: echo {{ greeting }}\n",
+		"tasks.yml": "- print: hello\n",
+		"vars.yml":  "greeting: hi\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	planner, err := NewPlanner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := planner.BuildPlan(PlannerConfig{ConfigPath: filepath.Join(tmpDir, "main.yml")})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+	return p, tmpDir
+}
+
+func TestBuildPlan_Fingerprint(t *testing.T) {
+	p, tmpDir := buildFingerprintPlan(t)
+
+	fp := p.Fingerprint
+	if fp == nil {
+		t.Fatal("plan has no fingerprint")
+	}
+	if fp.MooncakeVersion != version.Version {
+		t.Errorf("MooncakeVersion = %q, want %q", fp.MooncakeVersion, version.Version)
+	}
+	for _, name := range []string{"main.yml", "tasks.yml", "vars.yml"} {
+		path, _ := filepath.Abs(filepath.Join(tmpDir, name))
+		if len(fp.Sources[path]) != 64 {
+			t.Errorf("Sources[%s] = %q, want a SHA-256", name, fp.Sources[path])
+		}
+	}
+	if len(fp.Sources) != 3 {
+		t.Errorf("Sources = %v, want 3 files", fp.Sources)
+	}
+	if fp.Facts["os"] != facts.Collect().OS || fp.Facts["arch"] != facts.Collect().Arch {
+		t.Errorf("Facts = %v, want this host's facts", fp.Facts)
+	}
+
+	if err := p.VerifyFingerprint(facts.Collect()); err != nil {
+		t.Errorf("VerifyFingerprint() on the same host = %v, want nil", err)
+	}
+}
+
+func TestVerifyFingerprint_Mismatches(t *testing.T) {
+	p, tmpDir := buildFingerprintPlan(t)
+
+	other := *facts.Collect()
+	other.Distribution = "somewhere-else"
+	if err := os.WriteFile(filepath.Join(tmpDir, "tasks.yml"), []byte("- print: changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(tmpDir, "vars.yml")); err != nil {
+		t.Fatal(err)
+	}
+	p.Fingerprint.MooncakeVersion = "0.0.1"
+
+	err := p.VerifyFingerprint(&other)
+	var fpErr *FingerprintError
+	if !errors.As(err, &fpErr) {
+		t.Fatalf("VerifyFingerprint() = %v, want a *FingerprintError", err)
+	}
+	want := []string{
+		"mooncake version: built with 0.0.1, running " + version.Version,
+		`distribution: built on "` + facts.Collect().Distribution + `", running on "somewhere-else"`,
+		"tasks.yml: changed since the plan was built",
+		"vars.yml: missing",
+	}
+	if len(fpErr.Mismatches) != len(want) {
+		t.Fatalf("Mismatches = %q, want %d entries", fpErr.Mismatches, len(want))
+	}
+	for i, mismatch := range fpErr.Mismatches {
+		if !strings.HasSuffix(mismatch, want[i]) {
+			t.Errorf("Mismatches[%d] = %q, want %q", i, mismatch, want[i])
+		}
+	}
+}
+
+func TestVerifyFingerprint_OtherHostSamePlatform(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "main.yml")
+	if err := os.WriteFile(configPath, []byte("- shell: echo hi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Plan on a CI runner, run on the target: same platform, different host
+	ci := &facts.Facts{
+		OS: "linux", Arch: "amd64", Hostname: "ci-runner-7", Username: "runner",
+		Distribution: "ubuntu", DistributionVersion: "24.04", PackageManager: "apt",
+	}
+	planner, err := NewPlanner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := planner.BuildPlan(PlannerConfig{ConfigPath: configPath, Facts: ci})
+	if err != nil {
+		t.Fatalf("BuildPlan() error = %v", err)
+	}
+
+	target := *ci
+	target.Hostname = "web-1"
+	target.Username = "deploy"
+	if err := p.VerifyFingerprint(&target); err != nil {
+		t.Errorf("VerifyFingerprint() on the target = %v, want nil", err)
+	}
+
+	target.DistributionVersion = "22.04"
+	if err := p.VerifyFingerprint(&target); err == nil {
+		t.Error("VerifyFingerprint() on another distribution version should fail")
+	}
+}
+
+func TestVerifyFingerprint_SourcesElsewhere(t *testing.T) {
+	p, tmpDir := buildFingerprintPlan(t)
+
+	// A plan copied to a host without its config can't be checked for source drift
+	if err := os.RemoveAll(tmpDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.VerifyFingerprint(facts.Collect()); err != nil {
+		t.Errorf("VerifyFingerprint() without sources = %v, want nil", err)
+	}
+}
+
+func TestVerifyFingerprint_Missing(t *testing.T) {
+	p := &Plan{}
+	if err := p.VerifyFingerprint(facts.Collect()); err == nil {
+		t.Error("VerifyFingerprint() without a fingerprint should fail")
+	}
+}
+
+func TestSignPlan_RoundTrip(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ext := range []string{".json", ".yaml"} {
+		t.Run(ext, func(t *testing.T) {
+			p, _ := buildFingerprintPlan(t)
+			if err := p.Sign(privateKey); err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+			if err := p.VerifySignature(publicKey); err != nil {
+				t.Fatalf("VerifySignature() before saving = %v", err)
+			}
+
+			path := filepath.Join(t.TempDir(), "plan"+ext)
+			if err := SavePlanToFile(p, path); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := LoadPlanFromFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := loaded.VerifySignature(publicKey); err != nil {
+				t.Errorf("VerifySignature() after loading = %v", err)
+			}
+			if err := loaded.VerifySignature(nil); err != nil {
+				t.Errorf("VerifySignature(nil) after loading = %v", err)
+			}
+
+			loaded.Steps[0].Name = "tampered"
+			if err := loaded.VerifySignature(nil); err == nil {
+				t.Error("VerifySignature() should fail for a modified plan")
+			}
+		})
+	}
+}
+
+func TestVerifySignature_Errors(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ := buildFingerprintPlan(t)
+	if err := p.VerifySignature(publicKey); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("VerifySignature() of an unsigned plan = %v, want not signed", err)
+	}
+
+	if err := p.Sign(privateKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.VerifySignature(otherKey); err == nil || !strings.Contains(err.Error(), "not by the trusted key") {
+		t.Errorf("VerifySignature() with another key = %v, want a key mismatch", err)
+	}
+
+	p.Fingerprint.Facts["os"] = "elsewhere"
+	if err := p.VerifySignature(publicKey); err == nil {
+		t.Error("VerifySignature() should fail when the fingerprint is modified")
+	}
+}
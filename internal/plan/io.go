@@ -10,9 +10,11 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// SavePlanToFile saves a plan to a file in JSON or YAML format
+// SavePlanToFile saves a plan to a file in JSON or YAML format. Registered
+// secrets are redacted (see Plan.Redact).
 func SavePlanToFile(p *Plan, filePath string) (err error) {
 	ext := filepath.Ext(filePath)
+	p = p.Redact()
 
 	file, err := os.Create(filePath) // #nosec G304 -- filePath is user-provided CLI argument
 	if err != nil {
@@ -5,8 +5,10 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/security"
 )
 
 // TestSavePlanToFile_JSON tests saving plan to JSON format
@@ -380,3 +382,91 @@ func TestSaveAndLoadRoundTrip(t *testing.T) {
 		t.Errorf("YAML round-trip: Steps count mismatch")
 	}
 }
+
+// TestSavePlanToFile_RedactsSecrets tests that saved plans don't contain secrets
+func TestSavePlanToFile_RedactsSecrets(t *testing.T) {
+	t.Cleanup(security.ResetSecrets)
+	security.RegisterSecret("saved-plan-secret")
+	p := &Plan{
+		RootFile:    "test.yml",
+		Steps:       []config.Step{{Name: "login", Shell: &config.ShellAction{Cmd: "login saved-plan-secret"}}},
+		InitialVars: map[string]interface{}{"password": "saved-plan-secret"},
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := SavePlanToFile(p, path); err != nil {
+		t.Fatalf("SavePlanToFile failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "saved-plan-secret") {
+		t.Errorf("saved plan contains the secret:\n%s", data)
+	}
+
+	loaded, err := LoadPlanFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadPlanFromFile failed: %v", err)
+	}
+	if !loaded.Redacted || loaded.Steps[0].Shell.Cmd != "login [REDACTED]" {
+		t.Errorf("loaded plan: redacted = %v, command = %q", loaded.Redacted, loaded.Steps[0].Shell.Cmd)
+	}
+	if p.Redacted || p.Steps[0].Shell.Cmd != "login saved-plan-secret" {
+		t.Error("SavePlanToFile modified the plan")
+	}
+}
+
+// TestPlanHash_StableAcrossSaveLoad tests that a saved plan keeps its hash
+func TestPlanHash_StableAcrossSaveLoad(t *testing.T) {
+	plan := buildTestPlan(t, `version: "1.0"
+vars:
+  tools: [go, node]
+  retries: 3
+steps:
+  - name: Install {{ item }}
+    shell: echo {{ item }}
+    with_items: tools
+    retries: 3
+    register: install
+  - name: Notify
+    shell: echo done
+    notify: [restart]
+handlers:
+  - name: restart
+    shell: echo restart
+`, nil)
+
+	hash, err := plan.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	filePath := filepath.Join(t.TempDir(), "plan.json")
+	if err := SavePlanToFile(plan, filePath); err != nil {
+		t.Fatalf("SavePlanToFile failed: %v", err)
+	}
+	loaded, err := LoadPlanFromFile(filePath)
+	if err != nil {
+		t.Fatalf("LoadPlanFromFile failed: %v", err)
+	}
+
+	loadedHash, err := loaded.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if loadedHash != hash {
+		t.Errorf("hash after save/load = %s, want %s", loadedHash, hash)
+	}
+
+	// Metadata doesn't change the hash, steps do
+	loaded.GeneratedAt = loaded.GeneratedAt.Add(time.Hour)
+	loaded.InitialVars = nil
+	if h, _ := loaded.Hash(); h != hash {
+		t.Error("hash should not depend on plan metadata")
+	}
+	loaded.Steps[0].Name = "Install something else"
+	if h, _ := loaded.Hash(); h == hash {
+		t.Error("hash should change when a step changes")
+	}
+}
@@ -1,9 +1,13 @@
 package plan
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"time"
 
 	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/security"
 )
 
 // Plan represents a fully expanded, deterministic execution plan
@@ -12,6 +16,40 @@ type Plan struct {
 	GeneratedAt time.Time              `json:"generated_at" yaml:"generated_at"`
 	RootFile    string                 `json:"root_file" yaml:"root_file"`
 	Steps       []config.Step          `json:"steps" yaml:"steps"`
+	Handlers    []config.Step          `json:"handlers,omitempty" yaml:"handlers,omitempty"`
 	InitialVars map[string]interface{} `json:"initial_vars,omitempty" yaml:"initial_vars,omitempty"`
 	Tags        []string               `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Strategy    string                 `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	Secrets     []string               `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	Redacted    bool                   `json:"redacted,omitempty" yaml:"redacted,omitempty"`
+	Fingerprint *Fingerprint           `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Signature   *Signature             `json:"signature,omitempty" yaml:"signature,omitempty"`
+}
+
+// Hash returns a SHA-256 digest of the plan's strategy, steps and handlers.
+// Metadata such as the generation time and initial variables is left out, so
+// rebuilding an unchanged config gives the same hash.
+func (p *Plan) Hash() (string, error) {
+	data, err := json.Marshal(struct {
+		Strategy string        `json:"strategy,omitempty"`
+		Steps    []config.Step `json:"steps"`
+		Handlers []config.Step `json:"handlers,omitempty"`
+	}{p.Strategy, p.Steps, p.Handlers})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Redact returns a copy of the plan with the registered secrets redacted and
+// Redacted set, or the plan itself if it contains none. A redacted plan can be
+// shown and saved, but not run.
+func (p *Plan) Redact() *Plan {
+	redacted, ok := security.RedactValue(*p)
+	if !ok {
+		return p
+	}
+	redacted.Redacted = true
+	return &redacted
 }
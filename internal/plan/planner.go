@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -14,8 +15,10 @@ import (
 	"github.com/alehatsman/mooncake/internal/facts"
 	"github.com/alehatsman/mooncake/internal/filetree"
 	"github.com/alehatsman/mooncake/internal/pathutil"
+	"github.com/alehatsman/mooncake/internal/security"
 	"github.com/alehatsman/mooncake/internal/template"
 	"github.com/alehatsman/mooncake/internal/utils"
+	"github.com/alehatsman/mooncake/internal/version"
 )
 
 // resolvePath converts a potentially relative path to an absolute path.
@@ -28,9 +31,13 @@ func resolvePath(path, baseDir string) (string, error) {
 	return filepath.Abs(absPath)
 }
 
-// validatePlatformSupport checks if the action is supported on the current platform.
-// Returns an error if the action is not supported.
-func validatePlatformSupport(actionType string) error {
+// validatePlatformSupport checks if the action is supported on the target platform.
+// An empty currentOS means this host. Returns an error if the action is not supported.
+func validatePlatformSupport(actionType, currentOS string) error {
+	if currentOS == "" {
+		currentOS = runtime.GOOS
+	}
+
 	// Get handler from registry
 	handler, ok := actions.Get(actionType)
 	if !ok {
@@ -45,8 +52,7 @@ func validatePlatformSupport(actionType string) error {
 		return nil
 	}
 
-	// Check if current platform is in the supported list
-	currentOS := runtime.GOOS
+	// Check if target platform is in the supported list
 	for _, supportedOS := range metadata.SupportedPlatforms {
 		if supportedOS == currentOS {
 			return nil
@@ -71,6 +77,14 @@ type Planner struct {
 	includeStack  []IncludeFrame
 	seenFiles     map[string]bool
 	locationMap   map[int]*IncludeFrame // Map step index to location
+	handlers      []config.Step         // Handlers collected from the root and included files
+	stepIDs       map[string][]string   // User-defined step id -> plan step IDs it expanded to
+	explicitDeps  map[string][]string   // Plan step ID -> user-defined ids from depends_on
+	implicitDeps  map[string][]string   // Plan step ID -> plan step IDs it must follow (sequential files)
+	nested        int                   // Depth of block sections and handlers being expanded
+	targetOS      string                // OS of the host the plan is built for
+	sources       map[string]string     // Absolute path -> SHA-256 of the config and vars files read
+	secrets       []string              // Names of secret variables declared by the root and included files
 }
 
 // IncludeFrame tracks a frame in the include stack for cycle detection and origin tracking
@@ -92,6 +106,13 @@ type PlannerConfig struct {
 	ConfigPath string
 	Variables  map[string]interface{}
 	Tags       []string
+
+	// VarsPath is the file Variables were read from, if any. It's recorded in the
+	// plan fingerprint.
+	VarsPath string
+
+	// Facts are the facts of the host the plan is built for. Nil means this host.
+	Facts *facts.Facts
 }
 
 // NewPlanner creates a new Planner instance.
@@ -109,6 +130,9 @@ func NewPlanner() (*Planner, error) {
 		fileTree:     filetree.NewWalker(pathExpander),
 		seenFiles:    make(map[string]bool),
 		locationMap:  make(map[int]*IncludeFrame),
+		stepIDs:      make(map[string][]string),
+		explicitDeps: make(map[string][]string),
+		implicitDeps: make(map[string][]string),
 	}, nil
 }
 
@@ -152,6 +176,7 @@ func (p *Planner) BuildPlan(cfg PlannerConfig) (*Plan, error) {
 		Steps:       make([]config.Step, 0),
 		InitialVars: cfg.Variables,
 		Tags:        cfg.Tags,
+		Strategy:    runConfig.Strategy,
 	}
 
 	// Merge global vars from config with provided vars (provided vars take precedence)
@@ -159,7 +184,11 @@ func (p *Planner) BuildPlan(cfg PlannerConfig) (*Plan, error) {
 
 	// Inject system facts (ansible_os_family, ansible_distribution, etc.)
 	// These are added after config vars but before expansion, so templates can use them
-	systemFacts := facts.Collect()
+	systemFacts := cfg.Facts
+	if systemFacts == nil {
+		systemFacts = facts.Collect()
+	}
+	p.targetOS = systemFacts.OS
 	for k, v := range systemFacts.ToMap() {
 		variables[k] = v
 	}
@@ -181,6 +210,18 @@ func (p *Planner) BuildPlan(cfg PlannerConfig) (*Plan, error) {
 		return nil, fmt.Errorf("failed to resolve config path: %w", err)
 	}
 	p.seenFiles[absPath] = true
+	if err := p.recordSource(absPath); err != nil {
+		return nil, err
+	}
+	if cfg.VarsPath != "" {
+		absVarsPath, err := filepath.Abs(cfg.VarsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve vars path: %w", err)
+		}
+		if err := p.recordSource(absVarsPath); err != nil {
+			return nil, err
+		}
+	}
 
 	// Push root frame
 	p.includeStack = append(p.includeStack, IncludeFrame{
@@ -190,13 +231,52 @@ func (p *Planner) BuildPlan(cfg PlannerConfig) (*Plan, error) {
 	})
 
 	// Expand all steps
-	if err := p.expandSteps(runConfig.Steps, ctx, plan, 0); err != nil {
+	if err := p.expandFileSteps(runConfig.Steps, runConfig.Strategy, ctx, plan, 0); err != nil {
+		return nil, err
+	}
+
+	// Expand root handlers after the steps so they see the final plan-time variables
+	if err := p.expandHandlers(runConfig.Handlers, ctx); err != nil {
 		return nil, err
 	}
+	plan.Handlers = p.handlers
+
+	if err := validateNotify(plan); err != nil {
+		return nil, err
+	}
+
+	if err := p.resolveDependencies(plan); err != nil {
+		return nil, err
+	}
+
+	// Keep the values of secret variables out of events and saved plans
+	plan.Secrets = p.secrets
+	for _, name := range p.secrets {
+		security.RegisterSecrets(ctx.Variables[name])
+	}
+
+	plan.Fingerprint = &Fingerprint{
+		MooncakeVersion: version.Version,
+		Sources:         p.sources,
+		Facts:           fingerprintFacts(systemFacts),
+	}
 
 	return plan, nil
 }
 
+// recordSource records the hash of a file read while planning for the plan fingerprint.
+func (p *Planner) recordSource(absPath string) error {
+	sum, err := hashFile(absPath)
+	if err != nil {
+		return fmt.Errorf("failed to hash %q: %w", absPath, err)
+	}
+	if p.sources == nil {
+		p.sources = make(map[string]string)
+	}
+	p.sources[absPath] = sum
+	return nil
+}
+
 // readRunConfig reads and parses a config file with validation
 func (p *Planner) readRunConfig(path string) (*config.RunConfig, error) {
 	// Use ReadConfigWithValidation to get parsed config with steps, vars, and version
@@ -211,11 +291,19 @@ func (p *Planner) readRunConfig(path string) (*config.RunConfig, error) {
 		return nil, fmt.Errorf("configuration validation failed:\n%s", formatted)
 	}
 
+	for _, name := range parsedConfig.Secrets {
+		if !slices.Contains(p.secrets, name) {
+			p.secrets = append(p.secrets, name)
+		}
+	}
+
 	// Convert ParsedConfig to RunConfig
 	runConfig := &config.RunConfig{
-		Version: parsedConfig.Version,
-		Vars:    parsedConfig.GlobalVars,
-		Steps:   parsedConfig.Steps,
+		Version:  parsedConfig.Version,
+		Vars:     parsedConfig.GlobalVars,
+		Steps:    parsedConfig.Steps,
+		Handlers: parsedConfig.Handlers,
+		Strategy: parsedConfig.Strategy,
 	}
 
 	return runConfig, nil
@@ -223,6 +311,11 @@ func (p *Planner) readRunConfig(path string) (*config.RunConfig, error) {
 
 // expandStep dispatches a single step to the appropriate expansion handler
 func (p *Planner) expandStep(step config.Step, ctx *ExpansionContext, plan *Plan, stepIndex int) error {
+	// Steps with an id or depends_on take part in dependency scheduling
+	if step.ID != "" || len(step.DependsOn) > 0 {
+		return p.expandScheduledStep(step, ctx, plan, stepIndex)
+	}
+
 	// Handle include directives
 	if step.Include != nil {
 		return p.expandInclude(step, ctx, plan, stepIndex)
@@ -311,6 +404,9 @@ func (p *Planner) expandInclude(step config.Step, ctx *ExpansionContext, plan *P
 	if err != nil {
 		return fmt.Errorf("failed to read included config %q: %w", absIncludePath, err)
 	}
+	if err := p.recordSource(absIncludePath); err != nil {
+		return err
+	}
 
 	// Create new context with updated current directory
 	newCtx := &ExpansionContext{
@@ -319,12 +415,17 @@ func (p *Planner) expandInclude(step config.Step, ctx *ExpansionContext, plan *P
 		Tags:       ctx.Tags,
 	}
 
+	// Handlers declared in included files join the run's handler list
+	if err := p.expandHandlers(includedConfig.Handlers, newCtx); err != nil {
+		return err
+	}
+
 	// If the include step has a 'when' condition, propagate it to all included steps
 	// This ensures that if include is conditional, all its steps inherit that condition
 	if step.When != "" {
 		// Read and modify included steps to add parent's when condition
 		stepsBeforeExpand := len(plan.Steps)
-		err = p.expandSteps(includedConfig.Steps, newCtx, plan, stepIndex)
+		err = p.expandFileSteps(includedConfig.Steps, includedConfig.Strategy, newCtx, plan, stepIndex)
 		if err != nil {
 			return err
 		}
@@ -344,7 +445,69 @@ func (p *Planner) expandInclude(step config.Step, ctx *ExpansionContext, plan *P
 	}
 
 	// Recursively expand included steps (no when condition to propagate)
-	return p.expandSteps(includedConfig.Steps, newCtx, plan, stepIndex)
+	return p.expandFileSteps(includedConfig.Steps, includedConfig.Strategy, newCtx, plan, stepIndex)
+}
+
+// expandHandlers compiles handler steps and adds them to the planner's handler list.
+// Handlers are not filtered by tags: a notified handler always runs.
+func (p *Planner) expandHandlers(handlers []config.Step, ctx *ExpansionContext) error {
+	if len(handlers) == 0 {
+		return nil
+	}
+
+	handlerCtx := &ExpansionContext{
+		Variables:  ctx.Variables,
+		CurrentDir: ctx.CurrentDir,
+		Tags:       nil,
+	}
+
+	handlerPlan := &Plan{
+		Steps: make([]config.Step, 0),
+	}
+	p.nested++
+	defer func() { p.nested-- }()
+	if err := p.expandSteps(handlers, handlerCtx, handlerPlan, 0); err != nil {
+		return fmt.Errorf("failed to expand handlers: %w", err)
+	}
+
+	for _, handler := range handlerPlan.Steps {
+		if handler.Name == "" {
+			return fmt.Errorf("handler %s has no name (handlers are notified by name)", handler.ID)
+		}
+	}
+
+	p.handlers = append(p.handlers, handlerPlan.Steps...)
+	return nil
+}
+
+// validateNotify checks that every notify entry refers to a declared handler.
+func validateNotify(plan *Plan) error {
+	known := make(map[string]bool, len(plan.Handlers))
+	for _, handler := range plan.Handlers {
+		known[handler.Name] = true
+	}
+
+	var check func(steps []config.Step) error
+	check = func(steps []config.Step) error {
+		for _, step := range steps {
+			for _, name := range step.Notify {
+				if !known[name] {
+					return fmt.Errorf("step %q (%s) notifies unknown handler %q", step.Name, step.ID, name)
+				}
+			}
+			for _, section := range [][]config.Step{step.Block, step.Rescue, step.Always} {
+				if err := check(section); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := check(plan.Steps); err != nil {
+		return err
+	}
+	return check(plan.Handlers)
 }
 
 // expandWithItems expands a step with with_items loop
@@ -495,6 +658,9 @@ func (p *Planner) expandIncludeVars(step config.Step, ctx *ExpansionContext) err
 	if err != nil {
 		return fmt.Errorf("failed to read variables from %q: %w", absVarsPath, err)
 	}
+	if err := p.recordSource(absVarsPath); err != nil {
+		return err
+	}
 
 	// Merge into context
 	for k, v := range vars {
@@ -580,6 +746,16 @@ func (p *Planner) compilePlanStep(step config.Step, ctx *ExpansionContext, loopC
 	step.IncludeVars = nil
 	step.Vars = nil
 
+	// Expand nested step groups; the block is skipped only if all of its steps are
+	if step.Block != nil {
+		if err := p.expandBlock(&step, ctx, loopCtx); err != nil {
+			return config.Step{}, err
+		}
+		if len(step.Block) > 0 {
+			skipped = allSkipped(step.Block)
+		}
+	}
+
 	// Add plan metadata
 	step.ID = stepID
 	step.ActionType = step.DetermineActionType()
@@ -588,14 +764,123 @@ func (p *Planner) compilePlanStep(step config.Step, ctx *ExpansionContext, loopC
 	step.LoopContext = loopCtx
 
 	// Validate platform support
-	if err := validatePlatformSupport(step.ActionType); err != nil {
+	if err := validatePlatformSupport(step.ActionType, p.targetOS); err != nil {
 		return config.Step{}, fmt.Errorf("platform validation failed for step %q: %w", step.Name, err)
 	}
 
 	return step, nil
 }
 
+// expandBlock expands the block, rescue and always sections of a step group.
+// Nested steps go through the regular expansion (includes, loops, vars) using the
+// parent's context, then inherit the parent's when, tags, become and loop context.
+func (p *Planner) expandBlock(step *config.Step, ctx *ExpansionContext, loopCtx *config.LoopContext) error {
+	sections := []struct {
+		name  string
+		steps *[]config.Step
+	}{
+		{"block", &step.Block},
+		{"rescue", &step.Rescue},
+		{"always", &step.Always},
+	}
+
+	p.nested++
+	defer func() { p.nested-- }()
+
+	for _, section := range sections {
+		if *section.steps == nil {
+			continue
+		}
+
+		sectionPlan := &Plan{
+			Steps: make([]config.Step, 0),
+		}
+		if err := p.expandSteps(*section.steps, ctx, sectionPlan, 0); err != nil {
+			return fmt.Errorf("failed to expand %s of step %q: %w", section.name, step.Name, err)
+		}
+
+		p.inheritFromParent(sectionPlan.Steps, step, loopCtx, ctx.Tags)
+		*section.steps = sectionPlan.Steps
+	}
+
+	return nil
+}
+
+// inheritFromParent applies a step group's when, tags, become and no_log settings to
+// already compiled nested steps, recursing into nested groups.
+func (p *Planner) inheritFromParent(steps []config.Step, parent *config.Step, loopCtx *config.LoopContext, filterTags []string) {
+	for i := range steps {
+		child := &steps[i]
+
+		// Combine when conditions with AND logic, same as conditional includes
+		if parent.When != "" {
+			if child.When != "" {
+				child.When = "(" + parent.When + ") && (" + child.When + ")"
+			} else {
+				child.When = parent.When
+			}
+		}
+
+		if parent.NoLog {
+			child.NoLog = true
+		}
+
+		if parent.Become && !child.Become {
+			child.Become = true
+			if child.BecomeUser == "" {
+				child.BecomeUser = parent.BecomeUser
+			}
+		}
+
+		// Keep loop variables of the parent iteration available at runtime
+		if child.LoopContext == nil {
+			child.LoopContext = loopCtx
+		}
+
+		child.Tags = mergeTags(parent.Tags, child.Tags)
+
+		if child.Block != nil {
+			p.inheritFromParent(child.Block, parent, loopCtx, filterTags)
+			p.inheritFromParent(child.Rescue, parent, loopCtx, filterTags)
+			p.inheritFromParent(child.Always, parent, loopCtx, filterTags)
+			if len(child.Block) > 0 {
+				child.Skipped = allSkipped(child.Block)
+				continue
+			}
+		}
+		child.Skipped = p.shouldSkipByTags(child.Tags, filterTags)
+	}
+}
+
+// mergeTags returns the union of parent and child tags, preserving order.
+func mergeTags(parentTags, childTags []string) []string {
+	if len(parentTags) == 0 {
+		return childTags
+	}
+
+	merged := make([]string, 0, len(parentTags)+len(childTags))
+	seen := make(map[string]bool, len(parentTags)+len(childTags))
+	for _, tag := range append(append([]string(nil), parentTags...), childTags...) {
+		if !seen[tag] {
+			seen[tag] = true
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// allSkipped reports whether every step in the list was skipped during planning.
+func allSkipped(steps []config.Step) bool {
+	for _, step := range steps {
+		if !step.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
 // renderActionTemplates renders templates in a step's action fields
+//
 //nolint:gocyclo,dupl // Complexity necessary for handling all action types; similar patterns are intentional
 func (p *Planner) renderActionTemplates(step *config.Step, ctx *ExpansionContext) error {
 	if step.Shell != nil {
@@ -0,0 +1,199 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildTestPlan writes the config to a temp dir and builds a plan from it.
+func buildTestPlan(t *testing.T, configContent string, tags []string) *Plan {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	planner, err := NewPlanner()
+	if err != nil {
+		t.Fatalf("Failed to create planner: %v", err)
+	}
+	plan, err := planner.BuildPlan(PlannerConfig{
+		ConfigPath: configPath,
+		Tags:       tags,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build plan: %v", err)
+	}
+	return plan
+}
+
+func TestPlanner_Block_ExpandsSections(t *testing.T) {
+	plan := buildTestPlan(t, `version: "1.0"
+steps:
+  - name: Deploy
+    block:
+      - name: Run deploy
+        shell: echo deploy
+      - name: Verify
+        shell: echo verify
+    rescue:
+      - name: Roll back
+        shell: echo rollback
+    always:
+      - name: Clean up
+        shell: echo cleanup
+`, nil)
+
+	if len(plan.Steps) != 1 {
+		t.Fatalf("Expected 1 top-level step, got %d", len(plan.Steps))
+	}
+
+	block := plan.Steps[0]
+	if block.ActionType != "block" {
+		t.Errorf("ActionType = %q, want %q", block.ActionType, "block")
+	}
+	if block.ID != "step-0001" {
+		t.Errorf("block ID = %q, want %q", block.ID, "step-0001")
+	}
+	if len(block.Block) != 2 || len(block.Rescue) != 1 || len(block.Always) != 1 {
+		t.Fatalf("sections = %d/%d/%d, want 2/1/1", len(block.Block), len(block.Rescue), len(block.Always))
+	}
+
+	// IDs are assigned in document order
+	wantIDs := []string{"step-0002", "step-0003"}
+	for i, step := range block.Block {
+		if step.ID != wantIDs[i] {
+			t.Errorf("block[%d].ID = %q, want %q", i, step.ID, wantIDs[i])
+		}
+		if step.ActionType != "shell" {
+			t.Errorf("block[%d].ActionType = %q, want shell", i, step.ActionType)
+		}
+	}
+	if block.Rescue[0].ID != "step-0004" {
+		t.Errorf("rescue[0].ID = %q, want step-0004", block.Rescue[0].ID)
+	}
+	if block.Always[0].ID != "step-0005" {
+		t.Errorf("always[0].ID = %q, want step-0005", block.Always[0].ID)
+	}
+
+	// Nested steps keep their own source locations
+	if block.Block[0].Origin == nil || block.Block[0].Origin.Line != 5 {
+		t.Errorf("block[0].Origin = %+v, want line 5", block.Block[0].Origin)
+	}
+	if block.Rescue[0].Origin == nil || block.Rescue[0].Origin.Line != 10 {
+		t.Errorf("rescue[0].Origin = %+v, want line 10", block.Rescue[0].Origin)
+	}
+}
+
+func TestPlanner_Block_InheritsWhenAndBecome(t *testing.T) {
+	plan := buildTestPlan(t, `version: "1.0"
+steps:
+  - name: Linux setup
+    when: os == "linux"
+    become: true
+    become_user: admin
+    block:
+      - name: No condition
+        shell: echo one
+      - name: With condition
+        when: arch == "amd64"
+        shell: echo two
+      - name: Own user
+        become: true
+        become_user: postgres
+        shell: echo three
+`, nil)
+
+	steps := plan.Steps[0].Block
+	if steps[0].When != `os == "linux"` {
+		t.Errorf("block[0].When = %q, want parent condition", steps[0].When)
+	}
+	if want := `(os == "linux") && (arch == "amd64")`; steps[1].When != want {
+		t.Errorf("block[1].When = %q, want %q", steps[1].When, want)
+	}
+	if !steps[0].Become || steps[0].BecomeUser != "admin" {
+		t.Errorf("block[0] become = %v/%q, want true/admin", steps[0].Become, steps[0].BecomeUser)
+	}
+	if steps[2].BecomeUser != "postgres" {
+		t.Errorf("block[2].BecomeUser = %q, want postgres", steps[2].BecomeUser)
+	}
+}
+
+func TestPlanner_Block_InheritsTags(t *testing.T) {
+	plan := buildTestPlan(t, `version: "1.0"
+steps:
+  - name: Tagged block
+    tags: [deploy]
+    block:
+      - name: Untagged child
+        shell: echo one
+  - name: Untagged block
+    block:
+      - name: Matching child
+        tags: [deploy]
+        shell: echo two
+      - name: Other child
+        tags: [test]
+        shell: echo three
+  - name: Filtered block
+    block:
+      - name: Hidden
+        shell: echo four
+`, []string{"deploy"})
+
+	tagged := plan.Steps[0]
+	if tagged.Skipped || tagged.Block[0].Skipped {
+		t.Error("tagged block and its child should not be skipped")
+	}
+	if len(tagged.Block[0].Tags) != 1 || tagged.Block[0].Tags[0] != "deploy" {
+		t.Errorf("child tags = %v, want [deploy]", tagged.Block[0].Tags)
+	}
+
+	untagged := plan.Steps[1]
+	if untagged.Skipped {
+		t.Error("block with a matching child should not be skipped")
+	}
+	if untagged.Block[0].Skipped {
+		t.Error("matching child should not be skipped")
+	}
+	if !untagged.Block[1].Skipped {
+		t.Error("non-matching child should be skipped")
+	}
+
+	if !plan.Steps[2].Skipped {
+		t.Error("block without matching steps should be skipped")
+	}
+}
+
+func TestPlanner_Block_WithItems(t *testing.T) {
+	plan := buildTestPlan(t, `version: "1.0"
+vars:
+  services: [api, worker]
+steps:
+  - name: Restart {{ item }}
+    with_items: services
+    block:
+      - name: Stop {{ item }}
+        shell: echo stop {{ item }}
+`, nil)
+
+	if len(plan.Steps) != 2 {
+		t.Fatalf("Expected 2 block iterations, got %d", len(plan.Steps))
+	}
+
+	for i, want := range []string{"api", "worker"} {
+		child := plan.Steps[i].Block[0]
+		if child.Name != "Stop "+want {
+			t.Errorf("iteration %d child name = %q, want %q", i, child.Name, "Stop "+want)
+		}
+		if child.Shell.Cmd != "echo stop "+want {
+			t.Errorf("iteration %d child cmd = %q", i, child.Shell.Cmd)
+		}
+		if child.LoopContext == nil || child.LoopContext.Item != want {
+			t.Errorf("iteration %d child loop context = %+v, want item %q", i, child.LoopContext, want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+)
+
+// buildTestPlanError builds a plan from config content and returns the planner error.
+func buildTestPlanError(t *testing.T, configContent string) error {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "test.yml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	planner, err := NewPlanner()
+	if err != nil {
+		t.Fatalf("Failed to create planner: %v", err)
+	}
+	_, err = planner.BuildPlan(PlannerConfig{ConfigPath: configPath})
+	return err
+}
+
+func TestPlanner_DependsOn_Resolved(t *testing.T) {
+	plan := buildTestPlan(t, `version: "1.0"
+vars:
+  tools: [go, node]
+steps:
+  - name: Download {{ item }}
+    id: download
+    shell: echo {{ item }}
+    with_items: tools
+  - name: Install fzf
+    id: fzf
+    shell: echo fzf
+  - name: Link tools
+    shell: echo link
+    depends_on: [download, fzf]
+`, nil)
+
+	if len(plan.Steps) != 4 {
+		t.Fatalf("Expected 4 steps, got %d", len(plan.Steps))
+	}
+
+	for i := 0; i < 3; i++ {
+		if len(plan.Steps[i].DependsOn) != 0 {
+			t.Errorf("step %d DependsOn = %v, want none", i, plan.Steps[i].DependsOn)
+		}
+	}
+
+	// Loop iterations share the id, so the step depends on all of them
+	want := []string{plan.Steps[0].ID, plan.Steps[1].ID, plan.Steps[2].ID}
+	if got := plan.Steps[3].DependsOn; !reflect.DeepEqual(got, want) {
+		t.Errorf("DependsOn = %v, want %v", got, want)
+	}
+}
+
+func TestPlanner_DependsOn_Include(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "tools.yml"), []byte(`- name: Install ripgrep
+  shell: echo rg
+- name: Install jq
+  shell: echo jq
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(tmpDir, "main.yml")
+	if err := os.WriteFile(configPath, []byte(`version: "1.0"
+steps:
+  - name: Update index
+    id: update
+    shell: echo update
+  - id: tools
+    include: tools.yml
+    depends_on: [update]
+  - name: Done
+    shell: echo done
+    depends_on: [tools]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	planner, err := NewPlanner()
+	if err != nil {
+		t.Fatalf("Failed to create planner: %v", err)
+	}
+	plan, err := planner.BuildPlan(PlannerConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to build plan: %v", err)
+	}
+
+	if len(plan.Steps) != 4 {
+		t.Fatalf("Expected 4 steps, got %d", len(plan.Steps))
+	}
+	update := plan.Steps[0].ID
+	for _, step := range plan.Steps[1:3] {
+		if !reflect.DeepEqual(step.DependsOn, []string{update}) {
+			t.Errorf("included step %q DependsOn = %v, want [%s]", step.Name, step.DependsOn, update)
+		}
+	}
+	want := []string{plan.Steps[1].ID, plan.Steps[2].ID}
+	if got := plan.Steps[3].DependsOn; !reflect.DeepEqual(got, want) {
+		t.Errorf("DependsOn = %v, want %v", got, want)
+	}
+}
+
+func TestPlanner_DependsOn_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name: "unknown id",
+			config: `steps:
+  - name: A
+    shell: echo a
+    depends_on: [missing]
+`,
+			wantErr: `unknown step id "missing"`,
+		},
+		{
+			name: "later step",
+			config: `steps:
+  - name: A
+    shell: echo a
+    depends_on: [b]
+  - name: B
+    id: b
+    shell: echo b
+`,
+			wantErr: "must be defined before it",
+		},
+		{
+			name: "duplicate id",
+			config: `steps:
+  - name: A
+    id: a
+    shell: echo a
+  - name: B
+    id: a
+    shell: echo b
+`,
+			wantErr: `duplicate step id "a"`,
+		},
+		{
+			name: "id inside block",
+			config: `steps:
+  - name: Group
+    block:
+      - name: A
+        id: a
+        shell: echo a
+`,
+			wantErr: "only supported on top-level steps",
+		},
+		{
+			name: "depends_on in handler",
+			config: `steps:
+  - name: A
+    id: a
+    shell: echo a
+handlers:
+  - name: restart
+    shell: echo restart
+    depends_on: [a]
+`,
+			wantErr: "only supported on top-level steps",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := buildTestPlanError(t, tt.config)
+			if err == nil {
+				t.Fatal("BuildPlan() should fail")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlanner_Strategy_Sequential(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "downloads.yml"), []byte(`strategy: parallel
+steps:
+  - name: Download go
+    shell: echo go
+  - name: Download node
+    shell: echo node
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(tmpDir, "main.yml")
+	if err := os.WriteFile(configPath, []byte(`strategy: sequential
+vars:
+  targets: [a, b]
+steps:
+  - name: Prepare
+    shell: echo prepare
+  - include: downloads.yml
+  - name: Finish {{ item }}
+    shell: echo {{ item }}
+    with_items: targets
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	planner, err := NewPlanner()
+	if err != nil {
+		t.Fatalf("Failed to create planner: %v", err)
+	}
+	plan, err := planner.BuildPlan(PlannerConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to build plan: %v", err)
+	}
+
+	if plan.Strategy != "sequential" {
+		t.Errorf("Strategy = %q, want sequential", plan.Strategy)
+	}
+	if len(plan.Steps) != 5 {
+		t.Fatalf("Expected 5 steps, got %d", len(plan.Steps))
+	}
+
+	ids := make([]string, len(plan.Steps))
+	for i, step := range plan.Steps {
+		ids[i] = step.ID
+	}
+	want := [][]string{
+		nil,
+		{ids[0]},         // included steps follow the previous step...
+		{ids[0]},         // ...but run in parallel with each other
+		{ids[1], ids[2]}, // the next step waits for the whole include
+		{ids[1], ids[2], ids[3]},
+	}
+	for i, step := range plan.Steps {
+		if !reflect.DeepEqual(step.DependsOn, want[i]) {
+			t.Errorf("step %d (%s) DependsOn = %v, want %v", i, step.Name, step.DependsOn, want[i])
+		}
+	}
+}
+
+func TestPlanner_ImplicitDependencies(t *testing.T) {
+	plan := buildTestPlan(t, `version: "1.0"
+steps:
+  - name: Check version
+    shell: go version
+    register: go_version
+  - name: Unrelated
+    shell: echo unrelated
+  - name: Upgrade
+    shell: echo upgrade
+    when: go_version.rc != 0
+  - name: Flush
+    flush_handlers: true
+  - name: After flush
+    shell: echo after
+`, nil)
+
+	if len(plan.Steps) != 5 {
+		t.Fatalf("Expected 5 steps, got %d", len(plan.Steps))
+	}
+
+	ids := make([]string, len(plan.Steps))
+	for i, step := range plan.Steps {
+		ids[i] = step.ID
+	}
+	want := [][]string{
+		nil,
+		nil,
+		{ids[0]},                 // reads a variable registered by the first step
+		{ids[0], ids[1], ids[2]}, // flush_handlers waits for every earlier step
+		{ids[3]},                 // and later steps wait for it
+	}
+	for i, step := range plan.Steps {
+		if !reflect.DeepEqual(step.DependsOn, want[i]) {
+			t.Errorf("step %d (%s) DependsOn = %v, want %v", i, step.Name, step.DependsOn, want[i])
+		}
+	}
+}
+
+func TestStepVariables(t *testing.T) {
+	items := "{{ packages }}"
+	step := config.Step{
+		Name:      "install",
+		When:      "os == 'linux'",
+		WithItems: &items,
+		Shell:     &config.ShellAction{Cmd: `echo "{{ item }}" {{ prefix.path }}`},
+		Block: []config.Step{
+			{
+				Name:       "nested",
+				FailedWhen: "probe.rc != 0",
+				Print:      &config.PrintAction{Msg: "{{ greeting }}"},
+			},
+		},
+	}
+
+	got := make(map[string]bool)
+	for _, name := range StepVariables(step) {
+		got[name] = true
+	}
+	for _, name := range []string{"os", "packages", "item", "prefix", "probe", "greeting"} {
+		if !got[name] {
+			t.Errorf("StepVariables() missing %q, got %v", name, got)
+		}
+	}
+	for _, name := range []string{"linux", "path", "rc", "echo"} {
+		if got[name] {
+			t.Errorf("StepVariables() should not include %q", name)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package plan
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanner_Handlers_Compiled(t *testing.T) {
+	plan := buildTestPlan(t, `version: "1.0"
+steps:
+  - name: Write config
+    shell: echo config
+    notify: [restart app]
+    tags: [deploy]
+handlers:
+  - name: restart app
+    shell: echo restart
+`, []string{"deploy"})
+
+	if len(plan.Steps) != 1 {
+		t.Fatalf("Expected 1 step, got %d", len(plan.Steps))
+	}
+	if got := plan.Steps[0].Notify; len(got) != 1 || got[0] != "restart app" {
+		t.Errorf("Notify = %v, want [restart app]", got)
+	}
+
+	if len(plan.Handlers) != 1 {
+		t.Fatalf("Expected 1 handler, got %d", len(plan.Handlers))
+	}
+	handler := plan.Handlers[0]
+	if handler.ID == "" || handler.ID == plan.Steps[0].ID {
+		t.Errorf("handler ID = %q, want a unique step ID", handler.ID)
+	}
+	// Handlers are not filtered by tags
+	if handler.Skipped {
+		t.Error("handler should not be skipped by tag filter")
+	}
+	if handler.Origin == nil || handler.Origin.Line == 0 {
+		t.Error("handler should have origin with line information")
+	}
+}
+
+func TestPlanner_Handlers_UnknownNotify(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yml")
+	content := `version: "1.0"
+steps:
+  - name: Write config
+    shell: echo config
+    notify: [missing]
+handlers:
+  - name: restart app
+    shell: echo restart
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	planner, err := NewPlanner()
+	if err != nil {
+		t.Fatalf("Failed to create planner: %v", err)
+	}
+	_, err = planner.BuildPlan(PlannerConfig{ConfigPath: configPath})
+	if err == nil {
+		t.Fatal("Expected error for unknown handler")
+	}
+	if !strings.Contains(err.Error(), `unknown handler "missing"`) {
+		t.Errorf("error = %v, want unknown handler error", err)
+	}
+}
+
+func TestPlanner_Handlers_FromInclude(t *testing.T) {
+	tmpDir := t.TempDir()
+	included := `version: "1.0"
+steps:
+  - name: Install service
+    shell: echo install
+    notify: [reload service]
+handlers:
+  - name: reload service
+    shell: echo reload
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "service.yml"), []byte(included), 0644); err != nil {
+		t.Fatalf("Failed to write included config: %v", err)
+	}
+
+	configPath := filepath.Join(tmpDir, "main.yml")
+	content := `version: "1.0"
+steps:
+  - include: service.yml
+  - name: Flush
+    flush_handlers: true
+handlers:
+  - name: restart app
+    shell: echo restart
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	planner, err := NewPlanner()
+	if err != nil {
+		t.Fatalf("Failed to create planner: %v", err)
+	}
+	plan, err := planner.BuildPlan(PlannerConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to build plan: %v", err)
+	}
+
+	names := make([]string, 0, len(plan.Handlers))
+	for _, handler := range plan.Handlers {
+		names = append(names, handler.Name)
+	}
+	if strings.Join(names, ",") != "reload service,restart app" {
+		t.Errorf("handlers = %v, want [reload service restart app]", names)
+	}
+
+	last := plan.Steps[len(plan.Steps)-1]
+	if last.ActionType != "flush_handlers" {
+		t.Errorf("ActionType = %q, want %q", last.ActionType, "flush_handlers")
+	}
+}
@@ -916,3 +916,65 @@ steps:
 		t.Error("Both steps point to file2.txt - expected different files")
 	}
 }
+
+func TestPlanner_Secrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "main.yml")
+	writeFile := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	writeFile(configPath, `vars:
+  db_password: planner-secret-password
+secrets: [db_password]
+steps:
+  - name: Connect
+    shell: connect --password {{ db_password }}
+  - include: extra.yml
+`)
+	writeFile(filepath.Join(tmpDir, "extra.yml"), `secrets: [db_password, api_key]
+steps:
+  - name: Call
+    shell: 'curl -H "Key: {{ api_key }}"'
+`)
+
+	planner, err := NewPlanner()
+	if err != nil {
+		t.Fatalf("Failed to create planner: %v", err)
+	}
+	p, err := planner.BuildPlan(PlannerConfig{
+		ConfigPath: configPath,
+		Variables:  map[string]interface{}{"api_key": "planner-secret-key"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build plan: %v", err)
+	}
+
+	if len(p.Secrets) != 2 || p.Secrets[0] != "db_password" || p.Secrets[1] != "api_key" {
+		t.Errorf("Secrets = %v, want [db_password api_key]", p.Secrets)
+	}
+	if p.Redacted || p.Steps[0].Shell.Cmd != "connect --password planner-secret-password" {
+		t.Errorf("BuildPlan() should keep the secrets in the plan it returns")
+	}
+
+	redacted := p.Redact()
+	if !redacted.Redacted {
+		t.Error("Redact() should mark the plan as redacted")
+	}
+	if got := redacted.Steps[0].Shell.Cmd; got != "connect --password [REDACTED]" {
+		t.Errorf("redacted step command = %q", got)
+	}
+	if got := redacted.Steps[1].Shell.Cmd; got != `curl -H "Key: [REDACTED]"` {
+		t.Errorf("redacted step command = %q", got)
+	}
+	if got := redacted.InitialVars["db_password"]; got != "[REDACTED]" {
+		t.Errorf("redacted initial variable = %v", got)
+	}
+	if p.Steps[0].Shell.Cmd != "connect --password planner-secret-password" {
+		t.Error("Redact() modified the plan")
+	}
+	if again := redacted.Redact(); again != redacted {
+		t.Error("Redact() of a redacted plan should return it unchanged")
+	}
+}
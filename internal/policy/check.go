@@ -0,0 +1,237 @@
+package policy
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/pathutil"
+	"github.com/alehatsman/mooncake/internal/plan"
+	"github.com/alehatsman/mooncake/internal/template"
+)
+
+// Violation is something a step does that the policy doesn't allow.
+type Violation struct {
+	Rule    string // become, actions, commands, paths, hosts, tags or max_files
+	Message string
+}
+
+// ViolationError is the error of a step that violates the policy.
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return "policy violation: " + strings.Join(messages, "; ")
+}
+
+// check returns the violations of the rules that apply to each step on its own.
+func (p *Policy) check(subject Subject) []Violation {
+	var violations []Violation
+	add := func(rule, format string, args ...interface{}) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if subject.Become && p.Become != nil && !*p.Become {
+		add("become", "become is not allowed")
+	}
+	if !p.Actions.allows(subject.Action, matchName) {
+		add("actions", "action %s is not allowed", subject.Action)
+	}
+	for _, command := range subject.Commands {
+		if !p.Commands.allows(command, matchCommand) {
+			add("commands", "command %s is not allowed", command)
+		}
+	}
+	for _, path := range subject.Paths {
+		if !p.Paths.allows(path, matchPath) {
+			add("paths", "writing %s is not allowed", path)
+		}
+	}
+	if p.Paths != nil || p.MaxFiles > 0 {
+		for _, write := range subject.Unchecked {
+			add("paths", "writing %s is not allowed: its path isn't known before it's written", write)
+		}
+	}
+	if p.Hosts != nil {
+		for _, rawURL := range subject.URLs {
+			parsed, err := url.Parse(rawURL)
+			if err != nil || parsed.Hostname() == "" {
+				add("hosts", "fetching %s is not allowed: no host", rawURL)
+			} else if !p.Hosts.allows(parsed.Hostname(), matchHost) {
+				add("hosts", "fetching from %s is not allowed", parsed.Hostname())
+			}
+		}
+	}
+	for _, tag := range subject.Tags {
+		if !p.Tags.allows(tag, matchName) {
+			add("tags", "tag %s is not allowed", tag)
+		}
+	}
+	return violations
+}
+
+// Enforcer checks the steps of a run against a policy, counting the files they
+// write towards MaxFiles. It is safe for concurrent use.
+type Enforcer struct {
+	policy *Policy
+
+	mu    sync.Mutex
+	files map[string]bool
+}
+
+// NewEnforcer returns an enforcer of the policy for a run.
+func (p *Policy) NewEnforcer() *Enforcer {
+	return &Enforcer{policy: p, files: make(map[string]bool)}
+}
+
+// Check returns the violations of a step.
+func (e *Enforcer) Check(subject Subject) []Violation {
+	violations := e.policy.check(subject)
+	if e.policy.MaxFiles == 0 || len(violations) > 0 {
+		return violations
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var added []string
+	for _, path := range subject.Paths {
+		if e.files[path] {
+			continue
+		}
+		if len(e.files) >= e.policy.MaxFiles {
+			violations = append(violations, Violation{
+				Rule:    "max_files",
+				Message: fmt.Sprintf("writing %s exceeds the limit of %d files", path, e.policy.MaxFiles),
+			})
+			continue
+		}
+		e.files[path] = true
+		added = append(added, path)
+	}
+	if len(violations) > 0 {
+		// The step doesn't run, so its files don't count
+		for _, path := range added {
+			delete(e.files, path)
+		}
+	}
+	return violations
+}
+
+// unknownVariable returns a variable the templates in text use that isn't
+// defined, or "".
+func unknownVariable(text string, variables map[string]interface{}) string {
+	for _, expr := range template.Expressions(text) {
+		for _, name := range template.Variables(expr) {
+			if _, ok := variables[name]; !ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// CheckPlan checks the steps and handlers of a plan against the policy and
+// returns the violations as errors at the origins of the steps.
+//
+// Fields are rendered with the initial variables of the plan and the loop
+// variables of the step. Fields using other variables, such as the results
+// registered by earlier steps, are only known at runtime and left to the
+// Enforcer.
+func (p *Policy) CheckPlan(pl *plan.Plan) ([]config.Diagnostic, error) {
+	renderer, err := template.NewPongo2Renderer()
+	if err != nil {
+		return nil, err
+	}
+	pathExpander := pathutil.NewPathExpander(renderer)
+	variables := maps.Clone(pl.InitialVars)
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	enforcer := p.NewEnforcer()
+
+	var diagnostics []config.Diagnostic
+	var walk func(steps []config.Step)
+	walk = func(steps []config.Step) {
+		for i := range steps {
+			step := &steps[i]
+			if step.Skipped {
+				continue
+			}
+
+			currentDir := filepath.Dir(pl.RootFile)
+			if step.Origin != nil && step.Origin.FilePath != "" {
+				currentDir = filepath.Dir(step.Origin.FilePath)
+			}
+			delete(variables, "item")
+			delete(variables, "index")
+			delete(variables, "first")
+			delete(variables, "last")
+			if loop := step.LoopContext; loop != nil {
+				variables["item"], variables["index"] = loop.Item, loop.Index
+				variables["first"], variables["last"] = loop.First, loop.Last
+			}
+
+			// A field with unknown variables fails to render and is left out
+			known := func(text string) error {
+				if name := unknownVariable(text, variables); name != "" {
+					return fmt.Errorf("%s is only known at runtime", name)
+				}
+				return nil
+			}
+			subject, _ := Describe(step, Resolver{
+				Render: func(text string) (string, error) {
+					if err := known(text); err != nil {
+						return "", err
+					}
+					return renderer.Render(text, variables)
+				},
+				ExpandPath: func(path string) (string, error) {
+					if err := known(path); err != nil {
+						return "", err
+					}
+					return pathExpander.ExpandPath(path, currentDir, variables)
+				},
+			})
+
+			for _, violation := range enforcer.Check(subject) {
+				diagnostic := config.Diagnostic{
+					FilePath: pl.RootFile,
+					Message:  fmt.Sprintf("%s: %s", stepName(step), violation.Message),
+					Severity: "error",
+				}
+				if step.Origin != nil {
+					diagnostic.FilePath = step.Origin.FilePath
+					diagnostic.Line, diagnostic.Column = step.Origin.Line, step.Origin.Column
+				}
+				diagnostics = append(diagnostics, diagnostic)
+			}
+
+			walk(step.Block)
+			walk(step.Rescue)
+			walk(step.Always)
+			if step.ArtifactCapture != nil {
+				walk(step.ArtifactCapture.Steps)
+			}
+		}
+	}
+	walk(pl.Steps)
+	walk(pl.Handlers)
+	return diagnostics, nil
+}
+
+// stepName names a step in diagnostics.
+func stepName(step *config.Step) string {
+	if step.Name != "" {
+		return fmt.Sprintf("step %q", step.Name)
+	}
+	return step.DetermineActionType() + " step"
+}
@@ -0,0 +1,265 @@
+// Package policy constrains what the steps of a plan may do: the actions they
+// use, the paths they write, the hosts they fetch from, the programs they run
+// and whether they run with become.
+//
+// A policy is checked against the expanded plan before a run (CheckPlan) and
+// again against every step the executor runs (Enforcer), with the values the
+// step has at runtime.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is a declarative rule set. Rules that aren't set don't restrict
+// anything, so the zero Policy allows everything.
+type Policy struct {
+	// Become allows steps to run with become when unset or true.
+	Become *bool `yaml:"become"`
+
+	// Actions are the action types steps may use (e.g. "shell", "download").
+	Actions *Rules `yaml:"actions"`
+
+	// Commands are the programs shell, command, wait and assert steps may run,
+	// by name (e.g. "git") or absolute path.
+	Commands *Rules `yaml:"commands"`
+
+	// Paths are globs of the paths steps may write; "**" matches any number of
+	// directories. Relative globs are relative to the directory of the policy file.
+	Paths *Rules `yaml:"paths"`
+
+	// Hosts are the hosts steps may fetch URLs from; "*.example.com" matches
+	// the subdomains of example.com.
+	Hosts *Rules `yaml:"hosts"`
+
+	// Tags are the tags steps may have.
+	Tags *Rules `yaml:"tags"`
+
+	// MaxFiles limits the number of distinct paths the steps of a run write.
+	// Zero means no limit.
+	MaxFiles int `yaml:"max_files"`
+}
+
+// Rules allow and deny values by glob pattern. A value is denied if it matches
+// a Deny pattern, or if Allow is set (even to an empty list) and it matches no
+// Allow pattern.
+type Rules struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// Load reads a policy file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is user-provided CLI argument
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data, filepath.Dir(absPath))
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses a policy. Relative path globs are made relative to dir.
+func Parse(data []byte, dir string) (*Policy, error) {
+	p := &Policy{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if p.MaxFiles < 0 {
+		return nil, fmt.Errorf("max_files must not be negative")
+	}
+
+	for name, rules := range map[string]*Rules{
+		"actions":  p.Actions,
+		"commands": p.Commands,
+		"paths":    p.Paths,
+		"hosts":    p.Hosts,
+		"tags":     p.Tags,
+	} {
+		if rules == nil {
+			continue
+		}
+		for _, pattern := range append(append([]string{}, rules.Allow...), rules.Deny...) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%s: invalid pattern %q", name, pattern)
+			}
+		}
+	}
+	if p.Paths != nil {
+		p.Paths = &Rules{
+			Allow: absolutePatterns(p.Paths.Allow, dir),
+			Deny:  absolutePatterns(p.Paths.Deny, dir),
+		}
+	}
+	return p, nil
+}
+
+// ForAgent returns the policy of agent runs that aren't given one: steps may
+// only write under root, can't use become, fetch URLs, install packages or
+// manage services.
+func ForAgent(root string) *Policy {
+	become := false
+	return &Policy{
+		Become:  &become,
+		Actions: &Rules{Deny: []string{"package", "service"}},
+		Paths:   &Rules{Allow: absolutePatterns([]string{"**"}, root)},
+		Hosts:   &Rules{Allow: []string{}},
+	}
+}
+
+// absolutePatterns makes relative path globs relative to dir, and resolves the
+// symlinks of their literal leading directories, as paths are matched once
+// resolved. Globs starting with "**" match anywhere and are kept.
+func absolutePatterns(patterns []string, dir string) []string {
+	if patterns == nil {
+		return nil
+	}
+	absolute := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		switch {
+		case strings.HasPrefix(pattern, "~/"):
+			pattern = filepath.Join(os.Getenv("HOME"), pattern[2:])
+		case !filepath.IsAbs(pattern) && (pattern == "**" || !strings.HasPrefix(pattern, "**")):
+			pattern = filepath.Join(dir, pattern)
+		}
+		absolute = append(absolute, resolvePattern(pattern))
+	}
+	return absolute
+}
+
+// allows reports whether the rules allow a value, matched with match.
+func (r *Rules) allows(value string, match func(pattern, value string) bool) bool {
+	if r == nil {
+		return true
+	}
+	for _, pattern := range r.Deny {
+		if match(pattern, value) {
+			return false
+		}
+	}
+	if r.Allow == nil {
+		return true
+	}
+	for _, pattern := range r.Allow {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchName matches action types and tags.
+func matchName(pattern, value string) bool {
+	matched, _ := filepath.Match(pattern, value)
+	return matched
+}
+
+// matchCommand matches programs: patterns with a slash match the path the
+// program is run by, others its base name.
+func matchCommand(pattern, command string) bool {
+	if !strings.Contains(pattern, "/") {
+		command = filepath.Base(command)
+	}
+	matched, _ := filepath.Match(pattern, command)
+	return matched
+}
+
+// matchHost matches host names case-insensitively.
+func matchHost(pattern, host string) bool {
+	matched, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(host))
+	return matched
+}
+
+// matchPath matches absolute paths against globs, where "**" matches any
+// number of path elements, including none.
+func matchPath(pattern, path string) bool {
+	return matchElements(splitPath(pattern), splitPath(path))
+}
+
+// maxLinks bounds the dangling symlinks resolvePath follows, so link cycles end.
+const maxLinks = 40
+
+// resolvePath resolves the symlinks of an absolute path the way a write to it
+// would: the deepest existing ancestor is resolved with filepath.EvalSymlinks,
+// and a dangling symlink is followed to the target a write would create.
+// Elements that don't exist yet are kept as they are.
+func resolvePath(path string) string {
+	return resolveLinks(filepath.Clean(path), 0)
+}
+
+func resolveLinks(path string, depth int) string {
+	existing, rest := path, ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(existing); err == nil {
+			return filepath.Join(resolved, rest)
+		}
+		if target, err := os.Readlink(existing); err == nil && depth < maxLinks {
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(existing), target)
+			}
+			return resolveLinks(filepath.Join(target, rest), depth+1)
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return path
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// resolvePattern resolves the symlinks of the leading elements of an absolute
+// glob that have no wildcards.
+func resolvePattern(pattern string) string {
+	if !filepath.IsAbs(pattern) {
+		return pattern
+	}
+	elements := splitPath(pattern)
+	literal := 0
+	for literal < len(elements) && !strings.ContainsAny(elements[literal], `*?[\`) {
+		literal++
+	}
+	prefix := resolvePath(string(filepath.Separator) + filepath.Join(elements[:literal]...))
+	return filepath.Join(append([]string{prefix}, elements[literal:]...)...)
+}
+
+func splitPath(path string) []string {
+	return strings.FieldsFunc(filepath.ToSlash(path), func(r rune) bool { return r == '/' })
+}
+
+func matchElements(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchElements(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if matched, _ := filepath.Match(pattern[0], path[0]); !matched {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
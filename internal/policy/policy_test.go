@@ -0,0 +1,222 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/config"
+	"github.com/alehatsman/mooncake/internal/plan"
+)
+
+func mustParse(t *testing.T, data string) *Policy {
+	t.Helper()
+	p, err := Parse([]byte(data), "/repo")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return p
+}
+
+// rules returns the rules of the violations.
+func rules(violations []Violation) []string {
+	var names []string
+	for _, violation := range violations {
+		names = append(names, violation.Rule)
+	}
+	return names
+}
+
+func TestParse(t *testing.T) {
+	p := mustParse(t, `
+become: false
+paths:
+  allow: [src, "**/*.md", /tmp/**]
+hosts:
+  allow: []
+`)
+	if want := []string{"/repo/src", "**/*.md", "/tmp/**"}; strings.Join(p.Paths.Allow, ",") != strings.Join(want, ",") {
+		t.Errorf("paths.allow = %q, want %q", p.Paths.Allow, want)
+	}
+	if p.Hosts == nil || p.Hosts.Allow == nil {
+		t.Error("hosts.allow = nil, want an empty allowlist")
+	}
+
+	for name, data := range map[string]string{
+		"unknown field":     "becom: false",
+		"negative limit":    "max_files: -1",
+		"invalid pattern":   "actions: {deny: ['[']}",
+		"invalid rule list": "tags: [a]",
+	} {
+		if _, err := Parse([]byte(data), "/repo"); err == nil {
+			t.Errorf("%s: Parse(%q) error = nil", name, data)
+		}
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	p := mustParse(t, `
+become: false
+actions:
+  deny: [package]
+commands:
+  allow: [git, go, /usr/local/bin/*]
+paths:
+  allow: ["**"]
+  deny: [.git/**, "**/*.pem"]
+hosts:
+  allow: [example.com, "*.example.com"]
+tags:
+  deny: [dangerous]
+`)
+
+	tests := []struct {
+		name    string
+		subject Subject
+		want    []string
+	}{
+		{"allowed", Subject{
+			Action:   "shell",
+			Commands: []string{"git", "/usr/bin/go", "/usr/local/bin/tool"},
+			Paths:    []string{"/repo/main.go"},
+			URLs:     []string{"https://EXAMPLE.com/a", "https://cdn.example.com/b"},
+			Tags:     []string{"build"},
+		}, nil},
+		{"become", Subject{Action: "shell", Become: true}, []string{"become"}},
+		{"denied action", Subject{Action: "package"}, []string{"actions"}},
+		{"command not allowed", Subject{Action: "shell", Commands: []string{"curl", "$CMD", "/opt/bin/git2"}}, []string{"commands", "commands", "commands"}},
+		{"denied paths", Subject{Action: "file", Paths: []string{"/repo/.git/config", "/repo/keys/id.pem"}}, []string{"paths", "paths"}},
+		{"path outside root", Subject{Action: "file", Paths: []string{"/etc/passwd"}}, []string{"paths"}},
+		{"unchecked write", Subject{Action: "service", Unchecked: []string{"the unit file of service app"}}, []string{"paths"}},
+		{"unknown host", Subject{Action: "download", URLs: []string{"https://example.org/x", "file:///etc/passwd"}}, []string{"hosts", "hosts"}},
+		{"denied tag", Subject{Action: "shell", Tags: []string{"dangerous"}}, []string{"tags"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules(p.NewEnforcer().Check(tt.subject))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Check() rules = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_PathsDefaultToPolicyDir(t *testing.T) {
+	p := mustParse(t, "paths: {allow: [src/**]}")
+	for path, want := range map[string]bool{
+		"/repo/src":         true,
+		"/repo/src/a/b.go":  true,
+		"/repo/srcs/a.go":   false,
+		"/other/src/a.go":   false,
+		"/repo/src/../x.go": false,
+	} {
+		violations := p.NewEnforcer().Check(Subject{Paths: []string{filepath.Clean(path)}})
+		if got := len(violations) == 0; got != want {
+			t.Errorf("writing %s allowed = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestEnforcer_MaxFiles(t *testing.T) {
+	enforcer := mustParse(t, "max_files: 2").NewEnforcer()
+
+	if violations := enforcer.Check(Subject{Paths: []string{"/a", "/b"}}); len(violations) != 0 {
+		t.Fatalf("Check(/a, /b) = %v, want none", violations)
+	}
+	// Files written before don't count again
+	if violations := enforcer.Check(Subject{Paths: []string{"/a"}}); len(violations) != 0 {
+		t.Errorf("Check(/a) = %v, want none", violations)
+	}
+	if got := rules(enforcer.Check(Subject{Paths: []string{"/c"}})); len(got) != 1 || got[0] != "max_files" {
+		t.Errorf("Check(/c) rules = %q, want max_files", got)
+	}
+}
+
+func TestForAgent(t *testing.T) {
+	enforcer := ForAgent("/work/repo").NewEnforcer()
+
+	if violations := enforcer.Check(Subject{Action: "file", Paths: []string{"/work/repo/main.go"}}); len(violations) != 0 {
+		t.Errorf("writing in the repo = %v, want allowed", violations)
+	}
+	for name, subject := range map[string]Subject{
+		"become":   {Action: "shell", Become: true},
+		"package":  {Action: "package"},
+		"outside":  {Action: "file", Paths: []string{"/work/other"}},
+		"download": {Action: "download", URLs: []string{"https://example.com/x"}},
+	} {
+		if violations := enforcer.Check(subject); len(violations) == 0 {
+			t.Errorf("%s: Check() = none, want a violation", name)
+		}
+	}
+}
+
+func TestPolicy_CheckPlan(t *testing.T) {
+	root := "/repo/config.yml"
+	origin := &config.Origin{FilePath: "/repo/tasks/write.yml", Line: 4, Column: 3}
+	p := mustParse(t, `
+become: false
+paths: {allow: [out/**]}
+`)
+	pl := &plan.Plan{
+		RootFile:    root,
+		InitialVars: map[string]interface{}{"dir": "out"},
+		Steps: []config.Step{
+			{Name: "allowed", File: &config.File{Path: "../{{ dir }}/a.txt"}, Origin: origin},
+			{Name: "outside", File: &config.File{Path: "/etc/{{ item }}"}, Origin: origin,
+				LoopContext: &config.LoopContext{Item: "hosts"}},
+			{Name: "registered", File: &config.File{Path: "{{ result.stdout }}"}, Origin: origin},
+			{Name: "skipped", File: &config.File{Path: "/etc/skipped"}, Skipped: true},
+			{Name: "group", Block: []config.Step{
+				{Name: "nested", Shell: &config.ShellAction{Cmd: "true"}, Become: true, Origin: origin},
+			}},
+		},
+	}
+
+	diagnostics, err := p.CheckPlan(pl)
+	if err != nil {
+		t.Fatalf("CheckPlan() error = %v", err)
+	}
+	if len(diagnostics) != 2 {
+		t.Fatalf("CheckPlan() = %v, want 2 diagnostics", diagnostics)
+	}
+	for i, want := range []string{`step "outside": writing /etc/hosts is not allowed`, `step "nested": become is not allowed`} {
+		diagnostic := diagnostics[i]
+		if diagnostic.Message != want || diagnostic.Severity != "error" {
+			t.Errorf("diagnostic %d = %q (%s), want %q", i, diagnostic.Message, diagnostic.Severity, want)
+		}
+		if diagnostic.FilePath != origin.FilePath || diagnostic.Line != 4 || diagnostic.Column != 3 {
+			t.Errorf("diagnostic %d location = %s:%d:%d, want the step origin", i, diagnostic.FilePath, diagnostic.Line, diagnostic.Column)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	root, _ := filepath.EvalSymlinks(t.TempDir())
+	outside, _ := filepath.EvalSymlinks(t.TempDir())
+	if err := os.Symlink(outside, filepath.Join(root, "out")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing"), filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		filepath.Join(root, "a", "b"):              filepath.Join(root, "a", "b"),
+		filepath.Join(root, "out", "new", "x.txt"): filepath.Join(outside, "new", "x.txt"),
+		filepath.Join(root, "dangling", "x.txt"):   filepath.Join(outside, "missing", "x.txt"),
+	} {
+		if got := resolvePath(path); got != want {
+			t.Errorf("resolvePath(%s) = %s, want %s", path, got, want)
+		}
+	}
+
+	p, err := Parse([]byte("paths: {allow: ['**']}"), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if violations := p.NewEnforcer().Check(Subject{Paths: []string{resolvePath(filepath.Join(root, "out", "x.txt"))}}); len(violations) != 1 {
+		t.Errorf("writing through a symlink out of the allowed paths = %v, want a violation", violations)
+	}
+}
@@ -0,0 +1,290 @@
+package policy
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Builtins that can't run other programs, which commands rules don't apply to.
+var harmlessBuiltins = map[string]bool{
+	":": true, "[": true, "[[": true, "cd": true, "echo": true, "exit": true,
+	"export": true, "false": true, "local": true, "printf": true, "pwd": true,
+	"read": true, "readonly": true, "return": true, "set": true, "shift": true,
+	"test": true, "true": true, "umask": true, "unset": true,
+}
+
+// Reserved words that precede a command or stand alone.
+var shellKeywords = map[string]bool{
+	"!": true, "{": true, "}": true, "do": true, "done": true, "elif": true,
+	"else": true, "esac": true, "fi": true, "if": true, "then": true,
+	"time": true, "until": true, "while": true,
+}
+
+// Reserved words whose command is a loop header, case word or function name.
+var shellHeaders = map[string]bool{
+	"case": true, "for": true, "function": true, "select": true,
+}
+
+var assignmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\+?=`)
+
+// ShellCommands returns the programs a POSIX shell script runs: the first word
+// of every simple command, including those in command and process
+// substitutions. Builtins that can't run other programs are left out.
+//
+// The script is read, not evaluated: a program named by a variable or a
+// command substitution is returned as written (e.g. "$CC" or "$(...)").
+func ShellCommands(script string) []string {
+	s := &shellScanner{src: script}
+	s.scan(0)
+	return s.commands
+}
+
+// shellScanner splits a shell script into simple commands.
+type shellScanner struct {
+	src string
+	pos int
+
+	commands []string
+	words    []string // Words of the current simple command
+	word     strings.Builder
+	inWord   bool
+
+	redirect   bool     // The next word is the target of a redirection
+	heredoc    bool     // The next word is the delimiter of a heredoc
+	nextStrips bool     // The heredoc of the next word is <<-
+	heredocs   []string // Delimiters of the heredocs starting on the next line
+	stripTabs  []bool   // Whether each heredoc is <<-
+	parenDepth int      // Open subshells
+}
+
+// scan reads commands up to end: 0 for the end of the script, ')' for a
+// command or process substitution and '`' for a backquoted one.
+func (s *shellScanner) scan(end byte) {
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case c == end && (end != ')' || s.parenDepth == 0):
+			s.pos++
+			s.endCommand()
+			return
+		case c == '\\':
+			if s.pos+1 < len(s.src) && s.src[s.pos+1] != '\n' {
+				s.word.WriteByte(s.src[s.pos+1])
+				s.inWord = true
+			}
+			s.pos += 2
+		case c == '\'':
+			closing := strings.IndexByte(s.src[s.pos+1:], '\'')
+			if closing < 0 {
+				closing = len(s.src) - s.pos - 1
+			}
+			s.word.WriteString(s.src[s.pos+1 : s.pos+1+closing])
+			s.inWord = true
+			s.pos += closing + 2
+		case c == '"':
+			s.pos++
+			s.scanDoubleQuoted()
+		case c == '$' || c == '`':
+			s.scanExpansion()
+		case c == '#' && !s.inWord:
+			for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+		case c == ' ' || c == '\t':
+			s.endWord()
+			s.pos++
+		case c == '\n':
+			s.pos++
+			s.endCommand()
+			s.skipHeredocs()
+		case c == ';' || c == '&' || c == '|':
+			s.pos++
+			s.endCommand()
+		case c == '(':
+			s.pos++
+			s.parenDepth++
+			s.endCommand()
+		case c == ')':
+			s.pos++
+			if s.parenDepth > 0 {
+				s.parenDepth--
+			}
+			s.endCommand()
+		case c == '<' || c == '>':
+			s.scanRedirection()
+		default:
+			s.word.WriteByte(c)
+			s.inWord = true
+			s.pos++
+		}
+	}
+	s.endCommand()
+}
+
+// scanDoubleQuoted reads the rest of a double-quoted string.
+func (s *shellScanner) scanDoubleQuoted() {
+	s.inWord = true
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case c == '"':
+			s.pos++
+			return
+		case c == '\\' && s.pos+1 < len(s.src) && strings.IndexByte("$`\"\\\n", s.src[s.pos+1]) >= 0:
+			if s.src[s.pos+1] != '\n' {
+				s.word.WriteByte(s.src[s.pos+1])
+			}
+			s.pos += 2
+		case c == '$' || c == '`':
+			s.scanExpansion()
+		default:
+			s.word.WriteByte(c)
+			s.pos++
+		}
+	}
+}
+
+// scanExpansion reads a parameter expansion, arithmetic expansion or command
+// substitution. The commands of a substitution are scanned and it's kept in
+// the word as "$(...)".
+func (s *shellScanner) scanExpansion() {
+	s.inWord = true
+	rest := s.src[s.pos:]
+	switch {
+	case strings.HasPrefix(rest, "$(("):
+		depth := 0
+		i := 1
+		for ; i < len(rest); i++ {
+			if rest[i] == '(' {
+				depth++
+			} else if rest[i] == ')' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		s.word.WriteString("$((...))")
+		s.pos += i + 1
+	case strings.HasPrefix(rest, "$("):
+		s.pos += 2
+		s.substitute(')')
+	case strings.HasPrefix(rest, "`"):
+		s.pos++
+		s.substitute('`')
+	case strings.HasPrefix(rest, "${"):
+		closing := strings.IndexByte(rest, '}')
+		if closing < 0 {
+			closing = len(rest) - 1
+		}
+		s.word.WriteString(rest[:closing+1])
+		s.pos += closing + 1
+	default:
+		s.word.WriteByte('$')
+		s.pos++
+	}
+}
+
+// substitute scans the commands of a substitution ending with end.
+func (s *shellScanner) substitute(end byte) {
+	nested := &shellScanner{src: s.src, pos: s.pos}
+	nested.scan(end)
+	s.commands = append(s.commands, nested.commands...)
+	s.pos = nested.pos
+	s.word.WriteString("$(...)")
+	s.inWord = true
+}
+
+// scanRedirection reads a redirection operator. File descriptor numbers
+// before it are dropped and the word after it is skipped, except for process
+// substitutions, whose commands are scanned.
+func (s *shellScanner) scanRedirection() {
+	if s.inWord && strings.Trim(s.word.String(), "0123456789") == "" {
+		s.word.Reset()
+		s.inWord = false
+	}
+	s.endWord()
+
+	rest := s.src[s.pos:]
+	switch {
+	case strings.HasPrefix(rest, "<<<"):
+		s.pos += 3
+		s.redirect = true
+	case strings.HasPrefix(rest, "<<-"):
+		s.pos += 3
+		s.heredoc, s.nextStrips = true, true
+	case strings.HasPrefix(rest, "<<"):
+		s.pos += 2
+		s.heredoc, s.nextStrips = true, false
+	case len(rest) > 1 && rest[1] == '(':
+		// Process substitution
+		s.pos += 2
+		s.substitute(')')
+	default:
+		s.pos++
+		for s.pos < len(s.src) && strings.IndexByte("<>&|", s.src[s.pos]) >= 0 {
+			s.pos++
+		}
+		s.redirect = true
+	}
+}
+
+// endWord adds the current word to the command.
+func (s *shellScanner) endWord() {
+	if !s.inWord {
+		return
+	}
+	word := s.word.String()
+	s.word.Reset()
+	s.inWord = false
+
+	switch {
+	case s.heredoc:
+		s.heredocs = append(s.heredocs, word)
+		s.stripTabs = append(s.stripTabs, s.nextStrips)
+		s.heredoc = false
+	case s.redirect:
+		s.redirect = false
+	default:
+		s.words = append(s.words, word)
+	}
+}
+
+// endCommand records the program of the current command.
+func (s *shellScanner) endCommand() {
+	s.endWord()
+	words := s.words
+	s.words = nil
+	s.redirect = false
+
+	for _, word := range words {
+		if shellKeywords[word] || assignmentPattern.MatchString(word) {
+			continue
+		}
+		if !shellHeaders[word] && !harmlessBuiltins[word] {
+			s.commands = append(s.commands, word)
+		}
+		return
+	}
+}
+
+// skipHeredocs skips the bodies of the heredocs started on the line before.
+func (s *shellScanner) skipHeredocs() {
+	for i, delimiter := range s.heredocs {
+		for s.pos < len(s.src) {
+			lineEnd := strings.IndexByte(s.src[s.pos:], '\n')
+			if lineEnd < 0 {
+				lineEnd = len(s.src) - s.pos
+			}
+			line := s.src[s.pos : s.pos+lineEnd]
+			s.pos += lineEnd + 1
+			if s.stripTabs[i] {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == delimiter {
+				break
+			}
+		}
+	}
+	s.heredocs, s.stripTabs = nil, nil
+}
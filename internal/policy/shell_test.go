@@ -0,0 +1,44 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShellCommands(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []string
+	}{
+		{"git status", []string{"git"}},
+		{"make build && ./bin/test -v || echo failed", []string{"make", "./bin/test"}},
+		{"cd src; go test ./... | tee out.log", []string{"go", "tee"}},
+		{"GOOS=linux go build -o bin/app .", []string{"go"}},
+		{"FOO=bar", nil},
+		{"/usr/bin/env python3 script.py", []string{"/usr/bin/env"}},
+		{"echo \"$(whoami)\" > /tmp/user 2>&1", []string{"whoami"}},
+		{"echo `hostname`", []string{"hostname"}},
+		{"diff <(sort a) <(sort b)", []string{"sort", "sort", "diff"}},
+		{"if ! grep -q x file; then sed -i s/a/b/ file; fi", []string{"grep", "sed"}},
+		{"for f in *.go; do gofmt -l \"$f\"; done", []string{"gofmt"}},
+		{"while read line; do curl \"$line\"; done < urls", []string{"curl"}},
+		{"(cd sub && make)", []string{"make"}},
+		{"'rm' -rf /tmp/x", []string{"rm"}},
+		{"r\\m -rf /tmp/x", []string{"rm"}},
+		{"$CC -o app main.c", []string{"$CC"}},
+		{"$(which rm) file", []string{"which", "$(...)"}},
+		{"echo $((1 + 2))", nil},
+		{"# rm -rf /\nls # rm", []string{"ls"}},
+		{"echo 'a; rm -rf /'", nil},
+		{"cat <<EOF > out\nrm -rf /\nEOF\nwc -l out", []string{"cat", "wc"}},
+		{"python3 - <<-'PY'\n\timport os\n\tPY\n", []string{"python3"}},
+		{"cat <<< \"rm -rf /\"", []string{"cat"}},
+		{"ls \\\n  -la", []string{"ls"}},
+	}
+
+	for _, tt := range tests {
+		if got := ShellCommands(tt.script); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ShellCommands(%q) = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
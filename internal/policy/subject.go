@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/config"
+)
+
+// Subject is what a step does, as far as a policy is concerned.
+type Subject struct {
+	Action string
+	Become bool
+	Tags   []string
+
+	// Paths are the absolute paths the step writes, with their symlinks
+	// resolved as far as they exist.
+	Paths []string
+
+	// URLs are the URLs the step fetches.
+	URLs []string
+
+	// Commands are the programs the step runs, as written in the command. A
+	// program named by a variable (e.g. "$CC") is kept as written.
+	Commands []string
+
+	// Unchecked are writes whose paths aren't known before the step runs, such
+	// as the unit file of a service without dest.
+	Unchecked []string
+}
+
+// Resolver renders the fields of a step the way its action does.
+type Resolver struct {
+	// Render renders a template string.
+	Render func(string) (string, error)
+
+	// ExpandPath renders a path and makes it absolute.
+	ExpandPath func(string) (string, error)
+}
+
+// Describe returns what a step does. Fields that can't be rendered are left
+// out of the subject and reported in the returned error.
+func Describe(step *config.Step, r Resolver) (Subject, error) {
+	subject := Subject{
+		Action: step.DetermineActionType(),
+		Become: step.Become,
+		Tags:   step.Tags,
+	}
+	var errs []error
+
+	addPath := func(field, path, fallback string) {
+		if path == "" {
+			path = fallback
+		}
+		if path == "" {
+			return
+		}
+		expanded, err := r.ExpandPath(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			return
+		}
+		subject.Paths = append(subject.Paths, resolvePath(expanded))
+	}
+	addURL := func(field, url string) {
+		rendered, err := r.Render(url)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			return
+		}
+		subject.URLs = append(subject.URLs, rendered)
+	}
+	addScript := func(field, script string) {
+		rendered, err := r.Render(script)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field, err))
+			return
+		}
+		subject.Commands = append(subject.Commands, ShellCommands(rendered)...)
+	}
+
+	switch {
+	case step.File != nil:
+		addPath("file.path", step.File.Path, "")
+		// Writes through a link reach its source
+		if step.File.State == "link" || step.File.State == "hardlink" {
+			addPath("file.src", step.File.Src, "")
+		}
+	case step.Template != nil:
+		addPath("template.dest", step.Template.Dest, "")
+	case step.Copy != nil:
+		addPath("copy.dest", step.Copy.Dest, "")
+	case step.Unarchive != nil:
+		addPath("unarchive.dest", step.Unarchive.Dest, "")
+	case step.Download != nil:
+		addPath("download.dest", step.Download.Dest, "")
+		addURL("download.url", step.Download.URL)
+	case step.FileReplace != nil:
+		addPath("file_replace.path", step.FileReplace.Path, "")
+	case step.FileInsert != nil:
+		addPath("file_insert.path", step.FileInsert.Path, "")
+	case step.FileDeleteRange != nil:
+		addPath("file_delete_range.path", step.FileDeleteRange.Path, "")
+	case step.FilePatchApply != nil:
+		addPath("file_patch_apply.path", step.FilePatchApply.Path, "")
+	case step.RepoApplyPatchset != nil:
+		addPath("repo_apply_patchset.base_dir", step.RepoApplyPatchset.BaseDir, ".")
+		addPath("repo_apply_patchset.output_file", step.RepoApplyPatchset.OutputFile, "")
+	case step.RepoSearch != nil:
+		addPath("repo_search.output_file", step.RepoSearch.OutputFile, "")
+	case step.RepoTree != nil:
+		addPath("repo_tree.output_file", step.RepoTree.OutputFile, "")
+	case step.ArtifactCapture != nil:
+		addPath("artifact_capture.output_dir", step.ArtifactCapture.OutputDir, "./artifacts")
+	case step.Service != nil:
+		if unit := step.Service.Unit; unit != nil {
+			if unit.Dest != "" {
+				addPath("service.unit.dest", unit.Dest, "")
+			} else {
+				subject.Unchecked = append(subject.Unchecked, "the unit file of service "+step.Service.Name)
+			}
+		}
+		if step.Service.Dropin != nil {
+			subject.Unchecked = append(subject.Unchecked, "a drop-in of service "+step.Service.Name)
+		}
+	case step.Shell != nil:
+		rendered, err := r.Render(step.Shell.Cmd)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("shell: %w", err))
+		} else if program := interpreterProgram(step.Shell.Interpreter); program != "" {
+			// Only the interpreter is known to run
+			subject.Commands = append(subject.Commands, program)
+		} else {
+			subject.Commands = append(subject.Commands, ShellCommands(rendered)...)
+		}
+	case step.Command != nil:
+		if len(step.Command.Argv) > 0 {
+			program, err := r.Render(step.Command.Argv[0])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("command.argv: %w", err))
+			} else {
+				subject.Commands = append(subject.Commands, program)
+			}
+		}
+	case step.Wait != nil:
+		if step.Wait.Cmd != nil {
+			addScript("wait.cmd", *step.Wait.Cmd)
+		}
+		if step.Wait.URL != nil {
+			addURL("wait.url", *step.Wait.URL)
+		}
+	case step.Assert != nil:
+		if step.Assert.Command != nil {
+			addScript("assert.command.cmd", step.Assert.Command.Cmd)
+		}
+		if step.Assert.HTTP != nil {
+			addURL("assert.http.url", step.Assert.HTTP.URL)
+		}
+	}
+
+	// Only shell and command steps run it, but it's checked wherever it's set
+	if step.Unless != nil {
+		addScript("unless", *step.Unless)
+	}
+
+	return subject, errors.Join(errs...)
+}
+
+// interpreterProgram returns the program of a shell interpreter, or "" for
+// the default interpreter and POSIX shells, whose scripts ShellCommands reads.
+func interpreterProgram(interpreter string) string {
+	fields := strings.Fields(interpreter)
+	if len(fields) == 0 {
+		return ""
+	}
+	switch filepath.Base(fields[0]) {
+	case "sh", "bash", "dash", "zsh", "ksh", "ash":
+		return ""
+	}
+	return fields[0]
+}
@@ -49,31 +49,7 @@ func LoadPreset(name string) (*config.PresetDefinition, error) {
 		return nil, fmt.Errorf("preset name cannot be empty")
 	}
 
-	// Search for preset file (directory structure takes precedence)
-	var presetPath string
-	var found bool
-	var baseDir string
-
-	for _, searchPath := range PresetSearchPaths() {
-		// Try directory structure first: <name>/preset.yml
-		candidatePath := filepath.Join(searchPath, name, "preset.yml")
-		if _, err := os.Stat(candidatePath); err == nil {
-			presetPath = candidatePath
-			baseDir = filepath.Join(searchPath, name)
-			found = true
-			break
-		}
-
-		// Fallback to flat structure: <name>.yml
-		candidatePath = filepath.Join(searchPath, name+".yml")
-		if _, err := os.Stat(candidatePath); err == nil {
-			presetPath = candidatePath
-			baseDir = searchPath
-			found = true
-			break
-		}
-	}
-
+	presetPath, baseDir, _, found := findPreset(name)
 	if !found {
 		return nil, fmt.Errorf("preset '%s' not found in search paths: %v", name, PresetSearchPaths())
 	}
@@ -116,6 +92,42 @@ func LoadPreset(name string) (*config.PresetDefinition, error) {
 	return &preset, nil
 }
 
+// findPreset searches the search paths for the preset file of a preset
+// (directory structure takes precedence) and returns it with the base
+// directory of the preset and whether it is a directory preset.
+func findPreset(name string) (presetPath string, baseDir string, isDir bool, found bool) {
+	for _, searchPath := range PresetSearchPaths() {
+		// Try directory structure first: <name>/preset.yml
+		candidatePath := filepath.Join(searchPath, name, "preset.yml")
+		if _, err := os.Stat(candidatePath); err == nil {
+			return candidatePath, filepath.Join(searchPath, name), true, true
+		}
+
+		// Fallback to flat structure: <name>.yml
+		candidatePath = filepath.Join(searchPath, name+".yml")
+		if _, err := os.Stat(candidatePath); err == nil {
+			return candidatePath, searchPath, false, true
+		}
+	}
+	return "", "", false, false
+}
+
+// Locate returns the path of a preset as LoadPreset finds it: the directory
+// of directory presets, the preset file of flat presets.
+func Locate(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("preset name cannot be empty")
+	}
+	presetPath, baseDir, isDir, found := findPreset(name)
+	if !found {
+		return "", fmt.Errorf("preset '%s' not found in search paths: %v", name, PresetSearchPaths())
+	}
+	if isDir {
+		return baseDir, nil
+	}
+	return presetPath, nil
+}
+
 // PresetInfo contains summary information about a discovered preset.
 type PresetInfo struct {
 	Name        string
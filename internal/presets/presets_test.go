@@ -145,6 +145,41 @@ steps:
 	}
 }
 
+// TestLocate tests that Locate returns the directory of directory presets and
+// the file of flat presets
+func TestLocate(t *testing.T) {
+	presetsDir := filepath.Join(".", "presets")
+	if err := os.MkdirAll(filepath.Join(presetsDir, "located-dir"), 0755); err != nil {
+		t.Fatalf("Failed to create presets directory: %v", err)
+	}
+	defer os.RemoveAll(presetsDir)
+
+	if err := os.WriteFile(filepath.Join(presetsDir, "located-dir", "preset.yml"), []byte("name: located-dir\n"), 0644); err != nil {
+		t.Fatalf("Failed to create preset file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(presetsDir, "located-flat.yml"), []byte("name: located-flat\n"), 0644); err != nil {
+		t.Fatalf("Failed to create preset file: %v", err)
+	}
+
+	tests := map[string]string{
+		"located-dir":  filepath.Join(presetsDir, "located-dir"),
+		"located-flat": filepath.Join(presetsDir, "located-flat.yml"),
+	}
+	for name, want := range tests {
+		got, err := Locate(name)
+		if err != nil {
+			t.Fatalf("Locate(%s) failed: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("Locate(%s) = %s, want %s", name, got, want)
+		}
+	}
+
+	if _, err := Locate("nonexistent-preset"); err == nil {
+		t.Error("Expected error for nonexistent preset")
+	}
+}
+
 // TestLoadPreset_EmptyName tests that empty preset name returns error
 func TestLoadPreset_EmptyName(t *testing.T) {
 	_, err := LoadPreset("")
@@ -82,11 +82,20 @@ func InstallToUserDir(name string, cacheDir string, userDir string) error {
 	dirSource := filepath.Join(sourceDir, name)
 
 	if _, err := os.Stat(flatSource); err == nil {
-		// Flat format: copy <name>.yml
+		// Flat format: copy <name>.yml and its signatures
 		target := filepath.Join(userDir, name+".yml")
 		if err := copyFile(flatSource, target); err != nil {
 			return fmt.Errorf("failed to install flat preset: %w", err)
 		}
+		for _, suffix := range []string{SignatureSuffix, MinisignSuffix} {
+			if _, err := os.Stat(flatSource + suffix); err == nil {
+				if err := copyFile(flatSource+suffix, target+suffix); err != nil {
+					return fmt.Errorf("failed to install preset signature: %w", err)
+				}
+			} else if err := os.Remove(target + suffix); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove old preset signature: %w", err)
+			}
+		}
 	} else if _, err := os.Stat(dirSource); err == nil {
 		// Directory format: copy entire directory
 		target := filepath.Join(userDir, name)
@@ -79,6 +79,38 @@ func TestInstallToUserDir_FlatFormat(t *testing.T) {
 	}
 }
 
+func TestInstallToUserDir_FlatSignature(t *testing.T) {
+	tmpCache := t.TempDir()
+	tmpUser := t.TempDir()
+
+	cacheDir := filepath.Join(tmpCache, "abc123")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		t.Fatalf("Failed to create cache dir: %v", err)
+	}
+	presetFile := filepath.Join(cacheDir, "test.yml")
+	if err := os.WriteFile(presetFile, []byte("name: test\nsteps: []"), 0644); err != nil {
+		t.Fatalf("Failed to create preset file: %v", err)
+	}
+	if err := os.WriteFile(presetFile+SignatureSuffix, []byte("signature"), 0644); err != nil {
+		t.Fatalf("Failed to create signature: %v", err)
+	}
+	// A signature of a previous version that the new one doesn't have
+	if err := os.WriteFile(filepath.Join(tmpUser, "test.yml"+MinisignSuffix), []byte("stale"), 0644); err != nil {
+		t.Fatalf("Failed to create stale signature: %v", err)
+	}
+
+	if err := InstallToUserDir("test", tmpCache, tmpUser); err != nil {
+		t.Fatalf("InstallToUserDir failed: %v", err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(tmpUser, "test.yml"+SignatureSuffix)); err != nil || string(data) != "signature" {
+		t.Errorf("Signature not installed: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpUser, "test.yml"+MinisignSuffix)); !os.IsNotExist(err) {
+		t.Errorf("Stale signature not removed: %v", err)
+	}
+}
+
 func TestInstallToUserDir_DirectoryFormat(t *testing.T) {
 	// Create temporary directories
 	tmpCache := t.TempDir()
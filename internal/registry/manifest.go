@@ -19,6 +19,8 @@ type ManifestEntry struct {
 	SHA256      string    `json:"sha256"`
 	InstalledAt time.Time `json:"installed_at"`
 	Version     string    `json:"version,omitempty"`
+	Signer      string    `json:"signer,omitempty"`     // Name of the trusted key that signed the preset
+	SignerKeyID string    `json:"signer_key,omitempty"` // ID of that key
 }
 
 // Manifest tracks all installed presets from external sources.
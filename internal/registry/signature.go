@@ -0,0 +1,264 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+// Signatures of presets are detached: next to a flat preset (<name>.yml.sig)
+// or inside a directory preset (<name>/preset.sig). A signature covers the
+// manifest of the preset (see PresetManifest), so a directory preset is signed
+// with all its files.
+const (
+	// SignatureSuffix is the suffix of ed25519 signatures made with
+	// 'mooncake presets sign'.
+	SignatureSuffix = ".sig"
+	// MinisignSuffix is the suffix of minisign signatures.
+	MinisignSuffix = ".minisig"
+
+	// dirSignatureBase is the name, without suffix, of the signature of a
+	// directory preset.
+	dirSignatureBase = "preset"
+
+	signatureAlgorithm = "ed25519"
+)
+
+// ErrUnsigned is returned by VerifyPreset for presets without a signature.
+var ErrUnsigned = errors.New("preset is not signed")
+
+// ErrUntrusted is returned by VerifyPreset for presets signed by a key that
+// isn't in the trust store.
+var ErrUntrusted = errors.New("preset is signed by an untrusted key")
+
+// PresetSignature is an ed25519 signature over the manifest of a preset.
+type PresetSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"` // base64
+	Value     string `json:"value"`      // base64
+}
+
+// Signer is the publisher whose trusted key signed a preset.
+type Signer struct {
+	Name  string // Name of the key in the trust store
+	KeyID string
+}
+
+func (s Signer) String() string {
+	return fmt.Sprintf("%s (key %s)", s.Name, s.KeyID)
+}
+
+// PresetManifest returns the manifest of the preset at path, a flat preset
+// file or a preset directory: a line "<sha256>  <path>" per file, sorted by
+// path, as printed by sha256sum. The path of a flat preset is its file name;
+// those of a directory preset are relative to the directory. Signatures are
+// left out.
+func PresetManifest(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access preset: %w", err)
+	}
+
+	hashes := map[string]string{}
+	if !info.IsDir() {
+		hash, hashErr := CalculateSHA256(path)
+		if hashErr != nil {
+			return nil, hashErr
+		}
+		hashes[filepath.Base(path)] = hash
+	} else {
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, walkErr error) error {
+			if walkErr != nil {
+				return walkErr
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			if !entry.Type().IsRegular() {
+				return fmt.Errorf("%s is not a regular file", file)
+			}
+			rel, relErr := filepath.Rel(path, file)
+			if relErr != nil {
+				return relErr
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == dirSignatureBase+SignatureSuffix || rel == dirSignatureBase+MinisignSuffix {
+				return nil
+			}
+			hash, hashErr := CalculateSHA256(file)
+			if hashErr != nil {
+				return hashErr
+			}
+			hashes[rel] = hash
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read preset directory: %w", err)
+		}
+	}
+
+	files := make([]string, 0, len(hashes))
+	for file := range hashes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var manifest bytes.Buffer
+	for _, file := range files {
+		fmt.Fprintf(&manifest, "%s  %s\n", hashes[file], file)
+	}
+	return manifest.Bytes(), nil
+}
+
+// SignaturePath returns the path of the signature of the preset at path with
+// the given suffix (SignatureSuffix or MinisignSuffix).
+func SignaturePath(path string, suffix string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, dirSignatureBase+suffix)
+	}
+	return path + suffix
+}
+
+// SignPreset signs the preset at path with key and writes the signature to
+// SignaturePath(path, SignatureSuffix), which it returns.
+func SignPreset(path string, key ed25519.PrivateKey) (string, error) {
+	manifest, err := PresetManifest(path)
+	if err != nil {
+		return "", err
+	}
+	publicKey, ok := key.Public().(ed25519.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("signing key is not an ed25519 key")
+	}
+	data, err := json.MarshalIndent(PresetSignature{
+		Algorithm: signatureAlgorithm,
+		KeyID:     security.KeyID(publicKey),
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest)),
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode signature: %w", err)
+	}
+
+	sigPath := SignaturePath(path, SignatureSuffix)
+	if err := os.WriteFile(sigPath, append(data, '\n'), 0644); err != nil { // #nosec G306 -- signatures are public
+		return "", fmt.Errorf("failed to write signature: %w", err)
+	}
+	return sigPath, nil
+}
+
+// VerifyPreset checks the signature of the preset at path against the keys of
+// the trust store and returns who signed it. It returns ErrUnsigned for
+// presets without a signature and ErrUntrusted (wrapped) for presets signed by
+// other keys; any other error means the signature is invalid.
+func VerifyPreset(path string, store *TrustStore) (*Signer, error) {
+	manifest, err := PresetManifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// #nosec G304 -- signature paths are derived from the preset path
+	if data, err := os.ReadFile(SignaturePath(path, SignatureSuffix)); err == nil {
+		return verifyEd25519(data, manifest, store)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+	// #nosec G304 -- signature paths are derived from the preset path
+	if data, err := os.ReadFile(SignaturePath(path, MinisignSuffix)); err == nil {
+		return verifyMinisign(data, manifest, store)
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+	return nil, ErrUnsigned
+}
+
+// verifyEd25519 checks a signature of 'mooncake presets sign'.
+func verifyEd25519(data, manifest []byte, store *TrustStore) (*Signer, error) {
+	var sig PresetSignature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	if sig.Algorithm != signatureAlgorithm {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm)
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(sig.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("signature has an invalid public key")
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return nil, fmt.Errorf("signature is not valid base64: %w", err)
+	}
+
+	key := store.find(KeyFormatEd25519, security.KeyID(publicKey))
+	if key == nil || !key.publicKey.Equal(ed25519.PublicKey(publicKey)) {
+		return nil, fmt.Errorf("%w %s", ErrUntrusted, security.KeyID(publicKey))
+	}
+	if !ed25519.Verify(key.publicKey, manifest, value) {
+		return nil, fmt.Errorf("signature is invalid: the preset was modified after signing")
+	}
+	return &Signer{Name: key.Name, KeyID: key.KeyID}, nil
+}
+
+// verifyMinisign checks a minisign signature: an untrusted comment, the
+// signature ("Ed" over the data or "ED" over its BLAKE2b-512 hash, the key ID
+// and the signature, in base64), a trusted comment and the signature of the
+// signature and the trusted comment.
+func verifyMinisign(data, manifest []byte, store *TrustStore) (*Signer, error) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[0], "untrusted comment:") || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return nil, fmt.Errorf("invalid minisign signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid minisign signature")
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("invalid minisign signature")
+	}
+
+	keyID := minisignKeyID(sig[2:10])
+	key := store.find(KeyFormatMinisign, keyID)
+	if key == nil {
+		return nil, fmt.Errorf("%w %s", ErrUntrusted, keyID)
+	}
+
+	message := manifest
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		hash := blake2b.Sum512(manifest)
+		message = hash[:]
+	default:
+		return nil, fmt.Errorf("unsupported minisign signature algorithm %q", sig[:2])
+	}
+	if !ed25519.Verify(key.publicKey, message, sig[10:]) {
+		return nil, fmt.Errorf("signature is invalid: the preset was modified after signing")
+	}
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	signed := append(append([]byte{}, sig[10:]...), trustedComment...)
+	if !ed25519.Verify(key.publicKey, signed, global) {
+		return nil, fmt.Errorf("minisign signature has an invalid trusted comment")
+	}
+	return &Signer{Name: key.Name, KeyID: key.KeyID}, nil
+}
+
+// minisignKeyID formats a minisign key ID (little endian) as minisign prints it.
+func minisignKeyID(id []byte) string {
+	return fmt.Sprintf("%016X", binary.LittleEndian.Uint64(id))
+}
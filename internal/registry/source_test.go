@@ -1,6 +1,8 @@
 package registry
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
@@ -116,3 +118,55 @@ func TestFetchFromGit(t *testing.T) {
 		t.Error("Expected error for non-existent repository")
 	}
 }
+
+func TestFetchFromPath_Signatures(t *testing.T) {
+	tmpSource := t.TempDir()
+	tmpTarget := t.TempDir()
+
+	sourceFile := filepath.Join(tmpSource, "test.yml")
+	if err := os.WriteFile(sourceFile, []byte("name: test"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(sourceFile+MinisignSuffix, []byte("signature"), 0644); err != nil {
+		t.Fatalf("Failed to create signature: %v", err)
+	}
+
+	targetDir, err := fetchFromPath(sourceFile, tmpTarget)
+	if err != nil {
+		t.Fatalf("fetchFromPath failed: %v", err)
+	}
+
+	// The signature is copied with the preset; missing signatures are skipped
+	if data, err := os.ReadFile(filepath.Join(targetDir, "test.yml"+MinisignSuffix)); err != nil || string(data) != "signature" {
+		t.Errorf("Signature not copied: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "test.yml"+SignatureSuffix)); !os.IsNotExist(err) {
+		t.Errorf("Unexpected signature in target: %v", err)
+	}
+}
+
+func TestFetchFromURL_Signatures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/presets/test.yml":
+			_, _ = w.Write([]byte("name: test"))
+		case "/presets/test.yml" + SignatureSuffix:
+			_, _ = w.Write([]byte("signature"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	targetDir, err := fetchFromURL(server.URL+"/presets/test.yml", t.TempDir())
+	if err != nil {
+		t.Fatalf("fetchFromURL failed: %v", err)
+	}
+
+	if data, err := os.ReadFile(filepath.Join(targetDir, "test.yml"+SignatureSuffix)); err != nil || string(data) != "signature" {
+		t.Errorf("Signature not downloaded: %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(targetDir, "test.yml"+MinisignSuffix)); !os.IsNotExist(err) {
+		t.Errorf("Unexpected minisign signature in target: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package registry
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+// Formats of the public keys of the trust store.
+const (
+	KeyFormatEd25519  = "ed25519"  // PEM, as written by 'mooncake keygen'
+	KeyFormatMinisign = "minisign" // As written by 'minisign -G'
+)
+
+// trustedKeySuffix is the suffix of the key files of the trust store.
+const trustedKeySuffix = ".pub"
+
+var trustedKeyName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// TrustedKey is the public key of a publisher whose signed presets are
+// trusted.
+type TrustedKey struct {
+	Name   string
+	Format string
+	KeyID  string
+	Path   string
+
+	publicKey ed25519.PublicKey
+}
+
+// TrustStore holds the keys of trusted publishers: a directory with a
+// <name>.pub file per key.
+type TrustStore struct {
+	Dir  string
+	Keys []TrustedKey
+}
+
+// DefaultTrustDir returns the default trust store directory.
+// Returns ~/.mooncake/trust
+func DefaultTrustDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	return filepath.Join(home, ".mooncake", "trust"), nil
+}
+
+// LoadTrustStore loads the keys of the trust store in dir. A missing
+// directory is an empty trust store.
+func LoadTrustStore(dir string) (*TrustStore, error) {
+	store := &TrustStore{Dir: dir}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust store: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), trustedKeySuffix) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path) // #nosec G304 -- path is in the trust store
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trusted key: %w", err)
+		}
+		key, err := ParsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted key %s: %w", path, err)
+		}
+		key.Name = strings.TrimSuffix(entry.Name(), trustedKeySuffix)
+		key.Path = path
+		store.Keys = append(store.Keys, *key)
+	}
+	sort.Slice(store.Keys, func(i, j int) bool { return store.Keys[i].Name < store.Keys[j].Name })
+	return store, nil
+}
+
+// Add validates the public key in keyPath and adds it to the trust store as
+// name. Existing keys are not overwritten.
+func (s *TrustStore) Add(name string, keyPath string) (*TrustedKey, error) {
+	if !trustedKeyName.MatchString(name) {
+		return nil, fmt.Errorf("invalid key name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	data, err := os.ReadFile(keyPath) // #nosec G304 -- key path is a user-provided CLI argument
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	key, err := ParsePublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", keyPath, err)
+	}
+	if existing := s.find(key.Format, key.KeyID); existing != nil {
+		return nil, fmt.Errorf("key %s is already trusted as %s", key.KeyID, existing.Name)
+	}
+
+	if err := os.MkdirAll(s.Dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create trust store: %w", err)
+	}
+	key.Name = name
+	key.Path = filepath.Join(s.Dir, name+trustedKeySuffix)
+	// #nosec G304 -- path is in the trust store
+	file, err := os.OpenFile(key.Path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("a key named %s is already trusted", name)
+		}
+		return nil, fmt.Errorf("failed to create trusted key: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to write trusted key: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write trusted key: %w", err)
+	}
+
+	s.Keys = append(s.Keys, *key)
+	return key, nil
+}
+
+// Remove removes the key named name from the trust store.
+func (s *TrustStore) Remove(name string) error {
+	for i, key := range s.Keys {
+		if key.Name == name {
+			if err := os.Remove(key.Path); err != nil {
+				return fmt.Errorf("failed to remove trusted key: %w", err)
+			}
+			s.Keys = append(s.Keys[:i], s.Keys[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no trusted key named %s", name)
+}
+
+// find returns the trusted key with the given format and ID, or nil.
+func (s *TrustStore) find(format, keyID string) *TrustedKey {
+	for i := range s.Keys {
+		if s.Keys[i].Format == format && s.Keys[i].KeyID == keyID {
+			return &s.Keys[i]
+		}
+	}
+	return nil
+}
+
+// ParsePublicKey parses an ed25519 public key in PEM (see 'mooncake keygen')
+// or a minisign public key, with or without its comment line.
+func ParsePublicKey(data []byte) (*TrustedKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "PUBLIC KEY" {
+			return nil, fmt.Errorf("PEM block is %q, not \"PUBLIC KEY\"", block.Type)
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		publicKey, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("not an ed25519 key")
+		}
+		return &TrustedKey{Format: KeyFormatEd25519, KeyID: security.KeyID(publicKey), publicKey: publicKey}, nil
+	}
+
+	// minisign: "Ed", the key ID and the key, in base64
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) > 1 && strings.HasPrefix(lines[0], "untrusted comment:") {
+		lines = lines[1:]
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[0]))
+	if len(lines) != 1 || err != nil || len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return nil, fmt.Errorf("not a PEM ed25519 or minisign public key")
+	}
+	return &TrustedKey{
+		Format:    KeyFormatMinisign,
+		KeyID:     minisignKeyID(raw[2:10]),
+		publicKey: ed25519.PublicKey(raw[10:]),
+	}, nil
+}
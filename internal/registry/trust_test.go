@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTrustStore_Missing(t *testing.T) {
+	store, err := LoadTrustStore(filepath.Join(t.TempDir(), "trust"))
+	if err != nil {
+		t.Fatalf("LoadTrustStore failed: %v", err)
+	}
+	if len(store.Keys) != 0 {
+		t.Errorf("Expected no keys, got %d", len(store.Keys))
+	}
+}
+
+func TestTrustStore_AddAndRemove(t *testing.T) {
+	_, store := trustEd25519(t, "alice")
+
+	// The key is saved and loaded again
+	reloaded, err := LoadTrustStore(store.Dir)
+	if err != nil {
+		t.Fatalf("LoadTrustStore failed: %v", err)
+	}
+	if len(reloaded.Keys) != 1 || reloaded.Keys[0].Name != "alice" || reloaded.Keys[0].Format != KeyFormatEd25519 {
+		t.Fatalf("Reloaded keys = %+v, want alice", reloaded.Keys)
+	}
+
+	// The same key can't be trusted twice
+	if _, err := reloaded.Add("bob", reloaded.Keys[0].Path); err == nil || !strings.Contains(err.Error(), "already trusted as alice") {
+		t.Errorf("Add of a trusted key = %v, want an error", err)
+	}
+
+	if err := reloaded.Remove("alice"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, "alice.pub")); !os.IsNotExist(err) {
+		t.Error("Key file still exists after Remove")
+	}
+	if err := reloaded.Remove("alice"); err == nil {
+		t.Error("Remove of an unknown key succeeded")
+	}
+}
+
+func TestTrustStore_AddInvalid(t *testing.T) {
+	store, _ := LoadTrustStore(t.TempDir())
+	keyFile := filepath.Join(t.TempDir(), "key.pub")
+	if err := os.WriteFile(keyFile, []byte("not a key\n"), 0644); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	if _, err := store.Add("publisher", keyFile); err == nil {
+		t.Error("Add of an invalid key succeeded")
+	}
+	if _, err := store.Add("../escape", keyFile); err == nil || !strings.Contains(err.Error(), "invalid key name") {
+		t.Errorf("Add with an invalid name = %v, want an error", err)
+	}
+}
+
+func TestParsePublicKey_Minisign(t *testing.T) {
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	id := []byte{0xEF, 0xCD, 0xAB, 0x89, 0x67, 0x45, 0x23, 0x01}
+	file := minisignKey(publicKey, id)
+
+	// With and without the comment line, as printed by 'minisign -G' and
+	// given to 'minisign -P'
+	for _, data := range []string{file, strings.SplitN(file, "\n", 2)[1]} {
+		key, err := ParsePublicKey([]byte(data))
+		if err != nil {
+			t.Fatalf("ParsePublicKey failed: %v", err)
+		}
+		if key.Format != KeyFormatMinisign || key.KeyID != "0123456789ABCDEF" || !key.publicKey.Equal(publicKey) {
+			t.Errorf("ParsePublicKey = %s %s, want minisign key 0123456789ABCDEF", key.Format, key.KeyID)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Package sandbox runs commands in a sandbox on Linux: unprivileged user,
+// mount, PID and network namespaces plus resource limits. In the sandbox the
+// writable paths are writable, /tmp is an empty tmpfs and the rest of the
+// filesystem is read-only. Without network access the command only has a
+// loopback interface.
+//
+// Wrap makes the command re-execute the current executable, whose init
+// function sets up the sandbox and then executes the command. Any binary
+// that runs sandboxed commands therefore has to import this package, which
+// happens through the packages that wrap commands. The sandbox reports the
+// limits it enforced over a pipe the command doesn't inherit (see Reports).
+package sandbox
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the sandbox of a command.
+type Config struct {
+	// Writable are the absolute paths the command may write.
+	Writable []string `json:"writable,omitempty"`
+
+	// Network gives the command the network of this host.
+	Network bool `json:"network,omitempty"`
+
+	// CPU limits the CPU time of each process (0: no limit).
+	CPU time.Duration `json:"cpu,omitempty"`
+
+	// Memory limits the address space of each process in bytes (0: no limit).
+	Memory int64 `json:"memory,omitempty"`
+
+	// Timeout limits the wall-clock time of the command (0: no limit).
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// Kinds of violations.
+const (
+	KindTime    = "time"
+	KindCPU     = "cpu"
+	KindMemory  = "memory"
+	KindWrite   = "write"
+	KindNetwork = "network"
+)
+
+// ViolationError is the error of a command stopped by its sandbox or failing
+// because of it.
+type ViolationError struct {
+	Kind    string // time, cpu, memory, write or network
+	Message string
+}
+
+func (e *ViolationError) Error() string {
+	return "sandbox violation: " + e.Message
+}
+
+// Reports of the sandbox, one per line as "<kind>: <message>".
+const (
+	reportSetup = "setup"
+	reportTime  = KindTime
+	reportCPU   = KindCPU
+)
+
+// Exit codes of the sandbox.
+const (
+	exitSetup = 125
+	exitTime  = 124
+)
+
+// Messages of programs that fail because of the sandbox.
+var (
+	writeMessages   = []string{"read-only file system"}
+	memoryMessages  = []string{"cannot allocate memory", "out of memory", "memoryerror", "bad_alloc", "memory exhausted"}
+	networkMessages = []string{
+		"network is unreachable", "temporary failure in name resolution",
+		"could not resolve host", "name or service not known", "no such host",
+	}
+)
+
+// maxDetailLength is the length at which lines of stderr quoted in
+// violations are cut.
+const maxDetailLength = 200
+
+// reportTimeout bounds the wait for the reports of a sandbox whose command
+// has exited.
+const reportTimeout = time.Second
+
+// Reports receives the reports of the sandbox of a command: the limits it
+// enforced and why it couldn't be set up. The sandbox writes them to a pipe
+// that the command doesn't inherit, so the command can't fake them.
+type Reports struct {
+	cfg    Config
+	reader *os.File
+	writer *os.File
+	done   bool
+	report string
+}
+
+// newReports creates the pipe of the reports of a sandbox.
+func newReports(cfg Config) (*Reports, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the report pipe of the sandbox: %w", err)
+	}
+	return &Reports{cfg: cfg, reader: reader, writer: writer}, nil
+}
+
+// Check returns why a command that failed in a sandbox failed when the
+// sandbox is the reason: a *ViolationError for a limit it exceeded or
+// something the sandbox doesn't allow, or an error when the sandbox couldn't
+// be set up. Otherwise, or when r is nil, it returns nil. It must be called
+// once the command has exited.
+//
+// Limits and setup failures come from the reports of the sandbox. Denied
+// writes, memory and network access are recognized by the error messages of
+// the programs on stderr, so only programs reporting them there are
+// recognized.
+func (r *Reports) Check(stderr string) error {
+	if r == nil {
+		return nil
+	}
+	if !r.done {
+		r.done = true
+		// The sandbox has exited: only this copy of the write end is left
+		_ = r.writer.Close()
+		_ = r.reader.SetReadDeadline(time.Now().Add(reportTimeout))
+		data, _ := io.ReadAll(r.reader)
+		r.report = string(data)
+		_ = r.reader.Close()
+	}
+	return check(r.cfg, r.report, stderr)
+}
+
+// Close releases the pipe of the reports. It is safe to call on nil and
+// after Check.
+func (r *Reports) Close() {
+	if r == nil {
+		return
+	}
+	_ = r.writer.Close()
+	_ = r.reader.Close()
+}
+
+// check returns why a command failed in a sandbox from the reports of the
+// sandbox and the stderr of the command (see Reports.Check).
+func check(cfg Config, report, stderr string) error {
+	reports := strings.Split(strings.TrimSpace(report), "\n")
+	if last := reports[len(reports)-1]; last != "" {
+		kind, message, _ := strings.Cut(last, ": ")
+		if kind == reportSetup {
+			return fmt.Errorf("failed to set up the sandbox: %s", message)
+		}
+		return &ViolationError{Kind: kind, Message: message}
+	}
+
+	lines := strings.Split(stderr, "\n")
+	if line := findLine(lines, writeMessages); line != "" {
+		return &ViolationError{
+			Kind:    KindWrite,
+			Message: fmt.Sprintf("writing outside %s is not allowed: %s", writableDescription(cfg), line),
+		}
+	}
+	if cfg.Memory > 0 {
+		if line := findLine(lines, memoryMessages); line != "" {
+			return &ViolationError{
+				Kind:    KindMemory,
+				Message: fmt.Sprintf("the command exceeded the memory limit of %s: %s", FormatSize(cfg.Memory), line),
+			}
+		}
+	}
+	if !cfg.Network {
+		if line := findLine(lines, networkMessages); line != "" {
+			return &ViolationError{
+				Kind:    KindNetwork,
+				Message: "network access is not allowed: " + line,
+			}
+		}
+	}
+	return nil
+}
+
+// findLine returns the first line containing one of the messages, ignoring
+// case, or "".
+func findLine(lines, messages []string) string {
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		for _, message := range messages {
+			if strings.Contains(lower, message) {
+				line = strings.TrimSpace(line)
+				if len(line) > maxDetailLength {
+					line = line[:maxDetailLength] + "..."
+				}
+				return line
+			}
+		}
+	}
+	return ""
+}
+
+// writableDescription names the writable paths of a sandbox in violations.
+func writableDescription(cfg Config) string {
+	if len(cfg.Writable) == 0 {
+		return "/tmp"
+	}
+	return strings.Join(cfg.Writable, ", ") + " and /tmp"
+}
+
+// Size units, in bytes.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+}
+
+// ParseSize parses a size such as "512M", "512MB" or "1GiB". Units are
+// powers of 1024 and a number without a unit is in bytes.
+func ParseSize(s string) (int64, error) {
+	trimmed := strings.TrimSpace(s)
+	end := 0
+	for end < len(trimmed) && trimmed[end] >= '0' && trimmed[end] <= '9' {
+		end++
+	}
+	number, err := strconv.ParseInt(trimmed[:end], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(trimmed[end:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit", s)
+	}
+	if number > (1<<63-1)/unit {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return number * unit, nil
+}
+
+// FormatSize formats a size in bytes with the largest unit that divides it.
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1<<30 && size%(1<<30) == 0:
+		return fmt.Sprintf("%d GiB", size>>30)
+	case size >= 1<<20 && size%(1<<20) == 0:
+		return fmt.Sprintf("%d MiB", size>>20)
+	case size >= 1<<10 && size%(1<<10) == 0:
+		return fmt.Sprintf("%d KiB", size>>10)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
@@ -0,0 +1,413 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Environment variables of the sandbox helper.
+const (
+	// envCommand holds the JSON encoded command and its sandbox.
+	envCommand = "MOONCAKE_SANDBOX"
+
+	// envStage is set to stageExec for the process that executes the command.
+	envStage  = "MOONCAKE_SANDBOX_STAGE"
+	stageExec = "exec"
+
+	// envReport holds the descriptor the helper writes its reports to.
+	envReport = "MOONCAKE_SANDBOX_REPORT"
+)
+
+// reportFile is where the helper writes its reports, or nil when it has
+// nowhere to write them.
+var reportFile *os.File
+
+// command is what the helper runs.
+type command struct {
+	Config Config   `json:"config"`
+	Path   string   `json:"path"`
+	Args   []string `json:"args"`
+}
+
+// Supported returns an error when this host can't run sandboxed commands.
+func Supported() error {
+	data, err := os.ReadFile("/proc/sys/user/max_user_namespaces")
+	if err != nil {
+		return fmt.Errorf("the sandbox needs user namespaces: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "0" {
+		return errors.New("the sandbox needs user namespaces, which are disabled (user.max_user_namespaces is 0)")
+	}
+	return nil
+}
+
+// Wrap makes cmd run in a sandbox and returns the reports of the sandbox,
+// which must be closed once the command has exited (nil when the command
+// fails to start anyway). It must be called before the command starts and
+// keeps the process group and cancellation set on it.
+func Wrap(cmd *exec.Cmd, cfg Config) (*Reports, error) {
+	if cmd.Err != nil {
+		// The command fails to start anyway
+		return nil, nil
+	}
+	for _, path := range cfg.Writable {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("writable path %s of the sandbox is not absolute", path)
+		}
+	}
+	payload, err := json.Marshal(command{Config: cfg, Path: cmd.Path, Args: cmd.Args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the sandboxed command: %w", err)
+	}
+	reports, err := newReports(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	reportFD := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, reports.writer)
+	cmd.Env = append(env[:len(env):len(env)], envCommand+"="+string(payload), envReport+"="+strconv.Itoa(reportFD))
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{"mooncake-sandbox"}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	attr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	if !cfg.Network {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	// Same IDs inside: files keep their owners and the command its user
+	uid, gid := os.Getuid(), os.Getgid()
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	// Kept by the helper across exec, which drops the other capabilities of
+	// users other than root
+	attr.AmbientCaps = append(attr.AmbientCaps, unix.CAP_SYS_ADMIN, unix.CAP_NET_ADMIN, unix.CAP_SETPCAP)
+	return reports, nil
+}
+
+func init() {
+	payload, ok := os.LookupEnv(envCommand)
+	if !ok {
+		return
+	}
+	// The command must not inherit the report descriptor
+	if fd, err := strconv.Atoi(os.Getenv(envReport)); err == nil && fd > 2 {
+		unix.CloseOnExec(fd)
+		reportFile = os.NewFile(uintptr(fd), "sandbox reports")
+	}
+	var cmd command
+	if err := json.Unmarshal([]byte(payload), &cmd); err != nil {
+		fail(fmt.Errorf("failed to decode the command: %w", err))
+	}
+	if os.Getenv(envStage) == stageExec {
+		execute(cmd)
+	}
+	supervise(cmd)
+}
+
+// fail reports that the sandbox couldn't be set up and exits.
+func fail(err error) {
+	report(reportSetup, "%v", err)
+	os.Exit(exitSetup)
+}
+
+// supervise runs as the first process of the namespaces of the sandbox. It
+// sets up the filesystem and network, runs the command in a process that
+// drops privileges and applies limits, and enforces the time limit. Exiting
+// kills every process left in the sandbox.
+func supervise(cmd command) {
+	cfg := cmd.Config
+	// Keeps the processes of the sandbox from reaching the report descriptor
+	// through /proc
+	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0); err != nil {
+		fail(fmt.Errorf("failed to protect the supervisor: %w", err))
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		fail(fmt.Errorf("failed to get the working directory: %w", err))
+	}
+	if err := setupMounts(cfg.Writable); err != nil {
+		fail(err)
+	}
+	if !cfg.Network {
+		if err := loopbackUp(); err != nil {
+			fail(err)
+		}
+	}
+	// The working directory still refers to the mounts replaced above
+	if err := os.Chdir(dir); err != nil {
+		fail(fmt.Errorf("the working directory %s is not in the sandbox: %w", dir, err))
+	}
+
+	child := exec.Command("/proc/self/exe")
+	child.Args = []string{"mooncake-sandbox"}
+	child.Env = append(os.Environ(), envStage+"="+stageExec)
+	if reportFile != nil {
+		// Reports setup failures until the command is executed
+		child.ExtraFiles = []*os.File{reportFile}
+		child.Env = append(child.Env, envReport+"=3")
+	}
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := child.Start(); err != nil {
+		fail(fmt.Errorf("failed to start the command: %w", err))
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- child.Wait()
+	}()
+	var timeout <-chan time.Time
+	if cfg.Timeout > 0 {
+		timeout = time.After(cfg.Timeout)
+	}
+	select {
+	case <-done:
+	case <-timeout:
+		report(reportTime, "the command ran longer than the time limit of %s", cfg.Timeout)
+		os.Exit(exitTime)
+	}
+
+	state := child.ProcessState
+	status, _ := state.Sys().(syscall.WaitStatus)
+	cpuExceeded := cfg.CPU > 0 && state.UserTime()+state.SystemTime() >= cfg.CPU
+	switch {
+	case status.Signaled():
+		if status.Signal() == syscall.SIGXCPU || (status.Signal() == syscall.SIGKILL && cpuExceeded) {
+			report(reportCPU, "the command used more than the CPU time limit of %s", cfg.CPU)
+		}
+		os.Exit(128 + int(status.Signal()))
+	case status.ExitStatus() == 128+int(syscall.SIGXCPU) && cfg.CPU > 0:
+		// A shell reporting a process killed by the CPU time limit
+		report(reportCPU, "a process used more than the CPU time limit of %s", cfg.CPU)
+	}
+	os.Exit(status.ExitStatus())
+}
+
+// report writes a report of the sandbox for Reports.Check, or to stderr when
+// there is no report descriptor.
+func report(kind, format string, args ...interface{}) {
+	out := reportFile
+	if out == nil {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "%s: %s\n", kind, fmt.Sprintf(format, args...))
+}
+
+// execute drops the privileges the sandbox was set up with, applies the
+// resource limits and executes the command.
+func execute(cmd command) {
+	// Capabilities and no_new_privs are attributes of the thread that executes
+	runtime.LockOSThread()
+
+	for c := 0; c <= lastCapability(); c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && !errors.Is(err, unix.EINVAL) {
+			fail(fmt.Errorf("failed to drop capability %d: %w", c, err))
+		}
+	}
+	_ = unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0)
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		fail(fmt.Errorf("failed to set no_new_privs: %w", err))
+	}
+	var none [2]unix.CapUserData
+	if err := unix.Capset(&unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}, &none[0]); err != nil {
+		fail(fmt.Errorf("failed to drop capabilities: %w", err))
+	}
+
+	env := make([]string, 0, len(os.Environ()))
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, envCommand+"=") && !strings.HasPrefix(variable, envStage+"=") &&
+			!strings.HasPrefix(variable, envReport+"=") {
+			env = append(env, variable)
+		}
+	}
+
+	// Last, as the address space limit applies to this process too
+	if cmd.Config.CPU > 0 {
+		seconds := uint64((cmd.Config.CPU + time.Second - 1) / time.Second)
+		// The soft limit sends SIGXCPU, the hard limit SIGKILL
+		if err := lowerLimit(unix.RLIMIT_CPU, seconds, seconds+1); err != nil {
+			fail(fmt.Errorf("failed to limit CPU time: %w", err))
+		}
+	}
+	if cmd.Config.Memory > 0 {
+		if err := lowerLimit(unix.RLIMIT_AS, uint64(cmd.Config.Memory), uint64(cmd.Config.Memory)); err != nil {
+			fail(fmt.Errorf("failed to limit memory: %w", err))
+		}
+	}
+
+	err := syscall.Exec(cmd.Path, cmd.Args, env)
+	fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.Path, err)
+	os.Exit(127)
+}
+
+// lowerLimit sets a resource limit unless the current one is lower.
+func lowerLimit(resource int, soft, hard uint64) error {
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(resource, &limit); err != nil {
+		return err
+	}
+	limit.Cur = min(limit.Cur, soft)
+	limit.Max = min(limit.Max, hard)
+	return unix.Setrlimit(resource, &limit)
+}
+
+// lastCapability returns the highest capability of the kernel.
+func lastCapability() int {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return 63
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 63
+	}
+	return last
+}
+
+// setupMounts makes the filesystem read-only except for the writable paths,
+// devices and an empty tmpfs on /tmp. The mounts are private to the sandbox.
+func setupMounts(writable []string) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make the mounts private: %w", err)
+	}
+
+	// Copies of the writable paths, attached again once the rest is read-only
+	trees := make([]int, len(writable))
+	for i, path := range writable {
+		fd, err := unix.OpenTree(unix.AT_FDCWD, path, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC|unix.AT_RECURSIVE)
+		if err != nil {
+			return fmt.Errorf("failed to copy the mount of writable path %s: %w", path, err)
+		}
+		defer func() { _ = unix.Close(fd) }()
+		trees[i] = fd
+	}
+
+	readOnly := &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}
+	if err := unix.MountSetattr(unix.AT_FDCWD, "/", unix.AT_RECURSIVE, readOnly); err != nil {
+		return fmt.Errorf("failed to make the filesystem read-only (the sandbox needs Linux 5.12 or later): %w", err)
+	}
+
+	// Device nodes such as /dev/null and terminals stay writable
+	mountPoints, err := mountPoints()
+	if err != nil {
+		return err
+	}
+	writableDevices := &unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY}
+	for _, mountPoint := range mountPoints {
+		if mountPoint == "/dev" || strings.HasPrefix(mountPoint, "/dev/") {
+			// Mounts that were read-only before stay read-only
+			_ = unix.MountSetattr(unix.AT_FDCWD, mountPoint, 0, writableDevices)
+		}
+	}
+
+	if info, err := os.Stat("/tmp"); err == nil && info.IsDir() {
+		if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("failed to mount /tmp: %w", err)
+		}
+	}
+
+	// Processes of the sandbox only. The command is executed through
+	// /proc/self/exe, and /proc of the host would show the processes outside
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("failed to mount /proc: %w", err)
+	}
+
+	for i, path := range writable {
+		// Paths under /tmp are hidden by the tmpfs
+		if err := os.MkdirAll(path, 0o700); err != nil {
+			return fmt.Errorf("failed to create mount point %s: %w", path, err)
+		}
+		if err := unix.MoveMount(trees[i], "", unix.AT_FDCWD, path, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+			return fmt.Errorf("failed to mount writable path %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// mountPoints returns the mount points of the mount namespace.
+func mountPoints() ([]string, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the mounts: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var mountPoints []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// ID, parent ID, major:minor, root, mount point, ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoints = append(mountPoints, unescapeMountPath(fields[4]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the mounts: %w", err)
+	}
+	return mountPoints, nil
+}
+
+// unescapeMountPath decodes the octal escapes of spaces, tabs, newlines and
+// backslashes in the paths of mountinfo.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if code, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// loopbackUp brings up the loopback interface of a new network namespace.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to bring up the loopback interface: %w", err)
+	}
+	defer func() { _ = unix.Close(fd) }()
+
+	ifreq, err := unix.NewIfreq("lo")
+	if err != nil {
+		return fmt.Errorf("failed to bring up the loopback interface: %w", err)
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifreq); err != nil {
+		return fmt.Errorf("failed to bring up the loopback interface: %w", err)
+	}
+	ifreq.SetUint16(ifreq.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifreq); err != nil {
+		return fmt.Errorf("failed to bring up the loopback interface: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sandboxed is the outcome of a command run in a sandbox.
+type sandboxed struct {
+	stdout, stderr string
+	err            error // Error of the command
+	violation      error // Result of Reports.Check when the command failed
+}
+
+// runSandboxed runs a command in a sandbox. The test is skipped when this
+// host can't set up the sandbox.
+func runSandboxed(t *testing.T, cfg Config, name string, args ...string) sandboxed {
+	t.Helper()
+	if err := Supported(); err != nil {
+		t.Skip(err)
+	}
+	cmd := exec.Command(name, args...)
+	reports, err := Wrap(cmd, cfg)
+	if err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	defer reports.Close()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	result := sandboxed{err: cmd.Run()}
+	result.stdout, result.stderr = stdout.String(), stderr.String()
+
+	if result.err != nil {
+		result.violation = reports.Check(result.stderr)
+		var violation *ViolationError
+		if result.violation != nil && !errors.As(result.violation, &violation) {
+			t.Skipf("sandbox not available: %v", result.violation)
+		}
+	}
+	return result
+}
+
+func TestSandbox_WritablePaths(t *testing.T) {
+	writable := t.TempDir()
+	run := runSandboxed(t, Config{Writable: []string{writable}}, "sh", "-c", "echo ok > "+writable+"/out")
+	if run.err != nil {
+		t.Fatalf("writing a writable path failed: %v: %s", run.err, run.stderr)
+	}
+	if data, err := os.ReadFile(filepath.Join(writable, "out")); err != nil || string(data) != "ok\n" {
+		t.Errorf("file written in the sandbox = %q, %v, want \"ok\\n\"", data, err)
+	}
+}
+
+func TestSandbox_ReadOnlyFilesystem(t *testing.T) {
+	// The package directory is outside /tmp, where the tmpfs of the sandbox would accept it
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(wd, "sandbox-write-test")
+	t.Cleanup(func() { _ = os.Remove(target) })
+
+	cfg := Config{Writable: []string{t.TempDir()}}
+	run := runSandboxed(t, cfg, "sh", "-c", "echo denied > "+target)
+	if run.err == nil {
+		t.Fatal("writing outside the writable paths succeeded")
+	}
+	var violation *ViolationError
+	if !errors.As(run.violation, &violation) || violation.Kind != KindWrite {
+		t.Errorf("Check() = %v, want a write violation (stderr %q)", run.violation, run.stderr)
+	}
+	if _, statErr := os.Stat(target); statErr == nil {
+		t.Error("the file was written on the host")
+	}
+}
+
+func TestSandbox_TmpIsPrivate(t *testing.T) {
+	run := runSandboxed(t, Config{}, "sh", "-c", "echo private > /tmp/mooncake-sandbox-test && ls /tmp")
+	if run.err != nil {
+		t.Fatalf("writing /tmp failed: %v: %s", run.err, run.stderr)
+	}
+	if strings.TrimSpace(run.stdout) != "mooncake-sandbox-test" {
+		t.Errorf("/tmp in the sandbox = %q, want only the file written there", run.stdout)
+	}
+	if _, statErr := os.Stat("/tmp/mooncake-sandbox-test"); statErr == nil {
+		_ = os.Remove("/tmp/mooncake-sandbox-test")
+		t.Error("the file was written to /tmp of the host")
+	}
+}
+
+func TestSandbox_Network(t *testing.T) {
+	interfaces := func(cfg Config) []string {
+		run := runSandboxed(t, cfg, "cat", "/proc/net/dev")
+		if run.err != nil {
+			t.Fatalf("reading the interfaces failed: %v: %s", run.err, run.stderr)
+		}
+		var names []string
+		for _, line := range strings.Split(run.stdout, "\n") {
+			if name, _, ok := strings.Cut(line, ":"); ok {
+				names = append(names, strings.TrimSpace(name))
+			}
+		}
+		return names
+	}
+
+	if got := interfaces(Config{}); len(got) != 1 || got[0] != "lo" {
+		t.Errorf("interfaces without network = %v, want [lo]", got)
+	}
+	if got := interfaces(Config{Network: true}); len(got) < 1 {
+		t.Errorf("interfaces with network = %v, want the interfaces of this host", got)
+	}
+}
+
+func TestSandbox_Timeout(t *testing.T) {
+	cfg := Config{Timeout: 200 * time.Millisecond}
+	start := time.Now()
+	run := runSandboxed(t, cfg, "sh", "-c", "sleep 10 & sleep 10")
+	if run.err == nil {
+		t.Fatal("command exceeding the time limit succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command stopped after %s, want about 200ms", elapsed)
+	}
+	var violation *ViolationError
+	if !errors.As(run.violation, &violation) || violation.Kind != KindTime {
+		t.Errorf("Check() = %v, want a time violation (stderr %q)", run.violation, run.stderr)
+	}
+}
+
+func TestSandbox_CPULimit(t *testing.T) {
+	cfg := Config{CPU: time.Second}
+	run := runSandboxed(t, cfg, "sh", "-c", "while :; do :; done")
+	if run.err == nil {
+		t.Fatal("command exceeding the CPU time limit succeeded")
+	}
+	var violation *ViolationError
+	if !errors.As(run.violation, &violation) || violation.Kind != KindCPU {
+		t.Errorf("Check() = %v, want a cpu violation (stderr %q)", run.violation, run.stderr)
+	}
+}
+
+func TestSandbox_CommandCannotFakeReports(t *testing.T) {
+	script := `echo "mooncake sandbox: time: faked" >&2; ` +
+		`for fd in /proc/self/fd/* /proc/1/fd/*; do echo "time: faked" > "$fd"; done 2>/dev/null; exit 1`
+	run := runSandboxed(t, Config{}, "sh", "-c", script)
+	if run.err == nil {
+		t.Fatal("command succeeded, want exit status 1")
+	}
+	if run.violation != nil {
+		t.Errorf("Check() = %v, want nil for a report written by the command", run.violation)
+	}
+}
+
+func TestSandbox_NoPrivileges(t *testing.T) {
+	run := runSandboxed(t, Config{}, "grep", "-E", "^(CapEff|NoNewPrivs)", "/proc/self/status")
+	if run.err != nil {
+		t.Fatalf("reading the status failed: %v: %s", run.err, run.stderr)
+	}
+	if !strings.Contains(run.stdout, "CapEff:\t0000000000000000") || !strings.Contains(run.stdout, "NoNewPrivs:\t1") {
+		t.Errorf("status in the sandbox = %q, want no capabilities and no_new_privs", run.stdout)
+	}
+}
+
+func TestWrap_RelativeWritablePath(t *testing.T) {
+	if _, err := Wrap(exec.Command("true"), Config{Writable: []string{"relative"}}); err == nil {
+		t.Error("Wrap() with a relative writable path succeeded")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errUnsupported = errors.New("the sandbox is only supported on Linux")
+
+// Supported returns an error when this host can't run sandboxed commands.
+func Supported() error {
+	return errUnsupported
+}
+
+// Wrap makes cmd run in a sandbox, which is not available on this platform.
+func Wrap(cmd *exec.Cmd, cfg Config) (*Reports, error) {
+	return nil, errUnsupported
+}
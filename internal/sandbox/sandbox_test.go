@@ -0,0 +1,145 @@
+package sandbox
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "1024", want: 1024},
+		{input: "512M", want: 512 << 20},
+		{input: "512MB", want: 512 << 20},
+		{input: "1GiB", want: 1 << 30},
+		{input: "64 kb", want: 64 << 10},
+		{input: "", wantErr: true},
+		{input: "M", wantErr: true},
+		{input: "12TB", wantErr: true},
+		{input: "-1", wantErr: true},
+		{input: "99999999999999999G", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for size, want := range map[int64]string{
+		2 << 30:   "2 GiB",
+		512 << 20: "512 MiB",
+		1536:      "1536 bytes",
+		1 << 10:   "1 KiB",
+	} {
+		if got := FormatSize(size); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", size, got, want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		report   string
+		stderr   string
+		wantKind string
+		wantErr  string
+	}{
+		{
+			name:     "time limit",
+			report:   "time: the command ran longer than the time limit of 1s\n",
+			stderr:   "partial output\n",
+			wantKind: KindTime,
+		},
+		{
+			name:     "cpu limit",
+			report:   "cpu: the command used more than the CPU time limit of 1s\n",
+			wantKind: KindCPU,
+		},
+		{
+			name:    "setup failure",
+			report:  "setup: failed to make the mounts private: operation not permitted\n",
+			wantErr: "failed to set up the sandbox: failed to make the mounts private",
+		},
+		{
+			name:   "report faked on stderr",
+			stderr: "mooncake sandbox: time: the command ran longer than the time limit of 1s",
+		},
+		{
+			name:     "write denied",
+			cfg:      Config{Writable: []string{"/repo"}},
+			stderr:   "sh: 1: cannot create /etc/motd: Read-only file system",
+			wantKind: KindWrite,
+		},
+		{
+			name:     "memory limit",
+			cfg:      Config{Memory: 64 << 20},
+			stderr:   "fatal error: runtime: out of memory",
+			wantKind: KindMemory,
+		},
+		{
+			name:   "memory message without a limit",
+			stderr: "fatal error: runtime: out of memory",
+		},
+		{
+			name:     "no network",
+			stderr:   "curl: (6) Could not resolve host: example.com",
+			wantKind: KindNetwork,
+		},
+		{
+			name:   "network message with network",
+			cfg:    Config{Network: true},
+			stderr: "curl: (6) Could not resolve host: example.com",
+		},
+		{
+			name:   "other failure",
+			stderr: "make: *** [all] Error 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := check(tt.cfg, tt.report, tt.stderr)
+			var violation *ViolationError
+			switch {
+			case tt.wantKind != "":
+				if !errors.As(err, &violation) || violation.Kind != tt.wantKind {
+					t.Errorf("check() = %v, want a %s violation", err, tt.wantKind)
+				}
+			case tt.wantErr != "":
+				if err == nil || errors.As(err, &violation) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("check() = %v, want an error containing %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Errorf("check() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestReports_Nil(t *testing.T) {
+	var reports *Reports
+	if err := reports.Check("mooncake sandbox: time: faked"); err != nil {
+		t.Errorf("Check() on nil = %v, want nil", err)
+	}
+	reports.Close()
+}
+
+func TestViolationError(t *testing.T) {
+	err := &ViolationError{Kind: KindTime, Message: "the command ran longer than the time limit of 1s"}
+	if got := err.Error(); got != "sandbox violation: the command ran longer than the time limit of 1s" {
+		t.Errorf("Error() = %q", got)
+	}
+}
@@ -62,6 +62,21 @@ func (g *Generator) Generate() (*Schema, error) {
 		Description: "Include steps from another file",
 	}
 
+	// Add flush_handlers definition (executor directive, not a registered action)
+	schema.Definitions["flush_handlers"] = &Definition{
+		Type:        "boolean",
+		Description: "Run pending handlers at this point",
+	}
+
+	// Add block definition (step group, not a registered action)
+	schema.Definitions["block"] = &Definition{
+		Type:        "array",
+		Description: "Group of steps with optional rescue and always sections",
+		Items: &SchemaRef{
+			Ref: "#/definitions/step",
+		},
+	}
+
 	// Support both formats at root level using oneOf:
 	// 1. Array of steps (old format for backward compatibility)
 	// 2. RunConfig object (new format with version/vars/steps)
@@ -94,8 +109,9 @@ func (g *Generator) generateStepDefinition() (*Definition, error) {
 		def.AdditionalProperties = &falseVal
 	}
 
-	// Helper for bool pointers
+	// Helpers for bool pointers
 	trueVal := true
+	falseVal := false
 
 	// Add universal fields
 	universalFields := map[string]*Property{
@@ -150,15 +166,19 @@ func (g *Generator) generateStepDefinition() (*Definition, error) {
 		},
 		"timeout": {
 			Type:        "string",
-			Description: "⚠️ SHELL/COMMAND ONLY: Maximum execution time (e.g., '30s', '5m', '1h'). Works with 'shell' and 'command' actions. Ignored for file/template/include.",
+			Description: "Maximum time for each attempt of the step (e.g., '30s', '5m', '1h'). Commands and requests are cancelled when it expires",
 		},
 		"retries": {
 			Type:        "integer",
-			Description: "⚠️ SHELL/COMMAND ONLY: Number of retry attempts on failure. Works with 'shell' and 'command' actions. Ignored for file/template/include.",
+			Description: "Number of retry attempts on failure (or until 'until' is true)",
 		},
 		"retry_delay": {
 			Type:        "string",
-			Description: "⚠️ SHELL/COMMAND ONLY: Delay between retry attempts (e.g., '1s', '5s'). Works with 'shell' and 'command' actions. Ignored for file/template/include.",
+			Description: "Delay between retry attempts (e.g., '1s', '5s')",
+		},
+		"until": {
+			Type:        "string",
+			Description: "Expression evaluated against the step result after each attempt; the step is retried until it is true (default 3 retries)",
 		},
 		"changed_when": {
 			Type:        "string",
@@ -168,6 +188,45 @@ func (g *Generator) generateStepDefinition() (*Definition, error) {
 			Type:        "string",
 			Description: "Expression to override failure condition",
 		},
+		"ignore_errors": {
+			Type:        "boolean",
+			Description: "Record a failure, register the failed result and continue with the next step",
+		},
+		"no_log": {
+			Type:        "boolean",
+			Description: "Hide the output, result and error message of the step from the console, events and artifacts. Inherited by nested steps",
+		},
+		"sandbox": {
+			Type: "object",
+			Properties: map[string]*Property{
+				"writable": {
+					Type:        "array",
+					Items:       &Property{Type: "string"},
+					Description: "Paths the command may write (default: the working directory of the step)",
+				},
+				"network": {
+					Type:        "boolean",
+					Description: "Allow network access (default: false)",
+				},
+				"cpu": {
+					Type:        "string",
+					Pattern:     `^[0-9]+(ns|us|µs|ms|s|m|h)$`,
+					Description: "CPU time limit of each process (e.g., '30s')",
+				},
+				"memory": {
+					Type:        "string",
+					Pattern:     `^[0-9]+ ?([KkMmGg]([Ii]?[Bb])?|[Bb])?$`,
+					Description: "Memory limit of each process in bytes or with a K, M or G unit (e.g., '512MB')",
+				},
+				"timeout": {
+					Type:        "string",
+					Pattern:     `^[0-9]+(ns|us|µs|ms|s|m|h)$`,
+					Description: "Wall-clock time limit of the command (e.g., '5m')",
+				},
+			},
+			AdditionalProps: &falseVal,
+			Description:     "⚠️ SHELL/COMMAND ONLY, LINUX ONLY: Run the command in a sandbox where only the writable paths and a private /tmp are writable, without network access by default. Use {} for the defaults",
+		},
 		"become_user": {
 			Type:        "string",
 			Description: "⚠️ SHELL/COMMAND ONLY: User to become via sudo (e.g., 'root', 'postgres'). Works with 'shell' and 'command' actions. Ignored for file/template/include.",
@@ -176,6 +235,44 @@ func (g *Generator) generateStepDefinition() (*Definition, error) {
 			Type:        "string",
 			Description: "Path to YAML file with steps to include",
 		},
+		"block": {
+			Type:        "array",
+			Items:       &Property{Ref: "#/definitions/step"},
+			Description: "Group of steps executed together. when, tags and become are inherited by nested steps",
+		},
+		"rescue": {
+			Type:        "array",
+			Items:       &Property{Ref: "#/definitions/step"},
+			Description: "Steps executed when a step in block fails. Failure details are available in failed_step (requires block)",
+		},
+		"notify": {
+			Type: "array",
+			Items: &Property{
+				Type: "string",
+			},
+			Description: "Handler names to run once after the main steps when this step reports a change",
+		},
+		"id": {
+			Type:        "string",
+			Pattern:     "^[A-Za-z0-9_.-]+$",
+			Description: "Identifier other steps can reference in depends_on",
+		},
+		"depends_on": {
+			Type: "array",
+			Items: &Property{
+				Type: "string",
+			},
+			Description: "IDs of earlier steps that must finish first. In parallel runs, steps start as soon as their dependencies are done",
+		},
+		"flush_handlers": {
+			Type:        "boolean",
+			Description: "Run handlers notified so far at this point instead of at the end of the run",
+		},
+		"always": {
+			Type:        "array",
+			Items:       &Property{Ref: "#/definitions/step"},
+			Description: "Steps executed after block and rescue regardless of outcome (requires block)",
+		},
 	}
 
 	for name, prop := range universalFields {
@@ -186,6 +283,12 @@ func (g *Generator) generateStepDefinition() (*Definition, error) {
 		def.Properties[name] = prop
 	}
 
+	// rescue and always only make sense as part of a block
+	def.Dependencies = map[string][]string{
+		"rescue": {"block"},
+		"always": {"block"},
+	}
+
 	// Get all action names for oneOf generation
 	actionMetas := actions.List()
 	var actionNames []string //nolint:prealloc // Size unknown at compile time
@@ -217,9 +320,9 @@ func (g *Generator) generateStepDefinition() (*Definition, error) {
 		def.Properties[meta.Name] = actionProp
 	}
 
-	// Add "include" to action names for oneOf generation
-	// (include is a special string field, not a registered action)
-	actionNames = append(actionNames, "include")
+	// Add "include", "block" and "flush_handlers" to action names for oneOf generation
+	// (these are special step fields, not registered actions)
+	actionNames = append(actionNames, "include", "block", "flush_handlers")
 
 	// Sort action names for deterministic schema generation
 	sort.Strings(actionNames)
@@ -257,6 +360,25 @@ func (g *Generator) generateRunConfigDefinition() *Definition {
 				},
 				Description: "Configuration steps to execute",
 			},
+			"handlers": {
+				Type: "array",
+				Items: &Property{
+					Ref: "#/definitions/step",
+				},
+				Description: "Steps that run once after the main steps when notified by a changed step",
+			},
+			"strategy": {
+				Type:        "string", //nolint:goconst // JSON Schema type
+				Enum:        []interface{}{"sequential", "parallel"},
+				Description: "How the steps of this file are scheduled. parallel runs independent steps concurrently; sequential keeps them in order even in --parallel runs",
+			},
+			"secrets": {
+				Type: "array",
+				Items: &Property{
+					Type: "string", //nolint:goconst // JSON Schema type
+				},
+				Description: "Names of variables holding secrets. Their values, including results registered under these names, are redacted from the console, events and artifacts",
+			},
 		},
 		Required: []string{"steps"},
 	}
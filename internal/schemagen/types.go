@@ -32,10 +32,14 @@ type Definition struct {
 	Description string                 `json:"description,omitempty" yaml:"description,omitempty"`
 	Properties  map[string]*Property   `json:"properties,omitempty" yaml:"properties,omitempty"`
 	Required    []string               `json:"required,omitempty" yaml:"required,omitempty"`
+	Items       *SchemaRef             `json:"items,omitempty" yaml:"items,omitempty"`
 	OneOf       []*OneOfConstraint     `json:"oneOf,omitempty" yaml:"oneOf,omitempty"`
 	AnyOf       []*SchemaRef           `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
 	AllOf       []*SchemaRef           `json:"allOf,omitempty" yaml:"allOf,omitempty"`
 
+	// Dependencies lists properties that require other properties to be present
+	Dependencies map[string][]string `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+
 	// additionalProperties controls whether unknown properties are allowed
 	AdditionalProperties *bool `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
 
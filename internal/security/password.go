@@ -18,10 +18,16 @@ type PasswordProvider interface {
 }
 
 // InteractivePasswordProvider prompts the user for password input
-type InteractivePasswordProvider struct{}
+type InteractivePasswordProvider struct {
+	Prompt string // Defaults to "BECOME password: "
+}
 
 func (p *InteractivePasswordProvider) GetPassword() (string, error) {
-	fmt.Fprint(os.Stderr, "BECOME password: ")
+	prompt := p.Prompt
+	if prompt == "" {
+		prompt = "BECOME password: "
+	}
+	fmt.Fprint(os.Stderr, prompt)
 	password, err := term.ReadPassword(syscall.Stdin)
 	fmt.Fprintln(os.Stderr) // New line after password input
 	if err != nil {
@@ -120,6 +126,23 @@ func (p *EnvPasswordProvider) Source() string {
 	return fmt.Sprintf("env:SUDO_ASKPASS=%s", p.ProgramPath)
 }
 
+// EnvVarPasswordProvider reads password from an environment variable
+type EnvVarPasswordProvider struct {
+	Name string
+}
+
+func (p *EnvVarPasswordProvider) GetPassword() (string, error) {
+	password := os.Getenv(p.Name)
+	if password == "" {
+		return "", fmt.Errorf("$%s is empty", p.Name)
+	}
+	return password, nil
+}
+
+func (p *EnvVarPasswordProvider) Source() string {
+	return fmt.Sprintf("env:%s", p.Name)
+}
+
 // CLIPasswordProvider wraps the existing --sudo-pass flag
 type CLIPasswordProvider struct {
 	Password string
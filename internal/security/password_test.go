@@ -313,6 +313,23 @@ func TestEnvPasswordProvider_ProgramFails(t *testing.T) {
 	}
 }
 
+// TestEnvVarPasswordProvider tests reading password from an environment variable
+func TestEnvVarPasswordProvider(t *testing.T) {
+	t.Setenv("MOONCAKE_TEST_PASSWORD", "from-env")
+	provider := &EnvVarPasswordProvider{Name: "MOONCAKE_TEST_PASSWORD"}
+	if password, err := provider.GetPassword(); err != nil || password != "from-env" {
+		t.Errorf("GetPassword() = %q, %v", password, err)
+	}
+	if provider.Source() != "env:MOONCAKE_TEST_PASSWORD" {
+		t.Errorf("Source() = %q", provider.Source())
+	}
+
+	t.Setenv("MOONCAKE_TEST_PASSWORD", "")
+	if _, err := provider.GetPassword(); err == nil {
+		t.Error("Expected error for empty variable, got nil")
+	}
+}
+
 // Note: SUDO_ASKPASS fallback is currently unreachable in ResolvePassword
 // because the function returns early when no method is specified.
 // This test is commented out until that code path is either fixed or removed.
@@ -12,6 +12,80 @@ type Redactor struct {
 	mu              sync.RWMutex
 }
 
+// secretSet holds the values every Redactor redacts, such as the values of
+// encrypted variables files, longest first.
+type secretSet struct {
+	mu     sync.RWMutex
+	values []string
+	known  map[string]bool
+	runs   int // Runs in progress
+}
+
+// secrets are the secrets of the runs in progress.
+var secrets = &secretSet{known: make(map[string]bool)}
+
+// RegisterSecret makes every Redactor, including the ones already created,
+// redact value. Empty strings are ignored.
+func RegisterSecret(value string) {
+	if value == "" {
+		return
+	}
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	if secrets.known[value] {
+		return
+	}
+	secrets.known[value] = true
+	// Keep the values longest first, for proper substring matching
+	i := sort.Search(len(secrets.values), func(i int) bool { return len(secrets.values[i]) < len(value) })
+	secrets.values = append(secrets.values, "")
+	copy(secrets.values[i+1:], secrets.values[i:])
+	secrets.values[i] = value
+}
+
+// BeginRun marks the start of a run, or of any other work registering secrets,
+// and returns the function marking its end. Registered secrets are forgotten
+// when the last run in progress ends, so a long-lived server doesn't redact the
+// secrets of earlier runs from later ones.
+func BeginRun() (end func()) {
+	secrets.mu.Lock()
+	secrets.runs++
+	secrets.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			secrets.mu.Lock()
+			defer secrets.mu.Unlock()
+			if secrets.runs--; secrets.runs == 0 {
+				secrets.reset()
+			}
+		})
+	}
+}
+
+// ResetSecrets forgets the registered secrets.
+func ResetSecrets() {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	secrets.reset()
+}
+
+func (s *secretSet) reset() {
+	s.values = nil
+	s.known = make(map[string]bool)
+}
+
+// redact replaces the secrets in text with [REDACTED].
+func (s *secretSet) redact(text string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, secret := range s.values {
+		text = strings.ReplaceAll(text, secret, "[REDACTED]")
+	}
+	return text
+}
+
 // NewRedactor creates a new Redactor instance
 func NewRedactor() *Redactor {
 	return &Redactor{
@@ -36,11 +110,13 @@ func (r *Redactor) AddSensitive(value string) {
 	})
 }
 
-// Redact replaces all occurrences of sensitive values with [REDACTED]
+// Redact replaces all occurrences of sensitive values, and of registered
+// secrets, with [REDACTED]
 func (r *Redactor) Redact(text string) string {
 	if text == "" {
 		return text
 	}
+	text = secrets.redact(text)
 
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -185,3 +185,72 @@ func BenchmarkRedactor_Redact(b *testing.B) {
 		_ = redactor.Redact(input)
 	}
 }
+
+func TestRegisterSecret(t *testing.T) {
+	t.Cleanup(ResetSecrets)
+	redactor := NewRedactor()
+	redactor.AddSensitive("local-password")
+
+	// Registered secrets are redacted by existing redactors
+	RegisterSecret("registered-vault-value")
+	RegisterSecret("registered-vault-value")
+	RegisterSecret("")
+
+	result := redactor.Redact("local-password and registered-vault-value")
+	if result != "[REDACTED] and [REDACTED]" {
+		t.Errorf("Redact() = %q", result)
+	}
+	if got := NewRedactor().Redact("registered-vault-value"); got != "[REDACTED]" {
+		t.Errorf("new Redactor Redact() = %q", got)
+	}
+
+	count := 0
+	for _, value := range secrets.values {
+		if value == "registered-vault-value" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("secret registered %d times, want once", count)
+	}
+}
+
+func TestBeginRun(t *testing.T) {
+	t.Cleanup(ResetSecrets)
+
+	endFirst := BeginRun()
+	RegisterSecret("first-run-secret")
+	endSecond := BeginRun()
+	RegisterSecret("second-run-secret")
+
+	// Secrets are kept while a run is in progress
+	endFirst()
+	endFirst()
+	if got := RedactSecrets("first-run-secret second-run-secret"); got != "[REDACTED] [REDACTED]" {
+		t.Errorf("RedactSecrets() during a run = %q", got)
+	}
+
+	endSecond()
+	if HasSecrets() {
+		t.Errorf("secrets = %q after the last run ended, want none", secrets.values)
+	}
+	if got := RedactSecrets("first-run-secret"); got != "first-run-secret" {
+		t.Errorf("RedactSecrets() after the runs = %q", got)
+	}
+}
+
+func TestRegisterSecret_Order(t *testing.T) {
+	t.Cleanup(ResetSecrets)
+	for _, value := range []string{"bb", "a", "dddd", "ccc", "eeee"} {
+		RegisterSecret(value)
+	}
+	want := []string{"dddd", "eeee", "ccc", "bb", "a"}
+	for i, value := range secrets.values {
+		if len(value) != len(want[i]) {
+			t.Fatalf("secrets = %q, want longest first", secrets.values)
+		}
+	}
+	if got := RedactSecrets("dddd"); got != "[REDACTED]" {
+		t.Errorf("RedactSecrets() = %q", got)
+	}
+}
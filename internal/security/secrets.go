@@ -0,0 +1,168 @@
+package security
+
+import (
+	"reflect"
+	"strings"
+)
+
+// minSecretLength is the length of the shortest value RegisterSecrets
+// registers: shorter ones, such as ports or flags, would garble the output
+// they're redacted from.
+const minSecretLength = 4
+
+// RegisterSecrets registers the string values of a variable, and the lines of
+// multi-line ones, as secrets. Maps and lists are walked.
+func RegisterSecrets(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, item := range v {
+			RegisterSecrets(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			RegisterSecrets(item)
+		}
+	case string:
+		if len(v) >= minSecretLength {
+			RegisterSecret(v)
+		}
+		if strings.Contains(v, "\n") {
+			for _, line := range strings.Split(v, "\n") {
+				if line = strings.TrimSpace(line); len(line) >= minSecretLength {
+					RegisterSecret(line)
+				}
+			}
+		}
+	}
+}
+
+// HasSecrets reports whether secrets were registered.
+func HasSecrets() bool {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	return len(secrets.values) > 0
+}
+
+// RedactSecrets replaces the registered secrets in text with [REDACTED].
+func RedactSecrets(text string) string {
+	if text == "" {
+		return text
+	}
+	return secrets.redact(text)
+}
+
+// RedactValue returns a copy of value with the registered secrets redacted
+// from its strings, and whether any was. Structs, pointers, maps, slices and
+// interfaces are copied only where a string changed: the rest is shared with
+// value. Unexported struct fields and map keys are left as they are. value
+// must not contain cycles.
+func RedactValue[T any](value T) (T, bool) {
+	if !HasSecrets() {
+		return value, false
+	}
+	v := reflect.ValueOf(&value).Elem()
+	redacted, changed := redactValue(v)
+	if !changed {
+		return value, false
+	}
+	return redacted.Interface().(T), true
+}
+
+func redactValue(v reflect.Value) (reflect.Value, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		if redacted := RedactSecrets(s); redacted != s {
+			return reflect.ValueOf(redacted).Convert(v.Type()), true
+		}
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			break
+		}
+		if elem, changed := redactValue(v.Elem()); changed {
+			ptr := reflect.New(v.Type().Elem())
+			ptr.Elem().Set(elem)
+			return ptr, true
+		}
+
+	case reflect.Interface:
+		if v.IsNil() {
+			break
+		}
+		if elem, changed := redactValue(v.Elem()); changed {
+			out := reflect.New(v.Type()).Elem()
+			out.Set(elem)
+			return out, true
+		}
+
+	case reflect.Struct:
+		var out reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			field, changed := redactValue(v.Field(i))
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.New(v.Type()).Elem()
+				out.Set(v)
+			}
+			out.Field(i).Set(field)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			break
+		}
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			item, changed := redactValue(v.Index(i))
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				if v.Kind() == reflect.Slice {
+					out = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+				} else {
+					out = reflect.New(v.Type()).Elem()
+				}
+				reflect.Copy(out, v)
+			}
+			out.Index(i).Set(item)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+
+	case reflect.Map:
+		if v.IsNil() {
+			break
+		}
+		var out reflect.Value
+		iter := v.MapRange()
+		for iter.Next() {
+			item, changed := redactValue(iter.Value())
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.MakeMapWithSize(v.Type(), v.Len())
+				all := v.MapRange()
+				for all.Next() {
+					out.SetMapIndex(all.Key(), all.Value())
+				}
+			}
+			out.SetMapIndex(iter.Key(), item)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+	}
+	return v, false
+}
@@ -0,0 +1,87 @@
+package security
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegisterSecrets(t *testing.T) {
+	t.Cleanup(ResetSecrets)
+	RegisterSecrets(map[string]interface{}{
+		"token": "register-secrets-token",
+		"port":  8080,
+		"short": "abc",
+		"nested": map[string]interface{}{
+			"keys": []interface{}{"register-secrets-key", true},
+			"pem":  "-----BEGIN TEST KEY-----\nregister-secrets-pem\n-----END TEST KEY-----\n",
+		},
+	})
+
+	for text, want := range map[string]string{
+		"token register-secrets-token": "token [REDACTED]",
+		"key register-secrets-key":     "key [REDACTED]",
+		"line register-secrets-pem":    "line [REDACTED]",
+		"port 8080, abc":               "port 8080, abc",
+	} {
+		if got := RedactSecrets(text); got != want {
+			t.Errorf("RedactSecrets(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+type redactTestStep struct {
+	Name    string
+	Command *string
+	Env     map[string]string
+	Args    []string
+	Data    interface{}
+	Count   int
+	hidden  string
+}
+
+func TestRedactValue(t *testing.T) {
+	t.Cleanup(ResetSecrets)
+	RegisterSecret("redact-value-secret")
+
+	command := "curl -H 'Authorization: redact-value-secret'"
+	original := redactTestStep{
+		Name:    "call",
+		Command: &command,
+		Env:     map[string]string{"TOKEN": "redact-value-secret", "HOME": "/root"},
+		Args:    []string{"a", "redact-value-secret"},
+		Data:    map[string]interface{}{"nested": []interface{}{"redact-value-secret"}},
+		Count:   2,
+		hidden:  "redact-value-secret",
+	}
+
+	redacted, changed := RedactValue(original)
+	if !changed {
+		t.Fatal("RedactValue() changed = false")
+	}
+	want := redactTestStep{
+		Name:    "call",
+		Command: ptr("curl -H 'Authorization: [REDACTED]'"),
+		Env:     map[string]string{"TOKEN": "[REDACTED]", "HOME": "/root"},
+		Args:    []string{"a", "[REDACTED]"},
+		Data:    map[string]interface{}{"nested": []interface{}{"[REDACTED]"}},
+		Count:   2,
+		hidden:  "redact-value-secret",
+	}
+	if !reflect.DeepEqual(redacted, want) {
+		t.Errorf("RedactValue() = %+v, want %+v", redacted, want)
+	}
+
+	// The original is left as it is
+	if *original.Command != command || original.Env["TOKEN"] != "redact-value-secret" || original.Args[1] != "redact-value-secret" {
+		t.Errorf("RedactValue() modified its argument: %+v", original)
+	}
+
+	if _, changed := RedactValue(redactTestStep{Name: "plain"}); changed {
+		t.Error("RedactValue() of a value without secrets changed = true")
+	}
+	if got, _ := RedactValue[interface{}]("x redact-value-secret"); got != "x [REDACTED]" {
+		t.Errorf("RedactValue() of an interface = %v", got)
+	}
+}
+
+func ptr(s string) *string { return &s }
@@ -0,0 +1,124 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// Signing keys are ed25519 keys stored as PEM: the private key in PKCS #8
+// ("PRIVATE KEY" block), the public key in PKIX ("PUBLIC KEY" block), as
+// written by openssl.
+const (
+	pemPrivateKey = "PRIVATE KEY"
+	pemPublicKey  = "PUBLIC KEY"
+)
+
+// GenerateSigningKey creates an ed25519 key pair, writing the private key to path
+// (mode 0600) and the public key to path + ".pub". Existing files are not overwritten.
+func GenerateSigningKey(path string) (ed25519.PublicKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	if err := writeNewFile(path, pem.EncodeToMemory(&pem.Block{Type: pemPrivateKey, Bytes: privateDER}), 0600); err != nil {
+		return nil, err
+	}
+	if err := writeNewFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: pemPublicKey, Bytes: publicDER}), 0644); err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
+
+// writeNewFile writes data to a file that must not exist yet.
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	// #nosec G304 -- key path is a user-provided CLI argument
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return file.Close()
+}
+
+// LoadSigningKey reads an ed25519 private key. Like password files, the key file
+// must have 0600 permissions.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot access signing key: %w", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		return nil, fmt.Errorf("signing key must have 0600 permissions, found %04o", mode)
+	}
+
+	der, err := readPEM(path, pemPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %w", path, err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an ed25519 key", path)
+	}
+	return privateKey, nil
+}
+
+// LoadVerifyKey reads an ed25519 public key.
+func LoadVerifyKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, pemPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an ed25519 key", path)
+	}
+	return publicKey, nil
+}
+
+// readPEM reads the first PEM block of a file, which must have the given type.
+func readPEM(path, blockType string) ([]byte, error) {
+	// #nosec G304 -- key path is a user-provided CLI argument
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s has no PEM %q block", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// KeyID returns a short identifier of a public key: the first 16 hex digits of
+// its SHA-256.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,89 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSigningKey(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "plan.key")
+
+	publicKey, err := GenerateSigningKey(keyPath)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey() error = %v", err)
+	}
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("private key mode = %04o, want 0600", mode)
+	}
+
+	privateKey, err := LoadSigningKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadSigningKey() error = %v", err)
+	}
+	loadedPublic, err := LoadVerifyKey(keyPath + ".pub")
+	if err != nil {
+		t.Fatalf("LoadVerifyKey() error = %v", err)
+	}
+	if !loadedPublic.Equal(publicKey) || !privateKey.Public().(ed25519.PublicKey).Equal(publicKey) {
+		t.Error("loaded keys don't match the generated key pair")
+	}
+
+	if _, err := GenerateSigningKey(keyPath); err == nil {
+		t.Error("GenerateSigningKey() should not overwrite an existing key")
+	}
+}
+
+func TestLoadSigningKey_InvalidPermissions(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "plan.key")
+	if _, err := GenerateSigningKey(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(keyPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := LoadSigningKey(keyPath)
+	if err == nil || !strings.Contains(err.Error(), "0600") {
+		t.Errorf("LoadSigningKey() error = %v, want a permissions error", err)
+	}
+}
+
+func TestLoadKeys_WrongBlock(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "plan.key")
+	if _, err := GenerateSigningKey(keyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// A private key is not a public key and vice versa
+	if _, err := LoadVerifyKey(keyPath); err == nil {
+		t.Error("LoadVerifyKey() should reject a private key")
+	}
+	if err := os.Chmod(keyPath+".pub", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSigningKey(keyPath + ".pub"); err == nil {
+		t.Error("LoadSigningKey() should reject a public key")
+	}
+	if _, err := LoadVerifyKey(filepath.Join(t.TempDir(), "missing.pub")); err == nil {
+		t.Error("LoadVerifyKey() should fail for a missing file")
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	publicKey := make(ed25519.PublicKey, ed25519.PublicKeySize)
+	id := KeyID(publicKey)
+	if len(id) != 16 {
+		t.Errorf("KeyID() = %q, want 16 hex digits", id)
+	}
+	if KeyID(publicKey) != id {
+		t.Error("KeyID() is not deterministic")
+	}
+}
@@ -0,0 +1,47 @@
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// FileSink appends records to a file, one JSON object per line.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens a JSON lines file for appending, creating it if needed.
+// Files are created with 0600 permissions, as events can include command
+// output.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600) // #nosec G304 -- user-provided events file
+	if err != nil {
+		return nil, fmt.Errorf("failed to open events file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Write implements Sink.
+func (s *FileSink) Write(record events.Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", record.Type, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// One write per line, so concurrent writers to the file don't interleave lines
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close implements Sink.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,84 @@
+// Package sinks ships run events to persistent destinations: JSON lines files,
+// webhooks and syslog. Events are written as events.Record, whose schema is
+// given by events.Schema.
+package sinks
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// Sink writes event records to a destination. Sinks are safe for concurrent
+// use, so the runs of several hosts can share them.
+type Sink interface {
+	// Write writes a record. It must not block on slow destinations.
+	Write(record events.Record) error
+
+	// Close flushes the pending records and releases the sink.
+	Close() error
+}
+
+// Subscriber writes the events of a run to sinks, as records of the host the
+// run applies the config to.
+type Subscriber struct {
+	host  string
+	sinks []Sink
+
+	mu     sync.Mutex
+	runID  string
+	failed map[int]bool // Sinks whose write error was reported, by index
+}
+
+// NewSubscriber returns a subscriber writing the events of a run on host to
+// sinks.
+func NewSubscriber(host string, sinks ...Sink) *Subscriber {
+	return &Subscriber{host: host, sinks: sinks, failed: make(map[int]bool)}
+}
+
+// OnEvent implements events.Subscriber.
+func (s *Subscriber) OnEvent(event events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if data, ok := event.Data.(events.RunStartedData); ok {
+		s.runID = data.RunID
+	}
+	timestamp := event.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	record := events.Record{
+		SchemaVersion: events.SchemaVersion,
+		Type:          event.Type,
+		Timestamp:     timestamp,
+		Host:          s.host,
+		RunID:         s.runID,
+		Data:          event.Data,
+	}
+	for i, sink := range s.sinks {
+		// Report the first error of each sink, not one per event
+		if err := sink.Write(record); err != nil && !s.failed[i] {
+			s.failed[i] = true
+			log.Printf("Warning: failed to write events to sink: %v", err)
+		}
+	}
+}
+
+// Close implements events.Subscriber. The sinks are not closed, as they may be
+// shared with other runs: their owner closes them.
+func (s *Subscriber) Close() {}
+
+// isFailure reports whether a record is a failure: a failed step that wasn't
+// ignored, a failed assertion or a failed run.
+func isFailure(record events.Record) bool {
+	switch data := record.Data.(type) {
+	case events.StepFailedData:
+		return !data.Ignored
+	case events.RunCompletedData:
+		return !data.Success
+	}
+	return record.Type == events.EventAssertFailed
+}
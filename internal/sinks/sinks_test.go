@@ -0,0 +1,133 @@
+package sinks
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// memorySink keeps the records written to it.
+type memorySink struct {
+	mu      sync.Mutex
+	records []events.Record
+	err     error
+}
+
+func (m *memorySink) Write(record events.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, record)
+	return m.err
+}
+
+func (m *memorySink) Close() error { return nil }
+
+// readLines decodes the records of a JSON lines file.
+func readLines(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestSubscriber(t *testing.T) {
+	sink := &memorySink{}
+	subscriber := NewSubscriber("web1", sink)
+	now := time.Now()
+
+	subscriber.OnEvent(events.Event{Type: events.EventPlanLoaded, Timestamp: now, Data: events.PlanLoadedData{TotalSteps: 1}})
+	subscriber.OnEvent(events.Event{Type: events.EventRunStarted, Timestamp: now, Data: events.RunStartedData{RunID: "run-1"}})
+	subscriber.OnEvent(events.Event{Type: events.EventPrintMessage, Data: events.PrintData{Message: "hi"}})
+	subscriber.Close()
+
+	if len(sink.records) != 3 {
+		t.Fatalf("records = %+v", sink.records)
+	}
+	for i, record := range sink.records {
+		if record.SchemaVersion != events.SchemaVersion || record.Host != "web1" || record.Timestamp.IsZero() {
+			t.Errorf("record %d = %+v", i, record)
+		}
+	}
+	if sink.records[0].RunID != "" || sink.records[1].RunID != "run-1" || sink.records[2].RunID != "run-1" {
+		t.Errorf("run IDs = %q, %q, %q", sink.records[0].RunID, sink.records[1].RunID, sink.records[2].RunID)
+	}
+	if sink.records[2].Data.(events.PrintData).Message != "hi" {
+		t.Errorf("data = %+v", sink.records[2].Data)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, []byte(`{"previous":"run"}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			NewSubscriber("host", sink).OnEvent(events.Event{Type: events.EventStepStdout, Data: events.StepOutputData{StepID: "1", Line: "output"}})
+		}()
+	}
+	wg.Wait()
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readLines(t, path)
+	if len(records) != 21 || records[0]["previous"] != "run" {
+		t.Fatalf("file has %d records, want the previous one and 20 appended", len(records))
+	}
+	if records[1]["type"] != "step.stdout" || records[1]["schema_version"] != float64(events.SchemaVersion) {
+		t.Errorf("record = %v", records[1])
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %v, %v", info, err)
+	}
+
+	if _, err := NewFileSink(filepath.Join(t.TempDir(), "missing", "events.jsonl")); err == nil {
+		t.Error("NewFileSink() in a missing directory succeeded")
+	}
+}
+
+func TestIsFailure(t *testing.T) {
+	tests := []struct {
+		record events.Record
+		want   bool
+	}{
+		{events.Record{Type: events.EventStepFailed, Data: events.StepFailedData{}}, true},
+		{events.Record{Type: events.EventStepFailed, Data: events.StepFailedData{Ignored: true}}, false},
+		{events.Record{Type: events.EventRunCompleted, Data: events.RunCompletedData{Success: false}}, true},
+		{events.Record{Type: events.EventRunCompleted, Data: events.RunCompletedData{Success: true}}, false},
+		{events.Record{Type: events.EventAssertFailed, Data: events.AssertionData{Failed: true}}, true},
+		{events.Record{Type: events.EventStepCompleted, Data: events.StepCompletedData{}}, false},
+	}
+	for _, tt := range tests {
+		if got := isFailure(tt.record); got != tt.want {
+			t.Errorf("isFailure(%s %+v) = %v, want %v", tt.record.Type, tt.record.Data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows || plan9
+
+package sinks
+
+import (
+	"fmt"
+
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// SyslogSink writes records to syslog, which is not available on this platform.
+type SyslogSink struct{}
+
+// NewSyslogSink returns an error: syslog is not available on this platform.
+func NewSyslogSink(_, _, _ string) (*SyslogSink, error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
+
+// Write implements Sink.
+func (s *SyslogSink) Write(_ events.Record) error {
+	return nil
+}
+
+// Close implements Sink.
+func (s *SyslogSink) Close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+//go:build !windows && !plan9
+
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// SyslogSink writes records to syslog, one JSON message per record. On systemd
+// hosts, journald collects the messages of the local syslog socket.
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogSink connects to the syslog daemon at address over network, or to
+// the local one if both are empty. Messages have the user facility and tag.
+func NewSyslogSink(network, address, tag string) (*SyslogSink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+// Write implements Sink. Failures are logged with the error priority, other
+// events with the info priority.
+func (s *SyslogSink) Write(record events.Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", record.Type, err)
+	}
+	if isFailure(record) {
+		return s.writer.Err(string(data))
+	}
+	return s.writer.Info(string(data))
+}
+
+// Close implements Sink.
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,53 @@
+//go:build !windows && !plan9
+
+package sinks
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+func TestSyslogSink(t *testing.T) {
+	address := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", address)
+	if err != nil {
+		t.Skipf("unixgram sockets not available: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	sink, err := NewSyslogSink("unixgram", address, "mooncake-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []events.Record{
+		{SchemaVersion: events.SchemaVersion, Type: events.EventStepCompleted, Host: "h", Data: events.StepCompletedData{StepID: "1"}},
+		{SchemaVersion: events.SchemaVersion, Type: events.EventStepFailed, Host: "h", Data: events.StepFailedData{StepID: "2"}},
+	}
+	for _, record := range records {
+		if err := sink.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// <priority>: user facility (8) + info (6) or err (3)
+	for i, want := range []string{"<14>", "<11>"} {
+		buf := make([]byte, 4096)
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := string(buf[:n])
+		if !strings.HasPrefix(message, want) || !strings.Contains(message, "mooncake-test") || !strings.Contains(message, `"type":"`+string(records[i].Type)+`"`) {
+			t.Errorf("message %d = %q, want priority %s", i, message, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package sinks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/batch"
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// Webhook request headers.
+const (
+	// SignatureHeader is the HMAC-SHA256 of the body with the webhook secret:
+	// "sha256=<hex>".
+	SignatureHeader = "X-Mooncake-Signature"
+
+	// DeliveryHeader identifies a batch. Retries of a batch have the same ID,
+	// so receivers can drop duplicates.
+	DeliveryHeader = "X-Mooncake-Delivery"
+)
+
+// Webhook defaults.
+const (
+	defaultBatchSize      = 100
+	defaultFlushInterval  = 2 * time.Second
+	defaultMaxAttempts    = 4
+	defaultRetryDelay     = 500 * time.Millisecond
+	defaultWebhookTimeout = 10 * time.Second
+	defaultCloseTimeout   = 30 * time.Second
+
+	// maxPendingBatches bounds the records kept while the receiver is down;
+	// newer records are dropped.
+	maxPendingBatches = 100
+)
+
+// WebhookOptions configures a WebhookSink.
+type WebhookOptions struct {
+	// URL receives the batches as POST requests: {"events": [records]}.
+	URL string
+
+	// Secret signs the requests (SignatureHeader). Empty sends them unsigned.
+	Secret []byte
+
+	// BatchSize is the maximum number of records per request (default: 100).
+	BatchSize int
+
+	// FlushInterval is the maximum time a record waits for its batch to fill up
+	// (default: 2s).
+	FlushInterval time.Duration
+
+	// MaxAttempts is the number of attempts to deliver a batch, retrying after
+	// network errors, 408, 429 and 5xx responses (default: 4).
+	MaxAttempts int
+
+	// RetryDelay is the delay before the first retry, doubled for each later
+	// retry (default: 500ms).
+	RetryDelay time.Duration
+
+	// CloseTimeout bounds the time Close spends delivering the pending records;
+	// records still pending then are dropped (default: 30s).
+	CloseTimeout time.Duration
+
+	// Client sends the requests (default: a client with a 10s timeout).
+	Client *http.Client
+}
+
+// WebhookSink posts records to a URL in batches, from a background goroutine.
+type WebhookSink struct {
+	opts   WebhookOptions
+	sender *batch.Sender[json.RawMessage]
+}
+
+// NewWebhookSink returns a sink posting to opts.URL, and starts its sender.
+func NewWebhookSink(opts WebhookOptions) (*WebhookSink, error) {
+	parsed, err := url.Parse(opts.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q: must be an http or https URL", opts.URL)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = defaultRetryDelay
+	}
+	if opts.CloseTimeout <= 0 {
+		opts.CloseTimeout = defaultCloseTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultWebhookTimeout}
+	}
+
+	s := &WebhookSink{opts: opts}
+	s.sender = batch.New(batch.Options[json.RawMessage]{
+		URL:           opts.URL,
+		Name:          "webhook",
+		BatchSize:     opts.BatchSize,
+		FlushInterval: opts.FlushInterval,
+		MaxQueued:     maxPendingBatches * opts.BatchSize,
+		MaxAttempts:   opts.MaxAttempts,
+		RetryDelay:    opts.RetryDelay,
+		CloseTimeout:  opts.CloseTimeout,
+		Client:        opts.Client,
+		Encode:        s.encode,
+		Retry: func(status int) bool {
+			return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+		},
+	})
+	return s, nil
+}
+
+// Write implements Sink. It queues the record for the next batch.
+func (s *WebhookSink) Write(record events.Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", record.Type, err)
+	}
+	if err := s.sender.Add(data); err != nil {
+		return fmt.Errorf("%w, dropping events", err)
+	}
+	return nil
+}
+
+// Close implements Sink. It delivers the pending records within the close
+// timeout, then reports the records that couldn't be delivered.
+func (s *WebhookSink) Close() error {
+	if dropped, err := s.sender.Close(); dropped > 0 {
+		return fmt.Errorf("webhook %s: %d events were not delivered: %w", s.opts.URL, dropped, err)
+	}
+	return nil
+}
+
+// encode returns the body of a batch and its headers: a delivery ID, the same
+// for every attempt, and the signature if the sink has a secret.
+func (s *WebhookSink) encode(records []json.RawMessage) ([]byte, http.Header, error) {
+	body, err := json.Marshal(map[string][]json.RawMessage{"events": records})
+	if err != nil {
+		return nil, nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set(DeliveryHeader, hex.EncodeToString(id))
+	if len(s.opts.Secret) > 0 {
+		header.Set(SignatureHeader, Sign(s.opts.Secret, body))
+	}
+	return body, header, nil
+}
+
+// Sign returns the signature of a webhook body: "sha256=" and the hex
+// HMAC-SHA256 of the body with the secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,206 @@
+package sinks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// receiver records the requests of a webhook.
+type receiver struct {
+	mu       sync.Mutex
+	batches  [][]events.Record
+	requests []*http.Request
+	bodies   [][]byte
+	status   func(attempt int) int // Status of the nth request
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	status := http.StatusOK
+	if rc.status != nil {
+		status = rc.status(len(rc.requests))
+	}
+	if status == http.StatusOK {
+		var batch struct {
+			Events []events.Record `json:"events"`
+		}
+		_ = json.Unmarshal(body, &batch)
+		rc.batches = append(rc.batches, batch.Events)
+	}
+	rc.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func writeRecords(t *testing.T, sink Sink, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := sink.Write(events.Record{SchemaVersion: events.SchemaVersion, Type: events.EventPrintMessage, Host: "h", Data: events.PrintData{Message: "m"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWebhookSink_Batches(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookOptions{URL: server.URL, Secret: []byte("s3cret"), BatchSize: 10, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeRecords(t, sink, 25)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	total := 0
+	for _, batch := range rc.batches {
+		if len(batch) > 10 {
+			t.Errorf("batch of %d records, want at most 10", len(batch))
+		}
+		total += len(batch)
+	}
+	if total != 25 || len(rc.batches) != 3 {
+		t.Errorf("received %d records in %d batches, want 25 in 3", total, len(rc.batches))
+	}
+	for i, req := range rc.requests {
+		if req.Header.Get(SignatureHeader) != Sign([]byte("s3cret"), rc.bodies[i]) {
+			t.Errorf("request %d signature = %q", i, req.Header.Get(SignatureHeader))
+		}
+		if req.Header.Get("Content-Type") != "application/json" || req.Header.Get(DeliveryHeader) == "" {
+			t.Errorf("request %d headers = %v", i, req.Header)
+		}
+	}
+	if rc.batches[0][0].Host != "h" || rc.batches[0][0].Type != events.EventPrintMessage {
+		t.Errorf("record = %+v", rc.batches[0][0])
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestWebhookSink_FlushInterval(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookOptions{URL: server.URL, FlushInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sink.Close() }()
+	writeRecords(t, sink, 2)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		rc.mu.Lock()
+		received := len(rc.batches)
+		signed := received > 0 && rc.requests[0].Header.Get(SignatureHeader) != ""
+		rc.mu.Unlock()
+		if received > 0 {
+			if signed {
+				t.Error("request without secret is signed")
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("records weren't sent after the flush interval")
+}
+
+func TestWebhookSink_Retries(t *testing.T) {
+	rc := &receiver{status: func(attempt int) int {
+		if attempt < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookOptions{URL: server.URL, RetryDelay: time.Millisecond, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeRecords(t, sink, 3)
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(rc.requests) != 3 || len(rc.batches) != 1 || len(rc.batches[0]) != 3 {
+		t.Fatalf("%d requests, batches = %v", len(rc.requests), rc.batches)
+	}
+	if delivery := rc.requests[0].Header.Get(DeliveryHeader); rc.requests[2].Header.Get(DeliveryHeader) != delivery {
+		t.Error("retries have a different delivery ID")
+	}
+}
+
+func TestWebhookSink_Failures(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		requests int
+	}{
+		{"server errors are retried", http.StatusInternalServerError, 2},
+		{"client errors are not retried", http.StatusUnauthorized, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{status: func(int) int { return tt.status }}
+			server := httptest.NewServer(rc)
+			defer server.Close()
+
+			sink, err := NewWebhookSink(WebhookOptions{URL: server.URL, MaxAttempts: 2, RetryDelay: time.Millisecond, FlushInterval: time.Hour})
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeRecords(t, sink, 4)
+			err = sink.Close()
+			if err == nil || !strings.Contains(err.Error(), "4 events were not delivered") {
+				t.Errorf("Close() error = %v", err)
+			}
+			if len(rc.requests) != tt.requests {
+				t.Errorf("%d requests, want %d", len(rc.requests), tt.requests)
+			}
+		})
+	}
+
+	for _, url := range []string{"", "ftp://collector", "http://", "collector:8080"} {
+		if _, err := NewWebhookSink(WebhookOptions{URL: url}); err == nil {
+			t.Errorf("NewWebhookSink(%q) succeeded", url)
+		}
+	}
+}
+
+func TestWebhookSink_CloseTimeout(t *testing.T) {
+	// The receiver hangs: Close returns after the close timeout
+	hang := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { <-hang }))
+	defer hung.Close()
+	defer close(hang)
+
+	sink, err := NewWebhookSink(WebhookOptions{URL: hung.URL, CloseTimeout: 50 * time.Millisecond, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeRecords(t, sink, 3)
+	start := time.Now()
+	err = sink.Close()
+	if err == nil || !strings.Contains(err.Error(), "3 events were not delivered") {
+		t.Errorf("Close() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close() took %s, want about the close timeout", elapsed)
+	}
+}
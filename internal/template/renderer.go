@@ -23,15 +23,18 @@ type Renderer interface {
 
 // Pongo2Renderer implements Renderer using the pongo2 template engine.
 type Pongo2Renderer struct {
-	// Mutex to protect concurrent access to pongo2.FromString
+	// Mutex to protect concurrent access to set.FromString
 	// The pongo2 TemplateSet is not thread-safe
 	mu sync.Mutex
+
+	// Own template set, so renderers can be used concurrently with each other
+	set *pongo2.TemplateSet
 }
 
 // NewPongo2Renderer creates a new Pongo2Renderer with filters registered.
 // Returns an error if filter registration fails (e.g., filter name already registered).
 func NewPongo2Renderer() (Renderer, error) {
-	r := &Pongo2Renderer{}
+	r := &Pongo2Renderer{set: pongo2.NewSet("renderer", pongo2.DefaultLoader)}
 
 	// Register custom filters once globally
 	once.Do(func() {
@@ -84,10 +87,13 @@ func (r *Pongo2Renderer) Render(template string, variables map[string]interface{
 		variables = make(map[string]interface{})
 	}
 
-	// Lock to prevent race condition in pongo2.FromString
+	// Lock to prevent race condition in set.FromString
 	// The pongo2 TemplateSet is not thread-safe for concurrent FromString calls
 	r.mu.Lock()
-	pongoTemplate, err := pongo2.FromString(template)
+	if r.set == nil {
+		r.set = pongo2.NewSet("renderer", pongo2.DefaultLoader)
+	}
+	pongoTemplate, err := r.set.FromString(template)
 	r.mu.Unlock()
 
 	if err != nil {
@@ -0,0 +1,47 @@
+package template
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// expressionRe matches template expressions and tags, which may span lines.
+	expressionRe = regexp.MustCompile(`(?s)\{\{.*?\}\}|\{%.*?%\}`)
+
+	// identifierRe matches names inside expressions.
+	identifierRe = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+	// stringLiteralRe matches string literals inside expressions.
+	stringLiteralRe = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+)
+
+// keywords are names in expressions that aren't variables.
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "in": true, "is": true, "if": true,
+	"elif": true, "else": true, "endif": true, "for": true, "endfor": true,
+	"true": true, "false": true, "none": true, "True": true, "False": true, "None": true,
+}
+
+// Expressions returns the template expressions and tags in text.
+func Expressions(text string) []string {
+	return expressionRe.FindAllString(text, -1)
+}
+
+// Variables returns the variable names an expression reads, in order of
+// appearance. String literals, attributes, filters and keywords aren't variables.
+func Variables(expr string) []string {
+	expr = stringLiteralRe.ReplaceAllString(expr, `""`)
+
+	var names []string
+	for _, loc := range identifierRe.FindAllStringIndex(expr, -1) {
+		before := strings.TrimRight(expr[:loc[0]], " \t")
+		if strings.HasSuffix(before, ".") || strings.HasSuffix(before, "|") {
+			continue
+		}
+		if name := expr[loc[0]:loc[1]]; !keywords[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
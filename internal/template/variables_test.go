@@ -0,0 +1,38 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariables(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want []string
+	}{
+		{"simple", "{{ name }}", []string{"name"}},
+		{"attribute", "{{ result.stdout }}", []string{"result"}},
+		{"filter", "{{ name | upper }}", []string{"name"}},
+		{"filter argument", "{{ name | default(fallback) }}", []string{"name", "fallback"}},
+		{"string literal", `{{ os == "linux" and 'arm64' in arch }}`, []string{"os", "arch"}},
+		{"keywords", "{% if enabled and not none %}", []string{"enabled"}},
+		{"raw expression", "rc != 0 or failed", []string{"rc", "failed"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Variables(tt.expr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Variables(%q) = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	got := Expressions("a {{ x }} b {% if y %}\n{{ z\n }}")
+	want := []string{"{{ x }}", "{% if y %}", "{{ z\n }}"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expressions() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,310 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/batch"
+	"github.com/alehatsman/mooncake/internal/version"
+)
+
+// Exporter defaults.
+const (
+	defaultServiceName   = "mooncake"
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+	defaultMaxAttempts   = 4
+	defaultRetryDelay    = 500 * time.Millisecond
+	defaultExportTimeout = 10 * time.Second
+	defaultCloseTimeout  = 30 * time.Second
+
+	// maxQueuedSpans bounds the spans kept while the collector is down; newer
+	// spans are dropped.
+	maxQueuedSpans = 100 * defaultBatchSize
+)
+
+// scopeName is the instrumentation scope of the spans.
+const scopeName = "github.com/alehatsman/mooncake"
+
+// ExporterOptions configures an Exporter.
+type ExporterOptions struct {
+	// Endpoint receives the spans as OTLP/HTTP JSON requests, e.g.
+	// "http://localhost:4318/v1/traces".
+	Endpoint string
+
+	// Headers are added to the requests, e.g. for authentication.
+	Headers map[string]string
+
+	// ServiceName is the service.name of the spans (default: "mooncake").
+	ServiceName string
+
+	// BatchSize is the maximum number of spans per request (default: 512).
+	BatchSize int
+
+	// FlushInterval is the maximum time a span waits for its batch to fill up
+	// (default: 5s).
+	FlushInterval time.Duration
+
+	// MaxAttempts is the number of attempts to export a batch, retrying after
+	// network errors, 429, 502, 503 and 504 responses (default: 4).
+	MaxAttempts int
+
+	// RetryDelay is the delay before the first retry, doubled for each later
+	// retry (default: 500ms).
+	RetryDelay time.Duration
+
+	// CloseTimeout bounds the time Close spends exporting the queued spans;
+	// spans still queued then are dropped (default: 30s).
+	CloseTimeout time.Duration
+
+	// Client sends the requests (default: a client with a 10s timeout).
+	Client *http.Client
+}
+
+// Exporter sends finished spans to an OTLP/HTTP collector in batches, from a
+// background goroutine. It is safe for concurrent use, so the runs of several
+// hosts can share it.
+type Exporter struct {
+	opts   ExporterOptions
+	sender *batch.Sender[*span]
+}
+
+// NewExporter returns an exporter sending to opts.Endpoint, and starts its
+// sender.
+func NewExporter(opts ExporterOptions) (*Exporter, error) {
+	parsed, err := url.Parse(opts.Endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: must be an http or https URL", opts.Endpoint)
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = defaultServiceName
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = defaultRetryDelay
+	}
+	if opts.CloseTimeout <= 0 {
+		opts.CloseTimeout = defaultCloseTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: defaultExportTimeout}
+	}
+
+	e := &Exporter{opts: opts}
+	e.sender = batch.New(batch.Options[*span]{
+		URL:           opts.Endpoint,
+		Name:          "OTLP endpoint",
+		BatchSize:     opts.BatchSize,
+		FlushInterval: opts.FlushInterval,
+		MaxQueued:     maxQueuedSpans,
+		MaxAttempts:   opts.MaxAttempts,
+		RetryDelay:    opts.RetryDelay,
+		CloseTimeout:  opts.CloseTimeout,
+		Client:        opts.Client,
+		Encode:        e.encode,
+		Retry: func(status int) bool {
+			switch status {
+			case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				return true
+			}
+			return false
+		},
+	})
+	return e, nil
+}
+
+// export queues a finished span for the next batch.
+func (e *Exporter) export(s *span) {
+	_ = e.sender.Add(s) // Counted as dropped, reported by Close
+}
+
+// Close exports the queued spans within the close timeout, then reports the
+// spans that couldn't be exported.
+func (e *Exporter) Close() error {
+	if dropped, err := e.sender.Close(); dropped > 0 {
+		return fmt.Errorf("OTLP endpoint %s: %d spans were not exported: %w", e.opts.Endpoint, dropped, err)
+	}
+	return nil
+}
+
+// encode returns the body of a batch and the configured headers.
+func (e *Exporter) encode(spans []*span) ([]byte, http.Header, error) {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	for name, value := range e.opts.Headers {
+		header.Set(name, value)
+	}
+	return body, header, nil
+}
+
+// request returns the OTLP export request of spans, grouped by host: the
+// host.name of their resource.
+func (e *Exporter) request(spans []*span) exportRequest {
+	byHost := make(map[string][]otlpSpan)
+	for _, s := range spans {
+		byHost[s.host] = append(byHost[s.host], s.otlp())
+	}
+	hosts := make([]string, 0, len(byHost))
+	for host := range byHost {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var req exportRequest
+	for _, host := range hosts {
+		req.ResourceSpans = append(req.ResourceSpans, resourceSpans{
+			Resource: resource{Attributes: []keyValue{
+				stringAttr("service.name", e.opts.ServiceName),
+				stringAttr("service.version", version.Version),
+				stringAttr("host.name", host),
+			}},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: scopeName, Version: version.Version},
+				Spans: byHost[host],
+			}},
+		})
+	}
+	return req
+}
+
+// OTLP/HTTP JSON encoding of ExportTraceServiceRequest. Trace and span IDs are
+// hex strings and 64-bit integers decimal strings.
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	TraceState        string      `json:"traceState,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []keyValue  `json:"attributes,omitempty"`
+	Events            []otlpEvent `json:"events,omitempty"`
+	Status            otlpStatus  `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string     `json:"stringValue,omitempty"`
+	BoolValue   *bool       `json:"boolValue,omitempty"`
+	IntValue    string      `json:"intValue,omitempty"`
+	ArrayValue  *arrayValue `json:"arrayValue,omitempty"`
+}
+
+type arrayValue struct {
+	Values []anyValue `json:"values"`
+}
+
+// Span kinds and status codes of OTLP.
+const (
+	spanKindInternal = 1
+
+	statusOK    = 1
+	statusError = 2
+)
+
+func stringAttr(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &value}}
+}
+
+func boolAttr(key string, value bool) keyValue {
+	return keyValue{Key: key, Value: anyValue{BoolValue: &value}}
+}
+
+func intAttr(key string, value int64) keyValue {
+	return keyValue{Key: key, Value: anyValue{IntValue: strconv.FormatInt(value, 10)}}
+}
+
+func stringsAttr(key string, values []string) keyValue {
+	array := &arrayValue{Values: make([]anyValue, len(values))}
+	for i := range values {
+		array.Values[i] = anyValue{StringValue: &values[i]}
+	}
+	return keyValue{Key: key, Value: anyValue{ArrayValue: array}}
+}
+
+// unixNano encodes a time as OTLP does.
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlp returns the OTLP encoding of a finished span.
+func (s *span) otlp() otlpSpan {
+	encoded := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		TraceState:        s.traceState,
+		Name:              s.name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: unixNano(s.start),
+		EndTimeUnixNano:   unixNano(s.end),
+		Attributes:        s.attributes,
+		Status:            otlpStatus{Code: s.statusCode, Message: s.statusMessage},
+	}
+	if s.parentID.IsValid() {
+		encoded.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	for _, event := range s.events {
+		encoded.Events = append(encoded.Events, otlpEvent{
+			TimeUnixNano: unixNano(event.time),
+			Name:         event.name,
+			Attributes:   event.attributes,
+		})
+	}
+	return encoded
+}
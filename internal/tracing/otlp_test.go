@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSpan(name, host string) *span {
+	now := time.Now()
+	return &span{host: host, traceID: newTraceID(), spanID: newSpanID(), name: name, start: now, end: now}
+}
+
+func TestNewExporter(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:4318", "ftp://collector/v1/traces", "http://"} {
+		if _, err := NewExporter(ExporterOptions{Endpoint: endpoint}); err == nil {
+			t.Errorf("NewExporter(%q) succeeded", endpoint)
+		}
+	}
+	if got := TracesEndpoint("http://localhost:4318/"); got != "http://localhost:4318/v1/traces" {
+		t.Errorf("TracesEndpoint() = %q", got)
+	}
+}
+
+func TestExporter_Batches(t *testing.T) {
+	c := newCollector(t)
+	exporter, err := NewExporter(ExporterOptions{Endpoint: TracesEndpoint(c.URL), BatchSize: 2, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter.export(testSpan("a", "web1"))
+	exporter.export(testSpan("b", "web2"))
+	exporter.export(testSpan("c", "web1"))
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.requests) != 2 {
+		t.Fatalf("requests = %d, want 2 batches", len(c.requests))
+	}
+	// Spans are grouped by host, the resource of their batch
+	if first := c.requests[0].ResourceSpans; len(first) != 2 || *attr(first[0].Resource.Attributes, "host.name").StringValue != "web1" {
+		t.Errorf("first batch = %+v", first)
+	}
+	if service := attr(c.requests[0].ResourceSpans[0].Resource.Attributes, "service.name"); *service.StringValue != "mooncake" {
+		t.Errorf("service.name = %s", *service.StringValue)
+	}
+}
+
+func TestExporter_FlushInterval(t *testing.T) {
+	c := newCollector(t)
+	exporter, err := NewExporter(ExporterOptions{Endpoint: TracesEndpoint(c.URL), FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = exporter.Close() }()
+	exporter.export(testSpan("a", "web1"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.spans()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("span wasn't exported after the flush interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestExporter_Retries(t *testing.T) {
+	c := newCollector(t)
+	c.status = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	exporter := newTestExporter(t, c)
+	exporter.export(testSpan("a", "web1"))
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, ok := c.spans()["a"]; !ok {
+		t.Error("span wasn't exported after retries")
+	}
+}
+
+func TestExporter_Failures(t *testing.T) {
+	c := newCollector(t)
+	c.status = []int{http.StatusBadRequest}
+	exporter := newTestExporter(t, c)
+	exporter.export(testSpan("a", "web1"))
+	err := exporter.Close()
+	if err == nil || !strings.Contains(err.Error(), "1 spans were not exported") || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Close() error = %v", err)
+	}
+
+	// The collector is down: retries are exhausted
+	c.status = []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}
+	exporter = newTestExporter(t, c)
+	exporter.export(testSpan("b", "web1"))
+	if err := exporter.Close(); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("Close() error = %v", err)
+	}
+}
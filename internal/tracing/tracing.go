@@ -0,0 +1,384 @@
+// Package tracing exports runs as OpenTelemetry traces over OTLP/HTTP. A run is
+// a root span and each step a child span of the run, or of the block or preset
+// step it is nested in. Retries, assertions and rescued blocks are span events.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// TraceparentEnvVar holds the W3C trace context a run joins, as set by CI
+// systems and other tracing-aware parents.
+const TraceparentEnvVar = "TRACEPARENT"
+
+// TracestateEnvVar holds the W3C trace state propagated with TRACEPARENT.
+const TracestateEnvVar = "TRACESTATE"
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// IsValid reports whether the ID is not all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// String returns the ID as lowercase hex.
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span of a trace.
+type SpanID [8]byte
+
+// IsValid reports whether the ID is not all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// String returns the ID as lowercase hex.
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext identifies the span that parents the spans of a run.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Sampled    bool   // The parent records its trace; unsampled runs aren't exported
+	TraceState string // Vendor-specific trace state, propagated as is
+}
+
+// IsValid reports whether the context has a trace and a span ID.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// ParseTraceparent parses a W3C traceparent header value:
+// "00-<trace-id>-<parent-id>-<flags>".
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: want 00-<trace-id>-<parent-id>-<flags>", value)
+	}
+	var sc SpanContext
+	var flags [1]byte
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  []byte
+	}{
+		{"version", parts[0], make([]byte, 1)},
+		{"trace ID", parts[1], sc.TraceID[:]},
+		{"parent ID", parts[2], sc.SpanID[:]},
+		{"flags", parts[3], flags[:]},
+	} {
+		if len(field.value) != 2*len(field.dest) || strings.ToLower(field.value) != field.value {
+			return SpanContext{}, fmt.Errorf("invalid traceparent %q: malformed %s", value, field.name)
+		}
+		if _, err := hex.Decode(field.dest, []byte(field.value)); err != nil {
+			return SpanContext{}, fmt.Errorf("invalid traceparent %q: malformed %s", value, field.name)
+		}
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q: all-zero trace or parent ID", value)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// span is a span being recorded.
+type span struct {
+	host       string
+	traceID    TraceID
+	spanID     SpanID
+	parentID   SpanID
+	traceState string
+
+	name          string
+	start, end    time.Time
+	attributes    []keyValue
+	events        []spanEvent
+	statusCode    int
+	statusMessage string
+
+	// Step spans
+	stepID string
+	level  int
+	action string
+}
+
+// spanEvent is an event in the life of a span.
+type spanEvent struct {
+	time       time.Time
+	name       string
+	attributes []keyValue
+}
+
+// Options configures a Subscriber.
+type Options struct {
+	// Host is the host.name of the spans: the host the run applies the config
+	// to.
+	Host string
+
+	// Parent is the span the run joins, from TRACEPARENT. Without it, the run
+	// starts a new trace.
+	Parent SpanContext
+}
+
+// Subscriber records the spans of a run from its events, and exports them as
+// they finish.
+type Subscriber struct {
+	exporter *Exporter
+	opts     Options
+
+	mu    sync.Mutex
+	run   *span
+	steps []*span // Open step spans, oldest first
+}
+
+// NewSubscriber returns a subscriber recording the spans of a run on
+// opts.Host to exporter.
+func NewSubscriber(exporter *Exporter, opts Options) *Subscriber {
+	return &Subscriber{exporter: exporter, opts: opts}
+}
+
+// OnEvent implements events.Subscriber.
+func (s *Subscriber) OnEvent(event events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// An unsampled parent doesn't record its trace, so neither does the run
+	if s.opts.Parent.IsValid() && !s.opts.Parent.Sampled {
+		return
+	}
+	now := event.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if data, ok := event.Data.(events.RunStartedData); ok {
+		s.startRun(now, data)
+		return
+	}
+	if s.run == nil {
+		return
+	}
+
+	switch data := event.Data.(type) {
+	case events.StepStartedData:
+		s.startStep(now, data)
+	case events.StepCompletedData:
+		if step := s.endStep(now, data.StepID); step != nil {
+			step.attributes = append(step.attributes, boolAttr("mooncake.step.changed", data.Changed))
+			step.statusCode = statusOK
+			s.exporter.export(step)
+		}
+	case events.StepFailedData:
+		if step := s.endStep(now, data.StepID); step != nil {
+			step.attributes = append(step.attributes, boolAttr("mooncake.step.ignored", data.Ignored))
+			if data.Reason != "" {
+				step.attributes = append(step.attributes, stringAttr("mooncake.step.failure_reason", data.Reason))
+			}
+			step.statusCode, step.statusMessage = statusError, data.ErrorMessage
+			s.exporter.export(step)
+		}
+	case events.StepSkippedData:
+		// Skipped steps don't start: record them as instant spans
+		step := s.newStep(now, data.StepID, data.Name, data.Level, "")
+		step.end = now
+		step.attributes = append(step.attributes,
+			boolAttr("mooncake.step.skipped", true),
+			stringAttr("mooncake.step.skip_reason", data.Reason))
+		s.exporter.export(step)
+	case events.StepRetryData:
+		s.addEvent(data.StepID, spanEvent{time: now, name: "retry", attributes: []keyValue{
+			intAttr("mooncake.retry.attempt", int64(data.Attempt)),
+			intAttr("mooncake.retry.max_attempts", int64(data.MaxAttempts)),
+			intAttr("mooncake.retry.delay_ms", data.DelayMs),
+			stringAttr("mooncake.retry.error", data.ErrorMessage),
+		}})
+	case events.AssertionData:
+		s.addEvent(data.StepID, spanEvent{time: now, name: string(event.Type), attributes: []keyValue{
+			stringAttr("mooncake.assert.type", data.Type),
+			stringAttr("mooncake.assert.expected", data.Expected),
+			stringAttr("mooncake.assert.actual", data.Actual),
+			boolAttr("mooncake.assert.failed", data.Failed),
+		}})
+	case events.BlockRescuedData:
+		s.addEvent(data.StepID, spanEvent{time: now, name: string(event.Type), attributes: []keyValue{
+			stringAttr("mooncake.rescue.failed_step_id", data.FailedStepID),
+			stringAttr("mooncake.rescue.failed_step_name", data.FailedStepName),
+			stringAttr("mooncake.rescue.error", data.ErrorMessage),
+		}})
+	case events.RunCompletedData:
+		s.endRun(now, data)
+	}
+}
+
+// Close implements events.Subscriber. The exporter is not closed, as it may
+// be shared with other runs: its owner closes it.
+func (s *Subscriber) Close() {}
+
+// startRun starts the root span of the run.
+func (s *Subscriber) startRun(now time.Time, data events.RunStartedData) {
+	run := &span{
+		host:       s.opts.Host,
+		traceID:    s.opts.Parent.TraceID,
+		parentID:   s.opts.Parent.SpanID,
+		traceState: s.opts.Parent.TraceState,
+		spanID:     newSpanID(),
+		name:       "mooncake run",
+		start:      now,
+		attributes: []keyValue{
+			stringAttr("mooncake.config.file", data.RootFile),
+			boolAttr("mooncake.dry_run", data.DryRun),
+			intAttr("mooncake.run.total_steps", int64(data.TotalSteps)),
+		},
+	}
+	if !run.traceID.IsValid() {
+		run.traceID = newTraceID()
+	}
+	if data.RunID != "" {
+		run.attributes = append(run.attributes, stringAttr("mooncake.run.id", data.RunID))
+	}
+	if len(data.Tags) > 0 {
+		run.attributes = append(run.attributes, stringsAttr("mooncake.run.tags", data.Tags))
+	}
+	s.run, s.steps = run, nil
+}
+
+// endRun ends the root span of the run, and the steps still open, which were
+// interrupted.
+func (s *Subscriber) endRun(now time.Time, data events.RunCompletedData) {
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		step := s.steps[i]
+		step.end = now
+		step.statusCode, step.statusMessage = statusError, "step did not complete"
+		s.exporter.export(step)
+	}
+	s.steps = nil
+
+	run := s.run
+	run.end = now
+	run.attributes = append(run.attributes,
+		intAttr("mooncake.run.success_steps", int64(data.SuccessSteps)),
+		intAttr("mooncake.run.failed_steps", int64(data.FailedSteps)),
+		intAttr("mooncake.run.skipped_steps", int64(data.SkippedSteps)),
+		intAttr("mooncake.run.changed_steps", int64(data.ChangedSteps)))
+	if data.Success {
+		run.statusCode = statusOK
+	} else {
+		run.statusCode, run.statusMessage = statusError, data.ErrorMessage
+	}
+	s.exporter.export(run)
+	s.run = nil
+}
+
+// startStep starts the span of a step, under its parent.
+func (s *Subscriber) startStep(now time.Time, data events.StepStartedData) {
+	step := s.newStep(now, data.StepID, data.Name, data.Level, data.Action)
+	if len(data.Tags) > 0 {
+		step.attributes = append(step.attributes, stringsAttr("mooncake.step.tags", data.Tags))
+	}
+	if data.Origin != "" {
+		step.attributes = append(step.attributes, stringAttr("mooncake.step.origin", data.Origin))
+		if i := strings.LastIndex(data.Origin, ":"); i > 0 {
+			if line, err := strconv.Atoi(data.Origin[i+1:]); err == nil {
+				step.attributes = append(step.attributes,
+					stringAttr("code.filepath", data.Origin[:i]),
+					intAttr("code.lineno", int64(line)))
+			}
+		}
+	}
+	s.steps = append(s.steps, step)
+}
+
+// newStep returns the span of a step, child of the step it is nested in or of
+// the run.
+func (s *Subscriber) newStep(now time.Time, stepID, name string, level int, action string) *span {
+	if name == "" {
+		name = action
+	}
+	if name == "" {
+		name = stepID
+	}
+	step := &span{
+		host:       s.opts.Host,
+		traceID:    s.run.traceID,
+		spanID:     newSpanID(),
+		parentID:   s.parent(level).spanID,
+		traceState: s.run.traceState,
+		name:       name,
+		start:      now,
+		stepID:     stepID,
+		level:      level,
+		action:     action,
+		attributes: []keyValue{
+			stringAttr("mooncake.step.id", stepID),
+			intAttr("mooncake.step.level", int64(level)),
+		},
+	}
+	if action != "" {
+		step.attributes = append(step.attributes, stringAttr("mooncake.step.action", action))
+	}
+	return step
+}
+
+// parent returns the span a step of level is nested in: the latest open step of
+// a lower level, as steps of blocks are one level deeper than their block, or
+// the latest open preset step, whose steps have its level. Steps at the top
+// are children of the run.
+func (s *Subscriber) parent(level int) *span {
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if step.level < level || (step.level == level && step.action == "preset") {
+			return step
+		}
+	}
+	return s.run
+}
+
+// endStep removes the latest open span of a step, and returns it ended, or nil
+// if it isn't open.
+func (s *Subscriber) endStep(now time.Time, stepID string) *span {
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		if step := s.steps[i]; step.stepID == stepID {
+			s.steps = append(s.steps[:i], s.steps[i+1:]...)
+			step.end = now
+			return step
+		}
+	}
+	return nil
+}
+
+// addEvent adds an event to the latest open span of a step, the latest open
+// step if stepID is empty, or the run.
+func (s *Subscriber) addEvent(stepID string, event spanEvent) {
+	target := s.run
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		if stepID == "" || s.steps[i].stepID == stepID {
+			target = s.steps[i]
+			break
+		}
+	}
+	target.events = append(target.events, event)
+}
+
+// newTraceID returns a random trace ID.
+func newTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// TracesEndpoint returns the OTLP/HTTP traces URL of a collector base URL, as
+// OTEL_EXPORTER_OTLP_ENDPOINT: "http://localhost:4318" posts to
+// "http://localhost:4318/v1/traces".
+func TracesEndpoint(base string) string {
+	return strings.TrimSuffix(base, "/") + "/v1/traces"
+}
@@ -0,0 +1,244 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alehatsman/mooncake/internal/events"
+)
+
+// collector is a stand-in OTLP/HTTP collector, recording the spans it
+// receives.
+type collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []exportRequest
+	headers  []http.Header
+	status   []int // Status of the next responses, then 200
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if len(c.status) > 0 {
+			status := c.status[0]
+			c.status = c.status[1:]
+			w.WriteHeader(status)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req exportRequest
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(body, &req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.requests = append(c.requests, req)
+		c.headers = append(c.headers, r.Header)
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// spans returns the spans received, by name, with the host.name of their
+// resource.
+func (c *collector) spans() map[string]otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]otlpSpan)
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					spans[s.Name] = s
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func newTestExporter(t *testing.T, c *collector) *Exporter {
+	t.Helper()
+	exporter, err := NewExporter(ExporterOptions{
+		Endpoint:   TracesEndpoint(c.URL + "/"),
+		Headers:    map[string]string{"Authorization": "Bearer t"},
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exporter
+}
+
+// attr returns the value of an attribute of a span, or nil.
+func attr(attributes []keyValue, key string) *anyValue {
+	for _, kv := range attributes {
+		if kv.Key == key {
+			return &kv.Value
+		}
+	}
+	return nil
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("ParseTraceparent() = %+v", sc)
+	}
+	if sc, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"); err != nil || sc.Sampled {
+		t.Errorf("unsampled traceparent = %+v, %v", sc, err)
+	}
+	// Later versions may add fields
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); err != nil {
+		t.Errorf("traceparent of a later version error = %v", err)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902zz-01",
+	} {
+		if _, err := ParseTraceparent(invalid); err == nil {
+			t.Errorf("ParseTraceparent(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	c := newCollector(t)
+	exporter := newTestExporter(t, c)
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.TraceState = "vendor=1"
+	subscriber := NewSubscriber(exporter, Options{Host: "web1", Parent: parent})
+
+	start := time.Unix(1700000000, 0)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	for _, event := range []events.Event{
+		{Type: events.EventRunStarted, Timestamp: at(0), Data: events.RunStartedData{RunID: "r1", RootFile: "/cfg/main.yml", TotalSteps: 4}},
+		{Type: events.EventStepStarted, Timestamp: at(1), Data: events.StepStartedData{StepID: "step-1", Name: "install", Level: 0, Action: "preset", Origin: "/cfg/main.yml:3"}},
+		{Type: events.EventStepStarted, Timestamp: at(2), Data: events.StepStartedData{StepID: "step-2", Name: "group", Level: 0, Action: "block"}},
+		{Type: events.EventStepStarted, Timestamp: at(3), Data: events.StepStartedData{StepID: "step-3", Name: "fetch", Level: 1, Action: "shell"}},
+		{Type: events.EventStepRetry, Timestamp: at(4), Data: events.StepRetryData{StepID: "step-3", Attempt: 2, MaxAttempts: 3, ErrorMessage: "exit 1"}},
+		{Type: events.EventStepCompleted, Timestamp: at(5), Data: events.StepCompletedData{StepID: "step-3", Changed: true}},
+		{Type: events.EventStepSkipped, Timestamp: at(5), Data: events.StepSkippedData{StepID: "step-4", Name: "skipped", Level: 1, Reason: "when"}},
+		{Type: events.EventAssertFailed, Timestamp: at(6), Data: events.AssertionData{Type: "file", Failed: true}},
+		{Type: events.EventStepFailed, Timestamp: at(6), Data: events.StepFailedData{StepID: "step-2", ErrorMessage: "assertion failed"}},
+		{Type: events.EventRunCompleted, Timestamp: at(7), Data: events.RunCompletedData{Success: false, ErrorMessage: "1 step failed"}},
+	} {
+		subscriber.OnEvent(event)
+	}
+	if err := exporter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	spans := c.spans()
+	run, preset, block, step, skipped := spans["mooncake run"], spans["install"], spans["group"], spans["fetch"], spans["skipped"]
+	if len(spans) != 5 {
+		t.Fatalf("spans = %v, want 5", spans)
+	}
+	for _, s := range spans {
+		if s.TraceID != parent.TraceID.String() || s.TraceState != "vendor=1" {
+			t.Errorf("span %s is in trace %s (%q), want the trace of the parent", s.Name, s.TraceID, s.TraceState)
+		}
+	}
+	if run.ParentSpanID != parent.SpanID.String() || run.Status.Code != statusError || run.Status.Message != "1 step failed" {
+		t.Errorf("run span = %+v", run)
+	}
+	if run.StartTimeUnixNano != "1700000000000000000" || run.EndTimeUnixNano != "1700000007000000000" {
+		t.Errorf("run span times = %s, %s", run.StartTimeUnixNano, run.EndTimeUnixNano)
+	}
+	if id := attr(run.Attributes, "mooncake.run.id"); id == nil || *id.StringValue != "r1" {
+		t.Errorf("run span attributes = %+v", run.Attributes)
+	}
+
+	// Preset steps have the level of the preset, block steps are one level deeper
+	if preset.ParentSpanID != run.SpanID || block.ParentSpanID != preset.SpanID || step.ParentSpanID != block.SpanID || skipped.ParentSpanID != block.SpanID {
+		t.Errorf("parents: preset %s (run %s), block %s (preset %s), step %s, skipped %s (block %s)",
+			preset.ParentSpanID, run.SpanID, block.ParentSpanID, preset.SpanID, step.ParentSpanID, skipped.ParentSpanID, block.SpanID)
+	}
+	if origin := attr(preset.Attributes, "code.filepath"); origin == nil || *origin.StringValue != "/cfg/main.yml" {
+		t.Errorf("preset span attributes = %+v", preset.Attributes)
+	}
+	if line := attr(preset.Attributes, "code.lineno"); line == nil || line.IntValue != "3" {
+		t.Errorf("preset span attributes = %+v", preset.Attributes)
+	}
+	if preset.Status.Code != statusError || preset.Status.Message != "step did not complete" {
+		t.Errorf("unfinished preset span status = %+v", preset.Status)
+	}
+
+	if action := attr(step.Attributes, "mooncake.step.action"); action == nil || *action.StringValue != "shell" {
+		t.Errorf("step span attributes = %+v", step.Attributes)
+	}
+	if changed := attr(step.Attributes, "mooncake.step.changed"); changed == nil || !*changed.BoolValue || step.Status.Code != statusOK {
+		t.Errorf("step span = %+v", step)
+	}
+	if len(step.Events) != 1 || step.Events[0].Name != "retry" || attr(step.Events[0].Attributes, "mooncake.retry.attempt").IntValue != "2" {
+		t.Errorf("step span events = %+v", step.Events)
+	}
+	if skipped.StartTimeUnixNano != skipped.EndTimeUnixNano || attr(skipped.Attributes, "mooncake.step.skipped") == nil {
+		t.Errorf("skipped span = %+v", skipped)
+	}
+	// Assertions without step ID go to the latest open step
+	if len(block.Events) != 1 || block.Events[0].Name != "assert.failed" || block.Status.Code != statusError {
+		t.Errorf("block span = %+v", block)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resource := c.requests[0].ResourceSpans[0].Resource
+	if host := attr(resource.Attributes, "host.name"); host == nil || *host.StringValue != "web1" {
+		t.Errorf("resource attributes = %+v", resource.Attributes)
+	}
+	if c.headers[0].Get("Authorization") != "Bearer t" {
+		t.Errorf("request headers = %v", c.headers[0])
+	}
+}
+
+func TestSubscriber_NewTrace(t *testing.T) {
+	c := newCollector(t)
+	exporter := newTestExporter(t, c)
+	subscriber := NewSubscriber(exporter, Options{Host: "here"})
+	subscriber.OnEvent(events.Event{Type: events.EventStepStarted, Data: events.StepStartedData{StepID: "before-run"}})
+	subscriber.OnEvent(events.Event{Type: events.EventRunStarted, Data: events.RunStartedData{}})
+	subscriber.OnEvent(events.Event{Type: events.EventRunCompleted, Data: events.RunCompletedData{Success: true}})
+
+	// An unsampled parent isn't exported
+	parent, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	unsampled := NewSubscriber(exporter, Options{Host: "here", Parent: parent})
+	unsampled.OnEvent(events.Event{Type: events.EventRunStarted, Data: events.RunStartedData{}})
+	unsampled.OnEvent(events.Event{Type: events.EventRunCompleted, Data: events.RunCompletedData{Success: true}})
+
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	spans := c.spans()
+	run, ok := spans["mooncake run"]
+	if len(spans) != 1 || !ok {
+		t.Fatalf("spans = %+v, want the run", spans)
+	}
+	if run.ParentSpanID != "" || run.TraceID == "" || run.TraceID == parent.TraceID.String() || run.Status.Code != statusOK {
+		t.Errorf("run span = %+v", run)
+	}
+}
@@ -0,0 +1,370 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxSymlinks is the number of symlinks followed when resolving a path, like the
+// limit of the Linux kernel.
+const maxSymlinks = 40
+
+// chrootDirScript changes to the directory in $0 and runs the command in "$@".
+const chrootDirScript = `cd "$0" && exec "$@"`
+
+// Chroot applies changes to a directory of this host as if it were the root of the
+// file system, such as the root file system of a VM or container image.
+//
+// Paths are resolved under the root: absolute symlinks point into the root and ".."
+// stops at it, so no path escapes the root. Commands run with chroot(8), which
+// needs root privileges. The tree must not be changed by untrusted processes during
+// the run, as paths are resolved before each access.
+type Chroot struct {
+	// Root is the absolute path of the root directory, without symlinks.
+	Root string
+}
+
+// NewChroot returns the transport of a root directory.
+func NewChroot(root string) (*Chroot, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	return &Chroot{Root: resolved}, nil
+}
+
+// Command returns a command running in the root with chroot(8). Its environment
+// is the environment of this process with cmd.Env added.
+func (c *Chroot) Command(ctx context.Context, cmd Cmd) *exec.Cmd {
+	args := []string{c.Root}
+	if cmd.Dir != "" {
+		args = append(args, "sh", "-c", chrootDirScript, cmd.Dir)
+	}
+	args = append(args, cmd.Name)
+	args = append(args, cmd.Args...)
+
+	// #nosec G204 -- This is a provisioning tool designed to execute commands
+	command := exec.CommandContext(ctx, "chroot", args...)
+	if len(cmd.Env) > 0 {
+		command.Env = append(os.Environ(), cmd.Env...)
+	}
+	setProcessGroup(command)
+	return command
+}
+
+// LookPath searches for an executable in the directories of the PATH of this
+// process under the root, and returns its path in the root.
+func (c *Chroot) LookPath(file string) (string, error) {
+	if strings.Contains(file, "/") {
+		if c.isExecutable(file) {
+			return file, nil
+		}
+		return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+	}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if !path.IsAbs(dir) {
+			continue
+		}
+		candidate := path.Join(dir, file)
+		if c.isExecutable(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// isExecutable reports whether a path of the root is an executable file.
+func (c *Chroot) isExecutable(name string) bool {
+	info, err := c.Stat(name)
+	return err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0
+}
+
+// ReadFile reads a file.
+func (c *Chroot) ReadFile(name string) ([]byte, error) {
+	hostPath, err := c.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G304 -- File path from user config is intentional
+	return os.ReadFile(hostPath)
+}
+
+// WriteFile writes a file, creating it with perm if needed.
+func (c *Chroot) WriteFile(name string, data []byte, perm os.FileMode) error {
+	hostPath, err := c.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	// #nosec G306 -- Mode is user-configurable for provisioning
+	return os.WriteFile(hostPath, data, perm)
+}
+
+// TempFile creates an empty temporary file in /tmp of the root, creating /tmp if needed.
+func (c *Chroot) TempFile() (string, error) {
+	tmpDir, err := c.resolve("/tmp", true)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(tmpDir); os.IsNotExist(err) {
+		if err := os.Mkdir(tmpDir, 0755); err != nil {
+			return "", err
+		}
+		if err := os.Chmod(tmpDir, os.ModeSticky|0777); err != nil {
+			return "", err
+		}
+	}
+	tmpFile, err := os.CreateTemp(tmpDir, "mooncake-*")
+	if err != nil {
+		return "", err
+	}
+	if err := tmpFile.Close(); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return path.Join("/tmp", filepath.Base(tmpFile.Name())), nil
+}
+
+// Stat returns the file info of a path, following symlinks.
+func (c *Chroot) Stat(name string) (os.FileInfo, error) {
+	hostPath, err := c.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(hostPath)
+}
+
+// Lstat returns the file info of a path without following symlinks.
+func (c *Chroot) Lstat(name string) (os.FileInfo, error) {
+	hostPath, err := c.resolve(name, false)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(hostPath)
+}
+
+// Readlink returns the target of a symlink, as stored in the link.
+func (c *Chroot) Readlink(name string) (string, error) {
+	hostPath, err := c.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(hostPath)
+}
+
+// MkdirAll creates a directory and its parents.
+func (c *Chroot) MkdirAll(name string, perm os.FileMode) error {
+	hostPath, err := c.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(hostPath, perm)
+}
+
+// Remove removes a file or an empty directory.
+func (c *Chroot) Remove(name string) error {
+	hostPath, err := c.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	if hostPath == c.Root {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	}
+	return os.Remove(hostPath)
+}
+
+// RemoveAll removes a path and everything below it.
+func (c *Chroot) RemoveAll(name string) error {
+	hostPath, err := c.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	if hostPath == c.Root {
+		return &os.PathError{Op: "removeall", Path: name, Err: syscall.EBUSY}
+	}
+	return os.RemoveAll(hostPath)
+}
+
+// Rename renames a path.
+func (c *Chroot) Rename(oldpath, newpath string) error {
+	oldHostPath, err := c.resolve(oldpath, false)
+	if err != nil {
+		return err
+	}
+	newHostPath, err := c.resolve(newpath, false)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldHostPath, newHostPath)
+}
+
+// Chmod changes the mode of a path.
+func (c *Chroot) Chmod(name string, mode os.FileMode) error {
+	hostPath, err := c.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(hostPath, mode)
+}
+
+// Chtimes changes the access and modification times of a path.
+func (c *Chroot) Chtimes(name string, atime, mtime time.Time) error {
+	hostPath, err := c.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(hostPath, atime, mtime)
+}
+
+// Symlink creates newname as a symlink to oldname. The target is stored as is:
+// absolute targets point into the root.
+func (c *Chroot) Symlink(oldname, newname string) error {
+	hostPath, err := c.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(oldname, hostPath)
+}
+
+// Link creates newname as a hard link to oldname.
+func (c *Chroot) Link(oldname, newname string) error {
+	oldHostPath, err := c.resolve(oldname, false)
+	if err != nil {
+		return err
+	}
+	newHostPath, err := c.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+	return os.Link(oldHostPath, newHostPath)
+}
+
+// Chown changes the owner and group of a path, looking up names in the
+// /etc/passwd and /etc/group files of the root.
+func (c *Chroot) Chown(name, owner, group string) error {
+	uid, gid := -1, -1
+	var err error
+	if owner != "" {
+		if uid, err = c.lookupID("/etc/passwd", "user", "UID", owner); err != nil {
+			return fmt.Errorf("failed to parse owner: %w", err)
+		}
+	}
+	if group != "" {
+		if gid, err = c.lookupID("/etc/group", "group", "GID", group); err != nil {
+			return fmt.Errorf("failed to parse group: %w", err)
+		}
+	}
+	hostPath, err := c.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	return os.Chown(hostPath, uid, gid)
+}
+
+// String returns "chroot://" and the root directory.
+func (c *Chroot) String() string {
+	return "chroot://" + c.Root
+}
+
+// Close does nothing.
+func (c *Chroot) Close() error {
+	return nil
+}
+
+// resolve returns the path on this host of a path of the root. Symlinks are
+// followed as if the root were the root of the file system, except the last
+// element of the path unless followLast is set. Relative paths are relative to
+// the root.
+func (c *Chroot) resolve(name string, followLast bool) (string, error) {
+	current := "/"
+	rest := name
+	links := 0
+	for {
+		rest = strings.TrimLeft(rest, "/")
+		if rest == "" {
+			break
+		}
+		var elem string
+		elem, rest, _ = strings.Cut(rest, "/")
+		switch elem {
+		case ".":
+			continue
+		case "..":
+			current = path.Dir(current)
+			continue
+		}
+
+		next := path.Join(current, elem)
+		if strings.TrimLeft(rest, "/") == "" && !followLast {
+			current = next
+			break
+		}
+		info, err := os.Lstat(filepath.Join(c.Root, next))
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			// Missing paths are resolved as they are, to be created or reported missing
+			current = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", &os.PathError{Op: "resolve", Path: name, Err: syscall.ELOOP}
+		}
+		target, err := os.Readlink(filepath.Join(c.Root, next))
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			current = "/"
+		}
+		rest = target + "/" + rest
+	}
+	return filepath.Join(c.Root, current), nil
+}
+
+// lookupID returns the numeric ID of a user or group name in a passwd or group
+// file of the root. Numeric IDs are returned as they are.
+func (c *Chroot) lookupID(file, kind, idName, name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	data, err := c.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return -1, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		// Format: name:password:id:...
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 3 || fields[0] != name {
+			continue
+		}
+		id, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return -1, fmt.Errorf("invalid %s: %s", idName, fields[2])
+		}
+		return id, nil
+	}
+	return -1, fmt.Errorf("%s not found: %s", kind, name)
+}
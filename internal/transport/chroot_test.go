@@ -0,0 +1,331 @@
+//go:build unix
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// newTestChroot returns a Chroot of a temporary directory with these entries:
+//
+//	/etc/passwd, /etc/group
+//	/usr/share/zoneinfo/UTC
+//	/etc/localtime -> /usr/share/zoneinfo/UTC   (absolute link)
+//	/lib -> usr/lib                             (relative link)
+//	/escape -> ../../..                         (relative link out of the root)
+//	/outside -> <a directory outside the root>  (absolute link out of the root)
+//	/loop -> loop
+func newTestChroot(t *testing.T) (*Chroot, string) {
+	t.Helper()
+	root := t.TempDir()
+	outside := t.TempDir()
+	files := map[string]string{
+		"etc/passwd":             "root:x:0:0:root:/root:/bin/sh\ndeploy:x:1001:1001::/home/deploy:/bin/sh\n",
+		"etc/group":              "root:x:0:\ndeploy:x:1001:\nbroken:x:abc:\n",
+		"usr/share/zoneinfo/UTC": "TZif",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"etc/localtime": "/usr/share/zoneinfo/UTC",
+		"lib":           "usr/lib",
+		"escape":        "../../..",
+		"outside":       outside,
+		"loop":          "loop",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := NewChroot(root)
+	if err != nil {
+		t.Fatalf("NewChroot() error = %v", err)
+	}
+	return c, outside
+}
+
+func TestNewChroot(t *testing.T) {
+	dir := t.TempDir()
+	resolvedDir, _ := filepath.EvalSymlinks(dir)
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewChroot(link)
+	if err != nil {
+		t.Fatalf("NewChroot() error = %v", err)
+	}
+	if c.Root != resolvedDir {
+		t.Errorf("Root = %q, want %q", c.Root, resolvedDir)
+	}
+	if c.String() != "chroot://"+resolvedDir {
+		t.Errorf("String() = %q", c.String())
+	}
+
+	if _, err := NewChroot(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("NewChroot(missing) error = %v, want not exist", err)
+	}
+	if _, err := NewChroot(file); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("NewChroot(file) error = %v, want not a directory", err)
+	}
+}
+
+func TestChroot_Resolve(t *testing.T) {
+	c, outside := newTestChroot(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		followLast bool
+		want       string
+	}{
+		{"root", "/", true, "/"},
+		{"plain path", "/etc/passwd", true, "/etc/passwd"},
+		{"relative path", "etc/passwd", true, "/etc/passwd"},
+		{"missing path", "/opt/app/config", true, "/opt/app/config"},
+		{"dot dot stops at root", "/../../etc/passwd", true, "/etc/passwd"},
+		{"absolute link", "/etc/localtime", true, "/usr/share/zoneinfo/UTC"},
+		{"absolute link not followed", "/etc/localtime", false, "/etc/localtime"},
+		{"relative link in path", "/lib/modules", true, "/usr/lib/modules"},
+		{"link out of root", "/escape/etc/passwd", true, "/etc/passwd"},
+		{"link out of root not followed", "/escape", false, "/escape"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.resolve(tt.path, tt.followLast)
+			if err != nil {
+				t.Fatalf("resolve() error = %v", err)
+			}
+			if want := filepath.Join(c.Root, tt.want); got != want {
+				t.Errorf("resolve(%q) = %q, want %q", tt.path, got, want)
+			}
+		})
+	}
+
+	// Absolute targets out of the root are resolved under the root
+	if got, err := c.resolve("/outside/file", true); err != nil || got != filepath.Join(c.Root, outside, "file") {
+		t.Errorf("resolve(/outside/file) = %q, %v, want %q", got, err, filepath.Join(c.Root, outside, "file"))
+	}
+	if _, err := c.resolve("/loop/file", true); !errors.Is(err, syscall.ELOOP) {
+		t.Errorf("resolve(loop) error = %v, want ELOOP", err)
+	}
+}
+
+func TestChroot_Files(t *testing.T) {
+	c, outside := newTestChroot(t)
+
+	// Writes through links out of the root stay in the root
+	if err := c.WriteFile("/escape/written", []byte("data"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.Root, "written")); err != nil {
+		t.Errorf("file not written under the root: %v", err)
+	}
+	if err := c.MkdirAll("/outside/dir", 0755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("MkdirAll() created %v outside the root", entries)
+	}
+
+	data, err := c.ReadFile("/etc/localtime")
+	if err != nil || string(data) != "TZif" {
+		t.Errorf("ReadFile(link) = %q, %v", data, err)
+	}
+	if _, err := c.ReadFile("/missing"); !os.IsNotExist(err) {
+		t.Errorf("ReadFile(missing) error = %v, want not exist", err)
+	}
+
+	// Links keep their targets as they are
+	if err := c.Symlink("/usr/share/zoneinfo/UTC", "/etc/zone"); err != nil {
+		t.Fatalf("Symlink() error = %v", err)
+	}
+	if target, err := c.Readlink("/etc/zone"); err != nil || target != "/usr/share/zoneinfo/UTC" {
+		t.Errorf("Readlink() = %q, %v", target, err)
+	}
+	info, err := c.Lstat("/etc/zone")
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat() = %v, %v, want a symlink", info, err)
+	}
+	info, err = c.Stat("/etc/zone")
+	if err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Stat() = %v, %v, want the link target", info, err)
+	}
+
+	if err := c.Link("/etc/passwd", "/etc/passwd-"); err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	if err := c.Rename("/etc/passwd-", "/etc/passwd.bak"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if err := c.Chmod("/etc/passwd.bak", 0600); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	if info, err := c.Stat("/etc/passwd.bak"); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Stat() = %v, %v, want mode 0600", info, err)
+	}
+
+	// Removing a link removes the link, not its target
+	if err := c.Remove("/etc/localtime"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.Root, "usr/share/zoneinfo/UTC")); err != nil {
+		t.Errorf("Remove() removed the link target: %v", err)
+	}
+	if err := c.RemoveAll("/escape"); err != nil {
+		t.Fatalf("RemoveAll() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.Root, "etc")); err != nil {
+		t.Errorf("RemoveAll() followed the link: %v", err)
+	}
+	for _, name := range []string{"/", "/.."} {
+		if err := c.RemoveAll(name); !errors.Is(err, syscall.EBUSY) {
+			t.Errorf("RemoveAll(%q) error = %v, want EBUSY", name, err)
+		}
+	}
+}
+
+func TestChroot_TempFile(t *testing.T) {
+	c, err := NewChroot(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := c.TempFile()
+	if err != nil {
+		t.Fatalf("TempFile() error = %v", err)
+	}
+	if !strings.HasPrefix(path, "/tmp/mooncake-") {
+		t.Errorf("TempFile() = %q, want a path in /tmp of the root", path)
+	}
+	info, err := c.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Size() != 0 || info.Mode().Perm() != 0o600 {
+		t.Errorf("TempFile() created size %d mode %v, want an empty 0600 file", info.Size(), info.Mode().Perm())
+	}
+	tmpInfo, err := c.Stat("/tmp")
+	if err != nil || tmpInfo.Mode()&os.ModeSticky == 0 || tmpInfo.Mode().Perm() != 0o777 {
+		t.Errorf("Stat(/tmp) = %v, %v, want a sticky 0777 directory", tmpInfo, err)
+	}
+}
+
+func TestChroot_LookupID(t *testing.T) {
+	c, _ := newTestChroot(t)
+
+	tests := []struct {
+		file    string
+		name    string
+		want    int
+		wantErr string
+	}{
+		{"/etc/passwd", "deploy", 1001, ""},
+		{"/etc/passwd", "root", 0, ""},
+		{"/etc/passwd", "1234", 1234, ""},
+		{"/etc/passwd", "nobody", -1, "user not found: nobody"},
+		{"/etc/group", "deploy", 1001, ""},
+		{"/etc/group", "broken", -1, "invalid GID: abc"},
+		{"/etc/shadow", "deploy", -1, "user not found: deploy"},
+	}
+	for _, tt := range tests {
+		kind, idName := "user", "UID"
+		if tt.file == "/etc/group" {
+			kind, idName = "group", "GID"
+		}
+		got, err := c.lookupID(tt.file, kind, idName, tt.name)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("lookupID(%s, %s) error = %v, want %q", tt.file, tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("lookupID(%s, %s) = %d, %v, want %d", tt.file, tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestChroot_LookPath(t *testing.T) {
+	c, _ := newTestChroot(t)
+	t.Setenv("PATH", "/usr/local/bin:/usr/bin:relative")
+	for name, mode := range map[string]os.FileMode{"usr/bin/apt": 0755, "usr/bin/notes": 0644} {
+		path := filepath.Join(c.Root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if path, err := c.LookPath("apt"); err != nil || path != "/usr/bin/apt" {
+		t.Errorf("LookPath(apt) = %q, %v, want /usr/bin/apt", path, err)
+	}
+	if path, err := c.LookPath("/usr/bin/apt"); err != nil || path != "/usr/bin/apt" {
+		t.Errorf("LookPath(/usr/bin/apt) = %q, %v", path, err)
+	}
+	for _, name := range []string{"notes", "dnf", "/usr/bin/dnf"} {
+		if _, err := c.LookPath(name); !errors.Is(err, exec.ErrNotFound) {
+			t.Errorf("LookPath(%s) error = %v, want not found", name, err)
+		}
+	}
+}
+
+func TestChroot_Command(t *testing.T) {
+	c := &Chroot{Root: "/mnt/image"}
+
+	cmd := c.Command(context.Background(), Cmd{Name: "apt-get", Args: []string{"install", "-y", "curl"}, Env: []string{"DEBIAN_FRONTEND=noninteractive"}})
+	want := []string{"chroot", "/mnt/image", "apt-get", "install", "-y", "curl"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Command() args = %q, want %q", cmd.Args, want)
+	}
+	if cmd.Dir != "" {
+		t.Errorf("Command() dir = %q, want the directory of this process", cmd.Dir)
+	}
+	if len(cmd.Env) == 0 || cmd.Env[len(cmd.Env)-1] != "DEBIAN_FRONTEND=noninteractive" {
+		t.Errorf("Command() env doesn't end with the added variable")
+	}
+
+	cmd = c.Command(context.Background(), Cmd{Name: "make", Args: []string{"install"}, Dir: "/src"})
+	want = []string{"chroot", "/mnt/image", "sh", "-c", chrootDirScript, "/src", "make", "install"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Command() args = %q, want %q", cmd.Args, want)
+	}
+}
+
+func TestHostPath(t *testing.T) {
+	c, _ := newTestChroot(t)
+
+	if path, err := HostPath(NewLocal(), "/etc/passwd"); err != nil || path != "/etc/passwd" {
+		t.Errorf("HostPath(local) = %q, %v", path, err)
+	}
+	if path, err := HostPath(c, "/etc/localtime"); err != nil || path != filepath.Join(c.Root, "usr/share/zoneinfo/UTC") {
+		t.Errorf("HostPath(chroot) = %q, %v", path, err)
+	}
+	if _, err := HostPath(&SSH{Host: "box"}, "/etc/passwd"); err == nil {
+		t.Error("HostPath(ssh) should error")
+	}
+}
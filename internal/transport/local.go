@@ -0,0 +1,182 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// Local applies changes to this host.
+type Local struct{}
+
+// NewLocal returns the transport of this host.
+func NewLocal() *Local {
+	return &Local{}
+}
+
+// Command returns a local command. Its environment is the environment of this
+// process with cmd.Env added.
+func (*Local) Command(ctx context.Context, cmd Cmd) *exec.Cmd {
+	// #nosec G204 -- This is a provisioning tool designed to execute commands
+	command := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	command.Dir = cmd.Dir
+	if len(cmd.Env) > 0 {
+		command.Env = append(os.Environ(), cmd.Env...)
+	}
+	setProcessGroup(command)
+	return command
+}
+
+// LookPath searches for an executable in the PATH of this process.
+func (*Local) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+// ReadFile reads a file.
+func (*Local) ReadFile(path string) ([]byte, error) {
+	// #nosec G304 -- File path from user config is intentional
+	return os.ReadFile(path)
+}
+
+// WriteFile writes a file, creating it with perm if needed.
+func (*Local) WriteFile(path string, data []byte, perm os.FileMode) error {
+	// #nosec G306 -- Mode is user-configurable for provisioning
+	return os.WriteFile(path, data, perm)
+}
+
+// TempFile creates an empty temporary file.
+func (*Local) TempFile() (string, error) {
+	tmpFile, err := os.CreateTemp("", "mooncake-*")
+	if err != nil {
+		return "", err
+	}
+	if err := tmpFile.Close(); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
+
+// Stat returns the file info of a path, following symlinks.
+func (*Local) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// Lstat returns the file info of a path without following symlinks.
+func (*Local) Lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+// Readlink returns the target of a symlink.
+func (*Local) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+// MkdirAll creates a directory and its parents.
+func (*Local) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Remove removes a file or an empty directory.
+func (*Local) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// RemoveAll removes a path and everything below it.
+func (*Local) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+// Rename renames a path.
+func (*Local) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// Chmod changes the mode of a path.
+func (*Local) Chmod(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+// Chtimes changes the access and modification times of a path.
+func (*Local) Chtimes(path string, atime, mtime time.Time) error {
+	return os.Chtimes(path, atime, mtime)
+}
+
+// Symlink creates newname as a symlink to oldname.
+func (*Local) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+// Link creates newname as a hard link to oldname.
+func (*Local) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+// Chown changes the owner and group of a path, looking up names in the user database.
+func (*Local) Chown(path, owner, group string) error {
+	uid, gid := -1, -1
+	var err error
+	if owner != "" {
+		if uid, err = lookupUID(owner); err != nil {
+			return fmt.Errorf("failed to parse owner: %w", err)
+		}
+	}
+	if group != "" {
+		if gid, err = lookupGID(group); err != nil {
+			return fmt.Errorf("failed to parse group: %w", err)
+		}
+	}
+	return os.Chown(path, uid, gid)
+}
+
+// String returns "local".
+func (*Local) String() string {
+	return "local"
+}
+
+// Close does nothing.
+func (*Local) Close() error {
+	return nil
+}
+
+// lookupUID returns the UID of a user name or numeric UID.
+func lookupUID(owner string) (int, error) {
+	// Try as UID first
+	if uid, err := strconv.Atoi(owner); err == nil {
+		return uid, nil
+	}
+
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return -1, fmt.Errorf("user not found: %s", owner)
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return -1, fmt.Errorf("invalid UID: %s", u.Uid)
+	}
+	return uid, nil
+}
+
+// lookupGID returns the GID of a group name or numeric GID.
+func lookupGID(group string) (int, error) {
+	// Try as GID first
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, fmt.Errorf("group not found: %s", group)
+	}
+
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return -1, fmt.Errorf("invalid GID: %s", g.Gid)
+	}
+	return gid, nil
+}
@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"context"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLookupUID(t *testing.T) {
+	uid, err := lookupUID("1000")
+	if err != nil {
+		t.Errorf("lookupUID() with numeric UID error = %v", err)
+	}
+	if uid != 1000 {
+		t.Errorf("lookupUID() = %d, want 1000", uid)
+	}
+
+	if currentUser, err := user.Current(); err == nil {
+		uid, err := lookupUID(currentUser.Username)
+		if err != nil {
+			t.Errorf("lookupUID() with username error = %v", err)
+		}
+		if expectedUID, _ := strconv.Atoi(currentUser.Uid); uid != expectedUID {
+			t.Errorf("lookupUID() = %d, want %d", uid, expectedUID)
+		}
+	}
+
+	if _, err := lookupUID("nonexistentuser12345"); err == nil {
+		t.Error("lookupUID() should error with nonexistent user")
+	}
+
+	if runtime.GOOS != "windows" {
+		uid, err := lookupUID("root")
+		if err != nil {
+			t.Errorf("lookupUID('root') error = %v", err)
+		} else if uid != 0 {
+			t.Errorf("lookupUID('root') = %d, want 0", uid)
+		}
+	}
+}
+
+func TestLookupGID(t *testing.T) {
+	gid, err := lookupGID("1000")
+	if err != nil {
+		t.Errorf("lookupGID() with numeric GID error = %v", err)
+	}
+	if gid != 1000 {
+		t.Errorf("lookupGID() = %d, want 1000", gid)
+	}
+
+	gid, err = lookupGID("0")
+	if err != nil {
+		t.Errorf("lookupGID('0') error = %v", err)
+	}
+	if gid != 0 {
+		t.Errorf("lookupGID('0') = %d, want 0", gid)
+	}
+
+	if _, err := lookupGID("nonexistentgroup12345"); err == nil {
+		t.Error("lookupGID() should error with nonexistent group")
+	}
+}
+
+func TestLocal_Command(t *testing.T) {
+	dir := t.TempDir()
+	cmd := NewLocal().Command(context.Background(), Cmd{
+		Name: "sh",
+		Args: []string{"-c", `pwd; echo "$MOONCAKE_TEST"`},
+		Dir:  dir,
+		Env:  []string{"MOONCAKE_TEST=hello"},
+	})
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Command() error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	wantDir, _ := filepath.EvalSymlinks(dir)
+	if len(lines) != 2 || lines[0] != wantDir || lines[1] != "hello" {
+		t.Errorf("Command() output = %q, want dir %q and env value", out, wantDir)
+	}
+}
+
+func TestLocal_TempFile(t *testing.T) {
+	local := NewLocal()
+	path, err := local.TempFile()
+	if err != nil {
+		t.Fatalf("TempFile() error = %v", err)
+	}
+	defer func() { _ = local.Remove(path) }()
+
+	info, err := local.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Size() != 0 || info.Mode().Perm() != 0o600 {
+		t.Errorf("TempFile() created size %d mode %v, want an empty 0600 file", info.Size(), info.Mode().Perm())
+	}
+}
+
+func TestIsLocal(t *testing.T) {
+	if !IsLocal(NewLocal()) {
+		t.Error("IsLocal(NewLocal()) = false")
+	}
+	if IsLocal(&SSH{Host: "box"}) {
+		t.Error("IsLocal(SSH) = true")
+	}
+}
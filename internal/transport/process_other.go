@@ -0,0 +1,21 @@
+//go:build !unix
+
+package transport
+
+import (
+	"os/exec"
+	"time"
+)
+
+// processWaitDelay bounds how long a cancelled command may keep its output pipes open.
+const processWaitDelay = 5 * time.Second
+
+// setProcessGroup makes cancellation of the command's context kill the command.
+// Process groups are not available on this platform, so children of the command
+// may keep running.
+//
+// The command must be created with exec.CommandContext. Every transport calls it
+// on the commands it creates.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = processWaitDelay
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package transport
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// processWaitDelay bounds how long a cancelled command may keep its output pipes open.
+const processWaitDelay = 5 * time.Second
+
+// setProcessGroup runs the command in its own process group and makes cancellation
+// of the command's context kill the whole group, so children spawned by shells and
+// scripts don't outlive a timed out or interrupted step.
+//
+// The command must be created with exec.CommandContext. Every transport calls it
+// on the commands it creates.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	cmd.Cancel = func() error {
+		// A negative PID signals every process in the group
+		if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	cmd.WaitDelay = processWaitDelay
+}
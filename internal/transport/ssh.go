@@ -0,0 +1,445 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sshConnectionError is the exit status of ssh itself failing.
+const sshConnectionError = 255
+
+// SSH applies changes to a remote host over SSH.
+//
+// It runs the system ssh client, so host keys, keys, agents and ssh_config apply
+// as usual. All commands share one connection (ssh connection multiplexing),
+// opened by Connect and closed by Close. Authentication must not prompt: the
+// session's stdin carries the command input and the sudo password.
+//
+// File operations run POSIX shell utilities (cat, stat, mkdir, ...) on the remote
+// host as the SSH user; steps with become run sudo on the remote host.
+type SSH struct {
+	// User is the remote user (empty: from ssh_config or the local user).
+	User string
+
+	// Host is the remote host name or address.
+	Host string
+
+	// Port is the SSH port (0: from ssh_config or 22).
+	Port int
+
+	// Program is the ssh client to run (default: "ssh").
+	Program string
+
+	// Options are extra ssh -o options, e.g. "StrictHostKeyChecking=accept-new".
+	Options []string
+
+	controlDir string
+}
+
+// ParseSSHTarget parses a [user@]host[:port] target.
+func ParseSSHTarget(target string) (*SSH, error) {
+	t := &SSH{}
+	host := target
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		t.User, host = host[:at], host[at+1:]
+		if t.User == "" {
+			return nil, fmt.Errorf("invalid host %q: empty user", target)
+		}
+	}
+	if colon := strings.LastIndex(host, ":"); colon >= 0 && !strings.HasSuffix(host, "]") {
+		port, err := strconv.Atoi(host[colon+1:])
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid host %q: bad port %q", target, host[colon+1:])
+		}
+		t.Port, host = port, host[:colon]
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "" {
+		return nil, fmt.Errorf("invalid host %q: empty host name", target)
+	}
+	t.Host = host
+	return t, nil
+}
+
+// Connect opens the shared connection and checks that commands can run.
+func (t *SSH) Connect(ctx context.Context) error {
+	if t.controlDir == "" {
+		dir, err := os.MkdirTemp("", "mooncake-ssh-")
+		if err != nil {
+			return fmt.Errorf("failed to create ssh control directory: %w", err)
+		}
+		t.controlDir = dir
+	}
+	if _, err := t.run(ctx, nil, "connect", "", "true"); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", t, err)
+	}
+	return nil
+}
+
+// Close closes the shared connection.
+func (t *SSH) Close() error {
+	if t.controlDir == "" {
+		return nil
+	}
+	// #nosec G204 -- ssh arguments are built from the configured target
+	_ = exec.Command(t.program(), t.sshArgs("-O", "exit")...).Run()
+	err := os.RemoveAll(t.controlDir)
+	t.controlDir = ""
+	return err
+}
+
+// String returns the target as an ssh URL.
+func (t *SSH) String() string {
+	s := "ssh://"
+	if t.User != "" {
+		s += t.User + "@"
+	}
+	s += t.Host
+	if t.Port != 0 {
+		s += ":" + strconv.Itoa(t.Port)
+	}
+	return s
+}
+
+func (t *SSH) program() string {
+	if t.Program != "" {
+		return t.Program
+	}
+	return "ssh"
+}
+
+// sshArgs returns the ssh arguments up to and including the destination.
+func (t *SSH) sshArgs(extra ...string) []string {
+	args := []string{"-T", "-o", "BatchMode=yes"}
+	if t.controlDir != "" {
+		args = append(args,
+			"-o", "ControlMaster=auto",
+			"-o", "ControlPath="+path.Join(t.controlDir, "control"),
+			"-o", "ControlPersist=yes")
+	}
+	for _, option := range t.Options {
+		args = append(args, "-o", option)
+	}
+	if t.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(t.Port))
+	}
+	if t.User != "" {
+		args = append(args, "-l", t.User)
+	}
+	args = append(args, extra...)
+	return append(args, "--", t.Host)
+}
+
+// Command returns an ssh command running cmd on the remote host.
+func (t *SSH) Command(ctx context.Context, cmd Cmd) *exec.Cmd {
+	var remote strings.Builder
+	if cmd.Dir != "" {
+		remote.WriteString("cd " + Quote(cmd.Dir) + " && ")
+	}
+	if len(cmd.Env) > 0 {
+		remote.WriteString("env")
+		for _, env := range cmd.Env {
+			remote.WriteString(" " + Quote(env))
+		}
+		remote.WriteString(" ")
+	}
+	remote.WriteString(Quote(cmd.Name))
+	for _, arg := range cmd.Args {
+		remote.WriteString(" " + Quote(arg))
+	}
+
+	// #nosec G204 -- This is a provisioning tool designed to execute commands
+	command := exec.CommandContext(ctx, t.program(), append(t.sshArgs(), remote.String())...)
+	setProcessGroup(command)
+	return command
+}
+
+// run runs a shell script on the remote host with args as its positional
+// parameters and returns its stdout. Failures are reported as *fs.PathError for
+// path, from the script's stderr.
+func (t *SSH) run(ctx context.Context, stdin []byte, op, path, script string, args ...string) ([]byte, error) {
+	// Error messages are matched in English
+	cmd := t.Command(ctx, Cmd{
+		Name: "sh",
+		Args: append([]string{"-c", script, "sh"}, args...),
+		Env:  []string{"LC_ALL=C"},
+	})
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, remoteError(op, path, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// remoteError converts the failure of a remote command to an error that os.IsNotExist
+// and friends understand.
+func remoteError(op, path string, err error, stderr string) error {
+	message := strings.TrimSpace(stderr)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	if exitErr.ExitCode() == sshConnectionError {
+		if message == "" {
+			message = "connection failed"
+		}
+		return fmt.Errorf("ssh: %s", message)
+	}
+	if message == "" {
+		message = err.Error()
+	}
+
+	var cause error
+	switch {
+	case strings.Contains(message, "No such file or directory"):
+		cause = fs.ErrNotExist
+	case strings.Contains(message, "File exists"):
+		cause = fs.ErrExist
+	case strings.Contains(message, "Permission denied"), strings.Contains(message, "Operation not permitted"):
+		cause = fs.ErrPermission
+	}
+	if cause == nil {
+		return &fs.PathError{Op: op, Path: path, Err: errors.New(message)}
+	}
+	// os.IsNotExist and friends only look at the error of a *fs.PathError itself
+	return &fs.PathError{Op: op, Path: path, Err: cause}
+}
+
+// LookPath searches for an executable in the remote PATH.
+func (t *SSH) LookPath(file string) (string, error) {
+	out, err := t.run(context.Background(), nil, "lookpath", file, `command -v "$1"`, file)
+	if err != nil {
+		return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ReadFile reads a remote file.
+func (t *SSH) ReadFile(path string) ([]byte, error) {
+	return t.run(context.Background(), nil, "open", path, `cat -- "$1"`, path)
+}
+
+// WriteFile writes a remote file, creating it with perm if needed.
+func (t *SSH) WriteFile(path string, data []byte, perm os.FileMode) error {
+	const script = `[ -e "$1" ] || { : > "$1" && chmod "$2" "$1"; } || exit 1; cat > "$1"`
+	_, err := t.run(context.Background(), data, "open", path, script, path, formatMode(perm))
+	return err
+}
+
+// TempFile creates an empty remote temporary file.
+func (t *SSH) TempFile() (string, error) {
+	out, err := t.run(context.Background(), nil, "mktemp", "", `mktemp "${TMPDIR:-/tmp}/mooncake-XXXXXXXX"`)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// statScript prints the raw mode, size, modification time, device and inode of
+// "$1" with GNU or BSD stat. $2 is -L to follow symlinks.
+const statScript = `if stat -c %f / >/dev/null 2>&1; then stat $2 -c '%f %s %Y %d %i' -- "$1"; ` +
+	`else stat $2 -f '%Xp %z %m %d %i' -- "$1"; fi`
+
+// Stat returns the file info of a remote path, following symlinks.
+func (t *SSH) Stat(path string) (os.FileInfo, error) {
+	return t.stat("stat", path, "-L")
+}
+
+// Lstat returns the file info of a remote path without following symlinks.
+func (t *SSH) Lstat(path string) (os.FileInfo, error) {
+	return t.stat("lstat", path, "")
+}
+
+func (t *SSH) stat(op, path, follow string) (os.FileInfo, error) {
+	out, err := t.run(context.Background(), nil, op, path, statScript, path, follow)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseStat(path, string(out))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: path, Err: err}
+	}
+	return info, nil
+}
+
+// Readlink returns the target of a remote symlink.
+func (t *SSH) Readlink(path string) (string, error) {
+	const script = `if [ -L "$1" ]; then readlink -- "$1"; ` +
+		`elif [ -e "$1" ]; then echo "$1: not a symlink" >&2; exit 1; ` +
+		`else echo "$1: No such file or directory" >&2; exit 1; fi`
+	out, err := t.run(context.Background(), nil, "readlink", path, script, path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// MkdirAll creates a remote directory and its parents.
+func (t *SSH) MkdirAll(path string, perm os.FileMode) error {
+	_, err := t.run(context.Background(), nil, "mkdir", path, `mkdir -p -m "$2" -- "$1"`, path, formatMode(perm))
+	return err
+}
+
+// Remove removes a remote file or empty directory.
+func (t *SSH) Remove(path string) error {
+	const script = `if [ -d "$1" ] && [ ! -L "$1" ]; then rmdir -- "$1"; else rm -- "$1"; fi`
+	_, err := t.run(context.Background(), nil, "remove", path, script, path)
+	return err
+}
+
+// RemoveAll removes a remote path and everything below it.
+func (t *SSH) RemoveAll(path string) error {
+	_, err := t.run(context.Background(), nil, "removeall", path, `rm -rf -- "$1"`, path)
+	return err
+}
+
+// Rename renames a remote path.
+func (t *SSH) Rename(oldpath, newpath string) error {
+	_, err := t.run(context.Background(), nil, "rename", oldpath, `mv -f -- "$1" "$2"`, oldpath, newpath)
+	return err
+}
+
+// Chmod changes the mode of a remote path.
+func (t *SSH) Chmod(path string, mode os.FileMode) error {
+	_, err := t.run(context.Background(), nil, "chmod", path, `chmod "$2" -- "$1"`, path, formatMode(mode))
+	return err
+}
+
+// Chtimes changes the access and modification times of a remote path.
+func (t *SSH) Chtimes(path string, atime, mtime time.Time) error {
+	const layout = "200601021504.05"
+	const script = `TZ=UTC0 touch -c -a -t "$2" -- "$1" && TZ=UTC0 touch -c -m -t "$3" -- "$1"`
+	_, err := t.run(context.Background(), nil, "chtimes", path, script, path,
+		atime.UTC().Format(layout), mtime.UTC().Format(layout))
+	return err
+}
+
+// Symlink creates newname as a remote symlink to oldname.
+func (t *SSH) Symlink(oldname, newname string) error {
+	_, err := t.run(context.Background(), nil, "symlink", newname, `ln -s -- "$1" "$2"`, oldname, newname)
+	return err
+}
+
+// Link creates newname as a remote hard link to oldname.
+func (t *SSH) Link(oldname, newname string) error {
+	_, err := t.run(context.Background(), nil, "link", newname, `ln -- "$1" "$2"`, oldname, newname)
+	return err
+}
+
+// Chown changes the owner and group of a remote path.
+func (t *SSH) Chown(path, owner, group string) error {
+	spec := owner
+	if group != "" {
+		spec += ":" + group
+	}
+	if spec == "" {
+		return nil
+	}
+	_, err := t.run(context.Background(), nil, "chown", path, `chown "$2" -- "$1"`, path, spec)
+	return err
+}
+
+// Quote quotes a string for a POSIX shell.
+func Quote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,+@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// formatMode formats the permission bits of a mode as an octal chmod mode.
+func formatMode(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+// fileInfo is the file info of a remote path.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	dev     string
+	ino     string
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+// parseStat parses the output of statScript.
+func parseStat(name, out string) (*fileInfo, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("unexpected stat output %q", strings.TrimSpace(out))
+	}
+	raw, err1 := strconv.ParseUint(fields[0], 16, 32)
+	size, err2 := strconv.ParseInt(fields[1], 10, 64)
+	mtime, err3 := strconv.ParseInt(fields[2], 10, 64)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, fmt.Errorf("unexpected stat output %q: %w", strings.TrimSpace(out), err)
+	}
+	return &fileInfo{
+		name:    path.Base(name),
+		size:    size,
+		mode:    unixMode(uint32(raw)),
+		modTime: time.Unix(mtime, 0),
+		dev:     fields[3],
+		ino:     fields[4],
+	}, nil
+}
+
+// unixMode converts a Unix st_mode to an os.FileMode.
+func unixMode(raw uint32) os.FileMode {
+	mode := os.FileMode(raw & 0o777)
+	switch raw & 0o170000 {
+	case 0o040000:
+		mode |= os.ModeDir
+	case 0o120000:
+		mode |= os.ModeSymlink
+	case 0o010000:
+		mode |= os.ModeNamedPipe
+	case 0o140000:
+		mode |= os.ModeSocket
+	case 0o020000:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 0o060000:
+		mode |= os.ModeDevice
+	}
+	if raw&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if raw&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if raw&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
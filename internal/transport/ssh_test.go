@@ -0,0 +1,431 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSSH is an ssh client that runs the remote command on this host.
+const fakeSSH = `#!/bin/sh
+control=
+while [ "$1" != "--" ]; do
+  [ "$1" = "-O" ] && control=1
+  shift
+done
+shift 2
+[ -n "$control" ] && exit 0
+exec sh -c "$1"
+`
+
+// newFakeSSH returns an SSH transport whose commands run on this host. If the
+// MOONCAKE_TEST_SSH_HOST environment variable is set (e.g. to a local sshd in a
+// container), the transport connects to that host instead.
+func newFakeSSH(t *testing.T) *SSH {
+	t.Helper()
+	var target *SSH
+	if host := os.Getenv("MOONCAKE_TEST_SSH_HOST"); host != "" {
+		parsed, err := ParseSSHTarget(host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target = parsed
+	} else {
+		program := filepath.Join(t.TempDir(), "ssh")
+		// #nosec G306 -- test helper must be executable
+		if err := os.WriteFile(program, []byte(fakeSSH), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		target = &SSH{Host: "box", Program: program}
+	}
+	if err := target.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() { _ = target.Close() })
+	return target
+}
+
+// remoteTempDir creates a temporary directory on the target of an SSH transport.
+func remoteTempDir(t *testing.T, target *SSH) string {
+	t.Helper()
+	out, err := target.run(context.Background(), nil, "mktemp", "", `mktemp -d "${TMPDIR:-/tmp}/mooncake-test-XXXXXXXX"`)
+	if err != nil {
+		t.Fatalf("mktemp -d error = %v", err)
+	}
+	dir := strings.TrimSpace(string(out))
+	t.Cleanup(func() { _ = target.RemoveAll(dir) })
+	return dir
+}
+
+func TestParseSSHTarget(t *testing.T) {
+	tests := []struct {
+		target  string
+		want    SSH
+		wantErr bool
+	}{
+		{target: "box", want: SSH{Host: "box"}},
+		{target: "deploy@box", want: SSH{User: "deploy", Host: "box"}},
+		{target: "deploy@box:2222", want: SSH{User: "deploy", Host: "box", Port: 2222}},
+		{target: "10.0.0.5:22", want: SSH{Host: "10.0.0.5", Port: 22}},
+		{target: "[::1]", want: SSH{Host: "::1"}},
+		{target: "root@[::1]:2222", want: SSH{User: "root", Host: "::1", Port: 2222}},
+		{target: "", wantErr: true},
+		{target: "@box", wantErr: true},
+		{target: "box:ssh", wantErr: true},
+		{target: "box:70000", wantErr: true},
+		{target: "deploy@", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			got, err := ParseSSHTarget(tt.target)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSSHTarget(%q) = %+v, want an error", tt.target, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSSHTarget(%q) error = %v", tt.target, err)
+			}
+			if got.User != tt.want.User || got.Host != tt.want.Host || got.Port != tt.want.Port {
+				t.Errorf("ParseSSHTarget(%q) = %+v, want %+v", tt.target, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSH_String(t *testing.T) {
+	target := &SSH{User: "deploy", Host: "box", Port: 2222}
+	if got := target.String(); got != "ssh://deploy@box:2222" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := (&SSH{Host: "box"}).String(); got != "ssh://box" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestSSH_sshArgs(t *testing.T) {
+	target := &SSH{User: "deploy", Host: "box", Port: 2222, Options: []string{"StrictHostKeyChecking=no"}}
+	got := strings.Join(target.sshArgs(), " ")
+	want := "-T -o BatchMode=yes -o StrictHostKeyChecking=no -p 2222 -l deploy -- box"
+	if got != want {
+		t.Errorf("sshArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"plain":          "plain",
+		"/etc/hosts":     "/etc/hosts",
+		"KEY=value":      "KEY=value",
+		"":               "''",
+		"two words":      "'two words'",
+		"it's":           `'it'\''s'`,
+		"$HOME":          "'$HOME'",
+		"a;rm -rf /":     "'a;rm -rf /'",
+		"line\nbreak":    "'line\nbreak'",
+		"glob*":          "'glob*'",
+		"`cmd`":          "'`cmd`'",
+		"back\\slash":    "'back\\slash'",
+		"user@host:port": "user@host:port",
+	}
+	for in, want := range tests {
+		if got := Quote(in); got != want {
+			t.Errorf("Quote(%q) = %q, want %q", in, got, want)
+		}
+		// The quoted string must come back unchanged from the shell
+		out, err := exec.Command("sh", "-c", "printf %s "+Quote(in)).Output()
+		if err != nil {
+			t.Fatalf("sh error = %v", err)
+		}
+		if string(out) != in {
+			t.Errorf("sh printf %s = %q, want %q", Quote(in), out, in)
+		}
+	}
+}
+
+func TestSSH_Command(t *testing.T) {
+	target := newFakeSSH(t)
+	dir := remoteTempDir(t, target)
+
+	cmd := target.Command(context.Background(), Cmd{
+		Name: "sh",
+		Args: []string{"-c", `pwd; echo "$GREETING"; echo "$1"`, "sh", "it's a $test"},
+		Dir:  dir,
+		Env:  []string{"GREETING=hello world"},
+	})
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Command() error = %v", err)
+	}
+	want := dir + "\nhello world\nit's a $test\n"
+	if string(out) != want {
+		t.Errorf("Command() output = %q, want %q", out, want)
+	}
+
+	cmd = target.Command(context.Background(), Cmd{Name: "sh", Args: []string{"-c", "exit 3"}})
+	var exitErr *exec.ExitError
+	if err := cmd.Run(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("Command() exit status = %v, want 3", err)
+	}
+
+	cmd = target.Command(context.Background(), Cmd{Name: "cat"})
+	cmd.Stdin = strings.NewReader("from stdin")
+	if out, err := cmd.Output(); err != nil || string(out) != "from stdin" {
+		t.Errorf("Command() with stdin = %q, %v", out, err)
+	}
+}
+
+func TestSSH_Files(t *testing.T) {
+	target := newFakeSSH(t)
+	dir := remoteTempDir(t, target)
+	file := filepath.Join(dir, "file with spaces.txt")
+
+	if _, err := target.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("Stat() of a missing file error = %v, want not exist", err)
+	}
+	if _, err := target.ReadFile(file); !os.IsNotExist(err) {
+		t.Fatalf("ReadFile() of a missing file error = %v, want not exist", err)
+	}
+
+	content := []byte("line one\nit's $HOME\n")
+	if err := target.WriteFile(file, content, 0o640); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	got, err := target.ReadFile(file)
+	if err != nil || string(got) != string(content) {
+		t.Fatalf("ReadFile() = %q, %v, want %q", got, err, content)
+	}
+	info, err := target.Stat(file)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Name() != "file with spaces.txt" || info.Size() != int64(len(content)) ||
+		info.Mode() != 0o640 || info.IsDir() {
+		t.Errorf("Stat() = name %q size %d mode %v", info.Name(), info.Size(), info.Mode())
+	}
+
+	// Rewriting keeps the mode
+	if err := target.WriteFile(file, []byte("new"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if info, _ := target.Stat(file); info.Mode() != 0o640 || info.Size() != 3 {
+		t.Errorf("Stat() after rewrite = mode %v size %d", info.Mode(), info.Size())
+	}
+
+	if err := target.Chmod(file, os.ModeSetuid|0o755); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	if info, _ := target.Stat(file); info.Mode() != 0o755|os.ModeSetuid {
+		t.Errorf("Stat() after Chmod() mode = %v", info.Mode())
+	}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := target.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	if info, _ := target.Stat(file); !info.ModTime().Equal(mtime) {
+		t.Errorf("ModTime() after Chtimes() = %v, want %v", info.ModTime(), mtime)
+	}
+
+	subdir := filepath.Join(dir, "a", "b")
+	if err := target.MkdirAll(subdir, 0o750); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if info, err := target.Stat(subdir); err != nil || !info.IsDir() || info.Mode().Perm() != 0o750 {
+		t.Errorf("Stat() of created directory = %v, %v", info, err)
+	}
+
+	link := filepath.Join(dir, "link")
+	if err := target.Symlink(file, link); err != nil {
+		t.Fatalf("Symlink() error = %v", err)
+	}
+	if err := target.Symlink(file, link); !os.IsExist(err) {
+		t.Errorf("Symlink() over an existing link error = %v, want exist", err)
+	}
+	if got, err := target.Readlink(link); err != nil || got != file {
+		t.Errorf("Readlink() = %q, %v, want %q", got, err, file)
+	}
+	if _, err := target.Readlink(file); err == nil || os.IsNotExist(err) {
+		t.Errorf("Readlink() of a regular file error = %v", err)
+	}
+	if _, err := target.Readlink(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("Readlink() of a missing path error = %v, want not exist", err)
+	}
+	if info, err := target.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat() of symlink = %v, %v", info, err)
+	}
+	if info, err := target.Stat(link); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Stat() of symlink = %v, %v", info, err)
+	}
+
+	hardlink := filepath.Join(dir, "hardlink")
+	if err := target.Link(file, hardlink); err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	fileInfo, _ := target.Stat(file)
+	hardlinkInfo, _ := target.Stat(hardlink)
+	subdirInfo, _ := target.Stat(subdir)
+	if !SameFile(fileInfo, hardlinkInfo) || SameFile(fileInfo, subdirInfo) {
+		t.Error("SameFile() does not tell hard links apart from other files")
+	}
+
+	renamed := filepath.Join(dir, "renamed")
+	if err := target.Rename(hardlink, renamed); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if _, err := target.Stat(hardlink); !os.IsNotExist(err) {
+		t.Errorf("Stat() of renamed file error = %v, want not exist", err)
+	}
+
+	if err := target.Remove(filepath.Join(dir, "a")); err == nil {
+		t.Error("Remove() of a non-empty directory should fail")
+	}
+	if err := target.Remove(subdir); err != nil {
+		t.Errorf("Remove() of an empty directory error = %v", err)
+	}
+	if err := target.Remove(link); err != nil {
+		t.Errorf("Remove() of a symlink error = %v", err)
+	}
+	if _, err := target.Stat(file); err != nil {
+		t.Errorf("Remove() of a symlink removed its target: %v", err)
+	}
+	if err := target.Remove(link); !os.IsNotExist(err) {
+		t.Errorf("Remove() of a missing path error = %v, want not exist", err)
+	}
+	if err := target.RemoveAll(filepath.Join(dir, "a")); err != nil {
+		t.Errorf("RemoveAll() error = %v", err)
+	}
+	if err := target.RemoveAll(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("RemoveAll() of a missing path error = %v", err)
+	}
+}
+
+func TestSSH_TempFileAndLookPath(t *testing.T) {
+	target := newFakeSSH(t)
+
+	tmp, err := target.TempFile()
+	if err != nil {
+		t.Fatalf("TempFile() error = %v", err)
+	}
+	defer func() { _ = target.Remove(tmp) }()
+	if info, err := target.Stat(tmp); err != nil || info.Size() != 0 || info.Mode().Perm() != 0o600 {
+		t.Errorf("Stat() of temp file = %v, %v", info, err)
+	}
+
+	if path, err := target.LookPath("sh"); err != nil || !strings.HasSuffix(path, "/sh") {
+		t.Errorf("LookPath(sh) = %q, %v", path, err)
+	}
+	if _, err := target.LookPath("mooncake-no-such-command"); !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("LookPath() of a missing command error = %v, want exec.ErrNotFound", err)
+	}
+}
+
+func TestSSH_Chown(t *testing.T) {
+	target := newFakeSSH(t)
+	dir := remoteTempDir(t, target)
+	file := filepath.Join(dir, "owned")
+	if err := target.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := target.Chown(file, "", ""); err != nil {
+		t.Errorf("Chown() with no owner error = %v", err)
+	}
+	uid := strings.TrimSpace(runOutput(t, target, "id -u"))
+	gid := strings.TrimSpace(runOutput(t, target, "id -g"))
+	if err := target.Chown(file, uid, gid); err != nil {
+		t.Errorf("Chown() to the current user error = %v", err)
+	}
+	if err := target.Chown(file, "nonexistentuser12345", ""); err == nil {
+		t.Error("Chown() to a nonexistent user should fail")
+	}
+}
+
+func TestSSH_ConnectError(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "ssh")
+	// #nosec G306 -- test helper must be executable
+	script := "#!/bin/sh\necho 'ssh: connect to host box port 22: Connection refused' >&2\nexit 255\n"
+	if err := os.WriteFile(program, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	target := &SSH{Host: "box", Program: program}
+	defer func() { _ = target.Close() }()
+
+	err := target.Connect(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Connection refused") {
+		t.Errorf("Connect() error = %v, want the ssh error", err)
+	}
+	if _, err := target.ReadFile("/etc/hosts"); err == nil || os.IsNotExist(err) {
+		t.Errorf("ReadFile() over a failed connection error = %v", err)
+	}
+}
+
+func TestParseStat(t *testing.T) {
+	info, err := parseStat("/etc/hosts", "81a4 220 1700000000 2049 1234\n")
+	if err != nil {
+		t.Fatalf("parseStat() error = %v", err)
+	}
+	if info.Name() != "hosts" || info.Size() != 220 || info.Mode() != 0o644 ||
+		info.ModTime().Unix() != 1700000000 || info.dev != "2049" || info.ino != "1234" {
+		t.Errorf("parseStat() = %+v", info)
+	}
+
+	for _, out := range []string{"", "81a4 220", "zz 220 1700000000 1 2"} {
+		if _, err := parseStat("x", out); err == nil {
+			t.Errorf("parseStat(%q) should fail", out)
+		}
+	}
+}
+
+func TestFormatMode(t *testing.T) {
+	tests := map[os.FileMode]string{
+		0o644:                              "0644",
+		os.ModeDir | 0o755:                 "0755",
+		os.ModeSetuid | 0o755:              "4755",
+		os.ModeSetgid | 0o750:              "2750",
+		os.ModeDir | os.ModeSticky | 0o777: "1777",
+	}
+	for mode, want := range tests {
+		if got := formatMode(mode); got != want {
+			t.Errorf("formatMode(%v) = %q, want %q", mode, got, want)
+		}
+	}
+}
+
+func TestUnixMode(t *testing.T) {
+	tests := []struct {
+		raw  uint32
+		want os.FileMode
+	}{
+		{0o100644, 0o644},
+		{0o040755, os.ModeDir | 0o755},
+		{0o120777, os.ModeSymlink | 0o777},
+		{0o104755, os.ModeSetuid | 0o755},
+		{0o041777, os.ModeDir | os.ModeSticky | 0o777},
+		{0o102755, os.ModeSetgid | 0o755},
+		{0o010644, os.ModeNamedPipe | 0o644},
+		{0o140755, os.ModeSocket | 0o755},
+		{0o020666, os.ModeDevice | os.ModeCharDevice | 0o666},
+		{0o060660, os.ModeDevice | 0o660},
+	}
+	for _, tt := range tests {
+		if got := unixMode(tt.raw); got != tt.want {
+			t.Errorf("unixMode(%o) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func runOutput(t *testing.T, target Transport, script string) string {
+	t.Helper()
+	out, err := target.Command(context.Background(), Cmd{Name: "sh", Args: []string{"-c", script}}).Output()
+	if err != nil {
+		t.Fatalf("%s error = %v", script, err)
+	}
+	return string(out)
+}
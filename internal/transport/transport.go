@@ -0,0 +1,101 @@
+// Package transport runs commands and accesses files on the host a plan is applied to.
+//
+// Action handlers go through a Transport instead of the os and os/exec packages, so
+// the same plan can be applied to the local host (Local), to a remote host over SSH
+// (SSH) or to a directory tree used as the root, such as an image (Chroot). Files
+// read from the config directory (template and copy sources) stay local; only the
+// paths a step manages are accessed through the transport.
+package transport
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Transport runs commands and accesses files on a target host.
+//
+// File methods behave like their os package counterparts: errors can be checked
+// with os.IsNotExist, os.IsExist and os.IsPermission.
+type Transport interface {
+	// Command returns a command that runs on the target host. The caller sets its
+	// Stdin, Stdout and Stderr and runs it like any exec.Cmd; a non-zero exit
+	// status of the remote command is reported as an *exec.ExitError. The command
+	// runs in its own process group, which is killed when ctx is done.
+	Command(ctx context.Context, cmd Cmd) *exec.Cmd
+
+	// LookPath searches for an executable in the PATH of the target host.
+	LookPath(file string) (string, error)
+
+	ReadFile(path string) ([]byte, error)
+	WriteFile(path string, data []byte, perm os.FileMode) error
+
+	// TempFile creates an empty file only readable by its owner in the temporary
+	// directory of the target host and returns its path. The caller removes it.
+	TempFile() (string, error)
+
+	Stat(path string) (os.FileInfo, error)
+	Lstat(path string) (os.FileInfo, error)
+	Readlink(path string) (string, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Remove(path string) error
+	RemoveAll(path string) error
+	Rename(oldpath, newpath string) error
+	Chmod(path string, mode os.FileMode) error
+	Chtimes(path string, atime, mtime time.Time) error
+	Symlink(oldname, newname string) error
+	Link(oldname, newname string) error
+
+	// Chown changes the owner and group of a path. Both are names or numeric
+	// IDs, resolved on the target host; empty leaves them unchanged.
+	Chown(path, owner, group string) error
+
+	// String describes the target, e.g. "local" or "ssh://deploy@web1".
+	String() string
+
+	// Close releases the connection to the target host.
+	Close() error
+}
+
+// Cmd describes a command to run on the target host.
+type Cmd struct {
+	Name string
+	Args []string
+
+	// Dir is the working directory on the target host (empty: the default).
+	Dir string
+
+	// Env holds KEY=value variables added to the environment of the target host.
+	Env []string
+}
+
+// IsLocal reports whether t applies changes to this host.
+func IsLocal(t Transport) bool {
+	_, ok := t.(*Local)
+	return ok
+}
+
+// HostPath returns the path on this host of a path of the target, for actions that
+// access files with the os package: the path itself for Local and the path under
+// the root, following symlinks, for Chroot. Other targets are not on this host.
+func HostPath(t Transport, path string) (string, error) {
+	switch t := t.(type) {
+	case *Local:
+		return path, nil
+	case *Chroot:
+		return t.resolve(path, true)
+	}
+	return "", fmt.Errorf("%s is not on this host", t)
+}
+
+// SameFile reports whether two file infos returned by a transport describe the same file.
+func SameFile(fi1, fi2 os.FileInfo) bool {
+	r1, ok1 := fi1.(*fileInfo)
+	r2, ok2 := fi2.(*fileInfo)
+	if ok1 || ok2 {
+		return ok1 && ok2 && r1.dev == r2.dev && r1.ino == r2.ino
+	}
+	return os.SameFile(fi1, fi2)
+}
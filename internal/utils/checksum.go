@@ -78,3 +78,23 @@ func VerifyChecksum(path, expected string) (bool, error) {
 
 	return actual == expected, nil
 }
+
+// VerifyDataChecksum verifies the checksum of data against an expected value,
+// like VerifyChecksum.
+func VerifyDataChecksum(data []byte, expected string) (bool, error) {
+	var actual string
+
+	switch len(expected) {
+	case 64: // SHA256
+		sum := sha256.Sum256(data)
+		actual = hex.EncodeToString(sum[:])
+	case 32: // MD5
+		// #nosec G401 -- MD5 used for integrity checks, not security
+		sum := md5.Sum(data)
+		actual = hex.EncodeToString(sum[:])
+	default:
+		return false, fmt.Errorf("unsupported checksum format (expected 32 or 64 hex characters, got %d)", len(expected))
+	}
+
+	return actual == expected, nil
+}
@@ -0,0 +1,75 @@
+package vault
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+// PasswordEnvVar is the environment variable holding the vault password.
+const PasswordEnvVar = "MOONCAKE_VAULT_PASSWORD"
+
+// keyring holds the password of the encrypted files read by Open.
+var keyring struct {
+	mu       sync.Mutex
+	provider security.PasswordProvider
+	password string // Cached once a file was decrypted with it
+	opened   bool   // An encrypted file was decrypted
+}
+
+// SetPasswordProvider sets the provider of the password of the files read by
+// Open. It's only asked for the password when the first encrypted file is
+// opened.
+func SetPasswordProvider(provider security.PasswordProvider) {
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+	keyring.provider = provider
+	keyring.password = ""
+}
+
+// SetPassword sets the password of the files read by Open, such as a password
+// prompted for before the run.
+func SetPassword(password string) {
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+	keyring.provider = nil
+	keyring.password = password
+}
+
+// Open returns the content of a file, decrypted if it's encrypted, and whether
+// it was.
+func Open(data []byte) ([]byte, bool, error) {
+	if !IsEncrypted(data) {
+		return data, false, nil
+	}
+
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+	if keyring.password != "" {
+		plaintext, err := Decrypt(data, keyring.password)
+		keyring.opened = keyring.opened || err == nil
+		return plaintext, true, err
+	}
+	if keyring.provider == nil {
+		return nil, true, fmt.Errorf("file is encrypted: set a vault password with --vault-password-file or $%s", PasswordEnvVar)
+	}
+	password, err := keyring.provider.GetPassword()
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to get vault password (%s): %w", keyring.provider.Source(), err)
+	}
+	plaintext, err := Decrypt(data, password)
+	if err != nil {
+		return nil, true, err
+	}
+	keyring.password = password
+	keyring.opened = true
+	return plaintext, true, nil
+}
+
+// Decrypted reports whether Open decrypted a file.
+func Decrypted() bool {
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+	return keyring.opened
+}
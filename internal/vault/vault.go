@@ -0,0 +1,120 @@
+// Package vault encrypts variables files, so secrets can be kept next to the
+// configs that use them.
+//
+// An encrypted file is a header line followed by the base64 encoding of the
+// scrypt salt, the AES-256-GCM nonce and the ciphertext, wrapped at 76
+// columns:
+//
+//	$MOONCAKE_VAULT;1;AES256-GCM;SCRYPT
+//	c2FsdHNhbHRzYWx0c2FsdG5vbmNlbm9uY2Vu...
+//
+// The key is derived from the password with scrypt (N=32768, r=8, p=1). The
+// header is authenticated with the ciphertext.
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Header is the first line of encrypted files.
+const Header = "$MOONCAKE_VAULT;1;AES256-GCM;SCRYPT"
+
+const (
+	saltSize  = 16
+	nonceSize = 12 // Standard GCM nonce
+	tagSize   = 16 // Standard GCM tag
+	keySize   = 32
+	lineWidth = 76
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrWrongPassword is returned when a file can't be decrypted with the password.
+var ErrWrongPassword = errors.New("wrong vault password, or the file was modified")
+
+// IsEncrypted reports whether data is an encrypted file.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Header+"\n")) || bytes.Equal(bytes.TrimRight(data, "\r\n"), []byte(Header))
+}
+
+// Encrypt encrypts plaintext with password.
+func Encrypt(plaintext []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, fmt.Errorf("vault password is empty")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := newAEAD(password, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	payload := append(append(salt, nonce...), aead.Seal(nil, nonce, plaintext, []byte(Header))...)
+	encoded := base64.StdEncoding.EncodeToString(payload)
+
+	var out bytes.Buffer
+	out.WriteString(Header + "\n")
+	for len(encoded) > lineWidth {
+		out.WriteString(encoded[:lineWidth] + "\n")
+		encoded = encoded[lineWidth:]
+	}
+	out.WriteString(encoded + "\n")
+	return out.Bytes(), nil
+}
+
+// Decrypt decrypts an encrypted file with password.
+func Decrypt(data []byte, password string) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, fmt.Errorf("not an encrypted file: missing %s header", Header)
+	}
+	body := strings.Join(strings.Fields(string(data[len(Header):])), "")
+	payload, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted file: %w", err)
+	}
+
+	if len(payload) < saltSize+nonceSize+tagSize {
+		return nil, fmt.Errorf("invalid encrypted file: truncated")
+	}
+
+	aead, err := newAEAD(password, payload[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	nonce := payload[saltSize : saltSize+nonceSize]
+	plaintext, err := aead.Open(nil, nonce, payload[saltSize+nonceSize:], []byte(Header))
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+	return plaintext, nil
+}
+
+// newAEAD returns the AES-256-GCM cipher of the key derived from password and salt.
+func newAEAD(password string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
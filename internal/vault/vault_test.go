@@ -0,0 +1,120 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alehatsman/mooncake/internal/security"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	plaintext := []byte("api_token: s3cr3t-t0ken\nssh_key: |\n  -----BEGIN KEY-----\n  abcdef\n")
+	encrypted, err := Encrypt(plaintext, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) || bytes.Contains(encrypted, []byte("s3cr3t")) {
+		t.Fatalf("Encrypt() = %s", encrypted)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(encrypted)), "\n") {
+		if len(line) > lineWidth {
+			t.Errorf("line of %d characters, want at most %d", len(line), lineWidth)
+		}
+	}
+
+	decrypted, err := Decrypt(encrypted, "correct horse")
+	if err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypt() = %q, %v", decrypted, err)
+	}
+	if _, err := Decrypt(encrypted, "wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Decrypt() with a wrong password error = %v", err)
+	}
+
+	// Encrypting twice gives different files: salt and nonce are random
+	again, _ := Encrypt(plaintext, "correct horse")
+	if bytes.Equal(again, encrypted) {
+		t.Error("Encrypt() is deterministic")
+	}
+	if _, err := Encrypt(plaintext, ""); err == nil {
+		t.Error("Encrypt() with an empty password succeeded")
+	}
+}
+
+func TestDecrypt_Invalid(t *testing.T) {
+	encrypted, err := Encrypt([]byte("a: 1\n"), "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(encrypted), "\n")
+	tampered := []byte(lines[0] + "\n" + strings.Replace(lines[1], lines[1][20:21], flip(lines[1][20]), 1) + "\n" + strings.Join(lines[2:], "\n"))
+
+	for name, data := range map[string][]byte{
+		"plaintext": []byte("a: 1\n"),
+		"truncated": []byte(Header + "\nc2FsdA==\n"),
+		"base64":    []byte(Header + "\n!!!\n"),
+		"tampered":  tampered,
+	} {
+		if _, err := Decrypt(data, "pw"); err == nil {
+			t.Errorf("Decrypt(%s) succeeded", name)
+		}
+	}
+}
+
+// flip returns another base64 character.
+func flip(c byte) string {
+	if c == 'A' {
+		return "B"
+	}
+	return "A"
+}
+
+func TestOpen(t *testing.T) {
+	t.Cleanup(func() { SetPasswordProvider(nil) })
+	encrypted, err := Encrypt([]byte("a: 1\n"), "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetPasswordProvider(nil)
+	if data, isEncrypted, err := Open([]byte("a: 1\n")); err != nil || isEncrypted || string(data) != "a: 1\n" {
+		t.Errorf("Open(plaintext) = %q, %v, %v", data, isEncrypted, err)
+	}
+	if _, _, err := Open(encrypted); err == nil || !strings.Contains(err.Error(), PasswordEnvVar) {
+		t.Errorf("Open() without a password error = %v", err)
+	}
+	if Decrypted() {
+		t.Error("Decrypted() = true before a file was decrypted")
+	}
+
+	provider := &countingProvider{password: "pw"}
+	SetPasswordProvider(provider)
+	for range 2 {
+		if data, isEncrypted, err := Open(encrypted); err != nil || !isEncrypted || string(data) != "a: 1\n" {
+			t.Errorf("Open() = %q, %v, %v", data, isEncrypted, err)
+		}
+	}
+	if provider.calls != 1 || !Decrypted() {
+		t.Errorf("provider asked %d times (decrypted: %v), want once", provider.calls, Decrypted())
+	}
+
+	SetPassword("wrong")
+	if _, _, err := Open(encrypted); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Open() with a wrong password error = %v", err)
+	}
+}
+
+type countingProvider struct {
+	password string
+	calls    int
+}
+
+func (p *countingProvider) GetPassword() (string, error) {
+	p.calls++
+	return p.password, nil
+}
+
+func (p *countingProvider) Source() string { return "test" }
+
+var _ security.PasswordProvider = (*countingProvider)(nil)
@@ -0,0 +1,6 @@
+// Package version holds the mooncake version, set at build time.
+package version
+
+// Version is the mooncake release version. Release builds set it with
+// -ldflags "-X github.com/alehatsman/mooncake/internal/version.Version=...".
+var Version = "dev"